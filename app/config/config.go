@@ -3,8 +3,10 @@ package config
 import (
 	"fmt"
 	"log"
+	"net"
 	"net/netip"
 	"net/url"
+	"regexp"
 	"strings"
 
 	"github.com/spf13/viper"
@@ -14,6 +16,7 @@ type Config struct {
 	Server        ServerConfig       `mapstructure:"server" json:"server"`
 	Site          SiteConfig         `mapstructure:"site" json:"site"`
 	Webhook       WebhookConfig      `mapstructure:"webhook" json:"webhook"`
+	Metrics       MetricsConfig      `mapstructure:"metrics" json:"metrics"`
 	Notifications NotificationConfig `mapstructure:"notifications" json:"notifications"`
 	Log           LogConfig          `mapstructure:"log" json:"log"`
 	JWT           JWTConfig          `mapstructure:"jwt" json:"jwt"`
@@ -45,6 +48,7 @@ const (
 	NotificationEventAppSecurity   = "security.filmfusion_brute_force"
 	NotificationEventRSSMatched    = "rss.matched"
 	NotificationEventWeb115Invalid = "storage.115_cookie_invalid"
+	NotificationEventBalanceHealth = "storage.balance_member_health"
 )
 
 // SiteConfig 保存可安全展示给未登录用户的站点外观配置。
@@ -67,6 +71,8 @@ type SiteConfig struct {
 // webhook 密钥不得复用管理后台密码。
 type WebhookConfig struct {
 	CloudDrive2 CloudDrive2WebhookConfig `mapstructure:"clouddrive2" json:"clouddrive2"`
+	// Arr Sonarr/Radarr/qBittorrent 等下载管理器的 webhook
+	Arr ArrWebhookConfig `mapstructure:"arr" json:"arr"`
 }
 
 type CloudDrive2WebhookConfig struct {
@@ -74,6 +80,19 @@ type CloudDrive2WebhookConfig struct {
 	Token   string `mapstructure:"token" json:"token"`
 }
 
+// ArrWebhookConfig 同时接受 Bearer Token 与 Basic 认证(密码即 Token)，
+// 便于直接填写 Sonarr/Radarr Webhook 的用户名/密码字段。
+type ArrWebhookConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"` // 是否启用 Webhook；关闭时端点返回 404，开启时必须配置 Token
+	Token   string `mapstructure:"token" json:"token"`
+}
+
+// MetricsConfig 控制 Prometheus /metrics 端点，启用时必须使用独立 Bearer Token 抓取。
+type MetricsConfig struct {
+	Enabled bool   `mapstructure:"enabled" json:"enabled"`
+	Token   string `mapstructure:"token" json:"token"`
+}
+
 type ServerConfig struct {
 	Port                   string              `mapstructure:"port" json:"port"`
 	Username               string              `mapstructure:"username" json:"username"`
@@ -120,6 +139,7 @@ type NotificationRoutesConfig struct {
 	SystemBruteForce    []string `mapstructure:"system_brute_force" json:"system_brute_force"`
 	RSSMatched          []string `mapstructure:"rss_matched" json:"rss_matched"`
 	Web115CookieInvalid []string `mapstructure:"web_115_cookie_invalid" json:"web_115_cookie_invalid"`
+	BalanceMemberHealth []string `mapstructure:"balance_member_health" json:"balance_member_health"`
 }
 
 func (r NotificationRoutesConfig) Channels(event string) []string {
@@ -132,6 +152,8 @@ func (r NotificationRoutesConfig) Channels(event string) []string {
 		return append([]string(nil), r.RSSMatched...)
 	case NotificationEventWeb115Invalid:
 		return append([]string(nil), r.Web115CookieInvalid...)
+	case NotificationEventBalanceHealth:
+		return append([]string(nil), r.BalanceMemberHealth...)
 	default:
 		return nil
 	}
@@ -140,7 +162,8 @@ func (r NotificationRoutesConfig) Channels(event string) []string {
 func (c NotificationConfig) IsZero() bool {
 	return strings.TrimSpace(c.InstanceName) == "" && c.Telegram.IsZero() && c.Webhook.IsZero() &&
 		len(c.Routes.EmbyBruteForce) == 0 && len(c.Routes.SystemBruteForce) == 0 &&
-		len(c.Routes.RSSMatched) == 0 && len(c.Routes.Web115CookieInvalid) == 0
+		len(c.Routes.RSSMatched) == 0 && len(c.Routes.Web115CookieInvalid) == 0 &&
+		len(c.Routes.BalanceMemberHealth) == 0
 }
 
 // TelegramChannelConfig 只包含 Telegram 自身的投递参数。
@@ -203,6 +226,64 @@ type EmbyConfig struct {
 	Security            LoginSecurityConfig         `mapstructure:"security" json:"security"`                             // Emby 登录防爆破配置
 	Cover               EmbyCoverConfig             `mapstructure:"cover" json:"cover"`                                   // 媒体库封面生成器配置
 	ImageOptimization   EmbyImageOptimizationConfig `mapstructure:"image_optimization" json:"image_optimization"`         // Emby 图片尺寸与质量控制
+	ProxyLog            EmbyProxyLogConfig          `mapstructure:"proxy_log" json:"proxy_log"`                           // 302 播放记录持久化保留策略
+	StreamProxy         EmbyStreamProxyConfig       `mapstructure:"stream_proxy" json:"stream_proxy"`                     // 不支持 302 的客户端改由服务端中转播放
+	DownloadURLCache    EmbyDownloadURLCacheConfig  `mapstructure:"download_url_cache" json:"download_url_cache"`         // 直链缓存后端
+}
+
+// 直链缓存后端
+const (
+	DownloadURLCacheMemory = "memory" // 进程内，重启后失效
+	DownloadURLCacheSQLite = "sqlite" // 写入本地数据库，重启后仍可用
+	DownloadURLCacheRedis  = "redis"  // Redis 兼容服务，可在多个实例间共享
+)
+
+// EmbyDownloadURLCacheConfig 直链缓存后端配置，缓存时间仍由 cache_time 与直链自身的过期参数决定。
+type EmbyDownloadURLCacheConfig struct {
+	Backend string               `mapstructure:"backend" json:"backend"`
+	Redis   EmbyRedisCacheConfig `mapstructure:"redis" json:"redis"`
+}
+
+// EmbyRedisCacheConfig Redis 兼容服务的连接参数
+type EmbyRedisCacheConfig struct {
+	Addr      string `mapstructure:"addr" json:"addr"` // host:port
+	Password  string `mapstructure:"password" json:"password"`
+	DB        int    `mapstructure:"db" json:"db"`
+	KeyPrefix string `mapstructure:"key_prefix" json:"key_prefix"`
+}
+
+func (c EmbyDownloadURLCacheConfig) IsZero() bool {
+	return c == (EmbyDownloadURLCacheConfig{})
+}
+
+// EmbyStreamProxyRule 命中规则的播放请求不返回 302，由 Film Fusion 拉取直链后转发给客户端。
+// Client 与 Emby 客户端名称不区分大小写比较，UserAgent 为正则表达式；两者都填写时需同时满足。
+type EmbyStreamProxyRule struct {
+	Name      string `mapstructure:"name" json:"name"`
+	Enabled   bool   `mapstructure:"enabled" json:"enabled"`
+	Client    string `mapstructure:"client" json:"client"`
+	UserAgent string `mapstructure:"user_agent" json:"user_agent"`
+}
+
+// EmbyStreamProxyConfig 中转播放配置；MaxConcurrent 为同时中转的连接上限，0 表示不限制。
+type EmbyStreamProxyConfig struct {
+	Enabled       bool                  `mapstructure:"enabled" json:"enabled"`
+	MaxConcurrent int                   `mapstructure:"max_concurrent" json:"max_concurrent"`
+	Rules         []EmbyStreamProxyRule `mapstructure:"rules" json:"rules"`
+}
+
+func (c EmbyStreamProxyConfig) IsZero() bool {
+	return !c.Enabled && c.MaxConcurrent == 0 && len(c.Rules) == 0
+}
+
+// EmbyProxyLogConfig 302/回退播放记录的保留策略；0 表示不按该维度清理。
+type EmbyProxyLogConfig struct {
+	RetentionDays int `mapstructure:"retention_days" json:"retention_days"` // 保留天数
+	MaxRows       int `mapstructure:"max_rows" json:"max_rows"`             // 最多保留条数，超出删除最旧的
+}
+
+func (c EmbyProxyLogConfig) IsZero() bool {
+	return c == (EmbyProxyLogConfig{})
 }
 
 // LoginSecurityConfig 控制登录接口的失败计数与临时封禁。
@@ -212,7 +293,7 @@ type LoginSecurityConfig struct {
 	MaxFailuresPerAccountIP int      `mapstructure:"max_failures_per_account_ip" json:"max_failures_per_account_ip"`
 	MaxFailuresPerIP        int      `mapstructure:"max_failures_per_ip" json:"max_failures_per_ip"`
 	BlockMinutes            int      `mapstructure:"block_minutes" json:"block_minutes"`
-	TrustedProxyCIDRs       []string `mapstructure:"trusted_proxy_cidrs" json:"trusted_proxy_cidrs"`
+	TrustedProxyCIDRs       []string `mapstructure:"trusted_proxy_cidrs" json:"trusted_proxy_cidrs"` // 可信反向代理，仅其转发的 X-Forwarded-For 会被采用；Emby 播放路由的网络与 IP 条件同样使用
 }
 
 func (c LoginSecurityConfig) IsZero() bool {
@@ -357,6 +438,10 @@ func Save(c *Config) error {
 
 	viper.Set("webhook.clouddrive2.enabled", c.Webhook.CloudDrive2.Enabled)
 	viper.Set("webhook.clouddrive2.token", c.Webhook.CloudDrive2.Token)
+	viper.Set("webhook.arr.enabled", c.Webhook.Arr.Enabled)
+	viper.Set("webhook.arr.token", c.Webhook.Arr.Token)
+	viper.Set("metrics.enabled", c.Metrics.Enabled)
+	viper.Set("metrics.token", c.Metrics.Token)
 
 	viper.Set("log.level", c.Log.Level)
 	viper.Set("log.format", c.Log.Format)
@@ -374,6 +459,7 @@ func Save(c *Config) error {
 	viper.Set("notifications.routes.system_brute_force", c.Notifications.Routes.SystemBruteForce)
 	viper.Set("notifications.routes.rss_matched", c.Notifications.Routes.RSSMatched)
 	viper.Set("notifications.routes.web_115_cookie_invalid", c.Notifications.Routes.Web115CookieInvalid)
+	viper.Set("notifications.routes.balance_member_health", c.Notifications.Routes.BalanceMemberHealth)
 	viper.Set("notifications.telegram.enabled", c.Notifications.Telegram.Enabled)
 	viper.Set("notifications.telegram.bot_token", c.Notifications.Telegram.BotToken)
 	viper.Set("notifications.telegram.chat_id", c.Notifications.Telegram.ChatID)
@@ -416,6 +502,14 @@ func Save(c *Config) error {
 	setEmbyImageRule("emby.image_optimization.detail_logo", c.Emby.ImageOptimization.DetailLogo)
 	setEmbyImageRule("emby.image_optimization.detail_backdrop", c.Emby.ImageOptimization.DetailBackdrop)
 	setEmbyImageRule("emby.image_optimization.other", c.Emby.ImageOptimization.Other)
+	viper.Set("emby.proxy_log.retention_days", c.Emby.ProxyLog.RetentionDays)
+	viper.Set("emby.proxy_log.max_rows", c.Emby.ProxyLog.MaxRows)
+	setEmbyStreamProxy("emby.stream_proxy", c.Emby.StreamProxy)
+	viper.Set("emby.download_url_cache.backend", c.Emby.DownloadURLCache.Backend)
+	viper.Set("emby.download_url_cache.redis.addr", c.Emby.DownloadURLCache.Redis.Addr)
+	viper.Set("emby.download_url_cache.redis.password", c.Emby.DownloadURLCache.Redis.Password)
+	viper.Set("emby.download_url_cache.redis.db", c.Emby.DownloadURLCache.Redis.DB)
+	viper.Set("emby.download_url_cache.redis.key_prefix", c.Emby.DownloadURLCache.Redis.KeyPrefix)
 
 	viper.Set("emby.cover.enabled", c.Emby.Cover.Enabled)
 	viper.Set("emby.cover.cron", c.Emby.Cover.Cron)
@@ -472,6 +566,21 @@ func setEmbyImageRule(prefix string, rule EmbyImageRuleConfig) {
 	viper.Set(prefix+".quality", rule.Quality)
 }
 
+func setEmbyStreamProxy(prefix string, settings EmbyStreamProxyConfig) {
+	viper.Set(prefix+".enabled", settings.Enabled)
+	viper.Set(prefix+".max_concurrent", settings.MaxConcurrent)
+	rules := make([]map[string]any, 0, len(settings.Rules))
+	for _, rule := range settings.Rules {
+		rules = append(rules, map[string]any{
+			"name":       rule.Name,
+			"enabled":    rule.Enabled,
+			"client":     rule.Client,
+			"user_agent": rule.UserAgent,
+		})
+	}
+	viper.Set(prefix+".rules", rules)
+}
+
 func setLoginSecurity(prefix string, settings LoginSecurityConfig) {
 	viper.Set(prefix+".enabled", settings.Enabled)
 	viper.Set(prefix+".window_minutes", settings.WindowMinutes)
@@ -506,6 +615,12 @@ func setDefaults() {
 	// CloudDrive2 webhook 默认关闭，必须显式设置独立 Token 后开启。
 	viper.SetDefault("webhook.clouddrive2.enabled", false)
 	viper.SetDefault("webhook.clouddrive2.token", "")
+	viper.SetDefault("webhook.arr.enabled", false)
+	viper.SetDefault("webhook.arr.token", "")
+
+	// /metrics 默认关闭
+	viper.SetDefault("metrics.enabled", false)
+	viper.SetDefault("metrics.token", "")
 
 	// Telegram 告警默认配置
 	viper.SetDefault("telegram.enabled", false)
@@ -574,6 +689,15 @@ func setDefaults() {
 	setDefaultEmbyImageRule("emby.image_optimization.detail_logo", true, 600, 152, 85)
 	setDefaultEmbyImageRule("emby.image_optimization.detail_backdrop", true, 1920, 1080, 70)
 	setDefaultEmbyImageRule("emby.image_optimization.other", false, 0, 0, 80)
+	viper.SetDefault("emby.proxy_log.retention_days", 30)
+	viper.SetDefault("emby.proxy_log.max_rows", 200000)
+	viper.SetDefault("emby.stream_proxy.enabled", false)
+	viper.SetDefault("emby.stream_proxy.max_concurrent", 4)
+	viper.SetDefault("emby.download_url_cache.backend", DownloadURLCacheMemory)
+	viper.SetDefault("emby.download_url_cache.redis.addr", "")
+	viper.SetDefault("emby.download_url_cache.redis.password", "")
+	viper.SetDefault("emby.download_url_cache.redis.db", 0)
+	viper.SetDefault("emby.download_url_cache.redis.key_prefix", "filmfusion:")
 
 	// Emby Cover 默认配置
 	viper.SetDefault("emby.cover.enabled", false)
@@ -685,6 +809,7 @@ func defaultNotificationConfig() NotificationConfig {
 			SystemBruteForce:    []string{NotificationChannelTelegram},
 			RSSMatched:          []string{NotificationChannelTelegram},
 			Web115CookieInvalid: []string{NotificationChannelTelegram},
+			BalanceMemberHealth: []string{NotificationChannelTelegram},
 		},
 		Telegram: TelegramChannelConfig{
 			APIBase: "https://api.telegram.org", TimeoutSeconds: 10,
@@ -778,6 +903,9 @@ func applyNotificationDefaults(cfg *Config) {
 	if !viper.InConfig("notifications.routes.web_115_cookie_invalid") {
 		settings.Routes.Web115CookieInvalid = defaults.Routes.Web115CookieInvalid
 	}
+	if !viper.InConfig("notifications.routes.balance_member_health") {
+		settings.Routes.BalanceMemberHealth = defaults.Routes.BalanceMemberHealth
+	}
 	if !viper.InConfig("notifications.telegram.api_base") {
 		settings.Telegram.APIBase = defaults.Telegram.APIBase
 	}
@@ -818,6 +946,7 @@ func NormalizeNotificationConfig(settings *NotificationConfig) {
 	settings.Routes.SystemBruteForce = normalizeNotificationRoute(settings.Routes.SystemBruteForce)
 	settings.Routes.RSSMatched = normalizeNotificationRoute(settings.Routes.RSSMatched)
 	settings.Routes.Web115CookieInvalid = normalizeNotificationRoute(settings.Routes.Web115CookieInvalid)
+	settings.Routes.BalanceMemberHealth = normalizeNotificationRoute(settings.Routes.BalanceMemberHealth)
 }
 
 func normalizeNotificationRoute(channels []string) []string {
@@ -947,6 +1076,9 @@ func validateConfig(config *Config) error {
 	if err := ValidateWebhook(config.Webhook); err != nil {
 		return err
 	}
+	if err := ValidateMetrics(config.Metrics); err != nil {
+		return err
+	}
 	return nil
 }
 
@@ -1049,6 +1181,68 @@ func ValidateWebhook(settings WebhookConfig) error {
 	if settings.CloudDrive2.Enabled && len(strings.TrimSpace(settings.CloudDrive2.Token)) < 32 {
 		return fmt.Errorf("CloudDrive2 Webhook 鉴权启用时 Token 至少需要 32 个字符")
 	}
+	if settings.Arr.Enabled && len(strings.TrimSpace(settings.Arr.Token)) < 32 {
+		return fmt.Errorf("Sonarr/Radarr Webhook 启用时 Token 至少需要 32 个字符")
+	}
+	return nil
+}
+
+// ValidateMetrics 校验 /metrics 抓取 Token
+func ValidateMetrics(settings MetricsConfig) error {
+	if settings.Enabled && len(strings.TrimSpace(settings.Token)) < 32 {
+		return fmt.Errorf("Prometheus 指标端点启用时 Token 至少需要 32 个字符")
+	}
+	return nil
+}
+
+// ValidateEmbyProxyLog 校验 302 播放记录保留策略
+func ValidateEmbyProxyLog(settings EmbyProxyLogConfig) error {
+	if settings.RetentionDays < 0 || settings.MaxRows < 0 {
+		return fmt.Errorf("302 播放记录的保留天数和最大条数不能为负数")
+	}
+	return nil
+}
+
+// ValidateEmbyDownloadURLCache 校验直链缓存后端；redis 需要 host:port 形式的地址
+func ValidateEmbyDownloadURLCache(settings EmbyDownloadURLCacheConfig) error {
+	switch strings.ToLower(strings.TrimSpace(settings.Backend)) {
+	case "", DownloadURLCacheMemory, DownloadURLCacheSQLite:
+	case DownloadURLCacheRedis:
+		addr := strings.TrimSpace(settings.Redis.Addr)
+		if addr == "" {
+			return fmt.Errorf("直链缓存使用 redis 时必须填写地址")
+		}
+		if _, _, err := net.SplitHostPort(addr); err != nil {
+			return fmt.Errorf("直链缓存 redis 地址无效，应为 host:port: %v", err)
+		}
+		if settings.Redis.DB < 0 {
+			return fmt.Errorf("直链缓存 redis 数据库编号不能为负数")
+		}
+	default:
+		return fmt.Errorf("不支持的直链缓存后端: %s", settings.Backend)
+	}
+	return nil
+}
+
+// ValidateEmbyStreamProxy 校验中转播放规则：启用的规则至少要限定客户端或 User-Agent，UA 需为合法正则
+func ValidateEmbyStreamProxy(settings EmbyStreamProxyConfig) error {
+	if settings.MaxConcurrent < 0 {
+		return fmt.Errorf("中转播放并发上限不能为负数")
+	}
+	for i, rule := range settings.Rules {
+		name := strings.TrimSpace(rule.Name)
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+		if rule.Enabled && strings.TrimSpace(rule.Client) == "" && strings.TrimSpace(rule.UserAgent) == "" {
+			return fmt.Errorf("中转播放规则 %s 需要填写客户端名称或 User-Agent", name)
+		}
+		if ua := strings.TrimSpace(rule.UserAgent); ua != "" {
+			if _, err := regexp.Compile(ua); err != nil {
+				return fmt.Errorf("中转播放规则 %s 的 User-Agent 正则无效: %v", name, err)
+			}
+		}
+	}
 	return nil
 }
 
@@ -1095,6 +1289,7 @@ func ValidateNotifications(settings NotificationConfig) error {
 		NotificationEventAppSecurity:   settings.Routes.SystemBruteForce,
 		NotificationEventRSSMatched:    settings.Routes.RSSMatched,
 		NotificationEventWeb115Invalid: settings.Routes.Web115CookieInvalid,
+		NotificationEventBalanceHealth: settings.Routes.BalanceMemberHealth,
 	} {
 		for _, channel := range channels {
 			switch strings.ToLower(strings.TrimSpace(channel)) {
@@ -22,6 +22,13 @@ func TestValidateWebhook(t *testing.T) {
 				Enabled: true, Token: "0123456789abcdef0123456789abcdef",
 			}},
 		},
+		{
+			name: "arr enabled with short token",
+			config: WebhookConfig{Arr: ArrWebhookConfig{
+				Enabled: true, Token: "too-short",
+			}},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -43,15 +43,27 @@ func AutoMigrate() error {
 		&model.OrganizeSourceFolderDeletionTask{},
 		&model.Download115Queue{},
 		&model.PickcodeCache{},
+		&model.DownloadURLCache{},
+		&model.CloudTreeSnapshotEntry{},
+		&model.CloudTreeSnapshotState{},
+		&model.StrmPlaybackTokenVersion{},
 		&model.Match302{},
 		&model.Match302BalanceMember{},
 		&model.Match302BalanceAssignment{},
+		&model.Match302BalanceHealthCheck{},
+		&model.Match302Fallback{},
 		&model.EmbyAccountBinding{},
+		&model.EmbyUserPlaybackLimit{},
+		&model.EmbyPlaybackRoute{},
+		&model.EmbyUserPlaybackUsage{},
 		&model.Web115AppVersionCache{},
 		&model.MediaTask{},
 		&model.EmbyCoverLibrary{},
 		&model.OrganizeLog{},
+		&model.EmbyProxyLog{},
 		&model.OrganizePreviewTask{},
+		&model.OrganizeBatch{},
+		&model.OrganizeBatchItem{},
 		&model.EmbyMissingEpisode{},
 		&model.EmbyMissingBlacklist{},
 		&model.EmbyMissingSetting{},
@@ -62,6 +74,7 @@ func AutoMigrate() error {
 		&model.EmbyWatchSetting{},
 		&model.RSSAutomationSource{},
 		&model.RSSAutomationWorkflow{},
+		&model.RSSAutomationSubWorkflow{},
 		&model.RSSAutomationTarget{},
 		&model.RSSAutomationEntry{},
 		&model.RSSAutomationRun{},
@@ -101,22 +101,28 @@ func (h *AppConfigHandler) Get(c *gin.Context) {
 	}
 	v.Telegram = config.LegacyTelegramFromNotifications(v.Notifications)
 	secrets := gin.H{
-		"server.password":                  h.cfg.Server.Password != "",
-		"webhook.clouddrive2.token":        h.cfg.Webhook.CloudDrive2.Token != "",
-		"emby.api_key":                     h.cfg.Emby.APIKey != "",
-		"moviepilot.password":              h.cfg.MoviePilot.Password != "",
-		"tmdb.api_key":                     h.cfg.TMDB.APIKey != "",
-		"tmdb.access_token":                h.cfg.TMDB.AccessToken != "",
-		"notifications.telegram.bot_token": h.cfg.Notifications.Telegram.BotToken != "",
-		"notifications.webhook.token":      h.cfg.Notifications.Webhook.Token != "",
-		"telegram.bot_token":               h.cfg.Notifications.Telegram.BotToken != "",
-		"hdhive.api_key":                   h.cfg.HDHive.APIKey != "",
-		"hdhive.access_token":              h.cfg.HDHive.AccessToken != "",
-		"hdhive.refresh_token":             h.cfg.HDHive.RefreshToken != "",
+		"server.password":                        h.cfg.Server.Password != "",
+		"webhook.clouddrive2.token":              h.cfg.Webhook.CloudDrive2.Token != "",
+		"webhook.arr.token":                      h.cfg.Webhook.Arr.Token != "",
+		"metrics.token":                          h.cfg.Metrics.Token != "",
+		"emby.api_key":                           h.cfg.Emby.APIKey != "",
+		"emby.download_url_cache.redis.password": h.cfg.Emby.DownloadURLCache.Redis.Password != "",
+		"moviepilot.password":                    h.cfg.MoviePilot.Password != "",
+		"tmdb.api_key":                           h.cfg.TMDB.APIKey != "",
+		"tmdb.access_token":                      h.cfg.TMDB.AccessToken != "",
+		"notifications.telegram.bot_token":       h.cfg.Notifications.Telegram.BotToken != "",
+		"notifications.webhook.token":            h.cfg.Notifications.Webhook.Token != "",
+		"telegram.bot_token":                     h.cfg.Notifications.Telegram.BotToken != "",
+		"hdhive.api_key":                         h.cfg.HDHive.APIKey != "",
+		"hdhive.access_token":                    h.cfg.HDHive.AccessToken != "",
+		"hdhive.refresh_token":                   h.cfg.HDHive.RefreshToken != "",
 	}
 	v.Server.Password = ""
 	v.Webhook.CloudDrive2.Token = ""
+	v.Webhook.Arr.Token = ""
+	v.Metrics.Token = ""
 	v.Emby.APIKey = ""
+	v.Emby.DownloadURLCache.Redis.Password = ""
 	v.MoviePilot.Password = ""
 	v.TMDB.APIKey = ""
 	v.TMDB.AccessToken = ""
@@ -196,6 +202,15 @@ func (h *AppConfigHandler) Update(c *gin.Context) {
 	if in.Emby.Security.IsZero() {
 		in.Emby.Security = h.cfg.Emby.Security
 	}
+	if in.Emby.ProxyLog.IsZero() {
+		in.Emby.ProxyLog = h.cfg.Emby.ProxyLog
+	}
+	if in.Emby.StreamProxy.IsZero() {
+		in.Emby.StreamProxy = h.cfg.Emby.StreamProxy
+	}
+	if in.Emby.DownloadURLCache.IsZero() {
+		in.Emby.DownloadURLCache = h.cfg.Emby.DownloadURLCache
+	}
 	if in.Server.Security.IsZero() {
 		in.Server.Security = h.cfg.Server.Security
 	}
@@ -214,11 +229,20 @@ func (h *AppConfigHandler) Update(c *gin.Context) {
 	if strings.TrimSpace(in.Webhook.CloudDrive2.Token) == "" {
 		in.Webhook.CloudDrive2.Token = h.cfg.Webhook.CloudDrive2.Token
 	}
+	if strings.TrimSpace(in.Webhook.Arr.Token) == "" {
+		in.Webhook.Arr.Token = h.cfg.Webhook.Arr.Token
+	}
+	if strings.TrimSpace(in.Metrics.Token) == "" {
+		in.Metrics.Token = h.cfg.Metrics.Token
+	}
 	// JWT 签名由服务内部管理，不接受 API 输入。
 	in.JWT.Secret = h.cfg.JWT.Secret
 	if strings.TrimSpace(in.Emby.APIKey) == "" {
 		in.Emby.APIKey = h.cfg.Emby.APIKey
 	}
+	if strings.TrimSpace(in.Emby.DownloadURLCache.Redis.Password) == "" {
+		in.Emby.DownloadURLCache.Redis.Password = h.cfg.Emby.DownloadURLCache.Redis.Password
+	}
 	if strings.TrimSpace(in.MoviePilot.Password) == "" {
 		in.MoviePilot.Password = h.cfg.MoviePilot.Password
 	}
@@ -351,6 +375,18 @@ func (h *AppConfigHandler) Update(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, err.Error())
 		return
 	}
+	if err := config.ValidateEmbyProxyLog(in.Emby.ProxyLog); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	if err := config.ValidateEmbyStreamProxy(in.Emby.StreamProxy); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	if err := config.ValidateEmbyDownloadURLCache(in.Emby.DownloadURLCache); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
 	if err := config.ValidateLoginSecurity("FilmFusion", in.Server.Security); err != nil {
 		h.error(c, http.StatusBadRequest, 400, err.Error())
 		return
@@ -363,6 +399,10 @@ func (h *AppConfigHandler) Update(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, err.Error())
 		return
 	}
+	if err := config.ValidateMetrics(in.Metrics); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
 
 	// 计算需重启才能生效的变更项
 	restart := make([]string, 0, 4)
@@ -387,6 +427,9 @@ func (h *AppConfigHandler) Update(c *gin.Context) {
 	if in.Server.Download115Concurrency != h.cfg.Server.Download115Concurrency {
 		restart = append(restart, "115 下载并发数")
 	}
+	if in.Emby.DownloadURLCache != h.cfg.Emby.DownloadURLCache {
+		restart = append(restart, "直链缓存后端")
+	}
 
 	// 外观、115 与 RSS 自动化运行配置写入 system_configs；这些值不再写回 YAML。
 	if err := h.saveConfigAndSiteSettings(&in); err != nil {
@@ -2,7 +2,9 @@ package handler
 
 import (
 	"film-fusion/app/database"
+	"film-fusion/app/logger"
 	"film-fusion/app/model"
+	"film-fusion/app/service"
 	"io/fs"
 	"net/http"
 	"os"
@@ -16,11 +18,13 @@ import (
 )
 
 // CloudPathHandler 云盘路径处理器
-type CloudPathHandler struct{}
+type CloudPathHandler struct {
+	logger *logger.Logger
+}
 
 // NewCloudPathHandler 创建云盘路径处理器
-func NewCloudPathHandler() *CloudPathHandler {
-	return &CloudPathHandler{}
+func NewCloudPathHandler(log *logger.Logger) *CloudPathHandler {
+	return &CloudPathHandler{logger: log}
 }
 
 // 创建成功响应
@@ -71,6 +75,10 @@ func (h *CloudPathHandler) CreateCloudPath(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, "无效的源类型")
 		return
 	}
+	if req.SourceType == model.SourceTypeLocalWatch && strings.TrimSpace(req.WatchPath) == "" {
+		h.error(c, http.StatusBadRequest, 400, "本地挂载监听需要设置监听目录")
+		return
+	}
 
 	// 验证STRM内容类型（如果是STRM链接类型且提供了内容类型）
 	if req.LinkType == model.LinkTypeStrm && req.StrmContentType != "" {
@@ -79,6 +87,20 @@ func (h *CloudPathHandler) CreateCloudPath(c *gin.Context) {
 			return
 		}
 	}
+	if req.StrmContentType == model.StrmContentTypeTemplate {
+		if err := service.ValidateStrmTemplate(req.ContentTemplate); err != nil {
+			h.error(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+	}
+	if !model.IsValidMediaInfoSidecar(req.MediaInfoSidecar) {
+		h.error(c, http.StatusBadRequest, 400, "无效的媒体信息文件格式")
+		return
+	}
+	if err := service.ValidateStrmPlaybackTokenTTL(req.PlaybackTokenTTLHours, req.ReconcileIntervalHours); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
 
 	// 验证云存储是否存在且属于当前用户
 	var cloudStorage model.CloudStorage
@@ -234,6 +256,20 @@ func (h *CloudPathHandler) UpdateCloudPath(c *gin.Context) {
 		LinkType         string `json:"link_type"`
 		FilterRules      string `json:"filter_rules"`
 		StrmContentType  string `json:"strm_content_type"`
+		// ContentTemplate/ContentSignKey 使用指针以允许置空
+		ContentTemplate *string `json:"content_template"`
+		ContentSignKey  *string `json:"content_sign_key"`
+		// PlaybackTokenTTLHours 签名播放令牌有效期，0 表示不过期
+		PlaybackTokenTTLHours *int `json:"playback_token_ttl_hours"`
+		// MediaInfoSidecar 媒体信息旁路文件格式，空字符串表示关闭
+		MediaInfoSidecar *string `json:"mediainfo_sidecar"`
+		// ArrPathPrefix 下载管理器上报路径前缀，空字符串表示不接收
+		ArrPathPrefix *string `json:"arr_path_prefix"`
+		// WatchPath/WatchRescanMinutes 仅 local_watch 使用
+		WatchPath          *string `json:"watch_path"`
+		WatchRescanMinutes *int    `json:"watch_rescan_minutes"`
+		// ReconcileIntervalHours 使用指针区分未设置与 0(关闭定时对账)
+		ReconcileIntervalHours *int `json:"reconcile_interval_hours"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.error(c, http.StatusBadRequest, 400, err.Error())
@@ -260,6 +296,18 @@ func (h *CloudPathHandler) UpdateCloudPath(c *gin.Context) {
 		}
 	}
 
+	// 模板类型需校验模板(以更新后的值为准)
+	contentTemplate := path.ContentTemplate
+	if req.ContentTemplate != nil {
+		contentTemplate = *req.ContentTemplate
+	}
+	if req.StrmContentType == model.StrmContentTypeTemplate {
+		if err := service.ValidateStrmTemplate(contentTemplate); err != nil {
+			h.error(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+	}
+
 	// 如果链接类型从STRM改为其他类型，清空STRM相关字段
 	if req.LinkType != "" && req.LinkType != model.LinkTypeStrm && path.LinkType == model.LinkTypeStrm {
 		req.StrmContentType = ""
@@ -315,6 +363,56 @@ func (h *CloudPathHandler) UpdateCloudPath(c *gin.Context) {
 	if req.StrmContentType != path.StrmContentType {
 		updates["strm_content_type"] = req.StrmContentType
 	}
+	if req.ContentTemplate != nil {
+		updates["content_template"] = *req.ContentTemplate
+	}
+	if req.ContentSignKey != nil {
+		updates["content_sign_key"] = *req.ContentSignKey
+	}
+	// 有效期与对账间隔以更新后的值一起校验
+	ttlHours, reconcileIntervalHours := path.PlaybackTokenTTLHours, path.ReconcileIntervalHours
+	if req.PlaybackTokenTTLHours != nil {
+		ttlHours = *req.PlaybackTokenTTLHours
+		updates["playback_token_ttl_hours"] = ttlHours
+	}
+	if req.ReconcileIntervalHours != nil {
+		if *req.ReconcileIntervalHours < 0 {
+			h.error(c, http.StatusBadRequest, 400, "对账间隔不能为负数")
+			return
+		}
+		reconcileIntervalHours = *req.ReconcileIntervalHours
+		updates["reconcile_interval_hours"] = reconcileIntervalHours
+	}
+	if err := service.ValidateStrmPlaybackTokenTTL(ttlHours, reconcileIntervalHours); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	if req.MediaInfoSidecar != nil {
+		if !model.IsValidMediaInfoSidecar(*req.MediaInfoSidecar) {
+			h.error(c, http.StatusBadRequest, 400, "无效的媒体信息文件格式")
+			return
+		}
+		updates["media_info_sidecar"] = *req.MediaInfoSidecar
+	}
+	if req.ArrPathPrefix != nil {
+		updates["arr_path_prefix"] = strings.TrimSpace(*req.ArrPathPrefix)
+	}
+	watchPath := path.WatchPath
+	if req.WatchPath != nil {
+		watchPath = strings.TrimSpace(*req.WatchPath)
+		updates["watch_path"] = watchPath
+	}
+	if (req.SourceType == model.SourceTypeLocalWatch || (req.SourceType == "" && path.SourceType == model.SourceTypeLocalWatch)) && watchPath == "" {
+		h.error(c, http.StatusBadRequest, 400, "本地挂载监听需要设置监听目录")
+		return
+	}
+	if req.WatchRescanMinutes != nil {
+		if *req.WatchRescanMinutes < 0 {
+			h.error(c, http.StatusBadRequest, 400, "重扫间隔不能为负数")
+			return
+		}
+		updates["watch_rescan_minutes"] = *req.WatchRescanMinutes
+	}
 
 	if err := database.DB.Model(&path).Updates(updates).Error; err != nil {
 		h.error(c, http.StatusInternalServerError, 500, "更新路径失败")
@@ -574,6 +672,11 @@ func (h *CloudPathHandler) GetSourceTypes(c *gin.Context) {
 			"label": "MoviePilot2",
 			"desc":  "使用 MoviePilot2 作为数据源",
 		},
+		{
+			"value": model.SourceTypeLocalWatch,
+			"label": "本地挂载监听",
+			"desc":  "监听本地挂载目录(rclone/CD2 FUSE)的文件变化",
+		},
 	}
 
 	h.success(c, sourceTypes, "获取源类型成功")
@@ -592,6 +695,16 @@ func (h *CloudPathHandler) GetStrmContentTypes(c *gin.Context) {
 			"label": "Path",
 			"desc":  "使用直接路径格式的STRM内容",
 		},
+		{
+			"value": model.StrmContentTypeTemplate,
+			"label": "Template",
+			"desc":  "使用自定义模板生成STRM内容，可引用 {{.Path}} {{.PickCode}} {{.SHA1}} {{.Sign}} 等变量",
+		},
+		{
+			"value": model.StrmContentTypeSigned,
+			"label": "Signed",
+			"desc":  "指向 Film Fusion 的签名播放地址(内容前缀填 Emby 代理地址)，可设置有效期并随时吊销",
+		},
 	}
 
 	h.success(c, contentTypes, "获取STRM内容类型成功")
@@ -645,6 +758,20 @@ func (h *CloudPathHandler) ValidateCloudPath(c *gin.Context) {
 			return
 		}
 	}
+	if req.StrmContentType == model.StrmContentTypeTemplate {
+		if err := service.ValidateStrmTemplate(req.ContentTemplate); err != nil {
+			h.error(c, http.StatusBadRequest, 400, err.Error())
+			return
+		}
+	}
+	if !model.IsValidMediaInfoSidecar(req.MediaInfoSidecar) {
+		h.error(c, http.StatusBadRequest, 400, "无效的媒体信息文件格式")
+		return
+	}
+	if err := service.ValidateStrmPlaybackTokenTTL(req.PlaybackTokenTTLHours, req.ReconcileIntervalHours); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
 
 	// 验证云存储是否存在且属于当前用户
 	var cloudStorage model.CloudStorage
@@ -780,6 +907,16 @@ func (h *CloudPathHandler) ImportPaths(c *gin.Context) {
 			LinkType        string `json:"link_type"`
 			FilterRules     string `json:"filter_rules"`
 			StrmContentType string `json:"strm_content_type"`
+			ContentTemplate string `json:"content_template"`
+			ContentSignKey  string `json:"content_sign_key"`
+			// 签名播放令牌有效期(小时)，需配合定时对账间隔
+			PlaybackTokenTTLHours  int    `json:"playback_token_ttl_hours"`
+			ReconcileIntervalHours int    `json:"reconcile_interval_hours"`
+			MediaInfoSidecar       string `json:"mediainfo_sidecar"`
+			ArrPathPrefix          string `json:"arr_path_prefix"`
+			WatchPath              string `json:"watch_path"`
+			// 0 或缺省时使用默认重扫间隔
+			WatchRescanMinutes int `json:"watch_rescan_minutes"`
 		} `json:"paths"`
 		ReplaceExisting bool `json:"replace_existing"`
 	}
@@ -819,6 +956,11 @@ func (h *CloudPathHandler) ImportPaths(c *gin.Context) {
 			errors = append(errors, "第"+strconv.Itoa(i+1)+"条: 无效的源类型")
 			continue
 		}
+		if sourceType == model.SourceTypeLocalWatch && strings.TrimSpace(pathData.WatchPath) == "" {
+			errorCount++
+			errors = append(errors, "第"+strconv.Itoa(i+1)+"条: 本地挂载监听需要设置监听目录")
+			continue
+		}
 
 		if pathData.LinkType == model.LinkTypeStrm && pathData.StrmContentType != "" {
 			if !model.IsValidStrmContentType(pathData.StrmContentType) {
@@ -827,6 +969,23 @@ func (h *CloudPathHandler) ImportPaths(c *gin.Context) {
 				continue
 			}
 		}
+		if pathData.StrmContentType == model.StrmContentTypeTemplate {
+			if err := service.ValidateStrmTemplate(pathData.ContentTemplate); err != nil {
+				errorCount++
+				errors = append(errors, "第"+strconv.Itoa(i+1)+"条: "+err.Error())
+				continue
+			}
+		}
+		if !model.IsValidMediaInfoSidecar(pathData.MediaInfoSidecar) {
+			errorCount++
+			errors = append(errors, "第"+strconv.Itoa(i+1)+"条: 无效的媒体信息文件格式")
+			continue
+		}
+		if err := service.ValidateStrmPlaybackTokenTTL(max(pathData.PlaybackTokenTTLHours, 0), max(pathData.ReconcileIntervalHours, 0)); err != nil {
+			errorCount++
+			errors = append(errors, "第"+strconv.Itoa(i+1)+"条: "+err.Error())
+			continue
+		}
 
 		// 验证云存储是否存在且属于当前用户
 		var cloudStorage model.CloudStorage
@@ -860,6 +1019,15 @@ func (h *CloudPathHandler) ImportPaths(c *gin.Context) {
 			LinkType:        pathData.LinkType,
 			FilterRules:     pathData.FilterRules,
 			StrmContentType: pathData.StrmContentType,
+			ContentTemplate: pathData.ContentTemplate,
+			ContentSignKey:  pathData.ContentSignKey,
+			// 负数按不过期处理
+			PlaybackTokenTTLHours:  max(pathData.PlaybackTokenTTLHours, 0),
+			ReconcileIntervalHours: max(pathData.ReconcileIntervalHours, 0),
+			MediaInfoSidecar:       pathData.MediaInfoSidecar,
+			ArrPathPrefix:          strings.TrimSpace(pathData.ArrPathPrefix),
+			WatchPath:              strings.TrimSpace(pathData.WatchPath),
+			WatchRescanMinutes:     max(pathData.WatchRescanMinutes, 0),
 		}
 
 		if err := database.DB.Create(&newPath).Error; err != nil {
@@ -882,7 +1050,9 @@ func (h *CloudPathHandler) ImportPaths(c *gin.Context) {
 	h.success(c, result, "导入完成")
 }
 
-// ReplaceStrmContent 批量替换指定路径下所有 STRM 文件内容
+// ReplaceStrmContent 批量替换指定路径下所有 STRM 文件内容。
+// 传入 template 时不做字符串替换，而是按新模板重新渲染 SourcePath 下已有的 STRM；save=true 时同时保存模板。
+// rerender=true 时按当前保存的内容设置重新渲染，例如吊销签名播放令牌后重新签发。
 func (h *CloudPathHandler) ReplaceStrmContent(c *gin.Context) {
 	userID, exists := c.Get("user_id")
 	if !exists {
@@ -894,6 +1064,7 @@ func (h *CloudPathHandler) ReplaceStrmContent(c *gin.Context) {
 	var path model.CloudPath
 
 	if err := database.DB.Where("id = ? AND user_id = ?", id, userID.(uint)).
+		Preload("CloudStorage").
 		First(&path).Error; err != nil {
 		if err == gorm.ErrRecordNotFound {
 			h.error(c, http.StatusNotFound, 404, "路径不存在")
@@ -909,13 +1080,25 @@ func (h *CloudPathHandler) ReplaceStrmContent(c *gin.Context) {
 	}
 
 	var req struct {
-		From string `json:"from" binding:"required"`
-		To   string `json:"to" binding:"required"`
+		From     string  `json:"from"`
+		To       string  `json:"to"`
+		Template string  `json:"template"`
+		SignKey  *string `json:"sign_key"`
+		Save     bool    `json:"save"`
+		Rerender bool    `json:"rerender"`
 	}
 	if err := c.ShouldBindJSON(&req); err != nil {
 		h.error(c, http.StatusBadRequest, 400, err.Error())
 		return
 	}
+	if strings.TrimSpace(req.Template) != "" {
+		h.rerenderStrmTemplate(c, path, req.Template, req.SignKey, req.Save)
+		return
+	}
+	if req.Rerender {
+		h.rerenderStrm(c, path)
+		return
+	}
 	if req.From == "" {
 		h.error(c, http.StatusBadRequest, 400, "from 不能为空")
 		return
@@ -979,3 +1162,41 @@ func (h *CloudPathHandler) ReplaceStrmContent(c *gin.Context) {
 
 	h.success(c, result, "替换完成")
 }
+
+// rerenderStrmTemplate 按新模板重新渲染已有 STRM 文件
+func (h *CloudPathHandler) rerenderStrmTemplate(c *gin.Context, path model.CloudPath, template string, signKey *string, save bool) {
+	if err := service.ValidateStrmTemplate(template); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+	path.StrmContentType = model.StrmContentTypeTemplate
+	path.ContentTemplate = template
+	if signKey != nil {
+		path.ContentSignKey = *signKey
+	}
+
+	if save {
+		updates := map[string]interface{}{
+			"strm_content_type": path.StrmContentType,
+			"content_template":  path.ContentTemplate,
+			"content_sign_key":  path.ContentSignKey,
+			"updated_at":        time.Now(),
+		}
+		if err := database.DB.Model(&model.CloudPath{}).Where("id = ?", path.ID).Updates(updates).Error; err != nil {
+			h.error(c, http.StatusInternalServerError, 500, "保存模板失败")
+			return
+		}
+	}
+
+	h.rerenderStrm(c, path)
+}
+
+// rerenderStrm 按 path 的内容设置重新渲染已有 STRM 文件
+func (h *CloudPathHandler) rerenderStrm(c *gin.Context, path model.CloudPath) {
+	result, err := service.NewStrmService(h.logger, nil).RerenderStrm(path)
+	if err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "重新渲染 STRM 失败: "+err.Error())
+		return
+	}
+	h.success(c, result, "重新渲染完成")
+}
@@ -1,8 +1,11 @@
 package handler
 
 import (
+	"context"
+	"errors"
 	"film-fusion/app/database"
 	"film-fusion/app/model"
+	"film-fusion/app/service"
 	"net/http"
 	"strconv"
 	"time"
@@ -64,6 +67,10 @@ func (h *CloudStorageHandler) CreateCloudStorage(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, "Match302 访问方式无效")
 		return
 	}
+	if !service.IsSupportedStorageType(req.StorageType) {
+		h.error(c, http.StatusBadRequest, 400, "不支持的存储类型")
+		return
+	}
 
 	// 获取当前用户ID（从JWT中间件获取）
 	userID, exists := c.Get("user_id")
@@ -356,21 +363,31 @@ func (h *CloudStorageHandler) RefreshToken(c *gin.Context) {
 		return
 	}
 
-	// TODO: 这里需要根据不同的存储类型实现具体的令牌刷新逻辑
-	// 示例：根据存储类型调用相应的API刷新令牌
-	switch storage.StorageType {
-	case model.StorageType115Open:
-		// 调用115的令牌刷新API
-		// newAccessToken, newRefreshToken, expiresIn := refresh115Token(storage.RefreshToken)
-		// storage.UpdateTokens(newAccessToken, newRefreshToken, expiresIn)
-	default:
+	drv, err := service.NewStorageDriver(storage, nil)
+	if err != nil {
 		h.error(c, http.StatusBadRequest, 400, "不支持的存储类型")
 		return
 	}
-
-	// 更新最后刷新时间
-	now := time.Now()
-	storage.LastRefreshAt = &now
+	ctx, cancel := context.WithTimeout(c.Request.Context(), 30*time.Second)
+	defer cancel()
+	token, err := drv.RefreshToken(ctx)
+	if errors.Is(err, service.ErrStorageOperationUnsupported) {
+		h.error(c, http.StatusBadRequest, 400, "该存储类型无需刷新令牌")
+		return
+	}
+	if err != nil {
+		storage.SetError(err)
+		if saveErr := database.DB.Save(&storage).Error; saveErr != nil {
+			h.error(c, http.StatusInternalServerError, 500, "令牌刷新失败: "+err.Error()+"；保存错误状态失败: "+saveErr.Error())
+			return
+		}
+		h.error(c, http.StatusBadGateway, 502, "令牌刷新失败: "+err.Error())
+		return
+	}
+	if storage.ProviderUID == "" && token.ProviderUID != "" {
+		storage.ProviderUID = token.ProviderUID
+	}
+	storage.UpdateTokens(token.AccessToken, token.RefreshToken, token.ExpiresIn)
 
 	if err := database.DB.Save(&storage).Error; err != nil {
 		h.error(c, http.StatusInternalServerError, 500, "更新令牌失败")
@@ -415,13 +432,7 @@ func (h *CloudStorageHandler) TestConnection(c *gin.Context) {
 
 // GetStorageTypes 获取支持的存储类型
 func (h *CloudStorageHandler) GetStorageTypes(c *gin.Context) {
-	types := []gin.H{
-		{
-			"type":        model.StorageType115Open,
-			"name":        "115网盘 Open API",
-			"description": "115网盘存储 Open API",
-		},
-	}
+	types := service.StorageDriverInfos()
 
 	h.success(c, types, "获取存储类型成功")
 }
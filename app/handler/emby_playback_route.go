@@ -0,0 +1,177 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmbyPlaybackRouteHandler 处理 Emby 播放路由规则(按客户端 / 网络 / 用户 / 媒体库 / 文件大小决定播放方式)的管理。
+type EmbyPlaybackRouteHandler struct {
+	logger *logger.Logger
+	router *service.EmbyPlaybackRouter
+}
+
+// NewEmbyPlaybackRouteHandler 构造
+func NewEmbyPlaybackRouteHandler(log *logger.Logger) *EmbyPlaybackRouteHandler {
+	return &EmbyPlaybackRouteHandler{logger: log, router: service.NewEmbyPlaybackRouter(log)}
+}
+
+func (h *EmbyPlaybackRouteHandler) success(c *gin.Context, data any, message string) {
+	c.JSON(http.StatusOK, ApiResponse{Code: 0, Message: message, Data: data})
+}
+
+func (h *EmbyPlaybackRouteHandler) error(c *gin.Context, statusCode int, errorCode int, message string) {
+	c.JSON(statusCode, ApiResponse{Code: errorCode, Message: message, Data: nil})
+}
+
+type embyPlaybackRoutePayload struct {
+	Name        string `json:"name"`
+	Enabled     *bool  `json:"enabled"`
+	Priority    int    `json:"priority"`
+	Network     string `json:"network"`
+	ClientCIDRs string `json:"client_cidrs"`
+	UserAgent   string `json:"user_agent"`
+	Client      string `json:"client"`
+	DeviceName  string `json:"device_name"`
+	EmbyUserIDs string `json:"emby_user_ids"`
+	Libraries   string `json:"libraries"`
+	MinSizeMB   int64  `json:"min_size_mb"`
+	MaxSizeMB   int64  `json:"max_size_mb"`
+	Action      string `json:"action"`
+	Remark      string `json:"remark"`
+}
+
+// bindRoute 解析请求体并写入 route，校验失败时已写出错误响应。
+func (h *EmbyPlaybackRouteHandler) bindRoute(c *gin.Context, route *model.EmbyPlaybackRoute) bool {
+	var payload embyPlaybackRoutePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		h.error(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return false
+	}
+	route.Name = payload.Name
+	route.Priority = payload.Priority
+	route.Network = payload.Network
+	route.ClientCIDRs = payload.ClientCIDRs
+	route.UserAgent = payload.UserAgent
+	route.Client = payload.Client
+	route.DeviceName = payload.DeviceName
+	route.EmbyUserIDs = payload.EmbyUserIDs
+	route.Libraries = payload.Libraries
+	route.MinSizeMB = payload.MinSizeMB
+	route.MaxSizeMB = payload.MaxSizeMB
+	route.Action = payload.Action
+	route.Remark = payload.Remark
+	if payload.Enabled != nil {
+		route.Enabled = *payload.Enabled
+	}
+	route.Normalize()
+	if err := route.Validate(); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return false
+	}
+	return true
+}
+
+// ListRoutes 获取所有播放路由规则，按匹配顺序排列。
+func (h *EmbyPlaybackRouteHandler) ListRoutes(c *gin.Context) {
+	var routes []model.EmbyPlaybackRoute
+	if err := database.DB.Order("priority ASC, id ASC").Find(&routes).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "获取播放路由规则失败")
+		return
+	}
+	h.success(c, routes, "获取播放路由规则成功")
+}
+
+// CreateRoute 新增播放路由规则。
+func (h *EmbyPlaybackRouteHandler) CreateRoute(c *gin.Context) {
+	route := model.EmbyPlaybackRoute{Enabled: true}
+	if !h.bindRoute(c, &route) {
+		return
+	}
+	if err := database.DB.Create(&route).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "创建播放路由规则失败: "+err.Error())
+		return
+	}
+	h.success(c, route, "创建播放路由规则成功")
+}
+
+// UpdateRoute 更新播放路由规则。
+func (h *EmbyPlaybackRouteHandler) UpdateRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的ID")
+		return
+	}
+
+	var route model.EmbyPlaybackRoute
+	if err := database.DB.First(&route, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			h.error(c, http.StatusNotFound, 404, "播放路由规则不存在")
+		} else {
+			h.error(c, http.StatusInternalServerError, 500, "获取播放路由规则失败")
+		}
+		return
+	}
+	if !h.bindRoute(c, &route) {
+		return
+	}
+	if err := database.DB.Save(&route).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "更新播放路由规则失败: "+err.Error())
+		return
+	}
+	h.success(c, route, "更新播放路由规则成功")
+}
+
+// DeleteRoute 删除播放路由规则。
+func (h *EmbyPlaybackRouteHandler) DeleteRoute(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的ID")
+		return
+	}
+	if err := database.DB.Delete(&model.EmbyPlaybackRoute{}, uint(id)).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "删除播放路由规则失败")
+		return
+	}
+	h.success(c, nil, "删除播放路由规则成功")
+}
+
+// TestRoute 用给定的请求条件试算命中的规则，不访问 Emby；未命中时 data.route 为 null，表示按默认 302 流程处理。
+func (h *EmbyPlaybackRouteHandler) TestRoute(c *gin.Context) {
+	var payload struct {
+		ClientIP    string `json:"client_ip"`
+		UserAgent   string `json:"user_agent"`
+		Client      string `json:"client"`
+		DeviceName  string `json:"device_name"`
+		EmbyUserID  string `json:"emby_user_id"`
+		LibraryID   string `json:"library_id"`
+		LibraryName string `json:"library_name"`
+		SizeMB      int64  `json:"size_mb"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		h.error(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return
+	}
+	route, err := h.router.Route(service.EmbyPlaybackRouteInput{
+		ClientIP:   payload.ClientIP,
+		UserAgent:  payload.UserAgent,
+		Client:     payload.Client,
+		DeviceName: payload.DeviceName,
+		Size:       payload.SizeMB * 1024 * 1024,
+		EmbyUserID: func() string { return payload.EmbyUserID },
+		Library:    func() (string, string) { return payload.LibraryID, payload.LibraryName },
+	})
+	if err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "评估播放路由规则失败: "+err.Error())
+		return
+	}
+	h.success(c, gin.H{"route": route}, "试算完成")
+}
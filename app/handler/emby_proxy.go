@@ -3,8 +3,6 @@ package handler
 import (
 	"bytes"
 	"context"
-	"crypto/md5"
-	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"film-fusion/app/config"
@@ -23,12 +21,10 @@ import (
 	"net/http/httputil"
 	"net/url"
 	"regexp"
-	"strconv"
 	"strings"
 	"time"
 
 	sdk115 "github.com/OpenListTeam/115-sdk-go"
-	driver "github.com/SheltonZhu/115driver/pkg/driver"
 	"github.com/gin-gonic/gin"
 	"github.com/patrickmn/go-cache"
 	"gorm.io/gorm"
@@ -65,16 +61,29 @@ type EmbyProxyHandler struct {
 	logger          *logger.Logger
 	proxy           *httputil.ReverseProxy
 	goCache         *cache.Cache
-	sdk115Open      *sdk115.Client
+	urlCache        service.DownloadURLCache
 	balanceSvc      *service.BalanceAssignmentService
-	web115Svc       *service.Web115Service
 	loginProtection *service.EmbyLoginProtection
+	proxyLogSvc     *service.EmbyProxyLogService
+	userLimitSvc    *service.EmbyUserLimitService
+	streamProxy     *service.EmbyStreamProxy
+	playbackRouter  *service.EmbyPlaybackRouter
+	storageDrivers  *service.StorageDriverCache
 }
 
 type embyLoginAttemptContextKey struct{}
 
+// embyUserContextKey 本次请求已解析出的 Emby 用户(embyhelper.EmbyUser)，避免重复解析
+const embyUserContextKey = "emby_proxy_user"
+
+// embyPlaybackRouteContextKey 本次播放请求命中的路由规则(model.EmbyPlaybackRoute)
+const embyPlaybackRouteContextKey = "emby_proxy_playback_route"
+
+// embyVirtualFoldersCacheKey 媒体库目录缓存，用于路由规则的媒体库条件
+const embyVirtualFoldersCacheKey = "emby_virtual_folders"
+
 // NewEmbyProxyHandler 创建新的Emby代理处理器
-func NewEmbyProxyHandler(cfg *config.Config, log *logger.Logger, loginProtection *service.EmbyLoginProtection) *EmbyProxyHandler {
+func NewEmbyProxyHandler(cfg *config.Config, log *logger.Logger, loginProtection *service.EmbyLoginProtection, proxyLogSvc *service.EmbyProxyLogService, streamProxy *service.EmbyStreamProxy) *EmbyProxyHandler {
 	// 解析Emby服务器URL
 	embyURL, err := url.Parse(cfg.Emby.URL)
 	if err != nil {
@@ -107,37 +116,31 @@ func NewEmbyProxyHandler(cfg *config.Config, log *logger.Logger, loginProtection
 	cacheExpiration := time.Duration(cfg.Emby.CacheTime) * time.Minute
 	goCache := cache.New(cacheExpiration, 10*time.Minute)
 
+	// 直链缓存可放在本地数据库或 Redis，重启或多实例时仍可复用未过期的直链
+	urlCache, err := service.NewDownloadURLCache(cfg.Emby.DownloadURLCache, log)
+	if err != nil {
+		log.Warnf("创建直链缓存失败，改用进程内缓存: %v", err)
+		urlCache = service.NewMemoryDownloadURLCache()
+	}
+
 	h := &EmbyProxyHandler{
 		config:          cfg,
 		logger:          log,
 		proxy:           proxy,
 		goCache:         goCache,
-		sdk115Open:      sdk115.New(),
+		urlCache:        urlCache,
 		balanceSvc:      balanceSvc,
-		web115Svc:       service.NewWeb115Service(log),
 		loginProtection: loginProtection,
+		proxyLogSvc:     proxyLogSvc,
+		userLimitSvc:    service.NewEmbyUserLimitService(log),
+		streamProxy:     streamProxy,
+		playbackRouter:  service.NewEmbyPlaybackRouter(log),
+		storageDrivers:  service.NewStorageDriverCache(log),
 	}
 	proxy.ModifyResponse = h.modifyResponse
 	return h
 }
 
-// md5CacheKey 生成MD5缓存键
-func (h *EmbyProxyHandler) md5CacheKey(input string) string {
-	// 创建一个 MD5 哈希实例
-	hash := md5.New()
-
-	// 写入数据
-	hash.Write([]byte(input))
-
-	// 获取哈希结果
-	hashBytes := hash.Sum(nil)
-
-	// 将结果转换为十六进制字符串
-	hashString := hex.EncodeToString(hashBytes)
-
-	return hashString
-}
-
 // removeQueryParams 移除URL中的查询参数
 func (h *EmbyProxyHandler) removeQueryParams(rawURL string) string {
 	u, err := url.Parse(rawURL)
@@ -159,7 +162,7 @@ func (h *EmbyProxyHandler) log302(c *gin.Context, source, target string) {
 		source, method, uri, ua, remote, target,
 	)
 
-	h.log302Entry(embyproxylog.Entry{
+	h.log302Entry(c, embyproxylog.Entry{
 		Source:    source,
 		Method:    method,
 		URI:       uri,
@@ -169,10 +172,23 @@ func (h *EmbyProxyHandler) log302(c *gin.Context, source, target string) {
 	})
 }
 
-func (h *EmbyProxyHandler) log302Entry(entry embyproxylog.Entry) {
+func (h *EmbyProxyHandler) log302Entry(c *gin.Context, entry embyproxylog.Entry) {
+	h.recordProxyEntry(c, entry)
+	embyplayback.Default().AttachRedirect(entry)
+}
+
+// recordProxyEntry 写入内存日志与持久化日志，但不登记播放会话；
+// 被拒绝的请求只走这里，否则重试时会被当作续播而绕过次数与并发限制。
+func (h *EmbyProxyHandler) recordProxyEntry(c *gin.Context, entry embyproxylog.Entry) {
 	if entry.Timestamp.IsZero() {
 		entry.Timestamp = time.Now()
 	}
+	if entry.EmbyUserID == "" {
+		if user, ok := embyUserFromContext(c); ok {
+			entry.EmbyUserID, entry.EmbyUserName = user.ID, user.Name
+		}
+	}
+	service.RecordEmbyPlaybackMetric(entry)
 	h.logger.Infof("[EMBY PROXY] 302 source=%s method=%s uri=%s status=%s assignment=%d actual_storage=%d fallback=%s -> %s",
 		entry.Source,
 		entry.Method,
@@ -184,7 +200,19 @@ func (h *EmbyProxyHandler) log302Entry(entry embyproxylog.Entry) {
 		entry.Target,
 	)
 	embyproxylog.Default().Append(entry)
-	embyplayback.Default().AttachRedirect(entry)
+
+	if h.proxyLogSvc == nil {
+		return
+	}
+	// 持久化前补全 Emby 用户；解析可能访问 Emby，放到请求之外执行
+	token, remoteIP := embyUserTokenFromRequest(c), c.ClientIP()
+	go func() {
+		if entry.EmbyUserID == "" {
+			user := h.resolveEmbyUser(token, entry.ItemID, remoteIP)
+			entry.EmbyUserID, entry.EmbyUserName = user.ID, user.Name
+		}
+		h.proxyLogSvc.Record(entry)
+	}()
 }
 
 // ProxyRequest 代理所有Emby请求的主要处理函数
@@ -227,10 +255,32 @@ func (h *EmbyProxyHandler) ProxyRequest(c *gin.Context) {
 		}
 	}
 
+	// Emby 用户播放限制：超限直接拒绝，不能回退到默认反代
+	if videoPlayURIRegex.MatchString(currentURI) && !h.admitEmbyUserPlayback(c) {
+		return
+	}
+
 	// 尝试代理播放请求
 	redirectURL, logEntry, skip, fallbackReason := h.proxyPlay(c)
+	route, routed := embyPlaybackRouteFromContext(c)
+	if routed && route.Action == model.EmbyPlaybackRouteActionDeny {
+		h.denyPlayback(c, route)
+		return
+	}
 	if !skip {
-		h.log302Entry(logEntry)
+		if routed && route.Action == model.EmbyPlaybackRouteActionStream && h.streamProxy != nil {
+			h.serveStream(c, redirectURL, logEntry, "路由规则:"+route.Name)
+			return
+		}
+		// 命中中转规则的客户端(部分电视 / DLNA 无法跟随跨域 302)由本服务转发直链数据；
+		// 路由规则明确要求 302 时不再按 User-Agent 中转
+		if !routed || route.Action != model.EmbyPlaybackRouteActionRedirect {
+			if rule, ok := h.streamProxy.Match(service.EmbyClientNameFromRequest(c.Request), c.Request.UserAgent()); ok {
+				h.serveStream(c, redirectURL, logEntry, rule.Name)
+				return
+			}
+		}
+		h.log302Entry(c, logEntry)
 		c.Redirect(http.StatusFound, redirectURL)
 		return
 	}
@@ -241,16 +291,59 @@ func (h *EmbyProxyHandler) ProxyRequest(c *gin.Context) {
 		if strings.TrimSpace(fallbackReason) == "" {
 			fallbackReason = "未命中 match302 / 缓存，走默认反代"
 		}
-		h.logFallback(c, fallbackReason)
+		h.logFallback(c, fallbackReason, logEntry.Attempts)
 	}
 
 	// 默认代理请求
 	h.proxy.ServeHTTP(c.Writer, c.Request)
 }
 
+// serveStream 中转播放：请求直链并把数据转发给客户端，沿用获取直链时的 User-Agent，115 账号附带 Cookie。
+// 中转连接数已满时返回 503，客户端稍后重试。
+func (h *EmbyProxyHandler) serveStream(c *gin.Context, target string, entry embyproxylog.Entry, ruleName string) {
+	streamTarget := service.EmbyStreamTarget{
+		URL:         target,
+		UserAgent:   c.Request.UserAgent(),
+		StorageID:   entry.ActualStorageID,
+		StorageName: entry.ActualStorageName,
+		ItemID:      entry.ItemID,
+		Client:      service.EmbyClientNameFromRequest(c.Request),
+		RemoteIP:    c.ClientIP(),
+		Rule:        ruleName,
+	}
+	if entry.ActualStorageID != 0 {
+		var storage model.CloudStorage
+		if err := database.DB.Select("id", "storage_type", "cookie").First(&storage, entry.ActualStorageID).Error; err == nil && storage.UsesPickcode() {
+			streamTarget.Cookie = strings.TrimSpace(storage.Cookie)
+		}
+	}
+
+	entry.Source = "stream"
+	h.log302Entry(c, entry)
+	h.logger.Infof("[EMBY PROXY] 中转播放 rule=%s client=%q item=%s storage=%d range=%q",
+		ruleName, streamTarget.Client, entry.ItemID, entry.ActualStorageID, c.GetHeader("Range"),
+	)
+
+	err := h.streamProxy.Serve(c.Writer, c.Request, streamTarget)
+	if errors.Is(err, service.ErrEmbyStreamProxyBusy) {
+		h.logger.Warnf("[EMBY PROXY] 中转播放连接数已满，拒绝 item=%s remote=%s", entry.ItemID, streamTarget.RemoteIP)
+		c.Header("Retry-After", "5")
+		c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{
+			"ResponseStatus": gin.H{
+				"ErrorCode": "TooManyStreams",
+				"Message":   err.Error(),
+			},
+		})
+		return
+	}
+	if err != nil {
+		h.logger.Warnf("[EMBY PROXY] 中转播放失败 item=%s: %v", entry.ItemID, err)
+	}
+}
+
 // logFallback 记录"播放请求未走 302、走了默认反代"的事件。
 // 复用同一份内存环形缓冲，但 source=fallback、target 为空、reason 描述原因。
-func (h *EmbyProxyHandler) logFallback(c *gin.Context, reason string) {
+func (h *EmbyProxyHandler) logFallback(c *gin.Context, reason string, attempts []embyproxylog.Attempt) {
 	method := c.Request.Method
 	uri := c.Request.RequestURI
 	ua := c.Request.UserAgent()
@@ -260,7 +353,7 @@ func (h *EmbyProxyHandler) logFallback(c *gin.Context, reason string) {
 		method, uri, ua, remote, reason,
 	)
 
-	h.log302Entry(embyproxylog.Entry{
+	entry := embyproxylog.Entry{
 		Source:         "fallback",
 		Method:         method,
 		URI:            uri,
@@ -268,7 +361,12 @@ func (h *EmbyProxyHandler) logFallback(c *gin.Context, reason string) {
 		RemoteIP:       remote,
 		Target:         reason,
 		FallbackReason: reason,
-	})
+		Attempts:       attempts,
+	}
+	if m := videoPlayURIRegex.FindStringSubmatch(c.Request.URL.Path); len(m) > 1 {
+		entry.ItemID = m[1]
+	}
+	h.log302Entry(c, entry)
 }
 
 func (h *EmbyProxyHandler) modifyResponse(resp *http.Response) error {
@@ -309,7 +407,7 @@ func (h *EmbyProxyHandler) preheatPlaybackInfo(requestURI string, body []byte) {
 			continue
 		}
 		match, matchedPath, err := h.balanceSvc.FindMatch(mediaPath)
-		if err != nil || match == nil || !match.BalanceEnabled {
+		if err != nil || match == nil || !match.BalanceEnabled || !match.CloudStorage.UsesPickcode() {
 			continue
 		}
 		err = h.balanceSvc.PreheatAssignment(context.Background(), service.BalancePlaybackRequest{
@@ -339,6 +437,10 @@ func (h *EmbyProxyHandler) handlePlaying(c *gin.Context, embyPath string) {
 	c.Request.Body = io.NopCloser(bytes.NewReader(body))
 
 	playEvent := h.parsePlayingEvent(c, body)
+	if h.userLimitSvc != nil && h.userLimitSvc.HasEnabledLimits() {
+		// 会话归属到用户，供并发数限制统计(包括未走 302 的播放)
+		playEvent.EmbyUserID = h.resolveEmbyUserByToken(embyUserTokenFromRequest(c)).ID
+	}
 	if strings.EqualFold(embyPath, "/Sessions/Playing") && playEvent.ItemID != "" {
 		if h.config.Emby.AddCurrentMediaInfo {
 			err := h.GETPlaybackInfo(playEvent.ItemID)
@@ -452,6 +554,10 @@ func (h *EmbyProxyHandler) proxyPlay(c *gin.Context) (string, embyproxylog.Entry
 
 	if err != nil {
 		h.logger.Errorf("获取 EmbyItems 错误: %v", err)
+		// 条目查询失败也要先评估路由规则，避免拒绝规则因拿不到媒体信息而放行
+		if reason, ok := h.applyPlaybackRoute(c, h.routePlayback(c, itemId, "", 0, true)); ok {
+			return "", baseEntry, true, reason
+		}
 		return "", baseEntry, true, "获取 EmbyItems 失败: " + err.Error()
 	}
 
@@ -462,6 +568,11 @@ func (h *EmbyProxyHandler) proxyPlay(c *gin.Context) (string, embyproxylog.Entry
 
 	h.logger.Infof("[EMBY PROXY] Emby 原地址: %s", embyPlayPath)
 
+	// 播放路由规则：emby / deny 不再走 302，stream 由 ProxyRequest 中转
+	if reason, ok := h.applyPlaybackRoute(c, h.routePlayback(c, itemId, embyPlayPath, embyRes.Size, false)); ok {
+		return "", baseEntry, true, reason
+	}
+
 	if strings.HasPrefix(embyPlayPath, "http") {
 		h.logger.Infof("[EMBY PROXY] Emby 播放地址是完整的 URL: %s", embyPlayPath)
 		baseEntry.Source = "proxyPlay"
@@ -503,7 +614,15 @@ func (h *EmbyProxyHandler) proxyPlay(c *gin.Context) (string, embyproxylog.Entry
 		return "", baseEntry, true, "Match302 负载均衡决策失败: " + err.Error()
 	}
 
-	redirectURL, fromCache, err := h.getDownloadURLForStorage(*decision.PlaybackStorage, decision.ActualPickCode, c.Request.UserAgent())
+	var redirectURL string
+	var fromCache bool
+	if match.CloudStorage.UsesPickcode() {
+		redirectURL, fromCache, err = h.getDownloadURLForStorage(*decision.PlaybackStorage, decision.ActualPickCode, c.Request.UserAgent())
+	} else {
+		redirectURL, fromCache, err = h.getDownloadURLByPath(*decision.PlaybackStorage, matchedPath, c.Request.UserAgent())
+	}
+	attempts := []embyproxylog.Attempt{newPlaybackAttempt(decision.PlaybackStorage, playbackAttemptPath(decision, matchedPath), playbackAttemptRole(decision), err)}
+	failReason := ""
 	if err != nil && decision.UseBalance && !decision.IsSourcePlayback {
 		if is115FileNotFound(err) && decision.Assignment != nil {
 			h.logger.Warnf("[EMBY PROXY] 子账号目标文件已删除(430004)，失效并重新秒传 assignment=%d", decision.Assignment.ID)
@@ -511,31 +630,235 @@ func (h *EmbyProxyHandler) proxyPlay(c *gin.Context) (string, embyproxylog.Entry
 		}
 		if decision.SourceStorage == nil {
 			h.logger.Warnf("[EMBY PROXY] 获取子账号直链失败，源账号信息缺失，无法回退: %v", err)
-			return "", baseEntry, true, "获取子账号直链失败，源账号信息缺失: " + err.Error()
-		}
-		if limitErr := h.balanceSvc.EnsureStrictStorageAllowed(decision.Match, decision.SourceStorage.ID, playbackReq); limitErr != nil {
+			failReason = "获取子账号直链失败，源账号信息缺失: " + err.Error()
+		} else if limitErr := h.balanceSvc.EnsureStrictStorageAllowed(decision.Match, decision.SourceStorage.ID, playbackReq); limitErr != nil {
 			h.logger.Warnf("[EMBY PROXY] 获取子账号直链失败，但严格模式不允许回退源账号: %v", limitErr)
-			return "", baseEntry, true, "获取子账号直链失败，严格模式不允许回退源账号: " + limitErr.Error()
+			failReason = "获取子账号直链失败，严格模式不允许回退源账号: " + limitErr.Error()
+		} else {
+			h.logger.Warnf("[EMBY PROXY] 获取子账号直链失败，回退源账号: %v", err)
+			decision.PlaybackStorage = decision.SourceStorage
+			decision.ActualPickCode = decision.SourceFile.PickCode
+			decision.IsSourcePlayback = true
+			decision.AccountType = "source"
+			decision.Status = "失败回退"
+			decision.FallbackReason = "获取子账号直链失败: " + err.Error()
+			redirectURL, fromCache, err = h.getDownloadURLForStorage(*decision.SourceStorage, decision.SourceFile.PickCode, c.Request.UserAgent())
+			attempts = append(attempts, newPlaybackAttempt(decision.SourceStorage, matchedPath, "source", err))
 		}
-		h.logger.Warnf("[EMBY PROXY] 获取子账号直链失败，回退源账号: %v", err)
-		decision.PlaybackStorage = decision.SourceStorage
-		decision.ActualPickCode = decision.SourceFile.PickCode
-		decision.IsSourcePlayback = true
-		decision.AccountType = "source"
-		decision.Status = "失败回退"
-		decision.FallbackReason = "获取子账号直链失败: " + err.Error()
-		redirectURL, fromCache, err = h.getDownloadURLForStorage(*decision.SourceStorage, decision.SourceFile.PickCode, c.Request.UserAgent())
 	}
 	if err != nil {
-		h.logger.Errorf("[EMBY PROXY] 获取下载URL失败: %v", err)
-		return "", baseEntry, true, "获取下载URL失败: " + err.Error()
+		if failReason == "" {
+			failReason = "获取下载URL失败: " + err.Error()
+		}
+		h.logger.Errorf("[EMBY PROXY] %s", failReason)
+		if redirectURL, entry, ok := h.tryMatch302Fallbacks(c, baseEntry, match, embyPlayPath, itemId, mediaSourceId, failReason, &attempts); ok {
+			return redirectURL, entry, false, ""
+		}
+		baseEntry.Attempts = attempts
+		return "", baseEntry, true, failReason
 	}
 
 	entry := h.buildPlaybackLogEntry(baseEntry, redirectURL, fromCache, itemId, mediaSourceId, embyPlayPath, decision)
+	entry.Attempts = attempts
 	h.logger.Infof("[EMBY PROXY] Match302 匹配成功，重定向到: %s", redirectURL)
 	return redirectURL, entry, false, ""
 }
 
+// tryMatch302Fallbacks 主存储(含负载均衡子账号与源账号回退)拿不到直链时，按顺序尝试规则配置的备用存储，
+// 每次尝试都追加到 attempts；全部失败时返回 false，由调用方走默认反代。
+func (h *EmbyProxyHandler) tryMatch302Fallbacks(c *gin.Context, baseEntry embyproxylog.Entry, match *model.Match302, embyPlayPath, itemID, mediaSourceID, reason string, attempts *[]embyproxylog.Attempt) (string, embyproxylog.Entry, bool) {
+	var fallbacks []model.Match302Fallback
+	if err := database.DB.Preload("CloudStorage").
+		Where("match302_id = ? AND enabled = ?", match.ID, true).
+		Order("sort_order ASC, id ASC").
+		Find(&fallbacks).Error; err != nil {
+		h.logger.Warnf("[EMBY PROXY] 查询 Match302 备用存储失败 match=%d err=%v", match.ID, err)
+		return "", baseEntry, false
+	}
+
+	userAgent := c.Request.UserAgent()
+	for _, fallback := range fallbacks {
+		storage := fallback.CloudStorage
+		matchedPath := fallback.MatchedPath(match, embyPlayPath)
+		if storage == nil || !storage.IsAvailable() || !service.IsSupportedStorageType(storage.StorageType) {
+			*attempts = append(*attempts, newPlaybackAttempt(storage, matchedPath, "fallback", fmt.Errorf("备用存储不可用")))
+			continue
+		}
+		redirectURL, fromCache, err := h.getFallbackDownloadURL(*storage, matchedPath, userAgent)
+		*attempts = append(*attempts, newPlaybackAttempt(storage, matchedPath, "fallback", err))
+		if err != nil {
+			h.logger.Warnf("[EMBY PROXY] 备用存储获取直链失败 match=%d storage=%d path=%s err=%v", match.ID, storage.ID, matchedPath, err)
+			continue
+		}
+
+		decision := &service.BalancePlaybackDecision{
+			Status:          "备用存储",
+			FallbackReason:  "主存储获取直链失败: " + reason,
+			Match:           match,
+			SourceStorage:   match.CloudStorage,
+			PlaybackStorage: storage,
+			AccountType:     "fallback",
+		}
+		entry := h.buildPlaybackLogEntry(baseEntry, redirectURL, fromCache, itemID, mediaSourceID, embyPlayPath, decision)
+		entry.Attempts = *attempts
+		h.logger.Infof("[EMBY PROXY] Match302 主存储失败，备用存储 %s 命中，重定向到: %s", storage.StorageName, redirectURL)
+		return redirectURL, entry, true
+	}
+	return "", baseEntry, false
+}
+
+// fallbackPickcodeCacheTTL 备用存储 pickcode 的内存缓存时间；文件被移动或改名后
+// 不一定触发 115 的文件不存在错误，过期后重新按路径解析。
+const fallbackPickcodeCacheTTL = 6 * time.Hour
+
+// getFallbackDownloadURL 获取备用存储上的直链。备用存储的 pickcode 不写入 PickcodeCache
+// (那里按 Emby 路径作 key，只对应主存储)，改为按存储 ID + 路径缓存在内存中。
+func (h *EmbyProxyHandler) getFallbackDownloadURL(storage model.CloudStorage, matchedPath, userAgent string) (string, bool, error) {
+	if !storage.UsesPickcode() {
+		return h.getDownloadURLByPath(storage, matchedPath, userAgent)
+	}
+	cacheKey := fmt.Sprintf("fallback-pickcode:%d:%s", storage.ID, matchedPath)
+	pickcode, _ := h.goCache.Get(cacheKey)
+	code, _ := pickcode.(string)
+	if code == "" {
+		resolved, err := h.fetchPickcodeForStorage(context.Background(), matchedPath, storage)
+		if err != nil {
+			return "", false, fmt.Errorf("获取 pickcode 失败: %w", err)
+		}
+		code = resolved
+		h.goCache.Set(cacheKey, code, fallbackPickcodeCacheTTL)
+	}
+	redirectURL, fromCache, err := h.getDownloadURLForStorage(storage, code, userAgent)
+	if err != nil && is115FileNotFound(err) {
+		h.goCache.Delete(cacheKey)
+	}
+	return redirectURL, fromCache, err
+}
+
+func newPlaybackAttempt(storage *model.CloudStorage, matchedPath, role string, err error) embyproxylog.Attempt {
+	attempt := embyproxylog.Attempt{Path: matchedPath, Role: role}
+	if storage != nil {
+		attempt.StorageID = storage.ID
+		attempt.StorageName = storage.StorageName
+	}
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+	return attempt
+}
+
+func playbackAttemptRole(decision *service.BalancePlaybackDecision) string {
+	if decision.UseBalance && !decision.IsSourcePlayback {
+		return "member"
+	}
+	return "primary"
+}
+
+func playbackAttemptPath(decision *service.BalancePlaybackDecision, matchedPath string) string {
+	if decision.Assignment != nil && !decision.IsSourcePlayback && decision.Assignment.TargetPath != "" {
+		return decision.Assignment.TargetPath
+	}
+	return matchedPath
+}
+
+// applyPlaybackRoute 记录命中的路由规则；emby / deny 不再走 302，返回回退原因与 true
+func (h *EmbyProxyHandler) applyPlaybackRoute(c *gin.Context, route *model.EmbyPlaybackRoute) (string, bool) {
+	if route == nil {
+		return "", false
+	}
+	c.Set(embyPlaybackRouteContextKey, *route)
+	switch route.Action {
+	case model.EmbyPlaybackRouteActionEmby:
+		return fmt.Sprintf("命中路由规则「%s」，由 Emby 播放", route.Name), true
+	case model.EmbyPlaybackRouteActionDeny:
+		return fmt.Sprintf("命中路由规则「%s」，拒绝播放", route.Name), true
+	}
+	return "", false
+}
+
+// routePlayback 按播放路由规则评估本次请求；未配置规则、未命中或评估出错时返回 nil 走默认流程。
+// itemUnknown 为 true 表示 Emby 条目查询失败，大小与媒体库条件无法判断（见 EmbyPlaybackRouteInput）
+func (h *EmbyProxyHandler) routePlayback(c *gin.Context, itemID, mediaPath string, size int64, itemUnknown bool) *model.EmbyPlaybackRoute {
+	if h.playbackRouter == nil {
+		return nil
+	}
+	// 不用 c.ClientIP()：gin 默认信任任意来源的 X-Forwarded-For，网络与 IP 条件只认 Emby 安全设置里的可信代理
+	clientIP := service.EmbyClientIP(c.Request, h.config.Emby.Security.TrustedProxyCIDRs)
+	route, err := h.playbackRouter.Route(service.EmbyPlaybackRouteInput{
+		ClientIP:    clientIP,
+		UserAgent:   c.Request.UserAgent(),
+		Client:      service.EmbyClientNameFromRequest(c.Request),
+		DeviceName:  service.EmbyDeviceNameFromRequest(c.Request),
+		Size:        size,
+		ItemUnknown: itemUnknown,
+		EmbyUserID:  func() string { return h.resolveEmbyUserID(c, itemID) },
+		Library:     func() (string, string) { return h.embyLibraryForPath(mediaPath) },
+	})
+	if err != nil {
+		h.logger.Warnf("[EMBY PROXY] 评估播放路由规则失败，按默认流程处理: %v", err)
+		return nil
+	}
+	if route != nil {
+		h.logger.Infof("[EMBY PROXY] 命中播放路由规则 id=%d name=%s action=%s item=%s remote=%s", route.ID, route.Name, route.Action, itemID, clientIP)
+	}
+	return route
+}
+
+// embyLibraryForPath 返回文件所属媒体库的 ID 与名称，媒体库目录按 Emby 缓存时间缓存
+func (h *EmbyProxyHandler) embyLibraryForPath(mediaPath string) (string, string) {
+	var folders []embyhelper.EmbyVirtualFolder
+	if cached, ok := h.goCache.Get(embyVirtualFoldersCacheKey); ok {
+		folders, _ = cached.([]embyhelper.EmbyVirtualFolder)
+	} else {
+		list, err := embyhelper.New(h.config).ListVirtualFolders()
+		if err != nil {
+			h.logger.Warnf("[EMBY PROXY] 获取媒体库目录失败: %v", err)
+			return "", ""
+		}
+		folders = list
+		h.goCache.Set(embyVirtualFoldersCacheKey, folders, h.userResolveCacheTTL())
+	}
+	folder, ok := service.EmbyLibraryForPath(folders, mediaPath)
+	if !ok {
+		return "", ""
+	}
+	return folder.ItemID, folder.Name
+}
+
+func embyPlaybackRouteFromContext(c *gin.Context) (model.EmbyPlaybackRoute, bool) {
+	v, exists := c.Get(embyPlaybackRouteContextKey)
+	if !exists {
+		return model.EmbyPlaybackRoute{}, false
+	}
+	route, ok := v.(model.EmbyPlaybackRoute)
+	return route, ok
+}
+
+// denyPlayback 路由规则拒绝播放：记录日志并返回 Emby 风格的 403
+func (h *EmbyProxyHandler) denyPlayback(c *gin.Context, route model.EmbyPlaybackRoute) {
+	message := fmt.Sprintf("播放被路由规则「%s」拒绝", route.Name)
+	entry := embyproxylog.Entry{
+		Source:         "denied",
+		Method:         c.Request.Method,
+		URI:            c.Request.RequestURI,
+		UserAgent:      c.Request.UserAgent(),
+		RemoteIP:       c.ClientIP(),
+		BalanceStatus:  "PlaybackRouteDenied",
+		FallbackReason: message,
+	}
+	if m := videoPlayURIRegex.FindStringSubmatch(c.Request.URL.Path); len(m) > 1 {
+		entry.ItemID = m[1]
+	}
+	h.recordProxyEntry(c, entry)
+	c.Header("X-Application-Error-Code", "PlaybackRouteDenied")
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"ResponseStatus": gin.H{
+			"ErrorCode": "PlaybackRouteDenied",
+			"Message":   message,
+		},
+	})
+}
+
 // resolveBoundStorageID 解析当前播放的 Emby 用户并返回其绑定的 115 存储ID。
 // 无法识别用户或未配置绑定时返回 0。
 func (h *EmbyProxyHandler) resolveBoundStorageID(c *gin.Context, itemID string) uint {
@@ -564,68 +887,135 @@ func (h *EmbyProxyHandler) resolveBoundStorageID(c *gin.Context, itemID string)
 // resolveEmbyUserID 解析当前播放用户ID：
 // 方案A 用请求 token 调 /Users/Me；A 取不到时用方案B 通过 /Sessions 反查兜底。
 func (h *EmbyProxyHandler) resolveEmbyUserID(c *gin.Context, itemID string) string {
-	if id := h.resolveEmbyUserIDByToken(embyUserTokenFromRequest(c)); id != "" {
-		return id
+	if user, ok := embyUserFromContext(c); ok {
+		return user.ID
+	}
+	return h.resolveEmbyUser(embyUserTokenFromRequest(c), itemID, c.ClientIP()).ID
+}
+
+func embyUserFromContext(c *gin.Context) (embyhelper.EmbyUser, bool) {
+	v, exists := c.Get(embyUserContextKey)
+	if !exists {
+		return embyhelper.EmbyUser{}, false
 	}
-	return h.resolveEmbyUserIDBySession(itemID, c.ClientIP())
+	user, ok := v.(embyhelper.EmbyUser)
+	return user, ok && user.ID != ""
 }
 
-// resolveEmbyUserIDByToken 方案A：用请求 token 调 /Users/Me，结果按 token 缓存。
-func (h *EmbyProxyHandler) resolveEmbyUserIDByToken(token string) string {
+// admitEmbyUserPlayback 按 Emby 用户限制校验播放请求；被拒绝时已写出 Emby 风格的错误响应并返回 false。
+// 无法识别用户或校验出错时放行，避免限制功能本身导致无法播放。
+func (h *EmbyProxyHandler) admitEmbyUserPlayback(c *gin.Context) bool {
+	if h.userLimitSvc == nil || !h.userLimitSvc.HasEnabledLimits() {
+		return true
+	}
+	_, itemID, _, mediaSourceID, _ := embyhelper.GetItemPathInfo(c, h.config)
+	remoteIP, userAgent := c.ClientIP(), c.Request.UserAgent()
+	user := h.resolveEmbyUser(embyUserTokenFromRequest(c), itemID, remoteIP)
+	if user.ID == "" {
+		return true
+	}
+	c.Set(embyUserContextKey, user)
+
+	sessionKey, resuming := embyplayback.Default().FindSessionKey(itemID, mediaSourceID, remoteIP, userAgent)
+	if !resuming {
+		sessionKey = embyproxylog.Entry{ItemID: itemID, MediaSourceID: mediaSourceID, RemoteIP: remoteIP, UserAgent: userAgent}.PlaybackKey()
+	}
+	err := h.userLimitSvc.Admit(user.ID, sessionKey, resuming, time.Now())
+	if err == nil {
+		return true
+	}
+	var limitErr *service.EmbyUserLimitError
+	if !errors.As(err, &limitErr) {
+		h.logger.Warnf("[EMBY PROXY] 校验 Emby 用户播放限制失败 user=%s，放行: %v", user.ID, err)
+		return true
+	}
+
+	h.logger.Infof("[EMBY PROXY] 拒绝播放 user=%s(%s) item=%s code=%s: %s", user.Name, user.ID, itemID, limitErr.Code, limitErr.Message)
+	h.recordProxyEntry(c, embyproxylog.Entry{
+		Source:         "limited",
+		Method:         c.Request.Method,
+		URI:            c.Request.RequestURI,
+		UserAgent:      userAgent,
+		RemoteIP:       remoteIP,
+		ItemID:         itemID,
+		MediaSourceID:  mediaSourceID,
+		BalanceStatus:  limitErr.Code,
+		FallbackReason: limitErr.Message,
+	})
+	c.Header("X-Application-Error-Code", limitErr.Code)
+	c.AbortWithStatusJSON(http.StatusForbidden, gin.H{
+		"ResponseStatus": gin.H{
+			"ErrorCode": limitErr.Code,
+			"Message":   limitErr.Message,
+		},
+	})
+	return false
+}
+
+// resolveEmbyUser 与 resolveEmbyUserID 相同，但同时返回用户名；参数由调用方预先从请求中取出，可在请求结束后异步调用。
+func (h *EmbyProxyHandler) resolveEmbyUser(token, itemID, remoteIP string) embyhelper.EmbyUser {
+	if user := h.resolveEmbyUserByToken(token); user.ID != "" {
+		return user
+	}
+	return h.resolveEmbyUserBySession(itemID, remoteIP)
+}
+
+// resolveEmbyUserByToken 方案A：用请求 token 调 /Users/Me，结果按 token 缓存。
+func (h *EmbyProxyHandler) resolveEmbyUserByToken(token string) embyhelper.EmbyUser {
 	token = strings.TrimSpace(token)
 	if token == "" {
-		return ""
+		return embyhelper.EmbyUser{}
 	}
 	// token 与管理员 APIKey 相同则无用户上下文，跳过(交给方案B)
 	if strings.TrimSpace(h.config.Emby.APIKey) != "" && token == strings.TrimSpace(h.config.Emby.APIKey) {
-		return ""
+		return embyhelper.EmbyUser{}
 	}
 
 	cacheKey := "emby-user-id:token:" + token
 	if v, found := h.goCache.Get(cacheKey); found {
-		if s, ok := v.(string); ok {
-			return s
+		if user, ok := v.(embyhelper.EmbyUser); ok {
+			return user
 		}
 	}
 	user, err := embyhelper.GetUserByToken(h.config, token)
 	if err != nil {
 		h.logger.Warnf("[EMBY PROXY] 解析 Emby 用户(token)失败: %v", err)
-		return "" // 出错不缓存，下次重试
+		return embyhelper.EmbyUser{} // 出错不缓存，下次重试
 	}
-	userID := ""
+	resolved := embyhelper.EmbyUser{}
 	if user != nil {
-		userID = user.ID
+		resolved = *user
 	}
-	h.goCache.Set(cacheKey, userID, h.userResolveCacheTTL())
-	return userID
+	h.goCache.Set(cacheKey, resolved, h.userResolveCacheTTL())
+	return resolved
 }
 
-// resolveEmbyUserIDBySession 方案B：通过 /Sessions 反查正在播放的用户(兜底)，按 item+IP 短时缓存。
-func (h *EmbyProxyHandler) resolveEmbyUserIDBySession(itemID, remoteIP string) string {
+// resolveEmbyUserBySession 方案B：通过 /Sessions 反查正在播放的用户(兜底)，按 item+IP 短时缓存。
+func (h *EmbyProxyHandler) resolveEmbyUserBySession(itemID, remoteIP string) embyhelper.EmbyUser {
 	itemID = strings.TrimSpace(itemID)
 	remoteIP = strings.TrimSpace(remoteIP)
 	if itemID == "" && remoteIP == "" {
-		return ""
+		return embyhelper.EmbyUser{}
 	}
 
 	cacheKey := "emby-user-id:session:" + itemID + "|" + remoteIP
 	if v, found := h.goCache.Get(cacheKey); found {
-		if s, ok := v.(string); ok {
-			return s
+		if user, ok := v.(embyhelper.EmbyUser); ok {
+			return user
 		}
 	}
 	user, err := embyhelper.New(h.config).GetUserBySession(itemID, remoteIP)
 	if err != nil {
 		h.logger.Warnf("[EMBY PROXY] 解析 Emby 用户(session)失败: %v", err)
-		return ""
+		return embyhelper.EmbyUser{}
 	}
-	userID := ""
+	resolved := embyhelper.EmbyUser{}
 	if user != nil {
-		userID = user.ID
+		resolved = *user
 	}
 	// 会话状态会变化，命中/未命中都只短时间缓存
-	h.goCache.Set(cacheKey, userID, 60*time.Second)
-	return userID
+	h.goCache.Set(cacheKey, resolved, 60*time.Second)
+	return resolved
 }
 
 func (h *EmbyProxyHandler) userResolveCacheTTL() time.Duration {
@@ -802,8 +1192,8 @@ func (h *EmbyProxyHandler) checkMatch302(filePath, userAgent string) (string, bo
 			continue
 		}
 
-		// 暂时只处理 StorageType115Open 的规则
-		if match.CloudStorage.StorageType != model.StorageType115Open {
+		// 跳过没有存储驱动的规则
+		if !service.IsSupportedStorageType(match.CloudStorage.StorageType) {
 			continue
 		}
 
@@ -821,7 +1211,13 @@ func (h *EmbyProxyHandler) checkMatch302(filePath, userAgent string) (string, bo
 		// 尝试获取下载URL
 		// filePath 是 Emby 看到的播放地址(STRM 内容空间)，用作 pickcode 缓存 key
 		// matchedPath 是 115 盘内路径，用于调 115 API 反查 pickcode
-		downloadURL, _, err := h.getDownloadURL(filePath, matchedPath, *match.CloudStorage, userAgent)
+		var downloadURL string
+		var err error
+		if match.CloudStorage.UsesPickcode() {
+			downloadURL, _, err = h.getDownloadURL(filePath, matchedPath, *match.CloudStorage, userAgent)
+		} else {
+			downloadURL, _, err = h.getDownloadURLByPath(*match.CloudStorage, matchedPath, userAgent)
+		}
 		if err != nil {
 			h.logger.Errorf("[EMBY PROXY] 获取下载URL失败: %v", err)
 			continue
@@ -883,80 +1279,49 @@ func (h *EmbyProxyHandler) getDownloadURLForStorage(storage model.CloudStorage,
 	if pickcode == "" {
 		return "", false, fmt.Errorf("pickcode 为空")
 	}
-	mode := storage.Match302AccessModeValue()
-	cacheKey := h.md5CacheKey(fmt.Sprintf("download-url:%d:%s:%s:%s", storage.ID, mode, pickcode, userAgent))
-	if cacheLink, found := h.goCache.Get(cacheKey); found {
-		if link, ok := cacheLink.(string); ok && link != "" {
-			return link, true, nil
-		}
+	cacheKey := service.DownloadURLCacheKey(storage.ID, storage.Match302AccessModeValue(), pickcode, userAgent)
+	if link, found := h.cachedDownloadURL(cacheKey); found {
+		return link, true, nil
 	}
 
-	redirectURL, err := resolveMatch302DownloadURL(
-		mode,
-		func() (string, error) {
-			if strings.TrimSpace(storage.AccessToken) == "" {
-				return "", fmt.Errorf("OpenAPI AccessToken 缺失")
-			}
-			h.sdk115Open.SetAccessToken(storage.AccessToken)
-			downURLResp, err := h.sdk115Open.DownURL(context.Background(), pickcode, userAgent)
-			if err != nil {
-				return "", fmt.Errorf("调用 DownURL API 失败: %w", err)
-			}
-			for _, urlInfo := range downURLResp {
-				if rawURL := strings.TrimSpace(urlInfo.URL.URL); rawURL != "" {
-					return rawURL, nil
-				}
-			}
-			return "", fmt.Errorf("OpenAPI DownURL 未返回可用直链")
-		},
-		func() (string, error) {
-			if strings.TrimSpace(storage.Cookie) == "" {
-				return "", fmt.Errorf("Cookie 缺失")
-			}
-			client, err := h.web115Svc.NewClient(storage.Cookie)
-			if err != nil {
-				return "", fmt.Errorf("115 Cookie 无效: %w", err)
-			}
-			info, err := client.DownloadWithUA(pickcode, userAgent)
-			if err != nil {
-				return "", fmt.Errorf("调用 DownloadWithUA 失败: %w", err)
-			}
-			return strings.TrimSpace(info.Url.Url), nil
-		},
-	)
+	drv, err := h.storageDrivers.Get(storage)
+	if err != nil {
+		return "", false, err
+	}
+	start := time.Now()
+	redirectURL, err := drv.DirectLink(context.Background(), service.StorageEntry{PickCode: pickcode}, userAgent)
+	service.RecordBalanceLinkLatency(storage.ID, time.Since(start), err)
 	if err != nil {
 		return "", false, fmt.Errorf("未找到可用的下载URL，pickcode=%s: %w", pickcode, err)
 	}
-	h.goCache.Set(cacheKey, redirectURL, h.downloadURLCacheTTL(redirectURL))
+	h.storeDownloadURL(cacheKey, redirectURL)
 	return redirectURL, false, nil
 }
 
-func resolveMatch302DownloadURL(
-	mode string,
-	openAPI func() (string, error),
-	cookie func() (string, error),
-) (string, error) {
-	var attemptErrors []error
-	for _, method := range model.Match302AccessOrder(mode) {
-		var (
-			rawURL string
-			err    error
-		)
-		switch method {
-		case model.Match302AccessMethodOpenAPI:
-			rawURL, err = openAPI()
-		case model.Match302AccessMethodCookie:
-			rawURL, err = cookie()
-		}
-		if err == nil && strings.TrimSpace(rawURL) != "" {
-			return strings.TrimSpace(rawURL), nil
-		}
-		if err == nil {
-			err = fmt.Errorf("未返回可用直链")
-		}
-		attemptErrors = append(attemptErrors, fmt.Errorf("%s: %w", method, err))
+// getDownloadURLByPath 按盘内路径获取直链，用于 OpenList / WebDAV 等没有 pickcode 的存储。
+// 缓存策略与 getDownloadURLForStorage 一致，过期时间同样由直链中的过期参数决定。
+func (h *EmbyProxyHandler) getDownloadURLByPath(storage model.CloudStorage, matchedPath, userAgent string) (string, bool, error) {
+	matchedPath = pathhelper.EnsureLeadingSlash(strings.TrimSpace(matchedPath))
+	if matchedPath == "/" {
+		return "", false, fmt.Errorf("文件路径为空")
+	}
+	cacheKey := service.DownloadURLCacheKey(storage.ID, "path", matchedPath, userAgent)
+	if link, found := h.cachedDownloadURL(cacheKey); found {
+		return link, true, nil
+	}
+
+	drv, err := h.storageDrivers.Get(storage)
+	if err != nil {
+		return "", false, err
+	}
+	start := time.Now()
+	redirectURL, err := drv.DirectLink(context.Background(), service.StorageEntry{ID: matchedPath, Path: matchedPath}, userAgent)
+	service.RecordBalanceLinkLatency(storage.ID, time.Since(start), err)
+	if err != nil {
+		return "", false, fmt.Errorf("未找到可用的下载URL，path=%s: %w", matchedPath, err)
 	}
-	return "", fmt.Errorf("Match302 下载方式 %s 全部失败: %w", model.NormalizeMatch302AccessMode(mode), errors.Join(attemptErrors...))
+	h.storeDownloadURL(cacheKey, redirectURL)
+	return redirectURL, false, nil
 }
 
 // is115FileNotFound 判断错误是否为 115 开放平台「文件(夹)不存在或已删除」(code 430004)。
@@ -991,74 +1356,41 @@ func (h *EmbyProxyHandler) invalidateBalanceAssignment(matchID, assignmentID uin
 	}()
 }
 
-func (h *EmbyProxyHandler) downloadURLCacheTTL(rawURL string) time.Duration {
-	configured := time.Duration(h.config.Emby.CacheTime) * time.Minute
-	if configured <= 0 {
-		configured = cache.DefaultExpiration
-	}
-	parsed, err := url.Parse(rawURL)
-	if err != nil {
-		return configured
-	}
-	rawT := parsed.Query().Get("t")
-	if rawT == "" {
-		return configured
-	}
-	expiresAt, err := strconv.ParseInt(rawT, 10, 64)
+// cachedDownloadURL 查询直链缓存；缓存后端出错时按未命中处理，不影响播放
+func (h *EmbyProxyHandler) cachedDownloadURL(key string) (string, bool) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	link, found, err := h.urlCache.Get(ctx, key)
 	if err != nil {
-		return configured
-	}
-	until := time.Until(time.Unix(expiresAt, 0))
-	if until <= 0 {
-		return time.Second
+		h.logger.Warnf("[EMBY PROXY] 读取直链缓存失败 backend=%s: %v", h.urlCache.Backend(), err)
+		return "", false
 	}
-	if configured > 0 && until < configured {
-		return until
+	return link, found
+}
+
+// storeDownloadURL 写入直链缓存，缓存时间取 cache_time 与直链自身过期时间中较早者
+func (h *EmbyProxyHandler) storeDownloadURL(key, link string) {
+	ttl := service.DownloadURLTTL(link, time.Duration(h.config.Emby.CacheTime)*time.Minute, time.Now())
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+	if err := h.urlCache.Set(ctx, key, link, ttl); err != nil {
+		h.logger.Warnf("[EMBY PROXY] 写入直链缓存失败 backend=%s: %v", h.urlCache.Backend(), err)
 	}
-	return configured
 }
 
 func (h *EmbyProxyHandler) fetchPickcodeForStorage(ctx context.Context, matchedPath string, storage model.CloudStorage) (string, error) {
-	mode := storage.Match302AccessModeValue()
-	var attemptErrors []error
-	for _, method := range model.Match302AccessOrder(mode) {
-		var (
-			file  service.Web115File
-			found bool
-			err   error
-		)
-		switch method {
-		case model.Match302AccessMethodOpenAPI:
-			if strings.TrimSpace(storage.AccessToken) == "" {
-				attemptErrors = append(attemptErrors, fmt.Errorf("OpenAPI AccessToken 缺失"))
-				continue
-			}
-			file, found, err = h.web115Svc.ResolveFilePathWithOpenAPI(ctx, storage.AccessToken, matchedPath)
-		case model.Match302AccessMethodCookie:
-			if strings.TrimSpace(storage.Cookie) == "" {
-				attemptErrors = append(attemptErrors, fmt.Errorf("Cookie 缺失"))
-				continue
-			}
-			var client *driver.Pan115Client
-			client, err = h.web115Svc.NewClient(storage.Cookie)
-			if err == nil {
-				file, found, err = h.web115Svc.ResolveFilePathWithClient(client, matchedPath)
-			}
-		}
-		if err != nil {
-			attemptErrors = append(attemptErrors, fmt.Errorf("%s 解析失败: %w", method, err))
-			continue
-		}
-		if !found || strings.TrimSpace(file.PickCode) == "" {
-			attemptErrors = append(attemptErrors, fmt.Errorf("%s 未返回有效 pickcode", method))
-			continue
-		}
-		if len(attemptErrors) > 0 && h.logger != nil {
-			h.logger.Warnf("[EMBY PROXY] Match302 pickcode 已降级到 %s mode=%s", method, mode)
-		}
-		return strings.TrimSpace(file.PickCode), nil
+	drv, err := h.storageDrivers.Get(storage)
+	if err != nil {
+		return "", err
+	}
+	entry, found, err := drv.ResolvePath(ctx, matchedPath)
+	if err != nil {
+		return "", fmt.Errorf("Match302 pickcode 解析失败 mode=%s: %w", storage.Match302AccessModeValue(), err)
+	}
+	if !found || entry.IsDir || strings.TrimSpace(entry.PickCode) == "" {
+		return "", fmt.Errorf("Match302 pickcode 解析失败 mode=%s: 未返回有效 pickcode", storage.Match302AccessModeValue())
 	}
-	return "", fmt.Errorf("Match302 pickcode 解析失败 mode=%s: %w", mode, errors.Join(attemptErrors...))
+	return strings.TrimSpace(entry.PickCode), nil
 }
 
 // GETPlaybackInfo 获取播放信息，使用新的emby客户端方法
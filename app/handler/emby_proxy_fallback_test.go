@@ -0,0 +1,141 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/service"
+	"film-fusion/app/store/embyproxylog"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+const fallbackTestStorageType = "fallback-test"
+
+// fallbackTestDriver 路径中含 broken 时拿不到直链，其余返回 https://mirror/<storage><path>
+type fallbackTestDriver struct {
+	storage model.CloudStorage
+}
+
+func (d *fallbackTestDriver) Type() string { return fallbackTestStorageType }
+func (d *fallbackTestDriver) List(context.Context, string) ([]service.StorageEntry, error) {
+	return nil, nil
+}
+func (d *fallbackTestDriver) ResolvePath(context.Context, string) (service.StorageEntry, bool, error) {
+	return service.StorageEntry{}, false, nil
+}
+func (d *fallbackTestDriver) DirectLink(_ context.Context, entry service.StorageEntry, _ string) (string, error) {
+	if strings.Contains(entry.Path, "broken") {
+		return "", errors.New("file not found")
+	}
+	return "https://mirror/" + d.storage.StorageName + entry.Path, nil
+}
+func (d *fallbackTestDriver) Rename(context.Context, string, string) error { return nil }
+func (d *fallbackTestDriver) Move(context.Context, []string, string) error { return nil }
+func (d *fallbackTestDriver) Delete(context.Context, []string) error       { return nil }
+func (d *fallbackTestDriver) RefreshToken(context.Context) (service.StorageToken, error) {
+	return service.StorageToken{}, service.ErrStorageOperationUnsupported
+}
+
+func TestTryMatch302FallbacksUsesFirstWorkingStorage(t *testing.T) {
+	service.RegisterStorageDriver(service.StorageDriverInfo{Type: fallbackTestStorageType}, func(storage model.CloudStorage, _ *logger.Logger) (service.StorageDriver, error) {
+		return &fallbackTestDriver{storage: storage}, nil
+	})
+
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "fallback.db")), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.CloudStorage{}, &model.Match302{}, &model.Match302Fallback{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = oldDB
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	newStorage := func(name, status string) model.CloudStorage {
+		storage := model.CloudStorage{UserID: 1, StorageType: fallbackTestStorageType, StorageName: name, Status: status}
+		if err := db.Create(&storage).Error; err != nil {
+			t.Fatalf("create storage: %v", err)
+		}
+		return storage
+	}
+	primary := newStorage("primary", model.StatusActive)
+	disabled := newStorage("disabled", model.StatusDisabled)
+	broken := newStorage("broken", model.StatusActive)
+	mirror := newStorage("mirror", model.StatusActive)
+
+	match := model.Match302{SourcePath: "/media", TargetPath: "/library", CloudStorageID: primary.ID}
+	if err := db.Create(&match).Error; err != nil {
+		t.Fatalf("create match: %v", err)
+	}
+	match.CloudStorage = &primary
+	for i, fallback := range []model.Match302Fallback{
+		{CloudStorageID: mirror.ID, SortOrder: 3},
+		{CloudStorageID: disabled.ID, SortOrder: 0},
+		{CloudStorageID: broken.ID, SortOrder: 1, TargetPath: "/broken"},
+		{CloudStorageID: mirror.ID, SortOrder: 2, TargetPath: "/skipped"},
+	} {
+		fallback.Match302ID = match.ID
+		fallback.Enabled = i != 3
+		if err := db.Create(&fallback).Error; err != nil {
+			t.Fatalf("create fallback: %v", err)
+		}
+		if i == 3 {
+			// gorm 会忽略 false 零值而使用默认值 true，单独更新
+			db.Model(&fallback).Update("enabled", false)
+		}
+	}
+
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	h := &EmbyProxyHandler{config: &config.Config{}, logger: log, goCache: cache.New(time.Minute, time.Minute), urlCache: service.NewMemoryDownloadURLCache()}
+	gin.SetMode(gin.TestMode)
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil)
+
+	attempts := []embyproxylog.Attempt{{StorageID: primary.ID, Role: "primary", Error: "boom"}}
+	target, entry, ok := h.tryMatch302Fallbacks(c, embyproxylog.Entry{}, &match, "/media/Movie/a.mkv", "1", "ms", "获取下载URL失败: boom", &attempts)
+	if !ok {
+		t.Fatalf("fallback chain failed, attempts=%+v", attempts)
+	}
+	if target != "https://mirror/mirror/library/Movie/a.mkv" {
+		t.Fatalf("target = %q", target)
+	}
+	if entry.ActualStorageID != mirror.ID || entry.AccountType != "fallback" || entry.Match302ID != match.ID {
+		t.Fatalf("entry = %+v", entry)
+	}
+
+	wantOrder := []uint{primary.ID, disabled.ID, broken.ID, mirror.ID}
+	if len(entry.Attempts) != len(wantOrder) {
+		t.Fatalf("attempts = %+v", entry.Attempts)
+	}
+	for i, id := range wantOrder {
+		if entry.Attempts[i].StorageID != id {
+			t.Fatalf("attempt %d storage = %d, want %d", i, entry.Attempts[i].StorageID, id)
+		}
+	}
+	if entry.Attempts[2].Path != "/broken/Movie/a.mkv" || entry.Attempts[2].Error == "" || entry.Attempts[3].Error != "" {
+		t.Fatalf("attempts = %+v", entry.Attempts)
+	}
+}
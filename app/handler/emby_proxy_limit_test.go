@@ -0,0 +1,82 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/service"
+	"film-fusion/app/store/embyplayback"
+	"film-fusion/app/utils/embyhelper"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func TestAdmitEmbyUserPlaybackDeniedRetryStaysDenied(t *testing.T) {
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "limit.db")), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.EmbyUserPlaybackLimit{}, &model.EmbyUserPlaybackUsage{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	embyplayback.Default().Clear()
+	t.Cleanup(func() {
+		database.DB = oldDB
+		embyplayback.Default().Clear()
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			_ = sqlDB.Close()
+		}
+	})
+
+	db.Create(&model.EmbyUserPlaybackLimit{EmbyUserID: "u1", Enabled: true, DailyLimit: 1})
+	if err := model.IncrEmbyUserPlaybackCount(db, "u1", model.EmbyUserPlaybackDay(time.Now())); err != nil {
+		t.Fatalf("seed playback count: %v", err)
+	}
+
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	h := &EmbyProxyHandler{
+		config:       &config.Config{},
+		logger:       log,
+		goCache:      cache.New(time.Minute, time.Minute),
+		userLimitSvc: service.NewEmbyUserLimitService(log),
+	}
+	h.goCache.Set("emby-user-id:token:user-token", embyhelper.EmbyUser{ID: "u1", Name: "alice"}, time.Minute)
+
+	gin.SetMode(gin.TestMode)
+	play := func() (bool, *httptest.ResponseRecorder) {
+		recorder := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(recorder)
+		c.Request = httptest.NewRequest(http.MethodGet, "/Videos/42/stream?MediaSourceId=ms42&api_key=user-token", nil)
+		c.Request.RemoteAddr = "198.51.100.7:1234"
+		c.Request.Header.Set("User-Agent", "test-player")
+		return h.admitEmbyUserPlayback(c), recorder
+	}
+
+	for attempt := 1; attempt <= 2; attempt++ {
+		admitted, recorder := play()
+		if admitted {
+			t.Fatalf("attempt %d should be denied by the daily limit", attempt)
+		}
+		if recorder.Code != http.StatusForbidden || recorder.Header().Get("X-Application-Error-Code") != service.EmbyUserLimitCodeDaily {
+			t.Fatalf("attempt %d status = %d code = %q", attempt, recorder.Code, recorder.Header().Get("X-Application-Error-Code"))
+		}
+	}
+	if _, found := embyplayback.Default().FindSessionKey("ms42", "ms42", "198.51.100.7", "test-player"); found {
+		t.Fatal("denied playback must not register a session")
+	}
+}
@@ -2,8 +2,11 @@ package handler
 
 import (
 	"film-fusion/app/service"
+	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 
 	"film-fusion/app/store/embyproxylog"
 
@@ -14,15 +17,25 @@ import (
 type EmbyProxyLogHandler struct {
 	balanceStatusSvc *service.BalanceStatusService
 	loginProtection  *service.EmbyLoginProtection
+	proxyLogSvc      *service.EmbyProxyLogService
+	streamProxy      *service.EmbyStreamProxy
 }
 
-func NewEmbyProxyLogHandler(loginProtection *service.EmbyLoginProtection) *EmbyProxyLogHandler {
+func NewEmbyProxyLogHandler(loginProtection *service.EmbyLoginProtection, proxyLogSvc *service.EmbyProxyLogService, streamProxy *service.EmbyStreamProxy) *EmbyProxyLogHandler {
 	return &EmbyProxyLogHandler{
 		balanceStatusSvc: service.NewBalanceStatusService(),
 		loginProtection:  loginProtection,
+		proxyLogSvc:      proxyLogSvc,
+		streamProxy:      streamProxy,
 	}
 }
 
+// StreamStatus GET /api/emby-proxy/stream-status
+// 返回中转播放的当前连接、并发上限与累计流量(按存储汇总)。
+func (h *EmbyProxyLogHandler) StreamStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, NewSuccessResponse("ok", h.streamProxy.Snapshot()))
+}
+
 // SecurityStatus GET /api/emby-proxy/security-status
 func (h *EmbyProxyLogHandler) SecurityStatus(c *gin.Context) {
 	if h.loginProtection == nil {
@@ -50,33 +63,126 @@ func (h *EmbyProxyLogHandler) SecurityUnblock(c *gin.Context) {
 	c.JSON(http.StatusOK, NewSuccessResponse("已解除封禁", gin.H{}))
 }
 
-// List GET /api/emby-proxy/302-logs?limit=500
-// 返回最新在前的 302 重定向日志。
+// List GET /api/emby-proxy/302-logs?page=1&size=50
+// 返回最新在前的 302 重定向日志，支持按 emby_user_id / item_id / storage_id / balance_status /
+// fallback_reason / source / start / end(RFC3339) 过滤。未启用持久化时回退到内存环形缓冲(仅支持 limit)。
 func (h *EmbyProxyLogHandler) List(c *gin.Context) {
-	limit := 0
-	if s := c.Query("limit"); s != "" {
-		if n, err := strconv.Atoi(s); err == nil {
-			limit = n
+	store := embyproxylog.Default()
+	count, capacity := store.Stats()
+
+	if h.proxyLogSvc == nil {
+		limit := 0
+		if s := c.Query("limit"); s != "" {
+			if n, err := strconv.Atoi(s); err == nil {
+				limit = n
+			}
 		}
+		c.JSON(http.StatusOK, NewSuccessResponse("ok", gin.H{
+			"count":    count,
+			"capacity": capacity,
+			"entries":  store.Snapshot(limit),
+		}))
+		return
 	}
 
-	store := embyproxylog.Default()
-	entries := store.Snapshot(limit)
-	count, capacity := store.Stats()
+	filter, err := parseEmbyProxyLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewErrorResponse("请求参数错误", err.Error()))
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", c.DefaultQuery("limit", "50")))
+	if page < 1 {
+		page = 1
+	}
+	if size <= 0 || size > 500 {
+		size = 50
+	}
 
+	list, total, err := h.proxyLogSvc.Query(filter, page, size)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, NewErrorResponse("查询 302 日志失败", err.Error()))
+		return
+	}
 	c.JSON(http.StatusOK, NewSuccessResponse("ok", gin.H{
 		"count":    count,
 		"capacity": capacity,
-		"entries":  entries,
+		"entries":  list,
+		"total":    total,
+		"page":     page,
+		"size":     size,
 	}))
 }
 
+// Export GET /api/emby-proxy/302-logs/export
+// 按与 List 相同的过滤条件导出 CSV。
+func (h *EmbyProxyLogHandler) Export(c *gin.Context) {
+	if h.proxyLogSvc == nil {
+		c.JSON(http.StatusServiceUnavailable, NewErrorResponse("302 日志持久化未启用", ""))
+		return
+	}
+	filter, err := parseEmbyProxyLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, NewErrorResponse("请求参数错误", err.Error()))
+		return
+	}
+
+	filename := fmt.Sprintf("emby-302-logs-%s.csv", time.Now().Format("20060102-150405"))
+	c.Header("Content-Type", "text/csv; charset=utf-8")
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Status(http.StatusOK)
+	// UTF-8 BOM，避免 Excel 打开中文乱码
+	_, _ = c.Writer.Write([]byte("\xEF\xBB\xBF"))
+	if err := h.proxyLogSvc.ExportCSV(c.Writer, filter); err != nil {
+		// 响应头已发出，只能中断输出
+		_ = c.Error(err)
+	}
+}
+
 // Clear DELETE /api/emby-proxy/302-logs
 func (h *EmbyProxyLogHandler) Clear(c *gin.Context) {
 	embyproxylog.Default().Clear()
+	if h.proxyLogSvc != nil {
+		if err := h.proxyLogSvc.Clear(); err != nil {
+			c.JSON(http.StatusInternalServerError, NewErrorResponse("清空 302 日志失败", err.Error()))
+			return
+		}
+	}
 	c.JSON(http.StatusOK, NewSuccessResponse("ok", gin.H{}))
 }
 
+func parseEmbyProxyLogFilter(c *gin.Context) (service.EmbyProxyLogFilter, error) {
+	filter := service.EmbyProxyLogFilter{
+		EmbyUserID:     strings.TrimSpace(c.Query("emby_user_id")),
+		ItemID:         strings.TrimSpace(c.Query("item_id")),
+		Source:         strings.TrimSpace(c.Query("source")),
+		BalanceStatus:  strings.TrimSpace(c.Query("balance_status")),
+		FallbackReason: strings.TrimSpace(c.Query("fallback_reason")),
+	}
+	if v := strings.TrimSpace(c.Query("storage_id")); v != "" {
+		id, err := strconv.ParseUint(v, 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 storage_id: %s", v)
+		}
+		filter.StorageID = uint(id)
+	}
+	for _, item := range []struct {
+		key    string
+		target *time.Time
+	}{{"start", &filter.Start}, {"end", &filter.End}} {
+		v := strings.TrimSpace(c.Query(item.key))
+		if v == "" {
+			continue
+		}
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return filter, fmt.Errorf("无效的 %s(需 RFC3339 格式): %s", item.key, v)
+		}
+		*item.target = t
+	}
+	return filter, nil
+}
+
 // BalanceStatus GET /api/emby-proxy/balance-status
 func (h *EmbyProxyLogHandler) BalanceStatus(c *gin.Context) {
 	c.JSON(http.StatusOK, NewSuccessResponse("ok", h.balanceStatusSvc.Snapshot()))
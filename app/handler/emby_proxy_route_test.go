@@ -0,0 +1,109 @@
+package handler
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/service"
+
+	"github.com/gin-gonic/gin"
+	"github.com/patrickmn/go-cache"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormLogger "gorm.io/gorm/logger"
+)
+
+func useRouteTestDB(t *testing.T) *gorm.DB {
+	t.Helper()
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "route.db")), &gorm.Config{
+		Logger: gormLogger.Default.LogMode(gormLogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.EmbyPlaybackRoute{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() {
+		database.DB = oldDB
+		if sqlDB, dbErr := db.DB(); dbErr == nil {
+			_ = sqlDB.Close()
+		}
+	})
+	return db
+}
+
+func TestRoutePlaybackIgnoresSpoofedForwardedFor(t *testing.T) {
+	db := useRouteTestDB(t)
+	db.Create(&model.EmbyPlaybackRoute{Name: "lan", Enabled: true, Network: model.EmbyPlaybackRouteNetworkLAN, Action: model.EmbyPlaybackRouteActionEmby})
+
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	cfg := &config.Config{}
+	h := &EmbyProxyHandler{config: cfg, logger: log, goCache: cache.New(time.Minute, time.Minute), playbackRouter: service.NewEmbyPlaybackRouter(log)}
+
+	gin.SetMode(gin.TestMode)
+	route := func(remoteAddr string) *model.EmbyPlaybackRoute {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil)
+		c.Request.RemoteAddr = remoteAddr
+		c.Request.Header.Set("X-Forwarded-For", "192.168.1.5")
+		return h.routePlayback(c, "1", "/media/a.mkv", 0, false)
+	}
+
+	if got := route("203.0.113.9:4567"); got != nil {
+		t.Fatalf("spoofed X-Forwarded-For matched LAN rule %q", got.Name)
+	}
+	cfg.Emby.Security.TrustedProxyCIDRs = []string{"203.0.113.0/24"}
+	if got := route("203.0.113.9:4567"); got == nil || got.Name != "lan" {
+		t.Fatalf("trusted proxy should forward the LAN client, got %+v", got)
+	}
+}
+
+func TestProxyPlayDeniesWhenItemLookupFails(t *testing.T) {
+	db := useRouteTestDB(t)
+	db.Create(&model.EmbyPlaybackRoute{Name: "big-wan", Enabled: true, Network: model.EmbyPlaybackRouteNetworkWAN, MinSizeMB: 10 * 1024, Action: model.EmbyPlaybackRouteActionDeny})
+	db.Create(&model.EmbyPlaybackRoute{Name: "movies-emby", Enabled: true, Libraries: "电影", Action: model.EmbyPlaybackRouteActionEmby})
+
+	emby := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	t.Cleanup(emby.Close)
+
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	cfg := &config.Config{}
+	cfg.Emby.URL = emby.URL
+	h := &EmbyProxyHandler{config: cfg, logger: log, goCache: cache.New(time.Minute, time.Minute), playbackRouter: service.NewEmbyPlaybackRouter(log)}
+
+	gin.SetMode(gin.TestMode)
+	play := func(remoteAddr string) (*gin.Context, string) {
+		c, _ := gin.CreateTestContext(httptest.NewRecorder())
+		c.Request = httptest.NewRequest(http.MethodGet, "/Videos/1/original?api_key=k", nil)
+		c.Request.RemoteAddr = remoteAddr
+		_, _, skip, reason := h.proxyPlay(c)
+		if !skip {
+			t.Fatalf("proxyPlay should fall back when the item lookup fails")
+		}
+		return c, reason
+	}
+
+	// 拿不到文件大小时拒绝规则仍按命中处理
+	c, reason := play("8.8.8.8:1234")
+	if route, ok := embyPlaybackRouteFromContext(c); !ok || route.Name != "big-wan" || !strings.Contains(reason, "拒绝播放") {
+		t.Fatalf("deny rule should apply when the item lookup fails, route=%+v reason=%q", route, reason)
+	}
+	// 非拒绝规则的媒体库条件无法判断，不命中
+	c, reason = play("192.168.1.5:1234")
+	if _, ok := embyPlaybackRouteFromContext(c); ok || !strings.Contains(reason, "获取 EmbyItems 失败") {
+		t.Fatalf("non-deny rule should not match without item info, reason=%q", reason)
+	}
+}
@@ -0,0 +1,165 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// EmbyUserLimitHandler 处理 Emby 用户播放限制(并发数 / 每日次数 / 允许时段)的管理。
+type EmbyUserLimitHandler struct {
+	logger *logger.Logger
+}
+
+// NewEmbyUserLimitHandler 构造
+func NewEmbyUserLimitHandler(log *logger.Logger) *EmbyUserLimitHandler {
+	return &EmbyUserLimitHandler{logger: log}
+}
+
+func (h *EmbyUserLimitHandler) success(c *gin.Context, data any, message string) {
+	c.JSON(http.StatusOK, ApiResponse{Code: 0, Message: message, Data: data})
+}
+
+func (h *EmbyUserLimitHandler) error(c *gin.Context, statusCode int, errorCode int, message string) {
+	c.JSON(statusCode, ApiResponse{Code: errorCode, Message: message, Data: nil})
+}
+
+type embyUserLimitPayload struct {
+	EmbyUserID     string `json:"emby_user_id"`
+	EmbyUserName   string `json:"emby_user_name"`
+	Enabled        *bool  `json:"enabled"`
+	MaxConcurrent  int    `json:"max_concurrent"`
+	DailyLimit     int    `json:"daily_limit"`
+	AllowedWindows string `json:"allowed_windows"`
+	Remark         string `json:"remark"`
+}
+
+// bindPayload 解析并校验请求体，失败时已写出错误响应。
+func (h *EmbyUserLimitHandler) bindPayload(c *gin.Context) (embyUserLimitPayload, bool) {
+	var payload embyUserLimitPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		h.error(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
+		return payload, false
+	}
+	payload.EmbyUserID = strings.TrimSpace(payload.EmbyUserID)
+	payload.AllowedWindows = strings.TrimSpace(payload.AllowedWindows)
+	if payload.EmbyUserID == "" {
+		h.error(c, http.StatusBadRequest, 400, "Emby 用户不能为空")
+		return payload, false
+	}
+	if payload.MaxConcurrent < 0 || payload.DailyLimit < 0 {
+		h.error(c, http.StatusBadRequest, 400, "并发数与每日次数不能为负数")
+		return payload, false
+	}
+	if _, err := model.ParsePlaybackTimeWindows(payload.AllowedWindows); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return payload, false
+	}
+	return payload, true
+}
+
+func (h *EmbyUserLimitHandler) apply(limit *model.EmbyUserPlaybackLimit, payload embyUserLimitPayload) {
+	limit.EmbyUserID = payload.EmbyUserID
+	limit.EmbyUserName = strings.TrimSpace(payload.EmbyUserName)
+	limit.MaxConcurrent = payload.MaxConcurrent
+	limit.DailyLimit = payload.DailyLimit
+	limit.AllowedWindows = payload.AllowedWindows
+	limit.Remark = strings.TrimSpace(payload.Remark)
+	if payload.Enabled != nil {
+		limit.Enabled = *payload.Enabled
+	}
+}
+
+// ListLimits 获取所有 Emby 用户播放限制，附带今日播放次数。
+func (h *EmbyUserLimitHandler) ListLimits(c *gin.Context) {
+	var limits []model.EmbyUserPlaybackLimit
+	if err := database.DB.Order("updated_at DESC").Find(&limits).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "获取播放限制列表失败")
+		return
+	}
+	day := model.EmbyUserPlaybackDay(time.Now())
+	for i := range limits {
+		limits[i].TodayCount, _ = model.GetEmbyUserPlaybackCount(database.DB, limits[i].EmbyUserID, day)
+	}
+	h.success(c, limits, "获取播放限制列表成功")
+}
+
+// CreateLimit 新增 Emby 用户播放限制。
+func (h *EmbyUserLimitHandler) CreateLimit(c *gin.Context) {
+	payload, ok := h.bindPayload(c)
+	if !ok {
+		return
+	}
+
+	var existing model.EmbyUserPlaybackLimit
+	if err := database.DB.Where("emby_user_id = ?", payload.EmbyUserID).First(&existing).Error; err == nil {
+		h.error(c, http.StatusConflict, 409, "该 Emby 用户已存在播放限制")
+		return
+	}
+
+	limit := model.EmbyUserPlaybackLimit{Enabled: true}
+	h.apply(&limit, payload)
+	if err := database.DB.Create(&limit).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "创建播放限制失败: "+err.Error())
+		return
+	}
+	h.success(c, limit, "创建播放限制成功")
+}
+
+// UpdateLimit 更新 Emby 用户播放限制。
+func (h *EmbyUserLimitHandler) UpdateLimit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的ID")
+		return
+	}
+
+	var limit model.EmbyUserPlaybackLimit
+	if err := database.DB.First(&limit, uint(id)).Error; err != nil {
+		if err == gorm.ErrRecordNotFound {
+			h.error(c, http.StatusNotFound, 404, "播放限制不存在")
+		} else {
+			h.error(c, http.StatusInternalServerError, 500, "获取播放限制失败")
+		}
+		return
+	}
+
+	payload, ok := h.bindPayload(c)
+	if !ok {
+		return
+	}
+	var conflict model.EmbyUserPlaybackLimit
+	if err := database.DB.Where("emby_user_id = ? AND id != ?", payload.EmbyUserID, uint(id)).First(&conflict).Error; err == nil {
+		h.error(c, http.StatusConflict, 409, "该 Emby 用户已存在播放限制")
+		return
+	}
+
+	h.apply(&limit, payload)
+	if err := database.DB.Save(&limit).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "更新播放限制失败: "+err.Error())
+		return
+	}
+	h.success(c, limit, "更新播放限制成功")
+}
+
+// DeleteLimit 删除 Emby 用户播放限制。
+func (h *EmbyUserLimitHandler) DeleteLimit(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的ID")
+		return
+	}
+	if err := database.DB.Delete(&model.EmbyUserPlaybackLimit{}, uint(id)).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "删除播放限制失败")
+		return
+	}
+	h.success(c, nil, "删除播放限制成功")
+}
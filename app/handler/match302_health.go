@@ -0,0 +1,88 @@
+package handler
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"film-fusion/app/database"
+	"film-fusion/app/model"
+	"film-fusion/app/service"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Match302HealthHandler 负载均衡子账号健康检查与健康时间线
+type Match302HealthHandler struct {
+	healthSvc *service.BalanceHealthService
+}
+
+// NewMatch302HealthHandler 构造
+func NewMatch302HealthHandler(healthSvc *service.BalanceHealthService) *Match302HealthHandler {
+	return &Match302HealthHandler{healthSvc: healthSvc}
+}
+
+func (h *Match302HealthHandler) success(c *gin.Context, data any, message string) {
+	c.JSON(http.StatusOK, ApiResponse{Code: 0, Message: message, Data: data})
+}
+
+func (h *Match302HealthHandler) error(c *gin.Context, statusCode int, errorCode int, message string) {
+	c.JSON(statusCode, ApiResponse{Code: errorCode, Message: message, Data: nil})
+}
+
+func (h *Match302HealthHandler) parseMemberIDs(c *gin.Context) (uint, uint, bool) {
+	matchID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的 Match302 ID")
+		return 0, 0, false
+	}
+	memberID, err := strconv.ParseUint(c.Param("member_id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的成员 ID")
+		return 0, 0, false
+	}
+	return uint(matchID), uint(memberID), true
+}
+
+// GetMemberHealth 获取成员当前健康状态与健康时间线
+func (h *Match302HealthHandler) GetMemberHealth(c *gin.Context) {
+	matchID, memberID, ok := h.parseMemberIDs(c)
+	if !ok {
+		return
+	}
+	var member model.Match302BalanceMember
+	if err := database.DB.Preload("CloudStorage").Where("id = ? AND match302_id = ?", memberID, matchID).First(&member).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.error(c, http.StatusNotFound, 404, "成员不存在")
+		} else {
+			h.error(c, http.StatusInternalServerError, 500, "获取成员失败")
+		}
+		return
+	}
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	checks, err := h.healthSvc.HealthTimeline(member.CloudStorageID, limit)
+	if err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "获取健康记录失败")
+		return
+	}
+	h.success(c, gin.H{"member": member, "checks": checks}, "获取成员健康状态成功")
+}
+
+// CheckMemberHealth 立即对成员执行一次健康检查
+func (h *Match302HealthHandler) CheckMemberHealth(c *gin.Context) {
+	matchID, memberID, ok := h.parseMemberIDs(c)
+	if !ok {
+		return
+	}
+	check, err := h.healthSvc.CheckMember(c.Request.Context(), matchID, memberID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.error(c, http.StatusNotFound, 404, "成员不存在")
+		} else {
+			h.error(c, http.StatusInternalServerError, 500, "健康检查失败: "+err.Error())
+		}
+		return
+	}
+	h.success(c, check, "健康检查完成")
+}
@@ -8,6 +8,7 @@ import (
 	"fmt"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/gin-gonic/gin"
 	"gorm.io/gorm"
@@ -39,22 +40,31 @@ type match302MemberPayload struct {
 	Enabled        *bool  `json:"enabled"`
 	Weight         *int   `json:"weight"`
 	TargetRootPath string `json:"target_root_path"`
+	ProbePickcode  string `json:"probe_pickcode"`
+}
+
+type match302FallbackPayload struct {
+	CloudStorageID uint   `json:"cloud_storage_id"`
+	Enabled        *bool  `json:"enabled"`
+	TargetPath     string `json:"target_path"`
 }
 
 type match302Payload struct {
-	SourcePath         string                   `json:"source_path"`
-	TargetPath         string                   `json:"target_path"`
-	CloudStorageID     uint                     `json:"cloud_storage_id"`
-	BalanceEnabled     *bool                    `json:"balance_enabled"`
-	BalanceStrategy    string                   `json:"balance_strategy"`
-	BalanceLimitMode   string                   `json:"balance_limit_mode"`
-	SourceWeight       *int                     `json:"source_weight"`
-	CleanupEnabled     *bool                    `json:"cleanup_enabled"`
-	RetentionHours     *int                     `json:"retention_hours"`
-	CleanupMode        string                   `json:"cleanup_mode"`
-	CleanupIntervalMin *int                     `json:"cleanup_interval_min"`
-	MinKeepReady       *int                     `json:"min_keep_ready"`
-	PoolMembers        *[]match302MemberPayload `json:"pool_members"`
+	SourcePath         string                     `json:"source_path"`
+	TargetPath         string                     `json:"target_path"`
+	CloudStorageID     uint                       `json:"cloud_storage_id"`
+	BalanceEnabled     *bool                      `json:"balance_enabled"`
+	BalanceStrategy    string                     `json:"balance_strategy"`
+	BalanceLimitMode   string                     `json:"balance_limit_mode"`
+	SourceWeight       *int                       `json:"source_weight"`
+	CleanupEnabled     *bool                      `json:"cleanup_enabled"`
+	RetentionHours     *int                       `json:"retention_hours"`
+	CleanupMode        string                     `json:"cleanup_mode"`
+	CleanupIntervalMin *int                       `json:"cleanup_interval_min"`
+	MinKeepReady       *int                       `json:"min_keep_ready"`
+	PrefetchEpisodes   *int                       `json:"prefetch_episodes"`
+	PoolMembers        *[]match302MemberPayload   `json:"pool_members"`
+	Fallbacks          *[]match302FallbackPayload `json:"fallbacks"`
 }
 
 type match302BalanceEnabledPayload struct {
@@ -114,6 +124,9 @@ func applyMatch302Payload(match *model.Match302, req match302Payload, creating b
 	if req.MinKeepReady != nil {
 		match.MinKeepReady = *req.MinKeepReady
 	}
+	if req.PrefetchEpisodes != nil {
+		match.PrefetchEpisodes = *req.PrefetchEpisodes
+	}
 	match.NormalizeBalanceDefaults()
 }
 
@@ -147,6 +160,7 @@ func (h *Match302Handler) syncPoolMembers(tx *gorm.DB, matchID, sourceStorageID
 			Enabled:        enabled,
 			Weight:         weight,
 			TargetRootPath: payload.TargetRootPath,
+			ProbePickcode:  strings.TrimSpace(payload.ProbePickcode),
 		}
 		member.NormalizeDefaults(matchID)
 
@@ -156,6 +170,7 @@ func (h *Match302Handler) syncPoolMembers(tx *gorm.DB, matchID, sourceStorageID
 			existing.Enabled = member.Enabled
 			existing.Weight = member.Weight
 			existing.TargetRootPath = member.TargetRootPath
+			existing.ProbePickcode = member.ProbePickcode
 			if err := tx.Save(&existing).Error; err != nil {
 				return err
 			}
@@ -178,9 +193,52 @@ func (h *Match302Handler) syncPoolMembers(tx *gorm.DB, matchID, sourceStorageID
 	return query.Delete(&model.Match302BalanceMember{}).Error
 }
 
+// syncFallbacks 按提交顺序重建备用存储链；与主存储、主目标路径完全相同的条目没有意义，直接拒绝
+func (h *Match302Handler) syncFallbacks(tx *gorm.DB, match model.Match302, payloads []match302FallbackPayload) error {
+	if err := tx.Where("match302_id = ?", match.ID).Delete(&model.Match302Fallback{}).Error; err != nil {
+		return err
+	}
+	for i, payload := range payloads {
+		if payload.CloudStorageID == 0 {
+			continue
+		}
+		targetPath := strings.TrimSpace(payload.TargetPath)
+		if payload.CloudStorageID == match.CloudStorageID && (targetPath == "" || targetPath == strings.TrimSpace(match.TargetPath)) {
+			return fmt.Errorf("备用存储不能与主存储及目标路径完全相同")
+		}
+		var storage model.CloudStorage
+		if err := tx.First(&storage, payload.CloudStorageID).Error; err != nil {
+			return err
+		}
+		if !service.IsSupportedStorageType(storage.StorageType) {
+			return fmt.Errorf("备用存储 %s 的类型不支持 302", storage.StorageName)
+		}
+		enabled := true
+		if payload.Enabled != nil {
+			enabled = *payload.Enabled
+		}
+		fallback := model.Match302Fallback{
+			Match302ID:     match.ID,
+			CloudStorageID: payload.CloudStorageID,
+			SortOrder:      i,
+			Enabled:        enabled,
+			TargetPath:     targetPath,
+		}
+		if err := tx.Create(&fallback).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func orderMatch302Fallbacks(db *gorm.DB) *gorm.DB {
+	return db.Order("sort_order ASC, id ASC")
+}
+
 func (h *Match302Handler) loadMatch302(id uint) (model.Match302, error) {
 	var match model.Match302
-	err := database.DB.Preload("CloudStorage").Preload("PoolMembers.CloudStorage").First(&match, id).Error
+	err := database.DB.Preload("CloudStorage").Preload("PoolMembers.CloudStorage").
+		Preload("Fallbacks", orderMatch302Fallbacks).Preload("Fallbacks.CloudStorage").First(&match, id).Error
 	return match, err
 }
 
@@ -191,6 +249,10 @@ func (h *Match302Handler) CreateMatch302(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
 		return
 	}
+	if payload.BalanceStrategy != "" && !model.IsValidMatch302BalanceStrategy(payload.BalanceStrategy) {
+		h.error(c, http.StatusBadRequest, 400, "不支持的负载均衡策略: "+payload.BalanceStrategy)
+		return
+	}
 	var req model.Match302
 	applyMatch302Payload(&req, payload, true)
 
@@ -229,7 +291,12 @@ func (h *Match302Handler) CreateMatch302(c *gin.Context) {
 			return err
 		}
 		if payload.PoolMembers != nil {
-			return h.syncPoolMembers(tx, req.ID, req.CloudStorageID, *payload.PoolMembers)
+			if err := h.syncPoolMembers(tx, req.ID, req.CloudStorageID, *payload.PoolMembers); err != nil {
+				return err
+			}
+		}
+		if payload.Fallbacks != nil {
+			return h.syncFallbacks(tx, req, *payload.Fallbacks)
 		}
 		return nil
 	}); err != nil {
@@ -244,7 +311,8 @@ func (h *Match302Handler) CreateMatch302(c *gin.Context) {
 // GetMatch302s 获取302匹配配置列表
 func (h *Match302Handler) GetMatch302s(c *gin.Context) {
 	var matches []model.Match302
-	query := database.DB.Model(&model.Match302{}).Preload("CloudStorage").Preload("PoolMembers.CloudStorage")
+	query := database.DB.Model(&model.Match302{}).Preload("CloudStorage").Preload("PoolMembers.CloudStorage").
+		Preload("Fallbacks", orderMatch302Fallbacks).Preload("Fallbacks.CloudStorage")
 
 	// 分页参数
 	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
@@ -330,6 +398,10 @@ func (h *Match302Handler) UpdateMatch302(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, "请求参数错误: "+err.Error())
 		return
 	}
+	if payload.BalanceStrategy != "" && !model.IsValidMatch302BalanceStrategy(payload.BalanceStrategy) {
+		h.error(c, http.StatusBadRequest, 400, "不支持的负载均衡策略: "+payload.BalanceStrategy)
+		return
+	}
 	var req model.Match302
 	applyMatch302Payload(&req, payload, false)
 
@@ -370,7 +442,12 @@ func (h *Match302Handler) UpdateMatch302(c *gin.Context) {
 			return err
 		}
 		if payload.PoolMembers != nil {
-			return h.syncPoolMembers(tx, match.ID, match.CloudStorageID, *payload.PoolMembers)
+			if err := h.syncPoolMembers(tx, match.ID, match.CloudStorageID, *payload.PoolMembers); err != nil {
+				return err
+			}
+		}
+		if payload.Fallbacks != nil {
+			return h.syncFallbacks(tx, match, *payload.Fallbacks)
 		}
 		return nil
 	}); err != nil {
@@ -444,6 +521,9 @@ func (h *Match302Handler) DeleteMatch302(c *gin.Context) {
 		if err := tx.Where("match302_id = ?", match.ID).Delete(&model.Match302BalanceAssignment{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("match302_id = ?", match.ID).Delete(&model.Match302Fallback{}).Error; err != nil {
+			return err
+		}
 		return tx.Delete(&match).Error
 	}); err != nil {
 		h.error(c, http.StatusInternalServerError, 500, "删除匹配配置失败")
@@ -477,6 +557,9 @@ func (h *Match302Handler) BatchDeleteMatch302s(c *gin.Context) {
 		if err := tx.Where("match302_id IN ?", req.IDs).Delete(&model.Match302BalanceAssignment{}).Error; err != nil {
 			return err
 		}
+		if err := tx.Where("match302_id IN ?", req.IDs).Delete(&model.Match302Fallback{}).Error; err != nil {
+			return err
+		}
 		result := tx.Where("id IN ?", req.IDs).Delete(&model.Match302{})
 		rowsAffected = result.RowsAffected
 		return result.Error
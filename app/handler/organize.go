@@ -114,6 +114,7 @@ type Organize115CookieGroup struct {
 	DirDebug []Organize115DirDebug   `json:"dir_debug,omitempty"`
 	Items    []Organize115ItemResult `json:"items,omitempty"`
 	Error    string                  `json:"error,omitempty"`
+	BatchID  uint                    `json:"batch_id,omitempty"` // 可撤销的整理批次
 }
 
 type Organize115CookieResult struct {
@@ -2096,6 +2097,15 @@ func (h *OrganizeHandler) processOrganize115CookieFolder(args processOrganizeArg
 	group.DirDebug = dirDebugs
 
 	if !dryRun {
+		batch, err := h.beginOrganizeBatch(dir, folderID, results)
+		if err != nil {
+			group.Error = fmt.Sprintf("记录整理批次失败，未执行整理: %v", err)
+			group.Items = results
+			return group
+		}
+		group.BatchID = batch.ID
+		defer func() { service.FinishOrganizeBatch(h.logger, batch.ID, group.Error) }()
+
 		if err := h.batchRenameAndMove(webClient, results); err != nil {
 			group.Error = err.Error()
 			group.Items = results
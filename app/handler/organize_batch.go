@@ -0,0 +1,203 @@
+package handler
+
+import (
+	"errors"
+	"film-fusion/app/database"
+	"film-fusion/app/model"
+	"film-fusion/app/service"
+	"film-fusion/app/utils/pathhelper"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	driver "github.com/SheltonZhu/115driver/pkg/driver"
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// web115OrganizeBatchOps 使用 Cookie 客户端执行撤销时的重命名/移动
+type web115OrganizeBatchOps struct {
+	svc    *service.Web115Service
+	client *driver.Pan115Client
+}
+
+func (o web115OrganizeBatchOps) Rename(renameMap map[string]string) error {
+	return o.svc.BatchRename(o.client, renameMap)
+}
+
+func (o web115OrganizeBatchOps) Move(dirID string, fileIDs []string) error {
+	return o.svc.MoveFiles(o.client, dirID, fileIDs)
+}
+
+// beginOrganizeBatch 在改动网盘之前记录每个文件的原名、原目录与将要生成的本地文件
+func (h *OrganizeHandler) beginOrganizeBatch(dir model.CloudDirectory, folderID string, items []Organize115ItemResult) (*model.OrganizeBatch, error) {
+	savePath := strings.TrimSpace(dir.SavePath)
+	contentPrefix := strings.TrimSpace(dir.ContentPrefix)
+	batch := &model.OrganizeBatch{
+		UserID:           dir.UserID,
+		CloudStorageID:   dir.CloudStorageID,
+		CloudDirectoryID: dir.ID,
+		SourceFolderID:   folderID,
+		SavePath:         savePath,
+		ContentPrefix:    contentPrefix,
+	}
+	for _, item := range items {
+		if strings.TrimSpace(item.FileID) == "" {
+			continue
+		}
+		newName := strings.TrimSpace(item.RenameTo)
+		if newName == "" {
+			newName = item.FileName
+		}
+		batchItem := model.OrganizeBatchItem{
+			FileID:           item.FileID,
+			PickCode:         item.PickCode,
+			IsSubtitle:       isOrganizeSubtitleItem(item),
+			OriginalName:     item.FileName,
+			OriginalParentID: folderID,
+			NewName:          newName,
+			NewParentID:      strings.TrimSpace(item.TargetDirID),
+			NewPath:          item.TargetPath,
+		}
+		if savePath != "" && strings.TrimSpace(item.TargetPath) != "" {
+			if batchItem.IsSubtitle || isSubtitleFile(newName) {
+				batchItem.LocalPath = pathhelper.SafeFilePathJoin(savePath, item.TargetPath)
+			} else {
+				batchItem.LocalPath, _ = buildStrmInfo(savePath, contentPrefix, item.TargetPath, dir.ContentEncodeURI)
+			}
+			if content, err := os.ReadFile(batchItem.LocalPath); err == nil {
+				batchItem.LocalExisted = true
+				if !batchItem.IsSubtitle {
+					batchItem.LocalPreviousContent = string(content)
+				}
+			}
+		}
+		batch.Items = append(batch.Items, batchItem)
+	}
+	if err := service.CreateOrganizeBatch(batch); err != nil {
+		return nil, err
+	}
+	return batch, nil
+}
+
+// ListBatches 分页查询整理批次
+// query: page, size, status, cloud_directory_id
+func (h *OrganizeHandler) ListBatches(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return
+	}
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	size, _ := strconv.Atoi(c.DefaultQuery("size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if size <= 0 || size > 200 {
+		size = 20
+	}
+
+	q := database.DB.Model(&model.OrganizeBatch{}).Where("user_id = ?", userIDVal.(uint))
+	if status := c.Query("status"); status != "" {
+		q = q.Where("status = ?", status)
+	}
+	if v := c.Query("cloud_directory_id"); v != "" {
+		if id, err := strconv.Atoi(v); err == nil {
+			q = q.Where("cloud_directory_id = ?", id)
+		}
+	}
+
+	var total int64
+	q.Count(&total)
+
+	var list []model.OrganizeBatch
+	if err := q.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&list).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "查询失败: "+err.Error())
+		return
+	}
+
+	h.success(c, gin.H{
+		"list":  list,
+		"total": total,
+		"page":  page,
+		"size":  size,
+	}, "获取整理批次成功")
+}
+
+// GetBatch 查询整理批次详情（含文件列表）
+func (h *OrganizeHandler) GetBatch(c *gin.Context) {
+	batch, ok := h.loadOrganizeBatch(c)
+	if !ok {
+		return
+	}
+	if err := database.DB.Where("batch_id = ?", batch.ID).Order("id ASC").Find(&batch.Items).Error; err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "查询批次文件失败: "+err.Error())
+		return
+	}
+	h.success(c, batch, "获取整理批次成功")
+}
+
+// RevertBatch 撤销整理批次：文件改回原名并移回原目录，删除生成的 STRM 与字幕
+func (h *OrganizeHandler) RevertBatch(c *gin.Context) {
+	batch, ok := h.loadOrganizeBatch(c)
+	if !ok {
+		return
+	}
+	if batch.Status == model.OrganizeBatchStatusReverted {
+		h.error(c, http.StatusConflict, 409, "整理批次已撤销")
+		return
+	}
+
+	var storage model.CloudStorage
+	if err := database.DB.Where("id = ? AND user_id = ?", batch.CloudStorageID, batch.UserID).First(&storage).Error; err != nil {
+		h.error(c, http.StatusBadRequest, 400, "云存储不存在或无权限")
+		return
+	}
+	if strings.TrimSpace(storage.Cookie) == "" {
+		h.error(c, http.StatusBadRequest, 400, "115 Cookie 为空")
+		return
+	}
+	webClient, err := h.web115Svc.NewClient(storage.Cookie)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "115 Cookie 无效")
+		return
+	}
+
+	if err := service.RevertOrganizeBatch(h.logger, &batch, web115OrganizeBatchOps{svc: h.web115Svc, client: webClient}); err != nil {
+		if errors.Is(err, service.ErrOrganizeBatchReverted) {
+			h.error(c, http.StatusConflict, 409, err.Error())
+			return
+		}
+		h.error(c, http.StatusInternalServerError, 500, "撤销整理失败: "+err.Error())
+		return
+	}
+	if batch.Status != model.OrganizeBatchStatusReverted {
+		h.success(c, batch, "部分文件撤销失败，可重试: "+batch.Error)
+		return
+	}
+	h.success(c, batch, "撤销整理成功")
+}
+
+func (h *OrganizeHandler) loadOrganizeBatch(c *gin.Context) (model.OrganizeBatch, bool) {
+	var batch model.OrganizeBatch
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return batch, false
+	}
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "无效的批次ID")
+		return batch, false
+	}
+	if err := database.DB.Where("id = ? AND user_id = ?", id, userIDVal.(uint)).First(&batch).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			h.error(c, http.StatusNotFound, 404, "整理批次不存在")
+		} else {
+			h.error(c, http.StatusInternalServerError, 500, "查询整理批次失败: "+err.Error())
+		}
+		return batch, false
+	}
+	return batch, true
+}
@@ -165,6 +165,59 @@ func (h *RSSAutomationHandler) UpdateWorkflow(c *gin.Context) {
 	c.JSON(http.StatusOK, NewSuccessResponse("自动化流程已更新", gin.H{"workflow": updated, "validation": validation}))
 }
 
+func (h *RSSAutomationHandler) ListSubWorkflows(c *gin.Context) {
+	subWorkflows, err := h.service.ListSubWorkflows()
+	if respondRSSAutomationError(c, err, "获取子流程列表失败") {
+		return
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse("获取子流程列表成功", subWorkflows))
+}
+
+func (h *RSSAutomationHandler) CreateSubWorkflow(c *gin.Context) {
+	var input service.RSSAutomationSubWorkflowInput
+	if !bindRSSAutomationJSON(c, &input) {
+		return
+	}
+	created, validation, err := h.service.CreateSubWorkflow(input)
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, NewErrorResponse("创建子流程失败", err.Error()))
+		return
+	}
+	c.JSON(http.StatusCreated, NewSuccessResponse("子流程已创建", gin.H{"sub_workflow": created, "validation": validation}))
+}
+
+func (h *RSSAutomationHandler) UpdateSubWorkflow(c *gin.Context) {
+	id, ok := rssAutomationID(c, "子流程")
+	if !ok {
+		return
+	}
+	var input service.RSSAutomationSubWorkflowInput
+	if !bindRSSAutomationJSON(c, &input) {
+		return
+	}
+	updated, validation, err := h.service.UpdateSubWorkflow(id, input)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, NewErrorResponse("子流程不存在", ""))
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusUnprocessableEntity, NewErrorResponse("更新子流程失败", err.Error()))
+		return
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse("子流程已更新", gin.H{"sub_workflow": updated, "validation": validation}))
+}
+
+func (h *RSSAutomationHandler) DeleteSubWorkflow(c *gin.Context) {
+	id, ok := rssAutomationID(c, "子流程")
+	if !ok {
+		return
+	}
+	if respondRSSAutomationError(c, h.service.DeleteSubWorkflow(id), "删除子流程失败") {
+		return
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse("子流程已删除", gin.H{}))
+}
+
 func (h *RSSAutomationHandler) ListManualCandidates(c *gin.Context) {
 	id, ok := rssAutomationID(c, "自动化流程")
 	if !ok {
@@ -194,6 +247,23 @@ func (h *RSSAutomationHandler) CreateManualRuns(c *gin.Context) {
 	c.JSON(http.StatusOK, NewSuccessResponse("所选条目已加入运行队列", result))
 }
 
+func (h *RSSAutomationHandler) TriggerWorkflow(c *gin.Context) {
+	id, ok := rssAutomationID(c, "自动化流程")
+	if !ok {
+		return
+	}
+	var input service.RSSAutomationTriggerInput
+	// 允许不带请求体直接触发，此时只使用触发器中配置的默认上下文
+	if c.Request.ContentLength != 0 && !bindRSSAutomationJSON(c, &input) {
+		return
+	}
+	result, err := h.service.TriggerWorkflow(id, input)
+	if respondRSSAutomationError(c, err, "触发流程失败") {
+		return
+	}
+	c.JSON(http.StatusOK, NewSuccessResponse("流程已触发", result))
+}
+
 func (h *RSSAutomationHandler) CreateTarget(c *gin.Context) {
 	var input service.RSSAutomationTargetInput
 	if !bindRSSAutomationJSON(c, &input) {
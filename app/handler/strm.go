@@ -3,6 +3,7 @@ package handler
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"film-fusion/app/database"
 	"film-fusion/app/logger"
 	"film-fusion/app/model"
@@ -28,14 +29,18 @@ type StrmHandler struct {
 	logger         *logger.Logger
 	sdk115Open     *sdk115.Client
 	download115Svc *service.Download115Service
+	reconcileSvc   *service.StrmReconcileService
+	snapshotSvc    *service.CloudTreeSnapshotService
 }
 
 // NewStrmHandler 构造函数
-func NewStrmHandler(log *logger.Logger, download115Svc *service.Download115Service) *StrmHandler {
+func NewStrmHandler(log *logger.Logger, download115Svc *service.Download115Service, reconcileSvc *service.StrmReconcileService, snapshotSvc *service.CloudTreeSnapshotService) *StrmHandler {
 	return &StrmHandler{logger: log,
 		sdk115Open: sdk115.New(),
 
-		download115Svc: download115Svc}
+		download115Svc: download115Svc,
+		reconcileSvc:   reconcileSvc,
+		snapshotSvc:    snapshotSvc}
 }
 
 // success 统一成功响应
@@ -54,6 +59,7 @@ func (h *StrmHandler) error(c *gin.Context, statusCode int, errorCode int, messa
 // - content_prefix / ContentPrefix
 // - save_local_path / saveLocalPath
 // - link_type / LinkType (目前只支持 strm)
+// - snapshot_cloud_path_id（可选）：提供时不再需要 world 文件，直接使用该云路径映射已同步完成的目录树快照
 // 生成 STRM 文件。
 func (h *StrmHandler) GenStrmWith115DirectoryTree(c *gin.Context) {
 	// 验证用户
@@ -70,15 +76,34 @@ func (h *StrmHandler) GenStrmWith115DirectoryTree(c *gin.Context) {
 		return
 	}
 
+	// 目录树快照模式：由已同步的快照代替上传的 world 文件
+	var snapshotCloudPath *model.CloudPath
+	if snapshotIDStr := strings.TrimSpace(c.PostForm("snapshot_cloud_path_id")); snapshotIDStr != "" {
+		var cloudPath model.CloudPath
+		if err := database.DB.Where("id = ? AND user_id = ?", snapshotIDStr, userID).First(&cloudPath).Error; err != nil {
+			h.error(c, http.StatusBadRequest, 400, "云路径映射不存在或无权限")
+			return
+		}
+		state, err := h.snapshotSvc.State(cloudPath.ID)
+		if err != nil || state.Status != model.CloudTreeSnapshotStatusCompleted {
+			h.error(c, http.StatusBadRequest, 400, "该云路径映射没有已完成的目录树快照，请先同步快照")
+			return
+		}
+		snapshotCloudPath = &cloudPath
+	}
+
 	// 获取文件
 	fileHeader, err := c.FormFile("world")
-	if err != nil {
+	if err != nil && snapshotCloudPath == nil {
 		h.error(c, http.StatusBadRequest, 400, "请上传名为 world 的文件")
 		return
 	}
 
 	// 获取字段（支持大小写/下划线两种风格）
 	cloudStorageIDStr := c.PostForm("cloud_storage_id")
+	if cloudStorageIDStr == "" && snapshotCloudPath != nil {
+		cloudStorageIDStr = strconv.FormatUint(uint64(snapshotCloudPath.CloudStorageID), 10)
+	}
 
 	if cloudStorageIDStr == "" {
 		h.error(c, http.StatusBadRequest, 400, "缺少 cloud_storage_id")
@@ -144,6 +169,33 @@ func (h *StrmHandler) GenStrmWith115DirectoryTree(c *gin.Context) {
 		return
 	}
 
+	if snapshotCloudPath != nil {
+		if snapshotCloudPath.CloudStorageID != storage.ID {
+			h.error(c, http.StatusBadRequest, 400, "快照所属云路径映射与 cloud_storage_id 不一致")
+			return
+		}
+		go func(cloudPath model.CloudPath, storage model.CloudStorage, contentPrefix, saveLocalPath, filterRules, linkType string) {
+			paths, err := h.snapshotSvc.TreePaths(cloudPath)
+			if err != nil {
+				h.logger.Errorf("读取目录树快照失败: %v", err)
+				return
+			}
+			if _, genErr := h.generateLinksFromPaths(paths, "snapshot", storage, contentPrefix, saveLocalPath, filterRules, linkType); genErr != nil {
+				h.logger.Errorf("链接生成失败: %v", genErr)
+			}
+		}(*snapshotCloudPath, storage, contentPrefix, saveLocalPath, filterRules, linkType)
+
+		h.success(c, gin.H{
+			"snapshot_cloud_path_id": snapshotCloudPath.ID,
+			"cloud_storage_id":       cloudStorageID,
+			"content_prefix":         contentPrefix,
+			"save_local_path":        saveLocalPath,
+			"link_type":              linkType,
+			"status":                 "accepted",
+		}, "任务已提交，后台处理")
+		return
+	}
+
 	// 保存上传文件到临时目录
 	uploadDir := filepath.Join("data", "uploads")
 	if err := os.MkdirAll(uploadDir, 0755); err != nil {
@@ -224,8 +276,8 @@ func (h *StrmHandler) RegenerateDirectory(c *gin.Context) {
 		h.error(c, http.StatusBadRequest, 400, "关联的云存储不存在")
 		return
 	}
-	if cloudPath.CloudStorage.StorageType != model.StorageType115Open {
-		h.error(c, http.StatusBadRequest, 400, "仅支持 115open 存储类型的云路径映射")
+	if !service.IsSupportedStorageType(cloudPath.CloudStorage.StorageType) {
+		h.error(c, http.StatusBadRequest, 400, "不支持的云存储类型: "+cloudPath.CloudStorage.StorageType)
 		return
 	}
 	if !cloudPath.CloudStorage.IsAvailable() {
@@ -245,7 +297,7 @@ func (h *StrmHandler) RegenerateDirectory(c *gin.Context) {
 			}
 		}()
 		h.logger.Infof("[regenerate-strm] 开始重生成 STRM: dir=%s cloud_path_id=%d", dir, cp.ID)
-		strmSvc.WalkDirWith115OpenAPI(dir, cp)
+		strmSvc.WalkDir(dir, cp)
 		h.logger.Infof("[regenerate-strm] 重生成 STRM 完成: dir=%s cloud_path_id=%d", dir, cp.ID)
 	}(cloudDir, cloudPath)
 
@@ -256,6 +308,228 @@ func (h *StrmHandler) RegenerateDirectory(c *gin.Context) {
 	}, "任务已提交，后台重生成 STRM，结果见整理日志")
 }
 
+type reconcilePayload struct {
+	CloudPathID uint `json:"cloud_path_id" binding:"required"`
+	// Apply 为 false 时只生成 dry-run 差异报告，不修改本地文件
+	Apply bool `json:"apply"`
+}
+
+// Reconcile POST /api/strm/reconcile
+// 对指定云路径映射做全量 STRM 对账（异步执行），报告通过 GetReconcileReport 查询，修复动作写整理日志。
+func (h *StrmHandler) Reconcile(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return
+	}
+	userID := userIDVal.(uint)
+
+	var payload reconcilePayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		h.error(c, http.StatusBadRequest, 400, "参数错误: "+err.Error())
+		return
+	}
+
+	var cloudPath model.CloudPath
+	if err := database.DB.Preload("CloudStorage").
+		Where("id = ? AND user_id = ?", payload.CloudPathID, userID).
+		First(&cloudPath).Error; err != nil {
+		h.error(c, http.StatusBadRequest, 400, "云路径映射不存在或无权限")
+		return
+	}
+	if cloudPath.CloudStorage == nil || !service.IsSupportedStorageType(cloudPath.CloudStorage.StorageType) {
+		h.error(c, http.StatusBadRequest, 400, "关联的云存储不存在或类型不支持")
+		return
+	}
+	if strings.TrimSpace(cloudPath.LocalPath) == "" {
+		h.error(c, http.StatusBadRequest, 400, "该云路径映射未配置本地路径，无法对账")
+		return
+	}
+
+	report, err := h.reconcileSvc.StartReconcile(cloudPath, payload.Apply, model.OrganizeTriggerManual)
+	if err != nil {
+		if errors.Is(err, service.ErrStrmReconcileRunning) {
+			h.error(c, http.StatusConflict, 409, err.Error())
+			return
+		}
+		h.error(c, http.StatusInternalServerError, 500, "启动对账失败: "+err.Error())
+		return
+	}
+	h.success(c, report, "对账任务已提交")
+}
+
+// GetReconcileReport GET /api/strm/reconcile/:cloud_path_id 获取最近一次对账报告
+func (h *StrmHandler) GetReconcileReport(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return
+	}
+	userID := userIDVal.(uint)
+
+	cloudPathID, err := strconv.ParseUint(c.Param("cloud_path_id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "cloud_path_id 无效")
+		return
+	}
+	var count int64
+	database.DB.Model(&model.CloudPath{}).Where("id = ? AND user_id = ?", cloudPathID, userID).Count(&count)
+	if count == 0 {
+		h.error(c, http.StatusNotFound, 404, "云路径映射不存在或无权限")
+		return
+	}
+
+	report := h.reconcileSvc.LatestReport(uint(cloudPathID))
+	if report == nil {
+		h.error(c, http.StatusNotFound, 404, "暂无对账报告")
+		return
+	}
+	h.success(c, report, "获取对账报告成功")
+}
+
+type snapshotSyncPayload struct {
+	CloudPathID uint `json:"cloud_path_id" binding:"required"`
+	// Full 忽略目录修改时间，重新列举全部目录
+	Full bool `json:"full"`
+	// GenerateStrm 同步完成后为新增/变化的文件生成 STRM，并删除已消失文件的 STRM
+	GenerateStrm bool `json:"generate_strm"`
+}
+
+// SyncSnapshot POST /api/strm/snapshot/sync
+// 异步同步云路径映射的目录树快照；上次中断或失败时从断点继续。
+func (h *StrmHandler) SyncSnapshot(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return
+	}
+	userID := userIDVal.(uint)
+
+	var payload snapshotSyncPayload
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		h.error(c, http.StatusBadRequest, 400, "参数错误: "+err.Error())
+		return
+	}
+
+	var cloudPath model.CloudPath
+	if err := database.DB.Preload("CloudStorage").
+		Where("id = ? AND user_id = ?", payload.CloudPathID, userID).
+		First(&cloudPath).Error; err != nil {
+		h.error(c, http.StatusBadRequest, 400, "云路径映射不存在或无权限")
+		return
+	}
+	if cloudPath.CloudStorage == nil || !service.IsSupportedStorageType(cloudPath.CloudStorage.StorageType) {
+		h.error(c, http.StatusBadRequest, 400, "关联的云存储不存在或类型不支持")
+		return
+	}
+	if payload.GenerateStrm && strings.TrimSpace(cloudPath.LocalPath) == "" {
+		h.error(c, http.StatusBadRequest, 400, "该云路径映射未配置本地路径，无法生成 STRM")
+		return
+	}
+
+	strmSvc := service.NewStrmService(h.logger, h.download115Svc)
+	go func(cp model.CloudPath, payload snapshotSyncPayload) {
+		defer func() {
+			if r := recover(); r != nil {
+				h.logger.Errorf("[snapshot] 目录树快照同步 panic: %v", r)
+			}
+		}()
+		var result *service.CloudTreeSyncResult
+		var err error
+		if payload.GenerateStrm {
+			result, err = h.snapshotSvc.SyncAndGenerateStrm(context.Background(), strmSvc, cp, payload.Full)
+		} else {
+			result, err = h.snapshotSvc.Sync(context.Background(), cp, payload.Full)
+		}
+		if err != nil {
+			h.logger.Errorf("[snapshot] 目录树快照同步失败 cloud_path_id=%d: %v", cp.ID, err)
+			return
+		}
+		h.logger.Infof("[snapshot] 目录树快照同步完成 cloud_path_id=%d: 列举 %d 个目录, 复用 %d 个目录, 文件 %d, 变化 %d, 删除 %d",
+			cp.ID, result.DirsListed, result.DirsReused, result.Files, result.Changed, result.Removed)
+	}(cloudPath, payload)
+
+	h.success(c, gin.H{
+		"cloud_path_id": cloudPath.ID,
+		"full":          payload.Full,
+		"generate_strm": payload.GenerateStrm,
+		"status":        "accepted",
+	}, "任务已提交，后台同步目录树快照")
+}
+
+// GetSnapshotState GET /api/strm/snapshot/:cloud_path_id 获取目录树快照同步状态
+func (h *StrmHandler) GetSnapshotState(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return
+	}
+	userID := userIDVal.(uint)
+
+	cloudPathID, err := strconv.ParseUint(c.Param("cloud_path_id"), 10, 32)
+	if err != nil {
+		h.error(c, http.StatusBadRequest, 400, "cloud_path_id 无效")
+		return
+	}
+	var count int64
+	database.DB.Model(&model.CloudPath{}).Where("id = ? AND user_id = ?", cloudPathID, userID).Count(&count)
+	if count == 0 {
+		h.error(c, http.StatusNotFound, 404, "云路径映射不存在或无权限")
+		return
+	}
+
+	state, err := h.snapshotSvc.State(uint(cloudPathID))
+	if err != nil {
+		h.error(c, http.StatusNotFound, 404, "尚未同步目录树快照")
+		return
+	}
+	h.success(c, state, "获取快照状态成功")
+}
+
+// RevokePlaybackTokens 吊销签名 STRM 播放令牌
+// 请求体：{"scope":"user"} 吊销当前用户的全部令牌；{"scope":"storage","storage_id":1} 只吊销指定云存储的令牌。
+// 吊销后旧 STRM 立即无法播放，需重新对账或重新渲染生成新令牌。
+func (h *StrmHandler) RevokePlaybackTokens(c *gin.Context) {
+	userIDVal, exists := c.Get("user_id")
+	if !exists {
+		h.error(c, http.StatusUnauthorized, 401, "用户未认证")
+		return
+	}
+	userID := userIDVal.(uint)
+
+	var payload struct {
+		Scope     string `json:"scope" binding:"required"`
+		StorageID uint   `json:"storage_id"`
+	}
+	if err := c.ShouldBindJSON(&payload); err != nil {
+		h.error(c, http.StatusBadRequest, 400, err.Error())
+		return
+	}
+
+	scopeID := userID
+	switch payload.Scope {
+	case model.StrmPlaybackScopeUser:
+	case model.StrmPlaybackScopeStorage:
+		var count int64
+		database.DB.Model(&model.CloudStorage{}).Where("id = ? AND user_id = ?", payload.StorageID, userID).Count(&count)
+		if count == 0 {
+			h.error(c, http.StatusNotFound, 404, "云存储不存在或无权限")
+			return
+		}
+		scopeID = payload.StorageID
+	default:
+		h.error(c, http.StatusBadRequest, 400, "scope 仅支持 user 或 storage")
+		return
+	}
+
+	version, err := service.RevokeStrmPlaybackTokens(payload.Scope, scopeID)
+	if err != nil {
+		h.error(c, http.StatusInternalServerError, 500, "吊销播放令牌失败: "+err.Error())
+		return
+	}
+	h.success(c, gin.H{"scope": payload.Scope, "scope_id": scopeID, "version": version}, "播放令牌已吊销，请重新生成 STRM")
+}
+
 func (h *StrmHandler) generateLinksFrom115DirectoryTree(worldFilePath string, storage model.CloudStorage, contentPrefix, saveLocalPath, filterRules, linkType string) (map[string]any, error) {
 	// 读取并按 UTF-16(含BOM优先) -> UTF-8 解码；若失败则按 UTF-8 原样读取
 	decoded, err := readFileUTF16(worldFilePath)
@@ -272,6 +546,11 @@ func (h *StrmHandler) generateLinksFrom115DirectoryTree(worldFilePath string, st
 	text := string(decoded)
 	paths := parsePaths(text)
 
+	return h.generateLinksFromPaths(paths, filepath.Base(worldFilePath), storage, contentPrefix, saveLocalPath, filterRules, linkType)
+}
+
+// generateLinksFromPaths 按 115 根目录为基准的路径列表生成 STRM；路径来自 world 文件或目录树快照。
+func (h *StrmHandler) generateLinksFromPaths(paths []string, sourceName string, storage model.CloudStorage, contentPrefix, saveLocalPath, filterRules, linkType string) (map[string]any, error) {
 	// 将保存路径规整
 	saveBase := filepath.Clean(saveLocalPath)
 	if err := os.MkdirAll(saveBase, 0755); err != nil {
@@ -373,7 +652,7 @@ func (h *StrmHandler) generateLinksFrom115DirectoryTree(worldFilePath string, st
 
 	result := map[string]any{
 		"status":          "generated",
-		"file":            filepath.Base(worldFilePath),
+		"file":            sourceName,
 		"total_paths":     len(paths),
 		"created_dirs":    createdDirs,
 		"queued_download": queuedDownload,
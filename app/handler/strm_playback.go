@@ -0,0 +1,47 @@
+package handler
+
+import (
+	"errors"
+	"film-fusion/app/service"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ServeStrmPlayback 处理签名 STRM 播放地址：校验令牌后 302 到实时直链。
+// 供 Infuse / VLC / Kodi 等直接读取 STRM 的播放器使用，不经过 Emby。
+func (h *EmbyProxyHandler) ServeStrmPlayback(c *gin.Context) {
+	claims, storage, err := service.VerifyStrmPlaybackToken(c.Param("token"))
+	if err != nil {
+		status := http.StatusForbidden
+		if !errors.Is(err, service.ErrStrmPlaybackTokenInvalid) &&
+			!errors.Is(err, service.ErrStrmPlaybackTokenExpired) &&
+			!errors.Is(err, service.ErrStrmPlaybackTokenRevoked) {
+			status = http.StatusInternalServerError
+		}
+		h.logger.Warnf("[STRM PLAY] 拒绝播放 remote=%s: %v", c.ClientIP(), err)
+		// 未鉴权的调用方只能看到固定提示，内部错误细节仅写日志
+		message := "播放令牌无效"
+		if status == http.StatusInternalServerError {
+			message = "校验播放令牌失败"
+		}
+		c.String(status, message)
+		return
+	}
+
+	userAgent := c.Request.UserAgent()
+	var redirectURL string
+	if storage.UsesPickcode() {
+		redirectURL, _, err = h.getDownloadURLForStorage(storage, claims.PickCode, userAgent)
+	} else {
+		redirectURL, _, err = h.getDownloadURLByPath(storage, claims.Path, userAgent)
+	}
+	if err != nil {
+		h.logger.Errorf("[STRM PLAY] 获取直链失败 storage=%d: %v", storage.ID, err)
+		c.String(http.StatusBadGateway, "获取播放地址失败")
+		return
+	}
+
+	h.log302(c, "strm-token", redirectURL)
+	c.Redirect(http.StatusFound, redirectURL)
+}
@@ -24,6 +24,7 @@ type WebhookHandler struct {
 	config       *config.Config
 	cd2NotifySvc *service.CD2NotifyService
 	md2NotifySvc *service.MoviePilot2NotifyService
+	arrNotifySvc *service.ArrNotifyService
 	sortNameSvc  *service.EmbySortNameService
 	watchSvc     *service.EmbyWatchService
 }
@@ -35,6 +36,7 @@ func NewWebhookHandler(log *logger.Logger, cfg *config.Config, download115Svc *s
 		config:       cfg,
 		cd2NotifySvc: service.NewCD2NotifyService(log, download115Svc),
 		md2NotifySvc: service.NewMoviePilot2NotifyService(log, download115Svc),
+		arrNotifySvc: service.NewArrNotifyService(log, download115Svc),
 		sortNameSvc:  sortNameSvc,
 		watchSvc:     watchSvc,
 	}
@@ -135,6 +137,89 @@ func (h *WebhookHandler) MoviePilotV2Webhook(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "ok"})
 }
 
+// ArrWebhook 接收 Sonarr/Radarr 的 Webhook，按 CloudPath.ArrPathPrefix 映射路径后生成/重命名/删除 STRM
+func (h *WebhookHandler) ArrWebhook(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20)
+	var requestBody service.ArrWebhookRequest
+	if err := c.ShouldBindJSON(&requestBody); err != nil {
+		h.logger.Errorf("解析 Sonarr/Radarr 请求体失败: %v", err)
+		service.WriteOrganizeLog(h.logger, service.OrganizeLogEntry{
+			Action: model.OrganizeActionWebhookRecv, Status: model.OrganizeStatusFailed,
+			Trigger: model.OrganizeTriggerArr, Error: err.Error(), Message: "解析 Sonarr/Radarr 请求体失败",
+		})
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	events, err := requestBody.Events()
+	if err != nil {
+		h.logger.Warnf("拒绝不安全的 Sonarr/Radarr 通知: %v", err)
+		service.WriteOrganizeLog(h.logger, service.OrganizeLogEntry{
+			Action: model.OrganizeActionWebhookRecv, Status: model.OrganizeStatusFailed,
+			Trigger: model.OrganizeTriggerArr, Error: err.Error(), Message: "拒绝不安全的 Sonarr/Radarr 请求",
+		})
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	h.dispatchArrEvents(c, fmt.Sprintf("instance=%s event=%s", requestBody.InstanceName, requestBody.EventType), events)
+}
+
+// QBittorrentWebhook 接收 qBittorrent「下载完成时运行外部程序」通过 curl 发来的通知，支持 JSON 与表单
+func (h *WebhookHandler) QBittorrentWebhook(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, 1<<20)
+	var requestBody service.QBittorrentNotifyRequest
+	if err := c.ShouldBind(&requestBody); err != nil {
+		h.logger.Errorf("解析 qBittorrent 请求体失败: %v", err)
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	events, err := requestBody.Events()
+	if err != nil {
+		h.logger.Warnf("拒绝不安全的 qBittorrent 通知: %v", err)
+		service.WriteOrganizeLog(h.logger, service.OrganizeLogEntry{
+			Action: model.OrganizeActionWebhookRecv, Status: model.OrganizeStatusFailed,
+			Trigger: model.OrganizeTriggerArr, Error: err.Error(), Message: "拒绝不安全的 qBittorrent 请求",
+		})
+		c.JSON(http.StatusBadRequest, gin.H{"message": err.Error()})
+		return
+	}
+	h.dispatchArrEvents(c, fmt.Sprintf("qbittorrent name=%s category=%s files=%d", requestBody.Name, requestBody.Category, requestBody.NumFiles), events)
+}
+
+func (h *WebhookHandler) dispatchArrEvents(c *gin.Context, summary string, events []service.ArrFileEvent) {
+	var source, target string
+	if len(events) > 0 {
+		source, target = events[0].PreviousPath, events[0].Path
+		summary = fmt.Sprintf("%s action=%s items=%d", summary, events[0].Action, len(events))
+	}
+	service.WriteOrganizeLog(h.logger, service.OrganizeLogEntry{
+		Action: model.OrganizeActionWebhookRecv, Status: model.OrganizeStatusSuccess,
+		Trigger: model.OrganizeTriggerArr, Source: source, Target: target, Message: summary,
+	})
+	if len(events) == 0 {
+		// Test/Grab 等事件无需处理
+		c.JSON(http.StatusOK, gin.H{"message": "ok"})
+		return
+	}
+
+	var cloudPaths []model.CloudPath
+	if err := database.DB.Where("arr_path_prefix <> ''").Preload("CloudStorage").Find(&cloudPaths).Error; err != nil {
+		h.logger.Errorf("获取 CloudPath 记录失败: %v", err)
+		c.JSON(http.StatusInternalServerError, gin.H{"message": "获取 CloudPath 记录失败"})
+		return
+	}
+
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				h.logger.Errorf("处理下载管理器 Webhook 事件 panic: %v", r)
+			}
+		}()
+		h.arrNotifySvc.ProcessEvents(events, cloudPaths)
+	}()
+
+	c.JSON(http.StatusOK, gin.H{"message": "ok"})
+}
+
 // EmbyWebhookRequest 定义 Emby webhook 请求的数据结构
 type EmbyWebhookRequest struct {
 	Title        string            `json:"Title"`
@@ -0,0 +1,243 @@
+// Package metrics 在 Prometheus 客户端库之上封装本项目用到的计数器、直方图与抓取时采集的 Gauge。
+// 业务代码只依赖这里的精简 API，抓取格式与协商由 promhttp 处理。
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"sync"
+
+	"film-fusion/app/logger"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// DefaultBuckets 直链解析等网络请求耗时的默认分桶(秒)
+var DefaultBuckets = []float64{0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// Sample 一个带标签的样本值，标签顺序与指标声明的标签名一致
+type Sample struct {
+	LabelValues []string
+	Value       float64
+}
+
+// CollectFunc 抓取时计算当前值，用于队列深度、活跃会话等 Gauge
+type CollectFunc func() ([]Sample, error)
+
+// Registry 指标注册表。抓取时采集失败的 Gauge 会被跳过，并记录日志与 collectErrors 计数
+type Registry struct {
+	registry      *prometheus.Registry
+	collectErrors *CounterVec
+
+	mu     sync.RWMutex
+	logger *logger.Logger
+}
+
+// NewRegistry 创建只含采集错误计数器的注册表
+func NewRegistry() *Registry {
+	r := &Registry{registry: prometheus.NewRegistry()}
+	r.collectErrors = r.NewCounterVec(
+		"filmfusion_metrics_collect_errors_total",
+		"抓取时 Gauge 采集失败或样本标签数不符而被跳过的次数。",
+		"metric",
+	)
+	return r
+}
+
+var defaultRegistry = NewRegistry()
+
+// Default 进程级默认注册表，/metrics 输出的就是它
+func Default() *Registry {
+	return defaultRegistry
+}
+
+// SetLogger 设置采集错误的日志输出，未设置时只计数
+func (r *Registry) SetLogger(log *logger.Logger) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.logger = log
+}
+
+// collectFailed 记录一次 Gauge 采集失败
+func (r *Registry) collectFailed(name string, err error) {
+	r.collectErrors.Inc(name)
+	r.mu.RLock()
+	log := r.logger
+	r.mu.RUnlock()
+	if log != nil {
+		log.Warnf("[METRICS] 采集指标 %s 失败，本次抓取跳过: %v", name, err)
+	}
+}
+
+// WriteTo 以 Prometheus 文本格式写出全部指标，主要供测试使用
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	families, err := r.registry.Gather()
+	if err != nil {
+		return 0, err
+	}
+	counter := &countingWriter{w: w}
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(counter, family); err != nil {
+			return counter.n, err
+		}
+	}
+	return counter.n, nil
+}
+
+// Handler 返回输出注册表内容的 http.Handler；单个指标出错时其余指标照常输出
+func (r *Registry) Handler() http.Handler {
+	return promhttp.HandlerFor(r.registry, promhttp.HandlerOpts{
+		ErrorLog:      handlerErrorLog{r},
+		ErrorHandling: promhttp.ContinueOnError,
+	})
+}
+
+// handlerErrorLog 将 promhttp 的错误转到注册表的日志
+type handlerErrorLog struct {
+	r *Registry
+}
+
+func (l handlerErrorLog) Println(v ...interface{}) {
+	l.r.mu.RLock()
+	log := l.r.logger
+	l.r.mu.RUnlock()
+	if log != nil {
+		log.Warnf("[METRICS] %s", fmt.Sprint(v...))
+	}
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// CounterVec 只增不减的计数器
+type CounterVec struct {
+	vec *prometheus.CounterVec
+}
+
+// NewCounterVec 在默认注册表中声明计数器
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	return defaultRegistry.NewCounterVec(name, help, labels...)
+}
+
+// NewCounterVec 在注册表中声明计数器，名称重复时 panic
+func (r *Registry) NewCounterVec(name, help string, labels ...string) *CounterVec {
+	vec := prometheus.NewCounterVec(prometheus.CounterOpts{Name: name, Help: help}, labels)
+	r.registry.MustRegister(vec)
+	return &CounterVec{vec: vec}
+}
+
+// Inc 计数加一，标签值个数与声明不符时 panic
+func (c *CounterVec) Inc(labelValues ...string) {
+	c.vec.WithLabelValues(labelValues...).Inc()
+}
+
+// Add 计数增加 delta，负数忽略
+func (c *CounterVec) Add(delta float64, labelValues ...string) {
+	if delta < 0 {
+		return
+	}
+	c.vec.WithLabelValues(labelValues...).Add(delta)
+}
+
+// Value 返回某组标签的当前值，主要供测试使用
+func (c *CounterVec) Value(labelValues ...string) float64 {
+	var m dto.Metric
+	if err := c.vec.WithLabelValues(labelValues...).Write(&m); err != nil {
+		return 0
+	}
+	return m.GetCounter().GetValue()
+}
+
+// HistogramVec 分桶统计观测值
+type HistogramVec struct {
+	vec *prometheus.HistogramVec
+}
+
+// NewHistogramVec 在默认注册表中声明直方图，buckets 为空时使用 DefaultBuckets
+func NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	return defaultRegistry.NewHistogramVec(name, help, buckets, labels...)
+}
+
+// NewHistogramVec 在注册表中声明直方图
+func (r *Registry) NewHistogramVec(name, help string, buckets []float64, labels ...string) *HistogramVec {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+	vec := prometheus.NewHistogramVec(prometheus.HistogramOpts{Name: name, Help: help, Buckets: sorted}, labels)
+	r.registry.MustRegister(vec)
+	return &HistogramVec{vec: vec}
+}
+
+// Observe 记录一次观测值
+func (h *HistogramVec) Observe(value float64, labelValues ...string) {
+	h.vec.WithLabelValues(labelValues...).Observe(value)
+}
+
+// NewGaugeFunc 在默认注册表中声明抓取时计算的 Gauge
+func NewGaugeFunc(name, help string, collect CollectFunc, labels ...string) {
+	defaultRegistry.NewGaugeFunc(name, help, collect, labels...)
+}
+
+// NewGaugeFunc 在注册表中声明抓取时计算的 Gauge
+func (r *Registry) NewGaugeFunc(name, help string, collect CollectFunc, labels ...string) {
+	r.registry.MustRegister(&gaugeFunc{
+		registry: r,
+		name:     name,
+		labels:   len(labels),
+		desc:     prometheus.NewDesc(name, help, labels, nil),
+		collect:  collect,
+	})
+}
+
+// gaugeFunc 抓取时调用 collect 计算的 Gauge
+type gaugeFunc struct {
+	registry *Registry
+	name     string
+	labels   int
+	desc     *prometheus.Desc
+	collect  CollectFunc
+}
+
+func (g *gaugeFunc) Describe(ch chan<- *prometheus.Desc) {
+	ch <- g.desc
+}
+
+// Collect 采集出错或任一样本标签数不符时整个指标本次不输出，不影响其他指标
+func (g *gaugeFunc) Collect(ch chan<- prometheus.Metric) {
+	samples, err := g.collect()
+	if err != nil {
+		g.registry.collectFailed(g.name, err)
+		return
+	}
+	metrics := make([]prometheus.Metric, 0, len(samples))
+	for _, s := range samples {
+		if len(s.LabelValues) != g.labels {
+			g.registry.collectFailed(g.name, fmt.Errorf("需要 %d 个标签值，实际 %d 个", g.labels, len(s.LabelValues)))
+			return
+		}
+		m, err := prometheus.NewConstMetric(g.desc, prometheus.GaugeValue, s.Value, s.LabelValues...)
+		if err != nil {
+			g.registry.collectFailed(g.name, err)
+			return
+		}
+		metrics = append(metrics, m)
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+}
@@ -0,0 +1,75 @@
+package metrics
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	r := NewRegistry()
+	requests := r.NewCounterVec("test_requests_total", "Requests by source.", "source", "reason")
+	requests.Inc("proxyPlay", "")
+	requests.Inc("fallback", `路径未匹配 "a\b"`)
+	requests.Add(2, "proxyPlay", "")
+
+	latency := r.NewHistogramVec("test_latency_seconds", "Latency.", []float64{1, 0.1}, "storage")
+	latency.Observe(0.05, "7")
+	latency.Observe(0.5, "7")
+	latency.Observe(3, "7")
+
+	r.NewGaugeFunc("test_queue", "Queue depth.", func() ([]Sample, error) {
+		return []Sample{{LabelValues: []string{"pending"}, Value: 3}, {LabelValues: []string{"failed"}, Value: 0}}, nil
+	}, "status")
+	r.NewGaugeFunc("test_broken", "Broken collector.", func() ([]Sample, error) {
+		return nil, errors.New("db down")
+	})
+	r.NewGaugeFunc("test_mislabeled", "Wrong label count.", func() ([]Sample, error) {
+		return []Sample{{LabelValues: []string{"a", "b"}, Value: 1}}, nil
+	}, "status")
+
+	var out strings.Builder
+	if _, err := r.WriteTo(&out); err != nil {
+		t.Fatalf("WriteTo: %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{reason="",source="proxyPlay"} 3` + "\n",
+		`test_requests_total{reason="路径未匹配 \"a\\b\"",source="fallback"} 1` + "\n",
+		"# TYPE test_latency_seconds histogram\n",
+		`test_latency_seconds_bucket{storage="7",le="0.1"} 1` + "\n",
+		`test_latency_seconds_bucket{storage="7",le="1"} 2` + "\n",
+		`test_latency_seconds_bucket{storage="7",le="+Inf"} 3` + "\n",
+		`test_latency_seconds_sum{storage="7"} 3.55` + "\n",
+		`test_latency_seconds_count{storage="7"} 3` + "\n",
+		`test_queue{status="failed"} 0` + "\n" + `test_queue{status="pending"} 3` + "\n",
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("output missing %q:\n%s", want, text)
+		}
+	}
+	// 采集失败与标签数不符的 Gauge 被跳过并计数，不影响其他指标
+	if strings.Contains(text, "# TYPE test_broken") || strings.Contains(text, "# TYPE test_mislabeled") {
+		t.Fatalf("failed collectors should be skipped:\n%s", text)
+	}
+	for _, name := range []string{"test_broken", "test_mislabeled"} {
+		if got := r.collectErrors.Value(name); got != 1 {
+			t.Fatalf("collect errors for %s = %v, want 1", name, got)
+		}
+	}
+	// 按名称排序输出
+	if strings.Index(text, "test_latency_seconds") > strings.Index(text, "test_requests_total") {
+		t.Fatalf("families not sorted:\n%s", text)
+	}
+}
+
+func TestCounterVecRejectsWrongLabelCount(t *testing.T) {
+	c := NewRegistry().NewCounterVec("test_total", "help", "a")
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on wrong label count")
+		}
+	}()
+	c.Inc("x", "y")
+}
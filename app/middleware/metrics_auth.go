@@ -0,0 +1,36 @@
+package middleware
+
+import (
+	"film-fusion/app/config"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsAuth 保护 Prometheus /metrics 端点：未启用时返回 404，启用后校验独立 Bearer Token。
+// 与 webhook 鉴权一样按请求读取共享配置，保存系统设置后立即生效。
+func MetricsAuth(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := cfg.Metrics
+		if !settings.Enabled {
+			c.AbortWithStatus(http.StatusNotFound)
+			return
+		}
+
+		expected := strings.TrimSpace(settings.Token)
+		if len(expected) < 32 {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "metrics authentication is not configured"})
+			return
+		}
+
+		parts := strings.Fields(c.GetHeader("Authorization"))
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || !secureTokenEqual(parts[1], expected) {
+			c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
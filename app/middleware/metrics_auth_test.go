@@ -0,0 +1,51 @@
+package middleware
+
+import (
+	"film-fusion/app/config"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestMetricsAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const token = "00112233445566778899aabbccddeeff00112233445566778899aabbccddeeff"
+	cfg := &config.Config{}
+	router := gin.New()
+	router.GET("/metrics", MetricsAuth(cfg), func(c *gin.Context) { c.Status(http.StatusOK) })
+
+	serve := func(header string) int {
+		req := httptest.NewRequest(http.MethodGet, "/metrics", nil)
+		if header != "" {
+			req.Header.Set("Authorization", header)
+		}
+		res := httptest.NewRecorder()
+		router.ServeHTTP(res, req)
+		return res.Code
+	}
+
+	// 默认关闭，不暴露端点
+	if code := serve("Bearer " + token); code != http.StatusNotFound {
+		t.Fatalf("disabled status = %d, want %d", code, http.StatusNotFound)
+	}
+
+	cfg.Metrics = config.MetricsConfig{Enabled: true, Token: "short"}
+	if code := serve("Bearer short"); code != http.StatusServiceUnavailable {
+		t.Fatalf("weak token status = %d, want %d", code, http.StatusServiceUnavailable)
+	}
+
+	cfg.Metrics.Token = token
+	for header, want := range map[string]int{
+		"":                 http.StatusUnauthorized,
+		"Bearer wrong":     http.StatusUnauthorized,
+		"Basic " + token:   http.StatusUnauthorized,
+		"Bearer " + token:  http.StatusOK,
+		"bearer  " + token: http.StatusOK,
+	} {
+		if code := serve(header); code != want {
+			t.Fatalf("header %q status = %d, want %d", header, code, want)
+		}
+	}
+}
@@ -37,6 +37,38 @@ func CloudDrive2WebhookAuth(cfg *config.Config) gin.HandlerFunc {
 	}
 }
 
+// ArrWebhookAuth 验证 Sonarr/Radarr/qBittorrent 发来的共享密钥。
+// 这些端点会删除 STRM 甚至整个目录，未启用时直接返回 404，启用后始终要求 Token。
+// Sonarr/Radarr 的 Webhook 只能配置用户名/密码，因此除 Bearer Token 外也接受密码为 Token 的 Basic 认证。
+func ArrWebhookAuth(cfg *config.Config) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		settings := cfg.Webhook.Arr
+		if !settings.Enabled {
+			c.AbortWithStatusJSON(http.StatusNotFound, gin.H{"message": "Arr webhook is disabled"})
+			return
+		}
+
+		expected := strings.TrimSpace(settings.Token)
+		if len(expected) < 32 {
+			c.AbortWithStatusJSON(http.StatusServiceUnavailable, gin.H{"message": "Arr webhook authentication is not configured"})
+			return
+		}
+
+		if _, password, ok := c.Request.BasicAuth(); ok && secureTokenEqual(password, expected) {
+			c.Next()
+			return
+		}
+		parts := strings.Fields(c.GetHeader("Authorization"))
+		if len(parts) != 2 || !strings.EqualFold(parts[0], "Bearer") || !secureTokenEqual(parts[1], expected) {
+			c.Header("WWW-Authenticate", `Basic realm="arr-webhook"`)
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"message": "Unauthorized"})
+			return
+		}
+
+		c.Next()
+	}
+}
+
 func secureTokenEqual(actual, expected string) bool {
 	actualHash := sha256.Sum256([]byte(actual))
 	expectedHash := sha256.Sum256([]byte(expected))
@@ -52,3 +52,58 @@ func TestCloudDrive2WebhookAuth(t *testing.T) {
 		t.Fatalf("authentication disabled status = %d, want %d", res.Code, http.StatusNoContent)
 	}
 }
+
+func TestArrWebhookAuth(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	const token = "fedcba9876543210fedcba9876543210fedcba9876543210fedcba9876543210"
+	cfg := &config.Config{Webhook: config.WebhookConfig{
+		Arr: config.ArrWebhookConfig{Enabled: true, Token: token},
+	}}
+	router := gin.New()
+	router.Use(ArrWebhookAuth(cfg))
+	router.POST("/hook", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	tests := []struct {
+		name     string
+		bearer   string
+		user     string
+		password string
+		want     int
+	}{
+		{name: "missing", want: http.StatusUnauthorized},
+		{name: "wrong bearer", bearer: "wrong", want: http.StatusUnauthorized},
+		{name: "wrong basic password", user: "sonarr", password: "wrong", want: http.StatusUnauthorized},
+		{name: "valid bearer", bearer: token, want: http.StatusNoContent},
+		{name: "valid basic", user: "sonarr", password: token, want: http.StatusNoContent},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/hook", nil)
+			if tt.bearer != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.bearer)
+			}
+			if tt.user != "" {
+				req.SetBasicAuth(tt.user, tt.password)
+			}
+			res := httptest.NewRecorder()
+			router.ServeHTTP(res, req)
+			if res.Code != tt.want {
+				t.Fatalf("status = %d, want %d", res.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestArrWebhookAuthRejectsWhenDisabled(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfg := &config.Config{}
+	router := gin.New()
+	router.Use(ArrWebhookAuth(cfg))
+	router.POST("/hook", func(c *gin.Context) { c.Status(http.StatusNoContent) })
+
+	res := httptest.NewRecorder()
+	router.ServeHTTP(res, httptest.NewRequest(http.MethodPost, "/hook", nil))
+	if res.Code != http.StatusNotFound {
+		t.Fatalf("disabled status = %d, want %d", res.Code, http.StatusNotFound)
+	}
+}
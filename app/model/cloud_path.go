@@ -27,6 +27,29 @@ type CloudPath struct {
 	UpdatedAt       time.Time      `json:"updated_at"`
 	DeletedAt       gorm.DeletedAt `gorm:"index" json:"deleted_at"`
 
+	// ReconcileIntervalHours 全量 STRM 对账间隔(小时)，0 表示不定时对账，仅支持手动触发。
+	ReconcileIntervalHours int        `gorm:"default:0;comment:STRM对账间隔(小时)" json:"reconcile_interval_hours"`
+	LastReconciledAt       *time.Time `gorm:"comment:上次STRM对账时间" json:"last_reconciled_at"`
+
+	// ContentTemplate STRM 内容模板(Go text/template)，仅 StrmContentType=template 时生效，
+	// 可用变量见 service.StrmTemplateData，如 http://host/d/{{.Path}}?sign={{.Sign}}
+	ContentTemplate string `gorm:"type:text;comment:STRM内容模板" json:"content_template"`
+	// ContentSignKey 模板变量 Sign 的签名密钥(与 OpenList 的 token 一致)
+	ContentSignKey string `gorm:"size:255;comment:STRM内容签名密钥" json:"content_sign_key"`
+	// PlaybackTokenTTLHours StrmContentType=signed 时播放令牌的有效期(小时)，0 表示不过期(仍可吊销)；
+	// 非 0 时需开启定时对账且间隔小于有效期，由对账在到期前重新签发 STRM。
+	PlaybackTokenTTLHours int `gorm:"default:0;comment:STRM播放令牌有效期(小时)" json:"playback_token_ttl_hours"`
+	// MediaInfoSidecar 生成 STRM 后由后台队列探测云端文件并补写媒体信息旁路文件，空表示不生成
+	MediaInfoSidecar string `gorm:"size:20;comment:媒体信息旁路文件格式" json:"mediainfo_sidecar"`
+	// ArrPathPrefix Sonarr/Radarr/qBittorrent 上报路径的前缀，替换为 SourcePath 后得到监控事件路径；
+	// 为空时不接收这些下载管理器的 webhook。
+	ArrPathPrefix string `gorm:"size:500;comment:下载管理器上报路径前缀" json:"arr_path_prefix"`
+
+	// WatchPath SourceType=local_watch 时监听的本地挂载目录(rclone/CD2 FUSE)，对应云端的 SourcePath
+	WatchPath string `gorm:"size:500;comment:本地挂载监听目录" json:"watch_path"`
+	// WatchRescanMinutes 周期性全量扫描挂载目录的间隔(分钟)，弥补网络挂载上丢失的 inotify 事件；0 表示不扫描
+	WatchRescanMinutes int `gorm:"default:60;comment:挂载目录重扫间隔(分钟)" json:"watch_rescan_minutes"`
+
 	// 关联关系
 	User         *User         `gorm:"foreignKey:UserID" json:"user,omitempty"`
 	CloudStorage *CloudStorage `gorm:"foreignKey:CloudStorageID" json:"cloud_storage,omitempty"`
@@ -45,14 +68,35 @@ const (
 const (
 	SourceTypeCloudDrive2 = "clouddrive2"
 	SourceTypeMoviePilot2 = "moviepilot2"
+	// SourceTypeLocalWatch 通过 inotify 监听本地挂载目录产生事件
+	SourceTypeLocalWatch = "local_watch"
 )
 
 // StrmContentType STRM文件内容类型常量
 const (
 	StrmContentTypeOpenlist = "openlist"
 	StrmContentTypePath     = "path"
+	StrmContentTypeTemplate = "template"
+	// StrmContentTypeSigned 指向 Film Fusion 自身的签名播放地址，由服务端 302 到实时直链
+	StrmContentTypeSigned = "signed"
+)
+
+// MediaInfoSidecar 媒体信息旁路文件格式常量
+const (
+	MediaInfoSidecarJSON = "json" // Emby 兼容的 -mediainfo.json
+	MediaInfoSidecarNFO  = "nfo"  // Kodi/Emby 兼容的 NFO streamdetails
+	MediaInfoSidecarBoth = "both"
 )
 
+// IsValidMediaInfoSidecar 检查媒体信息旁路文件格式是否有效，空字符串表示关闭
+func IsValidMediaInfoSidecar(sidecar string) bool {
+	switch sidecar {
+	case "", MediaInfoSidecarJSON, MediaInfoSidecarNFO, MediaInfoSidecarBoth:
+		return true
+	}
+	return false
+}
+
 // IsValidLinkType 检查链接类型是否有效
 func IsValidLinkType(linkType string) bool {
 	return linkType == LinkTypeStrm
@@ -60,12 +104,13 @@ func IsValidLinkType(linkType string) bool {
 
 // IsValidStrmContentType 检查STRM文件内容类型是否有效
 func IsValidStrmContentType(contentType string) bool {
-	return contentType == StrmContentTypeOpenlist || contentType == StrmContentTypePath
+	return contentType == StrmContentTypeOpenlist || contentType == StrmContentTypePath ||
+		contentType == StrmContentTypeTemplate || contentType == StrmContentTypeSigned
 }
 
 // IsValidSourceType 检查源类型是否有效
 func IsValidSourceType(sourceType string) bool {
-	return sourceType == SourceTypeCloudDrive2 || sourceType == SourceTypeMoviePilot2
+	return sourceType == SourceTypeCloudDrive2 || sourceType == SourceTypeMoviePilot2 || sourceType == SourceTypeLocalWatch
 }
 
 // FilterRule 文件过滤规则结构
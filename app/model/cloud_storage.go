@@ -1,6 +1,8 @@
 package model
 
 import (
+	"encoding/json"
+	"fmt"
 	"log"
 	"strings"
 	"time"
@@ -115,9 +117,42 @@ func (cs CloudStorage) HasMatch302AccessCredential() bool {
 
 // StorageType 存储类型常量
 const (
-	StorageType115Open = "115open" // 115网盘 OpenAPI
+	StorageType115Open  = "115open"  // 115网盘 OpenAPI
+	StorageTypeOpenList = "openlist" // OpenList / AList HTTP API
+	StorageTypeWebDAV   = "webdav"   // 通用 WebDAV
 )
 
+// UsesPickcode 判断存储是否以 115 pickcode 定位文件；
+// 负载均衡秒传、pickcode 缓存等能力只对这类存储生效。
+func (cs CloudStorage) UsesPickcode() bool {
+	return cs.StorageType == StorageType115Open
+}
+
+// StorageEndpointConfig 基于 HTTP 端点的存储(OpenList / WebDAV)连接信息，保存在 Config 字段中。
+type StorageEndpointConfig struct {
+	URL      string `json:"url"`       // 服务地址，WebDAV 为挂载根地址，OpenList 为站点地址
+	Username string `json:"username"`  // 登录用户名
+	Password string `json:"password"`  // 登录密码
+	RootPath string `json:"root_path"` // 路径前缀，Match302 目标路径会拼接在其后
+}
+
+// EndpointConfig 解析 Config 字段中的端点配置，URL 为空时返回错误。
+func (cs CloudStorage) EndpointConfig() (StorageEndpointConfig, error) {
+	var cfg StorageEndpointConfig
+	if strings.TrimSpace(cs.Config) != "" {
+		if err := json.Unmarshal([]byte(cs.Config), &cfg); err != nil {
+			return cfg, fmt.Errorf("解析存储端点配置失败: %w", err)
+		}
+	}
+	cfg.URL = strings.TrimRight(strings.TrimSpace(cfg.URL), "/")
+	cfg.Username = strings.TrimSpace(cfg.Username)
+	cfg.RootPath = strings.TrimSpace(cfg.RootPath)
+	if cfg.URL == "" {
+		return cfg, fmt.Errorf("存储端点地址未配置")
+	}
+	return cfg, nil
+}
+
 // StorageStatus 存储状态常量
 const (
 	StatusActive   = "active"   // 正常
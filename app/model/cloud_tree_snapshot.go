@@ -0,0 +1,64 @@
+package model
+
+import "time"
+
+// 目录树快照同步状态
+const (
+	CloudTreeSnapshotStatusRunning   = "running"
+	CloudTreeSnapshotStatusCompleted = "completed"
+	CloudTreeSnapshotStatusFailed    = "failed"
+)
+
+// CloudTreeSnapshotEntry 云盘目录树快照中的一个文件或目录，按 (CloudPathID, FileID) 唯一。
+// 每轮同步递增 Generation：本轮看到的条目 SeenGeneration=当前轮次，
+// 同步结束时仍停留在旧轮次的条目即为云端已删除。
+type CloudTreeSnapshotEntry struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	CloudPathID uint      `gorm:"not null;uniqueIndex:uk_cloud_tree_snapshot_file,priority:1;index:idx_cloud_tree_snapshot_parent,priority:1" json:"cloud_path_id"`
+	FileID      string    `gorm:"size:255;not null;uniqueIndex:uk_cloud_tree_snapshot_file,priority:2" json:"file_id"`
+	ParentID    string    `gorm:"size:255;index:idx_cloud_tree_snapshot_parent,priority:2" json:"parent_id"`
+	Name        string    `gorm:"size:500" json:"name"`
+	Path        string    `gorm:"size:1024;comment:事件路径空间的完整路径(与 STRM 生成一致)" json:"path"`
+	IsDir       bool      `gorm:"index" json:"is_dir"`
+	Size        int64     `json:"size"`
+	SHA1        string    `gorm:"size:64" json:"sha1"`
+	PickCode    string    `gorm:"size:64" json:"pick_code"`
+	ModTime     time.Time `json:"mod_time"`
+	// PreviousPath 本轮因移动/重命名而变化时记录的旧路径，用于清理旧位置的 STRM。
+	PreviousPath string `gorm:"size:1024" json:"previous_path"`
+	// ListedModTime 目录上次实际列举时的修改时间；与 ModTime 相同说明直接子项未变化，可复用快照。
+	ListedModTime time.Time `json:"listed_mod_time"`
+	// ModTimeGeneration ModTime 最近一次由父目录实际列举刷新的轮次；父目录被复用时 ModTime 是旧值，不能据此复用本目录。
+	ModTimeGeneration int64     `gorm:"comment:修改时间最近一次由父目录列举刷新的轮次" json:"mod_time_generation"`
+	ListedGeneration  int64     `gorm:"index;comment:目录最近一次处理(列举或复用)的轮次" json:"listed_generation"`
+	SeenGeneration    int64     `gorm:"index;comment:最近一次在云端看到的轮次" json:"seen_generation"`
+	ChangedGeneration int64     `gorm:"index;comment:最近一次新增或变化的轮次" json:"changed_generation"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func (CloudTreeSnapshotEntry) TableName() string {
+	return "cloud_tree_snapshot_entries"
+}
+
+// CloudTreeSnapshotState 每个 CloudPath 的快照同步进度；Status=running 且进程重启时可从中断处继续。
+type CloudTreeSnapshotState struct {
+	ID          uint       `gorm:"primarykey" json:"id"`
+	CloudPathID uint       `gorm:"not null;uniqueIndex" json:"cloud_path_id"`
+	Generation  int64      `gorm:"comment:当前(或最近完成)的同步轮次" json:"generation"`
+	Status      string     `gorm:"size:16;comment:running/completed/failed" json:"status"`
+	Full        bool       `gorm:"comment:本轮是否强制全量列举" json:"full"`
+	RootID      string     `gorm:"size:255" json:"root_id"`
+	DirsListed  int        `json:"dirs_listed"`
+	DirsReused  int        `json:"dirs_reused"`
+	Files       int        `json:"files"`
+	Changed     int        `json:"changed"`
+	Removed     int        `json:"removed"`
+	LastError   string     `gorm:"type:text" json:"last_error"`
+	StartedAt   *time.Time `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at"`
+	UpdatedAt   time.Time  `json:"updated_at"`
+}
+
+func (CloudTreeSnapshotState) TableName() string {
+	return "cloud_tree_snapshot_states"
+}
@@ -0,0 +1,34 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// DownloadURLCache 持久化的直链缓存，重启后仍可复用未过期的直链，减少 115 接口调用。
+// CacheKey 为存储、pickcode(或盘内路径)与 User-Agent 的摘要。
+type DownloadURLCache struct {
+	CacheKey  string    `gorm:"primaryKey;size:128" json:"cache_key"`
+	URL       string    `gorm:"type:text;not null" json:"url"`
+	ExpiresAt time.Time `gorm:"not null;index" json:"expires_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (DownloadURLCache) TableName() string {
+	return "download_url_caches"
+}
+
+// UpsertDownloadURLCache 写入或覆盖一条直链缓存
+func UpsertDownloadURLCache(db *gorm.DB, key, url string, expiresAt time.Time) error {
+	now := time.Now()
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "cache_key"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"url":        url,
+			"expires_at": expiresAt,
+			"updated_at": now,
+		}),
+	}).Create(&DownloadURLCache{CacheKey: key, URL: url, ExpiresAt: expiresAt, UpdatedAt: now}).Error
+}
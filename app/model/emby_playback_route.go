@@ -0,0 +1,132 @@
+package model
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Emby 播放路由规则的动作
+const (
+	EmbyPlaybackRouteActionRedirect = "redirect" // 302 到云盘直链(默认流程)
+	EmbyPlaybackRouteActionEmby     = "emby"     // 交给 Emby 直接播放(如 NAS 本地副本)
+	EmbyPlaybackRouteActionStream   = "stream"   // 由 Film Fusion 中转直链数据
+	EmbyPlaybackRouteActionDeny     = "deny"     // 拒绝播放
+)
+
+// Emby 播放路由规则的网络条件
+const (
+	EmbyPlaybackRouteNetworkLAN = "lan"
+	EmbyPlaybackRouteNetworkWAN = "wan"
+)
+
+// EmbyPlaybackRoute 播放路由规则：按优先级从小到大匹配，首个全部条件满足的规则决定播放方式。
+// 条件留空表示不限制；列表类条件用逗号或换行分隔，命中其中任意一项即可。
+// Network 与 ClientCIDRs 按 TCP 来源地址判断，只有来源属于 Emby 安全设置中的可信代理
+// (emby.security.trusted_proxy_cidrs，默认为空) 时才采用 X-Forwarded-For，防止客户端伪造转发头。
+type EmbyPlaybackRoute struct {
+	ID          uint      `gorm:"primarykey" json:"id"`
+	Name        string    `gorm:"size:100;not null;comment:规则名称" json:"name"`
+	Enabled     bool      `gorm:"default:true;comment:是否启用" json:"enabled"`
+	Priority    int       `gorm:"default:0;index;comment:优先级，越小越先匹配" json:"priority"`
+	Network     string    `gorm:"size:10;comment:网络条件 lan/wan，空为不限" json:"network"`
+	ClientCIDRs string    `gorm:"size:1000;comment:客户端 IP/CIDR 列表" json:"client_cidrs"`
+	UserAgent   string    `gorm:"size:500;comment:User-Agent 正则" json:"user_agent"`
+	Client      string    `gorm:"size:500;comment:Emby 客户端名称列表(不区分大小写)" json:"client"`
+	DeviceName  string    `gorm:"size:500;comment:设备名称关键字列表" json:"device_name"`
+	EmbyUserIDs string    `gorm:"size:1000;comment:Emby 用户ID列表" json:"emby_user_ids"`
+	Libraries   string    `gorm:"size:1000;comment:媒体库名称或ID列表" json:"libraries"`
+	MinSizeMB   int64     `gorm:"default:0;comment:文件大小下限(MB)" json:"min_size_mb"`
+	MaxSizeMB   int64     `gorm:"default:0;comment:文件大小上限(MB)" json:"max_size_mb"`
+	Action      string    `gorm:"size:20;not null;default:redirect;comment:动作 redirect/emby/stream/deny" json:"action"`
+	Remark      string    `gorm:"size:500;comment:备注" json:"remark"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+func (EmbyPlaybackRoute) TableName() string {
+	return "emby_playback_routes"
+}
+
+// SplitEmbyPlaybackRouteList 拆分逗号 / 换行分隔的列表条件，忽略空项
+func SplitEmbyPlaybackRouteList(raw string) []string {
+	fields := strings.FieldsFunc(raw, func(r rune) bool {
+		return r == ',' || r == '，' || r == '\n' || r == '\r'
+	})
+	out := make([]string, 0, len(fields))
+	for _, field := range fields {
+		if field = strings.TrimSpace(field); field != "" {
+			out = append(out, field)
+		}
+	}
+	return out
+}
+
+// ParseEmbyPlaybackRoutePrefixes 解析 ClientCIDRs，单个 IP 视为 /32 或 /128
+func ParseEmbyPlaybackRoutePrefixes(raw string) ([]netip.Prefix, error) {
+	items := SplitEmbyPlaybackRouteList(raw)
+	prefixes := make([]netip.Prefix, 0, len(items))
+	for _, item := range items {
+		if prefix, err := netip.ParsePrefix(item); err == nil {
+			prefixes = append(prefixes, prefix.Masked())
+			continue
+		}
+		addr, err := netip.ParseAddr(item)
+		if err != nil {
+			return nil, fmt.Errorf("无效的 IP/CIDR: %s", item)
+		}
+		prefixes = append(prefixes, netip.PrefixFrom(addr.Unmap(), addr.Unmap().BitLen()))
+	}
+	return prefixes, nil
+}
+
+// Normalize 去除首尾空白并补全默认动作
+func (r *EmbyPlaybackRoute) Normalize() {
+	r.Name = strings.TrimSpace(r.Name)
+	r.Network = strings.ToLower(strings.TrimSpace(r.Network))
+	r.ClientCIDRs = strings.TrimSpace(r.ClientCIDRs)
+	r.UserAgent = strings.TrimSpace(r.UserAgent)
+	r.Client = strings.TrimSpace(r.Client)
+	r.DeviceName = strings.TrimSpace(r.DeviceName)
+	r.EmbyUserIDs = strings.TrimSpace(r.EmbyUserIDs)
+	r.Libraries = strings.TrimSpace(r.Libraries)
+	r.Remark = strings.TrimSpace(r.Remark)
+	r.Action = strings.ToLower(strings.TrimSpace(r.Action))
+	if r.Action == "" {
+		r.Action = EmbyPlaybackRouteActionRedirect
+	}
+}
+
+// Validate 校验规则的动作、网络条件、CIDR、正则与文件大小范围
+func (r EmbyPlaybackRoute) Validate() error {
+	if r.Name == "" {
+		return fmt.Errorf("规则名称不能为空")
+	}
+	switch r.Action {
+	case EmbyPlaybackRouteActionRedirect, EmbyPlaybackRouteActionEmby, EmbyPlaybackRouteActionStream, EmbyPlaybackRouteActionDeny:
+	default:
+		return fmt.Errorf("不支持的动作: %s", r.Action)
+	}
+	switch r.Network {
+	case "", EmbyPlaybackRouteNetworkLAN, EmbyPlaybackRouteNetworkWAN:
+	default:
+		return fmt.Errorf("网络条件仅支持 lan 或 wan")
+	}
+	if _, err := ParseEmbyPlaybackRoutePrefixes(r.ClientCIDRs); err != nil {
+		return err
+	}
+	if r.UserAgent != "" {
+		if _, err := regexp.Compile(r.UserAgent); err != nil {
+			return fmt.Errorf("User-Agent 正则无效: %v", err)
+		}
+	}
+	if r.MinSizeMB < 0 || r.MaxSizeMB < 0 {
+		return fmt.Errorf("文件大小不能为负数")
+	}
+	if r.MaxSizeMB > 0 && r.MinSizeMB > r.MaxSizeMB {
+		return fmt.Errorf("文件大小下限不能大于上限")
+	}
+	return nil
+}
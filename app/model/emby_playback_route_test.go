@@ -0,0 +1,33 @@
+package model
+
+import "testing"
+
+func TestEmbyPlaybackRouteValidate(t *testing.T) {
+	route := EmbyPlaybackRoute{Name: " 局域网 ", Network: "LAN", ClientCIDRs: "192.168.0.0/16\n10.0.0.1"}
+	route.Normalize()
+	if route.Action != EmbyPlaybackRouteActionRedirect || route.Network != EmbyPlaybackRouteNetworkLAN || route.Name != "局域网" {
+		t.Fatalf("normalized route = %+v", route)
+	}
+	if err := route.Validate(); err != nil {
+		t.Fatalf("valid route: %v", err)
+	}
+
+	invalid := []EmbyPlaybackRoute{
+		{Action: EmbyPlaybackRouteActionDeny},
+		{Name: "a", Action: "proxy"},
+		{Name: "a", Action: EmbyPlaybackRouteActionEmby, Network: "intranet"},
+		{Name: "a", Action: EmbyPlaybackRouteActionEmby, ClientCIDRs: "192.168.1.300"},
+		{Name: "a", Action: EmbyPlaybackRouteActionEmby, UserAgent: "("},
+		{Name: "a", Action: EmbyPlaybackRouteActionEmby, MinSizeMB: 10, MaxSizeMB: 5},
+	}
+	for i, r := range invalid {
+		if err := r.Validate(); err == nil {
+			t.Fatalf("case %d should be invalid: %+v", i, r)
+		}
+	}
+
+	prefixes, err := ParseEmbyPlaybackRoutePrefixes("10.0.0.1，::ffff:192.168.1.1, 2001:db8::/32")
+	if err != nil || len(prefixes) != 3 || prefixes[0].Bits() != 32 || prefixes[1].Bits() != 32 {
+		t.Fatalf("prefixes = %v err=%v", prefixes, err)
+	}
+}
@@ -0,0 +1,43 @@
+package model
+
+import "time"
+
+// EmbyProxyLog 持久化的 Emby 代理 302 / 回退播放记录，字段与内存日志 embyproxylog.Entry 一一对应
+type EmbyProxyLog struct {
+	ID                  uint                  `gorm:"primarykey" json:"id"`
+	Timestamp           time.Time             `gorm:"index;not null" json:"timestamp"`
+	Source              string                `gorm:"size:16;index" json:"source"` // cache / proxyPlay / stream / fallback / limited / denied
+	Method              string                `gorm:"size:16" json:"method"`
+	URI                 string                `gorm:"type:text" json:"uri"`
+	UserAgent           string                `gorm:"size:512" json:"user_agent"`
+	RemoteIP            string                `gorm:"size:64;index" json:"remote_ip"`
+	Target              string                `gorm:"type:text" json:"target"`
+	ItemID              string                `gorm:"size:64;index" json:"item_id,omitempty"`
+	MediaSourceID       string                `gorm:"size:64" json:"media_source_id,omitempty"`
+	MediaPath           string                `gorm:"size:1024" json:"media_path,omitempty"`
+	Match302ID          uint                  `gorm:"index" json:"match302_id,omitempty"`
+	AssignmentID        uint                  `json:"assignment_id,omitempty"`
+	AssignedStorageID   uint                  `json:"assigned_storage_id,omitempty"`
+	AssignedStorageName string                `gorm:"size:255" json:"assigned_storage_name,omitempty"`
+	ActualStorageID     uint                  `gorm:"index" json:"actual_storage_id,omitempty"`
+	ActualStorageName   string                `gorm:"size:255" json:"actual_storage_name,omitempty"`
+	AccountType         string                `gorm:"size:32" json:"account_type,omitempty"`
+	BalanceStatus       string                `gorm:"size:64;index" json:"balance_status,omitempty"`
+	FallbackReason      string                `gorm:"size:1024" json:"fallback_reason,omitempty"`
+	EmbyUserID          string                `gorm:"size:64;index" json:"emby_user_id,omitempty"`
+	EmbyUserName        string                `gorm:"size:255" json:"emby_user_name,omitempty"`
+	Attempts            []EmbyProxyLogAttempt `gorm:"serializer:json;type:text" json:"attempts,omitempty"`
+}
+
+// EmbyProxyLogAttempt 获取直链的单次尝试，对应 embyproxylog.Attempt
+type EmbyProxyLogAttempt struct {
+	StorageID   uint   `json:"storage_id"`
+	StorageName string `json:"storage_name,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Role        string `json:"role"`
+	Error       string `json:"error,omitempty"`
+}
+
+func (EmbyProxyLog) TableName() string {
+	return "emby_proxy_logs"
+}
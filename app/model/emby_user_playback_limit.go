@@ -0,0 +1,133 @@
+package model
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// EmbyUserPlaybackLimit 单个 Emby 用户在代理上的播放限制，0 / 空表示该项不限制。
+type EmbyUserPlaybackLimit struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	EmbyUserID     string    `gorm:"size:120;not null;uniqueIndex:uk_emby_user_playback_limit_user;comment:Emby用户ID" json:"emby_user_id"`
+	EmbyUserName   string    `gorm:"size:200;comment:Emby用户名(展示用)" json:"emby_user_name"`
+	Enabled        bool      `gorm:"default:true;comment:是否启用" json:"enabled"`
+	MaxConcurrent  int       `gorm:"default:0;comment:最大同时播放数" json:"max_concurrent"`
+	DailyLimit     int       `gorm:"default:0;comment:每日播放次数上限" json:"daily_limit"`
+	AllowedWindows string    `gorm:"size:500;comment:允许播放时段，如 08:00-23:00,23:30-01:00" json:"allowed_windows"`
+	Remark         string    `gorm:"size:500;comment:备注" json:"remark"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+
+	TodayCount int `gorm:"-" json:"today_count"`
+}
+
+func (EmbyUserPlaybackLimit) TableName() string {
+	return "emby_user_playback_limits"
+}
+
+// EmbyUserPlaybackUsage 按自然日统计的 Emby 用户播放次数
+type EmbyUserPlaybackUsage struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	EmbyUserID string    `gorm:"size:120;not null;uniqueIndex:uk_emby_user_playback_usage_day,priority:1" json:"emby_user_id"`
+	Day        string    `gorm:"size:10;not null;uniqueIndex:uk_emby_user_playback_usage_day,priority:2;comment:YYYY-MM-DD" json:"day"`
+	Count      int       `gorm:"not null;default:0" json:"count"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
+
+func (EmbyUserPlaybackUsage) TableName() string {
+	return "emby_user_playback_usages"
+}
+
+// EmbyUserPlaybackDay 返回统计用的日期键(服务器本地时区)
+func EmbyUserPlaybackDay(t time.Time) string {
+	return t.Format("2006-01-02")
+}
+
+// GetEmbyUserPlaybackCount 返回用户在指定日期的播放次数
+func GetEmbyUserPlaybackCount(db *gorm.DB, embyUserID, day string) (int, error) {
+	var row EmbyUserPlaybackUsage
+	err := db.Where("emby_user_id = ? AND day = ?", embyUserID, day).Limit(1).Find(&row).Error
+	return row.Count, err
+}
+
+// IncrEmbyUserPlaybackCount 将用户在指定日期的播放次数 +1
+func IncrEmbyUserPlaybackCount(db *gorm.DB, embyUserID, day string) error {
+	now := time.Now()
+	row := EmbyUserPlaybackUsage{EmbyUserID: embyUserID, Day: day, Count: 1, UpdatedAt: now}
+	return db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "emby_user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"count":      gorm.Expr("count + 1"),
+			"updated_at": now,
+		}),
+	}).Create(&row).Error
+}
+
+// PlaybackTimeWindow 一天内允许播放的时段，以分钟表示；End <= Start 表示跨越午夜
+type PlaybackTimeWindow struct {
+	Start int
+	End   int
+}
+
+// Contains 判断 t 的时分是否落在时段内(含起点、不含终点)
+func (w PlaybackTimeWindow) Contains(t time.Time) bool {
+	minute := t.Hour()*60 + t.Minute()
+	if w.End > w.Start {
+		return minute >= w.Start && minute < w.End
+	}
+	return minute >= w.Start || minute < w.End
+}
+
+func (w PlaybackTimeWindow) String() string {
+	return fmt.Sprintf("%02d:%02d-%02d:%02d", w.Start/60, w.Start%60, w.End/60, w.End%60)
+}
+
+// ParsePlaybackTimeWindows 解析逗号分隔的 HH:MM-HH:MM 时段列表，空字符串表示不限制
+func ParsePlaybackTimeWindows(raw string) ([]PlaybackTimeWindow, error) {
+	var windows []PlaybackTimeWindow
+	for _, part := range strings.FieldsFunc(raw, func(r rune) bool { return r == ',' || r == '，' || r == ';' }) {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		start, end, ok := strings.Cut(part, "-")
+		if !ok {
+			return nil, fmt.Errorf("时段格式错误: %s，应为 HH:MM-HH:MM", part)
+		}
+		startMin, err := parseClockMinute(start)
+		if err != nil {
+			return nil, fmt.Errorf("时段格式错误: %s: %w", part, err)
+		}
+		endMin, err := parseClockMinute(end)
+		if err != nil {
+			return nil, fmt.Errorf("时段格式错误: %s: %w", part, err)
+		}
+		startMin %= 24 * 60 // 24:00 作为起点等同 00:00，作为终点表示当天结束
+		if startMin == endMin {
+			return nil, fmt.Errorf("时段起止时间不能相同: %s", part)
+		}
+		windows = append(windows, PlaybackTimeWindow{Start: startMin, End: endMin})
+	}
+	return windows, nil
+}
+
+func parseClockMinute(value string) (int, error) {
+	hour, minute, ok := strings.Cut(strings.TrimSpace(value), ":")
+	if !ok {
+		return 0, fmt.Errorf("无效时间 %q", value)
+	}
+	h, err := strconv.Atoi(strings.TrimSpace(hour))
+	if err != nil || h < 0 || h > 24 {
+		return 0, fmt.Errorf("无效时间 %q", value)
+	}
+	m, err := strconv.Atoi(strings.TrimSpace(minute))
+	if err != nil || m < 0 || m > 59 || (h == 24 && m != 0) {
+		return 0, fmt.Errorf("无效时间 %q", value)
+	}
+	return h*60 + m, nil
+}
@@ -0,0 +1,48 @@
+package model
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParsePlaybackTimeWindows(t *testing.T) {
+	windows, err := ParsePlaybackTimeWindows("08:00-12:30, 22:00-02:00，19:00-24:00")
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if len(windows) != 3 {
+		t.Fatalf("windows = %v", windows)
+	}
+
+	at := func(clock string) time.Time {
+		v, _ := time.Parse("15:04", clock)
+		return v
+	}
+	cases := []struct {
+		window PlaybackTimeWindow
+		clock  string
+		want   bool
+	}{
+		{windows[0], "08:00", true},
+		{windows[0], "12:30", false},
+		{windows[1], "23:59", true},
+		{windows[1], "01:59", true},
+		{windows[1], "02:00", false},
+		{windows[1], "12:00", false},
+		{windows[2], "23:59", true},
+	}
+	for _, tc := range cases {
+		if got := tc.window.Contains(at(tc.clock)); got != tc.want {
+			t.Fatalf("%s contains %s = %v, want %v", tc.window, tc.clock, got, tc.want)
+		}
+	}
+
+	for _, raw := range []string{"8-12", "08:00-08:00", "25:00-26:00", "08:00"} {
+		if _, err := ParsePlaybackTimeWindows(raw); err == nil {
+			t.Fatalf("%q should be rejected", raw)
+		}
+	}
+	if windows, err := ParsePlaybackTimeWindows(" "); err != nil || len(windows) != 0 {
+		t.Fatalf("empty input = %v, %v", windows, err)
+	}
+}
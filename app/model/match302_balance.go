@@ -17,27 +17,41 @@ const (
 	BalanceCleanupStatusCleaning = "cleaning"
 	BalanceCleanupStatusCleaned  = "cleaned"
 	BalanceCleanupStatusFailed   = "failed"
+
+	BalanceMemberHealthUnknown = "unknown"
+	BalanceMemberHealthHealthy = "healthy"
+	BalanceMemberHealthDown    = "down"
 )
 
 type Match302BalanceMember struct {
-	ID             uint          `gorm:"primarykey" json:"id"`
-	Match302ID     uint          `gorm:"not null;uniqueIndex:uk_match302_balance_member,priority:1;index" json:"match302_id"`
-	CloudStorageID uint          `gorm:"not null;uniqueIndex:uk_match302_balance_member,priority:2;index" json:"cloud_storage_id"`
-	Enabled        bool          `gorm:"default:true;comment:是否启用" json:"enabled"`
-	Weight         int           `gorm:"default:1;comment:权重" json:"weight"`
-	TargetRootPath string        `gorm:"size:500;comment:子账号缓存根目录" json:"target_root_path"`
-	LastError      string        `gorm:"type:text;comment:最近错误" json:"last_error"`
-	LastErrorAt    *time.Time    `gorm:"comment:最近错误时间" json:"last_error_at"`
-	CooldownUntil  *time.Time    `gorm:"comment:冷却截止时间" json:"cooldown_until"`
-	CreatedAt      time.Time     `json:"created_at"`
-	UpdatedAt      time.Time     `json:"updated_at"`
-	CloudStorage   *CloudStorage `gorm:"foreignKey:CloudStorageID" json:"cloud_storage,omitempty"`
+	ID              uint          `gorm:"primarykey" json:"id"`
+	Match302ID      uint          `gorm:"not null;uniqueIndex:uk_match302_balance_member,priority:1;index" json:"match302_id"`
+	CloudStorageID  uint          `gorm:"not null;uniqueIndex:uk_match302_balance_member,priority:2;index" json:"cloud_storage_id"`
+	Enabled         bool          `gorm:"default:true;comment:是否启用" json:"enabled"`
+	Weight          int           `gorm:"default:1;comment:权重" json:"weight"`
+	TargetRootPath  string        `gorm:"size:500;comment:子账号缓存根目录" json:"target_root_path"`
+	LastError       string        `gorm:"type:text;comment:最近错误" json:"last_error"`
+	LastErrorAt     *time.Time    `gorm:"comment:最近错误时间" json:"last_error_at"`
+	CooldownUntil   *time.Time    `gorm:"comment:冷却截止时间" json:"cooldown_until"`
+	ProbePickcode   string        `gorm:"size:120;comment:健康检查用的测试pickcode" json:"probe_pickcode"`
+	HealthStatus    string        `gorm:"size:20;default:unknown;index;comment:健康状态(unknown/healthy/down)" json:"health_status"`
+	HealthFailures  int           `gorm:"default:0;comment:连续健康检查失败次数" json:"health_failures"`
+	HealthCheckedAt *time.Time    `gorm:"comment:最近健康检查时间" json:"health_checked_at"`
+	QuarantinedAt   *time.Time    `gorm:"comment:被自动隔离的时间" json:"quarantined_at"`
+	CreatedAt       time.Time     `json:"created_at"`
+	UpdatedAt       time.Time     `json:"updated_at"`
+	CloudStorage    *CloudStorage `gorm:"foreignKey:CloudStorageID" json:"cloud_storage,omitempty"`
 }
 
 func (Match302BalanceMember) TableName() string {
 	return "match302_balance_members"
 }
 
+// Quarantined 成员是否因健康检查失败被自动隔离，隔离期间不参与负载均衡
+func (m Match302BalanceMember) Quarantined() bool {
+	return m.HealthStatus == BalanceMemberHealthDown
+}
+
 func (m *Match302BalanceMember) NormalizeDefaults(matchID uint) {
 	if m.Weight <= 0 {
 		m.Weight = 1
@@ -90,6 +104,24 @@ func (a *Match302BalanceAssignment) IsTransferLocked() bool {
 	return a.Status == BalanceAssignmentStatusPending || a.Status == BalanceAssignmentStatusTransferring
 }
 
+// Match302BalanceHealthCheck 子账号的一次健康检查结果，按账号(CloudStorage)记录，构成成员的健康时间线
+type Match302BalanceHealthCheck struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	CloudStorageID uint      `gorm:"not null;index:idx_match302_health_storage_time,priority:1" json:"cloud_storage_id"`
+	Healthy        bool      `gorm:"default:false" json:"healthy"`
+	CookieOK       bool      `gorm:"default:false;comment:Cookie是否有效" json:"cookie_ok"`
+	FreeBytes      int64     `gorm:"default:-1;comment:剩余空间字节数，-1表示未知" json:"free_bytes"`
+	LinkChecked    bool      `gorm:"default:false;comment:是否检查了测试pickcode直链" json:"link_checked"`
+	LinkOK         bool      `gorm:"default:false" json:"link_ok"`
+	LatencyMs      int64     `gorm:"default:0" json:"latency_ms"`
+	Error          string    `gorm:"type:text" json:"error"`
+	CheckedAt      time.Time `gorm:"not null;index:idx_match302_health_storage_time,priority:2" json:"checked_at"`
+}
+
+func (Match302BalanceHealthCheck) TableName() string {
+	return "match302_balance_health_checks"
+}
+
 func DefaultMatch302BalanceTargetRoot(matchID uint) string {
 	return "/FilmFusion-302/" + strconv.FormatUint(uint64(matchID), 10)
 }
@@ -0,0 +1,33 @@
+package model
+
+import (
+	"strings"
+	"time"
+)
+
+// Match302Fallback 主存储获取直链失败时按 SortOrder 依次尝试的备用存储，
+// 用于同一媒体库在其他 115 账号或 OpenList / WebDAV 上的镜像。
+type Match302Fallback struct {
+	ID             uint          `gorm:"primarykey" json:"id"`
+	Match302ID     uint          `gorm:"not null;index" json:"match302_id"`
+	CloudStorageID uint          `gorm:"not null;index" json:"cloud_storage_id"`
+	SortOrder      int           `gorm:"default:0;comment:尝试顺序，越小越先" json:"sort_order"`
+	Enabled        bool          `gorm:"default:true;comment:是否启用" json:"enabled"`
+	TargetPath     string        `gorm:"size:500;comment:备用存储上的目标路径，为空沿用主规则" json:"target_path"`
+	CreatedAt      time.Time     `json:"created_at"`
+	UpdatedAt      time.Time     `json:"updated_at"`
+	CloudStorage   *CloudStorage `gorm:"foreignKey:CloudStorageID" json:"cloud_storage,omitempty"`
+}
+
+func (Match302Fallback) TableName() string {
+	return "match302_fallbacks"
+}
+
+// MatchedPath 将 Emby 播放路径映射为备用存储上的路径：按主规则的 SourcePath 匹配，替换为备用的 TargetPath
+func (f Match302Fallback) MatchedPath(match *Match302, filePath string) string {
+	mirror := *match
+	if strings.TrimSpace(f.TargetPath) != "" {
+		mirror.TargetPath = f.TargetPath
+	}
+	return mirror.GetMatchedPath(filePath)
+}
@@ -0,0 +1,21 @@
+package model
+
+import "testing"
+
+func TestMatch302FallbackMatchedPath(t *testing.T) {
+	match := &Match302{SourcePath: "/media/source", TargetPath: "/library"}
+
+	mirror := Match302Fallback{TargetPath: "/backup/library"}
+	if got, want := mirror.MatchedPath(match, "/media/source/Movie/test.mkv"), "/backup/library/Movie/test.mkv"; got != want {
+		t.Fatalf("MatchedPath() = %q, want %q", got, want)
+	}
+
+	// 未设置目标路径时沿用主规则，且不修改主规则本身
+	same := Match302Fallback{}
+	if got, want := same.MatchedPath(match, "/media/source/Movie/test.mkv"), "/library/Movie/test.mkv"; got != want {
+		t.Fatalf("MatchedPath() = %q, want %q", got, want)
+	}
+	if match.TargetPath != "/library" {
+		t.Fatalf("primary match target path changed to %q", match.TargetPath)
+	}
+}
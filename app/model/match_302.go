@@ -21,12 +21,14 @@ type Match302 struct {
 	CleanupMode        string    `gorm:"size:40;default:recycle;comment:清理模式" json:"cleanup_mode"`
 	CleanupIntervalMin int       `gorm:"default:30;comment:清理扫描间隔分钟" json:"cleanup_interval_min"`
 	MinKeepReady       int       `gorm:"default:0;comment:至少保留ready资源数" json:"min_keep_ready"`
+	PrefetchEpisodes   int       `gorm:"default:0;comment:播放剧集时预先秒传后续集数" json:"prefetch_episodes"`
 	CreatedAt          time.Time `json:"created_at"`
 	UpdatedAt          time.Time `json:"updated_at"`
 
 	// 关联关系
 	CloudStorage *CloudStorage               `gorm:"foreignKey:CloudStorageID" json:"cloud_storage,omitempty"`
 	PoolMembers  []Match302BalanceMember     `gorm:"foreignKey:Match302ID" json:"pool_members,omitempty"`
+	Fallbacks    []Match302Fallback          `gorm:"foreignKey:Match302ID" json:"fallbacks,omitempty"`
 	Assignments  []Match302BalanceAssignment `gorm:"foreignKey:Match302ID" json:"assignments,omitempty"`
 }
 
@@ -35,15 +37,34 @@ func (Match302) TableName() string {
 }
 
 const (
-	Match302BalanceStrategyStickyLeastActive = "sticky_least_active"
-	Match302BalanceLimitModeLoose            = "loose"
-	Match302BalanceLimitModeStrict           = "strict"
-	Match302CleanupModeRecycle               = "recycle"
-	Match302CleanupModeHardDelete            = "hard_delete"
+	Match302BalanceStrategyStickyLeastActive  = "sticky_least_active"
+	Match302BalanceStrategyWeightedRoundRobin = "weighted_round_robin"
+	Match302BalanceStrategyFreeQuota          = "free_quota"
+	Match302BalanceStrategyLatencyAware       = "latency_aware"
+	Match302BalanceStrategySourceFirst        = "source_first"
+	Match302BalanceLimitModeLoose             = "loose"
+	Match302BalanceLimitModeStrict            = "strict"
+	Match302CleanupModeRecycle                = "recycle"
+	Match302CleanupModeHardDelete             = "hard_delete"
+	Match302MaxPrefetchEpisodes               = 10
 )
 
+// IsValidMatch302BalanceStrategy 判断负载均衡策略是否受支持
+func IsValidMatch302BalanceStrategy(strategy string) bool {
+	switch strategy {
+	case Match302BalanceStrategyStickyLeastActive,
+		Match302BalanceStrategyWeightedRoundRobin,
+		Match302BalanceStrategyFreeQuota,
+		Match302BalanceStrategyLatencyAware,
+		Match302BalanceStrategySourceFirst:
+		return true
+	}
+	return false
+}
+
 func (m *Match302) NormalizeBalanceDefaults() {
-	if strings.TrimSpace(m.BalanceStrategy) == "" {
+	m.BalanceStrategy = strings.TrimSpace(m.BalanceStrategy)
+	if !IsValidMatch302BalanceStrategy(m.BalanceStrategy) {
 		m.BalanceStrategy = Match302BalanceStrategyStickyLeastActive
 	}
 	if strings.TrimSpace(m.BalanceLimitMode) == "" {
@@ -70,6 +91,12 @@ func (m *Match302) NormalizeBalanceDefaults() {
 	if m.MinKeepReady < 0 {
 		m.MinKeepReady = 0
 	}
+	if m.PrefetchEpisodes < 0 {
+		m.PrefetchEpisodes = 0
+	}
+	if m.PrefetchEpisodes > Match302MaxPrefetchEpisodes {
+		m.PrefetchEpisodes = Match302MaxPrefetchEpisodes
+	}
 }
 
 // GetMatchedPath 根据源路径规则转换目标路径
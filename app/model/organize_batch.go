@@ -0,0 +1,60 @@
+package model
+
+import "time"
+
+// 整理批次状态
+const (
+	OrganizeBatchStatusPending      = "pending"       // 已记录，网盘操作尚未完成
+	OrganizeBatchStatusApplied      = "applied"       // 整理完成
+	OrganizeBatchStatusFailed       = "failed"        // 整理中途失败，可能已部分重命名/移动
+	OrganizeBatchStatusReverted     = "reverted"      // 已撤销
+	OrganizeBatchStatusRevertFailed = "revert_failed" // 撤销未全部成功，可重试
+)
+
+// OrganizeBatch 一次整理执行（单个源文件夹）的可撤销记录。
+// 在重命名/移动网盘文件之前写入，保证中途失败也能回滚已生效的部分。
+type OrganizeBatch struct {
+	ID               uint       `gorm:"primarykey" json:"id"`
+	UserID           uint       `gorm:"not null;index;comment:所属用户ID" json:"user_id"`
+	CloudStorageID   uint       `gorm:"not null;index;comment:关联 cloud_storages" json:"cloud_storage_id"`
+	CloudDirectoryID uint       `gorm:"index;comment:关联 cloud_directories" json:"cloud_directory_id"`
+	SourceFolderID   string     `gorm:"size:64;index;comment:整理的 115 源目录ID" json:"source_folder_id"`
+	SavePath         string     `gorm:"size:1024;comment:本地 STRM 保存路径" json:"save_path"`
+	ContentPrefix    string     `gorm:"size:1024;comment:STRM 内容前缀" json:"content_prefix"`
+	Status           string     `gorm:"size:16;index;not null;default:pending" json:"status"`
+	ItemCount        int        `gorm:"not null;default:0" json:"item_count"`
+	Error            string     `gorm:"type:text" json:"error"`
+	RevertedAt       *time.Time `json:"reverted_at,omitempty"`
+	CreatedAt        time.Time  `gorm:"index" json:"created_at"`
+	UpdatedAt        time.Time  `json:"updated_at"`
+
+	Items        []OrganizeBatchItem `gorm:"foreignKey:BatchID" json:"items,omitempty"`
+	CloudStorage *CloudStorage       `gorm:"foreignKey:CloudStorageID" json:"cloud_storage,omitempty"`
+}
+
+func (OrganizeBatch) TableName() string {
+	return "organize_batches"
+}
+
+// OrganizeBatchItem 批次中的单个网盘文件及其生成的本地文件
+type OrganizeBatchItem struct {
+	ID               uint   `gorm:"primarykey" json:"id"`
+	BatchID          uint   `gorm:"not null;index" json:"batch_id"`
+	FileID           string `gorm:"size:64;not null" json:"file_id"`
+	PickCode         string `gorm:"size:64" json:"pick_code"`
+	IsSubtitle       bool   `json:"is_subtitle"`
+	OriginalName     string `gorm:"size:512;not null" json:"original_name"`
+	OriginalParentID string `gorm:"size:64;not null" json:"original_parent_id"`
+	NewName          string `gorm:"size:512" json:"new_name"`
+	NewParentID      string `gorm:"size:64" json:"new_parent_id"`
+	NewPath          string `gorm:"size:1024" json:"new_path"`
+	// LocalPath 生成的 STRM 或下载的字幕；LocalExisted 表示整理前已存在，撤销时恢复原内容而不是删除
+	LocalPath            string `gorm:"size:1024" json:"local_path"`
+	LocalExisted         bool   `json:"local_existed"`
+	LocalPreviousContent string `gorm:"type:text" json:"-"`
+	RevertError          string `gorm:"type:text" json:"revert_error,omitempty"`
+}
+
+func (OrganizeBatchItem) TableName() string {
+	return "organize_batch_items"
+}
@@ -7,6 +7,7 @@ const (
 	OrganizeActionStrmCreate   = "strm_create"      // 创建 STRM 文件
 	OrganizeActionStrmDelete   = "strm_delete"      // 删除 STRM 文件 / 目录
 	OrganizeActionStrmRename   = "strm_rename"      // 重命名 STRM 文件
+	OrganizeActionStrmRewrite  = "strm_rewrite"     // 对账时重写内容不一致的 STRM 文件
 	OrganizeActionFileDownload = "file_download"    // 通过 115 Open 下载非视频文件（如字幕）
 	OrganizeActionWalkDir      = "walk_dir"         // 目录递归遍历入口
 	OrganizeActionWebhookRecv  = "webhook_received" // 接收到外部 webhook
@@ -21,11 +22,13 @@ const (
 
 // 触发来源
 const (
-	OrganizeTriggerCD2     = "cd2_notify"
-	OrganizeTriggerMP2     = "mp2_notify"
-	OrganizeTriggerManual  = "manual"
-	OrganizeTriggerSystem  = "system"
-	OrganizeTriggerWebhook = "webhook"
+	OrganizeTriggerCD2       = "cd2_notify"
+	OrganizeTriggerMP2       = "mp2_notify"
+	OrganizeTriggerManual    = "manual"
+	OrganizeTriggerSystem    = "system"
+	OrganizeTriggerWebhook   = "webhook"
+	OrganizeTriggerReconcile = "reconcile"
+	OrganizeTriggerArr       = "arr_notify" // Sonarr/Radarr/qBittorrent
 )
 
 // OrganizeLog 整理日志（生成 STRM / 下载字幕等业务事件）
@@ -3,7 +3,21 @@ package model
 import "time"
 
 const (
-	RSSAutomationTargetQBittorrent = "qbittorrent"
+	RSSAutomationTargetQBittorrent  = "qbittorrent"
+	RSSAutomationTargetTransmission = "transmission"
+	RSSAutomationTargetDeluge       = "deluge"
+	RSSAutomationTargetAria2        = "aria2"
+
+	// Source types. RSS sources are walked with slash selectors, JSON sources
+	// with JSONPath-style selectors and HTML sources with CSS selectors.
+	RSSAutomationSourceRSS  = "rss"
+	RSSAutomationSourceJSON = "json"
+	RSSAutomationSourceHTML = "html"
+
+	// Entry trigger types. Feed entries leave TriggerType empty; cron and API
+	// triggered runs get a synthetic entry so they reuse the run tables.
+	RSSAutomationTriggerCron = "cron"
+	RSSAutomationTriggerAPI  = "api"
 
 	RSSAutomationRunPending   = "pending"
 	RSSAutomationRunRunning   = "running"
@@ -20,11 +34,12 @@ const (
 	RSSAutomationNodeCancelled = "cancelled"
 )
 
-// RSSAutomationSource is an RSS/Atom source owned by the workflow-based
-// automation module.
+// RSSAutomationSource is an RSS/Atom, JSON API or HTML listing source owned
+// by the workflow-based automation module.
 type RSSAutomationSource struct {
 	ID              uint       `gorm:"primarykey" json:"id"`
 	Name            string     `gorm:"size:120;not null" json:"name"`
+	Type            string     `gorm:"size:20;not null;default:'rss'" json:"type"`
 	Enabled         bool       `gorm:"not null;default:false;index" json:"enabled"`
 	FeedURL         string     `gorm:"type:text;not null" json:"feed_url"`
 	IntervalMinutes int        `gorm:"not null;default:5" json:"interval_minutes"`
@@ -43,22 +58,40 @@ func (RSSAutomationSource) TableName() string { return "rss_automation_sources"
 
 // RSSAutomationWorkflow stores the only editable workflow owned by an RSS
 // automation source. SourceID is both required and unique: workflows cannot be
-// global, shared, or rebound between sources.
+// global, shared, or rebound between sources. LastScheduledAt is the cron time
+// up to which scheduled triggers have been handled.
 type RSSAutomationWorkflow struct {
-	ID             uint                `gorm:"primarykey" json:"id"`
-	SourceID       uint                `gorm:"not null;uniqueIndex:uk_rss_automation_workflow_source;check:chk_rss_automation_workflow_source,source_id > 0" json:"source_id"`
-	Source         RSSAutomationSource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
-	Name           string              `gorm:"size:120;not null" json:"name"`
-	Description    string              `gorm:"type:text" json:"description,omitempty"`
-	Enabled        bool                `gorm:"not null;default:false;index" json:"enabled"`
-	Version        int                 `gorm:"not null;default:1" json:"version"`
-	DefinitionJSON string              `gorm:"type:text;not null" json:"definition_json"`
-	CreatedAt      time.Time           `json:"created_at"`
-	UpdatedAt      time.Time           `json:"updated_at"`
+	ID              uint                `gorm:"primarykey" json:"id"`
+	SourceID        uint                `gorm:"not null;uniqueIndex:uk_rss_automation_workflow_source;check:chk_rss_automation_workflow_source,source_id > 0" json:"source_id"`
+	Source          RSSAutomationSource `gorm:"constraint:OnUpdate:CASCADE,OnDelete:CASCADE;" json:"-"`
+	Name            string              `gorm:"size:120;not null" json:"name"`
+	Description     string              `gorm:"type:text" json:"description,omitempty"`
+	Enabled         bool                `gorm:"not null;default:false;index" json:"enabled"`
+	Version         int                 `gorm:"not null;default:1" json:"version"`
+	DefinitionJSON  string              `gorm:"type:text;not null" json:"definition_json"`
+	LastScheduledAt *time.Time          `json:"last_scheduled_at,omitempty"`
+	CreatedAt       time.Time           `json:"created_at"`
+	UpdatedAt       time.Time           `json:"updated_at"`
 }
 
 func (RSSAutomationWorkflow) TableName() string { return "rss_automation_workflows" }
 
+// RSSAutomationSubWorkflow is a named workflow fragment that any source
+// workflow can invoke through a call_workflow node. Its trigger declares the
+// inputs and its end nodes map the outputs. Runs expand the current version
+// into their own DefinitionJSON snapshot, so later edits only affect new runs.
+type RSSAutomationSubWorkflow struct {
+	ID             uint      `gorm:"primarykey" json:"id"`
+	Name           string    `gorm:"size:120;not null;uniqueIndex:uk_rss_automation_sub_workflow_name" json:"name"`
+	Description    string    `gorm:"type:text" json:"description,omitempty"`
+	Version        int       `gorm:"not null;default:1" json:"version"`
+	DefinitionJSON string    `gorm:"type:text;not null" json:"definition_json"`
+	CreatedAt      time.Time `json:"created_at"`
+	UpdatedAt      time.Time `json:"updated_at"`
+}
+
+func (RSSAutomationSubWorkflow) TableName() string { return "rss_automation_sub_workflows" }
+
 // RSSAutomationTarget contains connection information for an external action
 // target. 115 actions reuse CloudStorage and therefore do not duplicate secrets
 // in this table.
@@ -88,6 +121,7 @@ type RSSAutomationEntry struct {
 	ContentKey         string     `gorm:"size:128;index" json:"content_key,omitempty"`
 	PublishedAt        *time.Time `gorm:"index" json:"published_at,omitempty"`
 	FieldsJSON         string     `gorm:"type:text;not null" json:"fields_json"`
+	TriggerType        string     `gorm:"size:20;not null;default:'';index" json:"trigger_type,omitempty"`
 	Baseline           bool       `gorm:"not null;default:false;index" json:"baseline"`
 	LegacyMatched      bool       `gorm:"not null;default:false;index" json:"-"`
 	LegacyMetadataJSON string     `gorm:"type:text" json:"-"`
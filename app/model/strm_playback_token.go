@@ -0,0 +1,70 @@
+package model
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// STRM 播放令牌吊销范围
+const (
+	StrmPlaybackScopeUser    = "user"
+	StrmPlaybackScopeStorage = "storage"
+)
+
+// ConfigKeyStrmPlaybackSecret STRM 播放令牌的签名密钥，首次使用时随机生成并保存在 system_configs。
+const ConfigKeyStrmPlaybackSecret = "security.strm_playback_secret"
+
+// StrmPlaybackTokenVersion 记录用户/云存储当前的播放令牌版本。
+// 令牌签发时写入两者的版本号，吊销即版本号 +1，此前签发的令牌全部失效。
+type StrmPlaybackTokenVersion struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Scope     string    `gorm:"size:16;not null;uniqueIndex:uk_strm_playback_token_scope,priority:1;comment:user/storage" json:"scope"`
+	ScopeID   uint      `gorm:"not null;uniqueIndex:uk_strm_playback_token_scope,priority:2" json:"scope_id"`
+	Version   int       `gorm:"not null;default:0" json:"version"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func (StrmPlaybackTokenVersion) TableName() string {
+	return "strm_playback_token_versions"
+}
+
+// GetStrmPlaybackTokenVersion 返回指定范围的令牌版本，没有记录时为 0。
+func GetStrmPlaybackTokenVersion(db *gorm.DB, scope string, scopeID uint) (int, error) {
+	var row StrmPlaybackTokenVersion
+	err := db.Where("scope = ? AND scope_id = ?", scope, scopeID).Limit(1).Find(&row).Error
+	return row.Version, err
+}
+
+// GetStrmPlaybackTokenVersions 一次查询返回用户与云存储的令牌版本，没有记录时为 0。
+func GetStrmPlaybackTokenVersions(db *gorm.DB, userID, storageID uint) (userVersion, storageVersion int, err error) {
+	var rows []StrmPlaybackTokenVersion
+	err = db.Where("(scope = ? AND scope_id = ?) OR (scope = ? AND scope_id = ?)",
+		StrmPlaybackScopeUser, userID, StrmPlaybackScopeStorage, storageID).Find(&rows).Error
+	for _, row := range rows {
+		switch row.Scope {
+		case StrmPlaybackScopeUser:
+			userVersion = row.Version
+		case StrmPlaybackScopeStorage:
+			storageVersion = row.Version
+		}
+	}
+	return userVersion, storageVersion, err
+}
+
+// BumpStrmPlaybackTokenVersion 将指定范围的令牌版本 +1 并返回新版本。
+func BumpStrmPlaybackTokenVersion(db *gorm.DB, scope string, scopeID uint) (int, error) {
+	now := time.Now()
+	row := StrmPlaybackTokenVersion{Scope: scope, ScopeID: scopeID, Version: 1, UpdatedAt: now}
+	if err := db.Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "scope"}, {Name: "scope_id"}},
+		DoUpdates: clause.Assignments(map[string]interface{}{
+			"version":    gorm.Expr("version + 1"),
+			"updated_at": now,
+		}),
+	}).Create(&row).Error; err != nil {
+		return 0, err
+	}
+	return GetStrmPlaybackTokenVersion(db, scope, scopeID)
+}
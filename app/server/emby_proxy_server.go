@@ -23,7 +23,7 @@ type EmbyProxyServer struct {
 }
 
 // NewEmbyProxyServer 创建新的Emby代理服务器
-func NewEmbyProxyServer(cfg *config.Config, log *logger.Logger, loginProtection *service.EmbyLoginProtection) *EmbyProxyServer {
+func NewEmbyProxyServer(cfg *config.Config, log *logger.Logger, loginProtection *service.EmbyLoginProtection, proxyLogSvc *service.EmbyProxyLogService, streamProxy *service.EmbyStreamProxy) *EmbyProxyServer {
 	// 设置gin模式
 	gin.SetMode(gin.ReleaseMode)
 
@@ -46,7 +46,7 @@ func NewEmbyProxyServer(cfg *config.Config, log *logger.Logger, loginProtection
 	})
 
 	// 创建Emby代理处理器
-	embyHandler := handler.NewEmbyProxyHandler(cfg, log, loginProtection)
+	embyHandler := handler.NewEmbyProxyHandler(cfg, log, loginProtection, proxyLogSvc, streamProxy)
 	if embyHandler == nil {
 		log.Errorf("创建Emby代理处理器失败")
 		return nil
@@ -73,6 +73,11 @@ func NewEmbyProxyServer(cfg *config.Config, log *logger.Logger, loginProtection
 
 // setupRoutes 设置Emby代理路由
 func (s *EmbyProxyServer) setupRoutes() {
+	// 签名 STRM 播放地址，由 Film Fusion 校验令牌后 302 到直链
+	playback := s.gin.Group(service.StrmPlaybackRoutePrefix)
+	playback.GET("/:token/*name", s.handler.ServeStrmPlayback)
+	playback.HEAD("/:token/*name", s.handler.ServeStrmPlayback)
+
 	// 代理所有其他请求到Emby服务器（通配符路由必须放在最后）
 	s.gin.NoRoute(s.handler.ProxyRequest)
 }
@@ -6,6 +6,7 @@ import (
 	"film-fusion/app/database"
 	"film-fusion/app/handler"
 	"film-fusion/app/logger"
+	"film-fusion/app/metrics"
 	"film-fusion/app/middleware"
 	"film-fusion/app/service"
 	"film-fusion/app/utils/embyhelper"
@@ -34,11 +35,18 @@ type Server struct {
 	embyMissingService      *service.EmbyMissingService
 	versionCheckHandler     *handler.EmbyVersionCheckHandler
 	balanceCleanupSvc       *service.BalanceCleanupService
+	balancePrefetchSvc      *service.BalancePrefetchService
+	balanceHealthSvc        *service.BalanceHealthService
 	embyClient              *embyhelper.EmbyClient
 	organizeLogCleaner      *service.OrganizeLogCleaner
+	strmReconcileService    *service.StrmReconcileService
+	localWatchService       *service.LocalWatchService
+	embyProxyLogService     *service.EmbyProxyLogService
+	cloudTreeSnapshotSvc    *service.CloudTreeSnapshotService
 	organizePreviewQueue    *service.OrganizePreviewQueue
 	embyProxyServer         *EmbyProxyServer
 	embyLoginProtection     *service.EmbyLoginProtection
+	embyStreamProxy         *service.EmbyStreamProxy
 	appLoginProtection      *service.EmbyLoginProtection
 	notificationService     *service.NotificationService
 	rssAutomationService    *service.RSSAutomationService
@@ -105,9 +113,16 @@ func New(cfg *config.Config, log *logger.Logger) *Server {
 		embyMissingService:      embyMissingService,
 		versionCheckHandler:     embyVersionCheckHandler,
 		balanceCleanupSvc:       service.NewBalanceCleanupService(log),
+		balancePrefetchSvc:      service.NewBalancePrefetchService(log, service.NewBalanceAssignmentService(log), embyClient),
 		embyClient:              embyClient,
 		organizeLogCleaner:      service.NewOrganizeLogCleaner(log, 0, 0),
+		strmReconcileService:    service.NewStrmReconcileService(log),
+		localWatchService:       service.NewLocalWatchService(log, download115Service),
+		embyProxyLogService:     service.NewEmbyProxyLogService(cfg, log),
+		embyStreamProxy:         service.NewEmbyStreamProxy(cfg, log),
+		cloudTreeSnapshotSvc:    service.NewCloudTreeSnapshotService(log),
 		notificationService:     notificationService,
+		balanceHealthSvc:        service.NewBalanceHealthService(cfg, log, notificationService),
 		taskQueue:               taskQueue,
 	}
 	s.rssAutomationService = service.NewRSSAutomationService(log, s.notificationService, s.moviePilotService)
@@ -121,7 +136,7 @@ func New(cfg *config.Config, log *logger.Logger) *Server {
 	// 开启一个 Emby 代理服务
 	if cfg.Emby.Enabled {
 		s.Logger.Info("Emby服务已启用，正在创建代理服务器...")
-		embyProxyServer := NewEmbyProxyServer(cfg, log, s.embyLoginProtection)
+		embyProxyServer := NewEmbyProxyServer(cfg, log, s.embyLoginProtection, s.embyProxyLogService, s.embyStreamProxy)
 		if embyProxyServer != nil {
 			s.embyProxyServer = embyProxyServer
 		} else {
@@ -163,6 +178,15 @@ func (s *Server) Start() error {
 	// 启动整理日志清理器（默认 7 天保留）
 	s.organizeLogCleaner.Start()
 
+	// 启动 STRM 全量对账调度
+	s.strmReconcileService.Start()
+
+	// 启动本地挂载目录监听
+	s.localWatchService.Start()
+
+	// 启动 302 播放记录持久化与保留清理
+	s.embyProxyLogService.Start()
+
 	// 启动预整理队列
 	if s.organizePreviewQueue != nil {
 		s.organizePreviewQueue.Start()
@@ -171,6 +195,12 @@ func (s *Server) Start() error {
 	// 启动 Match302 子账号缓存清理器
 	s.balanceCleanupSvc.Start()
 
+	// 启动 Match302 剧集后续集预取
+	s.balancePrefetchSvc.Start()
+
+	// 启动 Match302 子账号健康检查
+	s.balanceHealthSvc.Start()
+
 	// 启动 Emby 缺集定时扫描调度
 	s.embyMissingService.Start()
 
@@ -214,6 +244,14 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.organizeLogCleaner.Stop()
 	}
 
+	if s.strmReconcileService != nil {
+		s.strmReconcileService.Stop()
+	}
+
+	if s.localWatchService != nil {
+		s.localWatchService.Stop()
+	}
+
 	if s.organizePreviewQueue != nil {
 		s.organizePreviewQueue.Stop()
 	}
@@ -222,6 +260,14 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		s.balanceCleanupSvc.Stop()
 	}
 
+	if s.balancePrefetchSvc != nil {
+		s.balancePrefetchSvc.Stop()
+	}
+
+	if s.balanceHealthSvc != nil {
+		s.balanceHealthSvc.Stop()
+	}
+
 	if s.embyMissingService != nil {
 		s.embyMissingService.Stop()
 	}
@@ -241,6 +287,11 @@ func (s *Server) Shutdown(ctx context.Context) error {
 		}
 	}
 
+	// 代理停止后再停止 302 播放记录写入，确保队列中的记录落库
+	if s.embyProxyLogService != nil {
+		s.embyProxyLogService.Stop()
+	}
+
 	s.taskQueue.Stop()
 
 	// 关闭数据库连接
@@ -282,16 +333,17 @@ func (s *Server) setupRoutes() {
 	notificationHandler := handler.NewNotificationHandler(s.notificationService)
 	rssAutomationHandler := handler.NewRSSAutomationHandler(s.rssAutomationService)
 	cloudStorageHandler := handler.NewCloudStorageHandler()
-	cloudPathHandler := handler.NewCloudPathHandler()
+	cloudPathHandler := handler.NewCloudPathHandler(s.Logger)
 	mediaRecognitionHandler := handler.NewMediaRecognitionHandler(s.mediaRecognitionService)
 	cloudDirectoryHandler := handler.NewCloudDirectoryHandler()
 	web115CookieHandler := handler.NewWeb115CookieHandler(s.Logger, s.web115KeepAliveService)
 	auth115Handler := handler.NewAuth115Handler(s.Config, s.Logger)
 	webhookHandler := handler.NewWebhookHandler(s.Logger, s.Config, s.download115Service, s.embySortNameService, embyWatchService)
-	strmHandler := handler.NewStrmHandler(s.Logger, s.download115Service)
+	strmHandler := handler.NewStrmHandler(s.Logger, s.download115Service, s.strmReconcileService, s.cloudTreeSnapshotSvc)
 	downloadQueueHandler := handler.NewDownloadQueueHandler(s.download115Service)
 	pickcodeCacheHandler := handler.NewPickcodeCacheHandler()
 	match302Handler := handler.NewMatch302Handler(s.Logger)
+	match302HealthHandler := handler.NewMatch302HealthHandler(s.balanceHealthSvc)
 	organizeHandler := handler.NewOrganizeHandler(s.Logger, s.moviePilotService, s.tmdbService, s.download115Service, s.embyClient)
 	s.rssAutomationService.SetOrganizer(organizeHandler)
 	s.rssAutomationService.SetMediaStatusChecker(organizeHandler)
@@ -302,8 +354,10 @@ func (s *Server) setupRoutes() {
 	embyCoverHandler := handler.NewEmbyCoverHandler(s.Logger, s.embyCoverService)
 	embySortNameHandler := handler.NewEmbySortNameHandler(s.Logger, s.embySortNameService)
 	embyStatsHandler := handler.NewEmbyStatsHandler(s.Logger, s.embyStatsService)
-	embyProxyLogHandler := handler.NewEmbyProxyLogHandler(s.embyLoginProtection)
+	embyProxyLogHandler := handler.NewEmbyProxyLogHandler(s.embyLoginProtection, s.embyProxyLogService, s.embyStreamProxy)
 	embyBindingHandler := handler.NewEmbyBindingHandler(s.Logger, s.embyClient)
+	embyUserLimitHandler := handler.NewEmbyUserLimitHandler(s.Logger)
+	embyPlaybackRouteHandler := handler.NewEmbyPlaybackRouteHandler(s.Logger)
 	embyMissingHandler := handler.NewEmbyMissingHandler(s.Logger, s.embyMissingService)
 	embyImageOptimizationHandler := handler.NewEmbyImageOptimizationHandler(s.Logger, s.Config, s.embyClient)
 	embyWatchHandler := handler.NewEmbyWatchHandler(s.Logger, embyWatchService)
@@ -338,6 +392,13 @@ func (s *Server) setupRoutes() {
 		cloudDrive2Webhook.POST("/file_notify", webhookHandler.CloudDrive2FileNotify)
 		// webhook.POST("/clouddrive2/mount_notify", webhookHandler.CloudDrive2MountNotify)
 
+		// Sonarr/Radarr/qBittorrent webhook
+		arrWebhook := webhook.Group("")
+		arrWebhook.Use(middleware.ArrWebhookAuth(s.Config))
+		arrWebhook.POST("/sonarr", webhookHandler.ArrWebhook)
+		arrWebhook.POST("/radarr", webhookHandler.ArrWebhook)
+		arrWebhook.POST("/qbittorrent", webhookHandler.QBittorrentWebhook)
+
 		// movie-pilot v2 webhook
 		webhook.Any("/movie-pilot/v2", webhookHandler.MoviePilotV2Webhook)
 
@@ -345,6 +406,10 @@ func (s *Server) setupRoutes() {
 		webhook.POST("/emby", webhookHandler.HandleEmbyWebhook)
 	}
 
+	// Prometheus 指标（独立 Bearer Token 鉴权，供抓取器调用）
+	service.RegisterMetricCollectors(s.Logger)
+	s.gin.GET("/metrics", middleware.MetricsAuth(s.Config), gin.WrapH(metrics.Default().Handler()))
+
 	// 需要JWT验证的路由
 	protected := api.Group("/")
 	protected.Use(middleware.JWTAuth(s.Config), middleware.RequireAdmin())
@@ -377,6 +442,11 @@ func (s *Server) setupRoutes() {
 			rssAutomation.PUT("/workflows/:id", rssAutomationHandler.UpdateWorkflow)
 			rssAutomation.GET("/workflows/:id/manual-candidates", rssAutomationHandler.ListManualCandidates)
 			rssAutomation.POST("/workflows/:id/manual-runs", rssAutomationHandler.CreateManualRuns)
+			rssAutomation.POST("/workflows/:id/trigger", rssAutomationHandler.TriggerWorkflow)
+			rssAutomation.GET("/sub-workflows", rssAutomationHandler.ListSubWorkflows)
+			rssAutomation.POST("/sub-workflows", rssAutomationHandler.CreateSubWorkflow)
+			rssAutomation.PUT("/sub-workflows/:id", rssAutomationHandler.UpdateSubWorkflow)
+			rssAutomation.DELETE("/sub-workflows/:id", rssAutomationHandler.DeleteSubWorkflow)
 			rssAutomation.GET("/targets", rssAutomationHandler.ListTargets)
 			rssAutomation.GET("/targets/status", rssAutomationHandler.ListTargetStatuses)
 			rssAutomation.POST("/targets", rssAutomationHandler.CreateTarget)
@@ -497,6 +567,14 @@ func (s *Server) setupRoutes() {
 			strm.POST("/gen/115-directory-tree", strmHandler.GenStrmWith115DirectoryTree)
 			// 按云路径映射与云端源目录递归重生成 STRM
 			strm.POST("/regenerate-directory", strmHandler.RegenerateDirectory)
+			// 按云路径映射全量对账 STRM（dry-run 报告 / 实际修复）
+			strm.POST("/reconcile", strmHandler.Reconcile)
+			strm.GET("/reconcile/:cloud_path_id", strmHandler.GetReconcileReport)
+			// 云盘目录树快照（增量、可断点续传）
+			strm.POST("/snapshot/sync", strmHandler.SyncSnapshot)
+			strm.GET("/snapshot/:cloud_path_id", strmHandler.GetSnapshotState)
+			// 签名播放令牌吊销
+			strm.POST("/playback/revoke", strmHandler.RevokePlaybackTokens)
 		}
 
 		// 115Open 下载队列（成功任务会自动出队）
@@ -538,6 +616,12 @@ func (s *Server) setupRoutes() {
 				previewTasks.POST("/:id/assign-tmdb", organizeHandler.AssignPreviewTaskTMDB)
 				previewTasks.DELETE("/:id", organizeHandler.DeletePreviewTask)
 			}
+			batches := organize.Group("/batches")
+			{
+				batches.GET("", organizeHandler.ListBatches)
+				batches.GET("/:id", organizeHandler.GetBatch)
+				batches.POST("/:id/revert", organizeHandler.RevertBatch)
+			}
 		}
 
 		// 整理日志（STRM 生成 / 文件下载等业务事件）
@@ -617,8 +701,10 @@ func (s *Server) setupRoutes() {
 		embyProxyLog := protected.Group("/emby-proxy")
 		{
 			embyProxyLog.GET("/302-logs", embyProxyLogHandler.List)
+			embyProxyLog.GET("/302-logs/export", embyProxyLogHandler.Export)
 			embyProxyLog.DELETE("/302-logs", embyProxyLogHandler.Clear)
 			embyProxyLog.GET("/balance-status", embyProxyLogHandler.BalanceStatus)
+			embyProxyLog.GET("/stream-status", embyProxyLogHandler.StreamStatus)
 			embyProxyLog.GET("/security-status", embyProxyLogHandler.SecurityStatus)
 			embyProxyLog.POST("/security-unblock", embyProxyLogHandler.SecurityUnblock)
 		}
@@ -633,6 +719,25 @@ func (s *Server) setupRoutes() {
 			embyBindings.DELETE("/:id", embyBindingHandler.DeleteBinding)
 		}
 
+		// Emby 用户播放限制（并发数 / 每日次数 / 允许时段）
+		embyUserLimits := protected.Group("/emby-user-limits")
+		{
+			embyUserLimits.GET("", embyUserLimitHandler.ListLimits)
+			embyUserLimits.POST("", embyUserLimitHandler.CreateLimit)
+			embyUserLimits.PUT("/:id", embyUserLimitHandler.UpdateLimit)
+			embyUserLimits.DELETE("/:id", embyUserLimitHandler.DeleteLimit)
+		}
+
+		// Emby 播放路由规则（按客户端 / 网络 / 用户 / 媒体库 / 文件大小选择 302、Emby、中转或拒绝）
+		embyPlaybackRoutes := protected.Group("/emby-playback-routes")
+		{
+			embyPlaybackRoutes.GET("", embyPlaybackRouteHandler.ListRoutes)
+			embyPlaybackRoutes.POST("", embyPlaybackRouteHandler.CreateRoute)
+			embyPlaybackRoutes.POST("/test", embyPlaybackRouteHandler.TestRoute)
+			embyPlaybackRoutes.PUT("/:id", embyPlaybackRouteHandler.UpdateRoute)
+			embyPlaybackRoutes.DELETE("/:id", embyPlaybackRouteHandler.DeleteRoute)
+		}
+
 		// Emby 缺集扫描（含定时扫描与黑名单）
 		embyMissing := protected.Group("/emby-missing")
 		{
@@ -707,6 +812,10 @@ func (s *Server) setupRoutes() {
 			match302.POST("/:id/assignments/:assignment_id/extend-retention", match302Handler.ExtendAssignmentRetention)
 			match302.PATCH("/:id/balance-enabled", match302Handler.UpdateMatch302BalanceEnabled)
 
+			// 子账号健康检查
+			match302.GET("/:id/members/:member_id/health", match302HealthHandler.GetMemberHealth)
+			match302.POST("/:id/members/:member_id/health-check", match302HealthHandler.CheckMemberHealth)
+
 			match302.GET("/:id", match302Handler.GetMatch302)
 			match302.PUT("/:id", match302Handler.UpdateMatch302)
 			match302.DELETE("/:id", match302Handler.DeleteMatch302)
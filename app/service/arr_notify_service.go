@@ -0,0 +1,256 @@
+package service
+
+import (
+	"encoding/json"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/pathhelper"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MaxArrNotifyEvents 单次 webhook 展开后的最大文件事件数
+const MaxArrNotifyEvents = 1000
+
+// 下载管理器文件事件动作，与 CloudDrive2 通知保持一致
+const (
+	ArrActionCreate = "create"
+	ArrActionRename = "rename"
+	ArrActionDelete = "delete"
+)
+
+// ArrFileEvent 由 Sonarr/Radarr/qBittorrent 通知展开得到的单个文件事件，路径为下载管理器视角
+type ArrFileEvent struct {
+	Action       string `json:"action"`
+	IsDir        bool   `json:"is_dir"`
+	Path         string `json:"path"`
+	PreviousPath string `json:"previous_path,omitempty"` // 仅 rename
+	// KindUnknown 上报方无法确定是文件还是目录(qBittorrent 未传文件数)，按 CloudPath 过滤规则推断
+	KindUnknown bool `json:"kind_unknown,omitempty"`
+}
+
+// ArrWebhookFile Sonarr episodeFile / Radarr movieFile 以及重命名、删除列表中的文件
+type ArrWebhookFile struct {
+	RelativePath         string `json:"relativePath"`
+	Path                 string `json:"path"`
+	PreviousRelativePath string `json:"previousRelativePath,omitempty"`
+	PreviousPath         string `json:"previousPath,omitempty"`
+}
+
+// ArrWebhookRequest Sonarr/Radarr Webhook 请求体中与文件路径相关的字段
+type ArrWebhookRequest struct {
+	EventType    string `json:"eventType"`
+	InstanceName string `json:"instanceName"`
+	Series       *struct {
+		Title string `json:"title"`
+		Path  string `json:"path"`
+	} `json:"series,omitempty"`
+	Movie *struct {
+		Title      string `json:"title"`
+		FolderPath string `json:"folderPath"`
+	} `json:"movie,omitempty"`
+	EpisodeFile  *ArrWebhookFile  `json:"episodeFile,omitempty"`
+	EpisodeFiles []ArrWebhookFile `json:"episodeFiles,omitempty"`
+	MovieFile    *ArrWebhookFile  `json:"movieFile,omitempty"`
+	IsUpgrade    bool             `json:"isUpgrade"`
+	DeleteReason string           `json:"deleteReason,omitempty"`
+	// DeletedFiles 在 Download 事件中是被替换的文件列表，在 SeriesDelete/MovieDelete 中是是否删除了文件
+	DeletedFiles        json.RawMessage  `json:"deletedFiles,omitempty"`
+	RenamedEpisodeFiles []ArrWebhookFile `json:"renamedEpisodeFiles,omitempty"`
+	RenamedMovieFiles   []ArrWebhookFile `json:"renamedMovieFiles,omitempty"`
+}
+
+// Events 将 Sonarr/Radarr 通知展开为文件事件；Test/Grab 等与文件无关的事件返回空
+func (r ArrWebhookRequest) Events() ([]ArrFileEvent, error) {
+	var events []ArrFileEvent
+	switch r.EventType {
+	case "Download":
+		// 升级时先删除被替换的旧文件，再为新文件生成 STRM
+		var replaced []ArrWebhookFile
+		if len(r.DeletedFiles) > 0 && r.DeletedFiles[0] == '[' {
+			if err := json.Unmarshal(r.DeletedFiles, &replaced); err != nil {
+				return nil, fmt.Errorf("invalid deletedFiles: %w", err)
+			}
+		}
+		imported := r.importedFiles()
+		for _, file := range replaced {
+			if !containsArrFile(imported, file.Path) {
+				events = append(events, ArrFileEvent{Action: ArrActionDelete, Path: file.Path})
+			}
+		}
+		for _, file := range imported {
+			events = append(events, ArrFileEvent{Action: ArrActionCreate, Path: file.Path})
+		}
+	case "Rename":
+		renamed := make([]ArrWebhookFile, 0, len(r.RenamedEpisodeFiles)+len(r.RenamedMovieFiles))
+		renamed = append(append(renamed, r.RenamedEpisodeFiles...), r.RenamedMovieFiles...)
+		for _, file := range renamed {
+			events = append(events, ArrFileEvent{Action: ArrActionRename, Path: file.Path, PreviousPath: file.PreviousPath})
+		}
+	case "EpisodeFileDelete", "MovieFileDelete":
+		// 升级导致的删除由随后的 Download 事件处理，避免误删同名的新 STRM
+		if strings.EqualFold(r.DeleteReason, "upgrade") {
+			return nil, nil
+		}
+		for _, file := range r.importedFiles() {
+			events = append(events, ArrFileEvent{Action: ArrActionDelete, Path: file.Path})
+		}
+	case "SeriesDelete", "MovieDelete":
+		var deletedFiles bool
+		if len(r.DeletedFiles) > 0 && r.DeletedFiles[0] != '[' {
+			_ = json.Unmarshal(r.DeletedFiles, &deletedFiles)
+		}
+		if !deletedFiles {
+			return nil, nil
+		}
+		if r.Series != nil && r.Series.Path != "" {
+			events = append(events, ArrFileEvent{Action: ArrActionDelete, IsDir: true, Path: r.Series.Path})
+		}
+		if r.Movie != nil && r.Movie.FolderPath != "" {
+			events = append(events, ArrFileEvent{Action: ArrActionDelete, IsDir: true, Path: r.Movie.FolderPath})
+		}
+	}
+	if err := validateArrEvents(events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (r ArrWebhookRequest) importedFiles() []ArrWebhookFile {
+	var files []ArrWebhookFile
+	if r.EpisodeFile != nil {
+		files = append(files, *r.EpisodeFile)
+	}
+	for _, file := range r.EpisodeFiles {
+		if !containsArrFile(files, file.Path) {
+			files = append(files, file)
+		}
+	}
+	if r.MovieFile != nil {
+		files = append(files, *r.MovieFile)
+	}
+	return files
+}
+
+func containsArrFile(files []ArrWebhookFile, filePath string) bool {
+	for _, file := range files {
+		if file.Path == filePath {
+			return true
+		}
+	}
+	return false
+}
+
+// QBittorrentNotifyRequest qBittorrent「下载完成时运行外部程序」通过 curl 上报的参数，
+// 例如 curl -d "name=%N" -d "content_path=%F" -d "num_files=%C" ...
+type QBittorrentNotifyRequest struct {
+	Name        string `json:"name" form:"name"`
+	Hash        string `json:"hash" form:"hash"`
+	Category    string `json:"category" form:"category"`
+	ContentPath string `json:"content_path" form:"content_path"`
+	NumFiles    int    `json:"num_files" form:"num_files"`
+}
+
+// Events 下载完成只会产生一个创建事件；多文件种子的内容路径为目录
+func (r QBittorrentNotifyRequest) Events() ([]ArrFileEvent, error) {
+	event := ArrFileEvent{
+		Action:      ArrActionCreate,
+		Path:        r.ContentPath,
+		IsDir:       r.NumFiles > 1,
+		KindUnknown: r.NumFiles <= 0,
+	}
+	events := []ArrFileEvent{event}
+	if err := validateArrEvents(events); err != nil {
+		return nil, err
+	}
+	return events, nil
+}
+
+func validateArrEvents(events []ArrFileEvent) error {
+	if len(events) > MaxArrNotifyEvents {
+		return fmt.Errorf("events exceed the maximum of %d items", MaxArrNotifyEvents)
+	}
+	for i, event := range events {
+		if _, err := pathhelper.NormalizeUntrustedPath(event.Path); err != nil {
+			return fmt.Errorf("events[%d]: invalid path: %w", i, err)
+		}
+		if event.Action == ArrActionRename {
+			if _, err := pathhelper.NormalizeUntrustedPath(event.PreviousPath); err != nil {
+				return fmt.Errorf("events[%d]: invalid previous path: %w", i, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MapArrPath 将下载管理器视角的路径按 CloudPath.ArrPathPrefix 映射为监控事件路径(SourcePath 空间)
+func MapArrPath(reported string, cloudPath model.CloudPath) (string, bool) {
+	if strings.TrimSpace(cloudPath.ArrPathPrefix) == "" {
+		return "", false
+	}
+	return pathhelper.RebasePath(reported, cloudPath.ArrPathPrefix, cloudPath.SourcePath)
+}
+
+// ArrNotifyService 处理 Sonarr/Radarr/qBittorrent 的文件通知
+type ArrNotifyService struct {
+	logger         *logger.Logger
+	download115Svc *Download115Service
+}
+
+// NewArrNotifyService 创建新的 ArrNotifyService 实例
+func NewArrNotifyService(log *logger.Logger, download115Svc *Download115Service) *ArrNotifyService {
+	return &ArrNotifyService{
+		logger:         log,
+		download115Svc: download115Svc,
+	}
+}
+
+func (s *ArrNotifyService) ProcessEvents(events []ArrFileEvent, cloudPaths []model.CloudPath) {
+	for _, event := range events {
+		s.HandleEvent(event, cloudPaths)
+	}
+}
+
+// HandleEvent 将路径映射到第一个匹配的 CloudPath 后，复用 STRM 的创建/重命名/删除逻辑
+func (s *ArrNotifyService) HandleEvent(event ArrFileEvent, cloudPaths []model.CloudPath) {
+	strmSvc := NewStrmService(s.logger, s.download115Svc)
+	for _, cloudPath := range cloudPaths {
+		if cloudPath.LinkType != model.LinkTypeStrm {
+			continue
+		}
+		eventPath, sourceInside := MapArrPath(event.Path, cloudPath)
+		var previousPath string
+		var previousInside bool
+		if event.Action == ArrActionRename {
+			previousPath, previousInside = MapArrPath(event.PreviousPath, cloudPath)
+		}
+		if !sourceInside && !previousInside {
+			s.logger.Debugf("%s 不在 CloudPath (ID: %d) 的下载管理器路径 %s 内", event.Path, cloudPath.ID, cloudPath.ArrPathPrefix)
+			continue
+		}
+
+		isDir := event.IsDir
+		if event.KindUnknown {
+			isDir = !pathhelper.IsFileInAnyFilterRules(strings.ToLower(filepath.Ext(eventPath)), cloudPath.FilterRules)
+		}
+
+		switch event.Action {
+		case ArrActionCreate:
+			if isDir {
+				strmSvc.CreateDir(eventPath, cloudPath)
+			} else if err := strmSvc.CreateFile(eventPath, cloudPath); err != nil {
+				s.logger.Warnf("处理下载管理器通知失败 %s: %v", event.Path, err)
+			}
+		case ArrActionRename:
+			if isDir {
+				strmSvc.RenameDir(previousPath, eventPath, cloudPath, previousInside, sourceInside)
+			} else {
+				strmSvc.RenameFile(previousPath, eventPath, cloudPath, previousInside, sourceInside)
+			}
+		case ArrActionDelete:
+			strmSvc.DeleteStrm(eventPath, cloudPath, isDir)
+		}
+		return
+	}
+}
@@ -0,0 +1,109 @@
+package service
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"film-fusion/app/config"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+func decodeArrRequest(t *testing.T, body string) ArrWebhookRequest {
+	t.Helper()
+	var req ArrWebhookRequest
+	if err := json.Unmarshal([]byte(body), &req); err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	return req
+}
+
+func TestArrWebhookRequestEvents(t *testing.T) {
+	download := decodeArrRequest(t, `{
+		"eventType": "Download", "isUpgrade": true,
+		"series": {"title": "Show", "path": "/tv/Show"},
+		"episodeFile": {"relativePath": "Season 01/Show S01E01 1080p.mkv", "path": "/tv/Show/Season 01/Show S01E01 1080p.mkv"},
+		"deletedFiles": [{"relativePath": "Season 01/Show S01E01 720p.mkv", "path": "/tv/Show/Season 01/Show S01E01 720p.mkv"}]
+	}`)
+	events, err := download.Events()
+	if err != nil {
+		t.Fatalf("download events: %v", err)
+	}
+	if len(events) != 2 || events[0].Action != ArrActionDelete || events[0].Path != "/tv/Show/Season 01/Show S01E01 720p.mkv" ||
+		events[1].Action != ArrActionCreate || events[1].Path != "/tv/Show/Season 01/Show S01E01 1080p.mkv" {
+		t.Fatalf("download events = %+v", events)
+	}
+
+	rename := decodeArrRequest(t, `{"eventType": "Rename", "renamedMovieFiles": [{"previousPath": "/movies/A/a.mkv", "path": "/movies/A/A (2020).mkv"}]}`)
+	events, err = rename.Events()
+	if err != nil || len(events) != 1 || events[0].PreviousPath != "/movies/A/a.mkv" || events[0].Path != "/movies/A/A (2020).mkv" {
+		t.Fatalf("rename events = %+v, err = %v", events, err)
+	}
+
+	upgradeDelete := decodeArrRequest(t, `{"eventType": "EpisodeFileDelete", "deleteReason": "upgrade", "episodeFile": {"path": "/tv/Show/a.mkv"}}`)
+	if events, _ := upgradeDelete.Events(); len(events) != 0 {
+		t.Fatalf("upgrade delete should be ignored, got %+v", events)
+	}
+
+	movieDelete := decodeArrRequest(t, `{"eventType": "MovieDelete", "deletedFiles": true, "movie": {"folderPath": "/movies/A"}}`)
+	events, err = movieDelete.Events()
+	if err != nil || len(events) != 1 || !events[0].IsDir || events[0].Path != "/movies/A" {
+		t.Fatalf("movie delete events = %+v, err = %v", events, err)
+	}
+	keepFiles := decodeArrRequest(t, `{"eventType": "SeriesDelete", "deletedFiles": false, "series": {"path": "/tv/Show"}}`)
+	if events, _ := keepFiles.Events(); len(events) != 0 {
+		t.Fatalf("series delete without files should be ignored, got %+v", events)
+	}
+
+	traversal := decodeArrRequest(t, `{"eventType": "Download", "movieFile": {"path": "/movies/../../etc/passwd"}}`)
+	if _, err := traversal.Events(); err == nil {
+		t.Fatal("path traversal should be rejected")
+	}
+	if events, _ := decodeArrRequest(t, `{"eventType": "Test"}`).Events(); len(events) != 0 {
+		t.Fatalf("test event = %+v", events)
+	}
+}
+
+func TestMapArrPath(t *testing.T) {
+	cloudPath := model.CloudPath{SourcePath: "/115/Media", ArrPathPrefix: "/data/media/"}
+	if got, ok := MapArrPath("/data/media/TV/Show/E01.mkv", cloudPath); !ok || got != "/115/Media/TV/Show/E01.mkv" {
+		t.Fatalf("mapped = %q, %v", got, ok)
+	}
+	if _, ok := MapArrPath("/data/mediaX/E01.mkv", cloudPath); ok {
+		t.Fatal("sibling prefix should not match")
+	}
+	if got, ok := MapArrPath(`D:\Media\Movie.mkv`, model.CloudPath{SourcePath: "/Media", ArrPathPrefix: `D:\Media`}); !ok || got != "/Media/Movie.mkv" {
+		t.Fatalf("windows path mapped = %q, %v", got, ok)
+	}
+	if _, ok := MapArrPath("/data/media/E01.mkv", model.CloudPath{SourcePath: "/Media"}); ok {
+		t.Fatal("cloud path without prefix should not receive arr events")
+	}
+}
+
+func TestArrNotifyServiceDeletesMappedStrm(t *testing.T) {
+	localRoot := t.TempDir()
+	cloudPath := model.CloudPath{
+		ID: 1, SourcePath: "/Media", ArrPathPrefix: "/tv", LocalPath: localRoot,
+		LinkType: model.LinkTypeStrm, SourceType: model.SourceTypeMoviePilot2,
+	}
+	writeLocalStrm(t, localRoot, "Media/Show/Show S01E01.strm", "http://strm/Media/Show/Show S01E01.mkv")
+	writeLocalStrm(t, localRoot, "Media/Show/Show S01E01.nfo", "<episodedetails/>")
+	writeLocalStrm(t, localRoot, "Media/Other/keep.strm", "http://strm/Media/Other/keep.mkv")
+
+	svc := NewArrNotifyService(logger.New(config.LogConfig{Level: "error", Output: "stdout"}), nil)
+	svc.ProcessEvents([]ArrFileEvent{
+		{Action: ArrActionDelete, Path: "/tv/Show/Show S01E01.mkv"},
+		{Action: ArrActionDelete, Path: "/movies/Other/keep.mkv"},
+	}, []model.CloudPath{cloudPath})
+
+	for _, rel := range []string{"Media/Show/Show S01E01.strm", "Media/Show/Show S01E01.nfo"} {
+		if _, err := os.Stat(filepath.Join(localRoot, filepath.FromSlash(rel))); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed, stat err = %v", rel, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(localRoot, "Media", "Other", "keep.strm")); err != nil {
+		t.Fatalf("unmapped path should be kept: %v", err)
+	}
+}
@@ -0,0 +1,455 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/pathhelper"
+	"fmt"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// cloudTreeSnapshotDirBatch 每次从快照表取出的待处理目录数
+const cloudTreeSnapshotDirBatch = 50
+
+// cloudTreeSnapshotQueryChunk IN 查询单批 ID 数，避开 SQLite 变量数上限
+const cloudTreeSnapshotQueryChunk = 500
+
+// ErrCloudTreeSnapshotRunning 同一 CloudPath 已有快照同步在执行。
+var ErrCloudTreeSnapshotRunning = errors.New("该云路径映射正在同步目录树快照")
+
+// CloudTreeSyncResult 一次快照同步的结果。
+// RemovedPaths 为云端已删除或已移走的文件旧路径(事件路径空间)，调用方据此清理 STRM。
+type CloudTreeSyncResult struct {
+	CloudPathID  uint     `json:"cloud_path_id"`
+	Generation   int64    `json:"generation"`
+	Resumed      bool     `json:"resumed"`
+	Full         bool     `json:"full"`
+	DirsListed   int      `json:"dirs_listed"`
+	DirsReused   int      `json:"dirs_reused"`
+	Files        int      `json:"files"`
+	Changed      int      `json:"changed"`
+	Removed      int      `json:"removed"`
+	RemovedPaths []string `json:"removed_paths"`
+}
+
+// CloudTreeSnapshotService 维护每个 CloudPath 的云盘目录树快照。
+//
+// 同步按轮次(Generation)进行：从根目录开始逐个目录列举并写入快照表，
+// 目录的修改时间已由本轮列举父目录刷新、且与上次列举时一致时直接复用快照中的子项，不再请求云盘；
+// 父目录被复用时子目录的修改时间仍是旧值，这些子目录必须重新列举，深层变动因此不会漏掉。
+// 待处理目录保存在快照表本身(本轮已看到但未处理)，进程中断后再次同步会从断点继续。
+type CloudTreeSnapshotService struct {
+	logger *logger.Logger
+
+	mu      sync.Mutex
+	running map[uint]bool
+}
+
+// NewCloudTreeSnapshotService 创建目录树快照服务
+func NewCloudTreeSnapshotService(log *logger.Logger) *CloudTreeSnapshotService {
+	return &CloudTreeSnapshotService{
+		logger:  log,
+		running: map[uint]bool{},
+	}
+}
+
+func (s *CloudTreeSnapshotService) acquire(cloudPathID uint) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[cloudPathID] {
+		return false
+	}
+	s.running[cloudPathID] = true
+	return true
+}
+
+func (s *CloudTreeSnapshotService) release(cloudPathID uint) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.running, cloudPathID)
+}
+
+// State 返回 CloudPath 的快照同步状态，从未同步过时返回 gorm.ErrRecordNotFound。
+func (s *CloudTreeSnapshotService) State(cloudPathID uint) (*model.CloudTreeSnapshotState, error) {
+	var state model.CloudTreeSnapshotState
+	if err := database.DB.Where("cloud_path_id = ?", cloudPathID).First(&state).Error; err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
+
+// Sync 同步 CloudPath 的目录树快照。上次同步被中断或失败时从断点继续，full 参数沿用中断的那一轮。
+// full=true 时忽略目录修改时间，重新列举所有目录。
+func (s *CloudTreeSnapshotService) Sync(ctx context.Context, cloudPath model.CloudPath, full bool) (*CloudTreeSyncResult, error) {
+	if cloudPath.CloudStorage == nil {
+		return nil, fmt.Errorf("CloudPath (ID: %d) 缺少关联的云存储配置", cloudPath.ID)
+	}
+	if !s.acquire(cloudPath.ID) {
+		return nil, ErrCloudTreeSnapshotRunning
+	}
+	defer s.release(cloudPath.ID)
+
+	drv, err := NewStorageDriver(*cloudPath.CloudStorage, s.logger)
+	if err != nil {
+		return nil, err
+	}
+
+	var state model.CloudTreeSnapshotState
+	err = database.DB.Where("cloud_path_id = ?", cloudPath.ID).First(&state).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+	state.CloudPathID = cloudPath.ID
+
+	// 被中断(running)或列举失败(failed，多为限流)的一轮都从断点继续，已处理的目录不会重复列举
+	resumed := (state.Status == model.CloudTreeSnapshotStatusRunning || state.Status == model.CloudTreeSnapshotStatusFailed) &&
+		state.Generation > 0 && state.RootID != ""
+	if resumed {
+		state.Status = model.CloudTreeSnapshotStatusRunning
+		state.LastError = ""
+		full = state.Full
+		s.logger.Infof("继续未完成的目录树快照同步 cloud_path_id=%d generation=%d", cloudPath.ID, state.Generation)
+	} else if err := s.beginGeneration(ctx, drv, cloudPath, &state, full); err != nil {
+		return nil, err
+	}
+
+	gen := state.Generation
+	for {
+		var dirs []model.CloudTreeSnapshotEntry
+		if err := database.DB.Where("cloud_path_id = ? AND is_dir = ? AND seen_generation = ? AND listed_generation < ?",
+			cloudPath.ID, true, gen, gen).
+			Order("id").Limit(cloudTreeSnapshotDirBatch).Find(&dirs).Error; err != nil {
+			return nil, err
+		}
+		if len(dirs) == 0 {
+			break
+		}
+		for _, dir := range dirs {
+			if err := ctx.Err(); err != nil {
+				// 保持 running 状态，下次同步从这里继续
+				s.saveState(&state)
+				return nil, err
+			}
+			if !full && dir.FileID != state.RootID && dirReusable(dir, gen) {
+				if err := s.reuseDir(cloudPath.ID, dir, gen); err != nil {
+					return nil, err
+				}
+				state.DirsReused++
+				continue
+			}
+			entries, err := drv.List(ctx, dir.FileID)
+			if err != nil {
+				state.Status = model.CloudTreeSnapshotStatusFailed
+				state.LastError = fmt.Sprintf("列举目录失败 %s: %v", dir.Path, err)
+				s.saveState(&state)
+				return nil, fmt.Errorf("列举目录失败 %s: %w", dir.Path, err)
+			}
+			if err := s.applyListing(cloudPath.ID, dir, entries, gen); err != nil {
+				return nil, err
+			}
+			state.DirsListed++
+		}
+		s.saveState(&state)
+	}
+
+	result, err := s.finishGeneration(cloudPath.ID, &state)
+	if err != nil {
+		return nil, err
+	}
+	result.Resumed = resumed
+	result.Full = full
+	return result, nil
+}
+
+// beginGeneration 开启新一轮同步：解析根目录并把它标记为本轮待列举。
+func (s *CloudTreeSnapshotService) beginGeneration(ctx context.Context, drv StorageDriver, cloudPath model.CloudPath, state *model.CloudTreeSnapshotState, full bool) error {
+	strmSvc := &StrmService{logger: s.logger}
+	sourceCloudPath := strmSvc.cloudSourcePath(cloudPath.SourcePath, cloudPath)
+	root, found, err := drv.ResolvePath(ctx, sourceCloudPath)
+	if err != nil {
+		return fmt.Errorf("获取云端目录失败: %w", err)
+	}
+	if !found || root.ID == "" {
+		return fmt.Errorf("云端目录不存在: %s", sourceCloudPath)
+	}
+
+	now := time.Now()
+	state.Generation++
+	state.Status = model.CloudTreeSnapshotStatusRunning
+	state.Full = full
+	state.RootID = root.ID
+	state.DirsListed, state.DirsReused, state.Files, state.Changed, state.Removed = 0, 0, 0, 0, 0
+	state.LastError = ""
+	state.StartedAt = &now
+	state.FinishedAt = nil
+	if err := database.DB.Save(state).Error; err != nil {
+		return err
+	}
+
+	var existing model.CloudTreeSnapshotEntry
+	err = database.DB.Where("cloud_path_id = ? AND file_id = ?", cloudPath.ID, root.ID).First(&existing).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return database.DB.Create(&model.CloudTreeSnapshotEntry{
+			CloudPathID:       cloudPath.ID,
+			FileID:            root.ID,
+			Name:              root.Name,
+			Path:              cloudPath.SourcePath,
+			IsDir:             true,
+			ModTime:           root.ModTime,
+			ModTimeGeneration: state.Generation,
+			SeenGeneration:    state.Generation,
+			ChangedGeneration: state.Generation,
+		}).Error
+	}
+	if err != nil {
+		return err
+	}
+	return database.DB.Model(&existing).Updates(map[string]any{
+		"parent_id":           "",
+		"path":                cloudPath.SourcePath,
+		"mod_time":            root.ModTime,
+		"mod_time_generation": state.Generation,
+		"seen_generation":     state.Generation,
+	}).Error
+}
+
+// dirReusable 目录曾被列举过，修改时间由本轮列举父目录刷新且与上次列举时一致
+func dirReusable(dir model.CloudTreeSnapshotEntry, gen int64) bool {
+	return dir.ModTimeGeneration == gen && dir.ListedGeneration > 0 &&
+		!dir.ListedModTime.IsZero() && dir.ModTime.Equal(dir.ListedModTime)
+}
+
+// reuseDir 复用快照中的直接子项：标记为本轮已看到。子目录的修改时间未被刷新，随后会被重新列举。
+func (s *CloudTreeSnapshotService) reuseDir(cloudPathID uint, dir model.CloudTreeSnapshotEntry, gen int64) error {
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&model.CloudTreeSnapshotEntry{}).
+			Where("cloud_path_id = ? AND parent_id = ?", cloudPathID, dir.FileID).
+			Update("seen_generation", gen).Error; err != nil {
+			return err
+		}
+		return tx.Model(&model.CloudTreeSnapshotEntry{}).Where("id = ?", dir.ID).
+			Update("listed_generation", gen).Error
+	})
+}
+
+// applyListing 将一次目录列举结果写入快照，并记录新增/变化的文件。
+func (s *CloudTreeSnapshotService) applyListing(cloudPathID uint, dir model.CloudTreeSnapshotEntry, entries []StorageEntry, gen int64) error {
+	entries = dedupeStorageEntries(entries)
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.ID)
+	}
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		existing := make(map[string]model.CloudTreeSnapshotEntry, len(ids))
+		for start := 0; start < len(ids); start += cloudTreeSnapshotQueryChunk {
+			end := min(start+cloudTreeSnapshotQueryChunk, len(ids))
+			var rows []model.CloudTreeSnapshotEntry
+			if err := tx.Where("cloud_path_id = ? AND file_id IN ?", cloudPathID, ids[start:end]).Find(&rows).Error; err != nil {
+				return err
+			}
+			for _, row := range rows {
+				existing[row.FileID] = row
+			}
+		}
+
+		var created []model.CloudTreeSnapshotEntry
+		for _, entry := range entries {
+			entryPath := path.Join(dir.Path, entry.Name)
+			old, ok := existing[entry.ID]
+			if !ok {
+				created = append(created, model.CloudTreeSnapshotEntry{
+					CloudPathID:       cloudPathID,
+					FileID:            entry.ID,
+					ParentID:          dir.FileID,
+					Name:              entry.Name,
+					Path:              entryPath,
+					IsDir:             entry.IsDir,
+					Size:              entry.Size,
+					SHA1:              strings.ToUpper(entry.SHA1),
+					PickCode:          entry.PickCode,
+					ModTime:           entry.ModTime,
+					ModTimeGeneration: gen,
+					SeenGeneration:    gen,
+					ChangedGeneration: gen,
+				})
+				continue
+			}
+
+			updates := map[string]any{
+				"parent_id":           dir.FileID,
+				"name":                entry.Name,
+				"path":                entryPath,
+				"is_dir":              entry.IsDir,
+				"size":                entry.Size,
+				"sha1":                strings.ToUpper(entry.SHA1),
+				"pick_code":           entry.PickCode,
+				"mod_time":            entry.ModTime,
+				"mod_time_generation": gen,
+				"seen_generation":     gen,
+			}
+			moved := old.Path != entryPath
+			if entry.IsDir {
+				// 目录被移动/重命名时子项路径全部过期，清空列举时间强制重新列举
+				if moved {
+					updates["listed_mod_time"] = time.Time{}
+				}
+			} else if moved || old.Size != entry.Size || !strings.EqualFold(old.SHA1, entry.SHA1) ||
+				!old.ModTime.Equal(entry.ModTime) || old.PickCode != entry.PickCode {
+				updates["changed_generation"] = gen
+				updates["previous_path"] = ""
+				if moved {
+					updates["previous_path"] = old.Path
+				}
+			}
+			if err := tx.Model(&model.CloudTreeSnapshotEntry{}).Where("id = ?", old.ID).Updates(updates).Error; err != nil {
+				return err
+			}
+		}
+		if len(created) > 0 {
+			if err := tx.CreateInBatches(created, 200).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&model.CloudTreeSnapshotEntry{}).Where("id = ?", dir.ID).Updates(map[string]any{
+			"listed_generation": gen,
+			"listed_mod_time":   dir.ModTime,
+		}).Error
+	})
+}
+
+// finishGeneration 清理本轮未看到的条目并汇总结果
+func (s *CloudTreeSnapshotService) finishGeneration(cloudPathID uint, state *model.CloudTreeSnapshotState) (*CloudTreeSyncResult, error) {
+	gen := state.Generation
+	result := &CloudTreeSyncResult{CloudPathID: cloudPathID, Generation: gen, RemovedPaths: []string{}}
+
+	var removed []string
+	if err := database.DB.Model(&model.CloudTreeSnapshotEntry{}).
+		Where("cloud_path_id = ? AND is_dir = ? AND seen_generation < ?", cloudPathID, false, gen).
+		Pluck("path", &removed).Error; err != nil {
+		return nil, err
+	}
+	var moved []string
+	if err := database.DB.Model(&model.CloudTreeSnapshotEntry{}).
+		Where("cloud_path_id = ? AND is_dir = ? AND changed_generation = ? AND previous_path <> ''", cloudPathID, false, gen).
+		Pluck("previous_path", &moved).Error; err != nil {
+		return nil, err
+	}
+	if err := database.DB.Where("cloud_path_id = ? AND seen_generation < ?", cloudPathID, gen).
+		Delete(&model.CloudTreeSnapshotEntry{}).Error; err != nil {
+		return nil, err
+	}
+	result.RemovedPaths = append(append(result.RemovedPaths, removed...), moved...)
+
+	var files, changed int64
+	database.DB.Model(&model.CloudTreeSnapshotEntry{}).
+		Where("cloud_path_id = ? AND is_dir = ?", cloudPathID, false).Count(&files)
+	database.DB.Model(&model.CloudTreeSnapshotEntry{}).
+		Where("cloud_path_id = ? AND is_dir = ? AND changed_generation = ?", cloudPathID, false, gen).Count(&changed)
+
+	now := time.Now()
+	state.Status = model.CloudTreeSnapshotStatusCompleted
+	state.Files = int(files)
+	state.Changed = int(changed)
+	state.Removed = len(result.RemovedPaths)
+	state.FinishedAt = &now
+	s.saveState(state)
+
+	result.DirsListed = state.DirsListed
+	result.DirsReused = state.DirsReused
+	result.Files = state.Files
+	result.Changed = state.Changed
+	result.Removed = state.Removed
+	return result, nil
+}
+
+func (s *CloudTreeSnapshotService) saveState(state *model.CloudTreeSnapshotState) {
+	if err := database.DB.Save(state).Error; err != nil {
+		s.logger.Warnf("保存目录树快照状态失败 cloud_path_id=%d: %v", state.CloudPathID, err)
+	}
+}
+
+// ForEachChangedFile 遍历指定轮次新增或变化的文件
+func (s *CloudTreeSnapshotService) ForEachChangedFile(cloudPathID uint, gen int64, fn func(entry model.CloudTreeSnapshotEntry) error) error {
+	var rows []model.CloudTreeSnapshotEntry
+	var fnErr error
+	err := database.DB.Where("cloud_path_id = ? AND is_dir = ? AND changed_generation = ?", cloudPathID, false, gen).
+		Order("id").FindInBatches(&rows, 500, func(tx *gorm.DB, batch int) error {
+		for _, row := range rows {
+			if fnErr = fn(row); fnErr != nil {
+				return fnErr
+			}
+		}
+		return nil
+	}).Error
+	if fnErr != nil {
+		return fnErr
+	}
+	return err
+}
+
+// TreePaths 以网盘根目录为基准返回快照中的全部目录与文件路径(不带前导 /)，
+// 格式与 115 导出目录树解析结果一致，可直接用于 STRM 批量生成。
+func (s *CloudTreeSnapshotService) TreePaths(cloudPath model.CloudPath) ([]string, error) {
+	strmSvc := &StrmService{logger: s.logger}
+	var paths []string
+	var rows []model.CloudTreeSnapshotEntry
+	err := database.DB.Where("cloud_path_id = ?", cloudPath.ID).Order("path").
+		FindInBatches(&rows, 1000, func(tx *gorm.DB, batch int) error {
+			for _, row := range rows {
+				// 生成逻辑以扩展名区分目录与文件，没有扩展名的文件会被误建为目录，直接跳过
+				if !row.IsDir && filepath.Ext(row.Name) == "" {
+					continue
+				}
+				p := strings.TrimPrefix(strmSvc.cloudSourcePath(row.Path, cloudPath), "/")
+				if p != "" {
+					paths = append(paths, p)
+				}
+			}
+			return nil
+		}).Error
+	return paths, err
+}
+
+// SyncAndGenerateStrm 同步快照后只为本轮新增/变化的文件生成 STRM，并删除已消失文件的 STRM。
+func (s *CloudTreeSnapshotService) SyncAndGenerateStrm(ctx context.Context, strmSvc *StrmService, cloudPath model.CloudPath, full bool) (*CloudTreeSyncResult, error) {
+	result, err := s.Sync(ctx, cloudPath, full)
+	if err != nil {
+		return nil, err
+	}
+	if strings.TrimSpace(cloudPath.LocalPath) == "" {
+		return result, nil
+	}
+	for _, removedPath := range result.RemovedPaths {
+		strmSvc.DeleteStrm(removedPath, cloudPath, false)
+	}
+	err = s.ForEachChangedFile(cloudPath.ID, result.Generation, func(entry model.CloudTreeSnapshotEntry) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		fileExt := strings.ToLower(filepath.Ext(entry.Name))
+		if cloudPath.FilterRules != "" && !pathhelper.IsFileInAnyFilterRules(fileExt, cloudPath.FilterRules) {
+			return nil
+		}
+		strmSvc.CreateStrmOrDownloadWithEntry(entry.Path, cloudPath, snapshotStorageEntry(entry))
+		return nil
+	})
+	return result, err
+}
+
+// snapshotStorageEntry 将快照行还原为存储条目，供 STRM 生成使用
+func snapshotStorageEntry(row model.CloudTreeSnapshotEntry) StorageEntry {
+	return StorageEntry{
+		ID: row.FileID, Name: row.Name, IsDir: row.IsDir, Size: row.Size,
+		SHA1: row.SHA1, PickCode: row.PickCode, ModTime: row.ModTime,
+	}
+}
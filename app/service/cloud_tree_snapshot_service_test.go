@@ -0,0 +1,196 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func setupCloudTreeSnapshotTest(t *testing.T, drv StorageDriver) (*CloudTreeSnapshotService, model.CloudPath) {
+	t.Helper()
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "snapshot.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.CloudTreeSnapshotEntry{}, &model.CloudTreeSnapshotState{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() { database.DB = oldDB })
+
+	RegisterStorageDriver(StorageDriverInfo{Type: "fake-snapshot"}, func(model.CloudStorage, *logger.Logger) (StorageDriver, error) {
+		return drv, nil
+	})
+	t.Cleanup(func() {
+		storageDriversMu.Lock()
+		delete(storageDrivers, "fake-snapshot")
+		storageDriversMu.Unlock()
+	})
+
+	cloudPath := model.CloudPath{
+		ID:           7,
+		SourcePath:   "/Media",
+		SourceType:   model.SourceTypeMoviePilot2,
+		CloudStorage: &model.CloudStorage{ID: 1, StorageType: "fake-snapshot"},
+	}
+	return NewCloudTreeSnapshotService(logger.New(config.LogConfig{Level: "error", Output: "stdout"})), cloudPath
+}
+
+func TestCloudTreeSnapshotIncrementalSync(t *testing.T) {
+	t1 := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	fake := &fakeStorageDriver{children: map[string][]StorageEntry{
+		"root": {
+			{ID: "dA", Name: "Show", IsDir: true, ModTime: t1},
+			{ID: "f1", Name: "Movie.mkv", PickCode: "pc1", Size: 10, ModTime: t1},
+		},
+		"dA": {{ID: "f2", Name: "E01.mkv", PickCode: "pc2", Size: 20, ModTime: t1}},
+	}}
+	svc, cloudPath := setupCloudTreeSnapshotTest(t, reconcileFakeDriver{fake})
+
+	result, err := svc.Sync(context.Background(), cloudPath, false)
+	if err != nil {
+		t.Fatalf("first sync: %v", err)
+	}
+	if result.DirsListed != 2 || result.Files != 2 || result.Changed != 2 || result.Removed != 0 {
+		t.Fatalf("first sync result = %+v", result)
+	}
+
+	// 无变化：子目录修改时间未变，直接复用快照，只列举根目录
+	fake.listed = nil
+	result, err = svc.Sync(context.Background(), cloudPath, false)
+	if err != nil {
+		t.Fatalf("second sync: %v", err)
+	}
+	if result.DirsListed != 1 || result.DirsReused != 1 || result.Changed != 0 || result.Files != 2 {
+		t.Fatalf("second sync result = %+v", result)
+	}
+	if len(fake.listed) != 1 || fake.listed[0] != "root" {
+		t.Fatalf("listed = %v, want only root", fake.listed)
+	}
+
+	// 删除根目录下的文件，并在子目录内重命名文件(目录修改时间随之变化)
+	t2 := t1.Add(time.Hour)
+	fake.children["root"] = []StorageEntry{{ID: "dA", Name: "Show", IsDir: true, ModTime: t2}}
+	fake.children["dA"] = []StorageEntry{{ID: "f2", Name: "S01E01.mkv", PickCode: "pc2", Size: 20, ModTime: t1}}
+	result, err = svc.Sync(context.Background(), cloudPath, false)
+	if err != nil {
+		t.Fatalf("third sync: %v", err)
+	}
+	sort.Strings(result.RemovedPaths)
+	if result.Changed != 1 || result.Files != 1 || len(result.RemovedPaths) != 2 ||
+		result.RemovedPaths[0] != "/Media/Movie.mkv" || result.RemovedPaths[1] != "/Media/Show/E01.mkv" {
+		t.Fatalf("third sync result = %+v", result)
+	}
+	var changed []string
+	if err := svc.ForEachChangedFile(cloudPath.ID, result.Generation, func(entry model.CloudTreeSnapshotEntry) error {
+		changed = append(changed, entry.Path)
+		return nil
+	}); err != nil {
+		t.Fatalf("ForEachChangedFile: %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "/Media/Show/S01E01.mkv" {
+		t.Fatalf("changed = %v", changed)
+	}
+
+	paths, err := svc.TreePaths(cloudPath)
+	if err != nil {
+		t.Fatalf("TreePaths: %v", err)
+	}
+	sort.Strings(paths)
+	want := []string{"Media", "Media/Show", "Media/Show/S01E01.mkv"}
+	if len(paths) != len(want) || paths[0] != want[0] || paths[1] != want[1] || paths[2] != want[2] {
+		t.Fatalf("TreePaths = %v, want %v", paths, want)
+	}
+
+	// root → Show → Season：新增二级子目录
+	t3 := t2.Add(time.Hour)
+	fake.children["root"] = []StorageEntry{{ID: "dA", Name: "Show", IsDir: true, ModTime: t3}}
+	fake.children["dA"] = []StorageEntry{
+		{ID: "f2", Name: "S01E01.mkv", PickCode: "pc2", Size: 20, ModTime: t1},
+		{ID: "dB", Name: "Season 02", IsDir: true, ModTime: t3},
+	}
+	fake.children["dB"] = []StorageEntry{{ID: "f3", Name: "S02E01.mkv", PickCode: "pc3", Size: 30, ModTime: t3}}
+	if result, err = svc.Sync(context.Background(), cloudPath, false); err != nil {
+		t.Fatalf("fourth sync: %v", err)
+	}
+	if result.DirsListed != 3 || result.Changed != 1 || result.Files != 2 {
+		t.Fatalf("fourth sync result = %+v", result)
+	}
+
+	// 只有二级目录变化：Show 的修改时间不变可复用，但 Season 的修改时间未被刷新，必须重新列举
+	t4 := t3.Add(time.Hour)
+	fake.children["dA"][1].ModTime = t4
+	fake.children["dB"] = append(fake.children["dB"], StorageEntry{ID: "f4", Name: "S02E02.mkv", PickCode: "pc4", Size: 40, ModTime: t4})
+	fake.listed = nil
+	if result, err = svc.Sync(context.Background(), cloudPath, false); err != nil {
+		t.Fatalf("fifth sync: %v", err)
+	}
+	if result.DirsListed != 2 || result.DirsReused != 1 || result.Changed != 1 || result.Files != 3 {
+		t.Fatalf("fifth sync result = %+v", result)
+	}
+	sort.Strings(fake.listed)
+	if len(fake.listed) != 2 || fake.listed[0] != "dB" || fake.listed[1] != "root" {
+		t.Fatalf("listed = %v, want root and dB", fake.listed)
+	}
+	changed = nil
+	if err := svc.ForEachChangedFile(cloudPath.ID, result.Generation, func(entry model.CloudTreeSnapshotEntry) error {
+		changed = append(changed, entry.Path)
+		return nil
+	}); err != nil {
+		t.Fatalf("ForEachChangedFile: %v", err)
+	}
+	if len(changed) != 1 || changed[0] != "/Media/Show/Season 02/S02E02.mkv" {
+		t.Fatalf("changed = %v", changed)
+	}
+}
+
+func TestCloudTreeSnapshotResumesAfterFailure(t *testing.T) {
+	fake := &fakeStorageDriver{
+		children: map[string][]StorageEntry{
+			"root": {
+				{ID: "dA", Name: "A", IsDir: true},
+				{ID: "dB", Name: "B", IsDir: true},
+			},
+			"dA": {{ID: "fa", Name: "a.mkv"}},
+			"dB": {{ID: "fb", Name: "b.mkv"}},
+		},
+		listErr: map[string]error{"dB": errors.New("rate limited")},
+	}
+	svc, cloudPath := setupCloudTreeSnapshotTest(t, reconcileFakeDriver{fake})
+
+	if _, err := svc.Sync(context.Background(), cloudPath, false); err == nil {
+		t.Fatal("sync should fail while dB cannot be listed")
+	}
+	state, err := svc.State(cloudPath.ID)
+	if err != nil || state.Status != model.CloudTreeSnapshotStatusFailed {
+		t.Fatalf("state = %+v, %v", state, err)
+	}
+
+	delete(fake.listErr, "dB")
+	fake.listed = nil
+	result, err := svc.Sync(context.Background(), cloudPath, false)
+	if err != nil {
+		t.Fatalf("resume sync: %v", err)
+	}
+	if !result.Resumed || result.Generation != 1 || result.Files != 2 {
+		t.Fatalf("resume result = %+v", result)
+	}
+	if len(fake.listed) != 1 || fake.listed[0] != "dB" {
+		t.Fatalf("resume listed = %v, want only dB", fake.listed)
+	}
+}
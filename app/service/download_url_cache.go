@@ -0,0 +1,250 @@
+package service
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+
+	"github.com/patrickmn/go-cache"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+)
+
+const (
+	// defaultDownloadURLCacheTTL 未配置 cache_time 且直链不带过期参数时的缓存时间
+	defaultDownloadURLCacheTTL = 30 * time.Minute
+	// downloadURLExpirySafety 提前这么久视为过期，避免把即将失效的直链交给客户端
+	downloadURLExpirySafety = 30 * time.Second
+	// sqliteDownloadURLCleanupInterval 清理过期记录的最小间隔
+	sqliteDownloadURLCleanupInterval = 10 * time.Minute
+)
+
+// DownloadURLCache 直链缓存后端。Get 未命中时返回 ok=false；ttl <= 0 的 Set 不写入。
+type DownloadURLCache interface {
+	Backend() string
+	Get(ctx context.Context, key string) (string, bool, error)
+	Set(ctx context.Context, key, link string, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// NewDownloadURLCache 按配置创建直链缓存；redis 连不上时不阻止启动，命令失败会按未命中处理
+func NewDownloadURLCache(settings config.EmbyDownloadURLCacheConfig, log *logger.Logger) (DownloadURLCache, error) {
+	switch strings.ToLower(strings.TrimSpace(settings.Backend)) {
+	case "", config.DownloadURLCacheMemory:
+		return NewMemoryDownloadURLCache(), nil
+	case config.DownloadURLCacheSQLite:
+		if database.DB == nil {
+			return nil, errors.New("数据库未初始化")
+		}
+		return NewSQLiteDownloadURLCache(database.DB), nil
+	case config.DownloadURLCacheRedis:
+		options := settings.Redis
+		client := redis.NewClient(&redis.Options{Addr: strings.TrimSpace(options.Addr), Password: options.Password, DB: options.DB})
+		ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+		defer cancel()
+		if err := client.Ping(ctx).Err(); err != nil && log != nil {
+			log.Warnf("[EMBY PROXY] 直链缓存 redis %s 暂不可用: %v", options.Addr, err)
+		}
+		return NewRedisDownloadURLCache(client, options.KeyPrefix), nil
+	}
+	return nil, fmt.Errorf("不支持的直链缓存后端: %s", settings.Backend)
+}
+
+// DownloadURLCacheKey 直链缓存 key：同一存储、同一文件(pickcode 或路径)、同一 User-Agent 共享直链。
+// mode 区分访问方式(如 115 的 open / web，或按路径访问的 path)，不同方式拿到的直链不能混用。
+func DownloadURLCacheKey(storageID uint, mode, target, userAgent string) string {
+	sum := md5.Sum([]byte(fmt.Sprintf("%d:%s:%s:%s", storageID, mode, target, userAgent)))
+	return "download-url:" + hex.EncodeToString(sum[:])
+}
+
+// DownloadURLTTL 计算直链的缓存时间：取 maxTTL 与直链自身剩余有效期(减去安全余量)中较小者。
+// maxTTL <= 0 时使用默认 30 分钟；直链已过期或即将过期时返回 0，表示不缓存。
+func DownloadURLTTL(rawURL string, maxTTL time.Duration, now time.Time) time.Duration {
+	if maxTTL <= 0 {
+		maxTTL = defaultDownloadURLCacheTTL
+	}
+	expiresAt, ok := DownloadURLExpiry(rawURL)
+	if !ok {
+		return maxTTL
+	}
+	until := expiresAt.Sub(now) - downloadURLExpirySafety
+	if until <= 0 {
+		return 0
+	}
+	if until < maxTTL {
+		return until
+	}
+	return maxTTL
+}
+
+// DownloadURLExpiry 从直链查询参数中解析过期时间，支持：
+//   - 115 的 t=<unix 秒>
+//   - 阿里云 OSS / CloudFront 等的 Expires=<unix 秒>(不区分大小写)
+//   - S3 预签名的 X-Amz-Date + X-Amz-Expires
+func DownloadURLExpiry(rawURL string) (time.Time, bool) {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return time.Time{}, false
+	}
+	query := parsed.Query()
+	if unix, ok := parseUnixSeconds(query.Get("t")); ok {
+		return unix, true
+	}
+	for key, values := range query {
+		if strings.EqualFold(key, "expires") && len(values) > 0 {
+			if unix, ok := parseUnixSeconds(values[0]); ok {
+				return unix, true
+			}
+		}
+	}
+	if date, expires := query.Get("X-Amz-Date"), query.Get("X-Amz-Expires"); date != "" && expires != "" {
+		signedAt, err := time.Parse("20060102T150405Z", date)
+		seconds, convErr := strconv.ParseInt(expires, 10, 64)
+		if err == nil && convErr == nil && seconds > 0 {
+			return signedAt.Add(time.Duration(seconds) * time.Second), true
+		}
+	}
+	return time.Time{}, false
+}
+
+// parseUnixSeconds 只接受看起来像秒级时间戳的值(2001 年之后)，避免把其他含义的 t 参数当成过期时间
+func parseUnixSeconds(raw string) (time.Time, bool) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, false
+	}
+	value, err := strconv.ParseInt(raw, 10, 64)
+	if err != nil || value < 1_000_000_000 || value > 100_000_000_000 {
+		return time.Time{}, false
+	}
+	return time.Unix(value, 0), true
+}
+
+// memoryDownloadURLCache 进程内缓存，重启后失效
+type memoryDownloadURLCache struct {
+	items *cache.Cache
+}
+
+func NewMemoryDownloadURLCache() DownloadURLCache {
+	return &memoryDownloadURLCache{items: cache.New(defaultDownloadURLCacheTTL, 10*time.Minute)}
+}
+
+func (c *memoryDownloadURLCache) Backend() string { return config.DownloadURLCacheMemory }
+
+func (c *memoryDownloadURLCache) Get(_ context.Context, key string) (string, bool, error) {
+	if v, ok := c.items.Get(key); ok {
+		if link, ok := v.(string); ok && link != "" {
+			return link, true, nil
+		}
+	}
+	return "", false, nil
+}
+
+func (c *memoryDownloadURLCache) Set(_ context.Context, key, link string, ttl time.Duration) error {
+	if ttl > 0 && link != "" {
+		c.items.Set(key, link, ttl)
+	}
+	return nil
+}
+
+func (c *memoryDownloadURLCache) Delete(_ context.Context, key string) error {
+	c.items.Delete(key)
+	return nil
+}
+
+// sqliteDownloadURLCache 写入 download_url_caches 表，重启后仍可命中；过期记录在写入时顺带清理
+type sqliteDownloadURLCache struct {
+	db  *gorm.DB
+	now func() time.Time
+
+	mu          sync.Mutex
+	lastCleanup time.Time
+}
+
+func NewSQLiteDownloadURLCache(db *gorm.DB) DownloadURLCache {
+	return &sqliteDownloadURLCache{db: db, now: time.Now}
+}
+
+func (c *sqliteDownloadURLCache) Backend() string { return config.DownloadURLCacheSQLite }
+
+func (c *sqliteDownloadURLCache) Get(ctx context.Context, key string) (string, bool, error) {
+	var row model.DownloadURLCache
+	err := c.db.WithContext(ctx).Where("cache_key = ? AND expires_at > ?", key, c.now()).First(&row).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return row.URL, row.URL != "", nil
+}
+
+func (c *sqliteDownloadURLCache) Set(ctx context.Context, key, link string, ttl time.Duration) error {
+	if ttl <= 0 || link == "" {
+		return nil
+	}
+	now := c.now()
+	if err := model.UpsertDownloadURLCache(c.db.WithContext(ctx), key, link, now.Add(ttl)); err != nil {
+		return err
+	}
+	c.mu.Lock()
+	due := now.Sub(c.lastCleanup) >= sqliteDownloadURLCleanupInterval
+	if due {
+		c.lastCleanup = now
+	}
+	c.mu.Unlock()
+	if due {
+		return c.db.WithContext(ctx).Where("expires_at <= ?", now).Delete(&model.DownloadURLCache{}).Error
+	}
+	return nil
+}
+
+func (c *sqliteDownloadURLCache) Delete(ctx context.Context, key string) error {
+	return c.db.WithContext(ctx).Where("cache_key = ?", key).Delete(&model.DownloadURLCache{}).Error
+}
+
+// redisDownloadURLCache 使用 Redis 兼容服务，过期交给服务端 PX 处理，多个实例可共享
+type redisDownloadURLCache struct {
+	client redis.UniversalClient
+	prefix string
+}
+
+func NewRedisDownloadURLCache(client redis.UniversalClient, prefix string) DownloadURLCache {
+	return &redisDownloadURLCache{client: client, prefix: prefix}
+}
+
+func (c *redisDownloadURLCache) Backend() string { return config.DownloadURLCacheRedis }
+
+func (c *redisDownloadURLCache) Get(ctx context.Context, key string) (string, bool, error) {
+	link, err := c.client.Get(ctx, c.prefix+key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return link, link != "", nil
+}
+
+func (c *redisDownloadURLCache) Set(ctx context.Context, key, link string, ttl time.Duration) error {
+	if ttl <= 0 || link == "" {
+		return nil
+	}
+	return c.client.Set(ctx, c.prefix+key, link, ttl).Err()
+}
+
+func (c *redisDownloadURLCache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, c.prefix+key).Err()
+}
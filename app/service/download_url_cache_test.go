@@ -0,0 +1,154 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"film-fusion/app/model"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+)
+
+func TestDownloadURLTTL(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	maxTTL := 30 * time.Minute
+	cases := []struct {
+		name string
+		url  string
+		want time.Duration
+	}{
+		{"无过期参数", "https://cdn.example.com/a.mkv", maxTTL},
+		{"115 t 参数", fmt.Sprintf("https://cdnfhnfile.115.com/a.mkv?t=%d&u=1", now.Add(10*time.Minute).Unix()), 10*time.Minute - downloadURLExpirySafety},
+		{"t 晚于上限", fmt.Sprintf("https://cdn.example.com/a.mkv?t=%d", now.Add(2*time.Hour).Unix()), maxTTL},
+		{"Expires 不区分大小写", fmt.Sprintf("https://oss.example.com/a.mkv?expires=%d&Signature=x", now.Add(5*time.Minute).Unix()), 5*time.Minute - downloadURLExpirySafety},
+		{"S3 预签名", "https://s3.example.com/a.mkv?X-Amz-Date=20231114T221320Z&X-Amz-Expires=600", 10*time.Minute - downloadURLExpirySafety},
+		{"即将过期不缓存", fmt.Sprintf("https://cdn.example.com/a.mkv?t=%d", now.Add(20*time.Second).Unix()), 0},
+		{"已过期不缓存", fmt.Sprintf("https://cdn.example.com/a.mkv?t=%d", now.Add(-time.Minute).Unix()), 0},
+		{"t 不是时间戳", "https://cdn.example.com/a.mkv?t=3", maxTTL},
+	}
+	for _, tc := range cases {
+		if got := DownloadURLTTL(tc.url, maxTTL, now); got != tc.want {
+			t.Fatalf("%s: DownloadURLTTL = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+	if got := DownloadURLTTL("https://cdn.example.com/a.mkv", 0, now); got != defaultDownloadURLCacheTTL {
+		t.Fatalf("default ttl = %v, want %v", got, defaultDownloadURLCacheTTL)
+	}
+}
+
+func TestDownloadURLCacheKeyDistinguishesInputs(t *testing.T) {
+	base := DownloadURLCacheKey(1, "open", "pc1", "Infuse")
+	if base != DownloadURLCacheKey(1, "open", "pc1", "Infuse") {
+		t.Fatal("cache key should be stable")
+	}
+	for _, other := range []string{
+		DownloadURLCacheKey(2, "open", "pc1", "Infuse"),
+		DownloadURLCacheKey(1, "web", "pc1", "Infuse"),
+		DownloadURLCacheKey(1, "open", "pc2", "Infuse"),
+		DownloadURLCacheKey(1, "open", "pc1", "VLC"),
+	} {
+		if other == base {
+			t.Fatalf("cache key collision: %s", other)
+		}
+	}
+}
+
+func TestMemoryDownloadURLCache(t *testing.T) {
+	ctx := context.Background()
+	c := NewMemoryDownloadURLCache()
+	if err := c.Set(ctx, "k", "https://a", 0); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if _, found, _ := c.Get(ctx, "k"); found {
+		t.Fatal("ttl <= 0 should not be cached")
+	}
+	_ = c.Set(ctx, "k", "https://a", time.Minute)
+	if link, found, _ := c.Get(ctx, "k"); !found || link != "https://a" {
+		t.Fatalf("Get = %q, %v", link, found)
+	}
+	_ = c.Delete(ctx, "k")
+	if _, found, _ := c.Get(ctx, "k"); found {
+		t.Fatal("Delete should remove the entry")
+	}
+}
+
+func TestSQLiteDownloadURLCacheSurvivesRestart(t *testing.T) {
+	ctx := context.Background()
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "url_cache.db")), &gorm.Config{})
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.DownloadURLCache{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	now := time.Unix(1_700_000_000, 0)
+
+	first := NewSQLiteDownloadURLCache(db).(*sqliteDownloadURLCache)
+	first.now = func() time.Time { return now }
+	if err := first.Set(ctx, "k", "https://a?v=1", time.Minute); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if err := first.Set(ctx, "k", "https://a?v=2", time.Minute); err != nil {
+		t.Fatalf("Set overwrite: %v", err)
+	}
+
+	// 新实例(相当于重启后)仍能读到未过期的直链
+	second := NewSQLiteDownloadURLCache(db).(*sqliteDownloadURLCache)
+	second.now = func() time.Time { return now.Add(30 * time.Second) }
+	link, found, err := second.Get(ctx, "k")
+	if err != nil || !found || link != "https://a?v=2" {
+		t.Fatalf("Get after restart = %q, %v, %v", link, found, err)
+	}
+
+	second.now = func() time.Time { return now.Add(2 * time.Minute) }
+	if _, found, _ := second.Get(ctx, "k"); found {
+		t.Fatal("expired entry should miss")
+	}
+	// 写入时顺带清理过期记录
+	if err := second.Set(ctx, "other", "https://b", time.Minute); err != nil {
+		t.Fatalf("Set other: %v", err)
+	}
+	var count int64
+	db.Model(&model.DownloadURLCache{}).Count(&count)
+	if count != 1 {
+		t.Fatalf("rows after cleanup = %d, want 1", count)
+	}
+}
+
+func TestRedisDownloadURLCache(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	server.RequireAuth("secret")
+	client := redis.NewClient(&redis.Options{Addr: server.Addr(), Password: "secret"})
+	t.Cleanup(func() { _ = client.Close() })
+
+	c := NewRedisDownloadURLCache(client, "ff:")
+	if _, found, err := c.Get(ctx, "k"); err != nil || found {
+		t.Fatalf("empty Get = %v, %v", found, err)
+	}
+	if err := c.Set(ctx, "k", "https://a", 90*time.Second); err != nil {
+		t.Fatalf("Set: %v", err)
+	}
+	if ttl := server.TTL("ff:k"); ttl <= 80*time.Second || ttl > 90*time.Second {
+		t.Fatalf("server ttl = %v", ttl)
+	}
+	// 另一个客户端(如另一实例)共享同一份缓存
+	otherClient := redis.NewClient(&redis.Options{Addr: server.Addr(), Password: "secret"})
+	t.Cleanup(func() { _ = otherClient.Close() })
+	other := NewRedisDownloadURLCache(otherClient, "ff:")
+	if link, found, err := other.Get(ctx, "k"); err != nil || !found || link != "https://a" {
+		t.Fatalf("shared Get = %q, %v, %v", link, found, err)
+	}
+	if err := c.Delete(ctx, "k"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, found, _ := other.Get(ctx, "k"); found {
+		t.Fatal("Delete should remove the entry")
+	}
+}
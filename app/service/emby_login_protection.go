@@ -226,12 +226,14 @@ func (p *EmbyLoginProtection) recordFailure(attempt *EmbyLoginAttempt) {
 	if len(pair.failures) >= settings.MaxFailuresPerAccountIP && !pair.blockedUntil.After(now) {
 		pair.blockedUntil = blockedUntil
 		p.appendEventLocked(now, "blocked", attempt, "account_ip")
+		loginBlocksMetric.Inc(p.alertSource, "account_ip")
 		p.logBlocked(attempt, "account_ip", blockedUntil)
 		p.notifyBlocked(attempt, "account_ip", len(pair.failures), blockedUntil, now)
 	}
 	if len(ip.failures) >= settings.MaxFailuresPerIP && !ip.blockedUntil.After(now) {
 		ip.blockedUntil = blockedUntil
 		p.appendEventLocked(now, "blocked", attempt, "ip")
+		loginBlocksMetric.Inc(p.alertSource, "ip")
 		p.logBlocked(attempt, "ip", blockedUntil)
 		p.notifyBlocked(attempt, "ip", len(ip.failures), blockedUntil, now)
 	}
@@ -407,8 +409,14 @@ func (p *EmbyLoginProtection) settings() config.LoginSecurityConfig {
 }
 
 func (p *EmbyLoginProtection) clientIP(req *http.Request) string {
+	return EmbyClientIP(req, p.settings().TrustedProxyCIDRs)
+}
+
+// EmbyClientIP 返回请求的客户端 IP：仅当 TCP 来源属于 trustedProxyCIDRs 时才解析 X-Forwarded-For/X-Real-IP，
+// 否则直接使用来源地址，避免客户端伪造转发头绕过按 IP 判定的规则。
+func EmbyClientIP(req *http.Request, trustedProxyCIDRs []string) string {
 	remoteIP := remoteAddressIP(req.RemoteAddr)
-	if remoteIP == "" || !ipInCIDRs(remoteIP, p.settings().TrustedProxyCIDRs) {
+	if remoteIP == "" || !ipInCIDRs(remoteIP, trustedProxyCIDRs) {
 		return remoteIP
 	}
 	candidates := make([]string, 0, 4)
@@ -424,7 +432,7 @@ func (p *EmbyLoginProtection) clientIP(req *http.Request) string {
 		return remoteIP
 	}
 	for i := len(candidates) - 1; i >= 0; i-- {
-		if !ipInCIDRs(candidates[i], p.settings().TrustedProxyCIDRs) {
+		if !ipInCIDRs(candidates[i], trustedProxyCIDRs) {
 			return candidates[i]
 		}
 	}
@@ -0,0 +1,251 @@
+package service
+
+import (
+	"net/http"
+	"net/netip"
+	"path"
+	"regexp"
+	"strings"
+	"sync"
+
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/embyhelper"
+)
+
+// embyDeviceRegex 从 X-Emby-Authorization / Authorization 头里提取 Device="xxx"
+var embyDeviceRegex = regexp.MustCompile(`(?i)\bDevice="([^"]*)"`)
+
+// EmbyDeviceNameFromRequest 取 Emby 设备名称：X-Emby-Device-Name 头、Authorization 中的 Device 字段或同名查询参数
+func EmbyDeviceNameFromRequest(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get("X-Emby-Device-Name")); v != "" {
+		return v
+	}
+	for _, header := range []string{"X-Emby-Authorization", "Authorization"} {
+		if m := embyDeviceRegex.FindStringSubmatch(r.Header.Get(header)); len(m) == 2 {
+			if v := strings.TrimSpace(m[1]); v != "" {
+				return v
+			}
+		}
+	}
+	return strings.TrimSpace(r.URL.Query().Get("X-Emby-Device-Name"))
+}
+
+// EmbyPlaybackRouteInput 一次播放请求的路由条件。
+// EmbyUserID 与 Library 需要访问 Emby，只有规则用到对应条件时才会调用。
+// ItemUnknown 表示拿不到媒体信息（Emby 条目查询失败）：此时大小与媒体库条件无法判断，
+// 拒绝规则按命中处理以免失效放行，其余规则按不满足处理。
+type EmbyPlaybackRouteInput struct {
+	ClientIP    string
+	UserAgent   string
+	Client      string
+	DeviceName  string
+	Size        int64
+	ItemUnknown bool
+	EmbyUserID  func() string
+	Library     func() (id, name string)
+}
+
+// EmbyPlaybackRouter 按优先级评估播放路由规则
+type EmbyPlaybackRouter struct {
+	logger *logger.Logger
+
+	mu      sync.Mutex
+	regexps map[string]*regexp.Regexp
+}
+
+func NewEmbyPlaybackRouter(log *logger.Logger) *EmbyPlaybackRouter {
+	return &EmbyPlaybackRouter{logger: log, regexps: make(map[string]*regexp.Regexp)}
+}
+
+// EnabledRoutes 返回启用的规则，按优先级、ID 升序
+func (r *EmbyPlaybackRouter) EnabledRoutes() ([]model.EmbyPlaybackRoute, error) {
+	var routes []model.EmbyPlaybackRoute
+	err := database.DB.Where("enabled = ?", true).Order("priority ASC, id ASC").Find(&routes).Error
+	return routes, err
+}
+
+// Route 返回首个命中的规则；没有启用的规则或都未命中时返回 nil，调用方按默认流程处理
+func (r *EmbyPlaybackRouter) Route(in EmbyPlaybackRouteInput) (*model.EmbyPlaybackRoute, error) {
+	routes, err := r.EnabledRoutes()
+	if err != nil || len(routes) == 0 {
+		return nil, err
+	}
+	return r.Match(routes, in), nil
+}
+
+// Match 在给定规则中按顺序查找首个命中的规则
+func (r *EmbyPlaybackRouter) Match(routes []model.EmbyPlaybackRoute, in EmbyPlaybackRouteInput) *model.EmbyPlaybackRoute {
+	// 用户与媒体库只解析一次，多条规则共用
+	var userID, libraryID, libraryName string
+	var userResolved, libraryResolved bool
+	for i := range routes {
+		route := &routes[i]
+		if !route.Enabled || !r.matchRequest(route, in) {
+			continue
+		}
+		if users := model.SplitEmbyPlaybackRouteList(route.EmbyUserIDs); len(users) > 0 {
+			if !userResolved {
+				userResolved = true
+				if in.EmbyUserID != nil {
+					userID = in.EmbyUserID()
+				}
+			}
+			if !containsFold(users, userID) {
+				continue
+			}
+		}
+		if libraries := model.SplitEmbyPlaybackRouteList(route.Libraries); len(libraries) > 0 {
+			if in.ItemUnknown {
+				if route.Action != model.EmbyPlaybackRouteActionDeny {
+					continue
+				}
+				return route
+			}
+			if !libraryResolved {
+				libraryResolved = true
+				if in.Library != nil {
+					libraryID, libraryName = in.Library()
+				}
+			}
+			if !containsFold(libraries, libraryID) && !containsFold(libraries, libraryName) {
+				continue
+			}
+		}
+		return route
+	}
+	return nil
+}
+
+// matchRequest 校验不需要访问 Emby 的条件：网络、IP、User-Agent、客户端、设备与文件大小
+func (r *EmbyPlaybackRouter) matchRequest(route *model.EmbyPlaybackRoute, in EmbyPlaybackRouteInput) bool {
+	addr, addrErr := netip.ParseAddr(strings.TrimSpace(in.ClientIP))
+	addr = addr.Unmap()
+	switch strings.ToLower(route.Network) {
+	case model.EmbyPlaybackRouteNetworkLAN:
+		if addrErr != nil || !isLANAddr(addr) {
+			return false
+		}
+	case model.EmbyPlaybackRouteNetworkWAN:
+		if addrErr != nil || isLANAddr(addr) {
+			return false
+		}
+	}
+	if strings.TrimSpace(route.ClientCIDRs) != "" {
+		prefixes, err := model.ParseEmbyPlaybackRoutePrefixes(route.ClientCIDRs)
+		if err != nil || addrErr != nil {
+			return false
+		}
+		matched := false
+		for _, prefix := range prefixes {
+			if prefix.Contains(addr) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if pattern := strings.TrimSpace(route.UserAgent); pattern != "" {
+		re := r.compile(pattern)
+		if re == nil || !re.MatchString(in.UserAgent) {
+			return false
+		}
+	}
+	if clients := model.SplitEmbyPlaybackRouteList(route.Client); len(clients) > 0 && !containsFold(clients, in.Client) {
+		return false
+	}
+	if devices := model.SplitEmbyPlaybackRouteList(route.DeviceName); len(devices) > 0 {
+		device := strings.ToLower(in.DeviceName)
+		matched := false
+		for _, keyword := range devices {
+			if device != "" && strings.Contains(device, strings.ToLower(keyword)) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if route.MinSizeMB > 0 || route.MaxSizeMB > 0 {
+		if in.ItemUnknown {
+			return route.Action == model.EmbyPlaybackRouteActionDeny
+		}
+		// 拿不到文件大小时不满足大小条件
+		if in.Size <= 0 {
+			return false
+		}
+		if route.MinSizeMB > 0 && in.Size < route.MinSizeMB*1024*1024 {
+			return false
+		}
+		if route.MaxSizeMB > 0 && in.Size > route.MaxSizeMB*1024*1024 {
+			return false
+		}
+	}
+	return true
+}
+
+func (r *EmbyPlaybackRouter) compile(pattern string) *regexp.Regexp {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if re, ok := r.regexps[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil && r.logger != nil {
+		r.logger.Warnf("[EMBY ROUTE] 路由规则 User-Agent 正则无效 %q: %v", pattern, err)
+	}
+	r.regexps[pattern] = re
+	return re
+}
+
+// isLANAddr 回环、私有网段与链路本地地址视为局域网
+func isLANAddr(addr netip.Addr) bool {
+	return addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast()
+}
+
+func containsFold(items []string, value string) bool {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return false
+	}
+	for _, item := range items {
+		if strings.EqualFold(item, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// EmbyLibraryForPath 按最长目录前缀找出文件所属的媒体库
+func EmbyLibraryForPath(folders []embyhelper.EmbyVirtualFolder, mediaPath string) (embyhelper.EmbyVirtualFolder, bool) {
+	normalized := normalizeLibraryPath(mediaPath)
+	var best embyhelper.EmbyVirtualFolder
+	bestLen := -1
+	for _, folder := range folders {
+		for _, location := range folder.Locations {
+			loc := normalizeLibraryPath(location)
+			if loc == "" || loc == "/" {
+				continue
+			}
+			if normalized != loc && !strings.HasPrefix(normalized, loc+"/") {
+				continue
+			}
+			if len(loc) > bestLen {
+				best, bestLen = folder, len(loc)
+			}
+		}
+	}
+	return best, bestLen >= 0
+}
+
+func normalizeLibraryPath(p string) string {
+	p = strings.TrimSpace(strings.ReplaceAll(p, "\\", "/"))
+	if p == "" {
+		return ""
+	}
+	return strings.ToLower(path.Clean(p))
+}
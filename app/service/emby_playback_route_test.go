@@ -0,0 +1,106 @@
+package service
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"film-fusion/app/model"
+	"film-fusion/app/utils/embyhelper"
+)
+
+func TestEmbyPlaybackRouterMatch(t *testing.T) {
+	routes := []model.EmbyPlaybackRoute{
+		{ID: 1, Name: "disabled", Enabled: false, Action: model.EmbyPlaybackRouteActionDeny},
+		{ID: 2, Name: "blocked-ip", Enabled: true, ClientCIDRs: "203.0.113.0/24, 198.51.100.7", Action: model.EmbyPlaybackRouteActionDeny},
+		{ID: 3, Name: "lan-nas", Enabled: true, Network: model.EmbyPlaybackRouteNetworkLAN, Libraries: "电影", Action: model.EmbyPlaybackRouteActionEmby},
+		{ID: 4, Name: "tv-stream", Enabled: true, Client: "Emby for Samsung", DeviceName: "客厅", Action: model.EmbyPlaybackRouteActionStream},
+		{ID: 5, Name: "kids-remux", Enabled: true, EmbyUserIDs: "kid", MinSizeMB: 20 * 1024, Action: model.EmbyPlaybackRouteActionDeny},
+		{ID: 6, Name: "wan-vlc", Enabled: true, Network: model.EmbyPlaybackRouteNetworkWAN, UserAgent: "(?i)^vlc/", Action: model.EmbyPlaybackRouteActionRedirect},
+	}
+	router := NewEmbyPlaybackRouter(nil)
+
+	var userCalls, libraryCalls int
+	input := func(ip, ua, client, device, user, library string, sizeMB int64) EmbyPlaybackRouteInput {
+		return EmbyPlaybackRouteInput{
+			ClientIP:   ip,
+			UserAgent:  ua,
+			Client:     client,
+			DeviceName: device,
+			Size:       sizeMB * 1024 * 1024,
+			EmbyUserID: func() string { userCalls++; return user },
+			Library:    func() (string, string) { libraryCalls++; return "lib-" + library, library },
+		}
+	}
+	unknownItem := func(in EmbyPlaybackRouteInput) EmbyPlaybackRouteInput {
+		in.ItemUnknown = true
+		return in
+	}
+	cases := []struct {
+		name string
+		in   EmbyPlaybackRouteInput
+		want string
+	}{
+		{"cidr deny", input("203.0.113.9", "", "", "", "", "", 0), "blocked-ip"},
+		{"single ip deny", input("198.51.100.7", "", "", "", "", "", 0), "blocked-ip"},
+		{"lan movie plays from emby", input("192.168.1.20", "", "", "", "", "电影", 0), "lan-nas"},
+		{"lan other library falls through", input("192.168.1.20", "", "", "", "", "剧集", 0), ""},
+		{"tv client and device", input("8.8.8.8", "", "emby for samsung", "客厅电视", "", "", 0), "tv-stream"},
+		{"tv client other device", input("8.8.8.8", "", "Emby for Samsung", "卧室", "", "", 0), ""},
+		{"large file for user", input("8.8.8.8", "", "", "", "kid", "", 30*1024), "kids-remux"},
+		{"small file for user", input("8.8.8.8", "", "", "", "kid", "", 1024), ""},
+		{"unknown size ignores size rule", input("8.8.8.8", "", "", "", "kid", "", 0), ""},
+		{"wan ua", input("8.8.8.8", "VLC/3.0.20", "", "", "", "", 0), "wan-vlc"},
+		{"lan ua is not wan", input("10.0.0.3", "VLC/3.0.20", "", "", "", "", 0), ""},
+		{"unknown item keeps size deny", unknownItem(input("8.8.8.8", "", "", "", "kid", "", 0)), "kids-remux"},
+		{"unknown item skips library route", unknownItem(input("192.168.1.20", "", "", "", "", "电影", 0)), ""},
+	}
+	for _, tc := range cases {
+		got := router.Match(routes, tc.in)
+		name := ""
+		if got != nil {
+			name = got.Name
+		}
+		if name != tc.want {
+			t.Fatalf("%s: matched %q, want %q", tc.name, name, tc.want)
+		}
+	}
+
+	// 用户与媒体库只在规则用到时解析，且每次评估最多解析一次
+	userCalls, libraryCalls = 0, 0
+	router.Match(routes, input("203.0.113.9", "", "", "", "", "", 0))
+	if userCalls != 0 || libraryCalls != 0 {
+		t.Fatalf("early match should not resolve user/library, got %d/%d", userCalls, libraryCalls)
+	}
+	router.Match(append(routes, model.EmbyPlaybackRoute{Name: "another-user", Enabled: true, EmbyUserIDs: "other"}), input("8.8.8.8", "", "", "", "kid", "", 1))
+	if userCalls != 1 {
+		t.Fatalf("user should be resolved once, got %d", userCalls)
+	}
+}
+
+func TestEmbyLibraryForPath(t *testing.T) {
+	folders := []embyhelper.EmbyVirtualFolder{
+		{ItemID: "1", Name: "影视", Locations: []string{"/media"}},
+		{ItemID: "2", Name: "电影", Locations: []string{"/media/movies", `D:\Movies`}},
+	}
+	cases := map[string]string{
+		"/media/movies/a/a.mkv": "电影",
+		`d:\movies\b.mkv`:       "电影",
+		"/media/tv/s01e01.mkv":  "影视",
+		"/media-other/x.mkv":    "",
+	}
+	for mediaPath, want := range cases {
+		folder, ok := EmbyLibraryForPath(folders, mediaPath)
+		if got := folder.Name; ok != (want != "") || got != want {
+			t.Fatalf("EmbyLibraryForPath(%q) = %q/%v, want %q", mediaPath, got, ok, want)
+		}
+	}
+}
+
+func TestEmbyDeviceNameFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil)
+	req.Header.Set("X-Emby-Authorization", `MediaBrowser Client="Emby for LG", Device="Living Room", DeviceId="x", Token="abc"`)
+	if got := EmbyDeviceNameFromRequest(req); got != "Living Room" {
+		t.Fatalf("device = %q", got)
+	}
+}
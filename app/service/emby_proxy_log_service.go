@@ -0,0 +1,310 @@
+package service
+
+import (
+	"context"
+	"encoding/csv"
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyproxylog"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	embyProxyLogQueueSize     = 1024
+	embyProxyLogBatchSize     = 100
+	embyProxyLogFlushInterval = time.Second
+	embyProxyLogCleanInterval = time.Hour
+	embyProxyLogExportBatch   = 500
+)
+
+// EmbyProxyLogFilter 302 播放记录查询条件，零值字段不参与过滤
+type EmbyProxyLogFilter struct {
+	EmbyUserID     string
+	ItemID         string
+	StorageID      uint // 匹配分配或实际播放的存储
+	Source         string
+	BalanceStatus  string
+	FallbackReason string // 模糊匹配
+	Start          time.Time
+	End            time.Time
+}
+
+func (f EmbyProxyLogFilter) apply(q *gorm.DB) *gorm.DB {
+	if f.EmbyUserID != "" {
+		q = q.Where("emby_user_id = ?", f.EmbyUserID)
+	}
+	if f.ItemID != "" {
+		q = q.Where("item_id = ?", f.ItemID)
+	}
+	if f.StorageID != 0 {
+		q = q.Where("actual_storage_id = ? OR assigned_storage_id = ?", f.StorageID, f.StorageID)
+	}
+	if f.Source != "" {
+		q = q.Where("source = ?", f.Source)
+	}
+	if f.BalanceStatus != "" {
+		q = q.Where("balance_status = ?", f.BalanceStatus)
+	}
+	if f.FallbackReason != "" {
+		q = q.Where("fallback_reason LIKE ?", "%"+f.FallbackReason+"%")
+	}
+	if !f.Start.IsZero() {
+		q = q.Where("timestamp >= ?", f.Start)
+	}
+	if !f.End.IsZero() {
+		q = q.Where("timestamp <= ?", f.End)
+	}
+	return q
+}
+
+// EmbyProxyLogService 将 302 / 回退播放记录异步批量写入数据库，并按配置的保留策略清理。
+// 内存环形缓冲 embyproxylog.Default() 仍用于实时状态页，这里负责可追溯的历史。
+type EmbyProxyLogService struct {
+	cfg     *config.Config
+	logger  *logger.Logger
+	entries chan embyproxylog.Entry
+	dropped atomic.Int64
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewEmbyProxyLogService 创建 302 播放记录持久化服务
+func NewEmbyProxyLogService(cfg *config.Config, log *logger.Logger) *EmbyProxyLogService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &EmbyProxyLogService{
+		cfg:     cfg,
+		logger:  log,
+		entries: make(chan embyproxylog.Entry, embyProxyLogQueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Record 提交一条记录；队列已满时丢弃，不阻塞播放请求
+func (s *EmbyProxyLogService) Record(entry embyproxylog.Entry) {
+	if s == nil {
+		return
+	}
+	select {
+	case s.entries <- entry:
+	default:
+		if s.dropped.Add(1)%100 == 1 {
+			s.logger.Warnf("302 播放记录写入队列已满，已丢弃 %d 条", s.dropped.Load())
+		}
+	}
+}
+
+// Start 启动批量写入与定时清理
+func (s *EmbyProxyLogService) Start() {
+	s.wg.Add(2)
+	go func() {
+		defer s.wg.Done()
+		s.writeLoop()
+	}()
+	go func() {
+		defer s.wg.Done()
+		select {
+		case <-time.After(time.Minute):
+		case <-s.ctx.Done():
+			return
+		}
+		s.Cleanup()
+		ticker := time.NewTicker(embyProxyLogCleanInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.Cleanup()
+			}
+		}
+	}()
+}
+
+// Stop 停止服务，退出前写入队列中剩余的记录
+func (s *EmbyProxyLogService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+func (s *EmbyProxyLogService) writeLoop() {
+	batch := make([]model.EmbyProxyLog, 0, embyProxyLogBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := database.DB.CreateInBatches(batch, embyProxyLogBatchSize).Error; err != nil {
+			s.logger.Warnf("写入 302 播放记录失败(%d 条): %v", len(batch), err)
+		}
+		batch = batch[:0]
+	}
+	ticker := time.NewTicker(embyProxyLogFlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case entry := <-s.entries:
+			batch = append(batch, embyProxyLogFromEntry(entry))
+			if len(batch) >= embyProxyLogBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-s.ctx.Done():
+			for {
+				select {
+				case entry := <-s.entries:
+					batch = append(batch, embyProxyLogFromEntry(entry))
+				default:
+					flush()
+					return
+				}
+			}
+		}
+	}
+}
+
+func embyProxyLogFromEntry(e embyproxylog.Entry) model.EmbyProxyLog {
+	if e.Timestamp.IsZero() {
+		e.Timestamp = time.Now()
+	}
+	var attempts []model.EmbyProxyLogAttempt
+	for _, a := range e.Attempts {
+		attempts = append(attempts, model.EmbyProxyLogAttempt(a))
+	}
+	return model.EmbyProxyLog{
+		Timestamp:           e.Timestamp,
+		Source:              e.Source,
+		Method:              e.Method,
+		URI:                 e.URI,
+		UserAgent:           e.UserAgent,
+		RemoteIP:            e.RemoteIP,
+		Target:              e.Target,
+		ItemID:              e.ItemID,
+		MediaSourceID:       e.MediaSourceID,
+		MediaPath:           e.MediaPath,
+		Match302ID:          e.Match302ID,
+		AssignmentID:        e.AssignmentID,
+		AssignedStorageID:   e.AssignedStorageID,
+		AssignedStorageName: e.AssignedStorageName,
+		ActualStorageID:     e.ActualStorageID,
+		ActualStorageName:   e.ActualStorageName,
+		AccountType:         e.AccountType,
+		BalanceStatus:       e.BalanceStatus,
+		FallbackReason:      e.FallbackReason,
+		EmbyUserID:          e.EmbyUserID,
+		EmbyUserName:        e.EmbyUserName,
+		Attempts:            attempts,
+	}
+}
+
+// Cleanup 按保留天数与最大条数删除旧记录
+func (s *EmbyProxyLogService) Cleanup() {
+	settings := s.cfg.Emby.ProxyLog
+	var deleted int64
+	if settings.RetentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -settings.RetentionDays)
+		res := database.DB.Where("timestamp < ?", cutoff).Delete(&model.EmbyProxyLog{})
+		if res.Error != nil {
+			s.logger.Warnf("清理过期 302 播放记录失败: %v", res.Error)
+		}
+		deleted += res.RowsAffected
+	}
+	if settings.MaxRows > 0 {
+		var boundary model.EmbyProxyLog
+		err := database.DB.Select("id").Order("id DESC").Offset(settings.MaxRows).Limit(1).Take(&boundary).Error
+		if err == nil {
+			res := database.DB.Where("id <= ?", boundary.ID).Delete(&model.EmbyProxyLog{})
+			if res.Error != nil {
+				s.logger.Warnf("清理超量 302 播放记录失败: %v", res.Error)
+			}
+			deleted += res.RowsAffected
+		}
+	}
+	if deleted > 0 {
+		s.logger.Infof("清理 302 播放记录完成：删除 %d 条", deleted)
+	}
+}
+
+// Query 分页查询，最新在前
+func (s *EmbyProxyLogService) Query(filter EmbyProxyLogFilter, page, size int) ([]model.EmbyProxyLog, int64, error) {
+	q := filter.apply(database.DB.Model(&model.EmbyProxyLog{}))
+	var total int64
+	if err := q.Count(&total).Error; err != nil {
+		return nil, 0, err
+	}
+	list := make([]model.EmbyProxyLog, 0, size)
+	if err := q.Order("id DESC").Offset((page - 1) * size).Limit(size).Find(&list).Error; err != nil {
+		return nil, 0, err
+	}
+	return list, total, nil
+}
+
+// Clear 删除全部持久化记录
+func (s *EmbyProxyLogService) Clear() error {
+	return database.DB.Where("1 = 1").Delete(&model.EmbyProxyLog{}).Error
+}
+
+var embyProxyLogCSVHeader = []string{
+	"id", "timestamp", "source", "emby_user_id", "emby_user_name", "item_id", "media_source_id", "media_path",
+	"match302_id", "assignment_id", "assigned_storage_id", "assigned_storage_name", "actual_storage_id", "actual_storage_name",
+	"account_type", "balance_status", "fallback_reason", "method", "uri", "remote_ip", "user_agent", "target",
+}
+
+// ExportCSV 按过滤条件分批导出为 CSV(按时间正序)
+func (s *EmbyProxyLogService) ExportCSV(w io.Writer, filter EmbyProxyLogFilter) error {
+	writer := csv.NewWriter(w)
+	if err := writer.Write(embyProxyLogCSVHeader); err != nil {
+		return err
+	}
+	uintText := func(v uint) string {
+		if v == 0 {
+			return ""
+		}
+		return strconv.FormatUint(uint64(v), 10)
+	}
+	var rows []model.EmbyProxyLog
+	err := filter.apply(database.DB.Model(&model.EmbyProxyLog{})).FindInBatches(&rows, embyProxyLogExportBatch, func(_ *gorm.DB, _ int) error {
+		for _, row := range rows {
+			record := []string{
+				strconv.FormatUint(uint64(row.ID), 10), row.Timestamp.Format(time.RFC3339), row.Source,
+				row.EmbyUserID, row.EmbyUserName, row.ItemID, row.MediaSourceID, row.MediaPath,
+				uintText(row.Match302ID), uintText(row.AssignmentID), uintText(row.AssignedStorageID), row.AssignedStorageName,
+				uintText(row.ActualStorageID), row.ActualStorageName, row.AccountType, row.BalanceStatus, row.FallbackReason,
+				row.Method, row.URI, row.RemoteIP, row.UserAgent, row.Target,
+			}
+			for i, value := range record {
+				record[i] = csvSafeCell(value)
+			}
+			if err := writer.Write(record); err != nil {
+				return err
+			}
+		}
+		writer.Flush()
+		return writer.Error()
+	}).Error
+	if err != nil {
+		return err
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvSafeCell 防止 URI、UA 等外部可控内容在表格软件中被当作公式执行
+func csvSafeCell(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
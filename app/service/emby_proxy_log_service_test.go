@@ -0,0 +1,126 @@
+package service
+
+import (
+	"bytes"
+	"encoding/csv"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyproxylog"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func setupEmbyProxyLogTest(t *testing.T, settings config.EmbyProxyLogConfig) (*EmbyProxyLogService, *gorm.DB) {
+	t.Helper()
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "emby-proxy-log.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.EmbyProxyLog{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() { database.DB = oldDB })
+
+	cfg := &config.Config{}
+	cfg.Emby.ProxyLog = settings
+	return NewEmbyProxyLogService(cfg, logger.New(config.LogConfig{Level: "error", Output: "stdout"})), db
+}
+
+func TestEmbyProxyLogServiceRecordAndQuery(t *testing.T) {
+	svc, _ := setupEmbyProxyLogTest(t, config.EmbyProxyLogConfig{})
+	svc.Start()
+	now := time.Now()
+	svc.Record(embyproxylog.Entry{Timestamp: now.Add(-2 * time.Hour), Source: "cache", ItemID: "100", EmbyUserID: "u1",
+		AssignedStorageID: 1, ActualStorageID: 2, BalanceStatus: "ready"})
+	svc.Record(embyproxylog.Entry{Timestamp: now.Add(-time.Hour), Source: "fallback", ItemID: "100", EmbyUserID: "u2",
+		FallbackReason: "未命中 match302 / 缓存，走默认反代"})
+	svc.Record(embyproxylog.Entry{Timestamp: now, Source: "proxyPlay", ItemID: "200", EmbyUserID: "u1",
+		ActualStorageID: 3, BalanceStatus: "fallback", URI: "=cmd|' /C calc'!A0"})
+	svc.Stop() // Stop 会写入队列中剩余的记录
+
+	cases := []struct {
+		name   string
+		filter EmbyProxyLogFilter
+		want   int64
+	}{
+		{"all", EmbyProxyLogFilter{}, 3},
+		{"user", EmbyProxyLogFilter{EmbyUserID: "u1"}, 2},
+		{"item", EmbyProxyLogFilter{ItemID: "100"}, 2},
+		{"assigned storage", EmbyProxyLogFilter{StorageID: 1}, 1},
+		{"actual storage", EmbyProxyLogFilter{StorageID: 3}, 1},
+		{"balance status", EmbyProxyLogFilter{BalanceStatus: "fallback"}, 1},
+		{"fallback reason", EmbyProxyLogFilter{FallbackReason: "match302"}, 1},
+		{"time range", EmbyProxyLogFilter{Start: now.Add(-90 * time.Minute), End: now.Add(-30 * time.Minute)}, 1},
+	}
+	for _, tc := range cases {
+		list, total, err := svc.Query(tc.filter, 1, 10)
+		if err != nil {
+			t.Fatalf("%s: query: %v", tc.name, err)
+		}
+		if total != tc.want || int64(len(list)) != tc.want {
+			t.Fatalf("%s: total=%d len=%d, want %d", tc.name, total, len(list), tc.want)
+		}
+	}
+
+	list, _, _ := svc.Query(EmbyProxyLogFilter{}, 1, 1)
+	if len(list) != 1 || list[0].ItemID != "200" {
+		t.Fatalf("latest entry should come first, got %+v", list)
+	}
+
+	var buf bytes.Buffer
+	if err := svc.ExportCSV(&buf, EmbyProxyLogFilter{EmbyUserID: "u1"}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	if len(records) != 3 || records[0][0] != "id" {
+		t.Fatalf("csv records = %v", records)
+	}
+	uriCol := -1
+	for i, name := range records[0] {
+		if name == "uri" {
+			uriCol = i
+		}
+	}
+	if got := records[2][uriCol]; got != "'=cmd|' /C calc'!A0" {
+		t.Fatalf("formula cell should be escaped, got %q", got)
+	}
+}
+
+func TestEmbyProxyLogServiceCleanup(t *testing.T) {
+	svc, db := setupEmbyProxyLogTest(t, config.EmbyProxyLogConfig{RetentionDays: 7, MaxRows: 3})
+	now := time.Now()
+	rows := []model.EmbyProxyLog{
+		{Timestamp: now.AddDate(0, 0, -10), Source: "cache"},
+		{Timestamp: now.Add(-5 * time.Hour), Source: "cache"},
+		{Timestamp: now.Add(-4 * time.Hour), Source: "cache"},
+		{Timestamp: now.Add(-3 * time.Hour), Source: "cache"},
+		{Timestamp: now.Add(-2 * time.Hour), Source: "cache"},
+		{Timestamp: now.Add(-1 * time.Hour), Source: "cache"},
+	}
+	if err := db.Create(&rows).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	svc.Cleanup()
+
+	var kept []model.EmbyProxyLog
+	db.Order("id ASC").Find(&kept)
+	if len(kept) != 3 || kept[0].ID != rows[3].ID {
+		t.Fatalf("kept = %+v", kept)
+	}
+}
@@ -0,0 +1,335 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/logger"
+)
+
+// ErrEmbyStreamProxyBusy 中转连接数已达上限
+var ErrEmbyStreamProxyBusy = errors.New("中转播放连接数已达上限")
+
+// embyStreamCopyHeaders 转发给直链的客户端请求头(断点续传与条件请求)
+var embyStreamCopyHeaders = []string{"Range", "If-Range", "If-Modified-Since", "If-None-Match", "Accept"}
+
+// embyStreamResponseHeaders 转发给客户端的直链响应头
+var embyStreamResponseHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Range", "Accept-Ranges",
+	"Last-Modified", "ETag", "Cache-Control", "Content-Disposition",
+}
+
+// embyClientRegex 从 X-Emby-Authorization / Authorization 头里提取 Client="xxx"
+var embyClientRegex = regexp.MustCompile(`(?i)\bClient="([^"]*)"`)
+
+// EmbyStreamTarget 一次中转播放的直链与来源信息
+type EmbyStreamTarget struct {
+	URL         string
+	UserAgent   string
+	Cookie      string
+	StorageID   uint
+	StorageName string
+	ItemID      string
+	Client      string
+	RemoteIP    string
+	Rule        string
+}
+
+// EmbyStreamSessionStatus 正在中转的连接
+type EmbyStreamSessionStatus struct {
+	ID             uint64    `json:"id"`
+	ItemID         string    `json:"item_id"`
+	Client         string    `json:"client"`
+	RemoteIP       string    `json:"remote_ip"`
+	Rule           string    `json:"rule"`
+	StorageID      uint      `json:"storage_id"`
+	StorageName    string    `json:"storage_name"`
+	Range          string    `json:"range,omitempty"`
+	Bytes          int64     `json:"bytes"`
+	BytesPerSecond int64     `json:"bytes_per_second"`
+	StartedAt      time.Time `json:"started_at"`
+}
+
+// EmbyStreamStorageUsage 按存储累计的中转流量
+type EmbyStreamStorageUsage struct {
+	StorageID   uint   `json:"storage_id"`
+	StorageName string `json:"storage_name"`
+	Bytes       int64  `json:"bytes"`
+	Streams     int64  `json:"streams"`
+}
+
+// EmbyStreamProxySnapshot 中转播放的并发与流量统计(进程内，重启清零)
+type EmbyStreamProxySnapshot struct {
+	Enabled        bool                      `json:"enabled"`
+	MaxConcurrent  int                       `json:"max_concurrent"`
+	Active         int                       `json:"active"`
+	TotalStreams   int64                     `json:"total_streams"`
+	Rejected       int64                     `json:"rejected"`
+	TotalBytes     int64                     `json:"total_bytes"`
+	BytesPerSecond int64                     `json:"bytes_per_second"`
+	Sessions       []EmbyStreamSessionStatus `json:"sessions"`
+	Storages       []EmbyStreamStorageUsage  `json:"storages"`
+}
+
+type embyStreamSession struct {
+	status EmbyStreamSessionStatus
+	bytes  atomic.Int64
+}
+
+// EmbyStreamProxy 为无法跟随 302 的客户端中转直链数据：
+// 按客户端名称 / User-Agent 规则决定是否中转，限制同时中转的连接数，并统计转发流量。
+type EmbyStreamProxy struct {
+	cfg    *config.Config
+	logger *logger.Logger
+	client *http.Client
+
+	mu       sync.Mutex
+	nextID   uint64
+	active   map[uint64]*embyStreamSession
+	storages map[uint]*EmbyStreamStorageUsage
+	total    int64
+	rejected int64
+	bytes    int64
+	regexps  map[string]*regexp.Regexp
+}
+
+func NewEmbyStreamProxy(cfg *config.Config, log *logger.Logger) *EmbyStreamProxy {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = 30 * time.Second
+	transport.DialContext = (&net.Dialer{Timeout: 15 * time.Second, KeepAlive: 30 * time.Second}).DialContext
+	return &EmbyStreamProxy{
+		cfg:      cfg,
+		logger:   log,
+		client:   &http.Client{Transport: transport},
+		active:   make(map[uint64]*embyStreamSession),
+		storages: make(map[uint]*EmbyStreamStorageUsage),
+		regexps:  make(map[string]*regexp.Regexp),
+	}
+}
+
+// EmbyClientNameFromRequest 取 Emby 客户端名称：X-Emby-Client 头、Authorization 中的 Client 字段或同名查询参数
+func EmbyClientNameFromRequest(r *http.Request) string {
+	if v := strings.TrimSpace(r.Header.Get("X-Emby-Client")); v != "" {
+		return v
+	}
+	for _, header := range []string{"X-Emby-Authorization", "Authorization"} {
+		if m := embyClientRegex.FindStringSubmatch(r.Header.Get(header)); len(m) == 2 {
+			if v := strings.TrimSpace(m[1]); v != "" {
+				return v
+			}
+		}
+	}
+	return strings.TrimSpace(r.URL.Query().Get("X-Emby-Client"))
+}
+
+// Match 返回首个命中的中转规则；未启用中转时总是返回 false
+func (p *EmbyStreamProxy) Match(client, userAgent string) (config.EmbyStreamProxyRule, bool) {
+	if p == nil || p.cfg == nil || !p.cfg.Emby.StreamProxy.Enabled {
+		return config.EmbyStreamProxyRule{}, false
+	}
+	for _, rule := range p.cfg.Emby.StreamProxy.Rules {
+		if !rule.Enabled {
+			continue
+		}
+		ruleClient, ruleUA := strings.TrimSpace(rule.Client), strings.TrimSpace(rule.UserAgent)
+		if ruleClient == "" && ruleUA == "" {
+			continue
+		}
+		if ruleClient != "" && !strings.EqualFold(ruleClient, strings.TrimSpace(client)) {
+			continue
+		}
+		if ruleUA != "" {
+			re := p.compile(ruleUA)
+			if re == nil || !re.MatchString(userAgent) {
+				continue
+			}
+		}
+		return rule, true
+	}
+	return config.EmbyStreamProxyRule{}, false
+}
+
+func (p *EmbyStreamProxy) compile(pattern string) *regexp.Regexp {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if re, ok := p.regexps[pattern]; ok {
+		return re
+	}
+	re, err := regexp.Compile(pattern)
+	if err != nil && p.logger != nil {
+		p.logger.Warnf("[EMBY STREAM] 中转规则 User-Agent 正则无效 %q: %v", pattern, err)
+	}
+	// 无效正则也缓存 nil，避免每次请求重复编译和告警
+	p.regexps[pattern] = re
+	return re
+}
+
+// acquire 占用一个中转名额，超出 MaxConcurrent 时返回 ErrEmbyStreamProxyBusy
+func (p *EmbyStreamProxy) acquire(target EmbyStreamTarget, rangeHeader string) (*embyStreamSession, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if limit := p.cfg.Emby.StreamProxy.MaxConcurrent; limit > 0 && len(p.active) >= limit {
+		p.rejected++
+		return nil, ErrEmbyStreamProxyBusy
+	}
+	p.nextID++
+	session := &embyStreamSession{status: EmbyStreamSessionStatus{
+		ID:          p.nextID,
+		ItemID:      target.ItemID,
+		Client:      target.Client,
+		RemoteIP:    target.RemoteIP,
+		Rule:        target.Rule,
+		StorageID:   target.StorageID,
+		StorageName: target.StorageName,
+		Range:       rangeHeader,
+		StartedAt:   time.Now(),
+	}}
+	p.active[session.status.ID] = session
+	p.total++
+	usage := p.storages[target.StorageID]
+	if usage == nil {
+		usage = &EmbyStreamStorageUsage{StorageID: target.StorageID}
+		p.storages[target.StorageID] = usage
+	}
+	if target.StorageName != "" {
+		usage.StorageName = target.StorageName
+	}
+	usage.Streams++
+	return session, nil
+}
+
+func (p *EmbyStreamProxy) release(session *embyStreamSession) {
+	n := session.bytes.Load()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	delete(p.active, session.status.ID)
+	p.bytes += n
+	if usage := p.storages[session.status.StorageID]; usage != nil {
+		usage.Bytes += n
+	}
+}
+
+// Serve 请求直链并把响应转发给客户端。
+// 客户端的 Range 等请求头原样转发，直链请求使用获取直链时的 User-Agent，115 账号额外携带 Cookie。
+// 连接数已满时返回 ErrEmbyStreamProxyBusy 且不写响应；客户端中途断开不视为错误。
+func (p *EmbyStreamProxy) Serve(w http.ResponseWriter, r *http.Request, target EmbyStreamTarget) error {
+	session, err := p.acquire(target, r.Header.Get("Range"))
+	if err != nil {
+		return err
+	}
+	defer p.release(session)
+	// 代理端口的 WriteTimeout 面向普通 API 请求，视频流需要长时间写出
+	_ = http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+	method := http.MethodGet
+	if r.Method == http.MethodHead {
+		method = http.MethodHead
+	}
+	req, err := http.NewRequestWithContext(r.Context(), method, target.URL, nil)
+	if err != nil {
+		http.Error(w, "无效的直链", http.StatusBadGateway)
+		return fmt.Errorf("构造直链请求失败: %w", err)
+	}
+	for _, name := range embyStreamCopyHeaders {
+		if v := r.Header.Get(name); v != "" {
+			req.Header.Set(name, v)
+		}
+	}
+	if target.UserAgent != "" {
+		req.Header.Set("User-Agent", target.UserAgent)
+	}
+	if target.Cookie != "" {
+		req.Header.Set("Cookie", target.Cookie)
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		if errors.Is(r.Context().Err(), context.Canceled) {
+			return nil
+		}
+		http.Error(w, "请求直链失败", http.StatusBadGateway)
+		return fmt.Errorf("请求直链失败: %w", err)
+	}
+	defer resp.Body.Close()
+
+	for _, name := range embyStreamResponseHeaders {
+		if v := resp.Header.Get(name); v != "" {
+			w.Header().Set(name, v)
+		}
+	}
+	w.WriteHeader(resp.StatusCode)
+	if method == http.MethodHead {
+		return nil
+	}
+	if _, err := io.Copy(&embyStreamCounter{w: w, n: &session.bytes}, resp.Body); err != nil {
+		if r.Context().Err() != nil {
+			return nil
+		}
+		return fmt.Errorf("转发直链数据中断: %w", err)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return fmt.Errorf("直链返回 HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// Snapshot 返回当前中转连接与累计流量
+func (p *EmbyStreamProxy) Snapshot() EmbyStreamProxySnapshot {
+	snapshot := EmbyStreamProxySnapshot{Sessions: []EmbyStreamSessionStatus{}, Storages: []EmbyStreamStorageUsage{}}
+	if p == nil {
+		return snapshot
+	}
+	now := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	snapshot.Enabled = p.cfg.Emby.StreamProxy.Enabled
+	snapshot.MaxConcurrent = p.cfg.Emby.StreamProxy.MaxConcurrent
+	snapshot.Active = len(p.active)
+	snapshot.TotalStreams = p.total
+	snapshot.Rejected = p.rejected
+	snapshot.TotalBytes = p.bytes
+
+	inflight := make(map[uint]int64)
+	for _, session := range p.active {
+		status := session.status
+		status.Bytes = session.bytes.Load()
+		if elapsed := now.Sub(status.StartedAt).Seconds(); elapsed >= 1 {
+			status.BytesPerSecond = int64(float64(status.Bytes) / elapsed)
+		}
+		snapshot.TotalBytes += status.Bytes
+		snapshot.BytesPerSecond += status.BytesPerSecond
+		inflight[status.StorageID] += status.Bytes
+		snapshot.Sessions = append(snapshot.Sessions, status)
+	}
+	for id, usage := range p.storages {
+		item := *usage
+		item.Bytes += inflight[id]
+		snapshot.Storages = append(snapshot.Storages, item)
+	}
+	sort.Slice(snapshot.Sessions, func(i, j int) bool { return snapshot.Sessions[i].ID < snapshot.Sessions[j].ID })
+	sort.Slice(snapshot.Storages, func(i, j int) bool { return snapshot.Storages[i].Bytes > snapshot.Storages[j].Bytes })
+	return snapshot
+}
+
+// embyStreamCounter 统计写给客户端的字节数
+type embyStreamCounter struct {
+	w io.Writer
+	n *atomic.Int64
+}
+
+func (c *embyStreamCounter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n.Add(int64(n))
+	return n, err
+}
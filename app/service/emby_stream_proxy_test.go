@@ -0,0 +1,150 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+)
+
+func newTestEmbyStreamProxy(settings config.EmbyStreamProxyConfig) *EmbyStreamProxy {
+	return NewEmbyStreamProxy(&config.Config{Emby: config.EmbyConfig{StreamProxy: settings}}, nil)
+}
+
+func TestEmbyStreamProxyMatch(t *testing.T) {
+	proxy := newTestEmbyStreamProxy(config.EmbyStreamProxyConfig{
+		Enabled: true,
+		Rules: []config.EmbyStreamProxyRule{
+			{Name: "disabled", Enabled: false, UserAgent: ".*"},
+			{Name: "samsung", Enabled: true, Client: "Emby for Samsung"},
+			{Name: "dlna", Enabled: true, UserAgent: "(?i)dlna|upnp"},
+			{Name: "both", Enabled: true, Client: "Kodi", UserAgent: "^Kodi/"},
+		},
+	})
+	cases := []struct {
+		client, ua, want string
+	}{
+		{"emby for samsung", "Mozilla/5.0", "samsung"},
+		{"", "Platinum/1.0 UPnP/1.0 DLNADOC/1.50", "dlna"},
+		{"Kodi", "Kodi/20.2", "both"},
+		{"Kodi", "VLC/3.0", ""},
+		{"Infuse", "Infuse/7", ""},
+	}
+	for _, tc := range cases {
+		rule, ok := proxy.Match(tc.client, tc.ua)
+		if got := rule.Name; ok != (tc.want != "") || got != tc.want {
+			t.Fatalf("Match(%q, %q) = %q/%v, want %q", tc.client, tc.ua, got, ok, tc.want)
+		}
+	}
+
+	proxy.cfg.Emby.StreamProxy.Enabled = false
+	if _, ok := proxy.Match("Emby for Samsung", ""); ok {
+		t.Fatal("disabled stream proxy should never match")
+	}
+}
+
+func TestEmbyClientNameFromRequest(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil)
+	req.Header.Set("X-Emby-Authorization", `MediaBrowser Client="Emby for LG", Device="TV", DeviceId="x", Version="1.0", Token="abc"`)
+	if got := EmbyClientNameFromRequest(req); got != "Emby for LG" {
+		t.Fatalf("client from authorization = %q", got)
+	}
+	req = httptest.NewRequest(http.MethodGet, "/Videos/1/stream?X-Emby-Client=Emby+Web", nil)
+	if got := EmbyClientNameFromRequest(req); got != "Emby Web" {
+		t.Fatalf("client from query = %q", got)
+	}
+}
+
+func TestEmbyStreamProxyServeForwardsRangeAndAccountsBytes(t *testing.T) {
+	content := bytes.Repeat([]byte("0123456789"), 100)
+	var gotUA, gotCookie string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		gotUA, gotCookie = r.UserAgent(), r.Header.Get("Cookie")
+		http.ServeContent(w, r, "video.mkv", time.Time{}, bytes.NewReader(content))
+	}))
+	defer upstream.Close()
+
+	proxy := newTestEmbyStreamProxy(config.EmbyStreamProxyConfig{Enabled: true, MaxConcurrent: 1})
+	req := httptest.NewRequest(http.MethodGet, "/Videos/1/stream", nil)
+	req.Header.Set("Range", "bytes=100-199")
+	rec := httptest.NewRecorder()
+	err := proxy.Serve(rec, req, EmbyStreamTarget{
+		URL:         upstream.URL,
+		UserAgent:   "TV-Player/1.0",
+		Cookie:      "UID=1; CID=2",
+		StorageID:   7,
+		StorageName: "member",
+		ItemID:      "1",
+	})
+	if err != nil {
+		t.Fatalf("Serve: %v", err)
+	}
+	if rec.Code != http.StatusPartialContent || rec.Header().Get("Content-Range") != "bytes 100-199/1000" {
+		t.Fatalf("status=%d content-range=%q", rec.Code, rec.Header().Get("Content-Range"))
+	}
+	if !bytes.Equal(rec.Body.Bytes(), content[100:200]) {
+		t.Fatalf("unexpected body %q", rec.Body.String())
+	}
+	if gotUA != "TV-Player/1.0" || gotCookie != "UID=1; CID=2" {
+		t.Fatalf("upstream ua=%q cookie=%q", gotUA, gotCookie)
+	}
+
+	snapshot := proxy.Snapshot()
+	if snapshot.Active != 0 || snapshot.TotalStreams != 1 || snapshot.TotalBytes != 100 {
+		t.Fatalf("snapshot = %+v", snapshot)
+	}
+	if len(snapshot.Storages) != 1 || snapshot.Storages[0].StorageID != 7 || snapshot.Storages[0].Bytes != 100 {
+		t.Fatalf("storage usage = %+v", snapshot.Storages)
+	}
+}
+
+func TestEmbyStreamProxyConcurrencyCap(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		_, _ = io.WriteString(w, "head")
+		w.(http.Flusher).Flush()
+		close(started)
+		<-release
+	}))
+	defer upstream.Close()
+
+	proxy := newTestEmbyStreamProxy(config.EmbyStreamProxyConfig{Enabled: true, MaxConcurrent: 1})
+	done := make(chan error, 1)
+	go func() {
+		done <- proxy.Serve(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/a", nil), EmbyStreamTarget{URL: upstream.URL})
+	}()
+	<-started
+
+	// 第一个连接仍在转发，第二个应被拒绝
+	deadline := time.Now().Add(2 * time.Second)
+	for proxy.Snapshot().TotalBytes != 4 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	rec := httptest.NewRecorder()
+	err := proxy.Serve(rec, httptest.NewRequest(http.MethodGet, "/b", nil), EmbyStreamTarget{URL: upstream.URL})
+	if !errors.Is(err, ErrEmbyStreamProxyBusy) {
+		t.Fatalf("second stream err = %v, want busy", err)
+	}
+	if rec.Body.Len() != 0 {
+		t.Fatalf("busy stream should not write a response, got %q", rec.Body.String())
+	}
+	if snapshot := proxy.Snapshot(); snapshot.Rejected != 1 || len(snapshot.Sessions) != 1 || snapshot.Sessions[0].Bytes != 4 {
+		t.Fatalf("snapshot while streaming = %+v", snapshot)
+	}
+
+	close(release)
+	if err := <-done; err != nil && !strings.Contains(err.Error(), "中断") {
+		t.Fatalf("first stream: %v", err)
+	}
+	if snapshot := proxy.Snapshot(); snapshot.Active != 0 || snapshot.TotalBytes != 4 {
+		t.Fatalf("snapshot after stream = %+v", snapshot)
+	}
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyplayback"
+
+	"gorm.io/gorm"
+)
+
+// Emby 用户播放限制的错误码，作为 Emby 风格错误响应的 ErrorCode 返回给客户端
+const (
+	EmbyUserLimitCodeTimeWindow = "PlaybackTimeRestricted"
+	EmbyUserLimitCodeConcurrent = "TooManyStreams"
+	EmbyUserLimitCodeDaily      = "DailyPlaybackLimitReached"
+)
+
+// EmbyUserLimitError 播放请求超出 Emby 用户限制
+type EmbyUserLimitError struct {
+	Code    string
+	Message string
+}
+
+func (e *EmbyUserLimitError) Error() string {
+	return e.Message
+}
+
+// CheckEmbyUserPlaybackLimit 校验一次播放请求是否满足限制。
+// activeStreams 为该用户其他正在播放的会话数；resuming 表示请求属于已在播放的会话(拖动进度、重连)，不再计入每日次数。
+func CheckEmbyUserPlaybackLimit(limit model.EmbyUserPlaybackLimit, now time.Time, activeStreams, todayCount int, resuming bool) error {
+	if !limit.Enabled {
+		return nil
+	}
+	windows, err := model.ParsePlaybackTimeWindows(limit.AllowedWindows)
+	if err != nil {
+		return err
+	}
+	if len(windows) > 0 {
+		allowed := false
+		texts := make([]string, 0, len(windows))
+		for _, window := range windows {
+			texts = append(texts, window.String())
+			if window.Contains(now) {
+				allowed = true
+				break
+			}
+		}
+		if !allowed {
+			return &EmbyUserLimitError{
+				Code:    EmbyUserLimitCodeTimeWindow,
+				Message: "当前时段不允许播放，可播放时段: " + strings.Join(texts, ", "),
+			}
+		}
+	}
+	if limit.MaxConcurrent > 0 && activeStreams >= limit.MaxConcurrent {
+		return &EmbyUserLimitError{
+			Code:    EmbyUserLimitCodeConcurrent,
+			Message: fmt.Sprintf("同时播放数已达上限(%d)，请先停止其他设备上的播放", limit.MaxConcurrent),
+		}
+	}
+	if !resuming && limit.DailyLimit > 0 && todayCount >= limit.DailyLimit {
+		return &EmbyUserLimitError{
+			Code:    EmbyUserLimitCodeDaily,
+			Message: fmt.Sprintf("今日播放次数已达上限(%d)", limit.DailyLimit),
+		}
+	}
+	return nil
+}
+
+// EmbyUserLimitService 在代理播放前按 Emby 用户校验并发数、每日次数与允许时段
+type EmbyUserLimitService struct {
+	logger   *logger.Logger
+	sessions *embyplayback.Store
+}
+
+func NewEmbyUserLimitService(log *logger.Logger) *EmbyUserLimitService {
+	return &EmbyUserLimitService{logger: log, sessions: embyplayback.Default()}
+}
+
+// HasEnabledLimits 是否存在启用的限制；没有时调用方可跳过用户解析
+func (s *EmbyUserLimitService) HasEnabledLimits() bool {
+	var count int64
+	if err := database.DB.Model(&model.EmbyUserPlaybackLimit{}).Where("enabled = ?", true).Count(&count).Error; err != nil {
+		return false
+	}
+	return count > 0
+}
+
+// Admit 校验并登记一次播放。sessionKey 为该次播放的会话键，resuming 表示会话已存在。
+// 返回 *EmbyUserLimitError 表示被拦截；其他错误由调用方决定是否放行。
+func (s *EmbyUserLimitService) Admit(embyUserID, sessionKey string, resuming bool, now time.Time) error {
+	var limit model.EmbyUserPlaybackLimit
+	err := database.DB.Where("emby_user_id = ? AND enabled = ?", embyUserID, true).First(&limit).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	day := model.EmbyUserPlaybackDay(now)
+	todayCount, err := model.GetEmbyUserPlaybackCount(database.DB, embyUserID, day)
+	if err != nil {
+		return err
+	}
+	active := s.sessions.ActiveCountByUserExcept(embyUserID, sessionKey)
+	if err := CheckEmbyUserPlaybackLimit(limit, now, active, todayCount, resuming); err != nil {
+		return err
+	}
+	if !resuming {
+		if err := model.IncrEmbyUserPlaybackCount(database.DB, embyUserID, day); err != nil {
+			s.logger.Warnf("记录 Emby 用户播放次数失败 user=%s: %v", embyUserID, err)
+		}
+	}
+	return nil
+}
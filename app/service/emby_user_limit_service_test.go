@@ -0,0 +1,111 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyplayback"
+	"film-fusion/app/store/embyproxylog"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func limitErrorCode(err error) string {
+	var limitErr *EmbyUserLimitError
+	if errors.As(err, &limitErr) {
+		return limitErr.Code
+	}
+	return ""
+}
+
+func TestCheckEmbyUserPlaybackLimit(t *testing.T) {
+	noon := time.Date(2026, 1, 1, 12, 0, 0, 0, time.Local)
+	limit := model.EmbyUserPlaybackLimit{Enabled: true, MaxConcurrent: 2, DailyLimit: 3, AllowedWindows: "08:00-23:00"}
+
+	if err := CheckEmbyUserPlaybackLimit(limit, noon, 1, 2, false); err != nil {
+		t.Fatalf("within limits: %v", err)
+	}
+	if code := limitErrorCode(CheckEmbyUserPlaybackLimit(limit, noon.Add(12*time.Hour), 0, 0, false)); code != EmbyUserLimitCodeTimeWindow {
+		t.Fatalf("outside window code = %q", code)
+	}
+	if code := limitErrorCode(CheckEmbyUserPlaybackLimit(limit, noon, 2, 0, false)); code != EmbyUserLimitCodeConcurrent {
+		t.Fatalf("concurrent code = %q", code)
+	}
+	if code := limitErrorCode(CheckEmbyUserPlaybackLimit(limit, noon, 0, 3, false)); code != EmbyUserLimitCodeDaily {
+		t.Fatalf("daily code = %q", code)
+	}
+	if err := CheckEmbyUserPlaybackLimit(limit, noon, 0, 3, true); err != nil {
+		t.Fatalf("resuming a session should not count against the daily limit: %v", err)
+	}
+	limit.Enabled = false
+	if err := CheckEmbyUserPlaybackLimit(limit, noon.Add(12*time.Hour), 5, 5, false); err != nil {
+		t.Fatalf("disabled limit: %v", err)
+	}
+}
+
+func TestEmbyUserLimitServiceAdmit(t *testing.T) {
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "emby-user-limit.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.EmbyUserPlaybackLimit{}, &model.EmbyUserPlaybackUsage{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() { database.DB = oldDB })
+
+	svc := &EmbyUserLimitService{
+		logger:   logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+		sessions: embyplayback.NewStore(),
+	}
+	if svc.HasEnabledLimits() {
+		t.Fatal("no limits configured yet")
+	}
+	now := time.Now()
+	if err := svc.Admit("u1", "k1", false, now); err != nil {
+		t.Fatalf("user without limit should be admitted: %v", err)
+	}
+
+	db.Create(&model.EmbyUserPlaybackLimit{EmbyUserID: "u1", Enabled: true, MaxConcurrent: 1, DailyLimit: 2})
+	if !svc.HasEnabledLimits() {
+		t.Fatal("limit should be detected")
+	}
+
+	if err := svc.Admit("u1", "k1", false, now); err != nil {
+		t.Fatalf("first play: %v", err)
+	}
+	svc.sessions.AttachRedirect(embyproxylog.Entry{ItemID: "i1", RemoteIP: "1.1.1.1", UserAgent: "ua", ActualStorageID: 1, EmbyUserID: "u1"})
+	key := embyproxylog.Entry{ItemID: "i1", RemoteIP: "1.1.1.1", UserAgent: "ua"}.PlaybackKey()
+
+	if code := limitErrorCode(svc.Admit("u1", "other", false, now)); code != EmbyUserLimitCodeConcurrent {
+		t.Fatalf("second stream code = %q", code)
+	}
+	if err := svc.Admit("u1", key, true, now); err != nil {
+		t.Fatalf("resuming the active stream should pass: %v", err)
+	}
+
+	svc.sessions.Clear()
+	if err := svc.Admit("u1", "k2", false, now); err != nil {
+		t.Fatalf("second play after stop: %v", err)
+	}
+	if code := limitErrorCode(svc.Admit("u1", "k3", false, now)); code != EmbyUserLimitCodeDaily {
+		t.Fatalf("third play code = %q", code)
+	}
+	if count, _ := model.GetEmbyUserPlaybackCount(db, "u1", model.EmbyUserPlaybackDay(now)); count != 2 {
+		t.Fatalf("today count = %d, want 2", count)
+	}
+	if err := svc.Admit("u1", "k4", false, now.AddDate(0, 0, 1)); err != nil {
+		t.Fatalf("daily count should reset the next day: %v", err)
+	}
+}
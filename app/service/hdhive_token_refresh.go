@@ -96,8 +96,11 @@ func (s *HDHiveTokenRefreshService) checkAndRefresh(reason string) {
 
 	ctx, cancel := context.WithTimeout(context.Background(), s.timeout())
 	defer cancel()
-	if _, err := s.RefreshNow(ctx, reason); err != nil && s.logger != nil {
-		s.logger.Warnf("[hdhive] 自动刷新 Token 失败: %v", err)
+	if _, err := s.RefreshNow(ctx, reason); err != nil {
+		tokenRefreshFailuresMetric.Inc("hdhive")
+		if s.logger != nil {
+			s.logger.Warnf("[hdhive] 自动刷新 Token 失败: %v", err)
+		}
 	}
 }
 
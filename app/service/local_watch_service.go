@@ -0,0 +1,404 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/pathhelper"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+const (
+	// localWatchSyncInterval 重新加载 local_watch 配置的间隔，新增/修改/删除的 CloudPath 在此间隔内生效
+	localWatchSyncInterval = time.Minute
+	// localWatchDebounce 同一路径在该时间内没有新事件才处理，避免复制大文件时反复生成
+	localWatchDebounce = 3 * time.Second
+)
+
+// 合并后的挂载目录变更
+const (
+	localWatchUpsert = "upsert" // 新建、写入或移入
+	localWatchRemove = "remove" // 删除或移出
+)
+
+type localWatchPending struct {
+	op     string
+	lastAt time.Time
+}
+
+// localWatcher 单个 local_watch CloudPath 的监听状态
+type localWatcher struct {
+	cloudPath model.CloudPath
+	cancel    context.CancelFunc
+	done      chan struct{}
+}
+
+// LocalWatchService 监听本地挂载目录(rclone/CD2 FUSE)的 inotify 事件，
+// 去抖后转换为与 webhook 相同的创建/删除操作交给 StrmService，并定期全量重扫弥补丢失的事件。
+type LocalWatchService struct {
+	logger         *logger.Logger
+	download115Svc *Download115Service
+	debounce       time.Duration
+
+	mu       sync.Mutex
+	watchers map[uint]*localWatcher
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewLocalWatchService 创建本地挂载监听服务
+func NewLocalWatchService(log *logger.Logger, download115Svc *Download115Service) *LocalWatchService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &LocalWatchService{
+		logger:         log,
+		download115Svc: download115Svc,
+		debounce:       localWatchDebounce,
+		watchers:       map[uint]*localWatcher{},
+		ctx:            ctx,
+		cancel:         cancel,
+	}
+}
+
+// Start 加载所有 local_watch 路径并定期同步配置变化
+func (s *LocalWatchService) Start() {
+	s.Sync()
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(localWatchSyncInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.Sync()
+			}
+		}
+	}()
+}
+
+// Stop 停止所有监听
+func (s *LocalWatchService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+	s.mu.Lock()
+	watchers := s.watchers
+	s.watchers = map[uint]*localWatcher{}
+	s.mu.Unlock()
+	for _, w := range watchers {
+		w.cancel()
+		<-w.done
+	}
+}
+
+// Sync 按数据库中的 local_watch 配置启动、重启或停止监听
+func (s *LocalWatchService) Sync() {
+	var cloudPaths []model.CloudPath
+	if err := database.DB.Preload("CloudStorage").
+		Where("source_type = ? AND link_type = ?", model.SourceTypeLocalWatch, model.LinkTypeStrm).
+		Find(&cloudPaths).Error; err != nil {
+		s.logger.Warnf("查询本地挂载监听配置失败: %v", err)
+		return
+	}
+
+	active := make(map[uint]bool, len(cloudPaths))
+	for _, cloudPath := range cloudPaths {
+		active[cloudPath.ID] = true
+		s.mu.Lock()
+		current, ok := s.watchers[cloudPath.ID]
+		s.mu.Unlock()
+		if ok && current.cloudPath.UpdatedAt.Equal(cloudPath.UpdatedAt) {
+			continue
+		}
+		if ok {
+			s.stopWatcher(cloudPath.ID)
+		}
+		if err := s.Watch(cloudPath); err != nil {
+			s.logger.Warnf("启动本地挂载监听失败 cloud_path_id=%d %s: %v", cloudPath.ID, cloudPath.WatchPath, err)
+		}
+	}
+
+	s.mu.Lock()
+	var stale []uint
+	for id := range s.watchers {
+		if !active[id] {
+			stale = append(stale, id)
+		}
+	}
+	s.mu.Unlock()
+	for _, id := range stale {
+		s.stopWatcher(id)
+	}
+}
+
+// Watch 为单个 CloudPath 启动监听，已在监听时先停止旧的
+func (s *LocalWatchService) Watch(cloudPath model.CloudPath) error {
+	root := strings.TrimSpace(cloudPath.WatchPath)
+	if root == "" {
+		return errors.New("未设置监听目录")
+	}
+	if info, err := os.Stat(root); err != nil {
+		return err
+	} else if !info.IsDir() {
+		return errors.New("监听路径不是目录")
+	}
+	fsWatcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+
+	s.stopWatcher(cloudPath.ID)
+	ctx, cancel := context.WithCancel(s.ctx)
+	w := &localWatcher{cloudPath: cloudPath, cancel: cancel, done: make(chan struct{})}
+	s.mu.Lock()
+	s.watchers[cloudPath.ID] = w
+	s.mu.Unlock()
+
+	s.addRecursive(fsWatcher, root)
+	s.logger.Infof("本地挂载监听已启动 cloud_path_id=%d: %s -> %s", cloudPath.ID, root, cloudPath.SourcePath)
+	go func() {
+		defer close(w.done)
+		defer fsWatcher.Close()
+		s.run(ctx, fsWatcher, cloudPath)
+	}()
+	return nil
+}
+
+func (s *LocalWatchService) stopWatcher(cloudPathID uint) {
+	s.mu.Lock()
+	w, ok := s.watchers[cloudPathID]
+	delete(s.watchers, cloudPathID)
+	s.mu.Unlock()
+	if ok {
+		w.cancel()
+		<-w.done
+	}
+}
+
+// addRecursive inotify 不支持递归，逐个目录添加；超出 max_user_watches 时依赖定期重扫兜底
+func (s *LocalWatchService) addRecursive(fsWatcher *fsnotify.Watcher, dir string) {
+	_ = filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			s.logger.Debugf("遍历挂载目录失败 %s: %v", p, err)
+			return nil
+		}
+		if !d.IsDir() {
+			return nil
+		}
+		if err := fsWatcher.Add(p); err != nil {
+			s.logger.Warnf("添加目录监听失败 %s: %v", p, err)
+			return filepath.SkipDir
+		}
+		return nil
+	})
+}
+
+// run 事件循环；事件处理与重扫都在同一 goroutine 中串行执行
+func (s *LocalWatchService) run(ctx context.Context, fsWatcher *fsnotify.Watcher, cloudPath model.CloudPath) {
+	pending := map[string]*localWatchPending{}
+	flushTicker := time.NewTicker(s.debounce / 2)
+	defer flushTicker.Stop()
+
+	var rescanC <-chan time.Time
+	if cloudPath.WatchRescanMinutes > 0 {
+		rescanTicker := time.NewTicker(time.Duration(cloudPath.WatchRescanMinutes) * time.Minute)
+		defer rescanTicker.Stop()
+		rescanC = rescanTicker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case event, ok := <-fsWatcher.Events:
+			if !ok {
+				return
+			}
+			op := localWatchUpsert
+			switch {
+			case event.Has(fsnotify.Remove), event.Has(fsnotify.Rename):
+				op = localWatchRemove
+			case event.Has(fsnotify.Create):
+				// 新目录需要立即加入监听，否则会漏掉其中随后创建的文件
+				if info, err := os.Stat(event.Name); err == nil && info.IsDir() {
+					s.addRecursive(fsWatcher, event.Name)
+				}
+			case event.Has(fsnotify.Write):
+			default:
+				continue
+			}
+			pending[event.Name] = &localWatchPending{op: op, lastAt: time.Now()}
+		case err, ok := <-fsWatcher.Errors:
+			if !ok {
+				return
+			}
+			s.logger.Warnf("本地挂载监听错误 cloud_path_id=%d: %v", cloudPath.ID, err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				s.Rescan(cloudPath)
+			}
+		case <-flushTicker.C:
+			s.flush(cloudPath, pending, false)
+		case <-rescanC:
+			s.flush(cloudPath, pending, true)
+			s.Rescan(cloudPath)
+		}
+	}
+}
+
+// flush 处理已静默超过去抖时间的事件；force 时处理全部
+func (s *LocalWatchService) flush(cloudPath model.CloudPath, pending map[string]*localWatchPending, force bool) {
+	now := time.Now()
+	var dirs []string
+	for name, item := range pending {
+		if !force && now.Sub(item.lastAt) < s.debounce {
+			continue
+		}
+		delete(pending, name)
+		if item.op == localWatchUpsert {
+			if info, err := os.Stat(name); err == nil && info.IsDir() {
+				dirs = append(dirs, name)
+			}
+		}
+		s.apply(cloudPath, name, item.op)
+	}
+	// 目录已整体遍历，丢弃其下尚未到期的文件事件
+	for _, dir := range dirs {
+		for name := range pending {
+			if pathhelper.IsSubPath(name, dir) {
+				delete(pending, name)
+			}
+		}
+	}
+}
+
+// apply 将挂载目录中的一个变更映射为事件路径并交给 StrmService
+func (s *LocalWatchService) apply(cloudPath model.CloudPath, localFile, op string) {
+	eventPath, ok := pathhelper.RebasePath(localFile, cloudPath.WatchPath, cloudPath.SourcePath)
+	if !ok {
+		return
+	}
+	strmSvc := NewStrmService(s.logger, s.download115Svc)
+	if _, err := os.Stat(localFile); op == localWatchUpsert && err == nil {
+		// 挂载目录即网盘内容，新目录直接遍历本地挂载，不再调用网盘列表接口
+		_ = filepath.WalkDir(localFile, func(p string, d fs.DirEntry, err error) error {
+			if err != nil || d.IsDir() {
+				return nil
+			}
+			if eventPath, ok := pathhelper.RebasePath(p, cloudPath.WatchPath, cloudPath.SourcePath); ok {
+				if err := strmSvc.CreateFile(eventPath, cloudPath); err != nil {
+					s.logger.Warnf("处理挂载目录变更失败 %s: %v", p, err)
+				}
+			}
+			return nil
+		})
+		return
+	}
+
+	// 文件已不存在：媒体文件删除对应 STRM；目录则按本地 STRM 目录是否存在判断
+	fileExt := strings.ToLower(filepath.Ext(eventPath))
+	if pathhelper.IsFileInAnyFilterRules(fileExt, cloudPath.FilterRules) {
+		strmSvc.DeleteStrm(eventPath, cloudPath, false)
+		return
+	}
+	if localDir, err := pathhelper.JoinUnderRoot(cloudPath.LocalPath, eventPath); err == nil {
+		if info, err := os.Stat(localDir); err == nil && info.IsDir() {
+			strmSvc.DeleteStrm(eventPath, cloudPath, true)
+		}
+	}
+}
+
+// Rescan 全量比对挂载目录与本地 STRM：补建缺失的 STRM，删除源文件已消失的 STRM
+func (s *LocalWatchService) Rescan(cloudPath model.CloudPath) {
+	root := strings.TrimSpace(cloudPath.WatchPath)
+	if info, err := os.Stat(root); err != nil || !info.IsDir() {
+		s.logger.Warnf("挂载目录不可用，跳过重扫 cloud_path_id=%d: %s", cloudPath.ID, root)
+		return
+	}
+	nested, err := nestedCloudPathSources(cloudPath)
+	if err != nil {
+		s.logger.Warnf("跳过重扫 cloud_path_id=%d: %v", cloudPath.ID, err)
+		return
+	}
+	strmSvc := NewStrmService(s.logger, s.download115Svc)
+
+	expected := map[string]bool{}
+	var creates []string
+	var mediaFiles int
+	err = filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+		fileExt := strings.ToLower(filepath.Ext(p))
+		if !pathhelper.IsFileInAnyFilterRules(fileExt, cloudPath.FilterRules) {
+			return nil
+		}
+		eventPath, ok := pathhelper.RebasePath(p, root, cloudPath.SourcePath)
+		if !ok || inNestedCloudPath(eventPath, nested) {
+			return nil
+		}
+		mediaFiles++
+		target := eventPath
+		if !pathhelper.IsFileMatchedByFilter(fileExt, cloudPath.FilterRules, "download") {
+			key, ok := strmKeyForSource(eventPath)
+			if !ok {
+				return nil
+			}
+			expected[key] = true
+			target = key
+		}
+		if localTarget, err := pathhelper.JoinUnderRoot(cloudPath.LocalPath, target); err == nil {
+			if _, err := os.Stat(localTarget); os.IsNotExist(err) {
+				creates = append(creates, eventPath)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		// 遍历不完整时不能据此删除，只补建已发现的缺失文件
+		s.logger.Warnf("重扫挂载目录失败 cloud_path_id=%d: %v", cloudPath.ID, err)
+	}
+
+	for _, eventPath := range creates {
+		if s.ctx.Err() != nil {
+			return
+		}
+		if err := strmSvc.CreateFile(eventPath, cloudPath); err != nil {
+			s.logger.Warnf("重扫补建 STRM 失败 %s: %v", eventPath, err)
+		}
+	}
+
+	local, localErr := collectLocalStrm(cloudPath, nested)
+	if err != nil || localErr != nil || (mediaFiles == 0 && len(local) > 0) {
+		// 挂载掉线时目录可能为空，宁可不删
+		if mediaFiles == 0 && len(local) > 0 {
+			s.logger.Warnf("挂载目录未发现任何媒体文件，跳过删除 cloud_path_id=%d", cloudPath.ID)
+		}
+		return
+	}
+	var deletes int
+	for key := range local {
+		if expected[key] {
+			continue
+		}
+		strmSvc.DeleteAction(cloudPath.LocalPath, key, false)
+		deletes++
+	}
+	if len(creates) > 0 || deletes > 0 {
+		s.logger.Infof("挂载目录重扫完成 cloud_path_id=%d: 补建 %d, 删除 %d", cloudPath.ID, len(creates), deletes)
+	}
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+func setupLocalWatchTest(t *testing.T) (*LocalWatchService, model.CloudPath, string) {
+	t.Helper()
+	_, cloudPath := setupStrmReconcileTest(t, reconcileFakeDriver{&fakeStorageDriver{}})
+	mount := t.TempDir()
+	cloudPath.SourceType = model.SourceTypeLocalWatch
+	cloudPath.WatchPath = mount
+	svc := NewLocalWatchService(logger.New(config.LogConfig{Level: "error", Output: "stdout"}), nil)
+	svc.debounce = 100 * time.Millisecond
+	t.Cleanup(svc.Stop)
+	return svc, cloudPath, mount
+}
+
+func waitForLocalWatch(t *testing.T, what string, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		if cond() {
+			return
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	t.Fatalf("timed out waiting for %s", what)
+}
+
+// waitStrmCreateLogs 整理日志异步写入，测试结束前等待其落库
+func waitStrmCreateLogs(t *testing.T, want int64) {
+	t.Helper()
+	waitForLocalWatch(t, "organize logs", func() bool {
+		var count int64
+		database.DB.Model(&model.OrganizeLog{}).Where("action = ?", model.OrganizeActionStrmCreate).Count(&count)
+		return count >= want
+	})
+}
+
+func TestLocalWatchServiceMirrorsMountEvents(t *testing.T) {
+	svc, cloudPath, mount := setupLocalWatchTest(t)
+	if err := svc.Watch(cloudPath); err != nil {
+		t.Fatalf("watch: %v", err)
+	}
+
+	// 新建目录后立即写入的文件也要被捕获
+	movieDir := filepath.Join(mount, "Movie")
+	if err := os.MkdirAll(movieDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(movieDir, "A (2020).mkv"), []byte("x"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	strmPath := filepath.Join(cloudPath.LocalPath, "Media", "Movie", "A (2020).strm")
+	waitForLocalWatch(t, "strm creation", func() bool {
+		data, err := os.ReadFile(strmPath)
+		return err == nil && string(data) == "http://strm/Media/Movie/A (2020).mkv"
+	})
+
+	// 删除未被过滤规则覆盖的旁路文件不应影响 STRM
+	writeLocalStrm(t, mount, "Movie/A (2020).nfo", "<movie/>")
+	if err := os.Remove(filepath.Join(movieDir, "A (2020).nfo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Remove(filepath.Join(movieDir, "A (2020).mkv")); err != nil {
+		t.Fatal(err)
+	}
+	waitForLocalWatch(t, "strm removal", func() bool {
+		_, err := os.Stat(strmPath)
+		return os.IsNotExist(err)
+	})
+	waitStrmCreateLogs(t, 1)
+}
+
+func TestLocalWatchServiceRescan(t *testing.T) {
+	svc, cloudPath, mount := setupLocalWatchTest(t)
+	writeLocalStrm(t, mount, "TV/Show/Show S01E01.mkv", "x")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/TV/Show/Show S01E02.strm", "http://strm/Media/TV/Show/Show S01E02.mkv")
+
+	svc.Rescan(cloudPath)
+
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "TV", "Show", "Show S01E01.strm")); err != nil {
+		t.Fatalf("missing strm should be created: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "TV", "Show", "Show S01E02.strm")); !os.IsNotExist(err) {
+		t.Fatalf("orphan strm should be removed, stat err = %v", err)
+	}
+
+	// 挂载掉线(目录为空)时不删除任何 STRM
+	if err := os.RemoveAll(filepath.Join(mount, "TV")); err != nil {
+		t.Fatal(err)
+	}
+	svc.Rescan(cloudPath)
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "TV", "Show", "Show S01E01.strm")); err != nil {
+		t.Fatalf("strm should be kept when mount is empty: %v", err)
+	}
+	waitStrmCreateLogs(t, 1)
+}
@@ -0,0 +1,355 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+const (
+	balanceHealthCheckInterval = 10 * time.Minute
+	balanceHealthProbeTimeout  = 30 * time.Second
+	// 连续失败达到该次数才隔离，避免偶发的网络抖动把成员摘掉
+	balanceHealthQuarantineFailures = 2
+	// 剩余空间低于该值视为不健康，秒传到该账号大概率会失败
+	balanceHealthMinFreeBytes = int64(1) << 30
+	balanceHealthRetention    = 7 * 24 * time.Hour
+)
+
+// BalanceHealthProbe 一次子账号健康探测的原始结果
+type BalanceHealthProbe struct {
+	CookieOK    bool
+	FreeBytes   int64 // -1 表示未知
+	LinkChecked bool
+	LinkOK      bool
+	Latency     time.Duration
+	Errors      []string
+}
+
+// Healthy Cookie 有效、剩余空间充足且测试 pickcode 能拿到可用直链(未配置时跳过)
+func (p BalanceHealthProbe) Healthy() bool {
+	if !p.CookieOK {
+		return false
+	}
+	if p.FreeBytes >= 0 && p.FreeBytes < balanceHealthMinFreeBytes {
+		return false
+	}
+	return !p.LinkChecked || p.LinkOK
+}
+
+// balanceMemberProber 探测单个账号的健康状况，便于测试替换
+type balanceMemberProber interface {
+	Probe(ctx context.Context, storage model.CloudStorage, pickcode string) BalanceHealthProbe
+}
+
+type web115BalanceMemberProber struct {
+	logger    *logger.Logger
+	web115Svc *Web115Service
+}
+
+func (p web115BalanceMemberProber) Probe(ctx context.Context, storage model.CloudStorage, pickcode string) BalanceHealthProbe {
+	start := time.Now()
+	probe := BalanceHealthProbe{FreeBytes: -1}
+
+	client, err := p.web115Svc.NewClientWithContext(ctx, storage.Cookie, balanceHealthProbeTimeout)
+	if err != nil {
+		probe.Errors = append(probe.Errors, err.Error())
+		probe.Latency = time.Since(start)
+		return probe
+	}
+	probe.CookieOK = true
+
+	if info, err := client.GetInfo(); err != nil {
+		probe.Errors = append(probe.Errors, "获取空间信息失败: "+err.Error())
+	} else {
+		probe.FreeBytes = info.SpaceInfo.AllRemain.Size
+		if probe.FreeBytes < balanceHealthMinFreeBytes {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("剩余空间不足: %.2f GB", bytesToGB(probe.FreeBytes)))
+		}
+	}
+
+	if pickcode = strings.TrimSpace(pickcode); pickcode != "" {
+		probe.LinkChecked = true
+		if err := p.checkLink(ctx, storage, pickcode); err != nil {
+			probe.Errors = append(probe.Errors, fmt.Sprintf("测试 pickcode %s 直链不可用: %v", pickcode, err))
+		} else {
+			probe.LinkOK = true
+		}
+	}
+	probe.Latency = time.Since(start)
+	return probe
+}
+
+// checkLink 获取测试文件直链并请求首字节，确认直链确实可以下载
+func (p web115BalanceMemberProber) checkLink(ctx context.Context, storage model.CloudStorage, pickcode string) error {
+	drv, err := NewStorageDriver(storage, p.logger)
+	if err != nil {
+		return err
+	}
+	link, err := drv.DirectLink(ctx, StorageEntry{PickCode: pickcode}, web115BrowserUA)
+	if err != nil {
+		return err
+	}
+	if strings.TrimSpace(link) == "" {
+		return fmt.Errorf("未返回直链")
+	}
+	reqCtx, cancel := context.WithTimeout(ctx, balanceHealthProbeTimeout)
+	defer cancel()
+	req, err := http.NewRequestWithContext(reqCtx, http.MethodGet, link, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", web115BrowserUA)
+	req.Header.Set("Range", "bytes=0-0")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusPartialContent {
+		return fmt.Errorf("直链返回 HTTP %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// BalanceHealthService 定时探测 Match302 子账号的 Cookie、剩余空间与测试直链，
+// 连续失败时自动隔离成员(不再参与负载均衡)，恢复后自动放回，并在状态切换时发送通知。
+type BalanceHealthService struct {
+	cfg      *config.Config
+	logger   *logger.Logger
+	prober   balanceMemberProber
+	notifier NotificationPublisher
+
+	mu        sync.Mutex
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+}
+
+func NewBalanceHealthService(cfg *config.Config, log *logger.Logger, notifier NotificationPublisher) *BalanceHealthService {
+	return &BalanceHealthService{
+		cfg:       cfg,
+		logger:    log,
+		prober:    web115BalanceMemberProber{logger: log, web115Svc: NewWeb115Service(log)},
+		notifier:  notifier,
+		stopCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+	}
+}
+
+func (s *BalanceHealthService) Start() {
+	go s.loop()
+}
+
+func (s *BalanceHealthService) Stop() {
+	select {
+	case <-s.stoppedCh:
+		return
+	default:
+	}
+	close(s.stopCh)
+	<-s.stoppedCh
+}
+
+func (s *BalanceHealthService) loop() {
+	defer close(s.stoppedCh)
+	// 启动后稍等再做第一次检查，避开启动时的请求高峰
+	timer := time.NewTimer(time.Minute)
+	defer timer.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-timer.C:
+			if _, err := s.CheckAll(context.Background()); err != nil && s.logger != nil {
+				s.logger.Warnf("[match302-balance-health] 健康检查失败: %v", err)
+			}
+			timer.Reset(balanceHealthCheckInterval)
+		}
+	}
+}
+
+// CheckAll 检查所有启用的子账号成员，同一账号被多条规则引用时只探测一次，返回探测的账号数
+func (s *BalanceHealthService) CheckAll(ctx context.Context) (int, error) {
+	var members []model.Match302BalanceMember
+	if err := database.DB.Preload("CloudStorage").Where("enabled = ?", true).Find(&members).Error; err != nil {
+		return 0, err
+	}
+	groups := map[uint][]model.Match302BalanceMember{}
+	storageIDs := make([]uint, 0)
+	for _, member := range members {
+		if member.CloudStorage == nil {
+			continue
+		}
+		if _, ok := groups[member.CloudStorageID]; !ok {
+			storageIDs = append(storageIDs, member.CloudStorageID)
+		}
+		groups[member.CloudStorageID] = append(groups[member.CloudStorageID], member)
+	}
+	sort.Slice(storageIDs, func(i, j int) bool { return storageIDs[i] < storageIDs[j] })
+
+	checked := 0
+	for _, storageID := range storageIDs {
+		if err := ctx.Err(); err != nil {
+			return checked, err
+		}
+		group := groups[storageID]
+		s.checkStorage(ctx, *group[0].CloudStorage, group)
+		checked++
+	}
+	if err := database.DB.Where("checked_at < ?", time.Now().Add(-balanceHealthRetention)).
+		Delete(&model.Match302BalanceHealthCheck{}).Error; err != nil && s.logger != nil {
+		s.logger.Warnf("[match302-balance-health] 清理过期健康记录失败: %v", err)
+	}
+	return checked, nil
+}
+
+// CheckMember 立即检查某个成员所在的账号，引用同一账号的其他成员一并更新
+func (s *BalanceHealthService) CheckMember(ctx context.Context, matchID, memberID uint) (*model.Match302BalanceHealthCheck, error) {
+	var member model.Match302BalanceMember
+	if err := database.DB.Preload("CloudStorage").Where("id = ? AND match302_id = ?", memberID, matchID).First(&member).Error; err != nil {
+		return nil, err
+	}
+	if member.CloudStorage == nil {
+		return nil, fmt.Errorf("成员账号不存在")
+	}
+	var members []model.Match302BalanceMember
+	if err := database.DB.Where("cloud_storage_id = ? AND (enabled = ? OR id = ?)", member.CloudStorageID, true, member.ID).Find(&members).Error; err != nil {
+		return nil, err
+	}
+	check := s.checkStorage(ctx, *member.CloudStorage, members)
+	return &check, nil
+}
+
+// HealthTimeline 返回账号最近的健康检查记录(新的在前)
+func (s *BalanceHealthService) HealthTimeline(storageID uint, limit int) ([]model.Match302BalanceHealthCheck, error) {
+	if limit <= 0 || limit > 500 {
+		limit = 100
+	}
+	var checks []model.Match302BalanceHealthCheck
+	err := database.DB.Where("cloud_storage_id = ?", storageID).Order("checked_at DESC").Order("id DESC").Limit(limit).Find(&checks).Error
+	return checks, err
+}
+
+func (s *BalanceHealthService) checkStorage(ctx context.Context, storage model.CloudStorage, members []model.Match302BalanceMember) model.Match302BalanceHealthCheck {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	probe := s.prober.Probe(ctx, storage, balanceProbePickcode(storage.ID, members))
+	now := time.Now()
+	check := model.Match302BalanceHealthCheck{
+		CloudStorageID: storage.ID,
+		Healthy:        probe.Healthy(),
+		CookieOK:       probe.CookieOK,
+		FreeBytes:      probe.FreeBytes,
+		LinkChecked:    probe.LinkChecked,
+		LinkOK:         probe.LinkOK,
+		LatencyMs:      probe.Latency.Milliseconds(),
+		Error:          strings.Join(probe.Errors, "; "),
+		CheckedAt:      now,
+	}
+	if err := database.DB.Create(&check).Error; err != nil && s.logger != nil {
+		s.logger.Warnf("[match302-balance-health] 保存健康记录失败 storage=%d: %v", storage.ID, err)
+	}
+
+	wentDown, recovered := false, false
+	for _, member := range members {
+		updates := map[string]any{"health_checked_at": now}
+		if check.Healthy {
+			if member.Quarantined() {
+				recovered = true
+			}
+			updates["health_status"] = model.BalanceMemberHealthHealthy
+			updates["health_failures"] = 0
+			updates["quarantined_at"] = nil
+		} else {
+			failures := member.HealthFailures + 1
+			updates["health_failures"] = failures
+			updates["last_error"] = "健康检查失败: " + check.Error
+			updates["last_error_at"] = now
+			if failures >= balanceHealthQuarantineFailures {
+				if !member.Quarantined() {
+					wentDown = true
+					updates["quarantined_at"] = now
+				}
+				updates["health_status"] = model.BalanceMemberHealthDown
+			}
+		}
+		if err := database.DB.Model(&model.Match302BalanceMember{}).Where("id = ?", member.ID).Updates(updates).Error; err != nil && s.logger != nil {
+			s.logger.Warnf("[match302-balance-health] 更新成员健康状态失败 member=%d: %v", member.ID, err)
+		}
+	}
+
+	if s.logger != nil {
+		if check.Healthy {
+			s.logger.Debugf("[match302-balance-health] 账号 %s 健康 耗时=%dms", storage.StorageName, check.LatencyMs)
+		} else {
+			s.logger.Warnf("[match302-balance-health] 账号 %s 检查失败: %s", storage.StorageName, check.Error)
+		}
+	}
+	if wentDown {
+		s.notify(storage, check, true)
+	} else if recovered {
+		s.notify(storage, check, false)
+	}
+	return check
+}
+
+// balanceProbePickcode 优先使用成员配置的测试 pickcode，否则取该账号最近一个就绪缓存的 pickcode
+func balanceProbePickcode(storageID uint, members []model.Match302BalanceMember) string {
+	for _, member := range members {
+		if pickcode := strings.TrimSpace(member.ProbePickcode); pickcode != "" {
+			return pickcode
+		}
+	}
+	var assignment model.Match302BalanceAssignment
+	err := database.DB.Where("is_source_playback = ? AND playback_storage_id = ? AND status = ? AND cleanup_status NOT IN ? AND target_pickcode != ''",
+		false,
+		storageID,
+		model.BalanceAssignmentStatusReady,
+		[]string{model.BalanceCleanupStatusCleaning, model.BalanceCleanupStatusCleaned},
+	).Order("last_ready_at DESC").First(&assignment).Error
+	if err != nil {
+		return ""
+	}
+	return assignment.TargetPickcode
+}
+
+func (s *BalanceHealthService) notify(storage model.CloudStorage, check model.Match302BalanceHealthCheck, down bool) {
+	if s.notifier == nil {
+		return
+	}
+	event := NotificationEvent{
+		Type:       NotificationEventBalanceHealth,
+		OccurredAt: check.CheckedAt,
+		Metadata: map[string]string{
+			"storage_id":   fmt.Sprintf("%d", storage.ID),
+			"storage_name": storage.StorageName,
+		},
+	}
+	if down {
+		event.Title = "[302 子账号已隔离] " + notificationInstanceName(s.cfg)
+		event.Severity = NotificationSeverityCritical
+		event.Metadata["status"] = model.BalanceMemberHealthDown
+		event.Message = fmt.Sprintf("账号: %s\n连续 %d 次健康检查失败，已暂停参与负载均衡\n原因: %s\n时间: %s",
+			storage.StorageName, balanceHealthQuarantineFailures, check.Error, check.CheckedAt.Format("2006-01-02 15:04:05"))
+	} else {
+		event.Title = "[302 子账号已恢复] " + notificationInstanceName(s.cfg)
+		event.Severity = NotificationSeverityInfo
+		event.Metadata["status"] = model.BalanceMemberHealthHealthy
+		event.Message = fmt.Sprintf("账号: %s\n健康检查恢复正常，已重新参与负载均衡\n时间: %s",
+			storage.StorageName, check.CheckedAt.Format("2006-01-02 15:04:05"))
+	}
+	report := s.notifier.Publish(context.Background(), event)
+	if !report.Skipped && !report.AnySuccess() && s.logger != nil {
+		s.logger.Errorf("302 子账号健康通知发送失败(storage=%d name=%s): %s", storage.ID, storage.StorageName, report.FailureMessage())
+	}
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"context"
+	"testing"
+
+	"film-fusion/app/config"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyplayback"
+)
+
+type fakeBalanceMemberProber struct {
+	probe     BalanceHealthProbe
+	pickcodes []string
+}
+
+func (f *fakeBalanceMemberProber) Probe(_ context.Context, _ model.CloudStorage, pickcode string) BalanceHealthProbe {
+	f.pickcodes = append(f.pickcodes, pickcode)
+	return f.probe
+}
+
+type recordingBalanceHealthNotifier struct {
+	events []NotificationEvent
+}
+
+func (r *recordingBalanceHealthNotifier) Publish(_ context.Context, event NotificationEvent) NotificationReport {
+	r.events = append(r.events, event)
+	return NotificationReport{Event: event.Type, Deliveries: []NotificationDelivery{{Channel: "test", Success: true}}}
+}
+
+func (*recordingBalanceHealthNotifier) Ready(NotificationEventType) bool { return true }
+
+func TestBalanceHealthServiceQuarantinesAndRestoresMember(t *testing.T) {
+	embyplayback.Default().Clear()
+	db := setupBalanceServiceTestDB(t)
+	if err := db.AutoMigrate(&model.Match302BalanceHealthCheck{}); err != nil {
+		t.Fatalf("migrate health checks: %v", err)
+	}
+	_, target, match := createBalanceCacheBase(t, db, true)
+	member := model.Match302BalanceMember{
+		Match302ID:     match.ID,
+		CloudStorageID: target.ID,
+		Enabled:        true,
+		Weight:         1,
+		ProbePickcode:  "probe-pc",
+	}
+	if err := db.Create(&member).Error; err != nil {
+		t.Fatalf("create member: %v", err)
+	}
+
+	prober := &fakeBalanceMemberProber{probe: BalanceHealthProbe{CookieOK: true, FreeBytes: -1}}
+	notifier := &recordingBalanceHealthNotifier{}
+	svc := &BalanceHealthService{
+		logger:   logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+		prober:   prober,
+		notifier: notifier,
+	}
+	reload := func() model.Match302BalanceMember {
+		t.Helper()
+		var got model.Match302BalanceMember
+		if err := db.First(&got, member.ID).Error; err != nil {
+			t.Fatalf("reload member: %v", err)
+		}
+		return got
+	}
+	memberCandidate := func() bool {
+		t.Helper()
+		var m model.Match302
+		if err := db.Preload("CloudStorage").Preload("PoolMembers.CloudStorage").First(&m, match.ID).Error; err != nil {
+			t.Fatalf("reload match: %v", err)
+		}
+		candidates, _ := NewBalanceAssignmentService(nil).candidates(&m, "")
+		for _, candidate := range candidates {
+			if candidate.Storage.ID == target.ID {
+				return true
+			}
+		}
+		return false
+	}
+
+	if checked, err := svc.CheckAll(context.Background()); err != nil || checked != 1 {
+		t.Fatalf("CheckAll checked=%d err=%v", checked, err)
+	}
+	if got := reload(); got.HealthStatus != model.BalanceMemberHealthHealthy || got.HealthCheckedAt == nil {
+		t.Fatalf("member after healthy probe = %+v", got)
+	}
+	if len(prober.pickcodes) != 1 || prober.pickcodes[0] != "probe-pc" {
+		t.Fatalf("probe pickcodes = %v", prober.pickcodes)
+	}
+
+	prober.probe = BalanceHealthProbe{FreeBytes: -1, Errors: []string{"115 Cookie 无效"}}
+	svc.CheckAll(context.Background())
+	if got := reload(); got.Quarantined() || got.HealthFailures != 1 {
+		t.Fatalf("a single failure should not quarantine: %+v", got)
+	}
+	if len(notifier.events) != 0 {
+		t.Fatalf("unexpected notifications: %+v", notifier.events)
+	}
+
+	svc.CheckAll(context.Background())
+	got := reload()
+	if !got.Quarantined() || got.QuarantinedAt == nil || got.LastError == "" {
+		t.Fatalf("member should be quarantined: %+v", got)
+	}
+	if memberCandidate() {
+		t.Fatal("quarantined member should not be a balance candidate")
+	}
+	if len(notifier.events) != 1 || notifier.events[0].Type != NotificationEventBalanceHealth || notifier.events[0].Severity != NotificationSeverityCritical {
+		t.Fatalf("down notification = %+v", notifier.events)
+	}
+
+	svc.CheckAll(context.Background())
+	if len(notifier.events) != 1 {
+		t.Fatalf("staying down should not notify again: %d events", len(notifier.events))
+	}
+
+	prober.probe = BalanceHealthProbe{CookieOK: true, FreeBytes: 10 << 30, LinkChecked: true, LinkOK: true}
+	svc.CheckAll(context.Background())
+	if got := reload(); got.Quarantined() || got.HealthFailures != 0 || got.QuarantinedAt != nil {
+		t.Fatalf("member should be restored: %+v", got)
+	}
+	if !memberCandidate() {
+		t.Fatal("restored member should be a balance candidate again")
+	}
+	if len(notifier.events) != 2 || notifier.events[1].Severity != NotificationSeverityInfo {
+		t.Fatalf("restore notification = %+v", notifier.events)
+	}
+
+	checks, err := svc.HealthTimeline(target.ID, 10)
+	if err != nil || len(checks) != 5 {
+		t.Fatalf("timeline len=%d err=%v", len(checks), err)
+	}
+	if !checks[0].Healthy || checks[1].Healthy || checks[1].Error == "" {
+		t.Fatalf("timeline order/content unexpected: %+v", checks[:2])
+	}
+}
+
+func TestBalanceHealthProbeHealthy(t *testing.T) {
+	cases := []struct {
+		probe BalanceHealthProbe
+		want  bool
+	}{
+		{BalanceHealthProbe{CookieOK: true, FreeBytes: -1}, true},
+		{BalanceHealthProbe{CookieOK: false, FreeBytes: -1}, false},
+		{BalanceHealthProbe{CookieOK: true, FreeBytes: 100}, false},
+		{BalanceHealthProbe{CookieOK: true, FreeBytes: -1, LinkChecked: true}, false},
+		{BalanceHealthProbe{CookieOK: true, FreeBytes: 2 << 30, LinkChecked: true, LinkOK: true}, true},
+	}
+	for i, tc := range cases {
+		if got := tc.probe.Healthy(); got != tc.want {
+			t.Fatalf("case %d: Healthy() = %v, want %v", i, got, tc.want)
+		}
+	}
+}
@@ -8,7 +8,6 @@ import (
 	"net/http"
 	"net/url"
 	"path"
-	"sort"
 	"strings"
 	"time"
 
@@ -114,7 +113,7 @@ func (s *BalanceAssignmentService) FindMatch(filePath string) (*model.Match302,
 
 	for i := range matches {
 		match := &matches[i]
-		if match.CloudStorage == nil || match.CloudStorage.StorageType != model.StorageType115Open {
+		if match.CloudStorage == nil || !IsSupportedStorageType(match.CloudStorage.StorageType) {
 			continue
 		}
 		matchedPath := match.GetMatchedPath(filePath)
@@ -236,6 +235,19 @@ func (s *BalanceAssignmentService) ResolvePlayback(ctx context.Context, req Bala
 		match.CloudStorage = &storage
 	}
 
+	// OpenList / WebDAV 等按路径取直链的存储没有 pickcode，也不参与秒传负载均衡，直接由源存储播放。
+	if !match.CloudStorage.UsesPickcode() {
+		return &BalancePlaybackDecision{
+			Status:           "路径直链播放",
+			Match:            match,
+			SourceStorage:    match.CloudStorage,
+			PlaybackStorage:  match.CloudStorage,
+			SourceFile:       BalanceSourceFile{SourceFilePath: req.SourcePath, MatchedPath: pathhelper.EnsureLeadingSlash(req.MatchedPath)},
+			IsSourcePlayback: true,
+			AccountType:      "source",
+		}, nil
+	}
+
 	sourceInfo, err := s.ResolveSourceFileInfo(ctx, match, req.SourcePath, req.MatchedPath)
 	if err != nil {
 		return nil, err
@@ -1001,7 +1013,7 @@ func (s *BalanceAssignmentService) ensureAssignment(ctx context.Context, match *
 		if len(candidates) == 0 {
 			return nil, errNoBalanceCandidate
 		}
-		selected := s.selectCandidate(candidates, playbackKey)
+		selected := s.selectCandidate(match, candidates, playbackKey, sourceInfo.Size)
 		if err := s.rematerializeAssignment(&existing, match, sourceInfo, selected, embyItemID, mediaSourceID); err != nil {
 			return nil, err
 		}
@@ -1017,7 +1029,7 @@ func (s *BalanceAssignmentService) ensureAssignment(ctx context.Context, match *
 		return nil, errNoBalanceCandidate
 	}
 
-	selected := s.selectCandidate(candidates, playbackKey)
+	selected := s.selectCandidate(match, candidates, playbackKey, sourceInfo.Size)
 	now := time.Now()
 	expiresAt := now.Add(time.Duration(match.RetentionHours) * time.Hour)
 	assignment := &model.Match302BalanceAssignment{
@@ -1135,7 +1147,7 @@ func (s *BalanceAssignmentService) candidates(match *model.Match302, excludeKey
 	}
 	for i := range members {
 		member := members[i]
-		if !member.Enabled || member.CloudStorage == nil {
+		if !member.Enabled || member.CloudStorage == nil || member.Quarantined() {
 			continue
 		}
 		storage := *member.CloudStorage
@@ -1164,20 +1176,28 @@ func (s *BalanceAssignmentService) candidates(match *model.Match302, excludeKey
 	return out, ""
 }
 
-func (s *BalanceAssignmentService) selectCandidate(candidates []balanceCandidate, excludeKey string) balanceCandidate {
-	activeCounts := activePlaybackCountsByStorageExcept(excludeKey)
-	sort.SliceStable(candidates, func(i, j int) bool {
-		left := activeCounts[candidates[i].Storage.ID] * positiveWeight(candidates[j].Weight)
-		right := activeCounts[candidates[j].Storage.ID] * positiveWeight(candidates[i].Weight)
-		if left != right {
-			return left < right
-		}
-		if candidates[i].SortOrder != candidates[j].SortOrder {
-			return candidates[i].SortOrder < candidates[j].SortOrder
-		}
-		return candidates[i].Storage.ID < candidates[j].Storage.ID
-	})
-	return candidates[0]
+// selectCandidate 按 Match302 配置的负载均衡策略从候选账号中选择一个
+func (s *BalanceAssignmentService) selectCandidate(match *model.Match302, candidates []balanceCandidate, excludeKey string, fileSize int64) balanceCandidate {
+	in := balanceSelectionInput{
+		MatchID:      match.ID,
+		FileSize:     fileSize,
+		ActiveCounts: activePlaybackCountsByStorageExcept(excludeKey),
+	}
+	switch match.BalanceStrategy {
+	case model.Match302BalanceStrategyFreeQuota:
+		storageIDs := make([]uint, 0, len(candidates))
+		for _, candidate := range candidates {
+			if !candidate.IsSource {
+				storageIDs = append(storageIDs, candidate.Storage.ID)
+			}
+		}
+		in.CacheUsedBytes = match302CacheUsageByStorage(storageIDs)
+	case model.Match302BalanceStrategyLatencyAware:
+		in.Latency = defaultBalanceLatency.snapshot(time.Now())
+	}
+	selected := balanceStrategyFor(match.BalanceStrategy).Select(candidates, in)
+	s.logger.Debugf("[BALANCE] match=%d strategy=%s 选择账号 storage=%d source=%v", match.ID, match.BalanceStrategy, selected.Storage.ID, selected.IsSource)
+	return selected
 }
 
 func (s *BalanceAssignmentService) enforceStrictLimit(match *model.Match302, decision *BalancePlaybackDecision, sourcePickcode, playbackKey string) error {
@@ -0,0 +1,265 @@
+package service
+
+import (
+	"math"
+	"sort"
+	"sync"
+	"time"
+
+	"film-fusion/app/database"
+	"film-fusion/app/model"
+)
+
+const (
+	// balanceLatencyFailurePenalty 获取直链失败时按该耗时计入，使失败的账号自然排到后面
+	balanceLatencyFailurePenalty = 10 * time.Second
+	// balanceLatencySampleTTL 超过该时间未更新的耗时样本视为未知
+	balanceLatencySampleTTL = 30 * time.Minute
+	balanceLatencyEWMAAlpha = 0.3
+)
+
+// balanceSelectionInput 选择候选账号时用到的运行状态，由 selectCandidate 采集，测试中可直接构造
+type balanceSelectionInput struct {
+	MatchID        uint
+	FileSize       int64
+	ActiveCounts   map[uint]int
+	CacheUsedBytes map[uint]int64         // free_quota：各子账号已占用的缓存字节数
+	Latency        map[uint]time.Duration // latency_aware：各账号最近获取直链的平均耗时
+}
+
+// balanceStrategy Match302 负载均衡策略，candidates 非空
+type balanceStrategy interface {
+	Select(candidates []balanceCandidate, in balanceSelectionInput) balanceCandidate
+}
+
+var defaultWeightedRoundRobin = newWeightedRoundRobinStrategy()
+
+func balanceStrategyFor(name string) balanceStrategy {
+	switch name {
+	case model.Match302BalanceStrategyWeightedRoundRobin:
+		return defaultWeightedRoundRobin
+	case model.Match302BalanceStrategyFreeQuota:
+		return freeQuotaStrategy{}
+	case model.Match302BalanceStrategyLatencyAware:
+		return latencyAwareStrategy{}
+	case model.Match302BalanceStrategySourceFirst:
+		return sourceFirstStrategy{}
+	default:
+		return stickyLeastActiveStrategy{}
+	}
+}
+
+// weightedLeastActiveLess 按 活跃数/权重 升序，其次 SortOrder、存储 ID
+func weightedLeastActiveLess(a, b balanceCandidate, activeCounts map[uint]int) bool {
+	left := activeCounts[a.Storage.ID] * positiveWeight(b.Weight)
+	right := activeCounts[b.Storage.ID] * positiveWeight(a.Weight)
+	if left != right {
+		return left < right
+	}
+	if a.SortOrder != b.SortOrder {
+		return a.SortOrder < b.SortOrder
+	}
+	return a.Storage.ID < b.Storage.ID
+}
+
+// stickyLeastActiveStrategy 默认策略：按权重选择当前活跃播放最少的账号
+type stickyLeastActiveStrategy struct{}
+
+func (stickyLeastActiveStrategy) Select(candidates []balanceCandidate, in balanceSelectionInput) balanceCandidate {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return weightedLeastActiveLess(candidates[i], candidates[j], in.ActiveCounts)
+	})
+	return candidates[0]
+}
+
+// weightedRoundRobinStrategy 平滑加权轮询，每条 Match302 规则独立维护轮询状态
+type weightedRoundRobinStrategy struct {
+	mu      sync.Mutex
+	current map[uint]map[uint]int // match302 ID -> storage ID -> 当前权重
+}
+
+func newWeightedRoundRobinStrategy() *weightedRoundRobinStrategy {
+	return &weightedRoundRobinStrategy{current: make(map[uint]map[uint]int)}
+}
+
+func (s *weightedRoundRobinStrategy) Select(candidates []balanceCandidate, in balanceSelectionInput) balanceCandidate {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.current[in.MatchID]
+	if state == nil {
+		state = make(map[uint]int)
+		s.current[in.MatchID] = state
+	}
+	// 候选集会因并发上限、账号停用而变化，只保留当前候选的状态
+	present := make(map[uint]bool, len(candidates))
+	total := 0
+	best := -1
+	for i, candidate := range candidates {
+		id := candidate.Storage.ID
+		present[id] = true
+		weight := positiveWeight(candidate.Weight)
+		total += weight
+		state[id] += weight
+		if best < 0 || state[id] > state[candidates[best].Storage.ID] ||
+			(state[id] == state[candidates[best].Storage.ID] && weightedLeastActiveLess(candidate, candidates[best], nil)) {
+			best = i
+		}
+	}
+	for id := range state {
+		if !present[id] {
+			delete(state, id)
+		}
+	}
+	state[candidates[best].Storage.ID] -= total
+	return candidates[best]
+}
+
+// freeQuotaStrategy 优先剩余缓存空间最多的子账号(未设上限视为无限)；
+// 没有子账号放得下当前文件时使用源账号，源账号不可用时再选需要清理旧缓存的子账号。
+type freeQuotaStrategy struct{}
+
+func (freeQuotaStrategy) remaining(candidate balanceCandidate, in balanceSelectionInput) int64 {
+	quotaGB := candidate.Storage.Match302CacheMaxGB
+	if quotaGB <= 0 {
+		return math.MaxInt64
+	}
+	return quotaGB*1024*1024*1024 - in.CacheUsedBytes[candidate.Storage.ID]
+}
+
+func (s freeQuotaStrategy) Select(candidates []balanceCandidate, in balanceSelectionInput) balanceCandidate {
+	rank := func(candidate balanceCandidate) int {
+		switch {
+		case candidate.IsSource:
+			return 1
+		case s.remaining(candidate, in) >= in.FileSize:
+			return 0
+		default:
+			return 2
+		}
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		left, right := candidates[i], candidates[j]
+		if rank(left) != rank(right) {
+			return rank(left) < rank(right)
+		}
+		if !left.IsSource && !right.IsSource {
+			if l, r := s.remaining(left, in), s.remaining(right, in); l != r {
+				return l > r
+			}
+		}
+		return weightedLeastActiveLess(left, right, in.ActiveCounts)
+	})
+	return candidates[0]
+}
+
+// latencyAwareStrategy 优先最近获取直链最快的账号，耗时按 (活跃数+1)/权重 放大以免流量全部压到同一账号；
+// 没有耗时样本的账号排在最前，以便尽快测得耗时。
+type latencyAwareStrategy struct{}
+
+func (latencyAwareStrategy) Select(candidates []balanceCandidate, in balanceSelectionInput) balanceCandidate {
+	score := func(candidate balanceCandidate) float64 {
+		latency, ok := in.Latency[candidate.Storage.ID]
+		if !ok {
+			return -1
+		}
+		return float64(latency) * float64(in.ActiveCounts[candidate.Storage.ID]+1) / float64(positiveWeight(candidate.Weight))
+	}
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if l, r := score(candidates[i]), score(candidates[j]); l != r {
+			return l < r
+		}
+		return weightedLeastActiveLess(candidates[i], candidates[j], in.ActiveCounts)
+	})
+	return candidates[0]
+}
+
+// sourceFirstStrategy 源账号可用(未达并发上限)时始终使用源账号，满载后溢出到子账号池
+type sourceFirstStrategy struct{}
+
+func (sourceFirstStrategy) Select(candidates []balanceCandidate, in balanceSelectionInput) balanceCandidate {
+	for _, candidate := range candidates {
+		if candidate.IsSource {
+			return candidate
+		}
+	}
+	return stickyLeastActiveStrategy{}.Select(candidates, in)
+}
+
+// match302CacheUsageByStorage 统计各子账号当前占用的 Match302 缓存字节数，口径与 cleanupStorageCacheForQuota 一致
+func match302CacheUsageByStorage(storageIDs []uint) map[uint]int64 {
+	usage := make(map[uint]int64, len(storageIDs))
+	if len(storageIDs) == 0 {
+		return usage
+	}
+	var rows []struct {
+		PlaybackStorageID uint
+		Used              int64
+	}
+	if err := database.DB.Model(&model.Match302BalanceAssignment{}).
+		Select("playback_storage_id, COALESCE(SUM(size), 0) AS used").
+		Where("is_source_playback = ? AND playback_storage_id IN ? AND status = ? AND cleanup_status NOT IN ?",
+			false,
+			storageIDs,
+			model.BalanceAssignmentStatusReady,
+			[]string{model.BalanceCleanupStatusCleaning, model.BalanceCleanupStatusCleaned},
+		).
+		Group("playback_storage_id").
+		Scan(&rows).Error; err != nil {
+		return usage
+	}
+	for _, row := range rows {
+		usage[row.PlaybackStorageID] = row.Used
+	}
+	return usage
+}
+
+type balanceLatencySample struct {
+	avg       time.Duration
+	updatedAt time.Time
+}
+
+// balanceLatencyTracker 记录各账号获取直链耗时的指数滑动平均，供 latency_aware 策略使用
+type balanceLatencyTracker struct {
+	mu      sync.RWMutex
+	samples map[uint]balanceLatencySample
+}
+
+var defaultBalanceLatency = &balanceLatencyTracker{samples: make(map[uint]balanceLatencySample)}
+
+// RecordBalanceLinkLatency 记录一次实际请求网盘获取直链的耗时(命中直链缓存不应记录)
+func RecordBalanceLinkLatency(storageID uint, elapsed time.Duration, err error) {
+	if storageID == 0 {
+		return
+	}
+	recordDownloadURLDuration(storageID, elapsed, err)
+	if err != nil && elapsed < balanceLatencyFailurePenalty {
+		elapsed = balanceLatencyFailurePenalty
+	}
+	defaultBalanceLatency.record(storageID, elapsed, time.Now())
+}
+
+func (t *balanceLatencyTracker) record(storageID uint, elapsed time.Duration, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	sample, ok := t.samples[storageID]
+	if !ok || now.Sub(sample.updatedAt) > balanceLatencySampleTTL {
+		sample.avg = elapsed
+	} else {
+		sample.avg = time.Duration(balanceLatencyEWMAAlpha*float64(elapsed) + (1-balanceLatencyEWMAAlpha)*float64(sample.avg))
+	}
+	sample.updatedAt = now
+	t.samples[storageID] = sample
+}
+
+func (t *balanceLatencyTracker) snapshot(now time.Time) map[uint]time.Duration {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	out := make(map[uint]time.Duration, len(t.samples))
+	for id, sample := range t.samples {
+		if now.Sub(sample.updatedAt) <= balanceLatencySampleTTL {
+			out[id] = sample.avg
+		}
+	}
+	return out
+}
@@ -0,0 +1,140 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"film-fusion/app/model"
+)
+
+func fakeBalanceCandidates() []balanceCandidate {
+	return []balanceCandidate{
+		{Storage: model.CloudStorage{ID: 1}, IsSource: true, Weight: 1, SortOrder: 0},
+		{Storage: model.CloudStorage{ID: 2, Match302CacheMaxGB: 100}, Weight: 2, SortOrder: 1},
+		{Storage: model.CloudStorage{ID: 3, Match302CacheMaxGB: 50}, Weight: 1, SortOrder: 2},
+	}
+}
+
+func selectBalanceStorage(strategy balanceStrategy, in balanceSelectionInput) uint {
+	return strategy.Select(fakeBalanceCandidates(), in).Storage.ID
+}
+
+func TestStickyLeastActiveStrategy(t *testing.T) {
+	in := balanceSelectionInput{ActiveCounts: map[uint]int{1: 1, 2: 1, 3: 0}}
+	if got := selectBalanceStorage(stickyLeastActiveStrategy{}, in); got != 3 {
+		t.Fatalf("idle storage should win, got %d", got)
+	}
+	// 2 的权重为 2，1 个活跃等价于权重 1 的 0.5 个
+	in.ActiveCounts = map[uint]int{1: 1, 2: 1, 3: 1}
+	if got := selectBalanceStorage(stickyLeastActiveStrategy{}, in); got != 2 {
+		t.Fatalf("heavier weight should win, got %d", got)
+	}
+}
+
+func TestWeightedRoundRobinStrategy(t *testing.T) {
+	strategy := newWeightedRoundRobinStrategy()
+	counts := map[uint]int{}
+	for i := 0; i < 8; i++ {
+		counts[selectBalanceStorage(strategy, balanceSelectionInput{MatchID: 1})]++
+	}
+	if counts[1] != 2 || counts[2] != 4 || counts[3] != 2 {
+		t.Fatalf("distribution = %v, want 1:2, 2:4, 3:2", counts)
+	}
+
+	// 不同规则互不影响
+	if got := selectBalanceStorage(strategy, balanceSelectionInput{MatchID: 2}); got != 2 {
+		t.Fatalf("first pick of a new match should be the heaviest, got %d", got)
+	}
+
+	// 候选集变化后不再为已移除的账号保留状态
+	strategy.Select(fakeBalanceCandidates()[:2], balanceSelectionInput{MatchID: 1})
+	if _, ok := strategy.current[1][3]; ok {
+		t.Fatalf("state for removed candidate should be dropped")
+	}
+}
+
+func TestFreeQuotaStrategy(t *testing.T) {
+	const gb = int64(1024 * 1024 * 1024)
+	in := balanceSelectionInput{
+		FileSize:       10 * gb,
+		CacheUsedBytes: map[uint]int64{2: 95 * gb, 3: 10 * gb},
+	}
+	if got := selectBalanceStorage(freeQuotaStrategy{}, in); got != 3 {
+		t.Fatalf("member with most remaining space should win, got %d", got)
+	}
+
+	in.CacheUsedBytes = map[uint]int64{2: 95 * gb, 3: 45 * gb}
+	if got := selectBalanceStorage(freeQuotaStrategy{}, in); got != 1 {
+		t.Fatalf("source should be used when no member has room, got %d", got)
+	}
+
+	members := fakeBalanceCandidates()[1:]
+	if got := (freeQuotaStrategy{}).Select(members, in).Storage.ID; got != 2 {
+		t.Fatalf("without source, member with most remaining space should win, got %d", got)
+	}
+
+	unlimited := append(fakeBalanceCandidates(), balanceCandidate{Storage: model.CloudStorage{ID: 4}, Weight: 1, SortOrder: 3})
+	if got := (freeQuotaStrategy{}).Select(unlimited, in).Storage.ID; got != 4 {
+		t.Fatalf("member without quota should be treated as unlimited, got %d", got)
+	}
+}
+
+func TestLatencyAwareStrategy(t *testing.T) {
+	in := balanceSelectionInput{
+		ActiveCounts: map[uint]int{},
+		Latency:      map[uint]time.Duration{1: 800 * time.Millisecond, 2: 600 * time.Millisecond, 3: 200 * time.Millisecond},
+	}
+	if got := selectBalanceStorage(latencyAwareStrategy{}, in); got != 3 {
+		t.Fatalf("fastest storage should win, got %d", got)
+	}
+
+	in.ActiveCounts = map[uint]int{3: 3}
+	if got := selectBalanceStorage(latencyAwareStrategy{}, in); got != 2 {
+		t.Fatalf("busy fast storage should yield, got %d", got)
+	}
+
+	delete(in.Latency, 1)
+	if got := selectBalanceStorage(latencyAwareStrategy{}, in); got != 1 {
+		t.Fatalf("storage without samples should be probed first, got %d", got)
+	}
+}
+
+func TestSourceFirstStrategy(t *testing.T) {
+	in := balanceSelectionInput{ActiveCounts: map[uint]int{1: 5}}
+	if got := selectBalanceStorage(sourceFirstStrategy{}, in); got != 1 {
+		t.Fatalf("source should be used while it is a candidate, got %d", got)
+	}
+
+	// 源账号达到并发上限时不在候选中，溢出到子账号
+	members := fakeBalanceCandidates()[1:]
+	in.ActiveCounts = map[uint]int{2: 2, 3: 0}
+	if got := (sourceFirstStrategy{}).Select(members, in).Storage.ID; got != 3 {
+		t.Fatalf("overflow should pick the least active member, got %d", got)
+	}
+}
+
+func TestBalanceLatencyTracker(t *testing.T) {
+	tracker := &balanceLatencyTracker{samples: make(map[uint]balanceLatencySample)}
+	now := time.Now()
+	tracker.record(1, time.Second, now)
+	tracker.record(1, 2*time.Second, now)
+	if got := tracker.snapshot(now)[1]; got != 1300*time.Millisecond {
+		t.Fatalf("ewma = %v", got)
+	}
+	if _, ok := tracker.snapshot(now.Add(balanceLatencySampleTTL + time.Second))[1]; ok {
+		t.Fatalf("stale samples should be ignored")
+	}
+}
+
+func TestMatch302NormalizeBalanceStrategy(t *testing.T) {
+	match := model.Match302{BalanceStrategy: "unknown"}
+	match.NormalizeBalanceDefaults()
+	if match.BalanceStrategy != model.Match302BalanceStrategyStickyLeastActive {
+		t.Fatalf("unknown strategy should fall back to default, got %s", match.BalanceStrategy)
+	}
+	match.BalanceStrategy = model.Match302BalanceStrategyFreeQuota
+	match.NormalizeBalanceDefaults()
+	if match.BalanceStrategy != model.Match302BalanceStrategyFreeQuota {
+		t.Fatalf("valid strategy should be kept, got %s", match.BalanceStrategy)
+	}
+}
@@ -0,0 +1,279 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyplayback"
+	"film-fusion/app/utils/embyhelper"
+	"film-fusion/app/utils/pathhelper"
+)
+
+const (
+	balancePrefetchInterval = 30 * time.Second
+	// 同一集在同一账号上处理过后，在此时间内不再重复预取
+	balancePrefetchSeenTTL = 6 * time.Hour
+)
+
+// balanceEpisodeLister 查询后续剧集，由 EmbyClient 实现
+type balanceEpisodeLister interface {
+	NextEpisodes(itemID string, count int) ([]embyhelper.EpisodeItem, error)
+}
+
+// balancePrefetcher 预取需要的分配能力，由 BalanceAssignmentService 实现
+type balancePrefetcher interface {
+	FindMatch(filePath string) (*model.Match302, string, error)
+	PrefetchAssignment(ctx context.Context, req BalancePlaybackRequest, preferredStorageID uint) (*model.Match302BalanceAssignment, error)
+}
+
+// BalancePrefetchService 观察当前播放会话，在观看剧集时把后续 N 集提前秒传到子账号，
+// 连续观看时下一集可直接命中 ready 缓存，不必在 waitReady 中等待秒传。
+type BalancePrefetchService struct {
+	logger   *logger.Logger
+	balance  balancePrefetcher
+	episodes balanceEpisodeLister
+	sessions *embyplayback.Store
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+
+	stopCh    chan struct{}
+	stoppedCh chan struct{}
+}
+
+func NewBalancePrefetchService(log *logger.Logger, balanceSvc *BalanceAssignmentService, embyClient *embyhelper.EmbyClient) *BalancePrefetchService {
+	return &BalancePrefetchService{
+		logger:    log,
+		balance:   balanceSvc,
+		episodes:  embyClient,
+		sessions:  embyplayback.Default(),
+		seen:      make(map[string]time.Time),
+		stopCh:    make(chan struct{}),
+		stoppedCh: make(chan struct{}),
+	}
+}
+
+func (s *BalancePrefetchService) Start() {
+	go s.loop()
+}
+
+func (s *BalancePrefetchService) Stop() {
+	select {
+	case <-s.stoppedCh:
+		return
+	default:
+	}
+	close(s.stopCh)
+	<-s.stoppedCh
+}
+
+func (s *BalancePrefetchService) loop() {
+	defer close(s.stoppedCh)
+	ticker := time.NewTicker(balancePrefetchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-s.stopCh:
+			return
+		case <-ticker.C:
+			if _, err := s.Scan(context.Background()); err != nil && s.logger != nil {
+				s.logger.Warnf("[match302-balance-prefetch] 扫描失败: %v", err)
+			}
+		}
+	}
+}
+
+// Scan 扫描一次当前播放会话并为开启预取的规则预取后续剧集，返回本次新建的预取分配数
+func (s *BalancePrefetchService) Scan(ctx context.Context) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for key, at := range s.seen {
+		if now.Sub(at) > balancePrefetchSeenTTL {
+			delete(s.seen, key)
+		}
+	}
+
+	matches := map[uint]*model.Match302{}
+	prefetched := 0
+	for _, session := range s.sessions.Snapshot() {
+		if session.Match302ID == 0 || strings.TrimSpace(session.ItemID) == "" {
+			continue
+		}
+		seenKey := fmt.Sprintf("%s|%d", session.ItemID, session.ActualStorageID)
+		if _, ok := s.seen[seenKey]; ok {
+			continue
+		}
+		match, ok := matches[session.Match302ID]
+		if !ok {
+			match = s.loadMatch(session.Match302ID)
+			matches[session.Match302ID] = match
+		}
+		if match == nil || !match.BalanceEnabled || match.PrefetchEpisodes <= 0 {
+			continue
+		}
+		s.seen[seenKey] = now
+
+		var preferredStorageID uint
+		if session.AccountType == "member" {
+			preferredStorageID = session.ActualStorageID
+		}
+		episodes, err := s.episodes.NextEpisodes(session.ItemID, match.PrefetchEpisodes)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Warnf("[match302-balance-prefetch] 获取后续剧集失败 item=%s err=%v", session.ItemID, err)
+			}
+			continue
+		}
+		for _, episode := range episodes {
+			if err := ctx.Err(); err != nil {
+				return prefetched, err
+			}
+			if s.prefetchEpisode(ctx, episode, preferredStorageID) {
+				prefetched++
+			}
+		}
+	}
+	return prefetched, nil
+}
+
+func (s *BalancePrefetchService) loadMatch(matchID uint) *model.Match302 {
+	var match model.Match302
+	if err := database.DB.First(&match, matchID).Error; err != nil {
+		return nil
+	}
+	match.NormalizeBalanceDefaults()
+	return &match
+}
+
+// prefetchEpisode 预取单集的全部媒体源，任一媒体源建立了预取分配即返回 true
+func (s *BalancePrefetchService) prefetchEpisode(ctx context.Context, episode embyhelper.EpisodeItem, preferredStorageID uint) bool {
+	sources := episode.MediaSources
+	if len(sources) == 0 {
+		sources = []embyhelper.EpisodeMediaSource{{Path: episode.Path}}
+	}
+	prefetched := false
+	for _, source := range sources {
+		if strings.TrimSpace(source.Path) == "" {
+			continue
+		}
+		mediaPath := pathhelper.EnsureLeadingSlash(source.Path)
+		match, matchedPath, err := s.balance.FindMatch(mediaPath)
+		if err != nil || match == nil || !match.BalanceEnabled || match.PrefetchEpisodes <= 0 {
+			continue
+		}
+		if match.CloudStorage == nil || !match.CloudStorage.UsesPickcode() {
+			continue
+		}
+		assignment, err := s.balance.PrefetchAssignment(ctx, BalancePlaybackRequest{
+			Match:         match,
+			SourcePath:    mediaPath,
+			MatchedPath:   matchedPath,
+			EmbyItemID:    episode.ID,
+			MediaSourceID: source.ID,
+		}, preferredStorageID)
+		if err != nil {
+			if s.logger != nil {
+				s.logger.Warnf("[match302-balance-prefetch] 预取失败 item=%s path=%s err=%v", episode.ID, mediaPath, err)
+			}
+			continue
+		}
+		if assignment != nil {
+			prefetched = true
+			if s.logger != nil {
+				s.logger.Infof("[match302-balance-prefetch] 已预取 item=%s path=%s storage=%d", episode.ID, mediaPath, assignment.PlaybackStorageID)
+			}
+		}
+	}
+	return prefetched
+}
+
+// PrefetchAssignment 为即将播放的文件提前秒传到子账号。
+// 优先使用 preferredStorageID(通常是当前会话所在的子账号)，不可用时按规则策略在子账号中选择。
+// 预取只使用子账号剩余的缓存配额，不会为腾出空间清理已就绪的缓存(MinKeepReady 保留的资源也不会被挤掉)；
+// 已有可用分配、没有可用子账号或配额不足时返回 nil。
+func (s *BalanceAssignmentService) PrefetchAssignment(ctx context.Context, req BalancePlaybackRequest, preferredStorageID uint) (*model.Match302BalanceAssignment, error) {
+	if req.Match == nil || !req.Match.BalanceEnabled {
+		return nil, nil
+	}
+	match := req.Match
+	match.NormalizeBalanceDefaults()
+	if match.CloudStorage == nil {
+		var storage model.CloudStorage
+		if err := database.DB.First(&storage, match.CloudStorageID).Error; err != nil {
+			return nil, err
+		}
+		match.CloudStorage = &storage
+	}
+	if strings.TrimSpace(match.CloudStorage.Cookie) == "" || !storageUsable(*match.CloudStorage) {
+		return nil, nil
+	}
+
+	var existing model.Match302BalanceAssignment
+	err := database.DB.Where("match302_id = ? AND source_file_path = ? AND forced = ?", match.ID, req.SourcePath, false).First(&existing).Error
+	if err == nil && assignmentCacheReusable(&existing, time.Now()) {
+		return nil, nil
+	}
+
+	sourceInfo, err := s.ResolveSourceFileInfo(ctx, match, req.SourcePath, req.MatchedPath)
+	if err != nil {
+		return nil, err
+	}
+	candidates, _ := s.candidates(match, "")
+	selected, ok := s.prefetchCandidate(match, candidates, preferredStorageID, sourceInfo.Size)
+	if !ok {
+		return nil, nil
+	}
+	assignment, err := s.ensureAssignment(ctx, match, sourceInfo, []balanceCandidate{selected}, req.EmbyItemID, req.MediaSourceID, "")
+	if errors.Is(err, errNoBalanceCandidate) {
+		return nil, nil
+	}
+	return assignment, err
+}
+
+// prefetchCandidate 选出预取的目标子账号；源账号本身无需预取，缓存配额放不下的子账号会被排除
+func (s *BalanceAssignmentService) prefetchCandidate(match *model.Match302, candidates []balanceCandidate, preferredStorageID uint, fileSize int64) (balanceCandidate, bool) {
+	members := make([]balanceCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if candidate.IsSource || !match302CacheHasRoom(candidate.Storage, fileSize) {
+			continue
+		}
+		if preferredStorageID != 0 && candidate.Storage.ID == preferredStorageID {
+			return candidate, true
+		}
+		members = append(members, candidate)
+	}
+	if len(members) == 0 {
+		return balanceCandidate{}, false
+	}
+	return s.selectCandidate(match, members, "", fileSize), true
+}
+
+// match302CacheHasRoom 判断子账号在不清理已有缓存的前提下能否再放下 size 字节，正在秒传的分配也计入占用
+func match302CacheHasRoom(storage model.CloudStorage, size int64) bool {
+	if storage.Match302CacheMaxGB <= 0 {
+		return true
+	}
+	quotaBytes := storage.Match302CacheMaxGB * 1024 * 1024 * 1024
+	var committed int64
+	if err := database.DB.Model(&model.Match302BalanceAssignment{}).
+		Where("is_source_playback = ? AND playback_storage_id = ? AND status IN ? AND cleanup_status NOT IN ?",
+			false,
+			storage.ID,
+			[]string{model.BalanceAssignmentStatusPending, model.BalanceAssignmentStatusTransferring, model.BalanceAssignmentStatusReady},
+			[]string{model.BalanceCleanupStatusCleaning, model.BalanceCleanupStatusCleaned},
+		).
+		Select("COALESCE(SUM(size), 0)").
+		Scan(&committed).Error; err != nil {
+		return false
+	}
+	return committed+size <= quotaBytes
+}
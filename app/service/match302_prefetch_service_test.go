@@ -0,0 +1,164 @@
+package service
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyplayback"
+	"film-fusion/app/store/embyproxylog"
+	"film-fusion/app/utils/embyhelper"
+)
+
+func TestPrefetchCandidatePrefersSessionAccountAndSkipsFullQuota(t *testing.T) {
+	db := setupBalanceServiceTestDB(t)
+	_, target, match := createBalanceCacheBase(t, db, true)
+
+	other := model.CloudStorage{
+		UserID:      1,
+		StorageType: model.StorageType115Open,
+		StorageName: "other",
+		ProviderUID: "other",
+		Cookie:      "other-cookie",
+		Status:      model.StatusActive,
+	}
+	if err := db.Create(&other).Error; err != nil {
+		t.Fatalf("create other storage: %v", err)
+	}
+	target.Match302CacheMaxGB = 1
+	if err := db.Save(&target).Error; err != nil {
+		t.Fatalf("update target quota: %v", err)
+	}
+	candidates := []balanceCandidate{
+		{Storage: model.CloudStorage{ID: match.CloudStorageID}, IsSource: true, Weight: 1},
+		{Storage: other, Weight: 1},
+		{Storage: target, Weight: 1},
+	}
+	svc := NewBalanceAssignmentService(logger.New(config.LogConfig{Level: "error", Output: "stdout"}))
+
+	selected, ok := svc.prefetchCandidate(&match, candidates, target.ID, 512*1024*1024)
+	if !ok || selected.Storage.ID != target.ID {
+		t.Fatalf("selected = %d ok=%v, want session storage %d", selected.Storage.ID, ok, target.ID)
+	}
+
+	// 正在秒传的分配也占用配额，预取不能挤掉已有缓存
+	if err := db.Create(&model.Match302BalanceAssignment{
+		Match302ID:        match.ID,
+		SourceFilePath:    "/media/source/show/e01.mkv",
+		SourceStorageID:   match.CloudStorageID,
+		PlaybackStorageID: target.ID,
+		Size:              700 * 1024 * 1024,
+		Status:            model.BalanceAssignmentStatusTransferring,
+		CleanupStatus:     model.BalanceCleanupStatusNone,
+	}).Error; err != nil {
+		t.Fatalf("create assignment: %v", err)
+	}
+	selected, ok = svc.prefetchCandidate(&match, candidates, target.ID, 512*1024*1024)
+	if !ok || selected.Storage.ID != other.ID {
+		t.Fatalf("selected = %d ok=%v, want fallback storage %d", selected.Storage.ID, ok, other.ID)
+	}
+
+	if _, ok := svc.prefetchCandidate(&match, candidates[:1], 0, 1); ok {
+		t.Fatal("source account should never be a prefetch target")
+	}
+}
+
+type fakeBalanceEpisodeLister struct {
+	calls    int
+	episodes []embyhelper.EpisodeItem
+}
+
+func (f *fakeBalanceEpisodeLister) NextEpisodes(itemID string, count int) ([]embyhelper.EpisodeItem, error) {
+	f.calls++
+	if count < len(f.episodes) {
+		return f.episodes[:count], nil
+	}
+	return f.episodes, nil
+}
+
+type prefetchCall struct {
+	itemID             string
+	sourcePath         string
+	preferredStorageID uint
+}
+
+type fakeBalancePrefetcher struct {
+	match *model.Match302
+	calls []prefetchCall
+}
+
+func (f *fakeBalancePrefetcher) FindMatch(filePath string) (*model.Match302, string, error) {
+	return f.match, f.match.GetMatchedPath(filePath), nil
+}
+
+func (f *fakeBalancePrefetcher) PrefetchAssignment(_ context.Context, req BalancePlaybackRequest, preferredStorageID uint) (*model.Match302BalanceAssignment, error) {
+	f.calls = append(f.calls, prefetchCall{itemID: req.EmbyItemID, sourcePath: req.SourcePath, preferredStorageID: preferredStorageID})
+	return &model.Match302BalanceAssignment{PlaybackStorageID: preferredStorageID}, nil
+}
+
+func TestBalancePrefetchServiceScan(t *testing.T) {
+	db := setupBalanceServiceTestDB(t)
+	source, target, match := createBalanceCacheBase(t, db, true)
+	match.PrefetchEpisodes = 2
+	if err := db.Save(&match).Error; err != nil {
+		t.Fatalf("enable prefetch: %v", err)
+	}
+	match.CloudStorage = &source
+
+	sessions := embyplayback.NewStore()
+	sessions.AttachRedirect(embyproxylog.Entry{
+		Timestamp:       time.Now(),
+		ItemID:          "ep-1",
+		RemoteIP:        "127.0.0.1",
+		UserAgent:       "test-player",
+		Match302ID:      match.ID,
+		ActualStorageID: target.ID,
+		AccountType:     "member",
+	})
+	lister := &fakeBalanceEpisodeLister{episodes: []embyhelper.EpisodeItem{
+		{ID: "ep-2", Path: "/media/source/show/e02.mkv"},
+		{ID: "ep-3", MediaSources: []embyhelper.EpisodeMediaSource{{ID: "ms-3", Path: "/media/source/show/e03.mkv"}}},
+		{ID: "ep-4", Path: "/media/source/show/e04.mkv"},
+	}}
+	prefetcher := &fakeBalancePrefetcher{match: &match}
+	svc := &BalancePrefetchService{
+		logger:   logger.New(config.LogConfig{Level: "error", Output: "stdout"}),
+		balance:  prefetcher,
+		episodes: lister,
+		sessions: sessions,
+		seen:     map[string]time.Time{},
+	}
+
+	count, err := svc.Scan(context.Background())
+	if err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if count != 2 || len(prefetcher.calls) != 2 {
+		t.Fatalf("prefetched %d calls=%+v, want next 2 episodes", count, prefetcher.calls)
+	}
+	if call := prefetcher.calls[1]; call.itemID != "ep-3" || call.sourcePath != "/media/source/show/e03.mkv" || call.preferredStorageID != target.ID {
+		t.Fatalf("unexpected prefetch call %+v", call)
+	}
+
+	if _, err := svc.Scan(context.Background()); err != nil {
+		t.Fatalf("second scan: %v", err)
+	}
+	if lister.calls != 1 || len(prefetcher.calls) != 2 {
+		t.Fatalf("same session should not be prefetched twice, lister calls=%d prefetch calls=%d", lister.calls, len(prefetcher.calls))
+	}
+
+	// 规则关闭预取后不再处理新会话
+	if err := db.Model(&model.Match302{}).Where("id = ?", match.ID).Update("prefetch_episodes", 0).Error; err != nil {
+		t.Fatalf("disable prefetch: %v", err)
+	}
+	sessions.AttachRedirect(embyproxylog.Entry{ItemID: "ep-2", RemoteIP: "127.0.0.1", UserAgent: "test-player", Match302ID: match.ID, ActualStorageID: target.ID, AccountType: "member"})
+	if _, err := svc.Scan(context.Background()); err != nil {
+		t.Fatalf("third scan: %v", err)
+	}
+	if lister.calls != 1 {
+		t.Fatalf("disabled rule should not be prefetched, lister calls=%d", lister.calls)
+	}
+}
@@ -0,0 +1,193 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/metrics"
+	"film-fusion/app/model"
+	"film-fusion/app/store/embyplayback"
+	"film-fusion/app/store/embyproxylog"
+)
+
+// Prometheus 指标，由 GET /metrics 输出
+var (
+	embyPlaybackRequestsMetric = metrics.NewCounterVec(
+		"filmfusion_emby_playback_requests_total",
+		"Emby 播放请求的处理结果：source 为 cache/proxyPlay/stream(302 或中转) 或 fallback/limited/denied，reason 为回退原因分类。",
+		"source", "reason",
+	)
+	downloadURLDurationMetric = metrics.NewHistogramVec(
+		"filmfusion_download_url_duration_seconds",
+		"向存储请求直链的耗时，不含缓存命中。",
+		nil,
+		"storage_id", "result",
+	)
+	tokenRefreshFailuresMetric = metrics.NewCounterVec(
+		"filmfusion_token_refresh_failures_total",
+		"令牌刷新失败次数，provider 为存储类型或 hdhive。",
+		"provider",
+	)
+	loginBlocksMetric = metrics.NewCounterVec(
+		"filmfusion_login_blocks_total",
+		"登录防爆破触发的封禁次数，target 为 emby 或 filmfusion，scope 为 ip 或 account_ip。",
+		"target", "scope",
+	)
+	rssRunOutcomesMetric = metrics.NewCounterVec(
+		"filmfusion_rss_automation_run_outcomes_total",
+		"RSS 自动化运行结束时的状态。",
+		"status",
+	)
+	rssNodeOutcomesMetric = metrics.NewCounterVec(
+		"filmfusion_rss_automation_node_outcomes_total",
+		"RSS 自动化节点执行结果，status 为 retry 表示失败后等待重试。",
+		"node_type", "status",
+	)
+)
+
+var registerMetricCollectorsOnce sync.Once
+
+// RegisterMetricCollectors 注册抓取时从数据库、播放会话读取的 Gauge，服务启动时调用一次；
+// 采集失败会写入 log 并计入 filmfusion_metrics_collect_errors_total
+func RegisterMetricCollectors(log *logger.Logger) {
+	registerMetricCollectorsOnce.Do(func() {
+		metrics.Default().SetLogger(log)
+		metrics.NewGaugeFunc(
+			"filmfusion_emby_active_sessions",
+			"当前 Emby 播放会话数，按实际播放存储统计。",
+			collectEmbyActiveSessions,
+			"storage_id", "storage_name",
+		)
+		metrics.NewGaugeFunc(
+			"filmfusion_download_115_queue",
+			"115 下载队列中各状态的任务数。",
+			collectDownload115Queue,
+			"status",
+		)
+		metrics.NewGaugeFunc(
+			"filmfusion_rss_automation_runs",
+			"尚未结束的 RSS 自动化运行数。",
+			collectRSSAutomationInflightRuns,
+			"status",
+		)
+	})
+}
+
+// RecordEmbyPlaybackMetric 统计一条 302 / 回退记录
+func RecordEmbyPlaybackMetric(entry embyproxylog.Entry) {
+	source := strings.TrimSpace(entry.Source)
+	if source == "" {
+		source = "unknown"
+	}
+	embyPlaybackRequestsMetric.Inc(source, PlaybackReasonCategory(entry.FallbackReason))
+}
+
+// PlaybackReasonCategory 把回退原因归为有限的类别：取冒号前的部分，去掉路径、错误详情等高基数内容
+func PlaybackReasonCategory(reason string) string {
+	reason = strings.TrimSpace(reason)
+	if i := strings.IndexAny(reason, ":："); i >= 0 {
+		reason = strings.TrimSpace(reason[:i])
+	}
+	// 路由规则名称等也会出现在原因里，这里只保留开头的固定描述
+	if i := strings.Index(reason, "「"); i >= 0 {
+		reason = strings.TrimSpace(reason[:i])
+	}
+	if len([]rune(reason)) > 40 {
+		reason = string([]rune(reason)[:40])
+	}
+	return reason
+}
+
+func recordDownloadURLDuration(storageID uint, elapsed time.Duration, err error) {
+	result := "ok"
+	if err != nil {
+		result = "error"
+	}
+	downloadURLDurationMetric.Observe(elapsed.Seconds(), strconv.FormatUint(uint64(storageID), 10), result)
+}
+
+func collectEmbyActiveSessions() ([]metrics.Sample, error) {
+	type storageSessions struct {
+		name  string
+		count int
+	}
+	byStorage := map[uint]*storageSessions{}
+	for _, session := range embyplayback.Default().Snapshot() {
+		if session.ActualStorageID == 0 {
+			continue
+		}
+		item, ok := byStorage[session.ActualStorageID]
+		if !ok {
+			item = &storageSessions{name: session.ActualStorageName}
+			byStorage[session.ActualStorageID] = item
+		}
+		item.count++
+	}
+	samples := make([]metrics.Sample, 0, len(byStorage))
+	for id, item := range byStorage {
+		samples = append(samples, metrics.Sample{
+			LabelValues: []string{strconv.FormatUint(uint64(id), 10), item.name},
+			Value:       float64(item.count),
+		})
+	}
+	return samples, nil
+}
+
+func collectDownload115Queue() ([]metrics.Sample, error) {
+	counts, err := countByStatus(&model.Download115Queue{}, nil)
+	if err != nil {
+		return nil, err
+	}
+	return statusSamples(counts, model.QueueStatusPending, model.QueueStatusDownloading, model.QueueStatusCompleted, model.QueueStatusFailed), nil
+}
+
+func collectRSSAutomationInflightRuns() ([]metrics.Sample, error) {
+	inflight := []string{model.RSSAutomationRunPending, model.RSSAutomationRunRunning}
+	counts, err := countByStatus(&model.RSSAutomationRun{}, inflight)
+	if err != nil {
+		return nil, err
+	}
+	return statusSamples(counts, inflight...), nil
+}
+
+func countByStatus(table any, statuses []string) (map[string]int64, error) {
+	if database.DB == nil {
+		return map[string]int64{}, nil
+	}
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	query := database.DB.Model(table).Select("status, COUNT(*) AS count").Group("status")
+	if len(statuses) > 0 {
+		query = query.Where("status IN ?", statuses)
+	}
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+	return counts, nil
+}
+
+// statusSamples 已知状态即使为 0 也输出，其余出现过的状态照常输出
+func statusSamples(counts map[string]int64, known ...string) []metrics.Sample {
+	samples := make([]metrics.Sample, 0, len(known)+len(counts))
+	seen := make(map[string]bool, len(known))
+	for _, status := range known {
+		seen[status] = true
+		samples = append(samples, metrics.Sample{LabelValues: []string{status}, Value: float64(counts[status])})
+	}
+	for status, count := range counts {
+		if !seen[status] {
+			samples = append(samples, metrics.Sample{LabelValues: []string{status}, Value: float64(count)})
+		}
+	}
+	return samples
+}
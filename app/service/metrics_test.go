@@ -0,0 +1,31 @@
+package service
+
+import (
+	"testing"
+
+	"film-fusion/app/store/embyproxylog"
+)
+
+func TestPlaybackReasonCategory(t *testing.T) {
+	cases := map[string]string{
+		"": "",
+		"路径未匹配任何 match302 规则: /media/a.mkv":  "路径未匹配任何 match302 规则",
+		"获取下载URL失败：未找到可用的下载URL，pickcode=abc": "获取下载URL失败",
+		"命中路由规则「客厅电视」，由 Emby 播放":             "命中路由规则",
+		"未命中 match302 / 缓存，走默认反代":            "未命中 match302 / 缓存，走默认反代",
+	}
+	for reason, want := range cases {
+		if got := PlaybackReasonCategory(reason); got != want {
+			t.Fatalf("PlaybackReasonCategory(%q) = %q, want %q", reason, got, want)
+		}
+	}
+}
+
+func TestRecordEmbyPlaybackMetric(t *testing.T) {
+	before := embyPlaybackRequestsMetric.Value("fallback", "获取 EmbyItems 失败")
+	RecordEmbyPlaybackMetric(embyproxylog.Entry{Source: "fallback", FallbackReason: "获取 EmbyItems 失败: timeout"})
+	RecordEmbyPlaybackMetric(embyproxylog.Entry{Source: "fallback", FallbackReason: "获取 EmbyItems 失败: 401"})
+	if got := embyPlaybackRequestsMetric.Value("fallback", "获取 EmbyItems 失败"); got != before+2 {
+		t.Fatalf("fallback count = %v, want %v", got, before+2)
+	}
+}
@@ -20,6 +20,7 @@ const (
 	NotificationEventAppSecurity   NotificationEventType = config.NotificationEventAppSecurity
 	NotificationEventRSSMatched    NotificationEventType = config.NotificationEventRSSMatched
 	NotificationEventWeb115Invalid NotificationEventType = config.NotificationEventWeb115Invalid
+	NotificationEventBalanceHealth NotificationEventType = config.NotificationEventBalanceHealth
 	NotificationEventTest          NotificationEventType = "system.test"
 )
 
@@ -0,0 +1,158 @@
+package service
+
+import (
+	"errors"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/pathhelper"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// ErrOrganizeBatchReverted 批次已撤销，不能重复撤销
+var ErrOrganizeBatchReverted = errors.New("整理批次已撤销")
+
+// OrganizeBatchFileOps 撤销整理时对网盘文件的操作，由调用方绑定具体的 115 客户端
+type OrganizeBatchFileOps interface {
+	Rename(renameMap map[string]string) error
+	Move(dirID string, fileIDs []string) error
+}
+
+// CreateOrganizeBatch 在执行网盘重命名/移动之前持久化批次及其条目
+func CreateOrganizeBatch(batch *model.OrganizeBatch) error {
+	batch.Status = model.OrganizeBatchStatusPending
+	batch.ItemCount = len(batch.Items)
+	return database.DB.Create(batch).Error
+}
+
+// FinishOrganizeBatch 根据整理结果标记批次状态；errMsg 为空表示成功
+func FinishOrganizeBatch(log *logger.Logger, batchID uint, errMsg string) {
+	status := model.OrganizeBatchStatusApplied
+	if strings.TrimSpace(errMsg) != "" {
+		status = model.OrganizeBatchStatusFailed
+	}
+	if err := database.DB.Model(&model.OrganizeBatch{}).Where("id = ?", batchID).
+		Updates(map[string]any{"status": status, "error": errMsg}).Error; err != nil && log != nil {
+		log.Warnf("更新整理批次状态失败 batch_id=%d: %v", batchID, err)
+	}
+}
+
+// RevertOrganizeBatch 将批次中的文件改回原名、移回原目录，并删除(或恢复)生成的本地文件。
+// 各步骤互不阻断，失败记录到条目上，批次标记为 revert_failed 以便重试。
+func RevertOrganizeBatch(log *logger.Logger, batch *model.OrganizeBatch, ops OrganizeBatchFileOps) error {
+	if batch.Status == model.OrganizeBatchStatusReverted {
+		return ErrOrganizeBatchReverted
+	}
+	if err := database.DB.Where("batch_id = ?", batch.ID).Order("id ASC").Find(&batch.Items).Error; err != nil {
+		return err
+	}
+
+	itemErrors := make(map[uint][]string, len(batch.Items))
+	addError := func(item model.OrganizeBatchItem, err error) {
+		itemErrors[item.ID] = append(itemErrors[item.ID], err.Error())
+	}
+
+	renameMap := make(map[string]string)
+	moveGroups := make(map[string][]model.OrganizeBatchItem)
+	for _, item := range batch.Items {
+		if item.NewName != "" && item.NewName != item.OriginalName {
+			renameMap[item.FileID] = item.OriginalName
+		}
+		if item.NewParentID != "" && item.NewParentID != item.OriginalParentID {
+			moveGroups[item.OriginalParentID] = append(moveGroups[item.OriginalParentID], item)
+		}
+	}
+	if err := ops.Rename(renameMap); err != nil {
+		for _, item := range batch.Items {
+			if _, ok := renameMap[item.FileID]; ok {
+				addError(item, fmt.Errorf("恢复文件名失败: %w", err))
+			}
+		}
+	}
+	for dirID, items := range moveGroups {
+		fileIDs := make([]string, 0, len(items))
+		for _, item := range items {
+			fileIDs = append(fileIDs, item.FileID)
+		}
+		if err := ops.Move(dirID, fileIDs); err != nil {
+			// 源文件夹被整理后的延迟删除任务删掉时也会走到这里
+			for _, item := range items {
+				addError(item, fmt.Errorf("移回原目录(ID=%s)失败: %w", dirID, err))
+			}
+		}
+	}
+
+	for _, item := range batch.Items {
+		if err := revertOrganizeBatchLocalFile(batch.SavePath, item); err != nil {
+			addError(item, err)
+		}
+		if !item.IsSubtitle && item.NewPath != "" {
+			cacheKey := pathhelper.SafeFilePathJoin(batch.ContentPrefix, item.NewPath)
+			if err := database.DB.Where("file_path = ?", cacheKey).Delete(&model.PickcodeCache{}).Error; err != nil && log != nil {
+				log.Warnf("删除 pickcode 缓存失败 %s: %v", cacheKey, err)
+			}
+		}
+	}
+
+	failed := 0
+	for i := range batch.Items {
+		item := &batch.Items[i]
+		item.RevertError = strings.Join(itemErrors[item.ID], "; ")
+		if item.RevertError != "" {
+			failed++
+		}
+		if err := database.DB.Model(item).Update("revert_error", item.RevertError).Error; err != nil && log != nil {
+			log.Warnf("更新整理批次条目失败 item_id=%d: %v", item.ID, err)
+		}
+	}
+
+	updates := map[string]any{"status": model.OrganizeBatchStatusReverted, "error": ""}
+	if failed > 0 {
+		updates["status"] = model.OrganizeBatchStatusRevertFailed
+		updates["error"] = fmt.Sprintf("%d/%d 个文件撤销失败", failed, len(batch.Items))
+	} else {
+		now := time.Now()
+		updates["reverted_at"] = &now
+		batch.RevertedAt = &now
+	}
+	batch.Status = updates["status"].(string)
+	batch.Error = updates["error"].(string)
+	if err := database.DB.Model(&model.OrganizeBatch{}).Where("id = ?", batch.ID).Updates(updates).Error; err != nil {
+		return err
+	}
+	if log != nil {
+		log.Infof("整理批次撤销完成 batch_id=%d: %d 个文件, %d 个失败", batch.ID, len(batch.Items), failed)
+	}
+	return nil
+}
+
+// revertOrganizeBatchLocalFile 删除整理生成的本地文件并清理空目录；整理前已存在的 STRM 恢复原内容
+func revertOrganizeBatchLocalFile(savePath string, item model.OrganizeBatchItem) error {
+	localPath := strings.TrimSpace(item.LocalPath)
+	if localPath == "" {
+		return nil
+	}
+	if item.LocalExisted {
+		if item.IsSubtitle {
+			return nil
+		}
+		if err := os.WriteFile(localPath, []byte(item.LocalPreviousContent), 0777); err != nil {
+			return fmt.Errorf("恢复 STRM 原内容失败: %w", err)
+		}
+		return nil
+	}
+	if err := os.Remove(localPath); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("删除本地文件失败: %w", err)
+	}
+	root := filepath.Clean(strings.TrimSpace(savePath))
+	for dir := filepath.Dir(localPath); root != "." && dir != root && pathhelper.IsSubPath(filepath.ToSlash(dir), filepath.ToSlash(root)); dir = filepath.Dir(dir) {
+		if os.Remove(dir) != nil {
+			break
+		}
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package service
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+type fakeOrganizeBatchOps struct {
+	renamed map[string]string
+	moved   map[string][]string
+	moveErr error
+}
+
+func (o *fakeOrganizeBatchOps) Rename(renameMap map[string]string) error {
+	o.renamed = renameMap
+	return nil
+}
+
+func (o *fakeOrganizeBatchOps) Move(dirID string, fileIDs []string) error {
+	if o.moveErr != nil {
+		return o.moveErr
+	}
+	if o.moved == nil {
+		o.moved = map[string][]string{}
+	}
+	o.moved[dirID] = append(o.moved[dirID], fileIDs...)
+	return nil
+}
+
+func setupOrganizeBatchTest(t *testing.T) *gorm.DB {
+	t.Helper()
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "organize-batch.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open test database: %v", err)
+	}
+	if err := db.AutoMigrate(&model.OrganizeBatch{}, &model.OrganizeBatchItem{}, &model.PickcodeCache{}); err != nil {
+		t.Fatalf("migrate test database: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() { database.DB = oldDB })
+	return db
+}
+
+func TestRevertOrganizeBatch(t *testing.T) {
+	db := setupOrganizeBatchTest(t)
+	savePath := t.TempDir()
+	newStrm := filepath.Join(savePath, "TV", "Show (2020)", "Season 1", "Show S01E01.strm")
+	existingStrm := filepath.Join(savePath, "TV", "Other", "Other S01E01.strm")
+	subtitle := filepath.Join(savePath, "TV", "Show (2020)", "Season 1", "Show S01E01.zh.srt")
+	for file, content := range map[string]string{newStrm: "http://new", existingStrm: "http://overwritten", subtitle: "1"} {
+		if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, _, err := model.UpsertPickcodeCache(db, "http://strm/TV/Show (2020)/Season 1/Show S01E01.mkv", "pc1"); err != nil {
+		t.Fatal(err)
+	}
+
+	batch := &model.OrganizeBatch{
+		UserID: 1, CloudStorageID: 1, SourceFolderID: "src", SavePath: savePath, ContentPrefix: "http://strm",
+		Items: []model.OrganizeBatchItem{
+			{FileID: "f1", OriginalName: "show.01.mkv", OriginalParentID: "src", NewName: "Show S01E01.mkv", NewParentID: "season1",
+				NewPath: "TV/Show (2020)/Season 1/Show S01E01.mkv", LocalPath: newStrm},
+			{FileID: "f2", OriginalName: "Other S01E01.mkv", OriginalParentID: "src", NewName: "Other S01E01.mkv", NewParentID: "other",
+				NewPath: "TV/Other/Other S01E01.mkv", LocalPath: existingStrm, LocalExisted: true, LocalPreviousContent: "http://previous"},
+			{FileID: "s1", IsSubtitle: true, OriginalName: "show.01.chs.srt", OriginalParentID: "src", NewName: "Show S01E01.zh.srt",
+				NewParentID: "season1", LocalPath: subtitle},
+		},
+	}
+	if err := CreateOrganizeBatch(batch); err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+	FinishOrganizeBatch(nil, batch.ID, "")
+
+	var stored model.OrganizeBatch
+	db.First(&stored, batch.ID)
+	if stored.Status != model.OrganizeBatchStatusApplied || stored.ItemCount != 3 {
+		t.Fatalf("stored batch = %+v", stored)
+	}
+
+	ops := &fakeOrganizeBatchOps{}
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	if err := RevertOrganizeBatch(log, &stored, ops); err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	if len(ops.renamed) != 2 || ops.renamed["f1"] != "show.01.mkv" || ops.renamed["s1"] != "show.01.chs.srt" {
+		t.Fatalf("renamed = %v", ops.renamed)
+	}
+	if len(ops.moved["src"]) != 3 {
+		t.Fatalf("moved = %v", ops.moved)
+	}
+	if _, err := os.Stat(filepath.Join(savePath, "TV", "Show (2020)")); !os.IsNotExist(err) {
+		t.Fatalf("generated files and empty dirs should be removed, stat err = %v", err)
+	}
+	if data, _ := os.ReadFile(existingStrm); string(data) != "http://previous" {
+		t.Fatalf("existing strm content = %q", data)
+	}
+	var caches int64
+	db.Model(&model.PickcodeCache{}).Count(&caches)
+	if caches != 0 {
+		t.Fatalf("pickcode cache should be removed, got %d", caches)
+	}
+	if stored.Status != model.OrganizeBatchStatusReverted || stored.RevertedAt == nil {
+		t.Fatalf("batch after revert = %+v", stored)
+	}
+	if err := RevertOrganizeBatch(log, &stored, ops); !errors.Is(err, ErrOrganizeBatchReverted) {
+		t.Fatalf("second revert err = %v", err)
+	}
+}
+
+func TestRevertOrganizeBatchRecordsItemFailures(t *testing.T) {
+	db := setupOrganizeBatchTest(t)
+	batch := &model.OrganizeBatch{
+		UserID: 1, CloudStorageID: 1, SourceFolderID: "src", SavePath: t.TempDir(),
+		Items: []model.OrganizeBatchItem{
+			{FileID: "f1", OriginalName: "a.mkv", OriginalParentID: "src", NewName: "A.mkv", NewParentID: "dst"},
+		},
+	}
+	if err := CreateOrganizeBatch(batch); err != nil {
+		t.Fatalf("create batch: %v", err)
+	}
+
+	ops := &fakeOrganizeBatchOps{moveErr: errors.New("folder not found")}
+	if err := RevertOrganizeBatch(nil, batch, ops); err != nil {
+		t.Fatalf("revert: %v", err)
+	}
+	var item model.OrganizeBatchItem
+	db.Where("batch_id = ?", batch.ID).First(&item)
+	if batch.Status != model.OrganizeBatchStatusRevertFailed || item.RevertError == "" {
+		t.Fatalf("batch = %+v, item = %+v", batch, item)
+	}
+
+	// 失败后可以重试
+	ops.moveErr = nil
+	if err := RevertOrganizeBatch(nil, batch, ops); err != nil || batch.Status != model.OrganizeBatchStatusReverted {
+		t.Fatalf("retry status = %s, err = %v", batch.Status, err)
+	}
+}
@@ -1,15 +1,10 @@
 package service
 
 import (
-	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"mime/multipart"
-	"net/http"
-	"net/http/cookiejar"
 	"net/url"
 	"regexp"
 	"strconv"
@@ -31,28 +26,15 @@ func (s *RSSAutomationService) TestTarget(ctx context.Context, targetID uint) er
 	if !target.Enabled {
 		return errors.New("目标已停用")
 	}
-	switch target.Type {
-	case model.RSSAutomationTargetQBittorrent:
-		client, err := s.newRSSAutomationQBClient(ctx, target)
-		if err != nil {
-			return err
-		}
-		return client.testConnection(ctx)
-	default:
-		return fmt.Errorf("不支持的目标类型 %q", target.Type)
+	downloader, err := s.newRSSAutomationDownloader(ctx, target)
+	if err != nil {
+		return err
 	}
+	return downloader.testConnection(ctx)
 }
 
 func (s *RSSAutomationService) executeRSSAutomationQBittorrent(ctx context.Context, node RSSAutomationNode, runContext map[string]any) (map[string]any, error) {
-	targetID := rssAutomationConfigUint(node.Config, "target_id")
-	var target model.RSSAutomationTarget
-	if err := s.db.First(&target, targetID).Error; err != nil {
-		return nil, fmt.Errorf("qBittorrent 目标不存在: %w", err)
-	}
-	if !target.Enabled {
-		return nil, errors.New("qBittorrent 目标已停用")
-	}
-	client, err := s.newRSSAutomationQBClient(ctx, target)
+	target, downloader, err := s.loadRSSAutomationDownloader(ctx, rssAutomationConfigUint(node.Config, "target_id"))
 	if err != nil {
 		return nil, err
 	}
@@ -66,118 +48,32 @@ func (s *RSSAutomationService) executeRSSAutomationQBittorrent(ctx context.Conte
 	contentKey := rssAutomationContentKey(downloadURL)
 	torrentTag := "filmfusion-rss-" + contentKey
 
-	var body bytes.Buffer
-	writer := multipart.NewWriter(&body)
-	configuredTags := renderRSSAutomationTemplate(rssAutomationConfigString(node.Config, "tags"), runContext)
-	allTags := torrentTag
-	if strings.TrimSpace(configuredTags) != "" {
-		allTags = configuredTags + "," + torrentTag
-	}
-	fields := map[string]string{
-		"urls":     downloadURL,
-		"savepath": renderRSSAutomationTemplate(rssAutomationConfigString(node.Config, "save_path"), runContext),
-		"category": renderRSSAutomationTemplate(rssAutomationConfigString(node.Config, "category"), runContext),
-		"tags":     allTags,
-	}
-	if rssAutomationConfigBool(node.Config, "paused") {
-		fields["paused"] = "true"
+	request := rssAutomationDownloadRequest{
+		URL:         downloadURL,
+		SavePath:    renderRSSAutomationTemplate(rssAutomationConfigString(node.Config, "save_path"), runContext),
+		Category:    renderRSSAutomationTemplate(rssAutomationConfigString(node.Config, "category"), runContext),
+		TrackingTag: torrentTag,
+		Paused:      rssAutomationConfigBool(node.Config, "paused"),
+		Sequential:  rssAutomationConfigBool(node.Config, "sequential"),
 	}
-	if rssAutomationConfigBool(node.Config, "sequential") {
-		fields["sequentialDownload"] = "true"
-	}
-	for key, value := range fields {
-		if strings.TrimSpace(value) != "" {
-			_ = writer.WriteField(key, value)
+	configuredTags := renderRSSAutomationTemplate(rssAutomationConfigString(node.Config, "tags"), runContext)
+	for _, tag := range strings.Split(configuredTags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			request.Tags = append(request.Tags, tag)
 		}
 	}
-	_ = writer.Close()
-	req, err := client.newRequest(ctx, http.MethodPost, "/api/v2/torrents/add", &body)
+	taskID, err := downloader.addTask(ctx, request)
 	if err != nil {
 		return nil, err
 	}
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	resp, err := client.client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("提交 qBittorrent 任务失败: %w", err)
-	}
-	defer resp.Body.Close()
-	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !strings.EqualFold(strings.TrimSpace(string(responseBody)), "Ok.") {
-		return nil, fmt.Errorf("qBittorrent 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(responseBody)))
-	}
-	return map[string]any{
-		"target_id": target.ID, "target_name": target.Name,
+	output := map[string]any{
+		"target_id": target.ID, "target_name": target.Name, "target_type": target.Type,
 		"content_key": contentKey, "torrent_tag": torrentTag, "submitted": true,
-	}, nil
-}
-
-type rssAutomationQBClient struct {
-	baseURL string
-	client  *http.Client
-	apiKey  string
-}
-
-func (client *rssAutomationQBClient) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
-	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(client.baseURL, "/")+path, body)
-	if err != nil {
-		return nil, err
-	}
-	if client.apiKey != "" {
-		req.Header.Set("Authorization", "Bearer "+client.apiKey)
-	}
-	return req, nil
-}
-
-func (client *rssAutomationQBClient) testConnection(ctx context.Context) error {
-	req, err := client.newRequest(ctx, http.MethodGet, "/api/v2/app/version", nil)
-	if err != nil {
-		return err
-	}
-	resp, err := client.client.Do(req)
-	if err != nil {
-		return fmt.Errorf("连接 qBittorrent API 失败: %w", err)
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		if client.apiKey != "" {
-			return fmt.Errorf("qBittorrent API Key 验证失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
-		}
-		return fmt.Errorf("qBittorrent API 连接失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
-	if strings.TrimSpace(string(body)) == "" {
-		return errors.New("qBittorrent API 未返回应用版本")
+	if taskID != "" {
+		output["task_id"] = taskID
 	}
-	return nil
-}
-
-func (s *RSSAutomationService) newRSSAutomationQBClient(ctx context.Context, target model.RSSAutomationTarget) (*rssAutomationQBClient, error) {
-	var config RSSAutomationQBittorrentConfig
-	if err := json.Unmarshal([]byte(target.ConfigJSON), &config); err != nil {
-		return nil, errors.New("qBittorrent 目标配置损坏")
-	}
-	jar, _ := cookiejar.New(nil)
-	client := &http.Client{Timeout: 20 * time.Second, Jar: jar}
-	apiKey := strings.TrimSpace(config.APIKey)
-	if apiKey != "" {
-		return &rssAutomationQBClient{baseURL: config.BaseURL, client: client, apiKey: apiKey}, nil
-	}
-	form := url.Values{"username": {config.Username}, "password": {config.Password}}
-	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(config.BaseURL, "/")+"/api/v2/auth/login", strings.NewReader(form.Encode()))
-	if err != nil {
-		return nil, err
-	}
-	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
-	resp, err := client.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("连接 qBittorrent 失败: %w", err)
-	}
-	defer resp.Body.Close()
-	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !strings.EqualFold(strings.TrimSpace(string(body)), "Ok.") {
-		return nil, fmt.Errorf("qBittorrent 登录失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
-	}
-	return &rssAutomationQBClient{baseURL: config.BaseURL, client: client}, nil
+	return output, nil
 }
 
 func (s *RSSAutomationService) executeRSSAutomationOffline115(ctx context.Context, node RSSAutomationNode, runContext map[string]any) (map[string]any, error) {
@@ -0,0 +1,281 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 磁力链接与种子地址在 Aria2 中会先下载元数据，再由 followedBy 中的新 GID 继续真正的下载
+const maxRSSAutomationAria2FollowDepth = 4
+
+var rssAutomationAria2TaskFields = []string{
+	"gid", "status", "totalLength", "completedLength", "uploadLength", "downloadSpeed",
+	"dir", "files", "bittorrent", "followedBy", "errorMessage", "seeder",
+}
+
+type rssAutomationAria2Client struct {
+	endpoint string
+	secret   string
+	client   *http.Client
+}
+
+type rssAutomationAria2Task struct {
+	GID             string   `json:"gid"`
+	Status          string   `json:"status"`
+	TotalLength     string   `json:"totalLength"`
+	CompletedLength string   `json:"completedLength"`
+	UploadLength    string   `json:"uploadLength"`
+	DownloadSpeed   string   `json:"downloadSpeed"`
+	Dir             string   `json:"dir"`
+	FollowedBy      []string `json:"followedBy"`
+	ErrorMessage    string   `json:"errorMessage"`
+	Seeder          string   `json:"seeder"`
+	Files           []struct {
+		Path   string `json:"path"`
+		Length string `json:"length"`
+	} `json:"files"`
+	BitTorrent struct {
+		Info struct {
+			Name string `json:"name"`
+		} `json:"info"`
+	} `json:"bittorrent"`
+}
+
+func newRSSAutomationAria2Client(config RSSAutomationDownloaderConfig) *rssAutomationAria2Client {
+	return &rssAutomationAria2Client{
+		endpoint: rssAutomationRPCEndpoint(config.BaseURL, "/jsonrpc"),
+		secret:   config.Password,
+		client:   &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+func (client *rssAutomationAria2Client) call(ctx context.Context, method string, params []any, result any) error {
+	if client.secret != "" {
+		params = append([]any{"token:" + client.secret}, params...)
+	}
+	payload, err := json.Marshal(map[string]any{"jsonrpc": "2.0", "id": "filmfusion", "method": method, "params": params})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接 Aria2 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Code    int    `json:"code"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	// Aria2 出错时 HTTP 状态码可能是 400，错误详情仍在 JSON 中
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("Aria2 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return fmt.Errorf("解析 Aria2 响应失败: %w", err)
+	}
+	if envelope.Error != nil {
+		if envelope.Error.Message == "Unauthorized" {
+			return errors.New("Aria2 RPC 密钥错误")
+		}
+		return fmt.Errorf("Aria2 %s 失败: %s", method, envelope.Error.Message)
+	}
+	if result == nil || len(envelope.Result) == 0 {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, result); err != nil {
+		return fmt.Errorf("解析 Aria2 %s 结果失败: %w", method, err)
+	}
+	return nil
+}
+
+func (client *rssAutomationAria2Client) testConnection(ctx context.Context) error {
+	var version struct {
+		Version string `json:"version"`
+	}
+	if err := client.call(ctx, "aria2.getVersion", []any{}, &version); err != nil {
+		return err
+	}
+	if version.Version == "" {
+		return errors.New("Aria2 未返回版本")
+	}
+	return nil
+}
+
+func (client *rssAutomationAria2Client) addTask(ctx context.Context, request rssAutomationDownloadRequest) (string, error) {
+	// Aria2 的选项值必须是字符串；分类与标签没有对应概念
+	options := map[string]any{}
+	if request.SavePath != "" {
+		options["dir"] = request.SavePath
+	}
+	if request.Paused {
+		options["pause"] = "true"
+	}
+	if request.Sequential {
+		options["bt-prioritize-piece"] = "head,tail"
+	}
+	var gid string
+	if err := client.call(ctx, "aria2.addUri", []any{[]string{request.URL}, options}, &gid); err != nil {
+		return "", err
+	}
+	if gid == "" {
+		return "", errors.New("Aria2 未返回任务 GID")
+	}
+	return gid, nil
+}
+
+// tellStatus 查询任务并沿 followedBy 找到实际的下载任务，任务不存在时返回 nil
+func (client *rssAutomationAria2Client) tellStatus(ctx context.Context, gid string) (*rssAutomationAria2Task, error) {
+	for depth := 0; ; depth++ {
+		var task rssAutomationAria2Task
+		if err := client.call(ctx, "aria2.tellStatus", []any{gid, rssAutomationAria2TaskFields}, &task); err != nil {
+			if strings.Contains(err.Error(), "is not found") {
+				return nil, nil
+			}
+			return nil, err
+		}
+		if len(task.FollowedBy) == 0 || depth >= maxRSSAutomationAria2FollowDepth {
+			if task.GID == "" {
+				task.GID = gid
+			}
+			return &task, nil
+		}
+		gid = task.FollowedBy[0]
+	}
+}
+
+func (client *rssAutomationAria2Client) findTask(ctx context.Context, taskID, _ string) (*rssAutomationDownloadTask, error) {
+	if taskID == "" {
+		return nil, errors.New("Aria2 任务缺少 GID")
+	}
+	task, err := client.tellStatus(ctx, taskID)
+	if err != nil || task == nil {
+		return nil, err
+	}
+	total := rssAutomationAria2Int(task.TotalLength)
+	completed := rssAutomationAria2Int(task.CompletedLength)
+	result := &rssAutomationDownloadTask{
+		ID: task.GID, State: task.Status, SavePath: task.Dir,
+		Size: total, Downloaded: completed, AmountLeft: max(total-completed, 0), ETA: -1,
+	}
+	if total > 0 {
+		result.Progress = float64(completed) / float64(total)
+		result.Ratio = float64(rssAutomationAria2Int(task.UploadLength)) / float64(total)
+		if speed := rssAutomationAria2Int(task.DownloadSpeed); speed > 0 {
+			result.ETA = result.AmountLeft / speed
+		}
+	}
+	switch {
+	case task.BitTorrent.Info.Name != "":
+		result.Name = task.BitTorrent.Info.Name
+		result.ContentPath = rssAutomationJoinDownloadPath(task.Dir, task.BitTorrent.Info.Name)
+	case len(task.Files) > 0:
+		result.ContentPath = task.Files[0].Path
+		result.Name = path.Base(strings.ReplaceAll(task.Files[0].Path, "\\", "/"))
+	}
+	switch task.Status {
+	case "error", "removed":
+		result.Failed = true
+		if task.ErrorMessage != "" {
+			result.State = task.Status + ": " + task.ErrorMessage
+		}
+	case "complete":
+		result.Completed = true
+	}
+	// BT 任务下载完成后会继续做种，状态仍是 active
+	if task.Seeder == "true" || (total > 0 && completed == total) {
+		result.Completed = true
+	}
+	if result.Completed {
+		result.Progress = 1
+	}
+	return result, nil
+}
+
+func (client *rssAutomationAria2Client) listFiles(ctx context.Context, taskID string) ([]rssAutomationDownloadFile, error) {
+	task, err := client.tellStatus(ctx, taskID)
+	if err != nil {
+		return nil, err
+	}
+	if task == nil {
+		return nil, errors.New("Aria2 任务不存在")
+	}
+	prefix := strings.TrimRight(strings.ReplaceAll(task.Dir, "\\", "/"), "/") + "/"
+	files := make([]rssAutomationDownloadFile, 0, len(task.Files))
+	for _, file := range task.Files {
+		name := strings.TrimPrefix(strings.ReplaceAll(file.Path, "\\", "/"), prefix)
+		files = append(files, rssAutomationDownloadFile{Name: name, Size: rssAutomationAria2Int(file.Length)})
+	}
+	return files, nil
+}
+
+func (client *rssAutomationAria2Client) removeTask(ctx context.Context, taskID string, deleteFiles bool) error {
+	if deleteFiles {
+		return errors.New("Aria2 RPC 不支持删除已下载的文件，请关闭同时删除下载文件")
+	}
+	task, err := client.tellStatus(ctx, taskID)
+	if err != nil || task == nil {
+		return err
+	}
+	switch task.Status {
+	case "active", "waiting", "paused":
+		if err := client.call(ctx, "aria2.forceRemove", []any{task.GID}, nil); err != nil {
+			return err
+		}
+		// forceRemove 完成后任务才会进入已停止列表，清理结果失败不影响删除
+		_ = client.call(ctx, "aria2.removeDownloadResult", []any{task.GID}, nil)
+		return nil
+	default:
+		return client.call(ctx, "aria2.removeDownloadResult", []any{task.GID}, nil)
+	}
+}
+
+func (client *rssAutomationAria2Client) globalStat(ctx context.Context) (map[string]string, error) {
+	var stat map[string]string
+	if err := client.call(ctx, "aria2.getGlobalStat", []any{}, &stat); err != nil {
+		return nil, err
+	}
+	return stat, nil
+}
+
+func (client *rssAutomationAria2Client) transferInfo(ctx context.Context) (rssAutomationTransferInfo, error) {
+	stat, err := client.globalStat(ctx)
+	if err != nil {
+		return rssAutomationTransferInfo{}, err
+	}
+	return rssAutomationTransferInfo{
+		ConnectionStatus: "connected",
+		DownloadSpeed:    rssAutomationAria2Int(stat["downloadSpeed"]),
+		UploadSpeed:      rssAutomationAria2Int(stat["uploadSpeed"]),
+	}, nil
+}
+
+func (client *rssAutomationAria2Client) activeTorrentCount(ctx context.Context) (int, error) {
+	stat, err := client.globalStat(ctx)
+	if err != nil {
+		return 0, err
+	}
+	return int(rssAutomationAria2Int(stat["numActive"])), nil
+}
+
+func rssAutomationAria2Int(value string) int64 {
+	parsed, _ := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	return parsed
+}
@@ -16,6 +16,7 @@ const (
 	RSSAutomationNodeRegex               = "regex"
 	RSSAutomationNodeKeyword             = "keyword"
 	RSSAutomationNodeConvert             = "convert"
+	RSSAutomationNodeScript              = "script"
 	RSSAutomationNodeIf                  = "if"
 	RSSAutomationNodeParallel            = "parallel"
 	RSSAutomationNodeJoin                = "join"
@@ -38,6 +39,7 @@ const (
 	RSSAutomationNodeEmbyRefreshWait     = "emby_refresh_wait"
 	RSSAutomationNodeHTTPRequest         = "http_request"
 	RSSAutomationNodeNotification        = "notification"
+	RSSAutomationNodeCallWorkflow        = "call_workflow"
 	RSSAutomationNodeEnd                 = "end"
 )
 
@@ -315,27 +317,27 @@ func ValidateRSSAutomationDefinition(definition RSSAutomationDefinition) RSSAuto
 			switch node.Type {
 			case RSSAutomationNodeWaitQBittorrent:
 				if predecessor.Type != RSSAutomationNodeQBittorrent {
-					result.Errors = append(result.Errors, fmt.Sprintf("等待 qBittorrent 节点 %s 必须直接连接在 qBittorrent 下载节点之后", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("等待下载完成节点 %s 必须直接连接在下载器下载节点之后", id))
 				}
 				if sourcePort != "success" {
-					result.Errors = append(result.Errors, fmt.Sprintf("等待 qBittorrent 节点 %s 必须连接 qBittorrent 节点的成功出口", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("等待下载完成节点 %s 必须连接下载器下载节点的成功出口", id))
 				}
 			case RSSAutomationNodeMoviePilotTransfer:
 				if predecessor.Type != RSSAutomationNodeWaitQBittorrent {
-					result.Errors = append(result.Errors, fmt.Sprintf("MP2 整理节点 %s 必须直接连接在等待 qBittorrent 完成节点之后", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("MP2 整理节点 %s 必须直接连接在等待下载完成节点之后", id))
 				}
 				if sourcePort != "success" {
-					result.Errors = append(result.Errors, fmt.Sprintf("MP2 整理节点 %s 必须连接等待 qBittorrent 节点的成功出口", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("MP2 整理节点 %s 必须连接等待下载完成节点的成功出口", id))
 				}
 			case RSSAutomationNodeDeleteQBittorrent:
 				if predecessor.Type != RSSAutomationNodeWaitQBittorrent && predecessor.Type != RSSAutomationNodeMoviePilotTransfer {
-					result.Errors = append(result.Errors, fmt.Sprintf("删除 qB 做种任务节点 %s 必须连接在等待 qBittorrent 完成或 MP2 整理节点之后", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("删除下载器做种任务节点 %s 必须连接在等待下载完成或 MP2 整理节点之后", id))
 				}
 				if sourcePort != "success" {
-					result.Errors = append(result.Errors, fmt.Sprintf("删除 qB 做种任务节点 %s 必须连接上游节点的成功出口", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("删除下载器做种任务节点 %s 必须连接上游节点的成功出口", id))
 				}
 				if rssAutomationConfigBool(node.Config, "delete_files") && predecessor.Type != RSSAutomationNodeMoviePilotTransfer {
-					result.Errors = append(result.Errors, fmt.Sprintf("删除 qB 做种任务节点 %s 只有在 MP2 整理成功后才能同时删除下载文件", id))
+					result.Errors = append(result.Errors, fmt.Sprintf("删除下载器做种任务节点 %s 只有在 MP2 整理成功后才能同时删除下载文件", id))
 				}
 			case RSSAutomationNodeWait115:
 				if predecessor.Type != RSSAutomationNodeOffline115 && predecessor.Type != RSSAutomationNodeOffline115OpenAPI {
@@ -449,14 +451,14 @@ func isRSSAutomationSourcePortValid(nodeType, port string) bool {
 	port = strings.TrimSpace(strings.ToLower(port))
 	if port == "always" {
 		switch nodeType {
-		case RSSAutomationNodeRegex, RSSAutomationNodeKeyword, RSSAutomationNodeConvert, RSSAutomationNodeJoin,
+		case RSSAutomationNodeRegex, RSSAutomationNodeKeyword, RSSAutomationNodeConvert, RSSAutomationNodeScript, RSSAutomationNodeJoin,
 			RSSAutomationNodeQBittorrent, RSSAutomationNodeWaitQBittorrent, RSSAutomationNodeDeleteQBittorrent,
 			RSSAutomationNodeOffline115, RSSAutomationNodeOffline115OpenAPI,
 			RSSAutomationNodeWait115, RSSAutomationNodeMoviePilotTitle, RSSAutomationNodeFilmFusionRecognize, RSSAutomationNodeMoviePilotTransfer, RSSAutomationNodeMediaExists,
 			RSSAutomationNodeHDHiveQuery, RSSAutomationNodeHDHiveUnlock,
 			RSSAutomationNodeMoviePilotRecognize, RSSAutomationNodeOrganizeStrm,
 			RSSAutomationNodeStrmVerify, RSSAutomationNodeStrmRegenerate, RSSAutomationNodeEmbyRefreshWait,
-			RSSAutomationNodeHTTPRequest, RSSAutomationNodeNotification:
+			RSSAutomationNodeHTTPRequest, RSSAutomationNodeNotification, RSSAutomationNodeCallWorkflow:
 			return true
 		default:
 			return false
@@ -475,12 +477,12 @@ func isRSSAutomationSourcePortValid(nodeType, port string) bool {
 		return port == "valid" || port == "invalid" || port == "failure"
 	case RSSAutomationNodeParallel:
 		return strings.HasPrefix(port, "branch-") && len(port) > len("branch-")
-	case RSSAutomationNodeRegex, RSSAutomationNodeConvert, RSSAutomationNodeJoin,
+	case RSSAutomationNodeRegex, RSSAutomationNodeConvert, RSSAutomationNodeScript, RSSAutomationNodeJoin,
 		RSSAutomationNodeQBittorrent, RSSAutomationNodeWaitQBittorrent, RSSAutomationNodeDeleteQBittorrent,
 		RSSAutomationNodeOffline115, RSSAutomationNodeOffline115OpenAPI,
 		RSSAutomationNodeWait115, RSSAutomationNodeMoviePilotTitle, RSSAutomationNodeFilmFusionRecognize, RSSAutomationNodeMoviePilotTransfer, RSSAutomationNodeHDHiveUnlock,
 		RSSAutomationNodeMoviePilotRecognize, RSSAutomationNodeOrganizeStrm, RSSAutomationNodeStrmRegenerate, RSSAutomationNodeEmbyRefreshWait,
-		RSSAutomationNodeHTTPRequest, RSSAutomationNodeNotification:
+		RSSAutomationNodeHTTPRequest, RSSAutomationNodeNotification, RSSAutomationNodeCallWorkflow:
 		return port == "success" || port == "failure"
 	case RSSAutomationNodeTrigger:
 		return port == "next"
@@ -495,6 +497,8 @@ func validateRSSAutomationNodeConfig(node RSSAutomationNode) error {
 		config = map[string]any{}
 	}
 	switch node.Type {
+	case RSSAutomationNodeTrigger:
+		return validateRSSAutomationTriggerConfig(config)
 	case RSSAutomationNodeRegex:
 		pattern := rssAutomationConfigString(config, "pattern")
 		if pattern == "" {
@@ -541,6 +545,10 @@ func validateRSSAutomationNodeConfig(node RSSAutomationNode) error {
 		default:
 			return errors.New("转换类型必须是 string/integer/number/boolean/datetime")
 		}
+	case RSSAutomationNodeScript:
+		return validateRSSAutomationScriptConfig(config)
+	case RSSAutomationNodeCallWorkflow:
+		return validateRSSAutomationCallWorkflowConfig(config)
 	case RSSAutomationNodeIf:
 		condition, ok := config["condition"]
 		if !ok {
@@ -574,7 +582,7 @@ func validateRSSAutomationNodeConfig(node RSSAutomationNode) error {
 		}
 	case RSSAutomationNodeQBittorrent:
 		if rssAutomationConfigUint(config, "target_id") == 0 {
-			return errors.New("必须选择 qBittorrent 目标")
+			return errors.New("必须选择下载器目标")
 		}
 		if rssAutomationConfigString(config, "url") == "" {
 			return errors.New("必须配置下载地址变量")
@@ -582,10 +590,10 @@ func validateRSSAutomationNodeConfig(node RSSAutomationNode) error {
 	case RSSAutomationNodeWaitQBittorrent:
 		pollSeconds := rssAutomationConfigUint(config, "poll_interval_seconds")
 		if pollSeconds > 0 && (pollSeconds < 5 || pollSeconds > 300) {
-			return errors.New("qBittorrent 检查间隔必须在 5 到 300 秒之间")
+			return errors.New("下载器检查间隔必须在 5 到 300 秒之间")
 		}
 		if maxWaitMinutes := rssAutomationConfigUint(config, "max_wait_minutes"); maxWaitMinutes > 30*24*60 {
-			return errors.New("qBittorrent 最长等待不能超过 30 天")
+			return errors.New("下载器最长等待不能超过 30 天")
 		}
 	case RSSAutomationNodeDeleteQBittorrent:
 		if value, exists := config["delete_files"]; exists {
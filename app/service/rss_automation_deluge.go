@@ -0,0 +1,257 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+var rssAutomationDelugeTaskFields = []string{
+	"hash", "name", "state", "progress", "save_path", "total_wanted", "total_done",
+	"ratio", "eta", "is_finished", "message",
+}
+
+// rssAutomationDelugeClient 通过 Deluge Web UI 的 /json 接口调用守护进程。
+// Web UI 登录后若未连接守护进程，会自动连接第一个已配置的主机。
+type rssAutomationDelugeClient struct {
+	endpoint string
+	client   *http.Client
+	nextID   atomic.Int64
+}
+
+type rssAutomationDelugeTorrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	State       string  `json:"state"`
+	Progress    float64 `json:"progress"`
+	SavePath    string  `json:"save_path"`
+	TotalWanted int64   `json:"total_wanted"`
+	TotalDone   int64   `json:"total_done"`
+	Ratio       float64 `json:"ratio"`
+	ETA         int64   `json:"eta"`
+	IsFinished  bool    `json:"is_finished"`
+	Message     string  `json:"message"`
+	Files       []struct {
+		Path string `json:"path"`
+		Size int64  `json:"size"`
+	} `json:"files"`
+}
+
+func newRSSAutomationDelugeClient(ctx context.Context, config RSSAutomationDownloaderConfig) (*rssAutomationDelugeClient, error) {
+	jar, _ := cookiejar.New(nil)
+	client := &rssAutomationDelugeClient{
+		endpoint: rssAutomationRPCEndpoint(config.BaseURL, "/json"),
+		client:   &http.Client{Timeout: 20 * time.Second, Jar: jar},
+	}
+	var loggedIn bool
+	if err := client.call(ctx, "auth.login", []any{config.Password}, &loggedIn); err != nil {
+		return nil, err
+	}
+	if !loggedIn {
+		return nil, errors.New("Deluge 登录失败，请检查 Web UI 密码")
+	}
+	var connected bool
+	if err := client.call(ctx, "web.connected", []any{}, &connected); err != nil {
+		return nil, err
+	}
+	if connected {
+		return client, nil
+	}
+	var hosts [][]any
+	if err := client.call(ctx, "web.get_hosts", []any{}, &hosts); err != nil {
+		return nil, err
+	}
+	if len(hosts) == 0 || len(hosts[0]) == 0 {
+		return nil, errors.New("Deluge Web UI 没有可连接的守护进程")
+	}
+	if err := client.call(ctx, "web.connect", []any{hosts[0][0]}, nil); err != nil {
+		return nil, fmt.Errorf("Deluge 连接守护进程失败: %w", err)
+	}
+	return client, nil
+}
+
+func (client *rssAutomationDelugeClient) call(ctx context.Context, method string, params []any, result any) error {
+	payload, err := json.Marshal(map[string]any{"method": method, "params": params, "id": client.nextID.Add(1)})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.endpoint, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接 Deluge 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("Deluge 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var envelope struct {
+		Result json.RawMessage `json:"result"`
+		Error  *struct {
+			Message string `json:"message"`
+			Code    int    `json:"code"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return fmt.Errorf("解析 Deluge 响应失败: %w", err)
+	}
+	if envelope.Error != nil {
+		return fmt.Errorf("Deluge %s 失败: %s", method, envelope.Error.Message)
+	}
+	if result == nil || len(envelope.Result) == 0 || string(envelope.Result) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Result, result); err != nil {
+		return fmt.Errorf("解析 Deluge %s 结果失败: %w", method, err)
+	}
+	return nil
+}
+
+func (client *rssAutomationDelugeClient) testConnection(ctx context.Context) error {
+	var version string
+	if err := client.call(ctx, "daemon.info", []any{}, &version); err != nil {
+		return err
+	}
+	if version == "" {
+		return errors.New("Deluge 未返回守护进程版本")
+	}
+	return nil
+}
+
+func (client *rssAutomationDelugeClient) addTask(ctx context.Context, request rssAutomationDownloadRequest) (string, error) {
+	options := map[string]any{"add_paused": request.Paused}
+	if request.SavePath != "" {
+		options["download_location"] = request.SavePath
+	}
+	if request.Sequential {
+		options["sequential_download"] = true
+	}
+	var taskID string
+	var err error
+	if strings.HasPrefix(strings.ToLower(request.URL), "magnet:") {
+		err = client.call(ctx, "core.add_torrent_magnet", []any{request.URL, options}, &taskID)
+	} else {
+		err = client.call(ctx, "core.add_torrent_url", []any{request.URL, options, map[string]any{}}, &taskID)
+	}
+	if err != nil {
+		return "", err
+	}
+	if taskID == "" {
+		return "", errors.New("Deluge 未返回任务 ID，任务可能已存在")
+	}
+	// 分类依赖 Label 插件，插件未启用时忽略
+	if label := strings.ToLower(strings.TrimSpace(request.Category)); label != "" {
+		_ = client.call(ctx, "label.add", []any{label}, nil)
+		_ = client.call(ctx, "label.set_torrent", []any{taskID, label}, nil)
+	}
+	return taskID, nil
+}
+
+func (client *rssAutomationDelugeClient) torrentStatus(ctx context.Context, taskID string, fields []string) (*rssAutomationDelugeTorrent, error) {
+	// 任务不存在时 Deluge 返回空对象
+	var raw json.RawMessage
+	if err := client.call(ctx, "core.get_torrent_status", []any{taskID, fields}, &raw); err != nil {
+		return nil, err
+	}
+	if len(raw) == 0 || string(bytes.TrimSpace(raw)) == "{}" {
+		return nil, nil
+	}
+	var torrent rssAutomationDelugeTorrent
+	if err := json.Unmarshal(raw, &torrent); err != nil {
+		return nil, fmt.Errorf("解析 Deluge 任务失败: %w", err)
+	}
+	if torrent.Hash == "" {
+		torrent.Hash = taskID
+	}
+	return &torrent, nil
+}
+
+func (client *rssAutomationDelugeClient) findTask(ctx context.Context, taskID, _ string) (*rssAutomationDownloadTask, error) {
+	if taskID == "" {
+		return nil, errors.New("Deluge 任务缺少 ID")
+	}
+	torrent, err := client.torrentStatus(ctx, taskID, rssAutomationDelugeTaskFields)
+	if err != nil || torrent == nil {
+		return nil, err
+	}
+	task := &rssAutomationDownloadTask{
+		ID: torrent.Hash, Name: torrent.Name, State: torrent.State, Progress: torrent.Progress / 100,
+		SavePath: torrent.SavePath, ContentPath: rssAutomationJoinDownloadPath(torrent.SavePath, torrent.Name),
+		Size: torrent.TotalWanted, Downloaded: torrent.TotalDone, AmountLeft: max(torrent.TotalWanted-torrent.TotalDone, 0),
+		Ratio: torrent.Ratio, ETA: torrent.ETA,
+	}
+	if strings.EqualFold(torrent.State, "Error") {
+		task.Failed = true
+		if torrent.Message != "" {
+			task.State = "Error: " + torrent.Message
+		}
+	}
+	task.Completed = torrent.IsFinished || torrent.Progress >= 99.9999
+	return task, nil
+}
+
+func (client *rssAutomationDelugeClient) listFiles(ctx context.Context, taskID string) ([]rssAutomationDownloadFile, error) {
+	torrent, err := client.torrentStatus(ctx, taskID, []string{"hash", "files"})
+	if err != nil {
+		return nil, err
+	}
+	if torrent == nil {
+		return nil, errors.New("Deluge 任务不存在")
+	}
+	files := make([]rssAutomationDownloadFile, 0, len(torrent.Files))
+	for _, file := range torrent.Files {
+		files = append(files, rssAutomationDownloadFile{Name: file.Path, Size: file.Size})
+	}
+	return files, nil
+}
+
+func (client *rssAutomationDelugeClient) removeTask(ctx context.Context, taskID string, deleteFiles bool) error {
+	var removed bool
+	if err := client.call(ctx, "core.remove_torrent", []any{taskID, deleteFiles}, &removed); err != nil {
+		return err
+	}
+	if !removed {
+		return errors.New("Deluge 未能删除任务")
+	}
+	return nil
+}
+
+func (client *rssAutomationDelugeClient) transferInfo(ctx context.Context) (rssAutomationTransferInfo, error) {
+	var stats struct {
+		DownloadRate  float64 `json:"download_rate"`
+		UploadRate    float64 `json:"upload_rate"`
+		TotalDownload float64 `json:"total_download"`
+		TotalUpload   float64 `json:"total_upload"`
+		DHTNodes      float64 `json:"dht_nodes"`
+	}
+	keys := []string{"download_rate", "upload_rate", "total_download", "total_upload", "dht_nodes"}
+	if err := client.call(ctx, "core.get_session_status", []any{keys}, &stats); err != nil {
+		return rssAutomationTransferInfo{}, err
+	}
+	return rssAutomationTransferInfo{
+		ConnectionStatus: "connected",
+		DownloadSpeed:    int64(stats.DownloadRate), UploadSpeed: int64(stats.UploadRate),
+		DownloadedData: int64(stats.TotalDownload), UploadedData: int64(stats.TotalUpload),
+		DHTNodes: int(stats.DHTNodes),
+	}, nil
+}
+
+func (client *rssAutomationDelugeClient) activeTorrentCount(ctx context.Context) (int, error) {
+	var torrents map[string]json.RawMessage
+	if err := client.call(ctx, "core.get_torrents_status", []any{map[string]any{"state": "Active"}, []string{"hash"}}, &torrents); err != nil {
+		return 0, err
+	}
+	return len(torrents), nil
+}
@@ -0,0 +1,221 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+
+	"film-fusion/app/model"
+)
+
+// rssAutomationDownloader 是下载器目标的统一操作。qbittorrent / wait_qbittorrent /
+// delete_qbittorrent 节点只依赖该接口，因此可以绑定任意类型的下载器。
+//
+// 任务 ID 在 qBittorrent、Transmission、Deluge 中是 Torrent Hash，在 Aria2 中是 GID；
+// 提交时拿不到 ID 的下载器(qBittorrent)通过内部跟踪标签定位任务。
+type rssAutomationDownloader interface {
+	testConnection(ctx context.Context) error
+	addTask(ctx context.Context, request rssAutomationDownloadRequest) (string, error)
+	// findTask 按任务 ID 或跟踪标签查找任务，任务不存在时返回 nil
+	findTask(ctx context.Context, taskID, trackingTag string) (*rssAutomationDownloadTask, error)
+	listFiles(ctx context.Context, taskID string) ([]rssAutomationDownloadFile, error)
+	removeTask(ctx context.Context, taskID string, deleteFiles bool) error
+	transferInfo(ctx context.Context) (rssAutomationTransferInfo, error)
+	activeTorrentCount(ctx context.Context) (int, error)
+}
+
+type rssAutomationDownloadRequest struct {
+	URL         string
+	SavePath    string
+	Category    string
+	Tags        []string
+	TrackingTag string
+	Paused      bool
+	Sequential  bool
+}
+
+// rssAutomationDownloadTask 各下载器任务状态的统一表示，Progress 取值 0 到 1
+type rssAutomationDownloadTask struct {
+	ID          string
+	Name        string
+	State       string
+	Progress    float64
+	SavePath    string
+	ContentPath string
+	Size        int64
+	Downloaded  int64
+	AmountLeft  int64
+	Ratio       float64
+	ETA         int64
+	Completed   bool
+	Failed      bool
+}
+
+// rssAutomationDownloadFile 任务中的文件，Name 为相对保存目录的路径
+type rssAutomationDownloadFile struct {
+	Name string
+	Size int64
+}
+
+type rssAutomationTransferInfo struct {
+	ConnectionStatus string `json:"connection_status"`
+	DownloadSpeed    int64  `json:"dl_info_speed"`
+	DownloadedData   int64  `json:"dl_info_data"`
+	UploadSpeed      int64  `json:"up_info_speed"`
+	UploadedData     int64  `json:"up_info_data"`
+	DHTNodes         int    `json:"dht_nodes"`
+}
+
+// RSSAutomationDownloaderConfig Transmission / Deluge / Aria2 目标的配置。
+// base_url 只填主机时分别补全 /transmission/rpc、/json、/jsonrpc；
+// Transmission 使用可选的用户名密码，Deluge 使用 Web UI 密码，Aria2 的 RPC 密钥填在 password。
+type RSSAutomationDownloaderConfig struct {
+	BaseURL  string `json:"base_url"`
+	Username string `json:"username,omitempty"`
+	Password string `json:"password"`
+}
+
+func isRSSAutomationTargetType(targetType string) bool {
+	switch targetType {
+	case model.RSSAutomationTargetQBittorrent, model.RSSAutomationTargetTransmission,
+		model.RSSAutomationTargetDeluge, model.RSSAutomationTargetAria2:
+		return true
+	default:
+		return false
+	}
+}
+
+func rssAutomationTargetLabel(targetType string) string {
+	switch targetType {
+	case model.RSSAutomationTargetQBittorrent:
+		return "qBittorrent"
+	case model.RSSAutomationTargetTransmission:
+		return "Transmission"
+	case model.RSSAutomationTargetDeluge:
+		return "Deluge"
+	case model.RSSAutomationTargetAria2:
+		return "Aria2"
+	default:
+		return "下载器"
+	}
+}
+
+func (s *RSSAutomationService) newRSSAutomationDownloader(ctx context.Context, target model.RSSAutomationTarget) (rssAutomationDownloader, error) {
+	switch target.Type {
+	case model.RSSAutomationTargetQBittorrent:
+		return s.newRSSAutomationQBClient(ctx, target)
+	case model.RSSAutomationTargetTransmission, model.RSSAutomationTargetDeluge, model.RSSAutomationTargetAria2:
+		var config RSSAutomationDownloaderConfig
+		if err := json.Unmarshal([]byte(target.ConfigJSON), &config); err != nil {
+			return nil, fmt.Errorf("%s 目标配置损坏", rssAutomationTargetLabel(target.Type))
+		}
+		switch target.Type {
+		case model.RSSAutomationTargetTransmission:
+			return newRSSAutomationTransmissionClient(config), nil
+		case model.RSSAutomationTargetDeluge:
+			return newRSSAutomationDelugeClient(ctx, config)
+		default:
+			return newRSSAutomationAria2Client(config), nil
+		}
+	default:
+		return nil, fmt.Errorf("不支持的目标类型 %q", target.Type)
+	}
+}
+
+// loadRSSAutomationDownloader 读取已启用的下载器目标并建立客户端
+func (s *RSSAutomationService) loadRSSAutomationDownloader(ctx context.Context, targetID uint) (model.RSSAutomationTarget, rssAutomationDownloader, error) {
+	var target model.RSSAutomationTarget
+	if err := s.db.First(&target, targetID).Error; err != nil {
+		return target, nil, fmt.Errorf("下载器不存在: %w", err)
+	}
+	if !target.Enabled {
+		return target, nil, fmt.Errorf("%s 下载器已停用", rssAutomationTargetLabel(target.Type))
+	}
+	downloader, err := s.newRSSAutomationDownloader(ctx, target)
+	return target, downloader, err
+}
+
+// rssAutomationDownloadContentType 根据文件列表判断下载结果是单个文件还是目录
+func rssAutomationDownloadContentType(ctx context.Context, downloader rssAutomationDownloader, taskID string) (string, int, error) {
+	files, err := downloader.listFiles(ctx, taskID)
+	if err != nil {
+		return "", 0, err
+	}
+	if len(files) == 0 {
+		return "", 0, errors.New("下载任务没有返回文件")
+	}
+	firstName := strings.Trim(strings.ReplaceAll(files[0].Name, "\\", "/"), "/")
+	if len(files) == 1 && !strings.Contains(firstName, "/") {
+		return "file", 1, nil
+	}
+	return "dir", len(files), nil
+}
+
+// rssAutomationRPCEndpoint 地址没有路径时补全下载器默认的 RPC 路径
+func rssAutomationRPCEndpoint(baseURL, defaultPath string) string {
+	baseURL = strings.TrimRight(strings.TrimSpace(baseURL), "/")
+	parsed, err := url.Parse(baseURL)
+	if err == nil && (parsed.Path == "" || parsed.Path == "/") {
+		return baseURL + defaultPath
+	}
+	return baseURL
+}
+
+// rssAutomationJoinDownloadPath 拼接下载器返回的保存目录与任务名称，兼容 Windows 路径
+func rssAutomationJoinDownloadPath(directory, name string) string {
+	if directory == "" {
+		return name
+	}
+	if name == "" {
+		return directory
+	}
+	if strings.Contains(directory, "\\") && !strings.Contains(directory, "/") {
+		return strings.TrimRight(directory, "\\") + "\\" + name
+	}
+	return path.Join(directory, name)
+}
+
+func validateRSSAutomationDownloaderConfig(input RSSAutomationTargetInput, oldConfigJSON string) (string, error) {
+	label := rssAutomationTargetLabel(input.Type)
+	encoded, err := json.Marshal(input.Config)
+	if err != nil {
+		return "", err
+	}
+	var config RSSAutomationDownloaderConfig
+	if err := json.Unmarshal(encoded, &config); err != nil {
+		return "", fmt.Errorf("%s 配置格式错误", label)
+	}
+	// 未提交或提交掩码时保留原密码，显式提交空字符串表示清除
+	_, passwordProvided := input.Config["password"]
+	if oldConfigJSON != "" && (!passwordProvided || config.Password == rssAutomationSecretMask) {
+		var old RSSAutomationDownloaderConfig
+		if json.Unmarshal([]byte(oldConfigJSON), &old) == nil {
+			config.Password = old.Password
+		}
+	}
+	config.BaseURL = strings.TrimRight(strings.TrimSpace(config.BaseURL), "/")
+	config.Username = strings.TrimSpace(config.Username)
+	parsed, parseErr := url.ParseRequestURI(config.BaseURL)
+	if parseErr != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
+		return "", fmt.Errorf("%s 地址必须是有效的 HTTP 或 HTTPS URL", label)
+	}
+	switch input.Type {
+	case model.RSSAutomationTargetTransmission:
+		if config.Username != "" && config.Password == "" {
+			return "", errors.New("填写 Transmission 用户名时必须同时填写密码")
+		}
+	case model.RSSAutomationTargetDeluge:
+		config.Username = ""
+		if config.Password == "" {
+			return "", errors.New("请填写 Deluge Web UI 密码")
+		}
+	case model.RSSAutomationTargetAria2:
+		config.Username = ""
+	}
+	configJSON, _ := json.Marshal(config)
+	return string(configJSON), nil
+}
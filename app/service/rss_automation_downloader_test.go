@@ -0,0 +1,272 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"film-fusion/app/model"
+)
+
+func createRSSAutomationDownloaderTestTarget(t *testing.T, automation *RSSAutomationService, targetType, baseURL, password string) model.RSSAutomationTarget {
+	t.Helper()
+	config, _ := json.Marshal(RSSAutomationDownloaderConfig{BaseURL: baseURL, Password: password})
+	target := model.RSSAutomationTarget{Name: "mock " + targetType, Type: targetType, Enabled: true, ConfigJSON: string(config)}
+	if err := automation.db.Create(&target).Error; err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
+
+func TestRSSAutomationTransmissionSubmitsAndWaitsByHash(t *testing.T) {
+	const magnet = "magnet:?xt=urn:btih:ABCDEF123456&dn=episode"
+	var conflicts atomic.Int32
+	var addLabels []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/transmission/rpc" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.Header.Get(rssAutomationTransmissionSessionHeader) != "session-1" {
+			conflicts.Add(1)
+			w.Header().Set(rssAutomationTransmissionSessionHeader, "session-1")
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		var request struct {
+			Method    string         `json:"method"`
+			Arguments map[string]any `json:"arguments"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		switch request.Method {
+		case "torrent-add":
+			if request.Arguments["filename"] != magnet || request.Arguments["download-dir"] != "/downloads/动画" {
+				_, _ = w.Write([]byte(`{"result":"unexpected arguments"}`))
+				return
+			}
+			for _, label := range request.Arguments["labels"].([]any) {
+				addLabels = append(addLabels, label.(string))
+			}
+			_, _ = w.Write([]byte(`{"result":"success","arguments":{"torrent-added":{"hashString":"ABCDEF123456","name":"episode"}}}`))
+		case "torrent-get":
+			if ids, _ := request.Arguments["ids"].([]any); len(ids) != 1 || ids[0] != "abcdef123456" {
+				_, _ = w.Write([]byte(`{"result":"unexpected ids"}`))
+				return
+			}
+			_, _ = w.Write([]byte(`{"result":"success","arguments":{"torrents":[{"hashString":"ABCDEF123456","name":"episode","status":6,"error":2,"errorString":"tracker timeout","percentDone":1,"downloadDir":"/downloads/动画","sizeWhenDone":100,"leftUntilDone":0,"uploadRatio":0.5,"files":[{"name":"episode/e01.mkv","length":60},{"name":"episode/e02.mkv","length":40}]}]}}`))
+		default:
+			_, _ = w.Write([]byte(`{"result":"unsupported method"}`))
+		}
+	}))
+	defer server.Close()
+
+	automation := &RSSAutomationService{db: newRSSAutomationTestDB(t)}
+	target := createRSSAutomationDownloaderTestTarget(t, automation, model.RSSAutomationTargetTransmission, server.URL, "")
+	submitted, err := automation.executeRSSAutomationQBittorrent(context.Background(), RSSAutomationNode{Type: RSSAutomationNodeQBittorrent, Config: map[string]any{
+		"target_id": target.ID, "url": "$item.download_url", "save_path": "/downloads/{{item.category}}", "category": "{{item.category}}",
+	}}, map[string]any{"item": map[string]any{"download_url": magnet, "category": "动画"}})
+	if err != nil {
+		t.Fatalf("executeRSSAutomationQBittorrent() error = %v", err)
+	}
+	if submitted["task_id"] != "abcdef123456" || submitted["target_type"] != model.RSSAutomationTargetTransmission {
+		t.Fatalf("unexpected submit output: %#v", submitted)
+	}
+	if !slices.Contains(addLabels, "动画") || !slices.Contains(addLabels, submitted["torrent_tag"].(string)) {
+		t.Fatalf("labels = %#v, want category and tracking tag", addLabels)
+	}
+	if conflicts.Load() != 1 {
+		t.Fatalf("session negotiations = %d, want 1", conflicts.Load())
+	}
+
+	definition := RSSAutomationDefinition{Edges: []RSSAutomationEdge{{Source: "download", SourcePort: "success", Target: "wait"}}}
+	output, err := automation.executeRSSAutomationWaitQBittorrent(context.Background(), model.RSSAutomationNodeRun{}, RSSAutomationNode{
+		ID: "wait", Type: RSSAutomationNodeWaitQBittorrent,
+	}, definition, rssAutomationTestRunContext("download", submitted))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Tracker 错误不影响已完成的任务
+	if output["selected_port"] != "success" || output["hash"] != "abcdef123456" || output["content_path"] != "/downloads/动画/episode" || output["content_type"] != "dir" || output["file_count"] != 2 {
+		t.Fatalf("unexpected Transmission wait output: %#v", output)
+	}
+}
+
+func TestRSSAutomationDelugeConnectsDaemonAndDeletesFinishedTask(t *testing.T) {
+	var methods []string
+	var removeParams []any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/json" {
+			http.NotFound(w, r)
+			return
+		}
+		var request struct {
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+			ID     int64  `json:"id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		methods = append(methods, request.Method)
+		if request.Method != "auth.login" {
+			if cookie, err := r.Cookie("_session_id"); err != nil || cookie.Value != "deluge-session" {
+				_, _ = w.Write([]byte(`{"result":null,"error":{"message":"Not authenticated","code":1},"id":1}`))
+				return
+			}
+		}
+		var result string
+		switch request.Method {
+		case "auth.login":
+			if len(request.Params) != 1 || request.Params[0] != "deluge" {
+				result = `false`
+				break
+			}
+			http.SetCookie(w, &http.Cookie{Name: "_session_id", Value: "deluge-session", Path: "/"})
+			result = `true`
+		case "web.connected":
+			result = `false`
+		case "web.get_hosts":
+			result = `[["host-1","127.0.0.1",58846,"localclient"]]`
+		case "web.connect":
+			result = `["core.get_torrent_status"]`
+		case "core.get_torrent_status":
+			result = `{"hash":"abc","name":"Example.mkv","state":"Seeding","progress":100,"save_path":"/downloads","total_wanted":100,"total_done":100,"is_finished":true}`
+		case "core.remove_torrent":
+			removeParams = request.Params
+			result = `true`
+		default:
+			result = `null`
+		}
+		_, _ = w.Write([]byte(`{"result":` + result + `,"error":null,"id":1}`))
+	}))
+	defer server.Close()
+
+	automation := &RSSAutomationService{db: newRSSAutomationTestDB(t)}
+	target := createRSSAutomationDownloaderTestTarget(t, automation, model.RSSAutomationTargetDeluge, server.URL, "deluge")
+	definition := RSSAutomationDefinition{Edges: []RSSAutomationEdge{{Source: "wait", SourcePort: "success", Target: "delete"}}}
+	output, err := automation.executeRSSAutomationDeleteQBittorrent(context.Background(), RSSAutomationNode{
+		ID: "delete", Type: RSSAutomationNodeDeleteQBittorrent,
+	}, definition, rssAutomationTestRunContext("wait", map[string]any{"completed": true, "target_id": target.ID, "hash": "abc"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["deleted"] != true || output["already_missing"] != false || output["content_path"] != "/downloads/Example.mkv" {
+		t.Fatalf("unexpected Deluge delete output: %#v", output)
+	}
+	if len(removeParams) != 2 || removeParams[0] != "abc" || removeParams[1] != false {
+		t.Fatalf("core.remove_torrent params = %#v", removeParams)
+	}
+	if !slices.Contains(methods, "web.connect") {
+		t.Fatalf("daemon was not connected: %v", methods)
+	}
+}
+
+func TestRSSAutomationAria2WaitFollowsMetadataTask(t *testing.T) {
+	var tokens atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request struct {
+			Method string `json:"method"`
+			Params []any  `json:"params"`
+		}
+		if r.URL.Path != "/jsonrpc" || json.NewDecoder(r.Body).Decode(&request) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		if len(request.Params) == 0 || request.Params[0] != "token:rpc-secret" {
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":"1","error":{"code":1,"message":"Unauthorized"}}`))
+			return
+		}
+		tokens.Add(1)
+		var result string
+		switch {
+		case request.Method == "aria2.tellStatus" && request.Params[1] == "meta":
+			result = `{"gid":"meta","status":"complete","totalLength":"2048","completedLength":"2048","followedBy":["real"]}`
+		case request.Method == "aria2.tellStatus" && request.Params[1] == "real":
+			result = `{"gid":"real","status":"active","seeder":"true","totalLength":"100","completedLength":"100","uploadLength":"50","dir":"/downloads","bittorrent":{"info":{"name":"Example"}},"files":[{"path":"/downloads/Example/a.mkv","length":"60"},{"path":"/downloads/Example/b.mkv","length":"40"}]}`
+		default:
+			w.WriteHeader(http.StatusBadRequest)
+			_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":"1","error":{"code":1,"message":"GID ` + strings.TrimSpace(request.Method) + ` is not found"}}`))
+			return
+		}
+		_, _ = w.Write([]byte(`{"jsonrpc":"2.0","id":"1","result":` + result + `}`))
+	}))
+	defer server.Close()
+
+	automation := &RSSAutomationService{db: newRSSAutomationTestDB(t)}
+	target := createRSSAutomationDownloaderTestTarget(t, automation, model.RSSAutomationTargetAria2, server.URL, "rpc-secret")
+	definition := RSSAutomationDefinition{Edges: []RSSAutomationEdge{{Source: "download", SourcePort: "success", Target: "wait"}}}
+	output, err := automation.executeRSSAutomationWaitQBittorrent(context.Background(), model.RSSAutomationNodeRun{}, RSSAutomationNode{
+		ID: "wait", Type: RSSAutomationNodeWaitQBittorrent,
+	}, definition, rssAutomationTestRunContext("download", map[string]any{"target_id": target.ID, "task_id": "meta", "torrent_tag": "filmfusion-rss-test"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if output["selected_port"] != "success" || output["task_id"] != "real" || output["content_path"] != "/downloads/Example" || output["content_type"] != "dir" || output["file_count"] != 2 {
+		t.Fatalf("unexpected Aria2 wait output: %#v", output)
+	}
+
+	downloader := newRSSAutomationAria2Client(RSSAutomationDownloaderConfig{BaseURL: server.URL, Password: "rpc-secret"})
+	task, err := downloader.findTask(context.Background(), "missing", "")
+	if err != nil || task != nil {
+		t.Fatalf("missing GID = %#v, %v; want nil task", task, err)
+	}
+	if err := downloader.removeTask(context.Background(), "real", true); err == nil {
+		t.Fatal("Aria2 remove with files unexpectedly accepted")
+	}
+	if tokens.Load() == 0 {
+		t.Fatal("RPC secret was never sent")
+	}
+}
+
+func TestValidateRSSAutomationDownloaderTargetInput(t *testing.T) {
+	input := RSSAutomationTargetInput{Name: "TR", Type: model.RSSAutomationTargetTransmission, Enabled: true, Config: map[string]any{
+		"base_url": "http://nas.local:9091/", "username": "admin", "password": "secret",
+	}}
+	_, encoded, err := validateRSSAutomationTargetInput(input, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(encoded, `"base_url":"http://nas.local:9091"`) || !strings.Contains(encoded, `"password":"secret"`) {
+		t.Fatalf("unexpected Transmission config: %s", encoded)
+	}
+
+	input.Config = map[string]any{"base_url": "http://nas.local:9091", "username": "admin", "password": rssAutomationSecretMask}
+	_, encoded, err = validateRSSAutomationTargetInput(input, encoded)
+	if err != nil || !strings.Contains(encoded, `"password":"secret"`) {
+		t.Fatalf("masked update did not preserve password: %s (err=%v)", encoded, err)
+	}
+
+	target := model.RSSAutomationTarget{Type: model.RSSAutomationTargetTransmission, ConfigJSON: encoded}
+	redactRSSAutomationTarget(&target)
+	if strings.Contains(target.ConfigJSON, `"secret"`) || !strings.Contains(target.ConfigJSON, rssAutomationSecretMask) {
+		t.Fatalf("redacted target leaked a secret: %s", target.ConfigJSON)
+	}
+
+	invalid := []RSSAutomationTargetInput{
+		{Name: "Deluge", Type: model.RSSAutomationTargetDeluge, Config: map[string]any{"base_url": "http://nas.local:8112"}},
+		{Name: "Aria2", Type: model.RSSAutomationTargetAria2, Config: map[string]any{"base_url": "ftp://nas.local:6800"}},
+		{Name: "rTorrent", Type: "rtorrent", Config: map[string]any{"base_url": "http://nas.local"}},
+	}
+	for _, input := range invalid {
+		if _, _, err := validateRSSAutomationTargetInput(input, ""); err == nil {
+			t.Fatalf("target %#v unexpectedly accepted", input)
+		}
+	}
+	if got := rssAutomationRPCEndpoint("http://nas.local:6800/", "/jsonrpc"); got != "http://nas.local:6800/jsonrpc" {
+		t.Fatalf("endpoint = %q", got)
+	}
+	if got := rssAutomationRPCEndpoint("https://nas.local/aria2/jsonrpc", "/jsonrpc"); got != "https://nas.local/aria2/jsonrpc" {
+		t.Fatalf("endpoint with path = %q", got)
+	}
+}
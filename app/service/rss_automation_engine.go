@@ -106,6 +106,7 @@ func (s *RSSAutomationService) advanceRSSAutomationRun(run model.RSSAutomationRu
 					Updates(map[string]any{"status": model.RSSAutomationNodeSkipped, "output_json": outputJSON, "completed_at": now}).Error; err != nil {
 					return err
 				}
+				rssNodeOutcomesMetric.Inc(nodeRun.NodeType, model.RSSAutomationNodeSkipped)
 				nodeRun.Status = model.RSSAutomationNodeSkipped
 				nodeRun.OutputJSON = outputJSON
 				nodeRun.CompletedAt = &now
@@ -252,7 +253,7 @@ func (s *RSSAutomationService) executeRSSAutomationNodeRun(runID, nodeRunID uint
 		s.completeRSSAutomationNode(nodeRun, nil, errors.New("流程定义中找不到节点"))
 		return
 	}
-	runContext, err := s.buildRSSAutomationRunContext(run)
+	runContext, err := s.buildRSSAutomationRunContext(run, rssAutomationNodeContextScope(node))
 	if err != nil {
 		s.completeRSSAutomationNode(nodeRun, nil, err)
 		return
@@ -277,6 +278,8 @@ func (s *RSSAutomationService) executeRSSAutomationNode(ctx context.Context, run
 		return executeRSSAutomationKeywordNode(node, runContext)
 	case RSSAutomationNodeConvert:
 		return executeRSSAutomationConvertNode(node, runContext)
+	case RSSAutomationNodeScript:
+		return executeRSSAutomationScriptNode(ctx, node, runContext)
 	case RSSAutomationNodeIf:
 		matched, err := evaluateRSSAutomationCondition(node.Config["condition"], runContext)
 		if err != nil {
@@ -335,6 +338,12 @@ func (s *RSSAutomationService) executeRSSAutomationNode(ctx context.Context, run
 	case RSSAutomationNodeNotification:
 		output, err := s.executeRSSAutomationNotification(ctx, node, runContext)
 		return withRSSAutomationSelectedPort(output, err), err
+	case RSSAutomationNodeCallWorkflow:
+		return s.executeRSSAutomationCallWorkflowNode(run.ID, node, definition)
+	case rssAutomationNodeSubWorkflowInput:
+		return executeRSSAutomationSubWorkflowInputNode(node, runContext)
+	case rssAutomationNodeSubWorkflowOutput:
+		return executeRSSAutomationSubWorkflowOutputNode(node, runContext)
 	case RSSAutomationNodeEnd:
 		return map[string]any{"completed": true}, nil
 	default:
@@ -555,6 +564,11 @@ func (s *RSSAutomationService) completeRSSAutomationNode(nodeRun model.RSSAutoma
 	if updateErr != nil || !updated {
 		return
 	}
+	outcome, _ := updates["status"].(string)
+	if outcome == model.RSSAutomationNodePending {
+		outcome = "retry"
+	}
+	rssNodeOutcomesMetric.Inc(nodeRun.NodeType, outcome)
 	_ = s.finalizeRSSAutomationRun(nodeRun.RunID)
 }
 
@@ -587,7 +601,9 @@ func (s *RSSAutomationService) deferRSSAutomationNode(nodeRun model.RSSAutomatio
 	})
 }
 
-func (s *RSSAutomationService) buildRSSAutomationRunContext(run model.RSSAutomationRun) (map[string]any, error) {
+// buildRSSAutomationRunContext 构建 scope 作用域内节点看到的上下文。顶层作用域为空；
+// 子流程作用域中 $nodes 只包含该作用域下的节点并可用子流程内的原始 ID 引用，$vars 从空开始，$inputs 为调用参数。
+func (s *RSSAutomationService) buildRSSAutomationRunContext(run model.RSSAutomationRun, scope string) (map[string]any, error) {
 	contextValue := map[string]any{}
 	decoder := json.NewDecoder(strings.NewReader(run.ContextJSON))
 	decoder.UseNumber()
@@ -595,7 +611,7 @@ func (s *RSSAutomationService) buildRSSAutomationRunContext(run model.RSSAutomat
 		return nil, err
 	}
 	variables, _ := contextValue["vars"].(map[string]any)
-	if variables == nil {
+	if variables == nil || scope != "" {
 		variables = map[string]any{}
 		contextValue["vars"] = variables
 	}
@@ -605,21 +621,35 @@ func (s *RSSAutomationService) buildRSSAutomationRunContext(run model.RSSAutomat
 	if err := s.db.Where("run_id = ?", run.ID).Order("id ASC").Find(&nodeRuns).Error; err != nil {
 		return nil, err
 	}
+	prefix := scope + "/"
 	for _, nodeRun := range nodeRuns {
+		if scope != "" && !strings.HasPrefix(nodeRun.NodeID, prefix) {
+			continue
+		}
 		output := map[string]any{}
 		if nodeRun.OutputJSON != "" {
 			outputDecoder := json.NewDecoder(strings.NewReader(nodeRun.OutputJSON))
 			outputDecoder.UseNumber()
 			_ = outputDecoder.Decode(&output)
 		}
+		nodeValue := map[string]any{
+			"status": nodeRun.Status, "attempt": nodeRun.Attempt, "output": output,
+		}
+		nodeValues[nodeRun.NodeID] = nodeValue
+		if rssAutomationNodeScope(nodeRun.NodeID) != scope {
+			continue
+		}
+		if scope != "" {
+			nodeValues[strings.TrimPrefix(nodeRun.NodeID, prefix)] = nodeValue
+			if nodeRun.NodeType == rssAutomationNodeSubWorkflowInput {
+				contextValue["inputs"] = output["inputs"]
+			}
+		}
 		if produced, ok := output["variables"].(map[string]any); ok {
 			for key, value := range produced {
 				variables[key] = value
 			}
 		}
-		nodeValues[nodeRun.NodeID] = map[string]any{
-			"status": nodeRun.Status, "attempt": nodeRun.Attempt, "output": output,
-		}
 	}
 	return contextValue, nil
 }
@@ -868,20 +898,28 @@ func (s *RSSAutomationService) finalizeRSSAutomationRun(runID uint) error {
 		status = model.RSSAutomationRunPartial
 	}
 	now := time.Now()
-	return s.db.Model(&model.RSSAutomationRun{}).
+	result := s.db.Model(&model.RSSAutomationRun{}).
 		Where("id = ? AND status IN ?", runID, []string{model.RSSAutomationRunPending, model.RSSAutomationRunRunning}).
 		Updates(map[string]any{
 			"status": status, "error_message": strings.Join(failed, "; "), "completed_at": now,
-		}).Error
+		})
+	if result.Error == nil && result.RowsAffected > 0 {
+		rssRunOutcomesMetric.Inc(status)
+	}
+	return result.Error
 }
 
 func (s *RSSAutomationService) failRSSAutomationRun(runID uint, runErr error) error {
 	now := time.Now()
-	return s.db.Model(&model.RSSAutomationRun{}).
+	result := s.db.Model(&model.RSSAutomationRun{}).
 		Where("id = ? AND status IN ?", runID, []string{model.RSSAutomationRunPending, model.RSSAutomationRunRunning}).
 		Updates(map[string]any{
 			"status": model.RSSAutomationRunFailed, "error_message": runErr.Error(), "completed_at": now,
-		}).Error
+		})
+	if result.Error == nil && result.RowsAffected > 0 {
+		rssRunOutcomesMetric.Inc(model.RSSAutomationRunFailed)
+	}
+	return result.Error
 }
 
 func (s *RSSAutomationService) ListRuns(workflowID uint, status string, limit, offset int) ([]model.RSSAutomationRun, int64, error) {
@@ -1001,7 +1039,7 @@ func (s *RSSAutomationService) CancelRun(runID uint) error {
 		return errors.New("当前流程不能取消")
 	}
 	now := time.Now()
-	return s.db.Transaction(func(tx *gorm.DB) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
 		if err := tx.Model(&model.RSSAutomationNodeRun{}).Where("run_id = ? AND status IN ?", runID, []string{model.RSSAutomationNodePending, model.RSSAutomationNodeRunning}).Updates(map[string]any{
 			"status": model.RSSAutomationNodeCancelled, "completed_at": now,
 		}).Error; err != nil {
@@ -1009,6 +1047,10 @@ func (s *RSSAutomationService) CancelRun(runID uint) error {
 		}
 		return tx.Model(&run).Updates(map[string]any{"status": model.RSSAutomationRunCancelled, "completed_at": now}).Error
 	})
+	if err == nil {
+		rssRunOutcomesMetric.Inc(model.RSSAutomationRunCancelled)
+	}
+	return err
 }
 
 func isRSSAutomationNodeTerminal(status string) bool {
@@ -184,7 +184,7 @@ func newRSSAutomationTestDB(t *testing.T) *gorm.DB {
 	}
 	if err := db.AutoMigrate(
 		&model.SystemConfig{},
-		&model.RSSAutomationSource{}, &model.RSSAutomationWorkflow{}, &model.RSSAutomationTarget{},
+		&model.RSSAutomationSource{}, &model.RSSAutomationWorkflow{}, &model.RSSAutomationSubWorkflow{}, &model.RSSAutomationTarget{},
 		&model.RSSAutomationEntry{}, &model.RSSAutomationRun{}, &model.RSSAutomationNodeRun{},
 		&model.CloudStorage{},
 	); err != nil {
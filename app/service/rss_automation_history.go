@@ -74,7 +74,7 @@ func (s *RSSAutomationService) ListEntryHistory(filter string, sourceID uint, li
 		offset = 0
 	}
 
-	query := s.db.Model(&model.RSSAutomationEntry{})
+	query := s.db.Model(&model.RSSAutomationEntry{}).Where("trigger_type = ?", "")
 	if sourceID > 0 {
 		query = query.Where("source_id = ?", sourceID)
 	}
@@ -0,0 +1,684 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+)
+
+// HTML 源使用 CSS 选择器：
+//   - 条目选择器在整个页面上匹配，如 table.torrents tr.row
+//   - 字段选择器在条目内部匹配，末尾的 @属性 取属性值，否则取元素文本；只写 @属性 表示条目元素本身的属性
+//   - 支持标签、*、#id、.class、[attr] / [attr=v] / [attr~=v] / [attr^=v] / [attr$=v] / [attr*=v]、
+//     :first-child / :last-child / :nth-child(an+b | odd | even)，后代、>、+、~ 组合符以及逗号分组
+//   - href / src 等链接属性按页面地址(或 <base href>)补全为绝对地址
+const maxRSSAutomationHTMLSelectors = 64
+
+var rssAutomationHTMLURLAttributes = map[string]bool{"href": true, "src": true, "data-src": true, "data-href": true}
+
+type rssAutomationCSSAttr struct {
+	name  string
+	op    string
+	value string
+}
+
+type rssAutomationCSSNth struct {
+	a, b int
+}
+
+type rssAutomationCSSCompound struct {
+	tag     string
+	id      string
+	classes []string
+	attrs   []rssAutomationCSSAttr
+	nth     []rssAutomationCSSNth
+	last    bool
+}
+
+// rssAutomationCSSComplex 由组合符连接的简单选择器序列；combinators[i] 连接 parts[i-1] 与 parts[i]
+type rssAutomationCSSComplex struct {
+	parts       []rssAutomationCSSCompound
+	combinators []byte
+}
+
+type rssAutomationCSSSelector []rssAutomationCSSComplex
+
+func compileRSSAutomationCSS(selector string) (rssAutomationCSSSelector, error) {
+	selector = strings.TrimSpace(selector)
+	if selector == "" {
+		return nil, errors.New("选择器不能为空")
+	}
+	groups, err := splitRSSAutomationCSSTopLevel(selector, ',')
+	if err != nil {
+		return nil, err
+	}
+	compiled := make(rssAutomationCSSSelector, 0, len(groups))
+	for _, group := range groups {
+		complex, err := compileRSSAutomationCSSComplex(strings.TrimSpace(group))
+		if err != nil {
+			return nil, err
+		}
+		compiled = append(compiled, complex)
+	}
+	return compiled, nil
+}
+
+// compileRSSAutomationHTMLFieldSelector 拆出末尾的 @属性；CSS 部分为空时表示条目本身
+func compileRSSAutomationHTMLFieldSelector(selector string) (rssAutomationCSSSelector, string, error) {
+	selector = strings.TrimSpace(selector)
+	attribute := ""
+	depth := 0
+	for i := len(selector) - 1; i >= 0; i-- {
+		switch selector[i] {
+		case ']', ')':
+			depth++
+		case '[', '(':
+			depth--
+		}
+		if selector[i] == '@' && depth == 0 {
+			attribute = strings.ToLower(strings.TrimSpace(selector[i+1:]))
+			selector = strings.TrimSpace(selector[:i])
+			if attribute == "" {
+				return nil, "", errors.New("@ 之后缺少属性名")
+			}
+			break
+		}
+	}
+	if selector == "" {
+		if attribute == "" {
+			return nil, "", errors.New("选择器不能为空")
+		}
+		return nil, attribute, nil
+	}
+	compiled, err := compileRSSAutomationCSS(selector)
+	return compiled, attribute, err
+}
+
+func splitRSSAutomationCSSTopLevel(selector string, separator byte) ([]string, error) {
+	parts := make([]string, 0, 1)
+	depth := 0
+	quote := byte(0)
+	start := 0
+	for i := 0; i < len(selector); i++ {
+		c := selector[i]
+		switch {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '[' || c == '(':
+			depth++
+		case c == ']' || c == ')':
+			depth--
+		case c == separator && depth == 0:
+			parts = append(parts, selector[start:i])
+			start = i + 1
+		}
+	}
+	if depth != 0 || quote != 0 {
+		return nil, fmt.Errorf("选择器 %q 括号或引号不匹配", selector)
+	}
+	parts = append(parts, selector[start:])
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			return nil, fmt.Errorf("选择器 %q 中有空的分组", selector)
+		}
+	}
+	return parts, nil
+}
+
+func compileRSSAutomationCSSComplex(selector string) (rssAutomationCSSComplex, error) {
+	var complex rssAutomationCSSComplex
+	pending := byte(0)
+	i := 0
+	for i < len(selector) {
+		c := selector[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n':
+			if pending == 0 && len(complex.parts) > 0 {
+				pending = ' '
+			}
+			i++
+		case c == '>' || c == '+' || c == '~':
+			if len(complex.parts) == 0 || (pending != 0 && pending != ' ') {
+				return complex, fmt.Errorf("选择器 %q 中组合符 %q 位置无效", selector, string(c))
+			}
+			pending = c
+			i++
+		default:
+			compound, consumed, err := compileRSSAutomationCSSCompound(selector[i:])
+			if err != nil {
+				return complex, fmt.Errorf("选择器 %q: %w", selector, err)
+			}
+			if len(complex.parts) > 0 {
+				complex.combinators = append(complex.combinators, pending)
+			} else {
+				complex.combinators = append(complex.combinators, 0)
+			}
+			complex.parts = append(complex.parts, compound)
+			pending = 0
+			i += consumed
+		}
+	}
+	if len(complex.parts) == 0 || (pending != 0 && pending != ' ') {
+		return complex, fmt.Errorf("选择器 %q 不完整", selector)
+	}
+	return complex, nil
+}
+
+var rssAutomationCSSIdentPattern = regexp.MustCompile(`^-?[A-Za-z_\x{80}-\x{10FFFF}][A-Za-z0-9_\-\x{80}-\x{10FFFF}]*`)
+
+func compileRSSAutomationCSSCompound(selector string) (rssAutomationCSSCompound, int, error) {
+	var compound rssAutomationCSSCompound
+	i := 0
+	if strings.HasPrefix(selector, "*") {
+		i = 1
+	} else if ident := rssAutomationCSSIdentPattern.FindString(selector); ident != "" {
+		compound.tag = strings.ToLower(ident)
+		i = len(ident)
+	}
+	for i < len(selector) {
+		rest := selector[i:]
+		switch rest[0] {
+		case '#', '.':
+			ident := rssAutomationCSSIdentPattern.FindString(rest[1:])
+			if ident == "" {
+				return compound, 0, fmt.Errorf("%q 之后缺少名称", string(rest[0]))
+			}
+			if rest[0] == '#' {
+				compound.id = ident
+			} else {
+				compound.classes = append(compound.classes, ident)
+			}
+			i += 1 + len(ident)
+		case '[':
+			end := strings.IndexByte(rest, ']')
+			if end < 0 {
+				return compound, 0, errors.New("属性选择器缺少 ]")
+			}
+			attr, err := compileRSSAutomationCSSAttr(rest[1:end])
+			if err != nil {
+				return compound, 0, err
+			}
+			compound.attrs = append(compound.attrs, attr)
+			i += end + 1
+		case ':':
+			ident := rssAutomationCSSIdentPattern.FindString(rest[1:])
+			name := strings.ToLower(ident)
+			i += 1 + len(ident)
+			switch name {
+			case "first-child":
+				compound.nth = append(compound.nth, rssAutomationCSSNth{a: 0, b: 1})
+			case "last-child":
+				compound.last = true
+			case "nth-child":
+				if i >= len(selector) || selector[i] != '(' {
+					return compound, 0, errors.New(":nth-child 缺少参数")
+				}
+				end := strings.IndexByte(selector[i:], ')')
+				if end < 0 {
+					return compound, 0, errors.New(":nth-child 缺少 )")
+				}
+				nth, err := parseRSSAutomationCSSNth(selector[i+1 : i+end])
+				if err != nil {
+					return compound, 0, err
+				}
+				compound.nth = append(compound.nth, nth)
+				i += end + 1
+			default:
+				return compound, 0, fmt.Errorf("不支持的伪类 :%s", ident)
+			}
+		default:
+			if i == 0 {
+				return compound, 0, fmt.Errorf("无法解析 %q", rest)
+			}
+			return compound, i, nil
+		}
+	}
+	return compound, i, nil
+}
+
+func compileRSSAutomationCSSAttr(raw string) (rssAutomationCSSAttr, error) {
+	raw = strings.TrimSpace(raw)
+	if index := strings.IndexByte(raw, '='); index > 0 {
+		name, op := raw[:index], "="
+		if strings.ContainsRune("~^$*", rune(name[len(name)-1])) {
+			name, op = name[:len(name)-1], name[len(name)-1:]+"="
+		}
+		value := strings.TrimSpace(raw[index+1:])
+		if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+			value = value[1 : len(value)-1]
+		}
+		name = strings.TrimSpace(name)
+		if name == "" {
+			return rssAutomationCSSAttr{}, fmt.Errorf("属性选择器 [%s] 无效", raw)
+		}
+		return rssAutomationCSSAttr{name: strings.ToLower(name), op: op, value: value}, nil
+	}
+	if !rssAutomationCSSIdentPattern.MatchString(raw) {
+		return rssAutomationCSSAttr{}, fmt.Errorf("属性选择器 [%s] 无效", raw)
+	}
+	return rssAutomationCSSAttr{name: strings.ToLower(raw)}, nil
+}
+
+func parseRSSAutomationCSSNth(raw string) (rssAutomationCSSNth, error) {
+	raw = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(raw), " ", ""))
+	switch raw {
+	case "odd":
+		return rssAutomationCSSNth{a: 2, b: 1}, nil
+	case "even":
+		return rssAutomationCSSNth{a: 2, b: 0}, nil
+	}
+	index := strings.IndexByte(raw, 'n')
+	if index < 0 {
+		b, err := strconv.Atoi(raw)
+		if err != nil {
+			return rssAutomationCSSNth{}, fmt.Errorf(":nth-child(%s) 参数无效", raw)
+		}
+		return rssAutomationCSSNth{b: b}, nil
+	}
+	nth := rssAutomationCSSNth{a: 1}
+	switch coefficient := raw[:index]; coefficient {
+	case "", "+":
+	case "-":
+		nth.a = -1
+	default:
+		a, err := strconv.Atoi(coefficient)
+		if err != nil {
+			return rssAutomationCSSNth{}, fmt.Errorf(":nth-child(%s) 参数无效", raw)
+		}
+		nth.a = a
+	}
+	if offset := raw[index+1:]; offset != "" {
+		b, err := strconv.Atoi(offset)
+		if err != nil {
+			return rssAutomationCSSNth{}, fmt.Errorf(":nth-child(%s) 参数无效", raw)
+		}
+		nth.b = b
+	}
+	return nth, nil
+}
+
+func (s rssAutomationCSSSelector) match(node *html.Node) bool {
+	for _, complex := range s {
+		if complex.matchAt(node, len(complex.parts)-1) {
+			return true
+		}
+	}
+	return false
+}
+
+// selectWithin 返回 root 的后代中匹配的元素(文档顺序)，祖先可以位于 root 之外，与 querySelectorAll 一致
+func (s rssAutomationCSSSelector) selectWithin(root *html.Node) []*html.Node {
+	matches := make([]*html.Node, 0, 4)
+	var walk func(*html.Node)
+	walk = func(node *html.Node) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if child.Type != html.ElementNode {
+				continue
+			}
+			if s.match(child) {
+				matches = append(matches, child)
+			}
+			walk(child)
+		}
+	}
+	walk(root)
+	return matches
+}
+
+func (c rssAutomationCSSComplex) matchAt(node *html.Node, index int) bool {
+	if !c.parts[index].match(node) {
+		return false
+	}
+	if index == 0 {
+		return true
+	}
+	switch c.combinators[index] {
+	case '>':
+		parent := rssAutomationHTMLParentElement(node)
+		return parent != nil && c.matchAt(parent, index-1)
+	case '+':
+		previous := rssAutomationHTMLPreviousElement(node)
+		return previous != nil && c.matchAt(previous, index-1)
+	case '~':
+		for previous := rssAutomationHTMLPreviousElement(node); previous != nil; previous = rssAutomationHTMLPreviousElement(previous) {
+			if c.matchAt(previous, index-1) {
+				return true
+			}
+		}
+	default:
+		for parent := rssAutomationHTMLParentElement(node); parent != nil; parent = rssAutomationHTMLParentElement(parent) {
+			if c.matchAt(parent, index-1) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func (c rssAutomationCSSCompound) match(node *html.Node) bool {
+	if node.Type != html.ElementNode {
+		return false
+	}
+	if c.tag != "" && node.Data != c.tag {
+		return false
+	}
+	if c.id != "" && rssAutomationHTMLAttribute(node, "id") != c.id {
+		return false
+	}
+	for _, class := range c.classes {
+		if !rssAutomationContainsWord(rssAutomationHTMLAttribute(node, "class"), class) {
+			return false
+		}
+	}
+	for _, attr := range c.attrs {
+		value, ok := rssAutomationHTMLLookupAttribute(node, attr.name)
+		if !ok {
+			return false
+		}
+		switch attr.op {
+		case "=":
+			ok = value == attr.value
+		case "~=":
+			ok = rssAutomationContainsWord(value, attr.value)
+		case "^=":
+			ok = attr.value != "" && strings.HasPrefix(value, attr.value)
+		case "$=":
+			ok = attr.value != "" && strings.HasSuffix(value, attr.value)
+		case "*=":
+			ok = attr.value != "" && strings.Contains(value, attr.value)
+		}
+		if !ok {
+			return false
+		}
+	}
+	if len(c.nth) > 0 || c.last {
+		position, total := rssAutomationHTMLElementPosition(node)
+		for _, nth := range c.nth {
+			if !nth.matches(position) {
+				return false
+			}
+		}
+		if c.last && position != total {
+			return false
+		}
+	}
+	return true
+}
+
+func (n rssAutomationCSSNth) matches(position int) bool {
+	if n.a == 0 {
+		return position == n.b
+	}
+	offset := position - n.b
+	return offset%n.a == 0 && offset/n.a >= 0
+}
+
+func rssAutomationContainsWord(list, word string) bool {
+	for _, item := range strings.Fields(list) {
+		if item == word {
+			return true
+		}
+	}
+	return false
+}
+
+func rssAutomationHTMLParentElement(node *html.Node) *html.Node {
+	for parent := node.Parent; parent != nil; parent = parent.Parent {
+		if parent.Type == html.ElementNode {
+			return parent
+		}
+	}
+	return nil
+}
+
+func rssAutomationHTMLPreviousElement(node *html.Node) *html.Node {
+	for previous := node.PrevSibling; previous != nil; previous = previous.PrevSibling {
+		if previous.Type == html.ElementNode {
+			return previous
+		}
+	}
+	return nil
+}
+
+// rssAutomationHTMLElementPosition 返回元素在同级元素中的序号(从 1 开始)与同级元素总数
+func rssAutomationHTMLElementPosition(node *html.Node) (int, int) {
+	if node.Parent == nil {
+		return 1, 1
+	}
+	position, total := 0, 0
+	for sibling := node.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type != html.ElementNode {
+			continue
+		}
+		total++
+		if sibling == node {
+			position = total
+		}
+	}
+	return position, total
+}
+
+func rssAutomationHTMLLookupAttribute(node *html.Node, name string) (string, bool) {
+	for _, attribute := range node.Attr {
+		if attribute.Namespace == "" && strings.EqualFold(attribute.Key, name) {
+			return attribute.Val, true
+		}
+	}
+	return "", false
+}
+
+func rssAutomationHTMLAttribute(node *html.Node, name string) string {
+	value, _ := rssAutomationHTMLLookupAttribute(node, name)
+	return value
+}
+
+// rssAutomationHTMLText 元素内的全部文本，连续空白折叠为一个空格
+func rssAutomationHTMLText(node *html.Node) string {
+	var builder strings.Builder
+	var walk func(*html.Node)
+	walk = func(current *html.Node) {
+		if current.Type == html.TextNode {
+			builder.WriteString(current.Data)
+			builder.WriteByte(' ')
+			return
+		}
+		if current.Type == html.ElementNode && (current.Data == "script" || current.Data == "style") {
+			return
+		}
+		for child := current.FirstChild; child != nil; child = child.NextSibling {
+			walk(child)
+		}
+	}
+	walk(node)
+	return strings.Join(strings.Fields(builder.String()), " ")
+}
+
+func parseRSSAutomationHTMLFeed(body []byte, feedURL string, mapping RSSAutomationMapping, limit int) (RSSAutomationParsedFeed, error) {
+	document, err := html.Parse(bytes.NewReader(body))
+	if err != nil {
+		return RSSAutomationParsedFeed{}, fmt.Errorf("解析 HTML 失败: %w", err)
+	}
+	itemSelector, err := compileRSSAutomationCSS(mapping.ItemSelector)
+	if err != nil {
+		return RSSAutomationParsedFeed{}, err
+	}
+	itemNodes := itemSelector.selectWithin(document)
+	if len(itemNodes) == 0 {
+		return RSSAutomationParsedFeed{}, fmt.Errorf("没有找到条目节点 %q", mapping.ItemSelector)
+	}
+	if limit > 0 && len(itemNodes) > limit {
+		itemNodes = itemNodes[:limit]
+	}
+	base, _ := url.Parse(strings.TrimSpace(feedURL))
+	titleSelector, _ := compileRSSAutomationCSS("head title")
+	baseSelector, _ := compileRSSAutomationCSS("base[href]")
+	if nodes := baseSelector.selectWithin(document); len(nodes) > 0 {
+		if href, err := url.Parse(strings.TrimSpace(rssAutomationHTMLAttribute(nodes[0], "href"))); err == nil {
+			if base != nil {
+				base = base.ResolveReference(href)
+			} else if href.IsAbs() {
+				base = href
+			}
+		}
+	}
+	parsed := RSSAutomationParsedFeed{Items: make([]RSSAutomationParsedItem, 0, len(itemNodes))}
+	if nodes := titleSelector.selectWithin(document); len(nodes) > 0 {
+		parsed.Title = rssAutomationHTMLText(nodes[0])
+	}
+	parsed.Selectors = discoverRSSAutomationHTMLSelectors(itemNodes[0])
+	type fieldSelector struct {
+		css       rssAutomationCSSSelector
+		attribute string
+	}
+	fieldSelectors := make(map[string]fieldSelector, len(mapping.Fields))
+	for _, field := range mapping.Fields {
+		css, attribute, err := compileRSSAutomationHTMLFieldSelector(field.Selector)
+		if err != nil {
+			return RSSAutomationParsedFeed{}, fmt.Errorf("字段 %s: %w", field.Name, err)
+		}
+		fieldSelectors[field.Name] = fieldSelector{css: css, attribute: attribute}
+	}
+	for _, itemNode := range itemNodes {
+		parsed.Items = append(parsed.Items, buildRSSAutomationItem(mapping.Fields, func(field RSSAutomationFieldMapping) ([]string, error) {
+			selector := fieldSelectors[field.Name]
+			return extractRSSAutomationHTMLField(itemNode, selector.css, selector.attribute, base, field)
+		}))
+	}
+	return parsed, nil
+}
+
+func extractRSSAutomationHTMLField(item *html.Node, css rssAutomationCSSSelector, attribute string, base *url.URL, field RSSAutomationFieldMapping) ([]string, error) {
+	var matchPattern *regexp.Regexp
+	if strings.TrimSpace(field.MatchPattern) != "" {
+		compiled, err := regexp.Compile(field.MatchPattern)
+		if err != nil {
+			return nil, err
+		}
+		matchPattern = compiled
+	}
+	nodes := []*html.Node{item}
+	if css != nil {
+		nodes = css.selectWithin(item)
+	}
+	values := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		if field.MatchAttribute != "" {
+			candidate := rssAutomationHTMLAttribute(node, field.MatchAttribute)
+			if matchPattern != nil && !matchPattern.MatchString(candidate) {
+				continue
+			}
+			if matchPattern == nil && candidate == "" {
+				continue
+			}
+		}
+		value := rssAutomationHTMLText(node)
+		if attribute != "" {
+			value = strings.TrimSpace(rssAutomationHTMLAttribute(node, attribute))
+			if value != "" && base != nil && rssAutomationHTMLURLAttributes[attribute] {
+				if ref, err := url.Parse(value); err == nil && !ref.IsAbs() {
+					value = base.ResolveReference(ref).String()
+				}
+			}
+		}
+		if value != "" {
+			values = append(values, value)
+			if !field.Multiple {
+				break
+			}
+		}
+	}
+	return values, nil
+}
+
+// discoverRSSAutomationHTMLSelectors 为首个条目内的元素生成相对选择器，重复的同名元素用 :nth-child 区分
+func discoverRSSAutomationHTMLSelectors(item *html.Node) []string {
+	selectors := make([]string, 0, 16)
+	for _, attribute := range item.Attr {
+		if attribute.Key != "class" && attribute.Key != "style" {
+			selectors = append(selectors, "@"+attribute.Key)
+		}
+	}
+	var walk func(*html.Node, string)
+	walk = func(node *html.Node, prefix string) {
+		for child := node.FirstChild; child != nil; child = child.NextSibling {
+			if len(selectors) >= maxRSSAutomationHTMLSelectors {
+				return
+			}
+			if child.Type != html.ElementNode || child.Data == "script" || child.Data == "style" {
+				continue
+			}
+			compound, class := child.Data, rssAutomationHTMLFirstClass(child)
+			if class != "" {
+				compound += "." + class
+			}
+			if rssAutomationHTMLSimilarSiblings(child, class) > 1 {
+				position, _ := rssAutomationHTMLElementPosition(child)
+				compound += fmt.Sprintf(":nth-child(%d)", position)
+			}
+			path := compound
+			if prefix != "" {
+				path = prefix + " > " + compound
+			}
+			if rssAutomationHTMLOwnText(child) != "" {
+				selectors = append(selectors, path)
+			}
+			for _, attribute := range child.Attr {
+				if attribute.Key != "class" && attribute.Key != "style" && attribute.Namespace == "" {
+					selectors = append(selectors, path+"@"+attribute.Key)
+				}
+			}
+			walk(child, path)
+		}
+	}
+	walk(item, "")
+	if len(selectors) > maxRSSAutomationHTMLSelectors {
+		selectors = selectors[:maxRSSAutomationHTMLSelectors]
+	}
+	return selectors
+}
+
+// rssAutomationHTMLSimilarSiblings 统计与 node 标签相同(且带有同一 class)的同级元素数量
+func rssAutomationHTMLSimilarSiblings(node *html.Node, class string) int {
+	if node.Parent == nil {
+		return 1
+	}
+	count := 0
+	for sibling := node.Parent.FirstChild; sibling != nil; sibling = sibling.NextSibling {
+		if sibling.Type != html.ElementNode || sibling.Data != node.Data {
+			continue
+		}
+		if class == "" || rssAutomationContainsWord(rssAutomationHTMLAttribute(sibling, "class"), class) {
+			count++
+		}
+	}
+	return count
+}
+
+// rssAutomationHTMLFirstClass 第一个可直接写进选择器的 class
+func rssAutomationHTMLFirstClass(node *html.Node) string {
+	classes := strings.Fields(rssAutomationHTMLAttribute(node, "class"))
+	if len(classes) > 0 && rssAutomationCSSIdentPattern.FindString(classes[0]) == classes[0] {
+		return classes[0]
+	}
+	return ""
+}
+
+func rssAutomationHTMLOwnText(node *html.Node) string {
+	var builder strings.Builder
+	for child := node.FirstChild; child != nil; child = child.NextSibling {
+		if child.Type == html.TextNode {
+			builder.WriteString(child.Data)
+		}
+	}
+	return strings.TrimSpace(builder.String())
+}
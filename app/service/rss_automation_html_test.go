@@ -0,0 +1,125 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+const rssAutomationHTMLListing = `<!doctype html>
+<html><head><title> 种子列表 </title></head>
+<body>
+<table class="torrents">
+  <tr class="header"><th>名称</th><th>大小</th><th>时间</th></tr>
+  <tr class="row sticky" data-id="501">
+    <td class="name"><a class="title" href="details.php?id=501">示例电影 2026 <b>2160p</b></a>
+      <a class="dl" href="/download.php?id=501&amp;passkey=x" title="下载">下载</a></td>
+    <td>12345</td>
+    <td><span title="2026-08-11 10:00:00">1 小时前</span></td>
+  </tr>
+  <tr class="row" data-id="502">
+    <td class="name"><a class="title" href="https://cdn.example.net/details/502">示例剧集 S01</a></td>
+    <td>678</td>
+    <td><span title="2026-08-11 11:00:00">刚刚</span></td>
+  </tr>
+</table>
+<div class="row">不是条目</div>
+</body></html>`
+
+func TestParseRSSAutomationHTMLFeedMapsFieldsWithCSSSelectors(t *testing.T) {
+	mapping := RSSAutomationMapping{
+		ItemSelector: "table.torrents tr.row",
+		Fields: []RSSAutomationFieldMapping{
+			{Name: "guid", Selector: "@data-id"},
+			{Name: "title", Selector: "td.name > a.title", Required: true},
+			{Name: "detail_url", Selector: "a.title@href"},
+			{Name: "download_url", Selector: "a[href*='download.php']@href"},
+			{Name: "size_bytes", Selector: "td:nth-child(2)", Type: "integer"},
+			{Name: "published_at", Selector: "td:last-child span@title", Type: "datetime"},
+			{Name: "category", Selector: "a", Multiple: true, MatchAttribute: "class", MatchPattern: "^(title|dl)$"},
+		},
+	}
+	feed, err := ParseRSSAutomationSourceFeed(strings.NewReader(rssAutomationHTMLListing), "html", "https://pt.example.com/torrents.php?page=1", mapping, 0)
+	if err != nil {
+		t.Fatalf("ParseRSSAutomationSourceFeed() error = %v", err)
+	}
+	if feed.Title != "种子列表" || len(feed.Items) != 2 {
+		t.Fatalf("unexpected feed: %#v", feed)
+	}
+	first := feed.Items[0].Fields
+	if first["guid"] != "501" || first["title"] != "示例电影 2026 2160p" {
+		t.Fatalf("unexpected first item: %#v", first)
+	}
+	if first["detail_url"] != "https://pt.example.com/details.php?id=501" {
+		t.Fatalf("relative detail_url not resolved: %#v", first["detail_url"])
+	}
+	if first["download_url"] != "https://pt.example.com/download.php?id=501&passkey=x" {
+		t.Fatalf("download_url = %#v", first["download_url"])
+	}
+	if got, ok := first["size_bytes"].(int64); !ok || got != 12345 {
+		t.Fatalf("size_bytes = %#v", first["size_bytes"])
+	}
+	if first["published_at"] != "2026-08-11T10:00:00Z" || first["category"] != "示例电影 2026 2160p, 下载" {
+		t.Fatalf("unexpected fields: %#v", first)
+	}
+	second := feed.Items[1]
+	if second.Fields["detail_url"] != "https://cdn.example.net/details/502" || len(second.Errors) != 0 {
+		t.Fatalf("unexpected second item: %#v", second)
+	}
+	if _, ok := second.Fields["download_url"]; ok {
+		t.Fatalf("missing optional field should be omitted: %#v", second.Fields)
+	}
+	for _, want := range []string{"@data-id", "td.name > a.title@href", "td:nth-child(2)"} {
+		found := false
+		for _, selector := range feed.Selectors {
+			found = found || selector == want
+		}
+		if !found {
+			t.Fatalf("selectors missing %q: %#v", want, feed.Selectors)
+		}
+	}
+}
+
+func TestRSSAutomationCSSSelectorMatching(t *testing.T) {
+	cases := map[string]int{
+		"tr.row":             2,
+		"table > tr":         0, // 解析器会补上 tbody
+		"table tbody > tr":   3,
+		"tr:first-child":     1,
+		"tr:nth-child(odd)":  2,
+		"tr:nth-child(2n+2)": 1,
+		"tr.header ~ tr":     2,
+		"tr.header + tr":     1,
+		"tr[data-id^='50']":  2,
+		"tr[data-id$=2]":     1,
+		"tr[class~=sticky]":  1,
+		"div.row, tr.header": 2,
+		"*[data-id]":         2,
+		"td.name a.dl":       1,
+	}
+	for selector, want := range cases {
+		compiled, err := compileRSSAutomationCSS(selector)
+		if err != nil {
+			t.Fatalf("%s: %v", selector, err)
+		}
+		mapping := RSSAutomationMapping{ItemSelector: selector, Fields: []RSSAutomationFieldMapping{{Name: "title", Selector: "@class"}}}
+		feed, err := ParseRSSAutomationSourceFeed(strings.NewReader(rssAutomationHTMLListing), "html", "", mapping, 0)
+		if want == 0 {
+			if err == nil {
+				t.Fatalf("%s: expected no items, got %d", selector, len(feed.Items))
+			}
+			continue
+		}
+		if err != nil || len(feed.Items) != want {
+			t.Fatalf("%s (%#v): got %d items (%v), want %d", selector, compiled, len(feed.Items), err, want)
+		}
+	}
+}
+
+func TestValidateRSSAutomationSourceMappingRejectsBadCSS(t *testing.T) {
+	for _, selector := range []string{"tr[", "tr >", "> tr", "tr:hover", "tr:nth-child(x)", "a, ", "a@"} {
+		mapping := RSSAutomationMapping{ItemSelector: "tr", Fields: []RSSAutomationFieldMapping{{Name: "title", Selector: selector}}}
+		if err := ValidateRSSAutomationSourceMapping("html", mapping); err == nil {
+			t.Fatalf("selector %q unexpectedly accepted", selector)
+		}
+	}
+}
@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// JSON 源使用 JSONPath 风格的选择器：
+//   - 条目选择器从文档根开始，如 $.data.items 或 $.data.items[*]，指向数组时自动展开为条目
+//   - 字段选择器相对于条目，如 title、$.torrent.size、files[0].name、tags[*]、links[*].href
+//   - 支持 .key、['key']、[n](负数从末尾计)、[*] / .*、..key(递归查找)，$ 与 @ 都表示当前起点
+const maxRSSAutomationJSONSelectors = 64
+
+type rssAutomationJSONStepKind int
+
+const (
+	rssAutomationJSONKey rssAutomationJSONStepKind = iota
+	rssAutomationJSONIndex
+	rssAutomationJSONWildcard
+	rssAutomationJSONRecursive
+)
+
+type rssAutomationJSONStep struct {
+	kind  rssAutomationJSONStepKind
+	key   string // rssAutomationJSONRecursive 时为 "*" 表示所有后代
+	index int
+}
+
+// rssAutomationJSONMatch 选中的值及其所在对象，match_attribute 在所在对象上取同级键
+type rssAutomationJSONMatch struct {
+	value  any
+	parent map[string]any
+}
+
+var rssAutomationJSONNamePattern = regexp.MustCompile(`^[^.\[\]'"\s]+`)
+
+func compileRSSAutomationJSONPath(selector string) ([]rssAutomationJSONStep, error) {
+	path := strings.TrimSpace(selector)
+	if path == "" {
+		return nil, errors.New("选择器不能为空")
+	}
+	if path[0] == '$' || path[0] == '@' {
+		path = path[1:]
+	} else if path[0] != '.' && path[0] != '[' {
+		path = "." + path
+	}
+	steps := make([]rssAutomationJSONStep, 0, 4)
+	for path != "" {
+		switch {
+		case strings.HasPrefix(path, ".."):
+			path = path[2:]
+			if strings.HasPrefix(path, "*") {
+				steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONRecursive, key: "*"})
+				path = path[1:]
+				continue
+			}
+			name := rssAutomationJSONNamePattern.FindString(path)
+			if name == "" {
+				return nil, fmt.Errorf("%q 中 .. 之后缺少键名", selector)
+			}
+			steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONRecursive, key: name})
+			path = path[len(name):]
+		case strings.HasPrefix(path, "."):
+			path = path[1:]
+			if strings.HasPrefix(path, "*") {
+				steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONWildcard})
+				path = path[1:]
+				continue
+			}
+			name := rssAutomationJSONNamePattern.FindString(path)
+			if name == "" {
+				return nil, fmt.Errorf("%q 中 . 之后缺少键名", selector)
+			}
+			steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONKey, key: name})
+			path = path[len(name):]
+		case strings.HasPrefix(path, "["):
+			end := strings.Index(path, "]")
+			if end < 0 {
+				return nil, fmt.Errorf("%q 缺少 ]", selector)
+			}
+			inner := strings.TrimSpace(path[1:end])
+			path = path[end+1:]
+			switch {
+			case inner == "*":
+				steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONWildcard})
+			case len(inner) >= 2 && (inner[0] == '\'' || inner[0] == '"') && inner[len(inner)-1] == inner[0]:
+				steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONKey, key: inner[1 : len(inner)-1]})
+			default:
+				index, err := strconv.Atoi(inner)
+				if err != nil {
+					return nil, fmt.Errorf("%q 中的下标 %q 无效", selector, inner)
+				}
+				steps = append(steps, rssAutomationJSONStep{kind: rssAutomationJSONIndex, index: index})
+			}
+		default:
+			return nil, fmt.Errorf("%q 在 %q 附近无法解析", selector, path)
+		}
+	}
+	return steps, nil
+}
+
+func evalRSSAutomationJSONPath(root any, steps []rssAutomationJSONStep) []rssAutomationJSONMatch {
+	current := []rssAutomationJSONMatch{{value: root}}
+	for _, step := range steps {
+		next := make([]rssAutomationJSONMatch, 0, len(current))
+		for _, match := range current {
+			next = appendRSSAutomationJSONStep(next, match.value, step)
+		}
+		current = next
+		if len(current) == 0 {
+			break
+		}
+	}
+	return current
+}
+
+func appendRSSAutomationJSONStep(out []rssAutomationJSONMatch, value any, step rssAutomationJSONStep) []rssAutomationJSONMatch {
+	switch step.kind {
+	case rssAutomationJSONKey:
+		if object, ok := value.(map[string]any); ok {
+			if child, exists := object[step.key]; exists {
+				out = append(out, rssAutomationJSONMatch{value: child, parent: object})
+			}
+		}
+	case rssAutomationJSONIndex:
+		if array, ok := value.([]any); ok {
+			index := step.index
+			if index < 0 {
+				index += len(array)
+			}
+			if index >= 0 && index < len(array) {
+				out = append(out, rssAutomationJSONMatch{value: array[index]})
+			}
+		}
+	case rssAutomationJSONWildcard:
+		out = appendRSSAutomationJSONChildren(out, value)
+	case rssAutomationJSONRecursive:
+		var walk func(any)
+		walk = func(node any) {
+			if step.key == "*" {
+				out = appendRSSAutomationJSONChildren(out, node)
+			} else if object, ok := node.(map[string]any); ok {
+				if child, exists := object[step.key]; exists {
+					out = append(out, rssAutomationJSONMatch{value: child, parent: object})
+				}
+			}
+			switch typed := node.(type) {
+			case map[string]any:
+				for _, key := range sortedRSSAutomationJSONKeys(typed) {
+					walk(typed[key])
+				}
+			case []any:
+				for _, child := range typed {
+					walk(child)
+				}
+			}
+		}
+		walk(value)
+	}
+	return out
+}
+
+func appendRSSAutomationJSONChildren(out []rssAutomationJSONMatch, value any) []rssAutomationJSONMatch {
+	switch typed := value.(type) {
+	case map[string]any:
+		for _, key := range sortedRSSAutomationJSONKeys(typed) {
+			out = append(out, rssAutomationJSONMatch{value: typed[key], parent: typed})
+		}
+	case []any:
+		for _, child := range typed {
+			out = append(out, rssAutomationJSONMatch{value: child})
+		}
+	}
+	return out
+}
+
+func sortedRSSAutomationJSONKeys(object map[string]any) []string {
+	keys := make([]string, 0, len(object))
+	for key := range object {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func parseRSSAutomationJSONFeed(body []byte, mapping RSSAutomationMapping, limit int) (RSSAutomationParsedFeed, error) {
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	var root any
+	if err := decoder.Decode(&root); err != nil {
+		return RSSAutomationParsedFeed{}, fmt.Errorf("解析 JSON 失败: %w", err)
+	}
+	itemSteps, err := compileRSSAutomationJSONPath(mapping.ItemSelector)
+	if err != nil {
+		return RSSAutomationParsedFeed{}, err
+	}
+	matches := evalRSSAutomationJSONPath(root, itemSteps)
+	items := make([]any, 0, len(matches))
+	if len(matches) == 1 {
+		if array, ok := matches[0].value.([]any); ok {
+			items = append(items, array...)
+		}
+	}
+	if len(items) == 0 {
+		for _, match := range matches {
+			if match.value != nil {
+				items = append(items, match.value)
+			}
+		}
+	}
+	if len(items) == 0 {
+		return RSSAutomationParsedFeed{}, fmt.Errorf("没有找到条目 %q", mapping.ItemSelector)
+	}
+	if limit > 0 && len(items) > limit {
+		items = items[:limit]
+	}
+	parsed := RSSAutomationParsedFeed{Items: make([]RSSAutomationParsedItem, 0, len(items))}
+	if object, ok := root.(map[string]any); ok {
+		if title, ok := object["title"].(string); ok {
+			parsed.Title = strings.TrimSpace(title)
+		}
+	}
+	parsed.Selectors = discoverRSSAutomationJSONSelectors(items[0])
+	fieldSteps := make(map[string][]rssAutomationJSONStep, len(mapping.Fields))
+	for _, field := range mapping.Fields {
+		steps, err := compileRSSAutomationJSONPath(field.Selector)
+		if err != nil {
+			return RSSAutomationParsedFeed{}, fmt.Errorf("字段 %s: %w", field.Name, err)
+		}
+		fieldSteps[field.Name] = steps
+	}
+	for _, item := range items {
+		parsed.Items = append(parsed.Items, buildRSSAutomationItem(mapping.Fields, func(field RSSAutomationFieldMapping) ([]string, error) {
+			return extractRSSAutomationJSONField(item, fieldSteps[field.Name], field)
+		}))
+	}
+	return parsed, nil
+}
+
+func extractRSSAutomationJSONField(item any, steps []rssAutomationJSONStep, field RSSAutomationFieldMapping) ([]string, error) {
+	var matchPattern *regexp.Regexp
+	if strings.TrimSpace(field.MatchPattern) != "" {
+		compiled, err := regexp.Compile(field.MatchPattern)
+		if err != nil {
+			return nil, err
+		}
+		matchPattern = compiled
+	}
+	values := make([]string, 0, 1)
+	for _, match := range evalRSSAutomationJSONPath(item, steps) {
+		if field.MatchAttribute != "" {
+			candidate := ""
+			if match.parent != nil {
+				candidate = rssAutomationJSONString(match.parent[field.MatchAttribute])
+			}
+			if matchPattern != nil && !matchPattern.MatchString(candidate) {
+				continue
+			}
+			if matchPattern == nil && candidate == "" {
+				continue
+			}
+		}
+		// 选中的是标量数组时逐个展开，便于 multiple 字段直接写 tags
+		candidates := []any{match.value}
+		if array, ok := match.value.([]any); ok && rssAutomationJSONScalarArray(array) {
+			candidates = array
+		}
+		for _, candidate := range candidates {
+			value := strings.TrimSpace(rssAutomationJSONString(candidate))
+			if value == "" {
+				continue
+			}
+			values = append(values, value)
+			if !field.Multiple {
+				return values, nil
+			}
+		}
+	}
+	return values, nil
+}
+
+func rssAutomationJSONScalarArray(array []any) bool {
+	for _, element := range array {
+		switch element.(type) {
+		case map[string]any, []any:
+			return false
+		}
+	}
+	return true
+}
+
+func rssAutomationJSONString(value any) string {
+	switch typed := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return typed
+	case json.Number:
+		return typed.String()
+	case bool:
+		return strconv.FormatBool(typed)
+	default:
+		encoded, err := json.Marshal(typed)
+		if err != nil {
+			return ""
+		}
+		return string(encoded)
+	}
+}
+
+// discoverRSSAutomationJSONSelectors 列出首个条目中可用的字段选择器，供界面选择
+func discoverRSSAutomationJSONSelectors(item any) []string {
+	selectors := make([]string, 0, 16)
+	var walk func(any, string)
+	walk = func(node any, path string) {
+		if len(selectors) >= maxRSSAutomationJSONSelectors {
+			return
+		}
+		switch typed := node.(type) {
+		case map[string]any:
+			for _, key := range sortedRSSAutomationJSONKeys(typed) {
+				child := key
+				if !rssAutomationJSONNamePattern.MatchString(key) || len(rssAutomationJSONNamePattern.FindString(key)) != len(key) {
+					child = "['" + key + "']"
+				}
+				if path != "" && !strings.HasPrefix(child, "[") {
+					child = "." + child
+				}
+				walk(typed[key], path+child)
+			}
+		case []any:
+			if len(typed) == 0 {
+				return
+			}
+			if rssAutomationJSONScalarArray(typed) {
+				selectors = append(selectors, path+"[*]")
+				return
+			}
+			walk(typed[0], path+"[*]")
+		default:
+			if path != "" {
+				selectors = append(selectors, path)
+			}
+		}
+	}
+	walk(item, "")
+	return selectors
+}
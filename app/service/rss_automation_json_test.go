@@ -0,0 +1,110 @@
+package service
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseRSSAutomationJSONFeedMapsFieldsWithJSONPath(t *testing.T) {
+	body := `{
+  "title": "站点最新",
+  "data": {"torrents": [
+    {"id": 1001, "name": "示例剧 S01E01 1080p", "size": 1234567890, "free": true,
+     "created_at": 1786413600, "tags": ["中字", "HDR"],
+     "links": [{"rel": "detail", "href": "https://example.com/t/1001"}, {"rel": "download", "href": "https://example.com/dl/1001"}]},
+    {"id": 1002, "name": "示例剧 S01E02 1080p", "size": 2345678901, "free": false,
+     "created_at": "2026-08-12 10:00:00", "tags": [],
+     "links": [{"rel": "download", "href": "https://example.com/dl/1002"}]}
+  ]}
+}`
+	mapping := RSSAutomationMapping{
+		ItemSelector: "$.data.torrents",
+		Fields: []RSSAutomationFieldMapping{
+			{Name: "guid", Selector: "id"},
+			{Name: "title", Selector: "$.name", Required: true},
+			{Name: "size_bytes", Selector: "size", Type: "integer"},
+			{Name: "free", Selector: "['free']", Type: "boolean"},
+			{Name: "published_at", Selector: "created_at", Type: "datetime"},
+			{Name: "category", Selector: "tags[*]", Multiple: true, JoinWith: "/"},
+			{Name: "download_url", Selector: "links[*].href", MatchAttribute: "rel", MatchPattern: "^download$"},
+		},
+	}
+	feed, err := ParseRSSAutomationSourceFeed(strings.NewReader(body), "json", "", mapping, 0)
+	if err != nil {
+		t.Fatalf("ParseRSSAutomationSourceFeed() error = %v", err)
+	}
+	if feed.Title != "站点最新" || len(feed.Items) != 2 {
+		t.Fatalf("unexpected feed: %#v", feed)
+	}
+	first := feed.Items[0].Fields
+	if first["guid"] != "1001" || first["title"] != "示例剧 S01E01 1080p" {
+		t.Fatalf("unexpected first item: %#v", first)
+	}
+	if got, ok := first["size_bytes"].(int64); !ok || got != 1234567890 {
+		t.Fatalf("size_bytes = %#v (%T)", first["size_bytes"], first["size_bytes"])
+	}
+	if first["free"] != true || first["category"] != "中字/HDR" {
+		t.Fatalf("unexpected typed fields: %#v", first)
+	}
+	if first["published_at"] != "2026-08-11T02:00:00Z" {
+		t.Fatalf("unix published_at = %#v", first["published_at"])
+	}
+	if first["download_url"] != "https://example.com/dl/1001" {
+		t.Fatalf("download_url = %#v", first["download_url"])
+	}
+	second := feed.Items[1]
+	if len(second.Errors) != 0 || second.Fields["published_at"] != "2026-08-12T10:00:00Z" {
+		t.Fatalf("unexpected second item: %#v", second)
+	}
+	if _, ok := second.Fields["category"]; ok {
+		t.Fatalf("empty tags should not produce a value: %#v", second.Fields)
+	}
+	for _, want := range []string{"id", "name", "tags[*]", "links[*].href"} {
+		found := false
+		for _, selector := range feed.Selectors {
+			found = found || selector == want
+		}
+		if !found {
+			t.Fatalf("selectors missing %q: %#v", want, feed.Selectors)
+		}
+	}
+}
+
+func TestRSSAutomationJSONPathSelectors(t *testing.T) {
+	body := `{"result": {"list": [{"meta": {"title": "A"}}, {"meta": {"title": "B"}}, {"meta": {"title": "C"}}]}}`
+	cases := map[string]int{
+		"$.result.list[*]":  3,
+		"result.list":       3,
+		"$..meta":           3,
+		"$.result.list[0]":  1,
+		"$.result.list[-1]": 1,
+	}
+	for selector, want := range cases {
+		mapping := RSSAutomationMapping{ItemSelector: selector, Fields: []RSSAutomationFieldMapping{{Name: "title", Selector: "..title"}}}
+		feed, err := ParseRSSAutomationSourceFeed(strings.NewReader(body), "json", "", mapping, 0)
+		if err != nil {
+			t.Fatalf("%s: %v", selector, err)
+		}
+		if len(feed.Items) != want {
+			t.Fatalf("%s: got %d items, want %d", selector, len(feed.Items), want)
+		}
+	}
+	mapping := RSSAutomationMapping{ItemSelector: "$.result.list[-1]", Fields: []RSSAutomationFieldMapping{{Name: "title", Selector: "meta.title"}}}
+	feed, err := ParseRSSAutomationSourceFeed(strings.NewReader(body), "json", "", mapping, 0)
+	if err != nil || feed.Items[0].Fields["title"] != "C" {
+		t.Fatalf("negative index item = %#v, %v", feed.Items, err)
+	}
+}
+
+func TestValidateRSSAutomationSourceMappingRejectsBadJSONPath(t *testing.T) {
+	for _, selector := range []string{"$.items[", "$.items[x]", "$.", "$..", "items..[0]"} {
+		mapping := RSSAutomationMapping{ItemSelector: selector, Fields: []RSSAutomationFieldMapping{{Name: "title", Selector: "title"}}}
+		if err := ValidateRSSAutomationSourceMapping("json", mapping); err == nil {
+			t.Fatalf("selector %q unexpectedly accepted", selector)
+		}
+	}
+	mapping := RSSAutomationMapping{ItemSelector: "$.items", Fields: []RSSAutomationFieldMapping{{Name: "title", Selector: "title"}}}
+	if err := ValidateRSSAutomationSourceMapping("yaml", mapping); err == nil {
+		t.Fatal("unknown source type unexpectedly accepted")
+	}
+}
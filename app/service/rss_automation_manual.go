@@ -1,6 +1,7 @@
 package service
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -74,7 +75,7 @@ func (s *RSSAutomationService) ListManualCandidates(workflowID uint, limit int)
 	}
 
 	var entries []model.RSSAutomationEntry
-	err = s.db.Where("source_id = ?", workflow.SourceID).
+	err = s.db.Where("source_id = ? AND trigger_type = ?", workflow.SourceID, "").
 		Where(`NOT EXISTS (
 			SELECT 1
 			FROM rss_automation_runs
@@ -143,7 +144,7 @@ func (s *RSSAutomationService) CreateManualRuns(workflowID uint, input RSSAutoma
 		return result, err
 	}
 	var entries []model.RSSAutomationEntry
-	if err := s.db.Where("id IN ? AND source_id = ?", entryIDs, workflow.SourceID).Find(&entries).Error; err != nil {
+	if err := s.db.Where("id IN ? AND source_id = ? AND trigger_type = ?", entryIDs, workflow.SourceID, "").Find(&entries).Error; err != nil {
 		return result, err
 	}
 	entryByID := make(map[uint]model.RSSAutomationEntry, len(entries))
@@ -312,6 +313,8 @@ func executeRSSAutomationPreviewNode(node RSSAutomationNode, runContext map[stri
 		return executeRSSAutomationKeywordNode(node, runContext)
 	case RSSAutomationNodeConvert:
 		return executeRSSAutomationConvertNode(node, runContext)
+	case RSSAutomationNodeScript:
+		return executeRSSAutomationScriptNode(context.Background(), node, runContext)
 	case RSSAutomationNodeIf:
 		matched, err := evaluateRSSAutomationCondition(node.Config["condition"], runContext)
 		if err != nil {
@@ -439,6 +442,11 @@ func previewRSSAutomationActionNode(node RSSAutomationNode, runContext map[strin
 			return map[string]any{"selected_port": "failure"}, errors.New("通知内容不能为空")
 		}
 		return map[string]any{"selected_port": "success", "preview": true}, nil
+	case RSSAutomationNodeCallWorkflow:
+		return map[string]any{
+			"selected_port": "success", "preview": true,
+			"sub_workflow_id": rssAutomationConfigUint(node.Config, "sub_workflow_id"), "outputs": map[string]any{},
+		}, nil
 	default:
 		return nil, fmt.Errorf("不支持预演动作节点 %q", node.Type)
 	}
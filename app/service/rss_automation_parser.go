@@ -13,6 +13,8 @@ import (
 	"strconv"
 	"strings"
 	"time"
+
+	"film-fusion/app/model"
 )
 
 const maxRSSAutomationBodyBytes = 8 << 20
@@ -120,17 +122,88 @@ func ValidateRSSAutomationMapping(mapping RSSAutomationMapping) error {
 	return nil
 }
 
+// NormalizeRSSAutomationSourceType 统一源类型写法，空值视为 rss
+func NormalizeRSSAutomationSourceType(sourceType string) string {
+	sourceType = strings.ToLower(strings.TrimSpace(sourceType))
+	if sourceType == "" {
+		return model.RSSAutomationSourceRSS
+	}
+	return sourceType
+}
+
+// ValidateRSSAutomationSourceMapping 在通用校验之外按源类型检查选择器语法
+func ValidateRSSAutomationSourceMapping(sourceType string, mapping RSSAutomationMapping) error {
+	if err := ValidateRSSAutomationMapping(mapping); err != nil {
+		return err
+	}
+	switch NormalizeRSSAutomationSourceType(sourceType) {
+	case model.RSSAutomationSourceRSS:
+		return nil
+	case model.RSSAutomationSourceJSON:
+		if _, err := compileRSSAutomationJSONPath(mapping.ItemSelector); err != nil {
+			return fmt.Errorf("条目选择器无效: %w", err)
+		}
+		for _, field := range mapping.Fields {
+			if _, err := compileRSSAutomationJSONPath(field.Selector); err != nil {
+				return fmt.Errorf("字段 %s 的选择器无效: %w", field.Name, err)
+			}
+		}
+		return nil
+	case model.RSSAutomationSourceHTML:
+		if _, err := compileRSSAutomationCSS(mapping.ItemSelector); err != nil {
+			return fmt.Errorf("条目选择器无效: %w", err)
+		}
+		for _, field := range mapping.Fields {
+			if _, _, err := compileRSSAutomationHTMLFieldSelector(field.Selector); err != nil {
+				return fmt.Errorf("字段 %s 的选择器无效: %w", field.Name, err)
+			}
+		}
+		return nil
+	}
+	return fmt.Errorf("不支持的源类型 %q", sourceType)
+}
+
+// ParseRSSAutomationSourceFeed 按源类型解析抓取到的内容。feedURL 用于把 HTML 中的相对链接补全为绝对地址。
+func ParseRSSAutomationSourceFeed(reader io.Reader, sourceType, feedURL string, mapping RSSAutomationMapping, limit int) (RSSAutomationParsedFeed, error) {
+	if err := ValidateRSSAutomationSourceMapping(sourceType, mapping); err != nil {
+		return RSSAutomationParsedFeed{}, err
+	}
+	body, err := readRSSAutomationBody(reader)
+	if err != nil {
+		return RSSAutomationParsedFeed{}, err
+	}
+	switch NormalizeRSSAutomationSourceType(sourceType) {
+	case model.RSSAutomationSourceJSON:
+		return parseRSSAutomationJSONFeed(body, mapping, limit)
+	case model.RSSAutomationSourceHTML:
+		return parseRSSAutomationHTMLFeed(body, feedURL, mapping, limit)
+	}
+	return parseRSSAutomationXMLFeed(body, mapping, limit)
+}
+
 func ParseRSSAutomationFeed(reader io.Reader, mapping RSSAutomationMapping, limit int) (RSSAutomationParsedFeed, error) {
 	if err := ValidateRSSAutomationMapping(mapping); err != nil {
 		return RSSAutomationParsedFeed{}, err
 	}
+	body, err := readRSSAutomationBody(reader)
+	if err != nil {
+		return RSSAutomationParsedFeed{}, err
+	}
+	return parseRSSAutomationXMLFeed(body, mapping, limit)
+}
+
+func readRSSAutomationBody(reader io.Reader) ([]byte, error) {
 	body, err := io.ReadAll(io.LimitReader(reader, maxRSSAutomationBodyBytes+1))
 	if err != nil {
-		return RSSAutomationParsedFeed{}, fmt.Errorf("读取 RSS 内容失败: %w", err)
+		return nil, fmt.Errorf("读取 RSS 内容失败: %w", err)
 	}
 	if len(body) > maxRSSAutomationBodyBytes {
-		return RSSAutomationParsedFeed{}, errors.New("RSS 内容超过 8 MiB 限制")
+		return nil, errors.New("RSS 内容超过 8 MiB 限制")
 	}
+	return body, nil
+}
+
+func parseRSSAutomationXMLFeed(body []byte, mapping RSSAutomationMapping, limit int) (RSSAutomationParsedFeed, error) {
 	root, err := parseRSSAutomationXML(body)
 	if err != nil {
 		return RSSAutomationParsedFeed{}, err
@@ -150,37 +223,44 @@ func ParseRSSAutomationFeed(reader io.Reader, mapping RSSAutomationMapping, limi
 		parsed.Selectors = discoverRSSAutomationSelectors(itemNodes[0])
 	}
 	for _, itemNode := range itemNodes {
-		item := RSSAutomationParsedItem{Fields: make(map[string]any, len(mapping.Fields)), Errors: []string{}}
-		for _, field := range mapping.Fields {
-			values, extractErr := extractRSSAutomationField(itemNode, field)
-			if extractErr != nil {
-				item.Errors = append(item.Errors, extractErr.Error())
-				continue
-			}
-			if len(values) == 0 {
-				if field.Required {
-					item.Errors = append(item.Errors, fmt.Sprintf("必填字段 %s 没有匹配到值", field.Name))
-				}
-				continue
-			}
-			if field.Multiple {
-				joinWith := field.JoinWith
-				if joinWith == "" {
-					joinWith = ", "
-				}
-				item.Fields[field.Name] = strings.Join(values, joinWith)
-				continue
+		parsed.Items = append(parsed.Items, buildRSSAutomationItem(mapping.Fields, func(field RSSAutomationFieldMapping) ([]string, error) {
+			return extractRSSAutomationField(itemNode, field)
+		}))
+	}
+	return parsed, nil
+}
+
+// buildRSSAutomationItem 按字段映射组装条目，extract 负责从具体格式的条目中取出字段的原始值
+func buildRSSAutomationItem(fields []RSSAutomationFieldMapping, extract func(RSSAutomationFieldMapping) ([]string, error)) RSSAutomationParsedItem {
+	item := RSSAutomationParsedItem{Fields: make(map[string]any, len(fields)), Errors: []string{}}
+	for _, field := range fields {
+		values, extractErr := extract(field)
+		if extractErr != nil {
+			item.Errors = append(item.Errors, extractErr.Error())
+			continue
+		}
+		if len(values) == 0 {
+			if field.Required {
+				item.Errors = append(item.Errors, fmt.Sprintf("必填字段 %s 没有匹配到值", field.Name))
 			}
-			converted, convertErr := convertRSSAutomationScalar(values[0], field.Type)
-			if convertErr != nil {
-				item.Errors = append(item.Errors, fmt.Sprintf("字段 %s: %v", field.Name, convertErr))
-				continue
+			continue
+		}
+		if field.Multiple {
+			joinWith := field.JoinWith
+			if joinWith == "" {
+				joinWith = ", "
 			}
-			item.Fields[field.Name] = converted
+			item.Fields[field.Name] = strings.Join(values, joinWith)
+			continue
 		}
-		parsed.Items = append(parsed.Items, item)
+		converted, convertErr := convertRSSAutomationScalar(values[0], field.Type)
+		if convertErr != nil {
+			item.Errors = append(item.Errors, fmt.Sprintf("字段 %s: %v", field.Name, convertErr))
+			continue
+		}
+		item.Fields[field.Name] = converted
 	}
-	return parsed, nil
+	return item
 }
 
 func parseRSSAutomationXML(body []byte) (*rssAutomationXMLNode, error) {
@@ -321,6 +401,17 @@ func convertRSSAutomationScalar(value, valueType string) (any, error) {
 }
 
 func parseRSSAutomationTime(value string) *time.Time {
+	// JSON 接口常用秒或毫秒级时间戳
+	if unix, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64); err == nil {
+		switch {
+		case unix >= 1_000_000_000 && unix < 100_000_000_000:
+			parsed := time.Unix(unix, 0)
+			return &parsed
+		case unix >= 1_000_000_000_000 && unix < 100_000_000_000_000:
+			parsed := time.UnixMilli(unix)
+			return &parsed
+		}
+	}
 	for _, layout := range []string{
 		time.RFC1123Z, time.RFC1123, time.RFC822Z, time.RFC822,
 		time.RFC3339Nano, time.RFC3339, "2006-01-02 15:04:05", "2006-01-02",
@@ -34,8 +34,13 @@ func rssAutomationTemplateVariable(name, valueType, label, description string, e
 }
 
 var rssAutomationNodeProtocols = []RSSAutomationNodeProtocol{
-	{Type: RSSAutomationNodeTrigger, Label: "RSS 条目进入", Inputs: []RSSAutomationVariableProtocol{}, Outputs: []RSSAutomationVariableProtocol{
-		rssAutomationVariable("selected_port", "string", "流程出口", "固定为 next。RSS 原始字段通过 $item.* 引用。", "next"),
+	{Type: RSSAutomationNodeTrigger, Label: "RSS 条目进入", Inputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("mode", "string", "触发方式", "feed 为源条目触发，cron 为定时触发，manual 为仅 API 触发；后两者不再轮询源。", "feed"),
+		rssAutomationVariable("cron", "string", "cron 表达式", "mode 为 cron 时必填，支持五段式、@daily 与 CRON_TZ= 前缀。", "0 3 * * *"),
+		rssAutomationVariable("context", "object", "默认上下文", "定时或 API 触发时作为 $item 的默认字段，API 传入的同名字段优先。", map[string]any{"title": "心愿单检查"}),
+		rssAutomationVariable("inputs", "array", "子流程参数", "仅子流程使用：声明调用方必须传入的参数名，子流程内通过 $inputs.* 引用。", []string{"title", "save_path"}),
+	}, Outputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("selected_port", "string", "流程出口", "固定为 next。RSS 原始字段通过 $item.* 引用，定时与 API 触发信息通过 $trigger.type、$trigger.fired_at 引用。", "next"),
 	}},
 	{Type: RSSAutomationNodeKeyword, Label: "关键词判断", Inputs: []RSSAutomationVariableProtocol{
 		rssAutomationTemplateVariable("input", "string", "输入字段", "要检查的 RSS 字段或上游变量。", "$item.title", true),
@@ -56,6 +61,16 @@ var rssAutomationNodeProtocols = []RSSAutomationNodeProtocol{
 	}, Outputs: []RSSAutomationVariableProtocol{
 		rssAutomationVariable("variables", "object", "生成变量", "转换后写入 $vars.* 的变量对象。", map[string]any{"episode": 12}),
 	}},
+	{Type: RSSAutomationNodeScript, Label: "脚本计算", Inputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("script", "string", "脚本", "每行一条 name = 表达式 语句(expr 语法)，可读取 item、vars、nodes、trigger 并调用 parse_size、regex_find、filter 等内置函数。", "size = parse_size(item.size)\nsave_path = \"/downloads/\" + lower(item.category)"),
+		rssAutomationVariable("outputs", "array", "输出变量", "声明脚本产出的变量名与类型，执行后按类型校验并写入 $vars.* 与节点输出。", []map[string]any{{"name": "size", "type": "integer"}, {"name": "save_path", "type": "string"}}),
+		rssAutomationVariable("max_duration_ms", "integer", "执行时间上限", "单次执行的最长毫秒数，默认 200，范围 10 到 5000。", 200),
+		rssAutomationVariable("max_memory_kb", "integer", "内存上限", "脚本创建字符串、数组与对象的累计上限，默认 1024 KB。", 1024),
+	}, Outputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("variables", "object", "生成变量", "声明的输出变量，同时写入 $vars.* 并可通过节点输出同名字段引用。", map[string]any{"size": 1610612736, "save_path": "/downloads/anime"}),
+		rssAutomationVariable("result", "any", "最后结果", "最后一条语句的值。", "/downloads/anime"),
+		rssAutomationVariable("reason", "string", "失败原因", "脚本执行失败或输出类型不符时的原因。", "脚本执行超时"),
+	}},
 	{Type: RSSAutomationNodeIf, Label: "IF 判断", Inputs: []RSSAutomationVariableProtocol{
 		rssAutomationTemplateVariable("condition.field", "any", "比较字段", "参与条件判断的 RSS 字段、变量或上游输出。", "$vars.episode", true),
 		rssAutomationTemplateVariable("condition.value", "any", "比较值", "固定值或另一个流程变量。", 10, false),
@@ -70,36 +85,40 @@ var rssAutomationNodeProtocols = []RSSAutomationNodeProtocol{
 		rssAutomationVariable("active_inputs", "integer", "激活输入数", "进入汇合节点的有效分支数量。", 2),
 		rssAutomationVariable("successful_inputs", "integer", "成功输入数", "成功完成的有效分支数量。", 2),
 	}},
-	{Type: RSSAutomationNodeQBittorrent, Label: "qBittorrent 下载", Inputs: []RSSAutomationVariableProtocol{
+	{Type: RSSAutomationNodeQBittorrent, Label: "下载器下载", Inputs: []RSSAutomationVariableProtocol{
 		rssAutomationTemplateVariable("url", "string", "下载地址", "磁力链接或 HTTP/HTTPS 种子地址。", "$item.download_url", true),
-		rssAutomationTemplateVariable("save_path", "string", "保存路径", "qBittorrent 保存路径，支持模板变量。", "/downloads/{{item.category}}", false),
-		rssAutomationTemplateVariable("category", "string", "分类", "qBittorrent 分类，支持模板变量。", "{{item.category}}", false),
-		rssAutomationTemplateVariable("tags", "string", "标签", "逗号分隔的 qBittorrent 标签，支持模板变量。", "rss,{{nodes.mp.output.media_type}}", false),
+		rssAutomationTemplateVariable("save_path", "string", "保存路径", "下载器保存路径，支持模板变量。", "/downloads/{{item.category}}", false),
+		rssAutomationTemplateVariable("category", "string", "分类", "下载器分类，支持模板变量；Transmission 写入标签，Deluge 需启用 Label 插件，Aria2 忽略。", "{{item.category}}", false),
+		rssAutomationTemplateVariable("tags", "string", "标签", "逗号分隔的标签，支持模板变量；仅 qBittorrent 与 Transmission 生效。", "rss,{{nodes.mp.output.media_type}}", false),
 	}, Outputs: []RSSAutomationVariableProtocol{
 		rssAutomationVariable("target_id", "integer", "下载器 ID", "所使用的下载器账号 ID。", 1),
 		rssAutomationVariable("target_name", "string", "下载器名称", "所使用的下载器账号名称。", "家庭 NAS qB"),
+		rssAutomationVariable("target_type", "string", "下载器类型", "qbittorrent、transmission、deluge 或 aria2。", "qbittorrent"),
 		rssAutomationVariable("content_key", "string", "内容键", "下载地址计算出的稳定去重键。", "e3b0c442..."),
 		rssAutomationVariable("torrent_tag", "string", "跟踪标签", "等待节点用于定位任务的内部标签。", "filmfusion-rss-e3b0c442"),
-		rssAutomationVariable("submitted", "boolean", "已提交", "任务是否已提交给 qBittorrent。", true),
+		rssAutomationVariable("task_id", "string", "任务 ID", "下载器返回的任务 ID：Torrent Hash 或 Aria2 GID；qBittorrent 不返回。", "0123456789abcdef"),
+		rssAutomationVariable("submitted", "boolean", "已提交", "任务是否已提交给下载器。", true),
 	}},
-	{Type: RSSAutomationNodeWaitQBittorrent, Label: "等待 qBittorrent 完成", Inputs: []RSSAutomationVariableProtocol{}, Outputs: []RSSAutomationVariableProtocol{
-		rssAutomationVariable("target_id", "integer", "下载器 ID", "任务所在的 qBittorrent 下载器 ID。", 1),
-		rssAutomationVariable("target_name", "string", "下载器名称", "任务所在的 qBittorrent 下载器名称。", "家庭 NAS qB"),
+	{Type: RSSAutomationNodeWaitQBittorrent, Label: "等待下载完成", Inputs: []RSSAutomationVariableProtocol{}, Outputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("target_id", "integer", "下载器 ID", "任务所在的下载器 ID。", 1),
+		rssAutomationVariable("target_name", "string", "下载器名称", "任务所在的下载器名称。", "家庭 NAS qB"),
+		rssAutomationVariable("target_type", "string", "下载器类型", "任务所在的下载器类型。", "qbittorrent"),
 		rssAutomationVariable("torrent_tag", "string", "跟踪标签", "FilmFusion 提交任务时附加的内部跟踪标签。", "filmfusion-rss-e3b0c442"),
-		rssAutomationVariable("completed", "boolean", "是否完成", "qBittorrent 下载是否完成。", true),
+		rssAutomationVariable("completed", "boolean", "是否完成", "下载任务是否完成。", true),
 		rssAutomationVariable("progress", "number", "下载进度", "0 到 100 的下载进度。", 100),
-		rssAutomationVariable("state", "string", "任务状态", "qBittorrent 返回的任务状态。", "uploading"),
-		rssAutomationVariable("hash", "string", "Torrent Hash", "qBittorrent 任务哈希。", "0123456789abcdef"),
-		rssAutomationVariable("name", "string", "任务名称", "qBittorrent 任务名称。", "Example.Movie.2026"),
-		rssAutomationVariable("save_path", "string", "保存目录", "qBittorrent 保存目录。", "/downloads/movies"),
+		rssAutomationVariable("state", "string", "任务状态", "下载器返回的任务状态。", "uploading"),
+		rssAutomationVariable("hash", "string", "Torrent Hash", "任务哈希；Aria2 为任务 GID。", "0123456789abcdef"),
+		rssAutomationVariable("task_id", "string", "任务 ID", "下载器中的任务 ID，与 hash 相同。", "0123456789abcdef"),
+		rssAutomationVariable("name", "string", "任务名称", "下载器中的任务名称。", "Example.Movie.2026"),
+		rssAutomationVariable("save_path", "string", "保存目录", "下载器保存目录。", "/downloads/movies"),
 		rssAutomationVariable("content_path", "string", "完成路径", "下载完成后的文件或文件夹路径。", "/downloads/movies/Example.Movie.2026"),
 		rssAutomationVariable("content_type", "string", "完成路径类型", "下载结果是 file 或 dir。", "dir"),
-		rssAutomationVariable("file_count", "integer", "任务文件数", "Torrent 中包含的文件数量。", 12),
+		rssAutomationVariable("file_count", "integer", "任务文件数", "任务中包含的文件数量。", 12),
 		rssAutomationVariable("size", "integer", "文件大小", "任务总字节数。", 10737418240),
 		rssAutomationVariable("ratio", "number", "分享率", "当前上传分享率。", 1.25),
 	}},
 	{Type: RSSAutomationNodeMoviePilotTransfer, Label: "MP2 整理入库", Inputs: []RSSAutomationVariableProtocol{
-		rssAutomationTemplateVariable("source_path", "string", "MP2 可见源路径", "留空使用上游 qB 完成路径；容器挂载不同可显式改写。", "{{nodes.wait_qb.output.content_path}}", false),
+		rssAutomationTemplateVariable("source_path", "string", "MP2 可见源路径", "留空使用上游下载器完成路径；容器挂载不同可显式改写。", "{{nodes.wait_qb.output.content_path}}", false),
 		rssAutomationTemplateVariable("tmdb_id", "string", "辅助 TMDB ID", "可选；提供后由 MP2 按指定媒体辅助识别整理。", "1396", false),
 	}, Outputs: []RSSAutomationVariableProtocol{
 		rssAutomationVariable("organized", "boolean", "整理成功", "MP2 同步整理调用是否成功完成。", true),
@@ -107,19 +126,19 @@ var rssAutomationNodeProtocols = []RSSAutomationNodeProtocol{
 		rssAutomationVariable("content_type", "string", "源路径类型", "整理源是 file 或 dir。", "dir"),
 		rssAutomationVariable("tmdb_id", "string", "辅助 TMDB ID", "本次整理使用的辅助 TMDB ID。", "1396"),
 		rssAutomationVariable("media_type", "string", "媒体类型", "本次整理指定的 auto/movie/tv。", "movie"),
-		rssAutomationVariable("hash", "string", "Torrent Hash", "整理完成后继续传递的 qBittorrent 任务哈希。", "0123456789abcdef"),
-		rssAutomationVariable("target_id", "integer", "下载器 ID", "整理完成后继续传递的 qBittorrent 下载器 ID。", 1),
-		rssAutomationVariable("target_name", "string", "下载器名称", "整理完成后继续传递的 qBittorrent 下载器名称。", "家庭 NAS qB"),
+		rssAutomationVariable("hash", "string", "Torrent Hash", "整理完成后继续传递的下载任务哈希。", "0123456789abcdef"),
+		rssAutomationVariable("target_id", "integer", "下载器 ID", "整理完成后继续传递的下载器 ID。", 1),
+		rssAutomationVariable("target_name", "string", "下载器名称", "整理完成后继续传递的下载器名称。", "家庭 NAS qB"),
 		rssAutomationVariable("message", "string", "MP2 消息", "MoviePilot 返回的整理结果消息。", "整理完成"),
 	}},
-	{Type: RSSAutomationNodeDeleteQBittorrent, Label: "删除 qB 做种任务", Inputs: []RSSAutomationVariableProtocol{}, Outputs: []RSSAutomationVariableProtocol{
-		rssAutomationVariable("deleted", "boolean", "删除成功", "qBittorrent 做种任务是否已删除。", true),
-		rssAutomationVariable("already_missing", "boolean", "原本已不存在", "执行时任务是否已经不在 qBittorrent 中。", false),
-		rssAutomationVariable("delete_files", "boolean", "同时删除文件", "是否要求 qBittorrent 一并删除下载数据。", false),
-		rssAutomationVariable("hash", "string", "Torrent Hash", "被删除的 qBittorrent 任务哈希。", "0123456789abcdef"),
-		rssAutomationVariable("target_id", "integer", "下载器 ID", "执行删除的 qBittorrent 下载器 ID。", 1),
-		rssAutomationVariable("target_name", "string", "下载器名称", "执行删除的 qBittorrent 下载器名称。", "家庭 NAS qB"),
-		rssAutomationVariable("deleted_at", "datetime", "删除时间", "实际向 qBittorrent 提交删除的时间。", "2026-08-16T12:00:00Z"),
+	{Type: RSSAutomationNodeDeleteQBittorrent, Label: "删除下载器做种任务", Inputs: []RSSAutomationVariableProtocol{}, Outputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("deleted", "boolean", "删除成功", "做种任务是否已删除。", true),
+		rssAutomationVariable("already_missing", "boolean", "原本已不存在", "执行时任务是否已经不在下载器中。", false),
+		rssAutomationVariable("delete_files", "boolean", "同时删除文件", "是否要求下载器一并删除下载数据；Aria2 不支持。", false),
+		rssAutomationVariable("hash", "string", "Torrent Hash", "被删除的下载任务哈希。", "0123456789abcdef"),
+		rssAutomationVariable("target_id", "integer", "下载器 ID", "执行删除的下载器 ID。", 1),
+		rssAutomationVariable("target_name", "string", "下载器名称", "执行删除的下载器名称。", "家庭 NAS qB"),
+		rssAutomationVariable("deleted_at", "datetime", "删除时间", "实际向下载器提交删除的时间。", "2026-08-16T12:00:00Z"),
 	}},
 	{Type: RSSAutomationNodeOffline115, Label: "115 云下载（Cookie）", Inputs: []RSSAutomationVariableProtocol{
 		rssAutomationTemplateVariable("url", "string", "下载地址", "提交到 115 的下载地址。", "$item.download_url", true),
@@ -251,7 +270,18 @@ var rssAutomationNodeProtocols = []RSSAutomationNodeProtocol{
 		rssAutomationVariable("deliveries", "array", "发送结果", "各通知渠道的发送结果。", []any{}),
 		rssAutomationVariable("partial", "boolean", "部分失败", "是否只有部分通知渠道发送成功。", false),
 	}},
-	{Type: RSSAutomationNodeEnd, Label: "结束", Inputs: []RSSAutomationVariableProtocol{}, Outputs: []RSSAutomationVariableProtocol{
+	{Type: RSSAutomationNodeCallWorkflow, Label: "调用子流程", Inputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("sub_workflow_id", "integer", "子流程", "要调用的子流程 ID；运行创建时按子流程当前版本展开进运行快照。", 1),
+		rssAutomationVariable("inputs", "object", "传入参数", "参数名到变量引用或模板的映射，必须覆盖子流程触发器声明的全部参数。", map[string]any{"title": "$item.title", "save_path": "/downloads/{{item.category}}"}),
+	}, Outputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("outputs", "object", "子流程输出", "到达的结束节点按 outputs 映射得到的值，同时写入 $vars.*。", map[string]any{"tmdb_id": 12345}),
+		rssAutomationVariable("end_node", "string", "结束节点", "子流程中实际到达的结束节点 ID。", "end"),
+		rssAutomationVariable("sub_workflow_version", "integer", "子流程版本", "本次运行展开时使用的子流程版本。", 3),
+		rssAutomationVariable("reason", "string", "失败原因", "子流程没有到达结束节点时的原因与失败节点。", "子流程没有到达结束节点，失败节点: offline"),
+	}},
+	{Type: RSSAutomationNodeEnd, Label: "结束", Inputs: []RSSAutomationVariableProtocol{
+		rssAutomationVariable("outputs", "object", "子流程输出", "仅子流程使用：输出名到子流程内变量引用或模板的映射，返回给调用节点。", map[string]any{"tmdb_id": "$nodes.recognize.output.tmdb_id"}),
+	}, Outputs: []RSSAutomationVariableProtocol{
 		rssAutomationVariable("completed", "boolean", "流程已结束", "结束节点已经执行。", true),
 	}},
 }
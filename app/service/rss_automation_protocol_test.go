@@ -12,6 +12,7 @@ func TestRSSAutomationNodeProtocolsCoverEverySupportedNode(t *testing.T) {
 		RSSAutomationNodeRegex,
 		RSSAutomationNodeKeyword,
 		RSSAutomationNodeConvert,
+		RSSAutomationNodeScript,
 		RSSAutomationNodeIf,
 		RSSAutomationNodeParallel,
 		RSSAutomationNodeJoin,
@@ -34,6 +35,7 @@ func TestRSSAutomationNodeProtocolsCoverEverySupportedNode(t *testing.T) {
 		RSSAutomationNodeEmbyRefreshWait,
 		RSSAutomationNodeHTTPRequest,
 		RSSAutomationNodeNotification,
+		RSSAutomationNodeCallWorkflow,
 		RSSAutomationNodeEnd,
 	}
 	protocols := RSSAutomationNodeProtocols()
@@ -2,32 +2,13 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"io"
-	"net/http"
-	"net/url"
-	"strings"
 	"time"
 
 	"film-fusion/app/model"
 )
 
-type rssAutomationQBTorrent struct {
-	Hash        string  `json:"hash"`
-	Name        string  `json:"name"`
-	Progress    float64 `json:"progress"`
-	State       string  `json:"state"`
-	SavePath    string  `json:"save_path"`
-	ContentPath string  `json:"content_path"`
-	Size        int64   `json:"size"`
-	Downloaded  int64   `json:"downloaded"`
-	AmountLeft  int64   `json:"amount_left"`
-	Ratio       float64 `json:"ratio"`
-	ETA         int64   `json:"eta"`
-}
-
 func (s *RSSAutomationService) executeRSSAutomationWaitQBittorrent(
 	ctx context.Context,
 	nodeRun model.RSSAutomationNodeRun,
@@ -41,20 +22,15 @@ func (s *RSSAutomationService) executeRSSAutomationWaitQBittorrent(
 	}
 	targetID := rssAutomationAnyUint(sourceOutput["target_id"])
 	torrentTag := rssAutomationAnyString(sourceOutput["torrent_tag"])
-	if targetID == 0 || torrentTag == "" {
-		return nil, errors.New("上游 qBittorrent 节点没有返回下载器或任务跟踪标签")
-	}
-	var target model.RSSAutomationTarget
-	if err := s.db.First(&target, targetID).Error; err != nil {
-		return nil, fmt.Errorf("qBittorrent 下载器不存在: %w", err)
+	taskID := rssAutomationAnyString(sourceOutput["task_id"])
+	if targetID == 0 || (torrentTag == "" && taskID == "") {
+		return nil, errors.New("上游下载节点没有返回下载器或任务跟踪信息")
 	}
-	if !target.Enabled {
-		return nil, errors.New("qBittorrent 下载器已停用")
-	}
-	client, err := s.newRSSAutomationQBClient(ctx, target)
+	target, downloader, err := s.loadRSSAutomationDownloader(ctx, targetID)
 	if err != nil {
 		return nil, err
 	}
+	label := rssAutomationTargetLabel(target.Type)
 
 	output := rssAutomationDecodeNodeOutput(nodeRun.OutputJSON)
 	delete(output, "selected_port")
@@ -67,56 +43,41 @@ func (s *RSSAutomationService) executeRSSAutomationWaitQBittorrent(
 	output["waiting_since"] = waitingSince.Format(time.RFC3339)
 	output["target_id"] = target.ID
 	output["target_name"] = target.Name
+	output["target_type"] = target.Type
 	output["torrent_tag"] = torrentTag
 	output["last_checked_at"] = time.Now().UTC().Format(time.RFC3339)
 
-	requestPath := "/api/v2/torrents/info?" + url.Values{"tag": {torrentTag}}.Encode()
-	req, err := client.newRequest(ctx, http.MethodGet, requestPath, nil)
+	task, err := downloader.findTask(ctx, taskID, torrentTag)
 	if err != nil {
 		return output, err
 	}
-	resp, err := client.client.Do(req)
-	if err != nil {
-		return output, fmt.Errorf("查询 qBittorrent 任务失败: %w", err)
-	}
-	defer resp.Body.Close()
-	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
-	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
-		return output, fmt.Errorf("查询 qBittorrent 任务返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(responseBody)))
-	}
-	var torrents []rssAutomationQBTorrent
-	if err := json.Unmarshal(responseBody, &torrents); err != nil {
-		return output, fmt.Errorf("解析 qBittorrent 任务失败: %w", err)
-	}
-
-	if len(torrents) > 0 {
-		torrent := torrents[0]
-		output["hash"] = torrent.Hash
-		output["name"] = torrent.Name
-		output["progress"] = torrent.Progress * 100
-		output["state"] = torrent.State
-		output["save_path"] = torrent.SavePath
-		output["content_path"] = torrent.ContentPath
-		output["size"] = torrent.Size
-		output["downloaded"] = torrent.Downloaded
-		output["amount_left"] = torrent.AmountLeft
-		output["ratio"] = torrent.Ratio
-		output["eta"] = torrent.ETA
-		switch strings.ToLower(strings.TrimSpace(torrent.State)) {
-		case "error", "missingfiles", "unknown":
+	if task != nil {
+		output["task_id"] = task.ID
+		output["hash"] = task.ID
+		output["name"] = task.Name
+		output["progress"] = task.Progress * 100
+		output["state"] = task.State
+		output["save_path"] = task.SavePath
+		output["content_path"] = task.ContentPath
+		output["size"] = task.Size
+		output["downloaded"] = task.Downloaded
+		output["amount_left"] = task.AmountLeft
+		output["ratio"] = task.Ratio
+		output["eta"] = task.ETA
+		if task.Failed {
 			output["waiting"] = false
 			output["completed"] = false
 			output["failed"] = true
 			output["selected_port"] = "failure"
-			output["reason"] = "qBittorrent 任务状态异常: " + torrent.State
+			output["reason"] = label + " 任务状态异常: " + task.State
 			return output, nil
 		}
-		if torrent.Progress >= 0.999999 || (torrent.Size > 0 && torrent.AmountLeft == 0) {
+		if task.Completed {
 			output["waiting"] = false
 			output["completed"] = true
 			output["failed"] = false
 			output["progress"] = 100
-			contentType, fileCount, contentTypeErr := queryRSSAutomationQBContentType(ctx, client, torrent.Hash)
+			contentType, fileCount, contentTypeErr := rssAutomationDownloadContentType(ctx, downloader, task.ID)
 			if contentTypeErr == nil {
 				output["content_type"] = contentType
 				output["file_count"] = fileCount
@@ -137,7 +98,7 @@ func (s *RSSAutomationService) executeRSSAutomationWaitQBittorrent(
 		output["completed"] = false
 		output["timed_out"] = true
 		output["selected_port"] = "failure"
-		output["reason"] = fmt.Sprintf("等待 qBittorrent 下载超过 %d 分钟", maxWaitMinutes)
+		output["reason"] = fmt.Sprintf("等待 %s 下载超过 %d 分钟", label, maxWaitMinutes)
 		return output, nil
 	}
 	pollSeconds := rssAutomationConfigUint(node.Config, "poll_interval_seconds")
@@ -151,6 +112,6 @@ func (s *RSSAutomationService) executeRSSAutomationWaitQBittorrent(
 	progress, _ := rssAutomationNumber(output["progress"])
 	return output, &rssAutomationNodeDeferred{
 		delay:   time.Duration(pollSeconds) * time.Second,
-		message: fmt.Sprintf("qBittorrent 下载中，当前约 %.0f%%", progress),
+		message: fmt.Sprintf("%s 下载中，当前约 %.0f%%", label, progress),
 	}
 }
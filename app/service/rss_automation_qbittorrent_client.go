@@ -0,0 +1,302 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/cookiejar"
+	"net/url"
+	"strings"
+	"time"
+
+	"film-fusion/app/model"
+)
+
+type rssAutomationQBTorrent struct {
+	Hash        string  `json:"hash"`
+	Name        string  `json:"name"`
+	Progress    float64 `json:"progress"`
+	State       string  `json:"state"`
+	SavePath    string  `json:"save_path"`
+	ContentPath string  `json:"content_path"`
+	Size        int64   `json:"size"`
+	Downloaded  int64   `json:"downloaded"`
+	AmountLeft  int64   `json:"amount_left"`
+	Ratio       float64 `json:"ratio"`
+	ETA         int64   `json:"eta"`
+}
+
+type rssAutomationQBTorrentFile struct {
+	Name     string  `json:"name"`
+	Size     int64   `json:"size"`
+	Progress float64 `json:"progress"`
+}
+
+type rssAutomationQBClient struct {
+	baseURL string
+	client  *http.Client
+	apiKey  string
+}
+
+func (client *rssAutomationQBClient) newRequest(ctx context.Context, method, path string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(client.baseURL, "/")+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if client.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+client.apiKey)
+	}
+	return req, nil
+}
+
+func (client *rssAutomationQBClient) testConnection(ctx context.Context) error {
+	req, err := client.newRequest(ctx, http.MethodGet, "/api/v2/app/version", nil)
+	if err != nil {
+		return err
+	}
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("连接 qBittorrent API 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		if client.apiKey != "" {
+			return fmt.Errorf("qBittorrent API Key 验证失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		return fmt.Errorf("qBittorrent API 连接失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	if strings.TrimSpace(string(body)) == "" {
+		return errors.New("qBittorrent API 未返回应用版本")
+	}
+	return nil
+}
+
+func (s *RSSAutomationService) newRSSAutomationQBClient(ctx context.Context, target model.RSSAutomationTarget) (*rssAutomationQBClient, error) {
+	var config RSSAutomationQBittorrentConfig
+	if err := json.Unmarshal([]byte(target.ConfigJSON), &config); err != nil {
+		return nil, errors.New("qBittorrent 目标配置损坏")
+	}
+	jar, _ := cookiejar.New(nil)
+	client := &http.Client{Timeout: 20 * time.Second, Jar: jar}
+	apiKey := strings.TrimSpace(config.APIKey)
+	if apiKey != "" {
+		return &rssAutomationQBClient{baseURL: config.BaseURL, client: client, apiKey: apiKey}, nil
+	}
+	form := url.Values{"username": {config.Username}, "password": {config.Password}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, strings.TrimRight(config.BaseURL, "/")+"/api/v2/auth/login", strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("连接 qBittorrent 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !strings.EqualFold(strings.TrimSpace(string(body)), "Ok.") {
+		return nil, fmt.Errorf("qBittorrent 登录失败: HTTP %d %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return &rssAutomationQBClient{baseURL: config.BaseURL, client: client}, nil
+}
+
+func (client *rssAutomationQBClient) addTask(ctx context.Context, request rssAutomationDownloadRequest) (string, error) {
+	var body bytes.Buffer
+	writer := multipart.NewWriter(&body)
+	tags := append(append([]string{}, request.Tags...), request.TrackingTag)
+	fields := map[string]string{
+		"urls":     request.URL,
+		"savepath": request.SavePath,
+		"category": request.Category,
+		"tags":     strings.Join(tags, ","),
+	}
+	if request.Paused {
+		fields["paused"] = "true"
+	}
+	if request.Sequential {
+		fields["sequentialDownload"] = "true"
+	}
+	for key, value := range fields {
+		if strings.TrimSpace(value) != "" {
+			_ = writer.WriteField(key, value)
+		}
+	}
+	_ = writer.Close()
+	req, err := client.newRequest(ctx, http.MethodPost, "/api/v2/torrents/add", &body)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("提交 qBittorrent 任务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	responseBody, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 || !strings.EqualFold(strings.TrimSpace(string(responseBody)), "Ok.") {
+		return "", fmt.Errorf("qBittorrent 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(responseBody)))
+	}
+	// qBittorrent 提交接口不返回 Hash，后续通过跟踪标签定位任务
+	return "", nil
+}
+
+func (client *rssAutomationQBClient) findTask(ctx context.Context, taskID, trackingTag string) (*rssAutomationDownloadTask, error) {
+	values := url.Values{"tag": {trackingTag}}
+	if taskID != "" {
+		values = url.Values{"hashes": {taskID}}
+	}
+	torrents, err := queryRSSAutomationQBTorrents(ctx, client, values)
+	if err != nil || len(torrents) == 0 {
+		return nil, err
+	}
+	torrent := torrents[0]
+	task := &rssAutomationDownloadTask{
+		ID: torrent.Hash, Name: torrent.Name, State: torrent.State, Progress: torrent.Progress,
+		SavePath: torrent.SavePath, ContentPath: torrent.ContentPath, Size: torrent.Size,
+		Downloaded: torrent.Downloaded, AmountLeft: torrent.AmountLeft, Ratio: torrent.Ratio, ETA: torrent.ETA,
+	}
+	switch strings.ToLower(strings.TrimSpace(torrent.State)) {
+	case "error", "missingfiles", "unknown":
+		task.Failed = true
+	}
+	task.Completed = torrent.Progress >= 0.999999 || (torrent.Size > 0 && torrent.AmountLeft == 0)
+	return task, nil
+}
+
+func (client *rssAutomationQBClient) listFiles(ctx context.Context, taskID string) ([]rssAutomationDownloadFile, error) {
+	requestPath := "/api/v2/torrents/files?" + url.Values{"hash": {taskID}}.Encode()
+	req, err := client.newRequest(ctx, http.MethodGet, requestPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("查询 qBittorrent 文件列表失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("查询 qBittorrent 文件列表返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var torrentFiles []rssAutomationQBTorrentFile
+	if err := json.Unmarshal(body, &torrentFiles); err != nil {
+		return nil, fmt.Errorf("解析 qBittorrent 文件列表失败: %w", err)
+	}
+	files := make([]rssAutomationDownloadFile, 0, len(torrentFiles))
+	for _, file := range torrentFiles {
+		files = append(files, rssAutomationDownloadFile{Name: file.Name, Size: file.Size})
+	}
+	return files, nil
+}
+
+func (client *rssAutomationQBClient) removeTask(ctx context.Context, taskID string, deleteFiles bool) error {
+	form := url.Values{
+		"hashes":      {taskID},
+		"deleteFiles": {fmt.Sprintf("%t", deleteFiles)},
+	}
+	req, err := client.newRequest(ctx, http.MethodPost, "/api/v2/torrents/delete", strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("删除 qBittorrent 任务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("删除 qBittorrent 任务返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (client *rssAutomationQBClient) transferInfo(ctx context.Context) (rssAutomationTransferInfo, error) {
+	var info rssAutomationTransferInfo
+	response, err := client.get(ctx, "/api/v2/transfer/info")
+	if err != nil {
+		return info, err
+	}
+	defer response.Body.Close()
+	if err := json.NewDecoder(io.LimitReader(response.Body, rssAutomationTargetStatusLimit)).Decode(&info); err != nil {
+		return info, fmt.Errorf("解析 qBittorrent 传输状态失败: %w", err)
+	}
+	return info, nil
+}
+
+func (client *rssAutomationQBClient) activeTorrentCount(ctx context.Context) (int, error) {
+	response, err := client.get(ctx, "/api/v2/torrents/info?filter=active")
+	if err != nil {
+		return 0, err
+	}
+	defer response.Body.Close()
+
+	decoder := json.NewDecoder(io.LimitReader(response.Body, rssAutomationTargetStatusLimit))
+	token, err := decoder.Token()
+	if err != nil {
+		return 0, fmt.Errorf("解析 qBittorrent 活动任务失败: %w", err)
+	}
+	opening, ok := token.(json.Delim)
+	if !ok || opening != '[' {
+		return 0, fmt.Errorf("qBittorrent 活动任务响应不是数组")
+	}
+	count := 0
+	for decoder.More() {
+		var item json.RawMessage
+		if err := decoder.Decode(&item); err != nil {
+			return 0, fmt.Errorf("解析 qBittorrent 活动任务失败: %w", err)
+		}
+		count++
+	}
+	if _, err := decoder.Token(); err != nil {
+		return 0, fmt.Errorf("解析 qBittorrent 活动任务失败: %w", err)
+	}
+	return count, nil
+}
+
+func (client *rssAutomationQBClient) get(ctx context.Context, path string) (*http.Response, error) {
+	request, err := client.newRequest(ctx, http.MethodGet, path, nil)
+	if err != nil {
+		return nil, err
+	}
+	response, err := client.client.Do(request)
+	if err != nil {
+		return nil, fmt.Errorf("连接 qBittorrent API 失败: %w", err)
+	}
+	if response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices {
+		return response, nil
+	}
+	defer response.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
+	return nil, fmt.Errorf("qBittorrent API 返回 HTTP %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
+}
+func queryRSSAutomationQBTorrents(ctx context.Context, client *rssAutomationQBClient, values url.Values) ([]rssAutomationQBTorrent, error) {
+	requestPath := "/api/v2/torrents/info"
+	if len(values) > 0 {
+		requestPath += "?" + values.Encode()
+	}
+	req, err := client.newRequest(ctx, http.MethodGet, requestPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := client.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("查询 qBittorrent 任务失败: %w", err)
+	}
+	defer resp.Body.Close()
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 2<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return nil, fmt.Errorf("查询 qBittorrent 任务返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	var torrents []rssAutomationQBTorrent
+	if err := json.Unmarshal(body, &torrents); err != nil {
+		return nil, fmt.Errorf("解析 qBittorrent 任务失败: %w", err)
+	}
+	return torrents, nil
+}
@@ -0,0 +1,207 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	maxRSSAutomationScriptOutputs = 32
+
+	defaultRSSAutomationScriptDurationMS = 200
+	minRSSAutomationScriptDurationMS     = 10
+	maxRSSAutomationScriptDurationMS     = 5000
+	defaultRSSAutomationScriptMemoryKB   = 1024
+	minRSSAutomationScriptMemoryKB       = 64
+	maxRSSAutomationScriptMemoryKB       = 16 << 10
+)
+
+var rssAutomationScriptNamePattern = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]{0,63}$`)
+
+// 节点输出中已占用的键，声明的输出变量不能与之重名
+var rssAutomationScriptReservedOutputs = map[string]struct{}{
+	"selected_port": {}, "variables": {}, "result": {}, "reason": {},
+}
+
+type rssAutomationScriptOutput struct {
+	Name string
+	Type string
+}
+
+func validateRSSAutomationScriptConfig(config map[string]any) error {
+	program, err := parseRSSAutomationScript(rssAutomationConfigString(config, "script"))
+	if err != nil {
+		return fmt.Errorf("脚本语法错误: %w", err)
+	}
+	outputs, err := rssAutomationScriptOutputs(config)
+	if err != nil {
+		return err
+	}
+	for _, output := range outputs {
+		if _, assigned := program.assigned[output.Name]; !assigned {
+			return fmt.Errorf("脚本没有为输出变量 %s 赋值", output.Name)
+		}
+	}
+	if value := rssAutomationConfigUint(config, "max_duration_ms"); value > 0 && (value < minRSSAutomationScriptDurationMS || value > maxRSSAutomationScriptDurationMS) {
+		return fmt.Errorf("脚本执行时间上限必须在 %d 到 %d 毫秒之间", minRSSAutomationScriptDurationMS, maxRSSAutomationScriptDurationMS)
+	}
+	if value := rssAutomationConfigUint(config, "max_memory_kb"); value > 0 && (value < minRSSAutomationScriptMemoryKB || value > maxRSSAutomationScriptMemoryKB) {
+		return fmt.Errorf("脚本内存上限必须在 %d 到 %d KB 之间", minRSSAutomationScriptMemoryKB, maxRSSAutomationScriptMemoryKB)
+	}
+	return nil
+}
+
+// rssAutomationScriptOutputs 读取声明的输出变量，格式为 [{"name": "size", "type": "integer"}]
+func rssAutomationScriptOutputs(config map[string]any) ([]rssAutomationScriptOutput, error) {
+	raw, exists := config["outputs"]
+	if !exists || raw == nil {
+		return nil, nil
+	}
+	items, ok := raw.([]any)
+	if !ok {
+		return nil, errors.New("输出变量必须是数组")
+	}
+	if len(items) > maxRSSAutomationScriptOutputs {
+		return nil, fmt.Errorf("输出变量不能超过 %d 个", maxRSSAutomationScriptOutputs)
+	}
+	outputs := make([]rssAutomationScriptOutput, 0, len(items))
+	seen := make(map[string]struct{}, len(items))
+	for _, item := range items {
+		declaration, ok := item.(map[string]any)
+		if !ok {
+			return nil, errors.New("输出变量必须包含 name 与 type")
+		}
+		output := rssAutomationScriptOutput{
+			Name: rssAutomationConfigString(declaration, "name"),
+			Type: strings.ToLower(rssAutomationConfigString(declaration, "type")),
+		}
+		if output.Type == "" {
+			output.Type = "any"
+		}
+		if !rssAutomationScriptNamePattern.MatchString(output.Name) {
+			return nil, fmt.Errorf("输出变量名 %q 只能包含字母、数字和下划线，且不能以数字开头", output.Name)
+		}
+		if _, reserved := rssAutomationScriptReservedOutputs[output.Name]; reserved {
+			return nil, fmt.Errorf("输出变量名 %s 已被节点输出占用", output.Name)
+		}
+		if _, duplicated := seen[output.Name]; duplicated {
+			return nil, fmt.Errorf("输出变量 %s 重复", output.Name)
+		}
+		seen[output.Name] = struct{}{}
+		switch output.Type {
+		case "any", "string", "integer", "number", "boolean", "array", "object":
+		default:
+			return nil, fmt.Errorf("输出变量 %s 的类型必须是 any/string/integer/number/boolean/array/object", output.Name)
+		}
+		outputs = append(outputs, output)
+	}
+	return outputs, nil
+}
+
+func rssAutomationScriptLimitsFromConfig(config map[string]any) rssAutomationScriptLimits {
+	durationMS := rssAutomationConfigUint(config, "max_duration_ms")
+	if durationMS < minRSSAutomationScriptDurationMS || durationMS > maxRSSAutomationScriptDurationMS {
+		durationMS = defaultRSSAutomationScriptDurationMS
+	}
+	memoryKB := rssAutomationConfigUint(config, "max_memory_kb")
+	if memoryKB < minRSSAutomationScriptMemoryKB || memoryKB > maxRSSAutomationScriptMemoryKB {
+		memoryKB = defaultRSSAutomationScriptMemoryKB
+	}
+	return rssAutomationScriptLimits{Duration: time.Duration(durationMS) * time.Millisecond, Memory: int(memoryKB) << 10}
+}
+
+// executeRSSAutomationScriptNode 执行脚本，把声明的输出变量写入 $vars.* 与节点输出。
+// 语法、运行与输出类型错误都作为节点错误返回，由节点重试与结果统计统一处理，并在 reason 中说明后走失败出口。
+func executeRSSAutomationScriptNode(ctx context.Context, node RSSAutomationNode, runContext map[string]any) (map[string]any, error) {
+	output, err := runRSSAutomationScriptNode(ctx, node, runContext)
+	if err != nil {
+		return map[string]any{"selected_port": "failure", "reason": err.Error()}, err
+	}
+	return output, nil
+}
+
+func runRSSAutomationScriptNode(ctx context.Context, node RSSAutomationNode, runContext map[string]any) (map[string]any, error) {
+	program, err := parseRSSAutomationScript(rssAutomationConfigString(node.Config, "script"))
+	if err != nil {
+		return nil, fmt.Errorf("脚本语法错误: %w", err)
+	}
+	outputs, err := rssAutomationScriptOutputs(node.Config)
+	if err != nil {
+		return nil, err
+	}
+	result, locals, err := program.run(ctx, runContext, rssAutomationScriptLimitsFromConfig(node.Config))
+	if err != nil {
+		return nil, err
+	}
+	variables := make(map[string]any, len(outputs))
+	output := map[string]any{"selected_port": "success", "result": result, "variables": variables}
+	for _, declared := range outputs {
+		value, assigned := locals[declared.Name]
+		if !assigned {
+			return nil, fmt.Errorf("脚本没有为输出变量 %s 赋值", declared.Name)
+		}
+		converted, err := coerceRSSAutomationScriptOutput(value, declared.Type)
+		if err != nil {
+			return nil, fmt.Errorf("输出变量 %s %s", declared.Name, err.Error())
+		}
+		variables[declared.Name] = converted
+		output[declared.Name] = converted
+	}
+	return output, nil
+}
+
+func coerceRSSAutomationScriptOutput(value any, valueType string) (any, error) {
+	if valueType == "any" {
+		return value, nil
+	}
+	if value == nil {
+		return nil, fmt.Errorf("的值为 nil，需要 %s", valueType)
+	}
+	switch valueType {
+	case "string":
+		if text, ok := rssAutomationScriptScalarText(value); ok {
+			return text, nil
+		}
+	case "integer":
+		switch typed := value.(type) {
+		case int64:
+			return typed, nil
+		case float64:
+			if typed == math.Trunc(typed) && math.Abs(typed) < 1<<53 {
+				return int64(typed), nil
+			}
+		case string:
+			if parsed, err := strconv.ParseInt(strings.TrimSpace(typed), 10, 64); err == nil {
+				return parsed, nil
+			}
+		}
+	case "number":
+		if number, ok := rssAutomationScriptNumber(value); ok {
+			return number, nil
+		}
+		if text, ok := value.(string); ok {
+			if parsed, err := strconv.ParseFloat(strings.TrimSpace(text), 64); err == nil && !math.IsInf(parsed, 0) && !math.IsNaN(parsed) {
+				return parsed, nil
+			}
+		}
+	case "boolean":
+		if boolean, ok := value.(bool); ok {
+			return boolean, nil
+		}
+	case "array":
+		if items, ok := value.([]any); ok {
+			return items, nil
+		}
+	case "object":
+		if mapping, ok := value.(map[string]any); ok {
+			return mapping, nil
+		}
+	}
+	return nil, fmt.Errorf("的值 %s 不能转换为 %s", rssAutomationScriptTypeName(value), valueType)
+}
@@ -0,0 +1,1100 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"github.com/expr-lang/expr"
+	"github.com/expr-lang/expr/ast"
+	"github.com/expr-lang/expr/file"
+	"github.com/expr-lang/expr/parser/lexer"
+	"github.com/expr-lang/expr/types"
+	"github.com/expr-lang/expr/vm"
+	"github.com/expr-lang/expr/vm/runtime"
+)
+
+// 脚本节点的表达式基于 expr-lang/expr：每行(或以分号分隔)一条语句，语句是 name = 表达式 的赋值或单独的表达式，
+// 每条语句单独编译，之前赋值的变量在后续语句中按名称引用。
+// 只开放 filter/map/any/all/count 五个内置函数与下方注册的函数，没有任何 I/O；
+// 运行上下文、函数结果、拼接、map/filter 的元素与每条语句的结果都按估算字节数计入内存上限，
+// 每次函数调用与循环迭代都检查时限，超时或 ctx 取消时立即返回。
+const (
+	maxRSSAutomationScriptSourceBytes = 16 << 10
+	// VM 的内存预算按元素个数计，这里按每个元素 16 字节换算
+	rssAutomationScriptSlotBytes = 16
+	// 编译时插入的内部函数：+ 运算改为调用 $add 以便拼接计入内存，
+	// filter/map/any/all/count 的每次迭代经过 $loop(只检查时限)或 $collect(同时计入一个元素)
+	rssAutomationScriptAddFunction     = "$add"
+	rssAutomationScriptLoopFunction    = "$loop"
+	rssAutomationScriptCollectFunction = "$collect"
+)
+
+var (
+	errRSSAutomationScriptTimeout = errors.New("脚本执行超时")
+	errRSSAutomationScriptMemory  = errors.New("脚本内存超出限制")
+)
+
+// 脚本可以直接引用的运行上下文根变量，运行时不存在的为 nil
+var rssAutomationScriptRoots = []string{"item", "vars", "nodes", "entry_id", "source_id", "trigger", "inputs"}
+
+type rssAutomationScriptLimits struct {
+	Duration time.Duration
+	Memory   int
+}
+
+type rssAutomationScriptStatement struct {
+	line   int
+	assign string
+	source string
+}
+
+type rssAutomationScriptProgram struct {
+	statements []rssAutomationScriptStatement
+	assigned   map[string]struct{}
+}
+
+// parseRSSAutomationScript 拆分语句并逐条编译检查，未知变量、未知函数与参数个数错误都在这里报告
+func parseRSSAutomationScript(source string) (*rssAutomationScriptProgram, error) {
+	if len(source) > maxRSSAutomationScriptSourceBytes {
+		return nil, fmt.Errorf("脚本不能超过 %d 字节", maxRSSAutomationScriptSourceBytes)
+	}
+	tokens, err := lexer.Lex(file.NewSource(source))
+	if err != nil {
+		return nil, rssAutomationScriptError(1, err)
+	}
+	runes := []rune(source)
+	program := &rssAutomationScriptProgram{assigned: map[string]struct{}{}}
+	var group []lexer.Token
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		statement, err := newRSSAutomationScriptStatement(runes, group)
+		group = nil
+		if err != nil {
+			return err
+		}
+		program.statements = append(program.statements, statement)
+		return nil
+	}
+	depth := 0
+	for _, token := range tokens {
+		if token.Kind == lexer.EOF {
+			break
+		}
+		// 括号外的分号与换行结束一条语句
+		if depth == 0 && len(group) > 0 && (token.Is(lexer.Operator, ";") || strings.ContainsRune(string(runes[group[len(group)-1].To:token.From]), '\n')) {
+			if err := flush(); err != nil {
+				return nil, err
+			}
+		}
+		if depth == 0 && token.Is(lexer.Operator, ";") {
+			continue
+		}
+		switch {
+		case token.Is(lexer.Bracket, "(", "[", "{"):
+			depth++
+		case token.Is(lexer.Bracket, ")", "]", "}") && depth > 0:
+			depth--
+		}
+		group = append(group, token)
+	}
+	if err := flush(); err != nil {
+		return nil, err
+	}
+	if len(program.statements) == 0 {
+		return nil, errors.New("脚本不能为空")
+	}
+
+	declared := newRSSAutomationScriptDeclarations(nil)
+	for _, statement := range program.statements {
+		if _, err := compileRSSAutomationScriptStatement(statement, declared, &rssAutomationScriptBudget{}); err != nil {
+			return nil, err
+		}
+		if statement.assign != "" {
+			declared[statement.assign] = types.Any
+			program.assigned[statement.assign] = struct{}{}
+		}
+	}
+	return program, nil
+}
+
+func newRSSAutomationScriptStatement(runes []rune, tokens []lexer.Token) (rssAutomationScriptStatement, error) {
+	statement := rssAutomationScriptStatement{line: strings.Count(string(runes[:tokens[0].From]), "\n") + 1}
+	start := tokens[0].From
+	if len(tokens) > 1 && tokens[0].Kind == lexer.Identifier && tokens[1].Is(lexer.Operator, "=") {
+		if !rssAutomationScriptNamePattern.MatchString(tokens[0].Value) {
+			return statement, fmt.Errorf("第 %d 行: 变量名 %q 只能包含字母、数字和下划线", statement.line, tokens[0].Value)
+		}
+		if len(tokens) == 2 {
+			return statement, fmt.Errorf("第 %d 行: %s = 后缺少表达式", statement.line, tokens[0].Value)
+		}
+		statement.assign = tokens[0].Value
+		start = tokens[2].From
+	}
+	statement.source = string(runes[start:tokens[len(tokens)-1].To])
+	return statement, nil
+}
+
+func newRSSAutomationScriptDeclarations(runContext map[string]any) types.Map {
+	declared := make(types.Map, len(rssAutomationScriptRoots)+len(runContext))
+	for _, name := range rssAutomationScriptRoots {
+		declared[name] = types.Any
+	}
+	for name := range runContext {
+		declared[name] = types.Any
+	}
+	return declared
+}
+
+func compileRSSAutomationScriptStatement(statement rssAutomationScriptStatement, declared types.Map, budget *rssAutomationScriptBudget) (*vm.Program, error) {
+	options := []expr.Option{
+		expr.Env(declared),
+		expr.DisableAllBuiltins(),
+		expr.Patch(rssAutomationScriptPatch{}),
+		expr.Function(rssAutomationScriptAddFunction, budget.add, new(func(any, any) any)),
+		expr.Function(rssAutomationScriptLoopFunction, budget.loop, new(func(any) any)),
+		expr.Function(rssAutomationScriptCollectFunction, budget.collect, new(func(any) any)),
+	}
+	for name := range rssAutomationScriptLambdaFunctions {
+		options = append(options, expr.EnableBuiltin(name))
+	}
+	for name, function := range rssAutomationScriptFunctions {
+		options = append(options, expr.Function(name, budget.function(name, function), function.signatures()...))
+	}
+	program, err := expr.Compile(statement.source, options...)
+	if err != nil {
+		return nil, rssAutomationScriptError(statement.line, err)
+	}
+	return program, nil
+}
+
+// rssAutomationScriptPatch 把 a + b 改写为 $add(a, b)，并把循环体 body 包装为 $loop(body) 或 $collect(body)
+type rssAutomationScriptPatch struct{}
+
+func (rssAutomationScriptPatch) Visit(node *ast.Node) {
+	switch typed := (*node).(type) {
+	case *ast.BinaryNode:
+		if typed.Operator == "+" {
+			ast.Patch(node, &ast.CallNode{
+				Callee:    &ast.IdentifierNode{Value: rssAutomationScriptAddFunction},
+				Arguments: []ast.Node{typed.Left, typed.Right},
+			})
+		}
+	case *ast.BuiltinNode:
+		if len(typed.Arguments) != 2 {
+			return
+		}
+		predicate, ok := typed.Arguments[1].(*ast.PredicateNode)
+		if !ok {
+			return
+		}
+		callee := rssAutomationScriptLoopFunction
+		if typed.Name == "map" || typed.Name == "filter" {
+			callee = rssAutomationScriptCollectFunction
+		}
+		predicate.Node = &ast.CallNode{
+			Callee:    &ast.IdentifierNode{Value: callee},
+			Arguments: []ast.Node{predicate.Node},
+		}
+	}
+}
+
+// rssAutomationScriptError 去掉 expr 错误中的源码片段，只保留行号与原因；资源限制错误原样返回
+func rssAutomationScriptError(line int, err error) error {
+	for _, limit := range []error{errRSSAutomationScriptTimeout, errRSSAutomationScriptMemory, context.Canceled} {
+		if errors.Is(err, limit) {
+			return limit
+		}
+	}
+	var exprErr *file.Error
+	if errors.As(err, &exprErr) {
+		if exprErr.Message == "memory budget exceeded" {
+			return errRSSAutomationScriptMemory
+		}
+		return fmt.Errorf("第 %d 行: %s", line, exprErr.Message)
+	}
+	return fmt.Errorf("第 %d 行: %w", line, err)
+}
+
+// rssAutomationScriptBudget 一次执行的时长与内存预算，函数调用时检查，超时或 ctx 取消后立即失败
+type rssAutomationScriptBudget struct {
+	ctx      context.Context
+	deadline time.Time
+	memory   int
+	limit    int
+	aborted  atomic.Bool
+}
+
+func newRSSAutomationScriptBudget(ctx context.Context, limits rssAutomationScriptLimits) *rssAutomationScriptBudget {
+	budget := &rssAutomationScriptBudget{ctx: ctx, deadline: time.Now().Add(limits.Duration), limit: limits.Memory}
+	if deadline, ok := ctx.Deadline(); ok && deadline.Before(budget.deadline) {
+		budget.deadline = deadline
+	}
+	return budget
+}
+
+func (b *rssAutomationScriptBudget) check() error {
+	if b.aborted.Load() || !time.Now().Before(b.deadline) {
+		return errRSSAutomationScriptTimeout
+	}
+	if err := b.ctx.Err(); err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			return errRSSAutomationScriptTimeout
+		}
+		return err
+	}
+	return nil
+}
+
+func (b *rssAutomationScriptBudget) charge(bytes int) error {
+	if err := b.check(); err != nil {
+		return err
+	}
+	b.memory += bytes
+	if b.memory > b.limit {
+		return errRSSAutomationScriptMemory
+	}
+	return nil
+}
+
+// slots 剩余内存换算成 VM 的内存预算
+func (b *rssAutomationScriptBudget) slots() uint {
+	remaining := b.limit - b.memory
+	if remaining < 0 {
+		remaining = 0
+	}
+	return uint(remaining/rssAutomationScriptSlotBytes) + 1
+}
+
+// run 依次执行语句，返回最后一条语句的值与全部赋值结果。
+// 语句在单独的 goroutine 中执行，到达时限或 ctx 取消时立即返回；
+// 剩余的计算会在下一次函数调用或循环迭代时失败，不会在后台继续执行。
+func (program *rssAutomationScriptProgram) run(ctx context.Context, runContext map[string]any, limits rssAutomationScriptLimits) (any, map[string]any, error) {
+	budget := newRSSAutomationScriptBudget(ctx, limits)
+	if err := budget.check(); err != nil {
+		return nil, nil, err
+	}
+	type outcome struct {
+		result any
+		locals map[string]any
+		err    error
+	}
+	done := make(chan outcome, 1)
+	go func() {
+		result, locals, err := program.execute(budget, runContext)
+		done <- outcome{result: result, locals: locals, err: err}
+	}()
+	timer := time.NewTimer(time.Until(budget.deadline))
+	defer timer.Stop()
+	select {
+	case finished := <-done:
+		return finished.result, finished.locals, finished.err
+	case <-timer.C:
+		budget.aborted.Store(true)
+		return nil, nil, errRSSAutomationScriptTimeout
+	case <-ctx.Done():
+		err := budget.check()
+		budget.aborted.Store(true)
+		return nil, nil, err
+	}
+}
+
+func (program *rssAutomationScriptProgram) execute(budget *rssAutomationScriptBudget, runContext map[string]any) (any, map[string]any, error) {
+	env := make(map[string]any, len(rssAutomationScriptRoots)+len(runContext))
+	for _, name := range rssAutomationScriptRoots {
+		env[name] = nil
+	}
+	for name, value := range runContext {
+		env[name] = normalizeRSSAutomationScriptValue(value)
+	}
+	size, err := measureRSSAutomationScriptValue(env)
+	if err != nil {
+		return nil, nil, err
+	}
+	if err := budget.charge(size); err != nil {
+		return nil, nil, err
+	}
+	declared := newRSSAutomationScriptDeclarations(runContext)
+	locals := map[string]any{}
+	var result any
+	for _, statement := range program.statements {
+		compiled, err := compileRSSAutomationScriptStatement(statement, declared, budget)
+		if err != nil {
+			return nil, nil, err
+		}
+		machine := vm.VM{MemoryBudget: budget.slots()}
+		value, err := machine.Run(compiled, env)
+		if err != nil {
+			return nil, nil, rssAutomationScriptError(statement.line, err)
+		}
+		value = normalizeRSSAutomationScriptValue(value)
+		size, err := measureRSSAutomationScriptValue(value)
+		if err != nil {
+			return nil, nil, fmt.Errorf("第 %d 行: %w", statement.line, err)
+		}
+		if err := budget.charge(size); err != nil {
+			return nil, nil, err
+		}
+		if statement.assign != "" {
+			env[statement.assign] = value
+			declared[statement.assign] = types.Any
+			locals[statement.assign] = value
+		}
+		result = value
+	}
+	return result, locals, nil
+}
+
+// add 实现 + 运算：字符串与标量拼接、数组合并按结果大小计入内存，其余交给 expr 的数值加法
+func (b *rssAutomationScriptBudget) add(params ...any) (any, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	left, right := rssAutomationScriptScalar(params[0]), rssAutomationScriptScalar(params[1])
+	leftItems, leftIsArray := left.([]any)
+	rightItems, rightIsArray := right.([]any)
+	if leftIsArray && rightIsArray {
+		if err := b.charge(rssAutomationScriptSlotBytes * (len(leftItems) + len(rightItems))); err != nil {
+			return nil, err
+		}
+		return append(append(make([]any, 0, len(leftItems)+len(rightItems)), leftItems...), rightItems...), nil
+	}
+	_, leftIsText := left.(string)
+	_, rightIsText := right.(string)
+	if leftIsText || rightIsText {
+		leftText, leftOK := rssAutomationScriptScalarText(left)
+		rightText, rightOK := rssAutomationScriptScalarText(right)
+		if leftOK && rightOK {
+			if err := b.charge(len(leftText) + len(rightText)); err != nil {
+				return nil, err
+			}
+			return leftText + rightText, nil
+		}
+	}
+	return runtime.Add(left, right), nil
+}
+
+// loop 在每次循环迭代时检查时限，原样返回循环体的值
+func (b *rssAutomationScriptBudget) loop(params ...any) (any, error) {
+	if err := b.check(); err != nil {
+		return nil, err
+	}
+	return params[0], nil
+}
+
+// collect 在 map/filter 的每次迭代时按一个元素计入内存
+func (b *rssAutomationScriptBudget) collect(params ...any) (any, error) {
+	if err := b.charge(rssAutomationScriptSlotBytes); err != nil {
+		return nil, err
+	}
+	return params[0], nil
+}
+
+// normalizeRSSAutomationScriptValue 把运行上下文中的各类 Go 值递归统一为 nil、bool、int64、float64、string、[]any、map[string]any
+func normalizeRSSAutomationScriptValue(value any) any {
+	switch typed := value.(type) {
+	case nil, bool, int64, float64, string:
+		return value
+	case []any:
+		items := make([]any, len(typed))
+		for index, item := range typed {
+			items[index] = normalizeRSSAutomationScriptValue(item)
+		}
+		return items
+	case map[string]any:
+		result := make(map[string]any, len(typed))
+		for key, item := range typed {
+			result[key] = normalizeRSSAutomationScriptValue(item)
+		}
+		return result
+	case json.Number:
+		if integer, err := typed.Int64(); err == nil {
+			return integer
+		}
+		number, _ := typed.Float64()
+		return number
+	case int, int8, int16, int32, uint8, uint16, uint32, float32:
+		return rssAutomationScriptScalar(value)
+	case uint:
+		return rssAutomationScriptUnsigned(uint64(typed))
+	case uint64:
+		return rssAutomationScriptUnsigned(typed)
+	case time.Time:
+		return typed.UTC().Format(time.RFC3339Nano)
+	case *time.Time:
+		if typed == nil {
+			return nil
+		}
+		return typed.UTC().Format(time.RFC3339Nano)
+	case []string:
+		items := make([]any, len(typed))
+		for index, item := range typed {
+			items[index] = item
+		}
+		return items
+	case []map[string]any:
+		items := make([]any, len(typed))
+		for index, item := range typed {
+			items[index] = normalizeRSSAutomationScriptValue(item)
+		}
+		return items
+	case map[string]string:
+		result := make(map[string]any, len(typed))
+		for key, item := range typed {
+			result[key] = item
+		}
+		return result
+	default:
+		// 其余结构体等类型按 JSON 形式暴露给脚本
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil
+		}
+		var decoded any
+		decoder := json.NewDecoder(strings.NewReader(string(encoded)))
+		decoder.UseNumber()
+		if decoder.Decode(&decoded) != nil {
+			return nil
+		}
+		return normalizeRSSAutomationScriptValue(decoded)
+	}
+}
+
+// rssAutomationScriptScalar 把 expr 字面量产生的 int 等数值统一为 int64/float64，其余值原样返回
+func rssAutomationScriptScalar(value any) any {
+	switch typed := value.(type) {
+	case int:
+		return int64(typed)
+	case int8:
+		return int64(typed)
+	case int16:
+		return int64(typed)
+	case int32:
+		return int64(typed)
+	case uint8:
+		return int64(typed)
+	case uint16:
+		return int64(typed)
+	case uint32:
+		return int64(typed)
+	case float32:
+		return float64(typed)
+	default:
+		return value
+	}
+}
+
+func rssAutomationScriptUnsigned(value uint64) any {
+	if value > math.MaxInt64 {
+		return float64(value)
+	}
+	return int64(value)
+}
+
+// measureRSSAutomationScriptValue 估算规范化后的值占用的字节数，NaN 与无穷大不能写入节点输出
+func measureRSSAutomationScriptValue(value any) (int, error) {
+	switch typed := value.(type) {
+	case string:
+		return rssAutomationScriptSlotBytes + len(typed), nil
+	case float64:
+		if math.IsInf(typed, 0) || math.IsNaN(typed) {
+			return 0, errors.New("数值运算溢出或除数为 0")
+		}
+		return rssAutomationScriptSlotBytes, nil
+	case []any:
+		size := rssAutomationScriptSlotBytes
+		for _, item := range typed {
+			itemSize, err := measureRSSAutomationScriptValue(item)
+			if err != nil {
+				return 0, err
+			}
+			size += itemSize
+		}
+		return size, nil
+	case map[string]any:
+		size := rssAutomationScriptSlotBytes
+		for key, item := range typed {
+			itemSize, err := measureRSSAutomationScriptValue(item)
+			if err != nil {
+				return 0, err
+			}
+			size += len(key) + itemSize
+		}
+		return size, nil
+	default:
+		return rssAutomationScriptSlotBytes, nil
+	}
+}
+
+func rssAutomationScriptTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "nil"
+	case bool:
+		return "布尔值"
+	case int64:
+		return "整数"
+	case float64:
+		return "数字"
+	case string:
+		return "字符串"
+	case []any:
+		return "数组"
+	case map[string]any:
+		return "对象"
+	default:
+		return fmt.Sprintf("%T", value)
+	}
+}
+
+func rssAutomationScriptNumber(value any) (float64, bool) {
+	switch typed := value.(type) {
+	case int64:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	default:
+		return 0, false
+	}
+}
+
+func rssAutomationScriptScalarText(value any) (string, bool) {
+	switch typed := value.(type) {
+	case string:
+		return typed, true
+	case int64:
+		return strconv.FormatInt(typed, 10), true
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64), true
+	case bool:
+		return strconv.FormatBool(typed), true
+	default:
+		return "", false
+	}
+}
+
+func rssAutomationScriptEqual(left, right any) bool {
+	leftInt, leftIsInt := left.(int64)
+	rightInt, rightIsInt := right.(int64)
+	if leftIsInt && rightIsInt {
+		return leftInt == rightInt
+	}
+	leftNumber, leftIsNumber := rssAutomationScriptNumber(left)
+	rightNumber, rightIsNumber := rssAutomationScriptNumber(right)
+	if leftIsNumber && rightIsNumber {
+		return leftNumber == rightNumber
+	}
+	return reflect.DeepEqual(left, right)
+}
+
+type rssAutomationScriptFunction struct {
+	minArgs int
+	maxArgs int // -1 表示不限
+	call    func(b *rssAutomationScriptBudget, args []any) (any, error)
+}
+
+// signatures 按参数个数生成 expr 的函数签名，编译时即可发现参数个数错误
+func (function rssAutomationScriptFunction) signatures() []any {
+	anyType := reflect.TypeOf((*any)(nil)).Elem()
+	out := []reflect.Type{anyType}
+	if function.maxArgs < 0 {
+		in := make([]reflect.Type, function.minArgs+1)
+		for index := range in {
+			in[index] = anyType
+		}
+		in[function.minArgs] = reflect.SliceOf(anyType)
+		return []any{reflect.Zero(reflect.FuncOf(in, out, true)).Interface()}
+	}
+	signatures := make([]any, 0, function.maxArgs-function.minArgs+1)
+	for count := function.minArgs; count <= function.maxArgs; count++ {
+		in := make([]reflect.Type, count)
+		for index := range in {
+			in[index] = anyType
+		}
+		signatures = append(signatures, reflect.Zero(reflect.FuncOf(in, out, false)).Interface())
+	}
+	return signatures
+}
+
+// function 包装内置函数：调用前检查时限，参数统一为 int64/float64，错误带上函数名
+func (b *rssAutomationScriptBudget) function(name string, function rssAutomationScriptFunction) func(...any) (any, error) {
+	return func(params ...any) (any, error) {
+		if err := b.check(); err != nil {
+			return nil, err
+		}
+		args := make([]any, len(params))
+		for index, param := range params {
+			args[index] = rssAutomationScriptScalar(param)
+		}
+		result, err := function.call(b, args)
+		if err != nil {
+			if errors.Is(err, errRSSAutomationScriptMemory) || errors.Is(err, errRSSAutomationScriptTimeout) || errors.Is(err, context.Canceled) {
+				return nil, err
+			}
+			return nil, fmt.Errorf("%s(): %w", name, err)
+		}
+		return result, nil
+	}
+}
+
+// 第二个参数是针对每个元素求值的表达式，元素通过 # 引用；由 expr 内置实现
+var rssAutomationScriptLambdaFunctions = map[string]struct{}{
+	"filter": {}, "map": {}, "any": {}, "all": {}, "count": {},
+}
+
+var rssAutomationScriptFunctions = map[string]rssAutomationScriptFunction{
+	"len":          {1, 1, rssAutomationScriptLen},
+	"lower":        {1, 1, rssAutomationScriptStringFunc(strings.ToLower)},
+	"upper":        {1, 1, rssAutomationScriptStringFunc(strings.ToUpper)},
+	"trim":         {1, 1, rssAutomationScriptStringFunc(strings.TrimSpace)},
+	"replace":      {3, 3, rssAutomationScriptReplace},
+	"split":        {2, 2, rssAutomationScriptSplit},
+	"join":         {2, 2, rssAutomationScriptJoin},
+	"starts_with":  {2, 2, rssAutomationScriptAffix(strings.HasPrefix)},
+	"ends_with":    {2, 2, rssAutomationScriptAffix(strings.HasSuffix)},
+	"regex_find":   {2, 3, rssAutomationScriptRegexFind},
+	"int":          {1, 1, rssAutomationScriptInt},
+	"float":        {1, 1, rssAutomationScriptFloat},
+	"string":       {1, 1, rssAutomationScriptString},
+	"round":        {1, 2, rssAutomationScriptRound},
+	"floor":        {1, 1, rssAutomationScriptRounding(math.Floor)},
+	"ceil":         {1, 1, rssAutomationScriptRounding(math.Ceil)},
+	"abs":          {1, 1, rssAutomationScriptAbs},
+	"min":          {1, -1, rssAutomationScriptExtreme(-1)},
+	"max":          {1, -1, rssAutomationScriptExtreme(1)},
+	"parse_size":   {1, 1, rssAutomationScriptParseSize},
+	"format_size":  {1, 1, rssAutomationScriptFormatSize},
+	"now":          {0, 0, func(*rssAutomationScriptBudget, []any) (any, error) { return time.Now().Unix(), nil }},
+	"timestamp":    {1, 1, rssAutomationScriptTimestamp},
+	"keys":         {1, 1, rssAutomationScriptKeys},
+	"is_empty":     {1, 1, rssAutomationScriptIsEmpty},
+	"format_index": {2, 2, rssAutomationScriptFormatIndex},
+}
+
+func rssAutomationScriptText(value any) (string, error) {
+	if value == nil {
+		return "", nil
+	}
+	if text, ok := rssAutomationScriptScalarText(value); ok {
+		return text, nil
+	}
+	return "", fmt.Errorf("需要字符串，实际为 %s", rssAutomationScriptTypeName(value))
+}
+
+func rssAutomationScriptLen(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case nil:
+		return int64(0), nil
+	case string:
+		return int64(utf8.RuneCountInString(typed)), nil
+	case []any:
+		return int64(len(typed)), nil
+	case map[string]any:
+		return int64(len(typed)), nil
+	default:
+		return nil, fmt.Errorf("不能计算 %s 的长度", rssAutomationScriptTypeName(args[0]))
+	}
+}
+
+func rssAutomationScriptStringFunc(transform func(string) string) func(*rssAutomationScriptBudget, []any) (any, error) {
+	return func(b *rssAutomationScriptBudget, args []any) (any, error) {
+		text, err := rssAutomationScriptText(args[0])
+		if err != nil {
+			return nil, err
+		}
+		if err := b.charge(len(text)); err != nil {
+			return nil, err
+		}
+		return transform(text), nil
+	}
+}
+
+func rssAutomationScriptReplace(b *rssAutomationScriptBudget, args []any) (any, error) {
+	texts := make([]string, len(args))
+	for index, arg := range args {
+		text, err := rssAutomationScriptText(arg)
+		if err != nil {
+			return nil, err
+		}
+		texts[index] = text
+	}
+	// 先按最坏情况估算结果大小，避免一次替换就产生超大字符串
+	estimate := len(texts[0])
+	if len(texts[2]) > len(texts[1]) {
+		occurrences := strings.Count(texts[0], texts[1])
+		if texts[1] == "" {
+			occurrences = utf8.RuneCountInString(texts[0]) + 1
+		}
+		estimate += occurrences * (len(texts[2]) - len(texts[1]))
+	}
+	if err := b.charge(estimate); err != nil {
+		return nil, err
+	}
+	return strings.ReplaceAll(texts[0], texts[1], texts[2]), nil
+}
+
+func rssAutomationScriptSplit(b *rssAutomationScriptBudget, args []any) (any, error) {
+	text, err := rssAutomationScriptText(args[0])
+	if err != nil {
+		return nil, err
+	}
+	separator, err := rssAutomationScriptText(args[1])
+	if err != nil {
+		return nil, err
+	}
+	parts := strings.Split(text, separator)
+	if err := b.charge(len(text) + rssAutomationScriptSlotBytes*len(parts)); err != nil {
+		return nil, err
+	}
+	items := make([]any, len(parts))
+	for index, part := range parts {
+		items[index] = part
+	}
+	return items, nil
+}
+
+func rssAutomationScriptJoin(b *rssAutomationScriptBudget, args []any) (any, error) {
+	items, ok := args[0].([]any)
+	if !ok && args[0] != nil {
+		return nil, fmt.Errorf("第一个参数必须是数组，实际为 %s", rssAutomationScriptTypeName(args[0]))
+	}
+	separator, err := rssAutomationScriptText(args[1])
+	if err != nil {
+		return nil, err
+	}
+	parts := make([]string, len(items))
+	size := 0
+	for index, item := range items {
+		text, err := rssAutomationScriptText(rssAutomationScriptScalar(item))
+		if err != nil {
+			return nil, err
+		}
+		parts[index] = text
+		size += len(text) + len(separator)
+	}
+	if err := b.charge(size); err != nil {
+		return nil, err
+	}
+	return strings.Join(parts, separator), nil
+}
+
+func rssAutomationScriptAffix(check func(string, string) bool) func(*rssAutomationScriptBudget, []any) (any, error) {
+	return func(_ *rssAutomationScriptBudget, args []any) (any, error) {
+		text, err := rssAutomationScriptText(args[0])
+		if err != nil {
+			return nil, err
+		}
+		affix, err := rssAutomationScriptText(args[1])
+		if err != nil {
+			return nil, err
+		}
+		return check(text, affix), nil
+	}
+}
+
+func rssAutomationScriptRegexp(args []any) (string, *regexp.Regexp, error) {
+	text, err := rssAutomationScriptText(args[0])
+	if err != nil {
+		return "", nil, err
+	}
+	pattern, err := rssAutomationScriptText(args[1])
+	if err != nil {
+		return "", nil, err
+	}
+	if len(pattern) > 1024 {
+		return "", nil, errors.New("正则表达式不能超过 1024 字节")
+	}
+	compiled, err := regexp.Compile(pattern)
+	if err != nil {
+		return "", nil, fmt.Errorf("正则表达式无效: %w", err)
+	}
+	return text, compiled, nil
+}
+
+func rssAutomationScriptRegexFind(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	text, compiled, err := rssAutomationScriptRegexp(args)
+	if err != nil {
+		return nil, err
+	}
+	group := int64(0)
+	if len(args) == 3 {
+		var ok bool
+		if group, ok = args[2].(int64); !ok || group < 0 || group > int64(compiled.NumSubexp()) {
+			return nil, fmt.Errorf("捕获组 %v 不存在", args[2])
+		}
+	}
+	match := compiled.FindStringSubmatchIndex(text)
+	if match == nil || match[2*group] < 0 {
+		return nil, nil
+	}
+	return text[match[2*group]:match[2*group+1]], nil
+}
+
+func rssAutomationScriptInt(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case int64:
+		return typed, nil
+	case float64:
+		if math.IsNaN(typed) || typed >= math.MaxInt64 || typed <= math.MinInt64 {
+			return nil, fmt.Errorf("%v 超出整数范围", typed)
+		}
+		return int64(typed), nil
+	case bool:
+		if typed {
+			return int64(1), nil
+		}
+		return int64(0), nil
+	case string:
+		text := strings.ReplaceAll(strings.TrimSpace(typed), ",", "")
+		if parsed, err := strconv.ParseInt(text, 10, 64); err == nil {
+			return parsed, nil
+		}
+		if parsed, err := strconv.ParseFloat(text, 64); err == nil && parsed < math.MaxInt64 && parsed > math.MinInt64 {
+			return int64(parsed), nil
+		}
+		return nil, fmt.Errorf("%q 不是有效整数", typed)
+	default:
+		return nil, fmt.Errorf("不能把 %s 转换为整数", rssAutomationScriptTypeName(args[0]))
+	}
+}
+
+func rssAutomationScriptFloat(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case int64:
+		return float64(typed), nil
+	case float64:
+		return typed, nil
+	case string:
+		parsed, err := strconv.ParseFloat(strings.ReplaceAll(strings.TrimSpace(typed), ",", ""), 64)
+		if err != nil || math.IsInf(parsed, 0) || math.IsNaN(parsed) {
+			return nil, fmt.Errorf("%q 不是有效数字", typed)
+		}
+		return parsed, nil
+	default:
+		return nil, fmt.Errorf("不能把 %s 转换为数字", rssAutomationScriptTypeName(args[0]))
+	}
+}
+
+func rssAutomationScriptString(b *rssAutomationScriptBudget, args []any) (any, error) {
+	if text, ok := rssAutomationScriptScalarText(args[0]); ok {
+		return text, nil
+	}
+	if args[0] == nil {
+		return "", nil
+	}
+	encoded, err := json.Marshal(args[0])
+	if err != nil {
+		return nil, err
+	}
+	if err := b.charge(len(encoded)); err != nil {
+		return nil, err
+	}
+	return string(encoded), nil
+}
+
+func rssAutomationScriptRound(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	number, ok := rssAutomationScriptNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("需要数字，实际为 %s", rssAutomationScriptTypeName(args[0]))
+	}
+	if len(args) == 1 {
+		return rssAutomationScriptFloatToInt(math.Round(number))
+	}
+	digits, ok := args[1].(int64)
+	if !ok || digits < 0 || digits > 10 {
+		return nil, errors.New("小数位数必须是 0 到 10 的整数")
+	}
+	scale := math.Pow10(int(digits))
+	return math.Round(number*scale) / scale, nil
+}
+
+func rssAutomationScriptRounding(round func(float64) float64) func(*rssAutomationScriptBudget, []any) (any, error) {
+	return func(_ *rssAutomationScriptBudget, args []any) (any, error) {
+		number, ok := rssAutomationScriptNumber(args[0])
+		if !ok {
+			return nil, fmt.Errorf("需要数字，实际为 %s", rssAutomationScriptTypeName(args[0]))
+		}
+		return rssAutomationScriptFloatToInt(round(number))
+	}
+}
+
+func rssAutomationScriptFloatToInt(number float64) (any, error) {
+	if number >= math.MaxInt64 || number <= math.MinInt64 {
+		return nil, fmt.Errorf("%v 超出整数范围", number)
+	}
+	return int64(number), nil
+}
+
+func rssAutomationScriptAbs(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case int64:
+		if typed < 0 && typed != math.MinInt64 {
+			return -typed, nil
+		}
+		if typed == math.MinInt64 {
+			return -float64(typed), nil
+		}
+		return typed, nil
+	case float64:
+		return math.Abs(typed), nil
+	default:
+		return nil, fmt.Errorf("需要数字，实际为 %s", rssAutomationScriptTypeName(args[0]))
+	}
+}
+
+// rssAutomationScriptExtreme 返回 min/max；只传一个数组参数时取数组内的极值
+func rssAutomationScriptExtreme(direction int) func(*rssAutomationScriptBudget, []any) (any, error) {
+	return func(_ *rssAutomationScriptBudget, args []any) (any, error) {
+		if len(args) == 1 {
+			items, ok := args[0].([]any)
+			if !ok {
+				return nil, fmt.Errorf("需要数组或多个数字，实际为 %s", rssAutomationScriptTypeName(args[0]))
+			}
+			if len(items) == 0 {
+				return nil, nil
+			}
+			args = make([]any, len(items))
+			for index, item := range items {
+				args[index] = rssAutomationScriptScalar(item)
+			}
+		}
+		best := args[0]
+		bestNumber, ok := rssAutomationScriptNumber(best)
+		if !ok {
+			return nil, fmt.Errorf("需要数字，实际为 %s", rssAutomationScriptTypeName(best))
+		}
+		for _, arg := range args[1:] {
+			number, ok := rssAutomationScriptNumber(arg)
+			if !ok {
+				return nil, fmt.Errorf("需要数字，实际为 %s", rssAutomationScriptTypeName(arg))
+			}
+			if (direction < 0 && number < bestNumber) || (direction > 0 && number > bestNumber) {
+				best, bestNumber = arg, number
+			}
+		}
+		return best, nil
+	}
+}
+
+var rssAutomationScriptSizePattern = regexp.MustCompile(`(?i)^([0-9]+(?:\.[0-9]+)?)\s*([kmgtp]?)(?:i?b|b?)?$`)
+
+// rssAutomationScriptParseSize 把 "1.5 GB"、"700MiB" 等文本解析为字节数；
+// 站点普遍以 1024 进制显示体积，因此 GB 与 GiB 都按 1024 换算，无法识别时返回 nil
+func rssAutomationScriptParseSize(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case int64:
+		return typed, nil
+	case float64:
+		return rssAutomationScriptFloatToInt(typed)
+	case nil:
+		return nil, nil
+	case string:
+		text := strings.ReplaceAll(strings.TrimSpace(typed), ",", "")
+		match := rssAutomationScriptSizePattern.FindStringSubmatch(text)
+		if match == nil {
+			return nil, nil
+		}
+		number, err := strconv.ParseFloat(match[1], 64)
+		if err != nil {
+			return nil, nil
+		}
+		exponent := strings.Index("kmgtp", strings.ToLower(match[2])) + 1
+		return rssAutomationScriptFloatToInt(math.Round(number * math.Pow(1024, float64(exponent))))
+	default:
+		return nil, fmt.Errorf("不能把 %s 解析为体积", rssAutomationScriptTypeName(args[0]))
+	}
+}
+
+func rssAutomationScriptFormatSize(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	size, ok := rssAutomationScriptNumber(args[0])
+	if !ok {
+		return nil, fmt.Errorf("需要数字，实际为 %s", rssAutomationScriptTypeName(args[0]))
+	}
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB", "PiB"}
+	unit := 0
+	for math.Abs(size) >= 1024 && unit < len(units)-1 {
+		size /= 1024
+		unit++
+	}
+	if unit == 0 {
+		return fmt.Sprintf("%.0f B", size), nil
+	}
+	return fmt.Sprintf("%.2f %s", size, units[unit]), nil
+}
+
+func rssAutomationScriptTimestamp(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case int64:
+		return typed, nil
+	case string:
+		parsed := parseRSSAutomationTime(typed)
+		if parsed == nil {
+			return nil, nil
+		}
+		return parsed.Unix(), nil
+	case nil:
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("不能把 %s 解析为时间", rssAutomationScriptTypeName(args[0]))
+	}
+}
+
+func rssAutomationScriptKeys(b *rssAutomationScriptBudget, args []any) (any, error) {
+	mapping, ok := args[0].(map[string]any)
+	if !ok && args[0] != nil {
+		return nil, fmt.Errorf("需要对象，实际为 %s", rssAutomationScriptTypeName(args[0]))
+	}
+	if err := b.charge(rssAutomationScriptSlotBytes * (len(mapping) + 1)); err != nil {
+		return nil, err
+	}
+	keys := make([]string, 0, len(mapping))
+	for key := range mapping {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	result := make([]any, len(keys))
+	for index, key := range keys {
+		result[index] = key
+	}
+	return result, nil
+}
+
+func rssAutomationScriptIsEmpty(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	switch typed := args[0].(type) {
+	case nil:
+		return true, nil
+	case string:
+		return strings.TrimSpace(typed) == "", nil
+	case []any:
+		return len(typed) == 0, nil
+	case map[string]any:
+		return len(typed) == 0, nil
+	default:
+		return false, nil
+	}
+}
+
+// rssAutomationScriptFormatIndex 把集数等整数补零到指定宽度，如 format_index(3, 2) 得到 "03"
+func rssAutomationScriptFormatIndex(_ *rssAutomationScriptBudget, args []any) (any, error) {
+	number, ok := args[0].(int64)
+	if !ok {
+		return nil, fmt.Errorf("需要整数，实际为 %s", rssAutomationScriptTypeName(args[0]))
+	}
+	width, ok := args[1].(int64)
+	if !ok || width < 1 || width > 10 {
+		return nil, errors.New("宽度必须是 1 到 10 的整数")
+	}
+	return fmt.Sprintf("%0*d", int(width), number), nil
+}
@@ -0,0 +1,365 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+var rssAutomationScriptTestLimits = rssAutomationScriptLimits{Duration: time.Second, Memory: 1 << 20}
+
+func evalRSSAutomationScriptForTest(ctx context.Context, source string, runContext map[string]any, limits rssAutomationScriptLimits) (any, error) {
+	program, err := parseRSSAutomationScript(source)
+	if err != nil {
+		return nil, err
+	}
+	result, _, err := program.run(ctx, runContext, limits)
+	return result, err
+}
+
+func TestRSSAutomationScriptBuiltins(t *testing.T) {
+	runContext := map[string]any{"item": map[string]any{
+		"title": "[Group] Show - 03 [1080p]", "size": "700 MiB", "pub": "2026-01-02T03:04:05Z",
+		"tags": []string{"1080p", "HEVC"}, "meta": map[string]any{"b": 1, "a": 2}, "blank": "  ",
+	}}
+	cases := []struct {
+		script string
+		want   any
+	}{
+		{`len("芙莉莲")`, int64(3)},
+		{`len([1, 2])`, int64(2)},
+		{`len({a: 1})`, int64(1)},
+		{`len(nil)`, int64(0)},
+		{`lower("AbC")`, "abc"},
+		{`lower(nil)`, ""},
+		{`upper("abc")`, "ABC"},
+		{`trim("  a b  ")`, "a b"},
+		{`replace("a-b-c", "-", "_")`, "a_b_c"},
+		{`split("a,b", ",")`, []any{"a", "b"}},
+		{`join(["a", 1, true], "/")`, "a/1/true"},
+		{`join(nil, ",")`, ""},
+		{`starts_with("Show", "Sh")`, true},
+		{`ends_with("Show", "Sh")`, false},
+		{`regex_find(item.title, "- (\\d+)", 1)`, "03"},
+		{`regex_find(item.title, "\\d+p")`, "1080p"},
+		{`regex_find("abc", "x")`, nil},
+		{`int("1,024")`, int64(1024)},
+		{`int("2.5")`, int64(2)},
+		{`int(3.9)`, int64(3)},
+		{`int(true)`, int64(1)},
+		{`float("1.5")`, 1.5},
+		{`float(2)`, 2.0},
+		{`string(1.5)`, "1.5"},
+		{`string(nil)`, ""},
+		{`string([1, "a"])`, `[1,"a"]`},
+		{`string({a: 1})`, `{"a":1}`},
+		{`round(2.5)`, int64(3)},
+		{`round(3.14159, 2)`, 3.14},
+		{`floor(2.7)`, int64(2)},
+		{`ceil(2.1)`, int64(3)},
+		{`abs(-3)`, int64(3)},
+		{`abs(-1.5)`, 1.5},
+		{`min(3, 1.5, 2)`, 1.5},
+		{`max([1, 5, 3])`, int64(5)},
+		{`min([])`, nil},
+		{`parse_size(item.size)`, int64(700 << 20)},
+		{`parse_size("1.5 GB")`, int64(1610612736)},
+		{`parse_size("n/a")`, nil},
+		{`parse_size(42)`, int64(42)},
+		{`format_size(512)`, "512 B"},
+		{`format_size(1536)`, "1.50 KiB"},
+		{`now() > 1700000000`, true},
+		{`timestamp(item.pub)`, time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC).Unix()},
+		{`timestamp("garbage")`, nil},
+		{`timestamp(5)`, int64(5)},
+		{`keys(item.meta)`, []any{"a", "b"}},
+		{`is_empty(item.blank)`, true},
+		{`is_empty([])`, true},
+		{`is_empty({a: 1})`, false},
+		{`is_empty(0)`, false},
+		{`format_index(3, 2)`, "03"},
+		{`filter([1, 2, 3], # > 1)`, []any{int64(2), int64(3)}},
+		{`map([1, 2], # * 10)`, []any{int64(10), int64(20)}},
+		{`map(item.missing ?? [], #)`, []any{}},
+		{`map([[1, 2], [3]], len(#))`, []any{int64(2), int64(1)}},
+		{`any(item.tags, # == "HEVC")`, true},
+		{`all([1, 2], # > 1)`, false},
+		{`count([1, 2, 3], # % 2 == 1)`, int64(2)},
+	}
+	for _, testCase := range cases {
+		got, err := evalRSSAutomationScriptForTest(context.Background(), testCase.script, runContext, rssAutomationScriptTestLimits)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", testCase.script, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("%s = %#v, want %#v", testCase.script, got, testCase.want)
+		}
+	}
+
+	// 新增内置函数时必须同时补充用例
+	names := make([]string, 0, len(rssAutomationScriptFunctions)+len(rssAutomationScriptLambdaFunctions))
+	for name := range rssAutomationScriptFunctions {
+		names = append(names, name)
+	}
+	for name := range rssAutomationScriptLambdaFunctions {
+		names = append(names, name)
+	}
+	for _, name := range names {
+		covered := false
+		for _, testCase := range cases {
+			if strings.HasPrefix(testCase.script, name+"(") {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			t.Errorf("builtin %s has no test case", name)
+		}
+	}
+}
+
+func TestRSSAutomationScriptBuiltinErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		reason string
+	}{
+		{`len(1)`, "len(): 不能计算 整数 的长度"},
+		{`lower([1])`, "lower(): 需要字符串，实际为 数组"},
+		{`replace("a", [1], "b")`, "replace(): 需要字符串"},
+		{`split("a", {})`, "split(): 需要字符串"},
+		{`join("a", ",")`, "join(): 第一个参数必须是数组"},
+		{`join([[1]], ",")`, "join(): 需要字符串"},
+		{`starts_with([1], "a")`, "starts_with(): 需要字符串"},
+		{`regex_find("a", "(")`, "regex_find(): 正则表达式无效"},
+		{`regex_find("a", "` + strings.Repeat("a", 1025) + `")`, "正则表达式不能超过 1024 字节"},
+		{`regex_find("a", "(a)", 2)`, "regex_find(): 捕获组 2 不存在"},
+		{`regex_find("a", "a", "1")`, "捕获组 1 不存在"},
+		{`int("abc")`, `int(): "abc" 不是有效整数`},
+		{`int(1e30)`, "超出整数范围"},
+		{`int([1])`, "不能把 数组 转换为整数"},
+		{`float("x")`, `float(): "x" 不是有效数字`},
+		{`float(true)`, "不能把 布尔值 转换为数字"},
+		{`round("a")`, "round(): 需要数字"},
+		{`round(1.5, 11)`, "小数位数必须是 0 到 10 的整数"},
+		{`floor("a")`, "floor(): 需要数字"},
+		{`ceil(1e300)`, "超出整数范围"},
+		{`abs("a")`, "abs(): 需要数字"},
+		{`min("a")`, "min(): 需要数组或多个数字"},
+		{`max(1, "a")`, "max(): 需要数字，实际为 字符串"},
+		{`min(["a"])`, "需要数字，实际为 字符串"},
+		{`parse_size(true)`, "不能把 布尔值 解析为体积"},
+		{`format_size("1 GB")`, "format_size(): 需要数字"},
+		{`timestamp(1.5)`, "不能把 数字 解析为时间"},
+		{`keys([1])`, "keys(): 需要对象"},
+		{`format_index(1.5, 2)`, "format_index(): 需要整数"},
+		{`format_index(1, 11)`, "宽度必须是 1 到 10 的整数"},
+		{"x = 1\nlower(x, 2)", "第 2 行: too many arguments to call lower"},
+	}
+	for _, testCase := range cases {
+		_, err := evalRSSAutomationScriptForTest(context.Background(), testCase.script, nil, rssAutomationScriptTestLimits)
+		if err == nil || !strings.Contains(err.Error(), testCase.reason) {
+			t.Errorf("%s: error = %v, want %q", testCase.script, err, testCase.reason)
+		}
+	}
+}
+
+func TestRSSAutomationScriptOperators(t *testing.T) {
+	runContext := map[string]any{"item": map[string]any{"count": 3, "tags": []string{"a"}, "title": "Show"}}
+	cases := []struct {
+		script string
+		want   any
+	}{
+		{`1 + 2 * 3`, int64(7)},
+		{`12 / 4 / 3`, 1.0},
+		{`7 % 4 * 2`, int64(6)},
+		{`-[1, 2][1]`, int64(-2)},
+		{`"a" + 1 + 2`, "a12"},
+		{`1 + "a"`, "1a"},
+		{`[1] + [2]`, []any{int64(1), int64(2)}},
+		{`item.count + 0.5`, 3.5},
+		{`3 not in [1, 2]`, true},
+		{`"ho" in ["Show", "ho"]`, true},
+		{`item.title contains "ho"`, true},
+		{`item.title matches "(?i)^s"`, true},
+		{`item.title startsWith "Sh"`, true},
+		{`false and true or true`, true},
+		{`not true or true`, true},
+		{`1 + 1 == 2 ? "a" : "b"`, "a"},
+		{`1 == 1.0`, true},
+		{`[1, 2] == [1, 2]`, true},
+		{`"a" not in {a: 1}`, false},
+		{`{a: [10, 20]}.a[-1]`, int64(20)},
+		{`item?.missing?.deeper ?? "none"`, "none"},
+		{`item.tags[0]`, "a"},
+		{`x = 2; x * item.count`, int64(6)},
+		{"total = (1 +\n 2)\ntotal", int64(3)},
+		{"a = 1 // 注释\n/* 块注释 */ a + 1", int64(2)},
+		{`x = "a;b"; x`, "a;b"},
+
+		// 短路求值：右侧不会被执行
+		{`false && int("x") == 0`, false},
+		{`1 ?? int("x")`, int64(1)},
+		{`true ? 1 : int("x")`, int64(1)},
+	}
+	for _, testCase := range cases {
+		got, err := evalRSSAutomationScriptForTest(context.Background(), testCase.script, runContext, rssAutomationScriptTestLimits)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", testCase.script, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("%s = %#v, want %#v", testCase.script, got, testCase.want)
+		}
+	}
+
+	errorCases := []struct {
+		script string
+		reason string
+	}{
+		{`1 / (item.count - 3)`, "数值运算溢出或除数为 0"},
+		{"x = 1\ny = item.count % 0", "第 2 行: runtime error: integer divide by zero"},
+		{`item.missing.deeper`, "cannot fetch deeper"},
+		{`item.tags[5]`, "index out of range"},
+		{`item.count ? 1 : 2`, "第 1 行"},
+		{`true + 1`, "invalid operation"},
+	}
+	for _, testCase := range errorCases {
+		_, err := evalRSSAutomationScriptForTest(context.Background(), testCase.script, runContext, rssAutomationScriptTestLimits)
+		if err == nil || !strings.Contains(err.Error(), testCase.reason) {
+			t.Errorf("%s: error = %v, want %q", testCase.script, err, testCase.reason)
+		}
+	}
+}
+
+func TestRSSAutomationScriptParseErrors(t *testing.T) {
+	cases := []struct {
+		script string
+		reason string
+	}{
+		{"   ", "脚本不能为空"},
+		{"// 只有注释\n;", "脚本不能为空"},
+		{strings.Repeat("1", maxRSSAutomationScriptSourceBytes+1), "脚本不能超过 16384 字节"},
+		{`"abc`, "literal not terminated"},
+		{`1 @ 2`, "unrecognized character"},
+		{"x = 1\ny = (1 +", "第 2 行"},
+		{`x =`, "第 1 行: x = 后缺少表达式"},
+		{`1 2`, "unexpected token"},
+		{`exec(1)`, "unknown name exec"},
+		{`x = y; y = 1`, "第 1 行: unknown name y"},
+		{`lower()`, "not enough arguments to call lower"},
+		{`round(1, 2, 3)`, "too many arguments to call round"},
+		{`min()`, "not enough arguments to call min"},
+		{`filter([1])`, "expected at least 2 arguments"},
+		{`sort([2, 1])`, "unknown name sort"},
+	}
+	for _, testCase := range cases {
+		_, err := parseRSSAutomationScript(testCase.script)
+		if err == nil || !strings.Contains(err.Error(), testCase.reason) {
+			t.Errorf("%.40q: error = %v, want %q", testCase.script, err, testCase.reason)
+		}
+	}
+}
+
+func TestRSSAutomationScriptLimitErrors(t *testing.T) {
+	words := make([]any, 8)
+	for index := range words {
+		words[index] = strings.Repeat("w", 10)
+	}
+	runContext := map[string]any{"item": map[string]any{
+		"title": strings.Repeat("x", 1024), "words": words,
+		"meta": map[string]any{"a": 1, "b": 2, "c": 3, "d": 4},
+	}}
+	nested := `xs = split(item.title, ""); count(xs, count(xs, # != "") > 0)`
+	tight := rssAutomationScriptLimits{Duration: time.Minute, Memory: 1400}
+	relaxed := rssAutomationScriptLimits{Duration: time.Minute, Memory: 1 << 20}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	cases := []struct {
+		name       string
+		ctx        context.Context
+		script     string
+		runContext map[string]any
+		limits     rssAutomationScriptLimits
+		want       error
+	}{
+		// 运行上下文本身就超出内存上限
+		{"context", nil, `1`, runContext, rssAutomationScriptLimits{Duration: time.Minute, Memory: 1024}, errRSSAutomationScriptMemory},
+		{"array literal", nil, `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15, 16, 17, 18, 19, 20]`, nil, rssAutomationScriptLimits{Duration: time.Minute, Memory: 256}, errRSSAutomationScriptMemory},
+		{"accumulated", nil, "a = item.title\nb = item.title", runContext, tight, errRSSAutomationScriptMemory},
+		{"string concat", nil, `s = item.title + item.title; 1`, runContext, tight, errRSSAutomationScriptMemory},
+		{"array concat", nil, `item.words + item.words + item.words + item.words + item.words + item.words`, runContext, tight, errRSSAutomationScriptMemory},
+		{"upper", nil, `upper(item.title) == ""`, runContext, tight, errRSSAutomationScriptMemory},
+		{"replace", nil, `replace(item.title, "x", "yy") == ""`, runContext, tight, errRSSAutomationScriptMemory},
+		{"split", nil, `len(split(item.title, "x"))`, runContext, tight, errRSSAutomationScriptMemory},
+		{"join", nil, `len(join(item.words + item.words + item.words, "-"))`, runContext, tight, errRSSAutomationScriptMemory},
+		{"string", nil, `len(string(item) + string(item))`, runContext, tight, errRSSAutomationScriptMemory},
+		{"map", nil, `len(map(split(item.title, ""), #))`, runContext, relaxed, nil},
+		{"nested map", nil, `xs = split(item.title, ""); len(map(xs, map(xs, #)))`, runContext, relaxed, errRSSAutomationScriptMemory},
+		{"duration", nil, nested, runContext, rssAutomationScriptLimits{Duration: time.Nanosecond, Memory: 1 << 20}, errRSSAutomationScriptTimeout},
+		{"context deadline", expired, nested, runContext, relaxed, errRSSAutomationScriptTimeout},
+		{"context canceled", canceled, nested, runContext, relaxed, context.Canceled},
+	}
+	for _, testCase := range cases {
+		ctx := testCase.ctx
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		_, err := evalRSSAutomationScriptForTest(ctx, testCase.script, testCase.runContext, testCase.limits)
+		if !errors.Is(err, testCase.want) {
+			t.Errorf("%s: error = %v, want %v", testCase.name, err, testCase.want)
+		}
+		// 资源限制错误必须原样返回，不能被包装成函数参数错误
+		if err != nil && testCase.want != nil && err.Error() != testCase.want.Error() {
+			t.Errorf("%s: error %q should not be wrapped", testCase.name, err)
+		}
+	}
+}
+
+func TestRSSAutomationScriptTimeoutStopsLongRunningStatement(t *testing.T) {
+	runContext := map[string]any{"item": map[string]any{"title": strings.Repeat("x", 2048)}}
+	// 嵌套循环约 80 亿次迭代，只能靠每次迭代检查时限中止
+	script := `xs = split(item.title, ""); count(xs, all(xs, all(xs, # != "y")))`
+	limits := rssAutomationScriptLimits{Duration: 20 * time.Millisecond, Memory: 16 << 20}
+	started := time.Now()
+	_, err := evalRSSAutomationScriptForTest(context.Background(), script, runContext, limits)
+	if !errors.Is(err, errRSSAutomationScriptTimeout) {
+		t.Fatalf("error = %v, want timeout", err)
+	}
+	if elapsed := time.Since(started); elapsed > 500*time.Millisecond {
+		t.Fatalf("script ran for %v after a 20ms limit", elapsed)
+	}
+}
+
+func TestNormalizeRSSAutomationScriptValue(t *testing.T) {
+	type payload struct {
+		Name string `json:"name"`
+	}
+	cases := []struct {
+		value any
+		want  any
+	}{
+		{json.Number("42"), int64(42)},
+		{json.Number("1.5"), 1.5},
+		{uint64(1 << 63), float64(1 << 63)},
+		{float32(0.5), 0.5},
+		{time.Date(2026, 1, 2, 3, 4, 5, 0, time.FixedZone("CST", 8*3600)), "2026-01-01T19:04:05Z"},
+		{(*time.Time)(nil), nil},
+		{[]string{"a"}, []any{"a"}},
+		{map[string]string{"k": "v"}, map[string]any{"k": "v"}},
+		{payload{Name: "x"}, map[string]any{"name": "x"}},
+		{map[string]any{"a": []any{json.Number("1"), 2}}, map[string]any{"a": []any{int64(1), int64(2)}}},
+	}
+	for _, testCase := range cases {
+		if got := normalizeRSSAutomationScriptValue(testCase.value); !reflect.DeepEqual(got, testCase.want) {
+			t.Errorf("normalize(%#v) = %#v, want %#v", testCase.value, got, testCase.want)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRSSAutomationScriptNodeComputesDeclaredOutputs(t *testing.T) {
+	runContext := map[string]any{
+		"item": map[string]any{
+			"title": "[喵萌奶茶屋] 葬送的芙莉莲 - 12 [1080p][简日双语]", "category": "Anime",
+			"size": "1.5 GB", "seeders": json.Number("42"), "tags": []any{"1080p", "简日双语", "HEVC"},
+		},
+		"vars":  map[string]any{"quality": "1080p"},
+		"nodes": map[string]any{"wait-qb": map[string]any{"output": map[string]any{"ratio": json.Number("1.25")}}},
+	}
+	node := RSSAutomationNode{ID: "calc", Type: RSSAutomationNodeScript, Config: map[string]any{
+		"script": strings.Join([]string{
+			`size = parse_size(item.size)`,
+			`episode = int(regex_find(item.title, "- (\\d+) ", 1))`,
+			`// 每 GiB 至少 10 个做种才下载`,
+			`healthy = item.seeders >= 10 * size / (1024 * 1024 * 1024)`,
+			`save_path = "/downloads/" + lower(item.category) + "/E" + format_index(episode, 2)`,
+			`tags = filter(item.tags, # != vars.quality)`,
+			`ratio = nodes["wait-qb"].output.ratio ?? 0; missing = item.subtitle ?? "none"`,
+			`healthy and "HEVC" in item.tags ? "keep" : "skip"`,
+		}, "\n"),
+		"outputs": []any{
+			map[string]any{"name": "size", "type": "integer"},
+			map[string]any{"name": "episode", "type": "integer"},
+			map[string]any{"name": "healthy", "type": "boolean"},
+			map[string]any{"name": "save_path", "type": "string"},
+			map[string]any{"name": "tags", "type": "array"},
+			map[string]any{"name": "ratio", "type": "number"},
+			map[string]any{"name": "missing"},
+		},
+	}}
+	if err := validateRSSAutomationNodeConfig(node); err != nil {
+		t.Fatalf("validateRSSAutomationNodeConfig() error = %v", err)
+	}
+	output, err := executeRSSAutomationScriptNode(context.Background(), node, runContext)
+	if err != nil {
+		t.Fatalf("executeRSSAutomationScriptNode() error = %v", err)
+	}
+	if output["selected_port"] != "success" || output["result"] != "keep" {
+		t.Fatalf("unexpected script output: %#v", output)
+	}
+	variables, _ := output["variables"].(map[string]any)
+	expected := map[string]any{
+		"size": int64(1610612736), "episode": int64(12), "healthy": true, "save_path": "/downloads/anime/E12",
+		"ratio": 1.25, "missing": "none",
+	}
+	for name, want := range expected {
+		if variables[name] != want || output[name] != want {
+			t.Errorf("%s = %#v (output %#v), want %#v", name, variables[name], output[name], want)
+		}
+	}
+	if tags, _ := variables["tags"].([]any); len(tags) != 2 || tags[0] != "简日双语" || tags[1] != "HEVC" {
+		t.Errorf("tags = %#v", variables["tags"])
+	}
+	if _, err := json.Marshal(output); err != nil {
+		t.Fatalf("script output is not JSON serializable: %v", err)
+	}
+}
+
+func TestRSSAutomationScriptNodeReturnsFailuresAsErrors(t *testing.T) {
+	cases := map[string]struct {
+		script  string
+		outputs []any
+		reason  string
+	}{
+		"syntax":         {script: `x = (1 +`, reason: "脚本语法错误"},
+		"type mismatch":  {script: `x = item.title * 2`, reason: "invalid operation"},
+		"division":       {script: `x = 1 / (item.count - 3)`, reason: "除数为 0"},
+		"function":       {script: `x = int(item.title)`, reason: `int(): "Example" 不是有效整数`},
+		"unknown root":   {script: `x = itme.title`, reason: "unknown name itme"},
+		"output type":    {script: `x = item.title`, outputs: []any{map[string]any{"name": "x", "type": "integer"}}, reason: "不能转换为 integer"},
+		"nil output":     {script: `x = item.missing`, outputs: []any{map[string]any{"name": "x", "type": "string"}}, reason: "的值为 nil"},
+		"memory":         {script: `x = item.title + item.title`, reason: errRSSAutomationScriptMemory.Error()},
+		"non-boolean if": {script: `x = item.title ? 1 : 2`, reason: "第 1 行"},
+	}
+	runContext := map[string]any{"item": map[string]any{"title": "Example", "count": 3}}
+	for name, testCase := range cases {
+		config := map[string]any{"script": testCase.script, "outputs": testCase.outputs}
+		if name == "memory" {
+			config["max_memory_kb"] = float64(minRSSAutomationScriptMemoryKB)
+			runContext["item"].(map[string]any)["title"] = strings.Repeat("x", 40<<10)
+		}
+		node := RSSAutomationNode{Type: RSSAutomationNodeScript, Config: config}
+		output, err := executeRSSAutomationScriptNode(context.Background(), node, runContext)
+		runContext["item"].(map[string]any)["title"] = "Example"
+		if err == nil || !strings.Contains(err.Error(), testCase.reason) {
+			t.Errorf("%s: error = %v, want %q", name, err, testCase.reason)
+			continue
+		}
+		// 失败出口与 reason 仍写入节点输出
+		if output["selected_port"] != "failure" || output["reason"] != err.Error() {
+			t.Errorf("%s: output = %#v", name, output)
+		}
+	}
+}
+
+func TestRSSAutomationScriptEnforcesResourceLimits(t *testing.T) {
+	runContext := map[string]any{"item": map[string]any{"title": strings.Repeat("x", 1024)}}
+	doubling := "s = item.title" + strings.Repeat("\ns = s + s", 12)
+	program, err := parseRSSAutomationScript(doubling)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := program.run(context.Background(), runContext, rssAutomationScriptLimits{Duration: time.Second, Memory: 1 << 20}); !errors.Is(err, errRSSAutomationScriptMemory) {
+		t.Fatalf("doubling error = %v, want memory limit", err)
+	}
+	if _, _, err := program.run(context.Background(), runContext, rssAutomationScriptLimits{Duration: time.Second, Memory: 16 << 20}); err != nil {
+		t.Fatalf("doubling within a larger limit failed: %v", err)
+	}
+
+	nested, err := parseRSSAutomationScript(`xs = split(item.title, ""); len(map(xs, map(xs, #)))`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := nested.run(context.Background(), runContext, rssAutomationScriptLimits{Duration: time.Minute, Memory: 1 << 20}); !errors.Is(err, errRSSAutomationScriptMemory) {
+		t.Fatalf("nested map error = %v, want memory limit", err)
+	}
+	if _, _, err := nested.run(context.Background(), runContext, rssAutomationScriptLimits{Duration: time.Nanosecond, Memory: 1 << 20}); !errors.Is(err, errRSSAutomationScriptTimeout) {
+		t.Fatalf("nested count error = %v, want timeout", err)
+	}
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, _, err := nested.run(canceled, runContext, rssAutomationScriptLimits{Duration: time.Minute, Memory: 1 << 20}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("nested count error = %v, want context canceled", err)
+	}
+}
+
+func TestValidateRSSAutomationScriptConfig(t *testing.T) {
+	invalid := map[string]map[string]any{
+		"empty":            {"script": "  "},
+		"syntax":           {"script": "x = (1 + 2"},
+		"unknown function": {"script": "x = exec(\"rm -rf /\")"},
+		"arity":            {"script": "x = lower()"},
+		"bad character":    {"script": "x = 1 @ 2"},
+		"unknown variable": {"script": "x = itme.title"},
+		"unassigned":       {"script": "x = 1", "outputs": []any{map[string]any{"name": "y", "type": "integer"}}},
+		"reserved":         {"script": "variables = 1", "outputs": []any{map[string]any{"name": "variables"}}},
+		"duplicated":       {"script": "x = 1", "outputs": []any{map[string]any{"name": "x"}, map[string]any{"name": "x"}}},
+		"bad type":         {"script": "x = 1", "outputs": []any{map[string]any{"name": "x", "type": "datetime"}}},
+		"duration":         {"script": "x = 1", "max_duration_ms": float64(60000)},
+		"memory":           {"script": "x = 1", "max_memory_kb": float64(1)},
+	}
+	for name, config := range invalid {
+		if err := validateRSSAutomationScriptConfig(config); err == nil {
+			t.Errorf("%s: config %#v unexpectedly accepted", name, config)
+		}
+	}
+	valid := map[string]any{
+		"script":          "first = item?.tags?.[0] ?? \"\"\nflag = not (first in [\"a\", \"b\"]) && {k: 1}.k == 1\nitem.and",
+		"outputs":         []any{map[string]any{"name": "first", "type": "string"}, map[string]any{"name": "flag", "type": "boolean"}},
+		"max_duration_ms": float64(500), "max_memory_kb": float64(256),
+	}
+	if err := validateRSSAutomationScriptConfig(valid); err != nil {
+		t.Fatalf("valid config rejected: %v", err)
+	}
+}
@@ -36,6 +36,7 @@ var rssAutomationQBAPIKeyPattern = regexp.MustCompile(`^qbt_[A-Za-z0-9]{28}$`)
 
 type RSSAutomationSourceInput struct {
 	Name            string               `json:"name"`
+	Type            string               `json:"type"`
 	Enabled         bool                 `json:"enabled"`
 	FeedURL         string               `json:"feed_url"`
 	IntervalMinutes int                  `json:"interval_minutes"`
@@ -103,16 +104,17 @@ type RSSAutomationRefreshResult struct {
 }
 
 type RSSAutomationDashboard struct {
-	Sources       []model.RSSAutomationSource   `json:"sources"`
-	Workflows     []model.RSSAutomationWorkflow `json:"workflows"`
-	Targets       []model.RSSAutomationTarget   `json:"targets"`
-	RecentRuns    []model.RSSAutomationRun      `json:"recent_runs"`
-	TotalEntries  int64                         `json:"total_entries"`
-	PendingNodes  int64                         `json:"pending_nodes"`
-	RunningNodes  int64                         `json:"running_nodes"`
-	FailedRuns    int64                         `json:"failed_runs"`
-	SourceRunning bool                          `json:"source_running"`
-	NodeProtocols []RSSAutomationNodeProtocol   `json:"node_protocols"`
+	Sources       []model.RSSAutomationSource      `json:"sources"`
+	Workflows     []model.RSSAutomationWorkflow    `json:"workflows"`
+	SubWorkflows  []model.RSSAutomationSubWorkflow `json:"sub_workflows"`
+	Targets       []model.RSSAutomationTarget      `json:"targets"`
+	RecentRuns    []model.RSSAutomationRun         `json:"recent_runs"`
+	TotalEntries  int64                            `json:"total_entries"`
+	PendingNodes  int64                            `json:"pending_nodes"`
+	RunningNodes  int64                            `json:"running_nodes"`
+	FailedRuns    int64                            `json:"failed_runs"`
+	SourceRunning bool                             `json:"source_running"`
+	NodeProtocols []RSSAutomationNodeProtocol      `json:"node_protocols"`
 }
 
 type RSSAutomationService struct {
@@ -184,9 +186,10 @@ func (s *RSSAutomationService) Start() {
 	s.db.Model(&model.RSSAutomationRun{}).
 		Where("status = ?", model.RSSAutomationRunRunning).
 		Update("status", model.RSSAutomationRunPending)
-	s.wg.Add(2)
+	s.wg.Add(3)
 	go s.sourceScheduleLoop()
 	go s.executionScheduleLoop()
+	go s.triggerScheduleLoop()
 	if s.log != nil {
 		s.log.Info("RSS 自动化调度器已启动")
 	}
@@ -229,7 +232,8 @@ func (s *RSSAutomationService) Dashboard(limit int) (RSSAutomationDashboard, err
 	}
 	dashboard := RSSAutomationDashboard{
 		Sources: []model.RSSAutomationSource{}, Workflows: []model.RSSAutomationWorkflow{},
-		Targets: []model.RSSAutomationTarget{}, RecentRuns: []model.RSSAutomationRun{},
+		SubWorkflows: []model.RSSAutomationSubWorkflow{},
+		Targets:      []model.RSSAutomationTarget{}, RecentRuns: []model.RSSAutomationRun{},
 		NodeProtocols: RSSAutomationNodeProtocols(),
 	}
 	if err := s.db.Order("id ASC").Find(&dashboard.Sources).Error; err != nil {
@@ -238,6 +242,9 @@ func (s *RSSAutomationService) Dashboard(limit int) (RSSAutomationDashboard, err
 	if err := s.db.Order("id ASC").Find(&dashboard.Workflows).Error; err != nil {
 		return dashboard, err
 	}
+	if err := s.db.Order("id ASC").Find(&dashboard.SubWorkflows).Error; err != nil {
+		return dashboard, err
+	}
 	if err := s.db.Order("id ASC").Find(&dashboard.Targets).Error; err != nil {
 		return dashboard, err
 	}
@@ -245,7 +252,7 @@ func (s *RSSAutomationService) Dashboard(limit int) (RSSAutomationDashboard, err
 	if err := s.db.Order("id DESC").Limit(limit).Find(&dashboard.RecentRuns).Error; err != nil {
 		return dashboard, err
 	}
-	s.db.Model(&model.RSSAutomationEntry{}).Count(&dashboard.TotalEntries)
+	s.db.Model(&model.RSSAutomationEntry{}).Where("trigger_type = ?", "").Count(&dashboard.TotalEntries)
 	s.db.Model(&model.RSSAutomationNodeRun{}).Where("status = ?", model.RSSAutomationNodePending).Count(&dashboard.PendingNodes)
 	s.db.Model(&model.RSSAutomationNodeRun{}).Where("status = ?", model.RSSAutomationNodeRunning).Count(&dashboard.RunningNodes)
 	s.db.Model(&model.RSSAutomationRun{}).Where("status IN ?", []string{model.RSSAutomationRunFailed, model.RSSAutomationRunPartial}).Count(&dashboard.FailedRuns)
@@ -268,10 +275,13 @@ func (s *RSSAutomationService) CreateAutomation(input RSSAutomationCreateInput)
 	if err != nil {
 		return result, err
 	}
+	if _, _, err := s.expandRSSAutomationSubWorkflows(input.Workflow.Definition, nil); err != nil {
+		return result, err
+	}
 	enabled := input.Workflow.Enabled
 	err = s.db.Transaction(func(tx *gorm.DB) error {
 		result.Source = model.RSSAutomationSource{
-			Name: sourceInput.Name, Enabled: enabled, FeedURL: sourceInput.FeedURL,
+			Name: sourceInput.Name, Type: sourceInput.Type, Enabled: enabled, FeedURL: sourceInput.FeedURL,
 			IntervalMinutes: sourceInput.IntervalMinutes, MappingJSON: mappingJSON,
 		}
 		if err := tx.Create(&result.Source).Error; err != nil {
@@ -303,10 +313,10 @@ func (s *RSSAutomationService) UpdateSource(id uint, input RSSAutomationSourceIn
 		return source, err
 	}
 	updates := map[string]any{
-		"name": input.Name, "enabled": input.Enabled, "feed_url": input.FeedURL,
+		"name": input.Name, "type": input.Type, "enabled": input.Enabled, "feed_url": input.FeedURL,
 		"interval_minutes": input.IntervalMinutes, "mapping_json": mappingJSON,
 	}
-	if source.FeedURL != input.FeedURL || source.MappingJSON != mappingJSON {
+	if source.FeedURL != input.FeedURL || source.MappingJSON != mappingJSON || NormalizeRSSAutomationSourceType(source.Type) != input.Type {
 		updates["initialized"] = false
 		updates["etag"] = ""
 		updates["last_modified"] = ""
@@ -480,6 +490,21 @@ func (s *RSSAutomationService) DeleteTarget(id uint) error {
 			}
 		}
 	}
+	var subWorkflows []model.RSSAutomationSubWorkflow
+	if err := s.db.Select("id", "name", "definition_json").Find(&subWorkflows).Error; err != nil {
+		return err
+	}
+	for _, subWorkflow := range subWorkflows {
+		definition, err := ParseRSSAutomationDefinition(subWorkflow.DefinitionJSON)
+		if err != nil {
+			continue
+		}
+		for _, node := range definition.Nodes {
+			if node.Type == RSSAutomationNodeQBittorrent && rssAutomationConfigUint(node.Config, "target_id") == id {
+				return fmt.Errorf("下载目标正在被子流程 %q 使用，请先修改子流程", subWorkflow.Name)
+			}
+		}
+	}
 	result := s.db.Delete(&model.RSSAutomationTarget{}, id)
 	if result.Error != nil {
 		return result.Error
@@ -499,7 +524,7 @@ func (s *RSSAutomationService) SampleSource(ctx context.Context, input RSSAutoma
 	if err != nil {
 		return RSSAutomationParsedFeed{}, errors.New("创建 RSS 请求失败")
 	}
-	s.setRSSAutomationRequestHeaders(req)
+	s.setRSSAutomationRequestHeaders(req, input.Type)
 	resp, err := s.httpClient.Do(req)
 	if err != nil {
 		return RSSAutomationParsedFeed{}, fmt.Errorf("请求 RSS 源失败: %w", err)
@@ -508,7 +533,7 @@ func (s *RSSAutomationService) SampleSource(ctx context.Context, input RSSAutoma
 	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		return RSSAutomationParsedFeed{}, fmt.Errorf("RSS 源返回 HTTP %d", resp.StatusCode)
 	}
-	return ParseRSSAutomationFeed(resp.Body, input.Mapping, rssAutomationSampleLimit)
+	return ParseRSSAutomationSourceFeed(resp.Body, input.Type, input.FeedURL, input.Mapping, rssAutomationSampleLimit)
 }
 
 func (s *RSSAutomationService) Refresh(ctx context.Context, sourceID uint) (RSSAutomationRefreshResult, error) {
@@ -568,7 +593,7 @@ func (s *RSSAutomationService) refreshAutomationSource(ctx context.Context, sour
 	if err != nil {
 		return result, err
 	}
-	s.setRSSAutomationRequestHeaders(req)
+	s.setRSSAutomationRequestHeaders(req, source.Type)
 	if source.Initialized && source.ETag != "" {
 		req.Header.Set("If-None-Match", source.ETag)
 	}
@@ -591,7 +616,7 @@ func (s *RSSAutomationService) refreshAutomationSource(ctx context.Context, sour
 			s.recordRSSAutomationSourceFailure(source.ID, requestErr)
 			return result, requestErr
 		}
-		s.setRSSAutomationRequestHeaders(fallbackReq)
+		s.setRSSAutomationRequestHeaders(fallbackReq, source.Type)
 		resp, err = s.httpClient.Do(fallbackReq)
 		if err != nil {
 			s.recordRSSAutomationSourceFailure(source.ID, err)
@@ -611,7 +636,7 @@ func (s *RSSAutomationService) refreshAutomationSource(ctx context.Context, sour
 		s.recordRSSAutomationSourceFailure(source.ID, err)
 		return result, err
 	}
-	feed, err := ParseRSSAutomationFeed(io.LimitReader(resp.Body, maxRSSAutomationBodyBytes+1), mapping, 0)
+	feed, err := ParseRSSAutomationSourceFeed(io.LimitReader(resp.Body, maxRSSAutomationBodyBytes+1), source.Type, source.FeedURL, mapping, 0)
 	if err != nil {
 		s.recordRSSAutomationSourceFailure(source.ID, err)
 		return result, err
@@ -683,6 +708,9 @@ func (s *RSSAutomationService) createRSSAutomationRuns(entry model.RSSAutomation
 	}
 	created := 0
 	for _, workflow := range workflows {
+		if rssAutomationWorkflowTrigger(workflow).Mode != RSSAutomationTriggerFeed {
+			continue
+		}
 		_, runCreated, err := s.createRSSAutomationRun(workflow, entry, false)
 		if err != nil {
 			return created, err
@@ -703,20 +731,35 @@ func (s *RSSAutomationService) createRSSAutomationRun(workflow model.RSSAutomati
 	if !validation.Valid {
 		return model.RSSAutomationRun{}, false, fmt.Errorf("流程 %s 无效: %s", workflow.Name, strings.Join(validation.Errors, "; "))
 	}
+	definitionJSON := workflow.DefinitionJSON
+	expanded, hasCalls, err := s.expandRSSAutomationSubWorkflows(definition, nil)
+	if err != nil {
+		return model.RSSAutomationRun{}, false, fmt.Errorf("流程 %s 展开子流程失败: %w", workflow.Name, err)
+	}
+	if hasCalls {
+		definition = expanded
+		if definitionJSON, err = MarshalRSSAutomationDefinition(expanded); err != nil {
+			return model.RSSAutomationRun{}, false, err
+		}
+	}
 	var fields map[string]any
 	decoder := json.NewDecoder(strings.NewReader(entry.FieldsJSON))
 	decoder.UseNumber()
 	if err := decoder.Decode(&fields); err != nil {
 		return model.RSSAutomationRun{}, false, err
 	}
-	contextJSON, _ := json.Marshal(map[string]any{
+	runContext := map[string]any{
 		"item": fields, "vars": map[string]any{}, "nodes": map[string]any{},
 		"entry_id": entry.ID, "source_id": entry.SourceID,
-	})
+	}
+	if entry.TriggerType != "" {
+		runContext["trigger"] = map[string]any{"type": entry.TriggerType, "fired_at": entry.DiscoveredAt.UTC().Format(time.RFC3339)}
+	}
+	contextJSON, _ := json.Marshal(runContext)
 	now := time.Now()
 	run := model.RSSAutomationRun{
 		WorkflowID: workflow.ID, WorkflowName: workflow.Name, WorkflowVersion: workflow.Version,
-		EntryID: entry.ID, DefinitionJSON: workflow.DefinitionJSON, ContextJSON: string(contextJSON),
+		EntryID: entry.ID, DefinitionJSON: definitionJSON, ContextJSON: string(contextJSON),
 		Status: model.RSSAutomationRunPending, StartedAt: &now,
 	}
 	created := false
@@ -779,6 +822,9 @@ func (s *RSSAutomationService) validateWorkflowInput(input RSSAutomationWorkflow
 	if count == 0 {
 		return input, "", validation, errors.New("选择的 RSS 自动化源不存在")
 	}
+	if _, _, err := s.expandRSSAutomationSubWorkflows(input.Definition, nil); err != nil {
+		return input, "", validation, err
+	}
 	return input, definitionJSON, validation, nil
 }
 
@@ -799,10 +845,16 @@ func validateRSSAutomationWorkflowContent(name, description string, definition R
 
 func validateRSSAutomationSourceInput(input RSSAutomationSourceInput) (RSSAutomationSourceInput, string, error) {
 	input.Name = strings.TrimSpace(input.Name)
+	input.Type = NormalizeRSSAutomationSourceType(input.Type)
 	input.FeedURL = strings.TrimSpace(input.FeedURL)
 	if input.Name == "" || len([]rune(input.Name)) > maxRSSAutomationNameLength {
 		return input, "", errors.New("源名称不能为空且不能超过 120 个字符")
 	}
+	switch input.Type {
+	case model.RSSAutomationSourceRSS, model.RSSAutomationSourceJSON, model.RSSAutomationSourceHTML:
+	default:
+		return input, "", fmt.Errorf("不支持的源类型 %q", input.Type)
+	}
 	parsed, err := url.ParseRequestURI(input.FeedURL)
 	if err != nil || parsed.Host == "" || (parsed.Scheme != "http" && parsed.Scheme != "https") {
 		return input, "", errors.New("RSS 地址必须是有效的 HTTP 或 HTTPS URL")
@@ -811,9 +863,12 @@ func validateRSSAutomationSourceInput(input RSSAutomationSourceInput) (RSSAutoma
 		return input, "", errors.New("刷新间隔必须在 1 到 1440 分钟之间")
 	}
 	if input.Mapping.ItemSelector == "" && len(input.Mapping.Fields) == 0 {
+		if input.Type != model.RSSAutomationSourceRSS {
+			return input, "", errors.New("JSON / HTML 源需要配置条目选择器与字段映射")
+		}
 		input.Mapping = DefaultRSSAutomationMapping()
 	}
-	if err := ValidateRSSAutomationMapping(input.Mapping); err != nil {
+	if err := ValidateRSSAutomationSourceMapping(input.Type, input.Mapping); err != nil {
 		return input, "", err
 	}
 	mappingJSON, err := json.Marshal(input.Mapping)
@@ -829,9 +884,13 @@ func validateRSSAutomationTargetInput(input RSSAutomationTargetInput, oldConfigJ
 	if input.Name == "" || len([]rune(input.Name)) > maxRSSAutomationNameLength {
 		return input, "", errors.New("目标名称不能为空且不能超过 120 个字符")
 	}
-	if input.Type != model.RSSAutomationTargetQBittorrent {
+	if !isRSSAutomationTargetType(input.Type) {
 		return input, "", fmt.Errorf("暂不支持目标类型 %q", input.Type)
 	}
+	if input.Type != model.RSSAutomationTargetQBittorrent {
+		configJSON, err := validateRSSAutomationDownloaderConfig(input, oldConfigJSON)
+		return input, configJSON, err
+	}
 	encoded, err := json.Marshal(input.Config)
 	if err != nil {
 		return input, "", err
@@ -876,18 +935,17 @@ func redactRSSAutomationTargets(targets []model.RSSAutomationTarget) {
 }
 
 func redactRSSAutomationTarget(target *model.RSSAutomationTarget) {
-	if target == nil || target.Type != model.RSSAutomationTargetQBittorrent {
+	if target == nil || !isRSSAutomationTargetType(target.Type) {
 		return
 	}
-	var config RSSAutomationQBittorrentConfig
+	var config map[string]any
 	if json.Unmarshal([]byte(target.ConfigJSON), &config) != nil {
 		return
 	}
-	if config.Password != "" {
-		config.Password = rssAutomationSecretMask
-	}
-	if config.APIKey != "" {
-		config.APIKey = rssAutomationSecretMask
+	for _, key := range []string{"password", "api_key"} {
+		if value, _ := config[key].(string); value != "" {
+			config[key] = rssAutomationSecretMask
+		}
 	}
 	encoded, _ := json.Marshal(config)
 	target.ConfigJSON = string(encoded)
@@ -900,8 +958,15 @@ func (s *RSSAutomationService) recordRSSAutomationSourceFailure(sourceID uint, r
 	})
 }
 
-func (s *RSSAutomationService) setRSSAutomationRequestHeaders(req *http.Request) {
-	req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml, text/xml;q=0.9, */*;q=0.5")
+func (s *RSSAutomationService) setRSSAutomationRequestHeaders(req *http.Request, sourceType string) {
+	switch NormalizeRSSAutomationSourceType(sourceType) {
+	case model.RSSAutomationSourceJSON:
+		req.Header.Set("Accept", "application/json, text/json;q=0.9, */*;q=0.5")
+	case model.RSSAutomationSourceHTML:
+		req.Header.Set("Accept", "text/html, application/xhtml+xml;q=0.9, */*;q=0.5")
+	default:
+		req.Header.Set("Accept", "application/rss+xml, application/atom+xml, application/xml, text/xml;q=0.9, */*;q=0.5")
+	}
 	req.Header.Set("User-Agent", s.rssAutomationUserAgent())
 }
 
@@ -950,7 +1015,11 @@ func (s *RSSAutomationService) refreshDueRSSAutomationSources() {
 		return
 	}
 	now := time.Now()
+	skipped := s.nonFeedRSSAutomationSourceIDs()
 	for _, source := range sources {
+		if _, ok := skipped[source.ID]; ok {
+			continue
+		}
 		minutes := source.IntervalMinutes
 		if minutes <= 0 {
 			minutes = defaultRSSAutomationIntervalMinutes
@@ -977,7 +1046,7 @@ func isRSSAutomationActionNode(nodeType string) bool {
 		RSSAutomationNodeHDHiveQuery, RSSAutomationNodeHDHiveUnlock,
 		RSSAutomationNodeMoviePilotRecognize, RSSAutomationNodeOrganizeStrm,
 		RSSAutomationNodeStrmVerify, RSSAutomationNodeStrmRegenerate, RSSAutomationNodeEmbyRefreshWait,
-		RSSAutomationNodeHTTPRequest, RSSAutomationNodeNotification:
+		RSSAutomationNodeHTTPRequest, RSSAutomationNodeNotification, RSSAutomationNodeCallWorkflow:
 		return true
 	default:
 		return false
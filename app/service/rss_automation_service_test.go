@@ -170,6 +170,71 @@ func TestRefreshRSSAutomationSourceDoesNotQueueMalformedItems(t *testing.T) {
 	}
 }
 
+func TestRefreshJSONRSSAutomationSourceUsesEntryLedger(t *testing.T) {
+	body := `{"items": [{"id": "a1", "name": "条目一", "url": "magnet:?xt=urn:btih:AAA"}, {"id": "a2", "name": "条目二"}]}`
+	var accept string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, request *http.Request) {
+		accept = request.Header.Get("Accept")
+		w.Header().Set("Content-Type", "application/json")
+		_, _ = w.Write([]byte(body))
+	}))
+	defer server.Close()
+
+	db := newRSSAutomationTestDB(t)
+	automation := &RSSAutomationService{
+		db: db, httpClient: &http.Client{Timeout: time.Second},
+		sourceWake: make(chan struct{}, 1), executionWake: make(chan struct{}, 1),
+	}
+	created, err := automation.CreateAutomation(RSSAutomationCreateInput{
+		Source: RSSAutomationSourceInput{
+			Name: "JSON 接口", Type: "JSON", Enabled: true, FeedURL: server.URL, IntervalMinutes: 5,
+			Mapping: RSSAutomationMapping{ItemSelector: "$.items", Fields: []RSSAutomationFieldMapping{
+				{Name: "guid", Selector: "id"},
+				{Name: "title", Selector: "name", Required: true},
+				{Name: "download_url", Selector: "url"},
+			}},
+		},
+		Workflow: RSSAutomationCreateWorkflowInput{Name: "JSON 流程", Enabled: true, Definition: DefaultRSSAutomationDefinition()},
+	})
+	if err != nil {
+		t.Fatalf("CreateAutomation() error = %v", err)
+	}
+	if created.Source.Type != model.RSSAutomationSourceJSON {
+		t.Fatalf("source type = %q", created.Source.Type)
+	}
+
+	for round, wantNew := range []int{2, 0} {
+		result, err := automation.refreshAutomationSource(context.Background(), created.Source)
+		if err != nil {
+			t.Fatalf("round %d: refreshAutomationSource() error = %v", round, err)
+		}
+		if result.Fetched != 2 || result.NewEntries != wantNew {
+			t.Fatalf("round %d: unexpected refresh result: %#v", round, result)
+		}
+		if err := db.First(&created.Source, created.Source.ID).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !strings.HasPrefix(accept, "application/json") {
+		t.Fatalf("Accept = %q", accept)
+	}
+	var entries []model.RSSAutomationEntry
+	if err := db.Order("id ASC").Find(&entries).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || entries[0].GUID != "a1" || entries[0].ContentKey != "btih:aaa" {
+		t.Fatalf("unexpected entries: %#v", entries)
+	}
+
+	_, err = automation.CreateAutomation(RSSAutomationCreateInput{
+		Source:   RSSAutomationSourceInput{Name: "HTML 页面", Type: "html", FeedURL: server.URL, IntervalMinutes: 5},
+		Workflow: RSSAutomationCreateWorkflowInput{Name: "HTML 流程", Definition: DefaultRSSAutomationDefinition()},
+	})
+	if err == nil {
+		t.Fatal("HTML source without mapping unexpectedly created")
+	}
+}
+
 func TestCreateRSSAutomationCreatesSourceAndWorkflowAtomically(t *testing.T) {
 	db := newRSSAutomationTestDB(t)
 	automation := &RSSAutomationService{
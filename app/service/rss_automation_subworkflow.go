@@ -0,0 +1,479 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"film-fusion/app/model"
+
+	"gorm.io/gorm"
+)
+
+// 子流程是可被多个源流程复用的流程片段：
+//   - 子流程的触发器 config.inputs 声明参数名，子流程内通过 $inputs.* 引用
+//   - 子流程的结束节点 config.outputs 把子流程内的值映射为输出
+//   - 源流程中的 call_workflow 节点通过 sub_workflow_id 调用子流程，config.inputs 传入参数
+//
+// 创建运行时 call_workflow 会按子流程当前版本展开进运行的 DefinitionJSON 快照：
+// 子流程节点 ID 加上 "<调用节点 ID>/" 前缀，触发器换成参数节点，结束节点换成输出节点，
+// 调用节点本身保留原 ID 作为汇总节点，因此源流程中的 $nodes.<调用节点>.output.* 引用保持不变。
+// 子流程节点只能看到本作用域内的节点与变量，子流程产生的变量不会写回调用方的 $vars。
+const (
+	rssAutomationNodeSubWorkflowInput  = "subworkflow_input"
+	rssAutomationNodeSubWorkflowOutput = "subworkflow_output"
+
+	maxRSSAutomationSubWorkflowDepth   = 4
+	maxRSSAutomationExpandedNodes      = 1000
+	maxRSSAutomationExpandedNodeIDSize = 80
+	maxRSSAutomationSubWorkflowFields  = 32
+)
+
+type RSSAutomationSubWorkflowInput struct {
+	Name        string                  `json:"name"`
+	Description string                  `json:"description"`
+	Definition  RSSAutomationDefinition `json:"definition"`
+}
+
+func (s *RSSAutomationService) ListSubWorkflows() ([]model.RSSAutomationSubWorkflow, error) {
+	subWorkflows := make([]model.RSSAutomationSubWorkflow, 0)
+	if err := s.db.Order("id ASC").Find(&subWorkflows).Error; err != nil {
+		return subWorkflows, err
+	}
+	return subWorkflows, nil
+}
+
+func (s *RSSAutomationService) CreateSubWorkflow(input RSSAutomationSubWorkflowInput) (model.RSSAutomationSubWorkflow, RSSAutomationValidationResult, error) {
+	input, definitionJSON, validation, err := s.validateSubWorkflowInput(0, input)
+	if err != nil {
+		return model.RSSAutomationSubWorkflow{}, validation, err
+	}
+	subWorkflow := model.RSSAutomationSubWorkflow{
+		Name: input.Name, Description: input.Description, Version: 1, DefinitionJSON: definitionJSON,
+	}
+	if err := s.db.Create(&subWorkflow).Error; err != nil {
+		return subWorkflow, validation, err
+	}
+	return subWorkflow, validation, nil
+}
+
+func (s *RSSAutomationService) UpdateSubWorkflow(id uint, input RSSAutomationSubWorkflowInput) (model.RSSAutomationSubWorkflow, RSSAutomationValidationResult, error) {
+	var subWorkflow model.RSSAutomationSubWorkflow
+	if err := s.db.First(&subWorkflow, id).Error; err != nil {
+		return subWorkflow, RSSAutomationValidationResult{}, err
+	}
+	input, definitionJSON, validation, err := s.validateSubWorkflowInput(id, input)
+	if err != nil {
+		return subWorkflow, validation, err
+	}
+	version := subWorkflow.Version
+	if subWorkflow.DefinitionJSON != definitionJSON {
+		version++
+	}
+	if err := s.db.Model(&subWorkflow).Updates(map[string]any{
+		"name": input.Name, "description": input.Description, "version": version, "definition_json": definitionJSON,
+	}).Error; err != nil {
+		return subWorkflow, validation, err
+	}
+	if err := s.db.First(&subWorkflow, id).Error; err != nil {
+		return subWorkflow, validation, err
+	}
+	return subWorkflow, validation, nil
+}
+
+// DeleteSubWorkflow 删除未被任何流程或子流程调用的子流程；已展开进运行快照的调用不受影响
+func (s *RSSAutomationService) DeleteSubWorkflow(id uint) error {
+	var workflows []model.RSSAutomationWorkflow
+	if err := s.db.Select("id", "name", "definition_json").Find(&workflows).Error; err != nil {
+		return err
+	}
+	for _, workflow := range workflows {
+		if rssAutomationDefinitionCalls(workflow.DefinitionJSON, id) {
+			return fmt.Errorf("子流程正在被流程 %q 调用，请先修改流程", workflow.Name)
+		}
+	}
+	var subWorkflows []model.RSSAutomationSubWorkflow
+	if err := s.db.Select("id", "name", "definition_json").Where("id <> ?", id).Find(&subWorkflows).Error; err != nil {
+		return err
+	}
+	for _, subWorkflow := range subWorkflows {
+		if rssAutomationDefinitionCalls(subWorkflow.DefinitionJSON, id) {
+			return fmt.Errorf("子流程正在被子流程 %q 调用，请先修改子流程", subWorkflow.Name)
+		}
+	}
+	result := s.db.Delete(&model.RSSAutomationSubWorkflow{}, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+func rssAutomationDefinitionCalls(definitionJSON string, subWorkflowID uint) bool {
+	definition, err := ParseRSSAutomationDefinition(definitionJSON)
+	if err != nil {
+		return false
+	}
+	for _, node := range definition.Nodes {
+		if node.Type == RSSAutomationNodeCallWorkflow && rssAutomationConfigUint(node.Config, "sub_workflow_id") == subWorkflowID {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *RSSAutomationService) validateSubWorkflowInput(id uint, input RSSAutomationSubWorkflowInput) (RSSAutomationSubWorkflowInput, string, RSSAutomationValidationResult, error) {
+	name, description, definitionJSON, validation, err := validateRSSAutomationWorkflowContent(input.Name, input.Description, input.Definition)
+	input.Name = name
+	input.Description = description
+	if err != nil {
+		return input, "", validation, err
+	}
+	definition, err := ParseRSSAutomationDefinition(definitionJSON)
+	if err != nil {
+		return input, "", validation, err
+	}
+	if err := validateRSSAutomationSubWorkflowInterface(definition); err != nil {
+		validation.Valid = false
+		validation.Errors = append(validation.Errors, err.Error())
+		return input, "", validation, err
+	}
+	var duplicated int64
+	if err := s.db.Model(&model.RSSAutomationSubWorkflow{}).Where("name = ? AND id <> ?", input.Name, id).Count(&duplicated).Error; err != nil {
+		return input, "", validation, err
+	}
+	if duplicated > 0 {
+		return input, "", validation, fmt.Errorf("子流程名称 %q 已存在", input.Name)
+	}
+	// 以待保存的定义替换自身后试展开一次，覆盖引用不存在、循环调用与嵌套过深
+	self := &model.RSSAutomationSubWorkflow{ID: id, Name: input.Name, DefinitionJSON: definitionJSON}
+	if _, _, err := s.expandRSSAutomationSubWorkflows(definition, self); err != nil {
+		return input, "", validation, err
+	}
+	return input, definitionJSON, validation, nil
+}
+
+// validateRSSAutomationSubWorkflowInterface 校验子流程触发器声明的参数与结束节点的输出映射
+func validateRSSAutomationSubWorkflowInterface(definition RSSAutomationDefinition) error {
+	for _, node := range definition.Nodes {
+		switch node.Type {
+		case RSSAutomationNodeTrigger:
+			if mode := readRSSAutomationTriggerSettings(node.Config).Mode; mode != RSSAutomationTriggerFeed {
+				return fmt.Errorf("子流程的触发器只能由 call_workflow 调用，不能使用 %s 触发", mode)
+			}
+			names := rssAutomationConfigTextSlice(node.Config, "inputs")
+			if len(names) > maxRSSAutomationSubWorkflowFields {
+				return fmt.Errorf("子流程参数不能超过 %d 个", maxRSSAutomationSubWorkflowFields)
+			}
+			seen := make(map[string]struct{}, len(names))
+			for _, name := range names {
+				if !rssAutomationScriptNamePattern.MatchString(name) {
+					return fmt.Errorf("子流程参数名 %q 只能包含字母、数字和下划线，且不能以数字开头", name)
+				}
+				if _, exists := seen[name]; exists {
+					return fmt.Errorf("子流程参数 %s 重复", name)
+				}
+				seen[name] = struct{}{}
+			}
+		case RSSAutomationNodeEnd:
+			if _, err := rssAutomationSubWorkflowMapping(node.Config, "outputs", "子流程输出"); err != nil {
+				return fmt.Errorf("结束节点 %s: %w", node.ID, err)
+			}
+		}
+	}
+	return nil
+}
+
+func validateRSSAutomationCallWorkflowConfig(config map[string]any) error {
+	if rssAutomationConfigUint(config, "sub_workflow_id") == 0 {
+		return errors.New("必须选择要调用的子流程")
+	}
+	_, err := rssAutomationSubWorkflowMapping(config, "inputs", "子流程参数")
+	return err
+}
+
+// rssAutomationSubWorkflowMapping 读取 名称 -> 变量引用或模板 的映射，例如 {"title": "$item.title"}
+func rssAutomationSubWorkflowMapping(config map[string]any, key, subject string) (map[string]any, error) {
+	raw, exists := config[key]
+	if !exists || raw == nil {
+		return map[string]any{}, nil
+	}
+	mapping, ok := raw.(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("%s必须是对象", subject)
+	}
+	if len(mapping) > maxRSSAutomationSubWorkflowFields {
+		return nil, fmt.Errorf("%s不能超过 %d 个", subject, maxRSSAutomationSubWorkflowFields)
+	}
+	for name := range mapping {
+		if !rssAutomationScriptNamePattern.MatchString(name) {
+			return nil, fmt.Errorf("%s名 %q 只能包含字母、数字和下划线，且不能以数字开头", subject, name)
+		}
+	}
+	return mapping, nil
+}
+
+// expandRSSAutomationSubWorkflows 把定义中的 call_workflow 递归展开为子流程节点。
+// self 非空时表示正在保存的子流程，展开时以它代替数据库中的同 ID 记录。
+func (s *RSSAutomationService) expandRSSAutomationSubWorkflows(definition RSSAutomationDefinition, self *model.RSSAutomationSubWorkflow) (RSSAutomationDefinition, bool, error) {
+	hasCall := false
+	for _, node := range definition.Nodes {
+		if node.Type == RSSAutomationNodeCallWorkflow {
+			hasCall = true
+			break
+		}
+	}
+	if !hasCall {
+		return definition, false, nil
+	}
+	expander := &rssAutomationSubWorkflowExpander{db: s.db, self: self, loaded: map[uint]rssAutomationLoadedSubWorkflow{}}
+	var stack []uint
+	if self != nil && self.ID > 0 {
+		stack = append(stack, self.ID)
+	}
+	if err := expander.expand(definition, "", nil, stack); err != nil {
+		return definition, true, err
+	}
+	expanded := definition
+	expanded.Nodes = expander.nodes
+	expanded.Edges = expander.edges
+	return expanded, true, nil
+}
+
+type rssAutomationLoadedSubWorkflow struct {
+	record     model.RSSAutomationSubWorkflow
+	definition RSSAutomationDefinition
+}
+
+type rssAutomationSubWorkflowExpander struct {
+	db     *gorm.DB
+	self   *model.RSSAutomationSubWorkflow
+	loaded map[uint]rssAutomationLoadedSubWorkflow
+	nodes  []RSSAutomationNode
+	edges  []RSSAutomationEdge
+}
+
+func (e *rssAutomationSubWorkflowExpander) load(id uint) (rssAutomationLoadedSubWorkflow, error) {
+	if loaded, exists := e.loaded[id]; exists {
+		return loaded, nil
+	}
+	var record model.RSSAutomationSubWorkflow
+	if e.self != nil && e.self.ID == id {
+		record = *e.self
+	} else if err := e.db.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return rssAutomationLoadedSubWorkflow{}, fmt.Errorf("子流程 %d 不存在", id)
+		}
+		return rssAutomationLoadedSubWorkflow{}, err
+	}
+	definition, err := ParseRSSAutomationDefinition(record.DefinitionJSON)
+	if err != nil {
+		return rssAutomationLoadedSubWorkflow{}, fmt.Errorf("子流程 %s: %w", record.Name, err)
+	}
+	if validation := ValidateRSSAutomationDefinition(definition); !validation.Valid {
+		return rssAutomationLoadedSubWorkflow{}, fmt.Errorf("子流程 %s 无效: %s", record.Name, strings.Join(validation.Errors, "; "))
+	}
+	loaded := rssAutomationLoadedSubWorkflow{record: record, definition: definition}
+	e.loaded[id] = loaded
+	return loaded, nil
+}
+
+// expand 展开 prefix 作用域内的定义；call 非空时 definition 是被 call 调用的子流程
+func (e *rssAutomationSubWorkflowExpander) expand(definition RSSAutomationDefinition, prefix string, call *RSSAutomationNode, stack []uint) error {
+	entries := make(map[string]string)
+	for _, node := range definition.Nodes {
+		id := prefix + node.ID
+		if len(id) > maxRSSAutomationExpandedNodeIDSize {
+			return fmt.Errorf("展开子流程后节点 ID %s 超过 %d 个字符，请缩短调用节点 ID", id, maxRSSAutomationExpandedNodeIDSize)
+		}
+		if len(e.nodes) >= maxRSSAutomationExpandedNodes {
+			return fmt.Errorf("展开子流程后节点数超过 %d 个", maxRSSAutomationExpandedNodes)
+		}
+		expanded := node
+		expanded.ID = id
+		switch {
+		case node.Type == RSSAutomationNodeCallWorkflow:
+			entry, err := e.expandCall(node, id, stack)
+			if err != nil {
+				return err
+			}
+			entries[node.ID] = entry
+			continue
+		case call != nil && node.Type == RSSAutomationNodeTrigger:
+			expanded.Type = rssAutomationNodeSubWorkflowInput
+			expanded.Config = map[string]any{
+				"inputs": call.Config["inputs"], "declared": rssAutomationConfigTextSlice(node.Config, "inputs"),
+			}
+		case call != nil && node.Type == RSSAutomationNodeEnd:
+			expanded.Type = rssAutomationNodeSubWorkflowOutput
+			expanded.Config = map[string]any{"outputs": node.Config["outputs"]}
+			exitID := strings.TrimSuffix(prefix, "/")
+			e.edges = append(e.edges, RSSAutomationEdge{ID: id + "/return", Source: id, SourcePort: "next", Target: exitID})
+		}
+		e.nodes = append(e.nodes, expanded)
+	}
+	for _, edge := range definition.Edges {
+		expanded := edge
+		if edge.ID != "" {
+			expanded.ID = prefix + edge.ID
+		}
+		expanded.Source = prefix + edge.Source
+		expanded.Target = prefix + edge.Target
+		if entry, exists := entries[edge.Target]; exists {
+			expanded.Target = entry
+		}
+		e.edges = append(e.edges, expanded)
+	}
+	return nil
+}
+
+// expandCall 展开一个调用节点，返回调用方连线应当指向的参数节点 ID
+func (e *rssAutomationSubWorkflowExpander) expandCall(node RSSAutomationNode, id string, stack []uint) (string, error) {
+	subWorkflowID := rssAutomationConfigUint(node.Config, "sub_workflow_id")
+	for _, called := range stack {
+		if called == subWorkflowID {
+			return "", fmt.Errorf("调用节点 %s 形成了子流程循环调用", id)
+		}
+	}
+	if len(stack) >= maxRSSAutomationSubWorkflowDepth {
+		return "", fmt.Errorf("子流程嵌套不能超过 %d 层", maxRSSAutomationSubWorkflowDepth)
+	}
+	loaded, err := e.load(subWorkflowID)
+	if err != nil {
+		return "", fmt.Errorf("调用节点 %s: %w", id, err)
+	}
+	inputs, _ := rssAutomationSubWorkflowMapping(node.Config, "inputs", "子流程参数")
+	entry := ""
+	for _, subNode := range loaded.definition.Nodes {
+		if subNode.Type != RSSAutomationNodeTrigger {
+			continue
+		}
+		entry = id + "/" + subNode.ID
+		for _, name := range rssAutomationConfigTextSlice(subNode.Config, "inputs") {
+			if _, exists := inputs[name]; !exists {
+				return "", fmt.Errorf("调用节点 %s 缺少子流程 %s 的参数 %s", id, loaded.record.Name, name)
+			}
+		}
+	}
+	nested := append(append([]uint{}, stack...), subWorkflowID)
+	if err := e.expand(loaded.definition, id+"/", &node, nested); err != nil {
+		return "", err
+	}
+	exit := node
+	exit.ID = id
+	exit.Config = make(map[string]any, len(node.Config)+2)
+	for key, value := range node.Config {
+		exit.Config[key] = value
+	}
+	exit.Config["sub_workflow_name"] = loaded.record.Name
+	exit.Config["sub_workflow_version"] = loaded.record.Version
+	e.nodes = append(e.nodes, exit)
+	// 参数节点到汇总节点的 always 连线让子流程未到达结束节点时汇总节点仍会执行并走失败出口
+	e.edges = append(e.edges, RSSAutomationEdge{ID: entry + "/enter", Source: entry, SourcePort: "always", Target: id})
+	return entry, nil
+}
+
+// rssAutomationNodeScope 返回节点所在的子流程作用域，即最后一个 "/" 之前的部分；顶层节点为空
+func rssAutomationNodeScope(nodeID string) string {
+	if index := strings.LastIndex(nodeID, "/"); index >= 0 {
+		return nodeID[:index]
+	}
+	return ""
+}
+
+// rssAutomationNodeContextScope 返回节点执行时读取的上下文作用域；参数节点在调用方作用域中求值
+func rssAutomationNodeContextScope(node RSSAutomationNode) string {
+	scope := rssAutomationNodeScope(node.ID)
+	if node.Type == rssAutomationNodeSubWorkflowInput {
+		scope = rssAutomationNodeScope(scope)
+	}
+	return scope
+}
+
+func executeRSSAutomationSubWorkflowInputNode(node RSSAutomationNode, runContext map[string]any) (map[string]any, error) {
+	mapping, err := rssAutomationSubWorkflowMapping(node.Config, "inputs", "子流程参数")
+	if err != nil {
+		return map[string]any{"selected_port": "failure"}, err
+	}
+	inputs := make(map[string]any, len(mapping))
+	for name, expression := range mapping {
+		value, exists := resolveRSSAutomationConditionOperand(runContext, expression)
+		if !exists {
+			return map[string]any{"selected_port": "failure"}, fmt.Errorf("子流程参数 %s 引用的变量 %v 不存在", name, expression)
+		}
+		inputs[name] = value
+	}
+	for _, name := range rssAutomationConfigTextSlice(node.Config, "declared") {
+		if _, exists := inputs[name]; !exists {
+			return map[string]any{"selected_port": "failure"}, fmt.Errorf("调用子流程缺少参数 %s", name)
+		}
+	}
+	return map[string]any{"selected_port": "next", "inputs": inputs}, nil
+}
+
+func executeRSSAutomationSubWorkflowOutputNode(node RSSAutomationNode, runContext map[string]any) (map[string]any, error) {
+	mapping, err := rssAutomationSubWorkflowMapping(node.Config, "outputs", "子流程输出")
+	if err != nil {
+		return map[string]any{"selected_port": "failure"}, err
+	}
+	outputs := make(map[string]any, len(mapping))
+	for name, expression := range mapping {
+		value, exists := resolveRSSAutomationConditionOperand(runContext, expression)
+		if !exists {
+			return map[string]any{"selected_port": "failure"}, fmt.Errorf("子流程输出 %s 引用的变量 %v 不存在", name, expression)
+		}
+		outputs[name] = value
+	}
+	return map[string]any{"selected_port": "next", "completed": true, "outputs": outputs}, nil
+}
+
+// executeRSSAutomationCallWorkflowNode 汇总子流程结果：到达任一结束节点走成功出口并把输出写入 $vars.*，否则走失败出口
+func (s *RSSAutomationService) executeRSSAutomationCallWorkflowNode(runID uint, node RSSAutomationNode, definition RSSAutomationDefinition) (map[string]any, error) {
+	var nodeRuns []model.RSSAutomationNodeRun
+	if err := s.db.Where("run_id = ?", runID).Order("id ASC").Find(&nodeRuns).Error; err != nil {
+		return nil, err
+	}
+	byNode := make(map[string]*model.RSSAutomationNodeRun, len(nodeRuns))
+	for index := range nodeRuns {
+		byNode[nodeRuns[index].NodeID] = &nodeRuns[index]
+	}
+	output := map[string]any{
+		"sub_workflow_id":      rssAutomationConfigUint(node.Config, "sub_workflow_id"),
+		"sub_workflow_name":    rssAutomationConfigString(node.Config, "sub_workflow_name"),
+		"sub_workflow_version": node.Config["sub_workflow_version"],
+	}
+	for _, edge := range definition.Edges {
+		predecessor := byNode[edge.Source]
+		if edge.Target != node.ID || predecessor == nil || predecessor.NodeType != rssAutomationNodeSubWorkflowOutput {
+			continue
+		}
+		if !rssAutomationEdgeActive(edge, predecessor) {
+			continue
+		}
+		outputs, _ := rssAutomationDecodeNodeOutput(predecessor.OutputJSON)["outputs"].(map[string]any)
+		if outputs == nil {
+			outputs = map[string]any{}
+		}
+		output["selected_port"] = "success"
+		output["end_node"] = strings.TrimPrefix(predecessor.NodeID, node.ID+"/")
+		output["outputs"] = outputs
+		output["variables"] = outputs
+		return output, nil
+	}
+	failed := make([]string, 0)
+	for _, nodeRun := range nodeRuns {
+		if strings.HasPrefix(nodeRun.NodeID, node.ID+"/") && nodeRun.Status == model.RSSAutomationNodeFailed {
+			failed = append(failed, strings.TrimPrefix(nodeRun.NodeID, node.ID+"/"))
+		}
+	}
+	sort.Strings(failed)
+	output["selected_port"] = "failure"
+	output["reason"] = "子流程没有到达结束节点"
+	if len(failed) > 0 {
+		output["reason"] = "子流程没有到达结束节点，失败节点: " + strings.Join(failed, ", ")
+	}
+	return output, nil
+}
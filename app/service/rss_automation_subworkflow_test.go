@@ -0,0 +1,251 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"film-fusion/app/model"
+)
+
+func TestRSSAutomationCallWorkflowRunsSharedSubWorkflow(t *testing.T) {
+	db := newRSSAutomationTestDB(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	service := &RSSAutomationService{
+		db: db, ctx: ctx, cancel: cancel,
+		sourceWake: make(chan struct{}, 1), executionWake: make(chan struct{}, 1),
+		workers: make(chan struct{}, 2),
+	}
+	subWorkflow, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{
+		Name: "提取集数",
+		Definition: RSSAutomationDefinition{
+			Nodes: []RSSAutomationNode{
+				{ID: "trigger", Type: RSSAutomationNodeTrigger, Config: map[string]any{"inputs": []any{"title", "prefix"}}},
+				{ID: "capture", Type: RSSAutomationNodeRegex, Config: map[string]any{
+					"input": "$inputs.title", "pattern": `(\d+)集`, "variable": "ep", "value_type": "integer",
+				}},
+				{ID: "end", Type: RSSAutomationNodeEnd, Config: map[string]any{"outputs": map[string]any{
+					"episode": "$vars.ep", "label": "{{inputs.prefix}}-{{nodes.capture.output.captured}}",
+				}}},
+			},
+			Edges: []RSSAutomationEdge{
+				{ID: "e1", Source: "trigger", SourcePort: "next", Target: "capture"},
+				{ID: "e2", Source: "capture", SourcePort: "success", Target: "end"},
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("CreateSubWorkflow() error = %v", err)
+	}
+
+	definition := RSSAutomationDefinition{
+		SchemaVersion: RSSAutomationSchemaVersion,
+		Nodes: []RSSAutomationNode{
+			{ID: "trigger", Type: RSSAutomationNodeTrigger},
+			{ID: "capture", Type: RSSAutomationNodeCallWorkflow, Config: map[string]any{
+				"sub_workflow_id": float64(subWorkflow.ID),
+				"inputs":          map[string]any{"title": "$item.title", "prefix": "EP"},
+			}},
+			{ID: "check", Type: RSSAutomationNodeIf, Config: map[string]any{
+				"condition": map[string]any{"field": "$vars.episode", "operator": "gt", "value": 10},
+			}},
+			{ID: "end_pass", Type: RSSAutomationNodeEnd},
+			{ID: "end_skip", Type: RSSAutomationNodeEnd},
+			{ID: "end_failed", Type: RSSAutomationNodeEnd},
+		},
+		Edges: []RSSAutomationEdge{
+			{ID: "e1", Source: "trigger", SourcePort: "next", Target: "capture"},
+			{ID: "e2", Source: "capture", SourcePort: "success", Target: "check"},
+			{ID: "e3", Source: "capture", SourcePort: "failure", Target: "end_failed"},
+			{ID: "e4", Source: "check", SourcePort: "true", Target: "end_pass"},
+			{ID: "e5", Source: "check", SourcePort: "false", Target: "end_skip"},
+		},
+	}
+	if validation := ValidateRSSAutomationDefinition(definition); !validation.Valid {
+		t.Fatalf("test definition invalid: %#v", validation.Errors)
+	}
+	definitionJSON, _ := MarshalRSSAutomationDefinition(definition)
+	source := model.RSSAutomationSource{
+		Name: "动画更新", Enabled: true, FeedURL: "https://example.com/feed.xml",
+		IntervalMinutes: 5, MappingJSON: DefaultRSSAutomationMappingJSON(),
+	}
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatal(err)
+	}
+	workflow := model.RSSAutomationWorkflow{SourceID: source.ID, Name: "调用子流程", Enabled: true, Version: 1, DefinitionJSON: definitionJSON}
+	if err := db.Create(&workflow).Error; err != nil {
+		t.Fatal(err)
+	}
+	for index, title := range []string{"示例动画 第12集", "示例动画 总集篇"} {
+		fieldsJSON, _ := json.Marshal(map[string]any{"title": title})
+		entry := model.RSSAutomationEntry{SourceID: source.ID, Fingerprint: title, FieldsJSON: string(fieldsJSON), DiscoveredAt: time.Now()}
+		if err := db.Create(&entry).Error; err != nil {
+			t.Fatal(err)
+		}
+		if created, err := service.createRSSAutomationRuns(entry); err != nil || created != 1 {
+			t.Fatalf("entry %d: createRSSAutomationRuns() = %d, %v", index, created, err)
+		}
+	}
+	// 子流程之后的修改只影响新运行
+	if _, _, err := service.UpdateSubWorkflow(subWorkflow.ID, RSSAutomationSubWorkflowInput{Name: "提取集数", Definition: RSSAutomationDefinition{
+		Nodes: []RSSAutomationNode{
+			{ID: "trigger", Type: RSSAutomationNodeTrigger, Config: map[string]any{"inputs": []any{"title", "prefix"}}},
+			{ID: "end", Type: RSSAutomationNodeEnd},
+		},
+		Edges: []RSSAutomationEdge{{ID: "e1", Source: "trigger", SourcePort: "next", Target: "end"}},
+	}}); err != nil {
+		t.Fatalf("UpdateSubWorkflow() error = %v", err)
+	}
+	service.Start()
+	t.Cleanup(service.Stop)
+
+	var runs []model.RSSAutomationRun
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		runs = nil
+		if err := db.Order("id ASC").Find(&runs).Error; err != nil {
+			t.Fatal(err)
+		}
+		if len(runs) == 2 && runs[0].Status == model.RSSAutomationRunSucceeded && runs[1].Status == model.RSSAutomationRunSucceeded {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if len(runs) != 2 || runs[0].Status != model.RSSAutomationRunSucceeded || runs[1].Status != model.RSSAutomationRunSucceeded {
+		t.Fatalf("runs did not succeed: %#v", runs)
+	}
+	if !strings.Contains(runs[0].DefinitionJSON, `"id":"capture/capture"`) {
+		t.Fatalf("run snapshot does not contain the expanded sub-workflow: %s", runs[0].DefinitionJSON)
+	}
+
+	matched := rssAutomationSubWorkflowTestNodeRuns(t, service, runs[0].ID)
+	if matched["end_pass"].Status != model.RSSAutomationNodeSucceeded || matched["capture/end"].NodeType != rssAutomationNodeSubWorkflowOutput {
+		t.Fatalf("matched entry did not return through the sub-workflow: %#v", matched)
+	}
+	callOutput := rssAutomationDecodeNodeOutput(matched["capture"].OutputJSON)
+	outputs, _ := callOutput["outputs"].(map[string]any)
+	if callOutput["selected_port"] != "success" || outputs["episode"] != json.Number("12") || outputs["label"] != "EP-12" || callOutput["sub_workflow_version"] != json.Number("1") {
+		t.Fatalf("call output = %#v", callOutput)
+	}
+	parentContext, err := service.buildRSSAutomationRunContext(runs[0], "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	variables := parentContext["vars"].(map[string]any)
+	if _, leaked := variables["ep"]; leaked || variables["episode"] != json.Number("12") {
+		t.Fatalf("parent vars = %#v, want only the mapped output", variables)
+	}
+	subContext, err := service.buildRSSAutomationRunContext(runs[0], "capture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if inputs, _ := subContext["inputs"].(map[string]any); inputs["prefix"] != "EP" {
+		t.Fatalf("sub-workflow inputs = %#v", subContext["inputs"])
+	}
+	if _, visible := subContext["nodes"].(map[string]any)["check"]; visible {
+		t.Fatal("sub-workflow scope must not see parent nodes")
+	}
+
+	unmatched := rssAutomationSubWorkflowTestNodeRuns(t, service, runs[1].ID)
+	failedOutput := rssAutomationDecodeNodeOutput(unmatched["capture"].OutputJSON)
+	if unmatched["end_failed"].Status != model.RSSAutomationNodeSucceeded || failedOutput["selected_port"] != "failure" {
+		t.Fatalf("unmatched entry did not take the failure port: %#v", failedOutput)
+	}
+	if unmatched["capture/end"].Status != model.RSSAutomationNodeSkipped || unmatched["check"].Status != model.RSSAutomationNodeSkipped {
+		t.Fatalf("unmatched branches not skipped: %#v", unmatched)
+	}
+}
+
+func TestRSSAutomationSubWorkflowValidation(t *testing.T) {
+	db := newRSSAutomationTestDB(t)
+	service := &RSSAutomationService{db: db}
+	leaf := RSSAutomationDefinition{
+		Nodes: []RSSAutomationNode{
+			{ID: "trigger", Type: RSSAutomationNodeTrigger, Config: map[string]any{"inputs": []any{"title"}}},
+			{ID: "end", Type: RSSAutomationNodeEnd, Config: map[string]any{"outputs": map[string]any{"title": "$inputs.title"}}},
+		},
+		Edges: []RSSAutomationEdge{{ID: "e1", Source: "trigger", SourcePort: "next", Target: "end"}},
+	}
+	caller := func(subWorkflowID uint, inputs map[string]any) RSSAutomationDefinition {
+		return RSSAutomationDefinition{
+			Nodes: []RSSAutomationNode{
+				{ID: "trigger", Type: RSSAutomationNodeTrigger},
+				{ID: "call", Type: RSSAutomationNodeCallWorkflow, Config: map[string]any{"sub_workflow_id": float64(subWorkflowID), "inputs": inputs}},
+				{ID: "end", Type: RSSAutomationNodeEnd},
+			},
+			Edges: []RSSAutomationEdge{
+				{ID: "e1", Source: "trigger", SourcePort: "next", Target: "call"},
+				{ID: "e2", Source: "call", SourcePort: "always", Target: "end"},
+			},
+		}
+	}
+
+	first, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{Name: "识别", Definition: leaf})
+	if err != nil {
+		t.Fatalf("CreateSubWorkflow(leaf) error = %v", err)
+	}
+	if _, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{Name: "识别", Definition: leaf}); err == nil {
+		t.Fatal("duplicated sub-workflow name accepted")
+	}
+	if _, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{Name: "缺参数", Definition: caller(first.ID, nil)}); err == nil || !strings.Contains(err.Error(), "参数 title") {
+		t.Fatalf("missing input error = %v", err)
+	}
+	if _, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{Name: "不存在", Definition: caller(999, nil)}); err == nil || !strings.Contains(err.Error(), "不存在") {
+		t.Fatalf("missing sub-workflow error = %v", err)
+	}
+	wrapper := caller(first.ID, map[string]any{"title": "$inputs.title"})
+	wrapper.Nodes[0].Config = map[string]any{"inputs": []any{"title"}}
+	second, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{Name: "整理", Definition: wrapper})
+	if err != nil {
+		t.Fatalf("CreateSubWorkflow(wrapper) error = %v", err)
+	}
+	cycle := caller(second.ID, map[string]any{"title": "$inputs.title"})
+	cycle.Nodes[0].Config = map[string]any{"inputs": []any{"title"}}
+	if _, _, err := service.UpdateSubWorkflow(first.ID, RSSAutomationSubWorkflowInput{Name: "识别", Definition: cycle}); err == nil || !strings.Contains(err.Error(), "循环调用") {
+		t.Fatalf("cycle error = %v", err)
+	}
+	cron := leaf
+	cron.Nodes = append([]RSSAutomationNode{}, leaf.Nodes...)
+	cron.Nodes[0] = RSSAutomationNode{ID: "trigger", Type: RSSAutomationNodeTrigger, Config: map[string]any{"mode": "cron", "cron": "0 3 * * *"}}
+	if _, _, err := service.CreateSubWorkflow(RSSAutomationSubWorkflowInput{Name: "定时", Definition: cron}); err == nil {
+		t.Fatal("sub-workflow with a cron trigger accepted")
+	}
+	if err := service.DeleteSubWorkflow(first.ID); err == nil || !strings.Contains(err.Error(), "整理") {
+		t.Fatalf("deleting a called sub-workflow error = %v", err)
+	}
+	if err := service.DeleteSubWorkflow(second.ID); err != nil {
+		t.Fatalf("DeleteSubWorkflow() error = %v", err)
+	}
+
+	expanded, hasCalls, err := service.expandRSSAutomationSubWorkflows(caller(first.ID, map[string]any{"title": "$item.title"}), nil)
+	if err != nil || !hasCalls {
+		t.Fatalf("expandRSSAutomationSubWorkflows() = %v, %v", hasCalls, err)
+	}
+	types := make(map[string]string, len(expanded.Nodes))
+	for _, node := range expanded.Nodes {
+		types[node.ID] = node.Type
+	}
+	if types["call/trigger"] != rssAutomationNodeSubWorkflowInput || types["call/end"] != rssAutomationNodeSubWorkflowOutput || types["call"] != RSSAutomationNodeCallWorkflow {
+		t.Fatalf("expanded node types = %#v", types)
+	}
+	for _, edge := range expanded.Edges {
+		if edge.Target == "call" && edge.Source == "trigger" {
+			t.Fatalf("caller edge was not redirected into the sub-workflow: %#v", edge)
+		}
+	}
+}
+
+func rssAutomationSubWorkflowTestNodeRuns(t *testing.T, service *RSSAutomationService, runID uint) map[string]model.RSSAutomationNodeRun {
+	t.Helper()
+	var nodeRuns []model.RSSAutomationNodeRun
+	if err := service.db.Where("run_id = ?", runID).Find(&nodeRuns).Error; err != nil {
+		t.Fatal(err)
+	}
+	byNode := make(map[string]model.RSSAutomationNodeRun, len(nodeRuns))
+	for _, nodeRun := range nodeRuns {
+		byNode[nodeRun.NodeID] = nodeRun
+	}
+	return byNode
+}
@@ -2,11 +2,7 @@ package service
 
 import (
 	"context"
-	"encoding/json"
 	"fmt"
-	"io"
-	"net/http"
-	"strings"
 	"sync"
 	"time"
 
@@ -19,8 +15,9 @@ const (
 )
 
 // RSSAutomationTargetStatus is a read-only snapshot of the information shown
-// by qBittorrent's status bar. A failed target is returned with Error populated
-// so one unavailable downloader does not hide the state of the others.
+// by a downloader's status bar. A failed target is returned with Error populated
+// so one unavailable downloader does not hide the state of the others. Session
+// totals and DHT nodes stay zero for downloaders that do not report them.
 type RSSAutomationTargetStatus struct {
 	TargetID          uint      `json:"target_id"`
 	Enabled           bool      `json:"enabled"`
@@ -36,15 +33,6 @@ type RSSAutomationTargetStatus struct {
 	CheckedAt         time.Time `json:"checked_at"`
 }
 
-type rssAutomationQBTransferInfo struct {
-	ConnectionStatus string `json:"connection_status"`
-	DownloadSpeed    int64  `json:"dl_info_speed"`
-	DownloadedData   int64  `json:"dl_info_data"`
-	UploadSpeed      int64  `json:"up_info_speed"`
-	UploadedData     int64  `json:"up_info_data"`
-	DHTNodes         int    `json:"dht_nodes"`
-}
-
 func (s *RSSAutomationService) ListTargetStatuses(ctx context.Context) ([]RSSAutomationTargetStatus, error) {
 	targets := make([]model.RSSAutomationTarget, 0)
 	if err := s.db.WithContext(ctx).Order("id ASC").Find(&targets).Error; err != nil {
@@ -73,14 +61,9 @@ func (s *RSSAutomationService) readTargetStatus(parent context.Context, target m
 	if !target.Enabled {
 		return status
 	}
-	if target.Type != model.RSSAutomationTargetQBittorrent {
-		status.Error = fmt.Sprintf("不支持的目标类型 %q", target.Type)
-		return status
-	}
-
 	ctx, cancel := context.WithTimeout(parent, rssAutomationTargetStatusTimeout)
 	defer cancel()
-	client, err := s.newRSSAutomationQBClient(ctx, target)
+	client, err := s.newRSSAutomationDownloader(ctx, target)
 	if err != nil {
 		status.Error = err.Error()
 		status.CheckedAt = time.Now().UTC()
@@ -88,7 +71,7 @@ func (s *RSSAutomationService) readTargetStatus(parent context.Context, target m
 	}
 
 	type transferResult struct {
-		info rssAutomationQBTransferInfo
+		info rssAutomationTransferInfo
 		err  error
 	}
 	type activeResult struct {
@@ -128,63 +111,3 @@ func (s *RSSAutomationService) readTargetStatus(parent context.Context, target m
 	status.ActiveTorrents = &active.count
 	return status
 }
-
-func (client *rssAutomationQBClient) transferInfo(ctx context.Context) (rssAutomationQBTransferInfo, error) {
-	var info rssAutomationQBTransferInfo
-	response, err := client.get(ctx, "/api/v2/transfer/info")
-	if err != nil {
-		return info, err
-	}
-	defer response.Body.Close()
-	if err := json.NewDecoder(io.LimitReader(response.Body, rssAutomationTargetStatusLimit)).Decode(&info); err != nil {
-		return info, fmt.Errorf("解析 qBittorrent 传输状态失败: %w", err)
-	}
-	return info, nil
-}
-
-func (client *rssAutomationQBClient) activeTorrentCount(ctx context.Context) (int, error) {
-	response, err := client.get(ctx, "/api/v2/torrents/info?filter=active")
-	if err != nil {
-		return 0, err
-	}
-	defer response.Body.Close()
-
-	decoder := json.NewDecoder(io.LimitReader(response.Body, rssAutomationTargetStatusLimit))
-	token, err := decoder.Token()
-	if err != nil {
-		return 0, fmt.Errorf("解析 qBittorrent 活动任务失败: %w", err)
-	}
-	opening, ok := token.(json.Delim)
-	if !ok || opening != '[' {
-		return 0, fmt.Errorf("qBittorrent 活动任务响应不是数组")
-	}
-	count := 0
-	for decoder.More() {
-		var item json.RawMessage
-		if err := decoder.Decode(&item); err != nil {
-			return 0, fmt.Errorf("解析 qBittorrent 活动任务失败: %w", err)
-		}
-		count++
-	}
-	if _, err := decoder.Token(); err != nil {
-		return 0, fmt.Errorf("解析 qBittorrent 活动任务失败: %w", err)
-	}
-	return count, nil
-}
-
-func (client *rssAutomationQBClient) get(ctx context.Context, path string) (*http.Response, error) {
-	request, err := client.newRequest(ctx, http.MethodGet, path, nil)
-	if err != nil {
-		return nil, err
-	}
-	response, err := client.client.Do(request)
-	if err != nil {
-		return nil, fmt.Errorf("连接 qBittorrent API 失败: %w", err)
-	}
-	if response.StatusCode >= http.StatusOK && response.StatusCode < http.StatusMultipleChoices {
-		return response, nil
-	}
-	defer response.Body.Close()
-	body, _ := io.ReadAll(io.LimitReader(response.Body, 4096))
-	return nil, fmt.Errorf("qBittorrent API 返回 HTTP %d: %s", response.StatusCode, strings.TrimSpace(string(body)))
-}
@@ -0,0 +1,256 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const rssAutomationTransmissionSessionHeader = "X-Transmission-Session-Id"
+
+var rssAutomationTransmissionTaskFields = []string{
+	"hashString", "name", "status", "error", "errorString", "percentDone", "downloadDir",
+	"sizeWhenDone", "leftUntilDone", "downloadedEver", "uploadRatio", "eta", "labels",
+}
+
+// Transmission 的 status 数值对应的状态名
+var rssAutomationTransmissionStates = []string{
+	"stopped", "check_pending", "checking", "download_pending", "downloading", "seed_pending", "seeding",
+}
+
+type rssAutomationTransmissionClient struct {
+	endpoint string
+	username string
+	password string
+	client   *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+type rssAutomationTransmissionTorrent struct {
+	HashString     string   `json:"hashString"`
+	Name           string   `json:"name"`
+	Status         int      `json:"status"`
+	Error          int      `json:"error"`
+	ErrorString    string   `json:"errorString"`
+	PercentDone    float64  `json:"percentDone"`
+	DownloadDir    string   `json:"downloadDir"`
+	SizeWhenDone   int64    `json:"sizeWhenDone"`
+	LeftUntilDone  int64    `json:"leftUntilDone"`
+	DownloadedEver int64    `json:"downloadedEver"`
+	UploadRatio    float64  `json:"uploadRatio"`
+	ETA            int64    `json:"eta"`
+	Labels         []string `json:"labels"`
+	Files          []struct {
+		Name   string `json:"name"`
+		Length int64  `json:"length"`
+	} `json:"files"`
+}
+
+func newRSSAutomationTransmissionClient(config RSSAutomationDownloaderConfig) *rssAutomationTransmissionClient {
+	return &rssAutomationTransmissionClient{
+		endpoint: rssAutomationRPCEndpoint(config.BaseURL, "/transmission/rpc"),
+		username: config.Username, password: config.Password,
+		client: &http.Client{Timeout: 20 * time.Second},
+	}
+}
+
+// call 调用 Transmission RPC；收到 409 时按协议换用响应中的会话 ID 重试一次
+func (client *rssAutomationTransmissionClient) call(ctx context.Context, method string, arguments any, result any) error {
+	payload, err := json.Marshal(map[string]any{"method": method, "arguments": arguments})
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < 2; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, client.endpoint, bytes.NewReader(payload))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		client.mu.Lock()
+		if client.sessionID != "" {
+			req.Header.Set(rssAutomationTransmissionSessionHeader, client.sessionID)
+		}
+		client.mu.Unlock()
+		if client.username != "" || client.password != "" {
+			req.SetBasicAuth(client.username, client.password)
+		}
+		resp, err := client.client.Do(req)
+		if err != nil {
+			return fmt.Errorf("连接 Transmission 失败: %w", err)
+		}
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+		resp.Body.Close()
+		if resp.StatusCode == http.StatusConflict && resp.Header.Get(rssAutomationTransmissionSessionHeader) != "" {
+			client.mu.Lock()
+			client.sessionID = resp.Header.Get(rssAutomationTransmissionSessionHeader)
+			client.mu.Unlock()
+			continue
+		}
+		if resp.StatusCode == http.StatusUnauthorized {
+			return errors.New("Transmission 用户名或密码错误")
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("Transmission 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+		}
+		var envelope struct {
+			Result    string          `json:"result"`
+			Arguments json.RawMessage `json:"arguments"`
+		}
+		if err := json.Unmarshal(body, &envelope); err != nil {
+			return fmt.Errorf("解析 Transmission 响应失败: %w", err)
+		}
+		if envelope.Result != "success" {
+			return fmt.Errorf("Transmission %s 失败: %s", method, envelope.Result)
+		}
+		if result == nil || len(envelope.Arguments) == 0 {
+			return nil
+		}
+		if err := json.Unmarshal(envelope.Arguments, result); err != nil {
+			return fmt.Errorf("解析 Transmission %s 结果失败: %w", method, err)
+		}
+		return nil
+	}
+	return errors.New("Transmission 会话 ID 协商失败")
+}
+
+func (client *rssAutomationTransmissionClient) testConnection(ctx context.Context) error {
+	var session struct {
+		Version string `json:"version"`
+	}
+	if err := client.call(ctx, "session-get", map[string]any{"fields": []string{"version"}}, &session); err != nil {
+		return err
+	}
+	if session.Version == "" {
+		return errors.New("Transmission 未返回版本")
+	}
+	return nil
+}
+
+func (client *rssAutomationTransmissionClient) addTask(ctx context.Context, request rssAutomationDownloadRequest) (string, error) {
+	// Transmission 没有分类，分类与标签都写入 labels
+	labels := make([]string, 0, len(request.Tags)+2)
+	if request.Category != "" {
+		labels = append(labels, request.Category)
+	}
+	labels = append(append(labels, request.Tags...), request.TrackingTag)
+	arguments := map[string]any{"filename": request.URL, "paused": request.Paused, "labels": labels}
+	if request.SavePath != "" {
+		arguments["download-dir"] = request.SavePath
+	}
+	if request.Sequential {
+		arguments["sequential_download"] = true
+	}
+	var result map[string]rssAutomationTransmissionTorrent
+	if err := client.call(ctx, "torrent-add", arguments, &result); err != nil {
+		return "", err
+	}
+	for _, key := range []string{"torrent-added", "torrent-duplicate"} {
+		if torrent, ok := result[key]; ok && torrent.HashString != "" {
+			return strings.ToLower(torrent.HashString), nil
+		}
+	}
+	return "", errors.New("Transmission 未返回任务 Hash")
+}
+
+func (client *rssAutomationTransmissionClient) getTorrents(ctx context.Context, taskID string, fields []string) ([]rssAutomationTransmissionTorrent, error) {
+	arguments := map[string]any{"fields": fields}
+	if taskID != "" {
+		arguments["ids"] = []string{taskID}
+	}
+	var result struct {
+		Torrents []rssAutomationTransmissionTorrent `json:"torrents"`
+	}
+	if err := client.call(ctx, "torrent-get", arguments, &result); err != nil {
+		return nil, err
+	}
+	return result.Torrents, nil
+}
+
+func (client *rssAutomationTransmissionClient) findTask(ctx context.Context, taskID, trackingTag string) (*rssAutomationDownloadTask, error) {
+	torrents, err := client.getTorrents(ctx, taskID, rssAutomationTransmissionTaskFields)
+	if err != nil {
+		return nil, err
+	}
+	for _, torrent := range torrents {
+		if taskID == "" && !slices.Contains(torrent.Labels, trackingTag) {
+			continue
+		}
+		state := "unknown"
+		if torrent.Status >= 0 && torrent.Status < len(rssAutomationTransmissionStates) {
+			state = rssAutomationTransmissionStates[torrent.Status]
+		}
+		task := &rssAutomationDownloadTask{
+			ID: strings.ToLower(torrent.HashString), Name: torrent.Name, State: state, Progress: torrent.PercentDone,
+			SavePath: torrent.DownloadDir, ContentPath: rssAutomationJoinDownloadPath(torrent.DownloadDir, torrent.Name),
+			Size: torrent.SizeWhenDone, Downloaded: torrent.DownloadedEver, AmountLeft: torrent.LeftUntilDone,
+			Ratio: torrent.UploadRatio, ETA: torrent.ETA,
+		}
+		// error 为 1、2 是 Tracker 警告或错误，只有 3(本地错误，如磁盘不可写)会让任务无法继续
+		if torrent.Error == 3 {
+			task.Failed = true
+			task.State = "error: " + torrent.ErrorString
+		}
+		task.Completed = torrent.PercentDone >= 0.999999 || (torrent.SizeWhenDone > 0 && torrent.LeftUntilDone == 0)
+		return task, nil
+	}
+	return nil, nil
+}
+
+func (client *rssAutomationTransmissionClient) listFiles(ctx context.Context, taskID string) ([]rssAutomationDownloadFile, error) {
+	torrents, err := client.getTorrents(ctx, taskID, []string{"hashString", "files"})
+	if err != nil {
+		return nil, err
+	}
+	if len(torrents) == 0 {
+		return nil, errors.New("Transmission 任务不存在")
+	}
+	files := make([]rssAutomationDownloadFile, 0, len(torrents[0].Files))
+	for _, file := range torrents[0].Files {
+		files = append(files, rssAutomationDownloadFile{Name: file.Name, Size: file.Length})
+	}
+	return files, nil
+}
+
+func (client *rssAutomationTransmissionClient) removeTask(ctx context.Context, taskID string, deleteFiles bool) error {
+	return client.call(ctx, "torrent-remove", map[string]any{"ids": []string{taskID}, "delete-local-data": deleteFiles}, nil)
+}
+
+func (client *rssAutomationTransmissionClient) sessionStats(ctx context.Context) (rssAutomationTransferInfo, int, error) {
+	var stats struct {
+		ActiveTorrentCount int   `json:"activeTorrentCount"`
+		DownloadSpeed      int64 `json:"downloadSpeed"`
+		UploadSpeed        int64 `json:"uploadSpeed"`
+		CurrentStats       struct {
+			DownloadedBytes int64 `json:"downloadedBytes"`
+			UploadedBytes   int64 `json:"uploadedBytes"`
+		} `json:"current-stats"`
+	}
+	if err := client.call(ctx, "session-stats", nil, &stats); err != nil {
+		return rssAutomationTransferInfo{}, 0, err
+	}
+	return rssAutomationTransferInfo{
+		ConnectionStatus: "connected",
+		DownloadSpeed:    stats.DownloadSpeed, UploadSpeed: stats.UploadSpeed,
+		DownloadedData: stats.CurrentStats.DownloadedBytes, UploadedData: stats.CurrentStats.UploadedBytes,
+	}, stats.ActiveTorrentCount, nil
+}
+
+func (client *rssAutomationTransmissionClient) transferInfo(ctx context.Context) (rssAutomationTransferInfo, error) {
+	info, _, err := client.sessionStats(ctx)
+	return info, err
+}
+
+func (client *rssAutomationTransmissionClient) activeTorrentCount(ctx context.Context) (int, error) {
+	_, count, err := client.sessionStats(ctx)
+	return count, err
+}
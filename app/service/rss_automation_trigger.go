@@ -0,0 +1,256 @@
+package service
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"film-fusion/app/model"
+
+	"github.com/robfig/cron/v3"
+)
+
+// 触发器节点的 mode：
+//   - feed(默认)：RSS / JSON / HTML 源发现新条目时启动
+//   - cron：按 cron 表达式定时启动，不依赖源条目，对应的源不再轮询
+//   - manual：只通过 API 手动触发，对应的源不再轮询
+//
+// cron 与 API 触发的运行会生成一条 trigger_type 非空的合成条目，复用运行与节点运行的持久化；
+// 运行上下文中 $item 为触发器 config.context 与调用方 context 合并后的对象，$trigger 为触发信息。
+const (
+	RSSAutomationTriggerFeed   = "feed"
+	RSSAutomationTriggerCron   = "cron"
+	RSSAutomationTriggerManual = "manual"
+
+	maxRSSAutomationTriggerContextBytes = 64 << 10
+	rssAutomationTriggerCheckInterval   = 30 * time.Second
+)
+
+var rssAutomationCronParser = cron.NewParser(cron.Minute | cron.Hour | cron.Dom | cron.Month | cron.Dow | cron.Descriptor)
+
+type RSSAutomationTriggerInput struct {
+	Context map[string]any `json:"context"`
+}
+
+type RSSAutomationTriggerResult struct {
+	RunID   uint `json:"run_id"`
+	EntryID uint `json:"entry_id"`
+}
+
+// rssAutomationTriggerSettings 触发器节点中与启动方式相关的配置
+type rssAutomationTriggerSettings struct {
+	Mode    string
+	Cron    string
+	Context map[string]any
+}
+
+func validateRSSAutomationTriggerConfig(config map[string]any) error {
+	settings := readRSSAutomationTriggerSettings(config)
+	switch settings.Mode {
+	case RSSAutomationTriggerFeed, RSSAutomationTriggerManual:
+	case RSSAutomationTriggerCron:
+		if settings.Cron == "" {
+			return errors.New("定时触发必须配置 cron 表达式")
+		}
+		if _, err := rssAutomationCronParser.Parse(settings.Cron); err != nil {
+			return fmt.Errorf("cron 表达式无效: %w", err)
+		}
+	default:
+		return fmt.Errorf("不支持的触发方式 %q", settings.Mode)
+	}
+	if raw, exists := config["context"]; exists && raw != nil {
+		if _, ok := raw.(map[string]any); !ok {
+			return errors.New("触发上下文必须是 JSON 对象")
+		}
+	}
+	return nil
+}
+
+func readRSSAutomationTriggerSettings(config map[string]any) rssAutomationTriggerSettings {
+	settings := rssAutomationTriggerSettings{
+		Mode: strings.ToLower(rssAutomationConfigString(config, "mode")),
+		Cron: rssAutomationConfigString(config, "cron"),
+	}
+	if settings.Mode == "" {
+		settings.Mode = RSSAutomationTriggerFeed
+	}
+	settings.Context, _ = config["context"].(map[string]any)
+	return settings
+}
+
+// rssAutomationDefinitionTrigger 返回流程触发器节点的配置；定义无效时按 feed 处理
+func rssAutomationDefinitionTrigger(definition RSSAutomationDefinition) rssAutomationTriggerSettings {
+	for _, node := range definition.Nodes {
+		if node.Type == RSSAutomationNodeTrigger {
+			return readRSSAutomationTriggerSettings(node.Config)
+		}
+	}
+	return rssAutomationTriggerSettings{Mode: RSSAutomationTriggerFeed}
+}
+
+func rssAutomationWorkflowTrigger(workflow model.RSSAutomationWorkflow) rssAutomationTriggerSettings {
+	definition, err := ParseRSSAutomationDefinition(workflow.DefinitionJSON)
+	if err != nil {
+		return rssAutomationTriggerSettings{Mode: RSSAutomationTriggerFeed}
+	}
+	return rssAutomationDefinitionTrigger(definition)
+}
+
+// TriggerWorkflow 通过 API 启动一次运行，调用方的 context 覆盖触发器中配置的同名字段
+func (s *RSSAutomationService) TriggerWorkflow(workflowID uint, input RSSAutomationTriggerInput) (RSSAutomationTriggerResult, error) {
+	workflow, definition, err := s.loadRSSAutomationWorkflowDefinition(workflowID)
+	if err != nil {
+		return RSSAutomationTriggerResult{}, err
+	}
+	encoded, err := json.Marshal(input.Context)
+	if err != nil {
+		return RSSAutomationTriggerResult{}, fmt.Errorf("触发上下文无法序列化: %w", err)
+	}
+	if len(encoded) > maxRSSAutomationTriggerContextBytes {
+		return RSSAutomationTriggerResult{}, errors.New("触发上下文不能超过 64 KiB")
+	}
+	fields := mergeRSSAutomationTriggerContext(rssAutomationDefinitionTrigger(definition).Context, input.Context)
+	run, err := s.createRSSAutomationTriggeredRun(workflow, model.RSSAutomationTriggerAPI, fields, time.Now())
+	if err != nil {
+		return RSSAutomationTriggerResult{}, err
+	}
+	s.wakeExecution()
+	return RSSAutomationTriggerResult{RunID: run.ID, EntryID: run.EntryID}, nil
+}
+
+func mergeRSSAutomationTriggerContext(base, override map[string]any) map[string]any {
+	merged := make(map[string]any, len(base)+len(override))
+	for key, value := range base {
+		merged[key] = value
+	}
+	for key, value := range override {
+		merged[key] = value
+	}
+	return merged
+}
+
+// createRSSAutomationTriggeredRun 为 cron / API 触发生成合成条目并创建运行，运行创建失败时删除该条目
+func (s *RSSAutomationService) createRSSAutomationTriggeredRun(workflow model.RSSAutomationWorkflow, triggerType string, fields map[string]any, firedAt time.Time) (model.RSSAutomationRun, error) {
+	fieldsJSON, err := json.Marshal(fields)
+	if err != nil {
+		return model.RSSAutomationRun{}, err
+	}
+	nonce := make([]byte, 8)
+	_, _ = rand.Read(nonce)
+	identity := strings.Join([]string{
+		"trigger", triggerType, strconv.FormatUint(uint64(workflow.ID), 10),
+		strconv.FormatInt(firedAt.UnixNano(), 10), hex.EncodeToString(nonce),
+	}, "\x00")
+	sum := sha256.Sum256([]byte(identity))
+	title := firstRSSAutomationString(fields, "title")
+	if title == "" {
+		label := "定时触发"
+		if triggerType == model.RSSAutomationTriggerAPI {
+			label = "API 触发"
+		}
+		title = label + " · " + workflow.Name
+	}
+	entry := model.RSSAutomationEntry{
+		SourceID: workflow.SourceID, Fingerprint: hex.EncodeToString(sum[:]), Title: title,
+		FieldsJSON: string(fieldsJSON), TriggerType: triggerType, DiscoveredAt: firedAt,
+	}
+	if err := s.db.Create(&entry).Error; err != nil {
+		return model.RSSAutomationRun{}, err
+	}
+	run, created, err := s.createRSSAutomationRun(workflow, entry, false)
+	if err == nil && !created {
+		err = errors.New("触发运行创建失败")
+	}
+	if err != nil {
+		s.db.Delete(&entry)
+		return model.RSSAutomationRun{}, err
+	}
+	return run, nil
+}
+
+func (s *RSSAutomationService) triggerScheduleLoop() {
+	defer s.wg.Done()
+	ticker := time.NewTicker(rssAutomationTriggerCheckInterval)
+	defer ticker.Stop()
+	s.fireDueRSSAutomationCronTriggers(time.Now())
+	for {
+		select {
+		case <-s.ctx.Done():
+			return
+		case now := <-ticker.C:
+			s.fireDueRSSAutomationCronTriggers(now)
+		}
+	}
+}
+
+// fireDueRSSAutomationCronTriggers 为到期的定时流程各创建一次运行。计时起点取上次计划时间与流程更新时间中较晚者，
+// 因此停用期间或离线期间错过的多次计划只补跑一次，编辑或重新启用流程后从当时重新计时。
+func (s *RSSAutomationService) fireDueRSSAutomationCronTriggers(now time.Time) int {
+	var workflows []model.RSSAutomationWorkflow
+	if err := s.db.Where("enabled = ?", true).Find(&workflows).Error; err != nil {
+		return 0
+	}
+	fired := 0
+	for _, workflow := range workflows {
+		trigger := rssAutomationWorkflowTrigger(workflow)
+		if trigger.Mode != RSSAutomationTriggerCron {
+			continue
+		}
+		schedule, err := rssAutomationCronParser.Parse(trigger.Cron)
+		if err != nil {
+			continue
+		}
+		base := workflow.UpdatedAt
+		if workflow.LastScheduledAt != nil && workflow.LastScheduledAt.After(base) {
+			base = *workflow.LastScheduledAt
+		}
+		scheduledAt := schedule.Next(base)
+		if scheduledAt.IsZero() || scheduledAt.After(now) {
+			continue
+		}
+		// 以旧值为条件推进计划时间，多实例共用数据库时只有一个实例能抢到本次触发
+		claim := s.db.Model(&model.RSSAutomationWorkflow{}).Where("id = ?", workflow.ID)
+		if workflow.LastScheduledAt == nil {
+			claim = claim.Where("last_scheduled_at IS NULL")
+		} else {
+			claim = claim.Where("last_scheduled_at = ?", *workflow.LastScheduledAt)
+		}
+		result := claim.UpdateColumn("last_scheduled_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			continue
+		}
+		fields := mergeRSSAutomationTriggerContext(trigger.Context, nil)
+		if _, err := s.createRSSAutomationTriggeredRun(workflow, model.RSSAutomationTriggerCron, fields, scheduledAt); err != nil {
+			if s.log != nil {
+				s.log.Warnf("[RSS-AUTOMATION] 流程 %s 定时触发失败: %v", workflow.Name, err)
+			}
+			continue
+		}
+		fired++
+	}
+	if fired > 0 {
+		s.wakeExecution()
+	}
+	return fired
+}
+
+// nonFeedRSSAutomationSourceIDs 返回流程不由源条目触发的源，这些源不再定时轮询
+func (s *RSSAutomationService) nonFeedRSSAutomationSourceIDs() map[uint]struct{} {
+	var workflows []model.RSSAutomationWorkflow
+	if err := s.db.Select("id", "source_id", "definition_json").Find(&workflows).Error; err != nil {
+		return nil
+	}
+	ids := make(map[uint]struct{})
+	for _, workflow := range workflows {
+		if rssAutomationWorkflowTrigger(workflow).Mode != RSSAutomationTriggerFeed {
+			ids[workflow.SourceID] = struct{}{}
+		}
+	}
+	return ids
+}
@@ -0,0 +1,192 @@
+package service
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"film-fusion/app/model"
+
+	"gorm.io/gorm"
+)
+
+func TestValidateRSSAutomationTriggerConfig(t *testing.T) {
+	valid := []map[string]any{
+		nil,
+		{"mode": "feed"},
+		{"mode": "manual", "context": map[string]any{"scope": "wishlist"}},
+		{"mode": "cron", "cron": "0 3 * * *"},
+		{"mode": "CRON", "cron": "@weekly"},
+		{"mode": "cron", "cron": "CRON_TZ=Asia/Shanghai 30 2 * * 1"},
+	}
+	for _, config := range valid {
+		if err := validateRSSAutomationTriggerConfig(config); err != nil {
+			t.Fatalf("config %#v rejected: %v", config, err)
+		}
+	}
+	invalid := []map[string]any{
+		{"mode": "webhook"},
+		{"mode": "cron"},
+		{"mode": "cron", "cron": "0 3 * *"},
+		{"mode": "cron", "cron": "0 0 3 * * *"},
+		{"mode": "manual", "context": "wishlist"},
+	}
+	for _, config := range invalid {
+		if err := validateRSSAutomationTriggerConfig(config); err == nil {
+			t.Fatalf("config %#v unexpectedly accepted", config)
+		}
+	}
+}
+
+func TestRSSAutomationCronTriggerCollapsesMissedSchedules(t *testing.T) {
+	db := newRSSAutomationTestDB(t)
+	automation := &RSSAutomationService{db: db, executionWake: make(chan struct{}, 1)}
+	source, workflow := createRSSAutomationTriggerTestWorkflow(t, db, map[string]any{
+		"mode": "cron", "cron": "0 3 * * *", "context": map[string]any{"scope": "wishlist"},
+	})
+	updatedAt := time.Date(2026, 8, 1, 12, 0, 0, 0, time.UTC)
+	if err := db.Model(&workflow).UpdateColumn("updated_at", updatedAt).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	if fired := automation.fireDueRSSAutomationCronTriggers(updatedAt.Add(14 * time.Hour)); fired != 0 {
+		t.Fatalf("fired before first schedule: %d", fired)
+	}
+	now := time.Date(2026, 8, 4, 8, 0, 0, 0, time.UTC)
+	if fired := automation.fireDueRSSAutomationCronTriggers(now); fired != 1 {
+		t.Fatalf("fired = %d, want one run for three missed schedules", fired)
+	}
+	if fired := automation.fireDueRSSAutomationCronTriggers(now.Add(time.Hour)); fired != 0 {
+		t.Fatalf("fired again before next schedule: %d", fired)
+	}
+	if fired := automation.fireDueRSSAutomationCronTriggers(time.Date(2026, 8, 5, 3, 0, 0, 0, time.UTC)); fired != 1 {
+		t.Fatalf("next daily schedule fired = %d", fired)
+	}
+
+	var runs []model.RSSAutomationRun
+	if err := db.Order("id").Find(&runs).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(runs) != 2 {
+		t.Fatalf("runs = %d, want 2", len(runs))
+	}
+	var entry model.RSSAutomationEntry
+	if err := db.First(&entry, runs[0].EntryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.TriggerType != model.RSSAutomationTriggerCron || entry.SourceID != source.ID {
+		t.Fatalf("unexpected synthetic entry: %#v", entry)
+	}
+	if !entry.DiscoveredAt.Equal(time.Date(2026, 8, 2, 3, 0, 0, 0, time.UTC)) {
+		t.Fatalf("fired_at = %s, want first missed schedule", entry.DiscoveredAt)
+	}
+	var runContext map[string]any
+	if err := json.Unmarshal([]byte(runs[0].ContextJSON), &runContext); err != nil {
+		t.Fatal(err)
+	}
+	if value, _ := resolveRSSAutomationReference(runContext, "$trigger.type"); value != model.RSSAutomationTriggerCron {
+		t.Fatalf("$trigger.type = %#v", value)
+	}
+	if value, _ := resolveRSSAutomationReference(runContext, "$item.scope"); value != "wishlist" {
+		t.Fatalf("$item.scope = %#v", value)
+	}
+
+	// 合成条目不属于源条目，不应出现在手动运行候选与条目历史中
+	candidates, err := automation.ListManualCandidates(workflow.ID, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if candidates.ScannedEntries != 0 {
+		t.Fatalf("synthetic entries scanned as candidates: %#v", candidates)
+	}
+	history, err := automation.ListEntryHistory("", 0, 50, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if history.Total != 0 {
+		t.Fatalf("synthetic entries listed in history: %#v", history)
+	}
+}
+
+func TestRSSAutomationTriggerWorkflowMergesCallerContext(t *testing.T) {
+	db := newRSSAutomationTestDB(t)
+	automation := &RSSAutomationService{db: db, executionWake: make(chan struct{}, 1)}
+	source, workflow := createRSSAutomationTriggerTestWorkflow(t, db, map[string]any{
+		"mode": "manual", "context": map[string]any{"scope": "wishlist", "limit": 10},
+	})
+
+	result, err := automation.TriggerWorkflow(workflow.ID, RSSAutomationTriggerInput{Context: map[string]any{"limit": 3, "title": "补全剧集"}})
+	if err != nil {
+		t.Fatalf("TriggerWorkflow() error = %v", err)
+	}
+	var run model.RSSAutomationRun
+	if err := db.First(&run, result.RunID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if run.EntryID != result.EntryID || run.Status != model.RSSAutomationRunPending {
+		t.Fatalf("unexpected run: %#v", run)
+	}
+	var nodeRuns int64
+	if err := db.Model(&model.RSSAutomationNodeRun{}).Where("run_id = ?", run.ID).Count(&nodeRuns).Error; err != nil {
+		t.Fatal(err)
+	}
+	if nodeRuns != 2 {
+		t.Fatalf("node runs = %d, want 2", nodeRuns)
+	}
+	var entry model.RSSAutomationEntry
+	if err := db.First(&entry, run.EntryID).Error; err != nil {
+		t.Fatal(err)
+	}
+	if entry.TriggerType != model.RSSAutomationTriggerAPI || entry.Title != "补全剧集" {
+		t.Fatalf("unexpected synthetic entry: %#v", entry)
+	}
+	var runContext map[string]any
+	if err := json.Unmarshal([]byte(run.ContextJSON), &runContext); err != nil {
+		t.Fatal(err)
+	}
+	item, _ := runContext["item"].(map[string]any)
+	if item["scope"] != "wishlist" || item["limit"] != float64(3) {
+		t.Fatalf("merged item context = %#v", item)
+	}
+
+	// manual 流程不响应源条目，也不参与源轮询
+	feedEntry := createRSSAutomationManualTestEntry(t, db, source.ID, "feed", "新条目", "magnet:?xt=urn:btih:CCC1", time.Now())
+	created, err := automation.createRSSAutomationRuns(feedEntry)
+	if err != nil || created != 0 {
+		t.Fatalf("feed entry created %d runs for manual workflow (err=%v)", created, err)
+	}
+	if _, skipped := automation.nonFeedRSSAutomationSourceIDs()[source.ID]; !skipped {
+		t.Fatal("source of manual workflow should not be polled")
+	}
+
+	if _, err := automation.TriggerWorkflow(workflow.ID, RSSAutomationTriggerInput{Context: map[string]any{"blob": string(make([]byte, maxRSSAutomationTriggerContextBytes))}}); err == nil {
+		t.Fatal("oversized trigger context unexpectedly accepted")
+	}
+}
+
+func createRSSAutomationTriggerTestWorkflow(t *testing.T, db *gorm.DB, triggerConfig map[string]any) (model.RSSAutomationSource, model.RSSAutomationWorkflow) {
+	t.Helper()
+	definitionJSON, err := MarshalRSSAutomationDefinition(RSSAutomationDefinition{
+		SchemaVersion: RSSAutomationSchemaVersion,
+		Nodes: []RSSAutomationNode{
+			{ID: "trigger", Type: RSSAutomationNodeTrigger, Name: "触发", Config: triggerConfig},
+			{ID: "end", Type: RSSAutomationNodeEnd, Name: "结束"},
+		},
+		Edges: []RSSAutomationEdge{{ID: "e1", Source: "trigger", SourcePort: "next", Target: "end"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := model.RSSAutomationSource{
+		Name: "定时任务", Enabled: true, FeedURL: "https://example.com/feed.xml",
+		IntervalMinutes: 5, MappingJSON: DefaultRSSAutomationMappingJSON(), Initialized: true,
+	}
+	if err := db.Create(&source).Error; err != nil {
+		t.Fatal(err)
+	}
+	workflow := model.RSSAutomationWorkflow{SourceID: source.ID, Name: "心愿单检查", Enabled: true, Version: 1, DefinitionJSON: definitionJSON}
+	if err := db.Create(&workflow).Error; err != nil {
+		t.Fatal(err)
+	}
+	return source, workflow
+}
@@ -0,0 +1,271 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+// ErrStorageOperationUnsupported 表示当前存储驱动不支持该操作（例如只读的 WebDAV 不支持令牌刷新）。
+var ErrStorageOperationUnsupported = errors.New("存储驱动不支持该操作")
+
+// storageWalkMaxDepth 递归遍历云盘目录的最大深度，防止异常目录结构导致无限递归。
+const storageWalkMaxDepth = 50
+
+// StorageEntry 是各存储驱动统一返回的文件/目录信息。
+// ID 为驱动内部的文件标识（115 为 file_id），PickCode 仅对支持提取码的驱动有效，
+// Path 为网盘内的绝对路径（驱动能给出时填充）。
+type StorageEntry struct {
+	ID       string    `json:"id"`
+	ParentID string    `json:"parent_id"`
+	Name     string    `json:"name"`
+	Path     string    `json:"path"`
+	IsDir    bool      `json:"is_dir"`
+	Size     int64     `json:"size"`
+	SHA1     string    `json:"sha1"`
+	PickCode string    `json:"pick_code"`
+	ModTime  time.Time `json:"mod_time"`
+}
+
+// StorageToken 令牌刷新结果；ProviderUID 非空时由调用方回填到存储配置。
+type StorageToken struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	ProviderUID  string
+}
+
+// StorageDriver 网盘存储驱动，屏蔽不同云盘的 API 差异。
+// STRM 生成、302 直链、整理与令牌刷新只依赖这组能力，新增云盘只需实现驱动并注册。
+type StorageDriver interface {
+	// Type 返回驱动对应的 model.CloudStorage.StorageType。
+	Type() string
+	// List 列出目录下的直接子项，dirID 为空时表示根目录。
+	List(ctx context.Context, dirID string) ([]StorageEntry, error)
+	// ResolvePath 将网盘内绝对路径解析为文件或目录；不存在时返回 found=false。
+	ResolvePath(ctx context.Context, filePath string) (StorageEntry, bool, error)
+	// DirectLink 获取文件的直链，userAgent 会透传给需要绑定 UA 的云盘。
+	DirectLink(ctx context.Context, entry StorageEntry, userAgent string) (string, error)
+	Rename(ctx context.Context, fileID, newName string) error
+	Move(ctx context.Context, fileIDs []string, dirID string) error
+	Delete(ctx context.Context, fileIDs []string) error
+	// RefreshToken 刷新访问令牌；无令牌概念的驱动返回 ErrStorageOperationUnsupported。
+	RefreshToken(ctx context.Context) (StorageToken, error)
+}
+
+// StorageDriverFactory 根据存储配置创建驱动实例。
+type StorageDriverFactory func(storage model.CloudStorage, log *logger.Logger) (StorageDriver, error)
+
+// StorageDriverInfo 描述一个已注册的存储类型，供前端下拉展示。
+type StorageDriverInfo struct {
+	Type        string `json:"type"`
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type storageDriverRegistration struct {
+	info    StorageDriverInfo
+	factory StorageDriverFactory
+}
+
+var (
+	storageDriversMu sync.RWMutex
+	storageDrivers   = map[string]storageDriverRegistration{}
+)
+
+// RegisterStorageDriver 注册存储驱动；同一类型重复注册时后者覆盖前者。
+func RegisterStorageDriver(info StorageDriverInfo, factory StorageDriverFactory) {
+	storageType := strings.TrimSpace(info.Type)
+	if storageType == "" || factory == nil {
+		return
+	}
+	info.Type = storageType
+	storageDriversMu.Lock()
+	defer storageDriversMu.Unlock()
+	storageDrivers[storageType] = storageDriverRegistration{info: info, factory: factory}
+}
+
+// NewStorageDriver 为存储配置创建对应驱动。
+func NewStorageDriver(storage model.CloudStorage, log *logger.Logger) (StorageDriver, error) {
+	storageDriversMu.RLock()
+	registration, ok := storageDrivers[strings.TrimSpace(storage.StorageType)]
+	storageDriversMu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("不支持的存储类型: %s", storage.StorageType)
+	}
+	return registration.factory(storage, log)
+}
+
+// playbackStorageDriver 由 302 播放时需要改变访问方式的驱动实现，例如 115 在播放时按
+// Match302 访问方式在 OpenAPI 与 Cookie 间降级解析路径，而 STRM 遍历只走 OpenAPI。
+type playbackStorageDriver interface {
+	forPlayback() StorageDriver
+}
+
+// NewPlaybackStorageDriver 创建 302 播放使用的驱动；驱动不区分访问方式时与 NewStorageDriver 相同。
+func NewPlaybackStorageDriver(storage model.CloudStorage, log *logger.Logger) (StorageDriver, error) {
+	drv, err := NewStorageDriver(storage, log)
+	if err != nil {
+		return nil, err
+	}
+	if playback, ok := drv.(playbackStorageDriver); ok {
+		return playback.forPlayback(), nil
+	}
+	return drv, nil
+}
+
+// StorageDriverCache 按存储缓存 302 播放使用的驱动，避免每次播放请求都重新创建；
+// 存储的令牌、Cookie、配置或访问方式变化后自动重建。
+type StorageDriverCache struct {
+	logger  *logger.Logger
+	mu      sync.Mutex
+	entries map[uint]storageDriverCacheEntry
+}
+
+type storageDriverCacheEntry struct {
+	fingerprint [sha256.Size]byte
+	driver      StorageDriver
+}
+
+// NewStorageDriverCache 创建播放驱动缓存
+func NewStorageDriverCache(log *logger.Logger) *StorageDriverCache {
+	return &StorageDriverCache{logger: log, entries: make(map[uint]storageDriverCacheEntry)}
+}
+
+// Get 返回存储对应的播放驱动；c 为 nil 时不缓存
+func (c *StorageDriverCache) Get(storage model.CloudStorage) (StorageDriver, error) {
+	if c == nil {
+		return NewPlaybackStorageDriver(storage, nil)
+	}
+	fingerprint := storageDriverFingerprint(storage)
+	c.mu.Lock()
+	entry, ok := c.entries[storage.ID]
+	c.mu.Unlock()
+	if ok && entry.fingerprint == fingerprint {
+		return entry.driver, nil
+	}
+	drv, err := NewPlaybackStorageDriver(storage, c.logger)
+	if err != nil {
+		return nil, err
+	}
+	c.mu.Lock()
+	c.entries[storage.ID] = storageDriverCacheEntry{fingerprint: fingerprint, driver: drv}
+	c.mu.Unlock()
+	return drv, nil
+}
+
+// storageDriverFingerprint 汇总驱动创建时读取的存储字段
+func storageDriverFingerprint(storage model.CloudStorage) [sha256.Size]byte {
+	return sha256.Sum256([]byte(strings.Join([]string{
+		storage.StorageType, storage.AppID, storage.AppSecret, storage.AccessToken, storage.RefreshToken,
+		storage.Cookie, storage.Config, storage.Match302AccessModeValue(), storage.ProviderUID,
+	}, "\x00")))
+}
+
+// IsSupportedStorageType 判断存储类型是否已注册驱动。
+func IsSupportedStorageType(storageType string) bool {
+	storageDriversMu.RLock()
+	defer storageDriversMu.RUnlock()
+	_, ok := storageDrivers[strings.TrimSpace(storageType)]
+	return ok
+}
+
+// StorageDriverInfos 返回所有已注册的存储类型，按类型名排序保证输出稳定。
+func StorageDriverInfos() []StorageDriverInfo {
+	storageDriversMu.RLock()
+	infos := make([]StorageDriverInfo, 0, len(storageDrivers))
+	for _, registration := range storageDrivers {
+		infos = append(infos, registration.info)
+	}
+	storageDriversMu.RUnlock()
+	sort.Slice(infos, func(i, j int) bool { return infos[i].Type < infos[j].Type })
+	return infos
+}
+
+// WalkStorageDir 递归遍历驱动目录树，对每个文件调用 visit。
+// currentPath 为该目录在调用方路径空间中的路径，子项路径在其基础上拼接。
+// visit 返回错误时立即停止遍历；列目录失败的子目录只记录日志并跳过，与原 115 遍历行为一致。
+func WalkStorageDir(
+	ctx context.Context,
+	drv StorageDriver,
+	dirID, currentPath string,
+	log *logger.Logger,
+	visit func(filePath string, entry StorageEntry) error,
+) error {
+	return walkStorageDir(ctx, drv, dirID, currentPath, 0, false, log, visit)
+}
+
+// WalkStorageDirStrict 与 WalkStorageDir 相同，但任一目录列举失败都会中止遍历并返回错误。
+// 用于需要完整目录树才能得出正确结论的场景（如 STRM 对账判断孤儿文件）。
+func WalkStorageDirStrict(
+	ctx context.Context,
+	drv StorageDriver,
+	dirID, currentPath string,
+	log *logger.Logger,
+	visit func(filePath string, entry StorageEntry) error,
+) error {
+	return walkStorageDir(ctx, drv, dirID, currentPath, 0, true, log, visit)
+}
+
+func walkStorageDir(
+	ctx context.Context,
+	drv StorageDriver,
+	dirID, currentPath string,
+	depth int,
+	strict bool,
+	log *logger.Logger,
+	visit func(filePath string, entry StorageEntry) error,
+) error {
+	if depth >= storageWalkMaxDepth {
+		if strict {
+			return fmt.Errorf("达到最大递归深度 %d: %s", storageWalkMaxDepth, currentPath)
+		}
+		if log != nil {
+			log.Warnf("达到最大递归深度 %d，停止遍历: %s", storageWalkMaxDepth, currentPath)
+		}
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	entries, err := drv.List(ctx, dirID)
+	if err != nil {
+		if strict {
+			return fmt.Errorf("获取%s目录文件列表失败: %s: %w", drv.Type(), currentPath, err)
+		}
+		if log != nil {
+			log.Errorf("获取%s目录文件列表失败: ID=%s, 错误: %v", drv.Type(), dirID, err)
+		}
+		return nil
+	}
+	if log != nil {
+		log.Debugf("获取到 %d 个文件/目录, ID: %s", len(entries), dirID)
+	}
+
+	for _, entry := range entries {
+		entryPath := path.Join(currentPath, entry.Name)
+		if entry.IsDir {
+			if log != nil {
+				log.Debugf("发现目录: %s", entryPath)
+			}
+			if err := walkStorageDir(ctx, drv, entry.ID, entryPath, depth+1, strict, log, visit); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := visit(entryPath, entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,527 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+
+	sdk115 "github.com/OpenListTeam/115-sdk-go"
+	driver "github.com/SheltonZhu/115driver/pkg/driver"
+)
+
+// open115ListPageLimit 115 OpenAPI 单页最多返回 1150 条。
+const open115ListPageLimit = 1150
+
+func init() {
+	RegisterStorageDriver(StorageDriverInfo{
+		Type:        model.StorageType115Open,
+		Name:        "115网盘 Open API",
+		Description: "115网盘存储 Open API",
+	}, newOpen115Driver)
+}
+
+// open115Driver 115 网盘驱动：直链与文件操作按存储的 Match302 访问方式依次尝试 OpenAPI 与 Cookie；
+// 列目录与路径解析默认只走 OpenAPI（STRM 遍历、对账），playback 为 true 时才同样按 Match302 访问方式降级。
+type open115Driver struct {
+	storage   model.CloudStorage
+	logger    *logger.Logger
+	web115Svc *Web115Service
+	playback  bool
+}
+
+func newOpen115Driver(storage model.CloudStorage, log *logger.Logger) (StorageDriver, error) {
+	return &open115Driver{
+		storage:   storage,
+		logger:    log,
+		web115Svc: NewWeb115Service(log),
+	}, nil
+}
+
+func (d *open115Driver) Type() string {
+	return model.StorageType115Open
+}
+
+func (d *open115Driver) forPlayback() StorageDriver {
+	copied := *d
+	copied.playback = true
+	return &copied
+}
+
+func (d *open115Driver) accessOrder() []string {
+	return model.Match302AccessOrder(d.storage.Match302AccessModeValue())
+}
+
+// walkAccessOrder 列目录与路径解析使用的访问方式
+func (d *open115Driver) walkAccessOrder() []string {
+	if d.playback {
+		return d.accessOrder()
+	}
+	return []string{model.Match302AccessMethodOpenAPI}
+}
+
+func (d *open115Driver) openAPIClient() (*sdk115.Client, error) {
+	accessToken := strings.TrimSpace(d.storage.AccessToken)
+	if accessToken == "" {
+		return nil, fmt.Errorf("OpenAPI AccessToken 缺失")
+	}
+	return sdk115.New(sdk115.WithAccessToken(accessToken)), nil
+}
+
+func (d *open115Driver) cookieClient(ctx context.Context) (*driver.Pan115Client, error) {
+	if strings.TrimSpace(d.storage.Cookie) == "" {
+		return nil, fmt.Errorf("Cookie 缺失")
+	}
+	client, err := d.web115Svc.NewClientWithContext(ctx, d.storage.Cookie, 0)
+	if err != nil {
+		return nil, fmt.Errorf("115 Cookie 无效: %w", err)
+	}
+	return client, nil
+}
+
+// tryAccessMethods 按 order 依次执行 fn，直到某一方式成功；全部失败时合并错误。
+func (d *open115Driver) tryAccessMethods(action string, order []string, fn func(method string) error) error {
+	var attemptErrors []error
+	for _, method := range order {
+		err := fn(method)
+		if err == nil {
+			if len(attemptErrors) > 0 && d.logger != nil {
+				d.logger.Warnf("115 %s 已降级到 %s storage=%d", action, method, d.storage.ID)
+			}
+			return nil
+		}
+		attemptErrors = append(attemptErrors, fmt.Errorf("%s: %w", method, err))
+	}
+	return fmt.Errorf("115 %s 失败 methods=%s: %w", action, strings.Join(order, ","), errors.Join(attemptErrors...))
+}
+
+func (d *open115Driver) List(ctx context.Context, dirID string) ([]StorageEntry, error) {
+	dirID = strings.TrimSpace(dirID)
+	if dirID == "" {
+		dirID = "0"
+	}
+	var entries []StorageEntry
+	err := d.tryAccessMethods("列目录", d.walkAccessOrder(), func(method string) error {
+		var err error
+		switch method {
+		case model.Match302AccessMethodOpenAPI:
+			entries, err = d.listWithOpenAPI(ctx, dirID)
+		case model.Match302AccessMethodCookie:
+			entries, err = d.listWithCookie(ctx, dirID)
+		}
+		return err
+	})
+	return entries, err
+}
+
+func (d *open115Driver) listWithOpenAPI(ctx context.Context, dirID string) ([]StorageEntry, error) {
+	client, err := d.openAPIClient()
+	if err != nil {
+		return nil, err
+	}
+	req := &sdk115.GetFilesReq{
+		CID:     dirID,
+		ShowDir: true, // 显示目录
+		Stdir:   1,    // 显示文件夹
+		Limit:   open115ListPageLimit,
+		Offset:  0,
+	}
+	var entries []StorageEntry
+	for {
+		resp, err := client.GetFiles(ctx, req)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range resp.Data {
+			entry := StorageEntry{
+				ID:       strings.TrimSpace(file.Fid),
+				ParentID: dirID,
+				Name:     file.Fn,
+				IsDir:    file.Fc == "0",
+				Size:     file.FS,
+				SHA1:     file.Sha1,
+				PickCode: file.Pc,
+			}
+			if file.Upt > 0 {
+				entry.ModTime = time.Unix(file.Upt, 0)
+			}
+			entries = append(entries, entry)
+		}
+		if req.Offset+req.Limit >= resp.Count || len(resp.Data) == 0 {
+			break
+		}
+		req.Offset += req.Limit
+	}
+	return entries, nil
+}
+
+func (d *open115Driver) listWithCookie(ctx context.Context, dirID string) ([]StorageEntry, error) {
+	client, err := d.cookieClient(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var entries []StorageEntry
+	collect := func(list func(offset, limit int) (Web115ListResult, error)) error {
+		limit := int(driver.MaxDirPageLimit)
+		for offset := 0; ; offset += limit {
+			result, err := list(offset, limit)
+			if err != nil {
+				return err
+			}
+			for _, item := range result.Items {
+				entries = append(entries, web115FileToStorageEntry(item, dirID))
+			}
+			if len(result.Items) == 0 || int64(offset+limit) >= result.Total {
+				return nil
+			}
+		}
+	}
+	if err := collect(func(offset, limit int) (Web115ListResult, error) {
+		return d.web115Svc.GetDirectoriesWithClient(client, dirID, offset, limit)
+	}); err != nil {
+		return nil, err
+	}
+	if err := collect(func(offset, limit int) (Web115ListResult, error) {
+		return d.web115Svc.GetFilesWithClient(client, dirID, offset, limit)
+	}); err != nil {
+		return nil, err
+	}
+	return dedupeStorageEntries(entries), nil
+}
+
+func (d *open115Driver) ResolvePath(ctx context.Context, filePath string) (StorageEntry, bool, error) {
+	filePath = strings.TrimSpace(filePath)
+	if decoded, err := url.PathUnescape(filePath); err == nil {
+		filePath = decoded
+	}
+	normalizedPath := path.Clean("/" + strings.TrimPrefix(filePath, "/"))
+	if normalizedPath == "/" {
+		return StorageEntry{ID: "0", Name: "/", Path: "/", IsDir: true}, true, nil
+	}
+
+	var (
+		entry    StorageEntry
+		found    bool
+		misses   int
+		attempts int
+	)
+	err := d.tryAccessMethods("路径解析", d.walkAccessOrder(), func(method string) error {
+		attempts++
+		var err error
+		switch method {
+		case model.Match302AccessMethodOpenAPI:
+			entry, found, err = d.resolveWithOpenAPI(ctx, normalizedPath)
+		case model.Match302AccessMethodCookie:
+			entry, found, err = d.resolveWithCookie(ctx, normalizedPath)
+		}
+		if err == nil && !found {
+			misses++
+			return fmt.Errorf("路径不存在: %s", normalizedPath)
+		}
+		return err
+	})
+	if err != nil {
+		// 所有方式都明确返回"不存在"时视为未找到，而不是调用失败。
+		if misses > 0 && misses == attempts {
+			return StorageEntry{}, false, nil
+		}
+		return StorageEntry{}, false, err
+	}
+	return entry, true, nil
+}
+
+func (d *open115Driver) resolveWithOpenAPI(ctx context.Context, normalizedPath string) (StorageEntry, bool, error) {
+	client, err := d.openAPIClient()
+	if err != nil {
+		return StorageEntry{}, false, err
+	}
+	info, err := client.GetFolderInfoByPath(ctx, normalizedPath)
+	if err != nil {
+		return StorageEntry{}, false, err
+	}
+	size, _ := strconv.ParseInt(strings.TrimSpace(info.Size), 10, 64)
+	name := strings.TrimSpace(info.FileName)
+	if name == "" {
+		name = path.Base(normalizedPath)
+	}
+	entry := StorageEntry{
+		ID:       strings.TrimSpace(info.FileID),
+		Name:     name,
+		Path:     normalizedPath,
+		IsDir:    strings.TrimSpace(info.FileCategory) == "0",
+		Size:     size,
+		SHA1:     strings.TrimSpace(info.Sha1),
+		PickCode: strings.TrimSpace(info.PickCode),
+	}
+	if n := len(info.Paths); n > 0 {
+		entry.ParentID = strings.TrimSpace(info.Paths[n-1].FileID)
+	}
+	if utime, err := strconv.ParseInt(strings.TrimSpace(info.UTime), 10, 64); err == nil && utime > 0 {
+		entry.ModTime = time.Unix(utime, 0)
+	}
+	return entry, entry.ID != "", nil
+}
+
+func (d *open115Driver) resolveWithCookie(ctx context.Context, normalizedPath string) (StorageEntry, bool, error) {
+	client, err := d.cookieClient(ctx)
+	if err != nil {
+		return StorageEntry{}, false, err
+	}
+	file, found, err := d.web115Svc.ResolveFilePathWithClient(client, normalizedPath)
+	if err != nil {
+		return StorageEntry{}, false, err
+	}
+	if found {
+		entry := web115FileToStorageEntry(file, "")
+		entry.Path = normalizedPath
+		return entry, true, nil
+	}
+	// 文件未命中时再按目录解析，WalkDir 需要目录的 CID。
+	cid, found, err := d.web115Svc.ResolveDirPathWithClient(client, normalizedPath)
+	if err != nil || !found {
+		return StorageEntry{}, false, err
+	}
+	return StorageEntry{
+		ID:    cid,
+		Name:  path.Base(normalizedPath),
+		Path:  normalizedPath,
+		IsDir: true,
+	}, true, nil
+}
+
+func (d *open115Driver) DirectLink(ctx context.Context, entry StorageEntry, userAgent string) (string, error) {
+	pickcode := strings.TrimSpace(entry.PickCode)
+	if pickcode == "" {
+		return "", fmt.Errorf("pickcode 为空")
+	}
+	return ResolveMatch302DownloadURL(
+		d.storage.Match302AccessModeValue(),
+		func() (string, error) {
+			client, err := d.openAPIClient()
+			if err != nil {
+				return "", err
+			}
+			downURLResp, err := client.DownURL(ctx, pickcode, userAgent)
+			if err != nil {
+				return "", fmt.Errorf("调用 DownURL API 失败: %w", err)
+			}
+			for _, urlInfo := range downURLResp {
+				if rawURL := strings.TrimSpace(urlInfo.URL.URL); rawURL != "" {
+					return rawURL, nil
+				}
+			}
+			return "", fmt.Errorf("OpenAPI DownURL 未返回可用直链")
+		},
+		func() (string, error) {
+			client, err := d.cookieClient(ctx)
+			if err != nil {
+				return "", err
+			}
+			info, err := client.DownloadWithUA(pickcode, userAgent)
+			if err != nil {
+				return "", fmt.Errorf("调用 DownloadWithUA 失败: %w", err)
+			}
+			return strings.TrimSpace(info.Url.Url), nil
+		},
+	)
+}
+
+func (d *open115Driver) Rename(ctx context.Context, fileID, newName string) error {
+	fileID = strings.TrimSpace(fileID)
+	newName = strings.TrimSpace(newName)
+	if fileID == "" || newName == "" {
+		return fmt.Errorf("重命名参数不完整")
+	}
+	return d.tryAccessMethods("重命名", d.accessOrder(), func(method string) error {
+		switch method {
+		case model.Match302AccessMethodOpenAPI:
+			client, err := d.openAPIClient()
+			if err != nil {
+				return err
+			}
+			_, err = client.UpdateFile(ctx, &sdk115.UpdateFileReq{FileID: fileID, FileNma: newName})
+			return err
+		case model.Match302AccessMethodCookie:
+			client, err := d.cookieClient(ctx)
+			if err != nil {
+				return err
+			}
+			return d.web115Svc.BatchRename(client, map[string]string{fileID: newName})
+		}
+		return ErrStorageOperationUnsupported
+	})
+}
+
+func (d *open115Driver) Move(ctx context.Context, fileIDs []string, dirID string) error {
+	ids := compactStorageIDs(fileIDs)
+	dirID = strings.TrimSpace(dirID)
+	if len(ids) == 0 || dirID == "" {
+		return nil
+	}
+	return d.tryAccessMethods("移动", d.accessOrder(), func(method string) error {
+		switch method {
+		case model.Match302AccessMethodOpenAPI:
+			client, err := d.openAPIClient()
+			if err != nil {
+				return err
+			}
+			_, err = client.Move(ctx, &sdk115.MoveReq{FileIDs: strings.Join(ids, ","), ToCid: dirID})
+			return err
+		case model.Match302AccessMethodCookie:
+			client, err := d.cookieClient(ctx)
+			if err != nil {
+				return err
+			}
+			return d.web115Svc.MoveFiles(client, dirID, ids)
+		}
+		return ErrStorageOperationUnsupported
+	})
+}
+
+func (d *open115Driver) Delete(ctx context.Context, fileIDs []string) error {
+	ids := compactStorageIDs(fileIDs)
+	if len(ids) == 0 {
+		return fmt.Errorf("要删除的文件 ID 为空")
+	}
+	return d.tryAccessMethods("删除", d.accessOrder(), func(method string) error {
+		switch method {
+		case model.Match302AccessMethodOpenAPI:
+			client, err := d.openAPIClient()
+			if err != nil {
+				return err
+			}
+			_, err = client.DelFile(ctx, &sdk115.DelFileReq{FileIDs: strings.Join(ids, ",")})
+			return err
+		case model.Match302AccessMethodCookie:
+			client, err := d.cookieClient(ctx)
+			if err != nil {
+				return err
+			}
+			return d.web115Svc.DeleteFilesWithClient(client, ids)
+		}
+		return ErrStorageOperationUnsupported
+	})
+}
+
+// RefreshToken 刷新 115 OpenAPI 令牌，并在 provider_uid 为空时顺带查询账号标识。
+func (d *open115Driver) RefreshToken(ctx context.Context) (StorageToken, error) {
+	if d.storage.RefreshToken == "" {
+		return StorageToken{}, fmt.Errorf("刷新令牌为空，无法刷新")
+	}
+
+	client := sdk115.New(
+		sdk115.WithAccessToken(d.storage.AccessToken),
+		sdk115.WithRefreshToken(d.storage.RefreshToken),
+	)
+	tokenResp, err := client.RefreshToken(ctx)
+	if err != nil {
+		if ctx.Err() == context.DeadlineExceeded {
+			return StorageToken{}, fmt.Errorf("刷新令牌请求超时")
+		}
+		return StorageToken{}, fmt.Errorf("调用115刷新令牌API失败: %w", err)
+	}
+	if tokenResp == nil {
+		return StorageToken{}, fmt.Errorf("115刷新令牌响应为空")
+	}
+	if tokenResp.AccessToken == "" {
+		return StorageToken{}, fmt.Errorf("115返回的访问令牌为空")
+	}
+
+	token := StorageToken{
+		AccessToken:  tokenResp.AccessToken,
+		RefreshToken: tokenResp.RefreshToken,
+		ExpiresIn:    tokenResp.ExpiresIn,
+	}
+	// 如果没有返回新的刷新令牌，使用原来的刷新令牌
+	if token.RefreshToken == "" {
+		token.RefreshToken = d.storage.RefreshToken
+	}
+
+	// 回填 provider_uid（仅在空时触发，避免对旧数据不断重试）
+	if d.storage.ProviderUID == "" {
+		tokenedClient := sdk115.New(sdk115.WithAccessToken(tokenResp.AccessToken))
+		if info, infoErr := tokenedClient.UserInfo(ctx); infoErr != nil {
+			if d.logger != nil {
+				d.logger.Warnf("回填115账号标识失败(storage=%s): %v", d.storage.StorageName, infoErr)
+			}
+		} else if info != nil && info.UserID != 0 {
+			token.ProviderUID = strconv.FormatInt(info.UserID, 10)
+		}
+	}
+	return token, nil
+}
+
+// ResolveMatch302DownloadURL 按访问方式顺序获取 115 直链，任一方式成功即返回。
+func ResolveMatch302DownloadURL(
+	mode string,
+	openAPI func() (string, error),
+	cookie func() (string, error),
+) (string, error) {
+	var attemptErrors []error
+	for _, method := range model.Match302AccessOrder(mode) {
+		var (
+			rawURL string
+			err    error
+		)
+		switch method {
+		case model.Match302AccessMethodOpenAPI:
+			rawURL, err = openAPI()
+		case model.Match302AccessMethodCookie:
+			rawURL, err = cookie()
+		}
+		if err == nil && strings.TrimSpace(rawURL) != "" {
+			return strings.TrimSpace(rawURL), nil
+		}
+		if err == nil {
+			err = fmt.Errorf("未返回可用直链")
+		}
+		attemptErrors = append(attemptErrors, fmt.Errorf("%s: %w", method, err))
+	}
+	return "", fmt.Errorf("Match302 下载方式 %s 全部失败: %w", model.NormalizeMatch302AccessMode(mode), errors.Join(attemptErrors...))
+}
+
+func web115FileToStorageEntry(file Web115File, parentID string) StorageEntry {
+	return StorageEntry{
+		ID:       strings.TrimSpace(file.FileID),
+		ParentID: parentID,
+		Name:     file.Name,
+		IsDir:    !file.IsFile,
+		Size:     file.Size,
+		SHA1:     file.SHA1,
+		PickCode: file.PickCode,
+	}
+}
+
+func dedupeStorageEntries(entries []StorageEntry) []StorageEntry {
+	seen := make(map[string]struct{}, len(entries))
+	result := entries[:0]
+	for _, entry := range entries {
+		if entry.ID != "" {
+			if _, ok := seen[entry.ID]; ok {
+				continue
+			}
+			seen[entry.ID] = struct{}{}
+		}
+		result = append(result, entry)
+	}
+	return result
+}
+
+func compactStorageIDs(ids []string) []string {
+	result := make([]string, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || id == "0" {
+			continue
+		}
+		result = append(result, id)
+	}
+	return result
+}
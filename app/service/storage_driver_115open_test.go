@@ -1,8 +1,10 @@
-package handler
+package service
 
 import (
+	"context"
 	"errors"
 	"reflect"
+	"strings"
 	"testing"
 
 	"film-fusion/app/model"
@@ -20,7 +22,7 @@ func TestResolveMatch302DownloadURLHonorsStrictModes(t *testing.T) {
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			var calls []string
-			got, err := resolveMatch302DownloadURL(
+			got, err := ResolveMatch302DownloadURL(
 				tt.mode,
 				func() (string, error) {
 					calls = append(calls, model.Match302AccessMethodOpenAPI)
@@ -32,7 +34,7 @@ func TestResolveMatch302DownloadURLHonorsStrictModes(t *testing.T) {
 				},
 			)
 			if err != nil {
-				t.Fatalf("resolveMatch302DownloadURL returned error: %v", err)
+				t.Fatalf("ResolveMatch302DownloadURL returned error: %v", err)
 			}
 			if got != tt.want || len(calls) != 1 {
 				t.Fatalf("url=%q calls=%v", got, calls)
@@ -43,7 +45,7 @@ func TestResolveMatch302DownloadURLHonorsStrictModes(t *testing.T) {
 
 func TestResolveMatch302DownloadURLAutoFallsBackToCookie(t *testing.T) {
 	var calls []string
-	got, err := resolveMatch302DownloadURL(
+	got, err := ResolveMatch302DownloadURL(
 		model.Match302AccessModeAuto,
 		func() (string, error) {
 			calls = append(calls, model.Match302AccessMethodOpenAPI)
@@ -55,7 +57,7 @@ func TestResolveMatch302DownloadURLAutoFallsBackToCookie(t *testing.T) {
 		},
 	)
 	if err != nil {
-		t.Fatalf("resolveMatch302DownloadURL returned error: %v", err)
+		t.Fatalf("ResolveMatch302DownloadURL returned error: %v", err)
 	}
 	if got != "cookie-url" || !reflect.DeepEqual(calls, []string{
 		model.Match302AccessMethodOpenAPI,
@@ -64,3 +66,22 @@ func TestResolveMatch302DownloadURLAutoFallsBackToCookie(t *testing.T) {
 		t.Fatalf("url=%q calls=%v", got, calls)
 	}
 }
+
+func TestOpen115DriverWalksWithOpenAPIUnlessPlayback(t *testing.T) {
+	storage := model.CloudStorage{ID: 1, StorageType: model.StorageType115Open, Match302AccessMode: model.Match302AccessModeCookieOnly}
+	drv, err := NewStorageDriver(storage, nil)
+	if err != nil {
+		t.Fatalf("NewStorageDriver: %v", err)
+	}
+	// STRM 遍历不受 Match302 访问方式影响，始终走 OpenAPI
+	if _, err := drv.List(context.Background(), "0"); err == nil || !strings.Contains(err.Error(), "methods=openapi:") {
+		t.Fatalf("walk List error = %v, want OpenAPI only", err)
+	}
+	playback, err := NewPlaybackStorageDriver(storage, nil)
+	if err != nil {
+		t.Fatalf("NewPlaybackStorageDriver: %v", err)
+	}
+	if _, _, err := playback.ResolvePath(context.Background(), "/a.mkv"); err == nil || !strings.Contains(err.Error(), "methods=cookie:") {
+		t.Fatalf("playback ResolvePath error = %v, want cookie only", err)
+	}
+}
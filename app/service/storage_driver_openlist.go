@@ -0,0 +1,354 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+// openListPageSize OpenList fs/list 单页条数。
+const openListPageSize = 500
+
+// openListObjectNotFound OpenList 对不存在的路径返回 code=500，message 含该文本。
+const openListObjectNotFound = "object not found"
+
+func init() {
+	RegisterStorageDriver(StorageDriverInfo{
+		Type:        model.StorageTypeOpenList,
+		Name:        "OpenList / AList",
+		Description: "通过 OpenList(AList) HTTP API 访问，302 使用 fs/get 返回的 raw_url",
+	}, newOpenListDriver)
+}
+
+// openListDriver OpenList(AList) 驱动。OpenList 以路径定位文件，StorageEntry.ID 即网盘内绝对路径。
+type openListDriver struct {
+	storage model.CloudStorage
+	config  model.StorageEndpointConfig
+	logger  *logger.Logger
+	client  *http.Client
+
+	mu    sync.Mutex
+	token string
+}
+
+func newOpenListDriver(storage model.CloudStorage, log *logger.Logger) (StorageDriver, error) {
+	cfg, err := storage.EndpointConfig()
+	if err != nil {
+		return nil, err
+	}
+	return &openListDriver{
+		storage: storage,
+		config:  cfg,
+		logger:  log,
+		client:  &http.Client{Timeout: 30 * time.Second},
+		token:   strings.TrimSpace(storage.AccessToken),
+	}, nil
+}
+
+type openListResponse struct {
+	Code    int             `json:"code"`
+	Message string          `json:"message"`
+	Data    json.RawMessage `json:"data"`
+}
+
+type openListObject struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	IsDir    bool      `json:"is_dir"`
+	Modified time.Time `json:"modified"`
+	RawURL   string    `json:"raw_url"`
+	Sign     string    `json:"sign"`
+	HashInfo struct {
+		SHA1 string `json:"sha1"`
+	} `json:"hash_info"`
+}
+
+func (d *openListDriver) Type() string {
+	return model.StorageTypeOpenList
+}
+
+// fullPath 将 Match302 / STRM 路径空间映射到 OpenList 路径空间。
+func (d *openListDriver) fullPath(p string) string {
+	return storageEndpointPath(d.config.RootPath, p)
+}
+
+func (d *openListDriver) login(ctx context.Context) (string, error) {
+	if d.config.Username == "" {
+		return "", fmt.Errorf("OpenList 未配置令牌或用户名")
+	}
+	body, _ := json.Marshal(map[string]string{"username": d.config.Username, "password": d.config.Password})
+	var data struct {
+		Token string `json:"token"`
+	}
+	if err := d.do(ctx, "/api/auth/login", body, "", &data); err != nil {
+		return "", fmt.Errorf("OpenList 登录失败: %w", err)
+	}
+	if strings.TrimSpace(data.Token) == "" {
+		return "", fmt.Errorf("OpenList 登录未返回令牌")
+	}
+	return data.Token, nil
+}
+
+// call 调用需要鉴权的接口；令牌失效(401)时使用用户名密码重新登录一次。
+func (d *openListDriver) call(ctx context.Context, apiPath string, payload any, result any) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	d.mu.Lock()
+	token := d.token
+	d.mu.Unlock()
+	if token == "" && d.config.Username != "" {
+		if token, err = d.login(ctx); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		d.token = token
+		d.mu.Unlock()
+	}
+	err = d.do(ctx, apiPath, body, token, result)
+	var apiErr *openListAPIError
+	if errors.As(err, &apiErr) && apiErr.Code == http.StatusUnauthorized && d.config.Username != "" {
+		if token, err = d.login(ctx); err != nil {
+			return err
+		}
+		d.mu.Lock()
+		d.token = token
+		d.mu.Unlock()
+		return d.do(ctx, apiPath, body, token, result)
+	}
+	return err
+}
+
+type openListAPIError struct {
+	Code    int
+	Message string
+}
+
+func (e *openListAPIError) Error() string {
+	return fmt.Sprintf("OpenList 返回错误 code=%d: %s", e.Code, e.Message)
+}
+
+func (d *openListDriver) do(ctx context.Context, apiPath string, body []byte, token string, result any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.config.URL+apiPath, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", token)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("请求 OpenList 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 8<<20))
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return &openListAPIError{Code: resp.StatusCode, Message: strings.TrimSpace(string(raw))}
+	}
+	var envelope openListResponse
+	if err := json.Unmarshal(raw, &envelope); err != nil {
+		return fmt.Errorf("解析 OpenList 响应失败: %w", err)
+	}
+	if envelope.Code != http.StatusOK {
+		return &openListAPIError{Code: envelope.Code, Message: envelope.Message}
+	}
+	if result == nil || len(envelope.Data) == 0 || string(envelope.Data) == "null" {
+		return nil
+	}
+	if err := json.Unmarshal(envelope.Data, result); err != nil {
+		return fmt.Errorf("解析 OpenList 数据失败: %w", err)
+	}
+	return nil
+}
+
+func (d *openListDriver) get(ctx context.Context, filePath string) (openListObject, error) {
+	var object openListObject
+	err := d.call(ctx, "/api/fs/get", map[string]any{
+		"path":     d.fullPath(filePath),
+		"password": "",
+	}, &object)
+	return object, err
+}
+
+func (d *openListDriver) entryFromObject(dirPath string, object openListObject) StorageEntry {
+	entryPath := path.Join(pathOrRoot(dirPath), object.Name)
+	return StorageEntry{
+		ID:       entryPath,
+		ParentID: pathOrRoot(dirPath),
+		Name:     object.Name,
+		Path:     entryPath,
+		IsDir:    object.IsDir,
+		Size:     object.Size,
+		SHA1:     strings.ToUpper(strings.TrimSpace(object.HashInfo.SHA1)),
+		ModTime:  object.Modified,
+	}
+}
+
+func (d *openListDriver) List(ctx context.Context, dirID string) ([]StorageEntry, error) {
+	dirPath := pathOrRoot(dirID)
+	var entries []StorageEntry
+	for page := 1; ; page++ {
+		var data struct {
+			Content []openListObject `json:"content"`
+			Total   int              `json:"total"`
+		}
+		if err := d.call(ctx, "/api/fs/list", map[string]any{
+			"path":     d.fullPath(dirPath),
+			"password": "",
+			"page":     page,
+			"per_page": openListPageSize,
+			"refresh":  false,
+		}, &data); err != nil {
+			return nil, err
+		}
+		for _, object := range data.Content {
+			entries = append(entries, d.entryFromObject(dirPath, object))
+		}
+		if len(data.Content) == 0 || len(entries) >= data.Total {
+			break
+		}
+	}
+	return entries, nil
+}
+
+func (d *openListDriver) ResolvePath(ctx context.Context, filePath string) (StorageEntry, bool, error) {
+	filePath = pathOrRoot(filePath)
+	object, err := d.get(ctx, filePath)
+	if err != nil {
+		var apiErr *openListAPIError
+		if errors.As(err, &apiErr) && strings.Contains(strings.ToLower(apiErr.Message), openListObjectNotFound) {
+			return StorageEntry{}, false, nil
+		}
+		return StorageEntry{}, false, err
+	}
+	entry := d.entryFromObject(path.Dir(filePath), object)
+	if filePath == "/" {
+		entry.ID, entry.Path, entry.ParentID = "/", "/", ""
+	}
+	return entry, true, nil
+}
+
+// DirectLink 返回 fs/get 的 raw_url；OpenList 对本地存储等可能返回空 raw_url，此时回退 /d/ 下载地址，
+// 并带上 fs/get 返回的 sign（未开启签名且路径未加密时为空），否则开启了签名的 OpenList 会拒绝该地址。
+func (d *openListDriver) DirectLink(ctx context.Context, entry StorageEntry, _ string) (string, error) {
+	filePath := strings.TrimSpace(entry.Path)
+	if filePath == "" {
+		filePath = strings.TrimSpace(entry.ID)
+	}
+	if filePath == "" {
+		return "", fmt.Errorf("文件路径为空")
+	}
+	object, err := d.get(ctx, filePath)
+	if err != nil {
+		return "", err
+	}
+	if object.IsDir {
+		return "", fmt.Errorf("路径是目录，无法获取直链: %s", filePath)
+	}
+	if rawURL := strings.TrimSpace(object.RawURL); rawURL != "" {
+		return rawURL, nil
+	}
+	link := d.config.URL + "/d" + escapeStoragePath(d.fullPath(filePath))
+	if sign := strings.TrimSpace(object.Sign); sign != "" {
+		link += "?sign=" + url.QueryEscape(sign)
+	}
+	return link, nil
+}
+
+func (d *openListDriver) Rename(ctx context.Context, fileID, newName string) error {
+	return d.call(ctx, "/api/fs/rename", map[string]any{
+		"path": d.fullPath(fileID),
+		"name": newName,
+	}, nil)
+}
+
+func (d *openListDriver) Move(ctx context.Context, fileIDs []string, dirID string) error {
+	for srcDir, names := range groupStoragePathsByDir(fileIDs) {
+		if err := d.call(ctx, "/api/fs/move", map[string]any{
+			"src_dir": d.fullPath(srcDir),
+			"dst_dir": d.fullPath(dirID),
+			"names":   names,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *openListDriver) Delete(ctx context.Context, fileIDs []string) error {
+	for dir, names := range groupStoragePathsByDir(fileIDs) {
+		if err := d.call(ctx, "/api/fs/remove", map[string]any{
+			"dir":   d.fullPath(dir),
+			"names": names,
+		}, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *openListDriver) RefreshToken(context.Context) (StorageToken, error) {
+	return StorageToken{}, ErrStorageOperationUnsupported
+}
+
+func pathOrRoot(p string) string {
+	p = strings.TrimSpace(p)
+	if p == "" || p == "0" {
+		return "/"
+	}
+	return path.Clean("/" + strings.TrimPrefix(p, "/"))
+}
+
+func storageEndpointPath(root, p string) string {
+	return path.Join(pathOrRoot(root), pathOrRoot(p))
+}
+
+func storageEndpointRelative(root, p string) string {
+	root = pathOrRoot(root)
+	p = pathOrRoot(p)
+	if root == "/" {
+		return p
+	}
+	if p == root {
+		return "/"
+	}
+	if strings.HasPrefix(p, root+"/") {
+		return strings.TrimPrefix(p, root)
+	}
+	return p
+}
+
+func escapeStoragePath(p string) string {
+	parts := strings.Split(p, "/")
+	for i, part := range parts {
+		parts[i] = url.PathEscape(part)
+	}
+	return strings.Join(parts, "/")
+}
+
+func groupStoragePathsByDir(paths []string) map[string][]string {
+	grouped := map[string][]string{}
+	for _, p := range paths {
+		p = strings.TrimSpace(p)
+		if p == "" || pathOrRoot(p) == "/" {
+			continue
+		}
+		p = pathOrRoot(p)
+		grouped[path.Dir(p)] = append(grouped[path.Dir(p)], path.Base(p))
+	}
+	return grouped
+}
@@ -0,0 +1,107 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"film-fusion/app/model"
+)
+
+func newOpenListTestServer(t *testing.T) (*httptest.Server, *int) {
+	t.Helper()
+	logins := 0
+	mux := http.NewServeMux()
+	writeJSON := func(w http.ResponseWriter, code int, message string, data any) {
+		_ = json.NewEncoder(w).Encode(map[string]any{"code": code, "message": message, "data": data})
+	}
+	mux.HandleFunc("/api/auth/login", func(w http.ResponseWriter, r *http.Request) {
+		logins++
+		writeJSON(w, 200, "success", map[string]string{"token": "fresh-token"})
+	})
+	mux.HandleFunc("/api/fs/get", func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "fresh-token" {
+			writeJSON(w, 401, "token is expired", nil)
+			return
+		}
+		var req struct {
+			Path string `json:"path"`
+		}
+		_ = json.NewDecoder(r.Body).Decode(&req)
+		switch req.Path {
+		case "/media/TV/E01.mkv":
+			writeJSON(w, 200, "success", map[string]any{"name": "E01.mkv", "size": 42, "raw_url": "https://cdn.example/E01.mkv?t=1"})
+		case "/media/TV/local.mkv":
+			writeJSON(w, 200, "success", map[string]any{"name": "local.mkv", "size": 1})
+		case "/media/TV/signed.mkv":
+			writeJSON(w, 200, "success", map[string]any{"name": "signed.mkv", "size": 1, "sign": "c2lnbg=:0"})
+		default:
+			writeJSON(w, 500, "failed get object: object not found", nil)
+		}
+	})
+	return httptest.NewServer(mux), &logins
+}
+
+func newOpenListTestDriver(t *testing.T, serverURL string) StorageDriver {
+	t.Helper()
+	cfg, _ := json.Marshal(model.StorageEndpointConfig{URL: serverURL + "/", Username: "admin", Password: "pw", RootPath: "/media"})
+	drv, err := NewStorageDriver(model.CloudStorage{
+		StorageType: model.StorageTypeOpenList,
+		AccessToken: "stale-token",
+		Config:      string(cfg),
+	}, nil)
+	if err != nil {
+		t.Fatalf("NewStorageDriver: %v", err)
+	}
+	return drv
+}
+
+func TestOpenListDirectLinkReloginsAndReturnsRawURL(t *testing.T) {
+	server, logins := newOpenListTestServer(t)
+	defer server.Close()
+	drv := newOpenListTestDriver(t, server.URL)
+
+	link, err := drv.DirectLink(context.Background(), StorageEntry{Path: "/TV/E01.mkv"}, "")
+	if err != nil {
+		t.Fatalf("DirectLink: %v", err)
+	}
+	if link != "https://cdn.example/E01.mkv?t=1" {
+		t.Fatalf("link = %q", link)
+	}
+	if *logins != 1 {
+		t.Fatalf("logins = %d, want 1", *logins)
+	}
+
+	link, err = drv.DirectLink(context.Background(), StorageEntry{Path: "/TV/local.mkv"}, "")
+	if err != nil || link != server.URL+"/d/media/TV/local.mkv" {
+		t.Fatalf("fallback link = %q, %v", link, err)
+	}
+	if *logins != 1 {
+		t.Fatalf("token should be reused, logins = %d", *logins)
+	}
+
+	// 开启签名时 /d/ 地址必须带上 fs/get 返回的 sign
+	link, err = drv.DirectLink(context.Background(), StorageEntry{Path: "/TV/signed.mkv"}, "")
+	if err != nil || link != server.URL+"/d/media/TV/signed.mkv?sign=c2lnbg%3D%3A0" {
+		t.Fatalf("signed fallback link = %q, %v", link, err)
+	}
+}
+
+func TestOpenListResolvePathNotFound(t *testing.T) {
+	server, _ := newOpenListTestServer(t)
+	defer server.Close()
+	drv := newOpenListTestDriver(t, server.URL)
+
+	if _, found, err := drv.ResolvePath(context.Background(), "/TV/missing.mkv"); err != nil || found {
+		t.Fatalf("missing path: found=%v err=%v", found, err)
+	}
+	entry, found, err := drv.ResolvePath(context.Background(), "/TV/E01.mkv")
+	if err != nil || !found {
+		t.Fatalf("existing path: found=%v err=%v", found, err)
+	}
+	if entry.Path != "/TV/E01.mkv" || entry.Size != 42 || entry.ParentID != "/TV" {
+		t.Fatalf("entry = %+v", entry)
+	}
+}
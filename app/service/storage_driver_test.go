@@ -0,0 +1,147 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+// fakeStorageDriver 是内存中的目录树，供驱动相关逻辑的测试使用。
+type fakeStorageDriver struct {
+	children map[string][]StorageEntry
+	listErr  map[string]error
+	listed   []string
+}
+
+func (d *fakeStorageDriver) Type() string { return "fake" }
+
+func (d *fakeStorageDriver) List(_ context.Context, dirID string) ([]StorageEntry, error) {
+	d.listed = append(d.listed, dirID)
+	if err := d.listErr[dirID]; err != nil {
+		return nil, err
+	}
+	return d.children[dirID], nil
+}
+
+func (d *fakeStorageDriver) ResolvePath(context.Context, string) (StorageEntry, bool, error) {
+	return StorageEntry{}, false, nil
+}
+
+func (d *fakeStorageDriver) DirectLink(_ context.Context, entry StorageEntry, _ string) (string, error) {
+	return "https://fake/" + entry.PickCode, nil
+}
+
+func (d *fakeStorageDriver) Rename(context.Context, string, string) error { return nil }
+func (d *fakeStorageDriver) Move(context.Context, []string, string) error { return nil }
+func (d *fakeStorageDriver) Delete(context.Context, []string) error       { return nil }
+func (d *fakeStorageDriver) RefreshToken(context.Context) (StorageToken, error) {
+	return StorageToken{}, ErrStorageOperationUnsupported
+}
+
+func TestWalkStorageDirVisitsFilesRecursively(t *testing.T) {
+	drv := &fakeStorageDriver{
+		children: map[string][]StorageEntry{
+			"root": {
+				{ID: "d1", Name: "Season 1", IsDir: true},
+				{ID: "f1", Name: "poster.jpg"},
+				{ID: "broken", Name: "Broken", IsDir: true},
+			},
+			"d1": {
+				{ID: "f2", Name: "E01.mkv", PickCode: "pc2"},
+			},
+		},
+		listErr: map[string]error{"broken": errors.New("rate limited")},
+	}
+
+	var visited []string
+	err := WalkStorageDir(context.Background(), drv, "root", "/TV/Show", nil, func(filePath string, entry StorageEntry) error {
+		visited = append(visited, filePath+"#"+entry.PickCode)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkStorageDir returned error: %v", err)
+	}
+	sort.Strings(visited)
+	want := []string{"/TV/Show/Season 1/E01.mkv#pc2", "/TV/Show/poster.jpg#"}
+	if !reflect.DeepEqual(visited, want) {
+		t.Fatalf("visited = %v, want %v", visited, want)
+	}
+}
+
+func TestWalkStorageDirStopsOnVisitError(t *testing.T) {
+	drv := &fakeStorageDriver{children: map[string][]StorageEntry{
+		"root": {{ID: "f1", Name: "a.mkv"}, {ID: "f2", Name: "b.mkv"}},
+	}}
+	stop := errors.New("stop")
+	calls := 0
+	err := WalkStorageDir(context.Background(), drv, "root", "/", nil, func(string, StorageEntry) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Fatalf("err=%v calls=%d", err, calls)
+	}
+}
+
+func TestStorageDriverRegistry(t *testing.T) {
+	if !IsSupportedStorageType(model.StorageType115Open) {
+		t.Fatal("115open driver should be registered")
+	}
+	drv, err := NewStorageDriver(model.CloudStorage{StorageType: model.StorageType115Open}, nil)
+	if err != nil || drv.Type() != model.StorageType115Open {
+		t.Fatalf("NewStorageDriver = %v, %v", drv, err)
+	}
+	if _, err := NewStorageDriver(model.CloudStorage{StorageType: "unknown"}, nil); err == nil {
+		t.Fatal("unknown storage type should fail")
+	}
+
+	RegisterStorageDriver(StorageDriverInfo{Type: "fake-test"}, func(model.CloudStorage, *logger.Logger) (StorageDriver, error) {
+		return &fakeStorageDriver{}, nil
+	})
+	defer func() {
+		storageDriversMu.Lock()
+		delete(storageDrivers, "fake-test")
+		storageDriversMu.Unlock()
+	}()
+	found := false
+	for _, info := range StorageDriverInfos() {
+		if info.Type == "fake-test" {
+			found = true
+		}
+	}
+	if !found {
+		t.Fatal("registered driver missing from StorageDriverInfos")
+	}
+}
+
+func TestStorageDriverCacheRebuildsOnStorageChange(t *testing.T) {
+	created := 0
+	RegisterStorageDriver(StorageDriverInfo{Type: "fake-cache"}, func(model.CloudStorage, *logger.Logger) (StorageDriver, error) {
+		created++
+		return &fakeStorageDriver{}, nil
+	})
+	t.Cleanup(func() {
+		storageDriversMu.Lock()
+		delete(storageDrivers, "fake-cache")
+		storageDriversMu.Unlock()
+	})
+
+	drivers := NewStorageDriverCache(nil)
+	storage := model.CloudStorage{ID: 3, StorageType: "fake-cache", AccessToken: "a"}
+	first, err := drivers.Get(storage)
+	if err != nil {
+		t.Fatalf("Get: %v", err)
+	}
+	if again, _ := drivers.Get(storage); again != first || created != 1 {
+		t.Fatalf("unchanged storage should reuse the driver, created = %d", created)
+	}
+	storage.AccessToken = "b"
+	if refreshed, _ := drivers.Get(storage); refreshed == first || created != 2 {
+		t.Fatalf("refreshed token should rebuild the driver, created = %d", created)
+	}
+}
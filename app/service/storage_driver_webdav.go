@@ -0,0 +1,301 @@
+package service
+
+import (
+	"context"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+const webDAVPropfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:displayname/><d:resourcetype/><d:getcontentlength/><d:getlastmodified/></d:prop></d:propfind>`
+
+func init() {
+	RegisterStorageDriver(StorageDriverInfo{
+		Type:        model.StorageTypeWebDAV,
+		Name:        "WebDAV",
+		Description: "通用 WebDAV 存储，302 跟随服务端重定向得到真实直链",
+	}, newWebDAVDriver)
+}
+
+// webDAVDriver 通用 WebDAV 驱动。与 OpenList 一样以路径作为 StorageEntry.ID。
+type webDAVDriver struct {
+	storage model.CloudStorage
+	config  model.StorageEndpointConfig
+	base    *url.URL
+	logger  *logger.Logger
+	client  *http.Client
+}
+
+func newWebDAVDriver(storage model.CloudStorage, log *logger.Logger) (StorageDriver, error) {
+	cfg, err := storage.EndpointConfig()
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(cfg.URL)
+	if err != nil || base.Scheme == "" || base.Host == "" {
+		return nil, fmt.Errorf("WebDAV 地址无效: %s", cfg.URL)
+	}
+	return &webDAVDriver{
+		storage: storage,
+		config:  cfg,
+		base:    base,
+		logger:  log,
+		client: &http.Client{
+			Timeout: 30 * time.Second,
+			// 直链解析需要拿到服务端的 302 Location，不能自动跟随。
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+	}, nil
+}
+
+func (d *webDAVDriver) Type() string {
+	return model.StorageTypeWebDAV
+}
+
+// fileURL 返回路径在 WebDAV 服务上的完整地址（不含凭据）。
+func (d *webDAVDriver) fileURL(p string) string {
+	full := storageEndpointPath(path.Join("/", d.base.Path, d.config.RootPath), p)
+	u := *d.base
+	u.Path = full
+	u.RawPath = ""
+	return u.String()
+}
+
+func (d *webDAVDriver) newRequest(ctx context.Context, method, p string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, d.fileURL(p), body)
+	if err != nil {
+		return nil, err
+	}
+	if d.config.Username != "" || d.config.Password != "" {
+		req.SetBasicAuth(d.config.Username, d.config.Password)
+	}
+	return req, nil
+}
+
+type webDAVMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Status string `xml:"status"`
+			Prop   struct {
+				DisplayName   string `xml:"displayname"`
+				ContentLength string `xml:"getcontentlength"`
+				LastModified  string `xml:"getlastmodified"`
+				ResourceType  struct {
+					Collection *struct{} `xml:"collection"`
+				} `xml:"resourcetype"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+func (d *webDAVDriver) propfind(ctx context.Context, p string, depth string) ([]StorageEntry, error) {
+	req, err := d.newRequest(ctx, "PROPFIND", p, strings.NewReader(webDAVPropfindBody))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Depth", depth)
+	req.Header.Set("Content-Type", "application/xml; charset=utf-8")
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("请求 WebDAV 失败: %w", err)
+	}
+	defer resp.Body.Close()
+	raw, _ := io.ReadAll(io.LimitReader(resp.Body, 32<<20))
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus && (resp.StatusCode < 200 || resp.StatusCode >= 300) {
+		return nil, fmt.Errorf("WebDAV PROPFIND 返回 HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	var status webDAVMultistatus
+	if err := xml.Unmarshal(raw, &status); err != nil {
+		return nil, fmt.Errorf("解析 WebDAV 响应失败: %w", err)
+	}
+
+	root := path.Join("/", d.base.Path, d.config.RootPath)
+	entries := make([]StorageEntry, 0, len(status.Responses))
+	for _, response := range status.Responses {
+		href, err := url.Parse(response.Href)
+		if err != nil {
+			continue
+		}
+		entryPath := storageEndpointRelative(root, href.Path)
+		entry := StorageEntry{
+			ID:       entryPath,
+			ParentID: path.Dir(entryPath),
+			Name:     path.Base(entryPath),
+			Path:     entryPath,
+		}
+		for _, propstat := range response.Propstat {
+			if propstat.Status != "" && !strings.Contains(propstat.Status, " 200") {
+				continue
+			}
+			prop := propstat.Prop
+			entry.IsDir = prop.ResourceType.Collection != nil
+			if size, err := strconv.ParseInt(strings.TrimSpace(prop.ContentLength), 10, 64); err == nil {
+				entry.Size = size
+			}
+			if modTime, err := http.ParseTime(strings.TrimSpace(prop.LastModified)); err == nil {
+				entry.ModTime = modTime
+			}
+			if name := strings.TrimSpace(prop.DisplayName); name != "" && entryPath != "/" {
+				entry.Name = name
+			}
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+func (d *webDAVDriver) List(ctx context.Context, dirID string) ([]StorageEntry, error) {
+	dirPath := pathOrRoot(dirID)
+	entries, err := d.propfind(ctx, dirPath, "1")
+	if err != nil {
+		return nil, err
+	}
+	// Depth: 1 的结果包含目录自身，需要剔除。
+	children := entries[:0]
+	for _, entry := range entries {
+		if entry.Path == dirPath {
+			continue
+		}
+		children = append(children, entry)
+	}
+	return children, nil
+}
+
+func (d *webDAVDriver) ResolvePath(ctx context.Context, filePath string) (StorageEntry, bool, error) {
+	filePath = pathOrRoot(filePath)
+	entries, err := d.propfind(ctx, filePath, "0")
+	if err != nil {
+		return StorageEntry{}, false, err
+	}
+	if len(entries) == 0 {
+		return StorageEntry{}, false, nil
+	}
+	entry := entries[0]
+	entry.ID, entry.Path = filePath, filePath
+	return entry, true, nil
+}
+
+// DirectLink 对文件发起不跟随重定向的 GET：
+// OpenList/AList 等 WebDAV 网关会直接 302 到真实直链，此时返回 Location；
+// 否则返回带凭据的 WebDAV 文件地址，由播放器直接访问。
+func (d *webDAVDriver) DirectLink(ctx context.Context, entry StorageEntry, userAgent string) (string, error) {
+	filePath := strings.TrimSpace(entry.Path)
+	if filePath == "" {
+		filePath = strings.TrimSpace(entry.ID)
+	}
+	if filePath == "" {
+		return "", fmt.Errorf("文件路径为空")
+	}
+	req, err := d.newRequest(ctx, http.MethodGet, filePath, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Range", "bytes=0-0")
+	if userAgent != "" {
+		req.Header.Set("User-Agent", userAgent)
+	}
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("请求 WebDAV 直链失败: %w", err)
+	}
+	defer resp.Body.Close()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	switch {
+	case resp.StatusCode >= 300 && resp.StatusCode < 400:
+		location, err := resp.Location()
+		if err != nil {
+			return "", fmt.Errorf("WebDAV 重定向缺少 Location: %w", err)
+		}
+		return location.String(), nil
+	case resp.StatusCode >= 200 && resp.StatusCode < 300:
+		u, err := url.Parse(d.fileURL(filePath))
+		if err != nil {
+			return "", err
+		}
+		if d.config.Username != "" || d.config.Password != "" {
+			u.User = url.UserPassword(d.config.Username, d.config.Password)
+		}
+		return u.String(), nil
+	default:
+		return "", fmt.Errorf("WebDAV 直链请求返回 HTTP %d", resp.StatusCode)
+	}
+}
+
+func (d *webDAVDriver) move(ctx context.Context, src, dst string) error {
+	req, err := d.newRequest(ctx, "MOVE", src, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Destination", d.fileURL(dst))
+	req.Header.Set("Overwrite", "F")
+	return d.expectSuccess(req, "MOVE")
+}
+
+func (d *webDAVDriver) expectSuccess(req *http.Request, action string) error {
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("WebDAV %s 失败: %w", action, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		raw, _ := io.ReadAll(io.LimitReader(resp.Body, 4<<10))
+		return fmt.Errorf("WebDAV %s 返回 HTTP %d: %s", action, resp.StatusCode, strings.TrimSpace(string(raw)))
+	}
+	return nil
+}
+
+func (d *webDAVDriver) Rename(ctx context.Context, fileID, newName string) error {
+	src := pathOrRoot(fileID)
+	return d.move(ctx, src, path.Join(path.Dir(src), newName))
+}
+
+func (d *webDAVDriver) Move(ctx context.Context, fileIDs []string, dirID string) error {
+	for _, fileID := range fileIDs {
+		src := pathOrRoot(fileID)
+		if src == "/" {
+			continue
+		}
+		if err := d.move(ctx, src, path.Join(pathOrRoot(dirID), path.Base(src))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *webDAVDriver) Delete(ctx context.Context, fileIDs []string) error {
+	for _, fileID := range fileIDs {
+		target := pathOrRoot(fileID)
+		if target == "/" {
+			continue
+		}
+		req, err := d.newRequest(ctx, http.MethodDelete, target, nil)
+		if err != nil {
+			return err
+		}
+		if err := d.expectSuccess(req, "DELETE"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (d *webDAVDriver) RefreshToken(context.Context) (StorageToken, error) {
+	return StorageToken{}, ErrStorageOperationUnsupported
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"film-fusion/app/model"
+)
+
+const webDAVTestMultistatus = `<?xml version="1.0" encoding="utf-8"?>
+<D:multistatus xmlns:D="DAV:">
+<D:response><D:href>/dav/media/TV/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>
+<D:response><D:href>/dav/media/TV/Season%201/</D:href><D:propstat><D:prop><D:resourcetype><D:collection/></D:resourcetype></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>
+<D:response><D:href>/dav/media/TV/E01.mkv</D:href><D:propstat><D:prop><D:resourcetype/><D:getcontentlength>42</D:getcontentlength><D:getlastmodified>Mon, 02 Jan 2006 15:04:05 GMT</D:getlastmodified></D:prop><D:status>HTTP/1.1 200 OK</D:status></D:propstat></D:response>
+</D:multistatus>`
+
+func newWebDAVTestDriver(t *testing.T, serverURL string) StorageDriver {
+	t.Helper()
+	cfg, _ := json.Marshal(model.StorageEndpointConfig{URL: serverURL + "/dav", Username: "u", Password: "p", RootPath: "/media"})
+	drv, err := NewStorageDriver(model.CloudStorage{StorageType: model.StorageTypeWebDAV, Config: string(cfg)}, nil)
+	if err != nil {
+		t.Fatalf("NewStorageDriver: %v", err)
+	}
+	return drv
+}
+
+func TestWebDAVListParsesMultistatus(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "u" || pass != "p" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method != "PROPFIND" || r.URL.Path != "/dav/media/TV" || r.Header.Get("Depth") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		_, _ = w.Write([]byte(webDAVTestMultistatus))
+	}))
+	defer server.Close()
+
+	entries, err := newWebDAVTestDriver(t, server.URL).List(context.Background(), "/TV")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("entries = %+v", entries)
+	}
+	if entries[0].Path != "/TV/Season 1" || !entries[0].IsDir {
+		t.Fatalf("dir entry = %+v", entries[0])
+	}
+	if entries[1].Path != "/TV/E01.mkv" || entries[1].IsDir || entries[1].Size != 42 || entries[1].ModTime.IsZero() {
+		t.Fatalf("file entry = %+v", entries[1])
+	}
+}
+
+func TestWebDAVDirectLinkReturnsRedirectLocation(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/dav/media/TV/E01.mkv":
+			http.Redirect(w, r, "https://cdn.example/E01.mkv?t=1", http.StatusFound)
+		case "/dav/media/TV/plain.mkv":
+			w.WriteHeader(http.StatusPartialContent)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	drv := newWebDAVTestDriver(t, server.URL)
+
+	link, err := drv.DirectLink(context.Background(), StorageEntry{Path: "/TV/E01.mkv"}, "Infuse")
+	if err != nil || link != "https://cdn.example/E01.mkv?t=1" {
+		t.Fatalf("redirect link = %q, %v", link, err)
+	}
+	link, err = drv.DirectLink(context.Background(), StorageEntry{Path: "/TV/plain.mkv"}, "")
+	if err != nil || link != "http://u:p@"+server.Listener.Addr().String()+"/dav/media/TV/plain.mkv" {
+		t.Fatalf("plain link = %q, %v", link, err)
+	}
+	if _, err := drv.DirectLink(context.Background(), StorageEntry{Path: "/TV/missing.mkv"}, ""); err == nil {
+		t.Fatal("missing file should fail")
+	}
+}
@@ -0,0 +1,382 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/mediaprobe"
+)
+
+const (
+	// StrmMediaInfoSuffix Emby 媒体信息旁路文件后缀，与 STRM 同名
+	StrmMediaInfoSuffix = "-mediainfo.json"
+	// strmMediaInfoProbeBytes 单个文件最多读取的字节数，moov 在文件尾时只会读取头尾少量数据
+	strmMediaInfoProbeBytes = 16 << 20
+	strmMediaInfoTimeout    = 2 * time.Minute
+	// strmMediaInfoUserAgent 获取直链与 Range 读取使用同一 UA，115 直链会校验 UA
+	strmMediaInfoUserAgent = "FilmFusion-MediaProbe/1.0"
+
+	// 探测在后台队列中执行：队列满时丢弃，下次生成同一 STRM 会重新入队
+	strmMediaInfoQueueSize = 1024
+	strmMediaInfoWorkers   = 2
+	// strmMediaInfoInterval 相邻两次探测的最小间隔(全局)，避免批量生成 STRM 时触发网盘直链风控
+	strmMediaInfoInterval = 2 * time.Second
+)
+
+// strmMediaInfoJob 一次待执行的媒体信息探测
+type strmMediaInfoJob struct {
+	localPath    string
+	relativeBase string
+	eventPath    string
+	cloudPath    model.CloudPath
+	entry        StorageEntry
+}
+
+func (j strmMediaInfoJob) key() string {
+	return j.localPath + "\x00" + j.relativeBase
+}
+
+// strmMediaInfoQueue 有界、限速的媒体信息探测队列，STRM 生成只负责入队，不做任何网络请求
+type strmMediaInfoQueue struct {
+	logger   *logger.Logger
+	interval time.Duration
+	jobs     chan strmMediaInfoJob
+	start    sync.Once
+
+	mu      sync.Mutex
+	pending map[string]bool
+	next    time.Time
+	wg      sync.WaitGroup
+}
+
+var (
+	defaultStrmMediaInfoQueue     *strmMediaInfoQueue
+	defaultStrmMediaInfoQueueOnce sync.Once
+)
+
+func newStrmMediaInfoQueue(log *logger.Logger, interval time.Duration) *strmMediaInfoQueue {
+	return &strmMediaInfoQueue{
+		logger:   log,
+		interval: interval,
+		jobs:     make(chan strmMediaInfoJob, strmMediaInfoQueueSize),
+		pending:  map[string]bool{},
+	}
+}
+
+// mediaInfoQueue 返回服务使用的探测队列，未单独指定时所有 StrmService 共享同一个队列
+func (s *StrmService) mediaInfoQueue() *strmMediaInfoQueue {
+	if s.mediaInfoProbes != nil {
+		return s.mediaInfoProbes
+	}
+	defaultStrmMediaInfoQueueOnce.Do(func() {
+		defaultStrmMediaInfoQueue = newStrmMediaInfoQueue(s.logger, strmMediaInfoInterval)
+	})
+	return defaultStrmMediaInfoQueue
+}
+
+// enqueue 加入探测任务；同一 STRM 已在排队时忽略，队列已满时丢弃并返回 false
+func (q *strmMediaInfoQueue) enqueue(job strmMediaInfoJob) bool {
+	q.start.Do(func() {
+		for range strmMediaInfoWorkers {
+			go q.worker()
+		}
+	})
+	key := job.key()
+	q.mu.Lock()
+	if q.pending[key] {
+		q.mu.Unlock()
+		return true
+	}
+	q.pending[key] = true
+	q.wg.Add(1)
+	q.mu.Unlock()
+
+	select {
+	case q.jobs <- job:
+		return true
+	default:
+		q.done(key)
+		return false
+	}
+}
+
+func (q *strmMediaInfoQueue) done(key string) {
+	q.mu.Lock()
+	delete(q.pending, key)
+	q.mu.Unlock()
+	q.wg.Done()
+}
+
+// wait 等待已入队的探测全部完成
+func (q *strmMediaInfoQueue) wait() {
+	q.wg.Wait()
+}
+
+// throttle 按全局间隔排队等待下一次探测时机
+func (q *strmMediaInfoQueue) throttle() {
+	q.mu.Lock()
+	now := time.Now()
+	at := q.next
+	if at.Before(now) {
+		at = now
+	}
+	q.next = at.Add(q.interval)
+	q.mu.Unlock()
+	time.Sleep(time.Until(at))
+}
+
+func (q *strmMediaInfoQueue) worker() {
+	for job := range q.jobs {
+		q.run(job)
+	}
+}
+
+func (q *strmMediaInfoQueue) run(job strmMediaInfoJob) {
+	defer q.done(job.key())
+	defer func() {
+		if r := recover(); r != nil {
+			q.logger.Errorf("生成媒体信息旁路文件 panic %s: %v", job.eventPath, r)
+		}
+	}()
+
+	localRoot, err := os.OpenRoot(job.localPath)
+	if err != nil {
+		q.logger.Warnf("打开 STRM 根目录失败 %s: %v", job.localPath, err)
+		return
+	}
+	defer localRoot.Close()
+	// 排队期间 STRM 可能已被删除或旁路文件已由其他任务写好，这两种情况都不再探测
+	if !rootFileExists(localRoot, job.relativeBase+".strm") || !strmMediaInfoMissing(localRoot, job.relativeBase, job.cloudPath.MediaInfoSidecar) {
+		return
+	}
+	q.throttle()
+	svc := &StrmService{logger: q.logger}
+	if err := svc.writeStrmMediaInfo(localRoot, job.relativeBase, job.eventPath, job.cloudPath, job.entry); err != nil {
+		q.logger.Warnf("生成媒体信息旁路文件失败 %s: %v", job.eventPath, err)
+	}
+}
+
+// strmMediaInfoMissing 按配置判断是否还缺少旁路文件
+func strmMediaInfoMissing(localRoot *os.Root, relativeBase, sidecar string) bool {
+	needJSON := (sidecar == model.MediaInfoSidecarJSON || sidecar == model.MediaInfoSidecarBoth) && !rootFileExists(localRoot, relativeBase+StrmMediaInfoSuffix)
+	needNFO := (sidecar == model.MediaInfoSidecarNFO || sidecar == model.MediaInfoSidecarBoth) && !rootFileExists(localRoot, relativeBase+".nfo")
+	return needJSON || needNFO
+}
+
+// strmMediaInfoSource Emby MediaSourceInfo 中与探测结果相关的字段
+type strmMediaInfoSource struct {
+	Protocol     string                `json:"Protocol"`
+	Container    string                `json:"Container"`
+	Size         int64                 `json:"Size,omitempty"`
+	Bitrate      int64                 `json:"Bitrate,omitempty"`
+	RunTimeTicks int64                 `json:"RunTimeTicks,omitempty"`
+	Name         string                `json:"Name,omitempty"`
+	MediaStreams []strmMediaInfoStream `json:"MediaStreams"`
+}
+
+// strmMediaInfoStream Emby MediaStream
+type strmMediaInfoStream struct {
+	Codec                string `json:"Codec"`
+	Type                 string `json:"Type"`
+	Index                int    `json:"Index"`
+	IsDefault            bool   `json:"IsDefault"`
+	IsExternal           bool   `json:"IsExternal"`
+	Language             string `json:"Language,omitempty"`
+	Title                string `json:"Title,omitempty"`
+	Width                int    `json:"Width,omitempty"`
+	Height               int    `json:"Height,omitempty"`
+	AspectRatio          string `json:"AspectRatio,omitempty"`
+	Channels             int    `json:"Channels,omitempty"`
+	SampleRate           int    `json:"SampleRate,omitempty"`
+	IsTextSubtitleStream bool   `json:"IsTextSubtitleStream,omitempty"`
+}
+
+// strmMediaInfoNFO 仅包含 fileinfo 的 NFO，刮削器写入完整 NFO 时会覆盖
+type strmMediaInfoNFO struct {
+	XMLName  xml.Name
+	FileInfo struct {
+		StreamDetails struct {
+			Video    []strmNFOVideo    `xml:"video"`
+			Audio    []strmNFOAudio    `xml:"audio"`
+			Subtitle []strmNFOSubtitle `xml:"subtitle"`
+		} `xml:"streamdetails"`
+	} `xml:"fileinfo"`
+}
+
+type strmNFOVideo struct {
+	Codec             string `xml:"codec"`
+	Aspect            string `xml:"aspect,omitempty"`
+	Width             int    `xml:"width,omitempty"`
+	Height            int    `xml:"height,omitempty"`
+	DurationInSeconds int    `xml:"durationinseconds,omitempty"`
+}
+
+type strmNFOAudio struct {
+	Codec    string `xml:"codec"`
+	Language string `xml:"language,omitempty"`
+	Channels int    `xml:"channels,omitempty"`
+}
+
+type strmNFOSubtitle struct {
+	Codec    string `xml:"codec,omitempty"`
+	Language string `xml:"language,omitempty"`
+}
+
+// writeStrmMediaInfo 探测云端文件并在 STRM 旁写入媒体信息旁路文件。
+// relativeBase 为去掉扩展名的相对路径；已存在的旁路文件不会被覆盖。
+func (s *StrmService) writeStrmMediaInfo(localRoot *os.Root, relativeBase, eventPath string, cloudPath model.CloudPath, entry StorageEntry) error {
+	sidecar := cloudPath.MediaInfoSidecar
+	jsonRelative := relativeBase + StrmMediaInfoSuffix
+	nfoRelative := relativeBase + ".nfo"
+	needJSON := (sidecar == model.MediaInfoSidecarJSON || sidecar == model.MediaInfoSidecarBoth) && !rootFileExists(localRoot, jsonRelative)
+	needNFO := (sidecar == model.MediaInfoSidecarNFO || sidecar == model.MediaInfoSidecarBoth) && !rootFileExists(localRoot, nfoRelative)
+	if !needJSON && !needNFO {
+		return nil
+	}
+	if cloudPath.CloudStorage == nil {
+		return fmt.Errorf("CloudPath (ID: %d) 缺少关联的云存储配置", cloudPath.ID)
+	}
+
+	// 探测需要文件大小与直链定位信息，事件未携带时从网盘补齐
+	if entry.Size <= 0 || (entry.ID == "" && entry.PickCode == "") ||
+		(cloudPath.CloudStorage.UsesPickcode() && entry.PickCode == "") {
+		resolved, err := s.resolveCloudFile(cloudPath, s.cloudSourcePath(eventPath, cloudPath))
+		if err != nil {
+			return err
+		}
+		entry = resolved
+	}
+	drv, err := NewStorageDriver(*cloudPath.CloudStorage, s.logger)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), strmMediaInfoTimeout)
+	defer cancel()
+	info, err := probeStorageEntry(ctx, drv, entry)
+	if err != nil {
+		return err
+	}
+
+	if needJSON {
+		data, err := buildStrmMediaInfoJSON(info, filepath.Base(relativeBase))
+		if err != nil {
+			return err
+		}
+		if err := localRoot.WriteFile(jsonRelative, data, 0777); err != nil {
+			return fmt.Errorf("写入媒体信息文件失败: %w", err)
+		}
+	}
+	if needNFO {
+		data, err := buildStrmMediaInfoNFO(info, filepath.Base(relativeBase))
+		if err != nil {
+			return err
+		}
+		if err := localRoot.WriteFile(nfoRelative, data, 0777); err != nil {
+			return fmt.Errorf("写入 NFO 文件失败: %w", err)
+		}
+	}
+	return nil
+}
+
+// probeStorageEntry 获取直链后通过 HTTP Range 读取文件头部解析媒体信息
+func probeStorageEntry(ctx context.Context, drv StorageDriver, entry StorageEntry) (*mediaprobe.Info, error) {
+	link, err := drv.DirectLink(ctx, entry, strmMediaInfoUserAgent)
+	if err != nil {
+		return nil, fmt.Errorf("获取直链失败: %w", err)
+	}
+	headers := http.Header{}
+	headers.Set("User-Agent", strmMediaInfoUserAgent)
+	reader := newHTTPRangeReadSeeker(link, headers, entry.Size)
+	info, err := mediaprobe.Probe(reader, entry.Size, strmMediaInfoProbeBytes)
+	if err != nil {
+		return nil, fmt.Errorf("探测媒体信息失败: %w", err)
+	}
+	return info, nil
+}
+
+// buildStrmMediaInfoJSON 生成 Emby 兼容的 -mediainfo.json 内容
+func buildStrmMediaInfoJSON(info *mediaprobe.Info, name string) ([]byte, error) {
+	source := strmMediaInfoSource{
+		Protocol:     "Http",
+		Container:    info.Container,
+		Size:         info.Size,
+		Bitrate:      info.Bitrate,
+		RunTimeTicks: int64(math.Round(info.DurationSeconds * 1e7)),
+		Name:         name,
+		MediaStreams: make([]strmMediaInfoStream, 0, len(info.Streams)),
+	}
+	for _, stream := range info.Streams {
+		item := strmMediaInfoStream{
+			Codec:      stream.Codec,
+			Type:       stream.Type,
+			Index:      stream.Index,
+			IsDefault:  stream.IsDefault,
+			Language:   stream.Language,
+			Title:      stream.Title,
+			Width:      stream.Width,
+			Height:     stream.Height,
+			Channels:   stream.Channels,
+			SampleRate: stream.SampleRate,
+		}
+		if stream.Type == mediaprobe.StreamVideo {
+			item.AspectRatio = aspectRatioString(stream.Width, stream.Height)
+		}
+		if stream.Type == mediaprobe.StreamSubtitle {
+			item.IsTextSubtitleStream = stream.Codec == "subrip" || stream.Codec == "ass" || stream.Codec == "webvtt" || stream.Codec == "mov_text"
+		}
+		source.MediaStreams = append(source.MediaStreams, item)
+	}
+	return json.MarshalIndent([]map[string]strmMediaInfoSource{{"MediaSourceInfo": source}}, "", "  ")
+}
+
+// buildStrmMediaInfoNFO 生成只包含 streamdetails 的 NFO，剧集文件名使用 episodedetails 根节点
+func buildStrmMediaInfoNFO(info *mediaprobe.Info, name string) ([]byte, error) {
+	doc := strmMediaInfoNFO{XMLName: xml.Name{Local: "movie"}}
+	if rssAutomationSeasonEpisodeRegexp.MatchString(name) {
+		doc.XMLName.Local = "episodedetails"
+	}
+	details := &doc.FileInfo.StreamDetails
+	for _, stream := range info.Streams {
+		switch stream.Type {
+		case mediaprobe.StreamVideo:
+			details.Video = append(details.Video, strmNFOVideo{
+				Codec:             stream.Codec,
+				Aspect:            aspectRatioString(stream.Width, stream.Height),
+				Width:             stream.Width,
+				Height:            stream.Height,
+				DurationInSeconds: int(math.Round(info.DurationSeconds)),
+			})
+		case mediaprobe.StreamAudio:
+			details.Audio = append(details.Audio, strmNFOAudio{Codec: stream.Codec, Language: stream.Language, Channels: stream.Channels})
+		case mediaprobe.StreamSubtitle:
+			details.Subtitle = append(details.Subtitle, strmNFOSubtitle{Codec: stream.Codec, Language: stream.Language})
+		}
+	}
+	data, err := xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(`<?xml version="1.0" encoding="UTF-8" standalone="yes"?>`+"\n"), data...), nil
+}
+
+func aspectRatioString(width, height int) string {
+	if width <= 0 || height <= 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.2f", float64(width)/float64(height))
+}
+
+func rootFileExists(root *os.Root, name string) bool {
+	_, err := root.Stat(name)
+	return err == nil
+}
@@ -0,0 +1,135 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+// mediaInfoFakeDriver 将直链指向测试 HTTP 服务
+type mediaInfoFakeDriver struct {
+	reconcileFakeDriver
+	url string
+}
+
+func (d mediaInfoFakeDriver) DirectLink(context.Context, StorageEntry, string) (string, error) {
+	return d.url, nil
+}
+
+// testMkvElement 按 EBML 编码拼接元素，长度固定使用 8 字节
+func testMkvElement(id []byte, payload ...[]byte) []byte {
+	body := bytes.Join(payload, nil)
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01
+	return bytes.Join([][]byte{id, size, body}, nil)
+}
+
+func TestCreateStrmWritesMediaInfoSidecars(t *testing.T) {
+	file := bytes.Join([][]byte{
+		testMkvElement([]byte{0x1A, 0x45, 0xDF, 0xA3}, testMkvElement([]byte{0x42, 0x82}, []byte("matroska"))),
+		testMkvElement([]byte{0x18, 0x53, 0x80, 0x67},
+			testMkvElement([]byte{0x16, 0x54, 0xAE, 0x6B},
+				testMkvElement([]byte{0xAE},
+					testMkvElement([]byte{0x83}, []byte{1}),
+					testMkvElement([]byte{0x86}, []byte("V_MPEG4/ISO/AVC")),
+					testMkvElement([]byte{0xE0}, testMkvElement([]byte{0xB0}, []byte{0x07, 0x80}), testMkvElement([]byte{0xBA}, []byte{0x04, 0x38})),
+				),
+				testMkvElement([]byte{0xAE},
+					testMkvElement([]byte{0x83}, []byte{2}),
+					testMkvElement([]byte{0x86}, []byte("A_AC3")),
+					testMkvElement([]byte{0xE1}, testMkvElement([]byte{0x9F}, []byte{6})),
+				),
+			),
+		),
+		make([]byte, 1024),
+	}, nil)
+	var rangeRequests atomic.Int32
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		if r.Header.Get("Range") != "" {
+			rangeRequests.Add(1)
+		}
+		if r.Header.Get("User-Agent") != strmMediaInfoUserAgent {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		http.ServeContent(w, r, "movie.mkv", time.Time{}, bytes.NewReader(file))
+	}))
+	defer server.Close()
+
+	drv := mediaInfoFakeDriver{reconcileFakeDriver{&fakeStorageDriver{}}, server.URL}
+	_, cloudPath := setupStrmReconcileTest(t, drv)
+	cloudPath.MediaInfoSidecar = model.MediaInfoSidecarBoth
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	svc := NewStrmService(log, nil)
+	svc.mediaInfoProbes = newStrmMediaInfoQueue(log, 0)
+
+	// 探测请求被挂起时 STRM 生成仍立即返回，旁路文件由后台队列补写
+	entry := StorageEntry{ID: "f1", PickCode: "pc1", Size: int64(len(file))}
+	svc.CreateStrmOrDownloadWithEntry("Movie/Show S01E02.mkv", cloudPath, entry)
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Movie", "Show S01E02.strm")); err != nil {
+		t.Fatalf("strm should be written before probing: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Movie", "Show S01E02"+StrmMediaInfoSuffix)); !os.IsNotExist(err) {
+		t.Fatalf("mediainfo should be filled in later, stat err = %v", err)
+	}
+	close(release)
+	svc.mediaInfoProbes.wait()
+
+	data, err := os.ReadFile(filepath.Join(cloudPath.LocalPath, "Movie", "Show S01E02"+StrmMediaInfoSuffix))
+	if err != nil {
+		t.Fatalf("read mediainfo: %v", err)
+	}
+	var parsed []struct {
+		MediaSourceInfo strmMediaInfoSource `json:"MediaSourceInfo"`
+	}
+	if err := json.Unmarshal(data, &parsed); err != nil || len(parsed) != 1 {
+		t.Fatalf("parse mediainfo %s: %v", data, err)
+	}
+	streams := parsed[0].MediaSourceInfo.MediaStreams
+	if parsed[0].MediaSourceInfo.Container != "mkv" || len(streams) != 2 ||
+		streams[0].Codec != "h264" || streams[0].Width != 1920 || streams[0].Height != 1080 ||
+		streams[1].Codec != "ac3" || streams[1].Channels != 6 {
+		t.Fatalf("mediainfo = %s", data)
+	}
+	if rangeRequests.Load() == 0 {
+		t.Fatal("probe should use range requests")
+	}
+
+	nfo, err := os.ReadFile(filepath.Join(cloudPath.LocalPath, "Movie", "Show S01E02.nfo"))
+	if err != nil {
+		t.Fatalf("read nfo: %v", err)
+	}
+	if !strings.Contains(string(nfo), "<episodedetails>") || !strings.Contains(string(nfo), "<width>1920</width>") {
+		t.Fatalf("nfo = %s", nfo)
+	}
+
+	// 已存在的旁路文件不重复探测；删除源文件时一并清理
+	rangeRequests.Store(0)
+	svc.CreateStrmOrDownloadWithEntry("Movie/Show S01E02.mkv", cloudPath, entry)
+	svc.mediaInfoProbes.wait()
+	if n := rangeRequests.Load(); n != 0 {
+		t.Fatalf("existing sidecars should not be probed again, got %d requests", n)
+	}
+	svc.DeleteAction(cloudPath.LocalPath, "Movie/Show S01E02.mkv", false)
+	for _, name := range []string{"Show S01E02.strm", "Show S01E02.nfo", "Show S01E02" + StrmMediaInfoSuffix} {
+		if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Movie", name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be removed, stat err = %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"film-fusion/app/database"
+	"film-fusion/app/model"
+	"fmt"
+	"net/url"
+	"path"
+	"strings"
+	"sync"
+	"time"
+)
+
+// StrmPlaybackRoutePrefix 签名播放地址在 Emby 代理端口上的路由前缀，
+// 完整地址为 ContentPrefix + 前缀 + "/" + 令牌 + "/" + 文件名。
+const StrmPlaybackRoutePrefix = "/film-fusion/strm"
+
+var (
+	ErrStrmPlaybackTokenInvalid = errors.New("播放令牌无效")
+	ErrStrmPlaybackTokenExpired = errors.New("播放令牌已过期")
+	ErrStrmPlaybackTokenRevoked = errors.New("播放令牌已被吊销")
+)
+
+// StrmPlaybackClaims 播放令牌内容。115 等 pickcode 存储写入 PickCode，其他存储写入盘内路径。
+type StrmPlaybackClaims struct {
+	UserID         uint   `json:"u"`
+	StorageID      uint   `json:"s"`
+	PickCode       string `json:"p,omitempty"`
+	Path           string `json:"f,omitempty"`
+	ExpiresAt      int64  `json:"e,omitempty"`
+	UserVersion    int    `json:"uv,omitempty"`
+	StorageVersion int    `json:"sv,omitempty"`
+}
+
+var strmPlaybackSecret struct {
+	sync.Mutex
+	key []byte
+}
+
+// strmPlaybackKey 读取(不存在时生成)播放令牌签名密钥
+func strmPlaybackKey() ([]byte, error) {
+	strmPlaybackSecret.Lock()
+	defer strmPlaybackSecret.Unlock()
+	if strmPlaybackSecret.key != nil {
+		return strmPlaybackSecret.key, nil
+	}
+
+	var cfg model.SystemConfig
+	if err := database.DB.Where("config_key = ?", model.ConfigKeyStrmPlaybackSecret).Limit(1).Find(&cfg).Error; err != nil {
+		return nil, err
+	}
+	if cfg.ConfigValue == "" {
+		buf := make([]byte, 32)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		cfg = model.SystemConfig{
+			ConfigKey:   model.ConfigKeyStrmPlaybackSecret,
+			ConfigValue: hex.EncodeToString(buf),
+			ConfigType:  model.TypeString,
+			Category:    model.CategorySecurity,
+			Description: "STRM 播放令牌签名密钥",
+			IsSystem:    true,
+			IsVisible:   false,
+		}
+		if err := database.DB.Create(&cfg).Error; err != nil {
+			return nil, err
+		}
+	}
+	strmPlaybackSecret.key = []byte(cfg.ConfigValue)
+	return strmPlaybackSecret.key, nil
+}
+
+// SignStrmPlaybackToken 签发播放令牌：base64url(JSON) + "." + base64url(HMAC-SHA256)
+func SignStrmPlaybackToken(claims StrmPlaybackClaims) (string, error) {
+	key, err := strmPlaybackKey()
+	if err != nil {
+		return "", fmt.Errorf("读取播放令牌密钥失败: %w", err)
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	body := base64.RawURLEncoding.EncodeToString(payload)
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	return body + "." + base64.RawURLEncoding.EncodeToString(mac.Sum(nil)), nil
+}
+
+// ParseStrmPlaybackToken 校验签名与有效期并返回令牌内容，不检查吊销
+func ParseStrmPlaybackToken(token string, now time.Time) (StrmPlaybackClaims, error) {
+	var claims StrmPlaybackClaims
+	body, sig, ok := strings.Cut(token, ".")
+	if !ok {
+		return claims, ErrStrmPlaybackTokenInvalid
+	}
+	key, err := strmPlaybackKey()
+	if err != nil {
+		return claims, fmt.Errorf("读取播放令牌密钥失败: %w", err)
+	}
+	gotSig, err := base64.RawURLEncoding.DecodeString(sig)
+	if err != nil {
+		return claims, ErrStrmPlaybackTokenInvalid
+	}
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(body))
+	if !hmac.Equal(gotSig, mac.Sum(nil)) {
+		return claims, ErrStrmPlaybackTokenInvalid
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(body)
+	if err != nil || json.Unmarshal(payload, &claims) != nil {
+		return claims, ErrStrmPlaybackTokenInvalid
+	}
+	if claims.ExpiresAt > 0 && now.Unix() > claims.ExpiresAt {
+		return claims, ErrStrmPlaybackTokenExpired
+	}
+	return claims, nil
+}
+
+// VerifyStrmPlaybackToken 完整校验播放令牌(签名、有效期、用户与存储的吊销版本)，返回令牌对应的云存储
+func VerifyStrmPlaybackToken(token string) (StrmPlaybackClaims, model.CloudStorage, error) {
+	var storage model.CloudStorage
+	claims, err := ParseStrmPlaybackToken(token, time.Now())
+	if err != nil {
+		return claims, storage, err
+	}
+	versions, err := loadStrmPlaybackTokenVersions(claims.UserID, claims.StorageID)
+	if err != nil {
+		return claims, storage, err
+	}
+	if claims.UserVersion != versions.User || claims.StorageVersion != versions.Storage {
+		return claims, storage, ErrStrmPlaybackTokenRevoked
+	}
+	if err := database.DB.Where("id = ? AND user_id = ?", claims.StorageID, claims.UserID).First(&storage).Error; err != nil {
+		return claims, storage, ErrStrmPlaybackTokenRevoked
+	}
+	return claims, storage, nil
+}
+
+// RevokeStrmPlaybackTokens 吊销用户或云存储此前签发的全部播放令牌，返回新的版本号。
+// 吊销后需重新生成(对账或重新渲染) STRM 才能继续播放。
+func RevokeStrmPlaybackTokens(scope string, scopeID uint) (int, error) {
+	if scope != model.StrmPlaybackScopeUser && scope != model.StrmPlaybackScopeStorage {
+		return 0, fmt.Errorf("不支持的吊销范围: %s", scope)
+	}
+	return model.BumpStrmPlaybackTokenVersion(database.DB, scope, scopeID)
+}
+
+// strmPlaybackTokenVersions 签发令牌时写入的用户与云存储吊销版本
+type strmPlaybackTokenVersions struct {
+	User    int
+	Storage int
+}
+
+func loadStrmPlaybackTokenVersions(userID, storageID uint) (strmPlaybackTokenVersions, error) {
+	userVersion, storageVersion, err := model.GetStrmPlaybackTokenVersions(database.DB, userID, storageID)
+	return strmPlaybackTokenVersions{User: userVersion, Storage: storageVersion}, err
+}
+
+// ValidateStrmPlaybackTokenTTL 校验播放令牌有效期与定时对账间隔的搭配。
+// 令牌到期后只能靠对账重新签发 STRM，因此设置有效期时必须开启定时对账，且间隔小于有效期：
+// 令牌至少还有 ttl 的剩余有效期，间隔更短才能保证在到期前完成重签。
+func ValidateStrmPlaybackTokenTTL(ttlHours, reconcileIntervalHours int) error {
+	if ttlHours < 0 {
+		return errors.New("播放令牌有效期不能为负数")
+	}
+	if ttlHours == 0 {
+		return nil
+	}
+	if reconcileIntervalHours <= 0 {
+		return errors.New("设置播放令牌有效期时需要开启定时对账，否则 STRM 到期后无法重新签发")
+	}
+	if reconcileIntervalHours >= ttlHours {
+		return fmt.Errorf("定时对账间隔(%d 小时)需小于播放令牌有效期(%d 小时)，否则令牌会在重新签发前过期", reconcileIntervalHours, ttlHours)
+	}
+	return nil
+}
+
+// strmPlaybackExpiresAt 按有效期对齐到时间窗口：同一窗口内生成的令牌完全一致，
+// 避免对账时每次都判定内容变化；令牌至少保证 ttl 的剩余有效期。
+func strmPlaybackExpiresAt(now time.Time, ttlHours int) int64 {
+	if ttlHours <= 0 {
+		return 0
+	}
+	window := int64(ttlHours) * 3600
+	return (now.Unix()/window + 2) * window
+}
+
+// signedStrmContent 生成 StrmContentType=signed 的 STRM 内容，versions 由调用方按批次加载
+func signedStrmContent(eventPath string, cloudPath model.CloudPath, entry StorageEntry, versions strmPlaybackTokenVersions) (string, error) {
+	if cloudPath.CloudStorage == nil {
+		return "", fmt.Errorf("CloudPath (ID: %d) 缺少关联的云存储配置", cloudPath.ID)
+	}
+	claims := StrmPlaybackClaims{
+		UserID:    cloudPath.UserID,
+		StorageID: cloudPath.CloudStorageID,
+		ExpiresAt: strmPlaybackExpiresAt(time.Now(), cloudPath.PlaybackTokenTTLHours),
+	}
+	if cloudPath.CloudStorage.UsesPickcode() {
+		if entry.PickCode == "" {
+			return "", fmt.Errorf("缺少 pickcode，无法生成播放令牌: %s", eventPath)
+		}
+		claims.PickCode = entry.PickCode
+	} else {
+		claims.Path = (&StrmService{}).cloudSourcePath(eventPath, cloudPath)
+	}
+	claims.UserVersion, claims.StorageVersion = versions.User, versions.Storage
+	token, err := SignStrmPlaybackToken(claims)
+	if err != nil {
+		return "", err
+	}
+	// 末尾带上文件名，便于播放器按扩展名识别容器格式
+	return strings.TrimRight(cloudPath.ContentPrefix, "/") + StrmPlaybackRoutePrefix + "/" + token + "/" +
+		url.PathEscape(path.Base(eventPath)), nil
+}
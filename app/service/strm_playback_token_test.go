@@ -0,0 +1,178 @@
+package service
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"film-fusion/app/database"
+	"film-fusion/app/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+func setupStrmPlaybackTokenTest(t *testing.T) model.CloudPath {
+	t.Helper()
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "playback.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.SystemConfig{}, &model.CloudStorage{}, &model.StrmPlaybackTokenVersion{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	database.DB = db
+	strmPlaybackSecret.key = nil
+	t.Cleanup(func() {
+		database.DB = oldDB
+		strmPlaybackSecret.key = nil
+	})
+
+	storage := model.CloudStorage{UserID: 1, StorageName: "115", StorageType: model.StorageType115Open}
+	if err := db.Create(&storage).Error; err != nil {
+		t.Fatalf("create storage: %v", err)
+	}
+	return model.CloudPath{
+		ID:              5,
+		UserID:          1,
+		CloudStorageID:  storage.ID,
+		SourcePath:      "/Media",
+		ContentPrefix:   "http://ff:8097/",
+		StrmContentType: model.StrmContentTypeSigned,
+		CloudStorage:    &storage,
+	}
+}
+
+func TestSignedStrmContentRoundTrip(t *testing.T) {
+	cloudPath := setupStrmPlaybackTokenTest(t)
+
+	content, err := renderStrmContent("/Media/Movie (2024).mkv", cloudPath, StorageEntry{PickCode: "pc1"})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	prefix := "http://ff:8097" + StrmPlaybackRoutePrefix + "/"
+	if !strings.HasPrefix(content, prefix) || !strings.HasSuffix(content, "/Movie%20%282024%29.mkv") {
+		t.Fatalf("content = %q", content)
+	}
+	if ext := sourceExtFromStrmContent(content); ext != ".mkv" {
+		t.Fatalf("ext from signed content = %q", ext)
+	}
+	token := strings.SplitN(strings.TrimPrefix(content, prefix), "/", 2)[0]
+
+	claims, storage, err := VerifyStrmPlaybackToken(token)
+	if err != nil {
+		t.Fatalf("verify: %v", err)
+	}
+	if claims.PickCode != "pc1" || claims.ExpiresAt != 0 || storage.ID != cloudPath.CloudStorageID {
+		t.Fatalf("claims = %+v, storage = %d", claims, storage.ID)
+	}
+
+	// 篡改负载后签名失效
+	body, sig, _ := strings.Cut(token, ".")
+	if _, _, err := VerifyStrmPlaybackToken(body + "x." + sig); !errors.Is(err, ErrStrmPlaybackTokenInvalid) {
+		t.Fatalf("tampered token err = %v", err)
+	}
+
+	// 吊销存储后旧令牌失效，新签发的令牌可用
+	if _, err := RevokeStrmPlaybackTokens(model.StrmPlaybackScopeStorage, cloudPath.CloudStorageID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, _, err := VerifyStrmPlaybackToken(token); !errors.Is(err, ErrStrmPlaybackTokenRevoked) {
+		t.Fatalf("revoked token err = %v", err)
+	}
+	content, err = renderStrmContent("/Media/Movie (2024).mkv", cloudPath, StorageEntry{PickCode: "pc1"})
+	if err != nil {
+		t.Fatalf("render after revoke: %v", err)
+	}
+	token = strings.SplitN(strings.TrimPrefix(content, prefix), "/", 2)[0]
+	if _, _, err := VerifyStrmPlaybackToken(token); err != nil {
+		t.Fatalf("reissued token: %v", err)
+	}
+
+	// 缺少 pickcode 时拒绝生成
+	if _, err := renderStrmContent("/Media/Other.mkv", cloudPath, StorageEntry{}); err == nil {
+		t.Fatal("render without pickcode should fail")
+	}
+}
+
+func TestStrmContentRendererLoadsTokenVersionsOnce(t *testing.T) {
+	cloudPath := setupStrmPlaybackTokenTest(t)
+	if _, err := RevokeStrmPlaybackTokens(model.StrmPlaybackScopeUser, cloudPath.UserID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	var queries int
+	if err := database.DB.Callback().Query().After("gorm:query").Register("test:count_token_versions", func(tx *gorm.DB) {
+		if tx.Statement.Table == (model.StrmPlaybackTokenVersion{}).TableName() {
+			queries++
+		}
+	}); err != nil {
+		t.Fatalf("register callback: %v", err)
+	}
+
+	renderer := newStrmContentRenderer(cloudPath)
+	prefix := "http://ff:8097" + StrmPlaybackRoutePrefix + "/"
+	for _, name := range []string{"a", "b", "c"} {
+		content, err := renderer.render("/Media/"+name+".mkv", StorageEntry{PickCode: "pc-" + name})
+		if err != nil {
+			t.Fatalf("render %s: %v", name, err)
+		}
+		claims, err := ParseStrmPlaybackToken(strings.SplitN(strings.TrimPrefix(content, prefix), "/", 2)[0], time.Now())
+		if err != nil || claims.UserVersion != 1 || claims.StorageVersion != 0 {
+			t.Fatalf("claims = %+v, err = %v", claims, err)
+		}
+	}
+	if queries != 1 {
+		t.Fatalf("token versions queried %d times, want 1", queries)
+	}
+}
+
+func TestStrmPlaybackTokenExpiry(t *testing.T) {
+	setupStrmPlaybackTokenTest(t)
+	now := time.Unix(1_800_000_000, 0)
+	expiresAt := strmPlaybackExpiresAt(now, 24)
+	if expiresAt-now.Unix() < 24*3600 || expiresAt-now.Unix() > 48*3600 {
+		t.Fatalf("expiresAt = %d, now = %d", expiresAt, now.Unix())
+	}
+	if strmPlaybackExpiresAt(now.Add(time.Minute), 24) != expiresAt {
+		t.Fatal("tokens within the same window should share the expiry")
+	}
+
+	token, err := SignStrmPlaybackToken(StrmPlaybackClaims{UserID: 1, StorageID: 1, PickCode: "pc", ExpiresAt: expiresAt})
+	if err != nil {
+		t.Fatalf("sign: %v", err)
+	}
+	if _, err := ParseStrmPlaybackToken(token, now); err != nil {
+		t.Fatalf("parse before expiry: %v", err)
+	}
+	if _, err := ParseStrmPlaybackToken(token, time.Unix(expiresAt+1, 0)); !errors.Is(err, ErrStrmPlaybackTokenExpired) {
+		t.Fatalf("parse after expiry err = %v", err)
+	}
+}
+
+func TestValidateStrmPlaybackTokenTTL(t *testing.T) {
+	tests := []struct {
+		name          string
+		ttl, interval int
+		wantErr       bool
+	}{
+		{name: "no expiry", ttl: 0, interval: 0},
+		{name: "negative ttl", ttl: -1, interval: 0, wantErr: true},
+		{name: "ttl without reconcile", ttl: 24, interval: 0, wantErr: true},
+		{name: "reconcile as long as ttl", ttl: 24, interval: 24, wantErr: true},
+		{name: "reconcile before expiry", ttl: 24, interval: 12},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateStrmPlaybackTokenTTL(tt.ttl, tt.interval)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
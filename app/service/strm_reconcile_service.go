@@ -0,0 +1,579 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/pathhelper"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// strmReconcileCheckInterval 定时对账的检查间隔；是否到期由各 CloudPath 的 ReconcileIntervalHours 决定。
+const strmReconcileCheckInterval = 10 * time.Minute
+
+// strmReconcileMaxActions 报告中保留的动作明细上限，避免超大媒体库撑爆内存与响应。
+const strmReconcileMaxActions = 2000
+
+// STRM 对账动作
+const (
+	StrmReconcileCreate  = "create"  // 云端有文件但本地缺少 STRM
+	StrmReconcileDelete  = "delete"  // 本地 STRM 对应的云端文件已不存在
+	StrmReconcileRewrite = "rewrite" // STRM 内容与当前配置生成的内容不一致
+)
+
+// STRM 对账任务状态
+const (
+	StrmReconcileStatusRunning   = "running"
+	StrmReconcileStatusCompleted = "completed"
+	StrmReconcileStatusFailed    = "failed"
+)
+
+// ErrStrmReconcileRunning 同一 CloudPath 已有对账任务在执行。
+var ErrStrmReconcileRunning = errors.New("该云路径映射正在对账中")
+
+// StrmReconcileAction 一条对账差异及其执行结果。
+type StrmReconcileAction struct {
+	Action   string `json:"action"`
+	Source   string `json:"source,omitempty"`
+	Target   string `json:"target"`
+	PickCode string `json:"pick_code,omitempty"`
+	Current  string `json:"current,omitempty"`
+	Expected string `json:"expected,omitempty"`
+	Status   string `json:"status,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// StrmReconcileReport 一次对账的结果报告；DryRun=true 时只列出差异不做修改。
+type StrmReconcileReport struct {
+	CloudPathID uint                  `json:"cloud_path_id"`
+	DryRun      bool                  `json:"dry_run"`
+	Trigger     string                `json:"trigger"`
+	Status      string                `json:"status"`
+	Error       string                `json:"error,omitempty"`
+	CloudFiles  int                   `json:"cloud_files"`
+	LocalStrm   int                   `json:"local_strm"`
+	Creates     int                   `json:"creates"`
+	Deletes     int                   `json:"deletes"`
+	Rewrites    int                   `json:"rewrites"`
+	Failed      int                   `json:"failed"`
+	Truncated   bool                  `json:"truncated"`
+	Warnings    []string              `json:"warnings,omitempty"`
+	Actions     []StrmReconcileAction `json:"actions"`
+	StartedAt   time.Time             `json:"started_at"`
+	FinishedAt  *time.Time            `json:"finished_at,omitempty"`
+}
+
+// strmExpectation 按云端目录树推算出的一个 STRM 文件。
+type strmExpectation struct {
+	Source   string
+	PickCode string
+	Content  string
+}
+
+// StrmReconcileService 全量比对云端目录树与 CloudPath.LocalPath 下的 STRM 文件，
+// 修复漏掉 webhook 导致的缺失、孤儿与内容过期的 STRM。
+type StrmReconcileService struct {
+	logger *logger.Logger
+
+	mu      sync.Mutex
+	running map[uint]bool
+	reports map[uint]*StrmReconcileReport
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+// NewStrmReconcileService 创建 STRM 对账服务
+func NewStrmReconcileService(log *logger.Logger) *StrmReconcileService {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &StrmReconcileService{
+		logger:  log,
+		running: map[uint]bool{},
+		reports: map[uint]*StrmReconcileReport{},
+		ctx:     ctx,
+		cancel:  cancel,
+	}
+}
+
+// Start 启动定时对账循环
+func (s *StrmReconcileService) Start() {
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		ticker := time.NewTicker(strmReconcileCheckInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-s.ctx.Done():
+				return
+			case <-ticker.C:
+				s.runDue()
+			}
+		}
+	}()
+	s.logger.Infof("STRM 对账调度已启动：每 %s 检查一次到期的云路径映射", strmReconcileCheckInterval)
+}
+
+// Stop 停止定时对账循环并等待进行中的定时任务结束
+func (s *StrmReconcileService) Stop() {
+	s.cancel()
+	s.wg.Wait()
+}
+
+// runDue 对所有到期的 CloudPath 执行一次实际修复对账
+func (s *StrmReconcileService) runDue() {
+	var cloudPaths []model.CloudPath
+	if err := database.DB.Preload("CloudStorage").
+		Where("reconcile_interval_hours > 0 AND link_type = ?", model.LinkTypeStrm).
+		Find(&cloudPaths).Error; err != nil {
+		s.logger.Warnf("查询待对账的云路径映射失败: %v", err)
+		return
+	}
+	now := time.Now()
+	for _, cloudPath := range cloudPaths {
+		interval := time.Duration(cloudPath.ReconcileIntervalHours) * time.Hour
+		if cloudPath.LastReconciledAt != nil && now.Sub(*cloudPath.LastReconciledAt) < interval {
+			continue
+		}
+		if s.ctx.Err() != nil {
+			return
+		}
+		report, err := s.Reconcile(s.ctx, cloudPath, true, model.OrganizeTriggerReconcile)
+		if err != nil {
+			s.logger.Warnf("定时 STRM 对账失败 cloud_path_id=%d: %v", cloudPath.ID, err)
+			continue
+		}
+		s.logger.Infof("定时 STRM 对账完成 cloud_path_id=%d: 新建 %d, 删除 %d, 重写 %d, 失败 %d",
+			cloudPath.ID, report.Creates, report.Deletes, report.Rewrites, report.Failed)
+	}
+}
+
+// StartReconcile 后台执行一次对账，立即返回初始报告；进度与结果通过 LatestReport 查询。
+func (s *StrmReconcileService) StartReconcile(cloudPath model.CloudPath, apply bool, trigger string) (*StrmReconcileReport, error) {
+	report, err := s.begin(cloudPath.ID, apply, trigger)
+	if err != nil {
+		return nil, err
+	}
+	snapshot := *report
+	go func() {
+		defer func() {
+			if r := recover(); r != nil {
+				s.logger.Errorf("STRM 对账 panic cloud_path_id=%d: %v", cloudPath.ID, r)
+				s.finish(report, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		s.finish(report, s.run(s.ctx, cloudPath, report))
+	}()
+	return &snapshot, nil
+}
+
+// Reconcile 同步执行一次对账。apply=false 时只生成差异报告。
+func (s *StrmReconcileService) Reconcile(ctx context.Context, cloudPath model.CloudPath, apply bool, trigger string) (*StrmReconcileReport, error) {
+	report, err := s.begin(cloudPath.ID, apply, trigger)
+	if err != nil {
+		return nil, err
+	}
+	err = s.run(ctx, cloudPath, report)
+	s.finish(report, err)
+	if err != nil {
+		return nil, err
+	}
+	return s.LatestReport(cloudPath.ID), nil
+}
+
+// LatestReport 返回 CloudPath 最近一次对账报告的副本，没有时返回 nil。
+func (s *StrmReconcileService) LatestReport(cloudPathID uint) *StrmReconcileReport {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	report, ok := s.reports[cloudPathID]
+	if !ok {
+		return nil
+	}
+	snapshot := *report
+	snapshot.Warnings = append([]string(nil), report.Warnings...)
+	snapshot.Actions = append([]StrmReconcileAction(nil), report.Actions...)
+	return &snapshot
+}
+
+func (s *StrmReconcileService) begin(cloudPathID uint, apply bool, trigger string) (*StrmReconcileReport, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.running[cloudPathID] {
+		return nil, ErrStrmReconcileRunning
+	}
+	s.running[cloudPathID] = true
+	report := &StrmReconcileReport{
+		CloudPathID: cloudPathID,
+		DryRun:      !apply,
+		Trigger:     trigger,
+		Status:      StrmReconcileStatusRunning,
+		Actions:     []StrmReconcileAction{},
+		StartedAt:   time.Now(),
+	}
+	s.reports[cloudPathID] = report
+	return report, nil
+}
+
+func (s *StrmReconcileService) finish(report *StrmReconcileReport, err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	finishedAt := time.Now()
+	report.FinishedAt = &finishedAt
+	report.Status = StrmReconcileStatusCompleted
+	if err != nil {
+		report.Status = StrmReconcileStatusFailed
+		report.Error = err.Error()
+	}
+	delete(s.running, report.CloudPathID)
+}
+
+// run 采集云端与本地两侧的状态，计算差异并按需执行修复。
+func (s *StrmReconcileService) run(ctx context.Context, cloudPath model.CloudPath, report *StrmReconcileReport) error {
+	if strings.TrimSpace(cloudPath.LocalPath) == "" {
+		return fmt.Errorf("CloudPath (ID: %d) 没有设置 LocalPath", cloudPath.ID)
+	}
+	if cloudPath.CloudStorage == nil || !IsSupportedStorageType(cloudPath.CloudStorage.StorageType) {
+		return fmt.Errorf("CloudPath (ID: %d) 的云存储不支持对账", cloudPath.ID)
+	}
+
+	nested, err := nestedCloudPathSources(cloudPath)
+	if err != nil {
+		return err
+	}
+	expected, err := s.collectCloud(ctx, cloudPath, nested)
+	if err != nil {
+		return err
+	}
+	local, err := collectLocalStrm(cloudPath, nested)
+	if err != nil {
+		return err
+	}
+	actions := planStrmReconcile(expected, local)
+
+	// 云端一个文件都没遍历到却要删除本地 STRM，多半是挂载或权限异常，宁可不删。
+	skipDeletes := len(expected) == 0 && len(local) > 0
+
+	s.mu.Lock()
+	report.CloudFiles = len(expected)
+	report.LocalStrm = len(local)
+	if skipDeletes {
+		report.Warnings = append(report.Warnings, "云端未返回任何文件，已跳过删除动作以避免误删")
+	}
+	s.mu.Unlock()
+
+	for _, action := range actions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if !report.DryRun {
+			if action.Action == StrmReconcileDelete && skipDeletes {
+				action.Status = model.OrganizeStatusSkipped
+			} else {
+				s.apply(cloudPath, &action, report.Trigger)
+			}
+		}
+		s.record(report, action)
+	}
+
+	if !report.DryRun {
+		if err := database.DB.Model(&model.CloudPath{}).Where("id = ?", cloudPath.ID).
+			Update("last_reconciled_at", time.Now()).Error; err != nil {
+			s.logger.Warnf("更新对账时间失败 cloud_path_id=%d: %v", cloudPath.ID, err)
+		}
+	}
+	return nil
+}
+
+func (s *StrmReconcileService) record(report *StrmReconcileReport, action StrmReconcileAction) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	switch action.Action {
+	case StrmReconcileCreate:
+		report.Creates++
+	case StrmReconcileDelete:
+		report.Deletes++
+	case StrmReconcileRewrite:
+		report.Rewrites++
+	}
+	if action.Status == model.OrganizeStatusFailed {
+		report.Failed++
+	}
+	if len(report.Actions) >= strmReconcileMaxActions {
+		report.Truncated = true
+		return
+	}
+	report.Actions = append(report.Actions, action)
+}
+
+// nestedCloudPathSources 返回与 cloudPath 共用 LocalPath、SourcePath 嵌套在其下的其他 CloudPath 的源路径。
+// 这些子树的 STRM 由对应的 CloudPath 负责，对账时两侧都要跳过，避免按本映射的内容设置重写或当作孤儿删除。
+func nestedCloudPathSources(cloudPath model.CloudPath) ([]string, error) {
+	var others []model.CloudPath
+	if err := database.DB.Where("id <> ? AND link_type = ?", cloudPath.ID, model.LinkTypeStrm).
+		Find(&others).Error; err != nil {
+		return nil, fmt.Errorf("查询嵌套的云路径映射失败: %w", err)
+	}
+	localPath := filepath.Clean(cloudPath.LocalPath)
+	var nested []string
+	for _, other := range others {
+		if strings.TrimSpace(other.LocalPath) == "" || filepath.Clean(other.LocalPath) != localPath {
+			continue
+		}
+		if pathhelper.IsSubPath(other.SourcePath, cloudPath.SourcePath) && !pathhelper.IsSubPath(cloudPath.SourcePath, other.SourcePath) {
+			nested = append(nested, other.SourcePath)
+		}
+	}
+	return nested, nil
+}
+
+// inNestedCloudPath 判断事件路径是否落在嵌套的其他 CloudPath 之内
+func inNestedCloudPath(filePath string, nested []string) bool {
+	for _, source := range nested {
+		if pathhelper.IsSubPath(filePath, source) {
+			return true
+		}
+	}
+	return false
+}
+
+// collectCloud 严格遍历云端 SourcePath，返回 STRM 相对路径 -> 期望内容。
+// 任一目录列举失败都会中止，避免把未列出的文件误判为已删除。
+func (s *StrmReconcileService) collectCloud(ctx context.Context, cloudPath model.CloudPath, nested []string) (map[string]strmExpectation, error) {
+	drv, err := NewStorageDriver(*cloudPath.CloudStorage, s.logger)
+	if err != nil {
+		return nil, err
+	}
+	strmSvc := &StrmService{logger: s.logger}
+	sourceCloudPath := strmSvc.cloudSourcePath(cloudPath.SourcePath, cloudPath)
+	root, found, err := drv.ResolvePath(ctx, sourceCloudPath)
+	if err != nil {
+		return nil, fmt.Errorf("获取云端目录失败: %w", err)
+	}
+	if !found {
+		return nil, fmt.Errorf("云端目录不存在: %s", sourceCloudPath)
+	}
+
+	expected := map[string]strmExpectation{}
+	renderer := newStrmContentRenderer(cloudPath)
+	err = WalkStorageDirStrict(ctx, drv, root.ID, cloudPath.SourcePath, s.logger, func(filePath string, entry StorageEntry) error {
+		if inNestedCloudPath(filePath, nested) {
+			return nil
+		}
+		fileExt := strings.ToLower(filepath.Ext(entry.Name))
+		if cloudPath.FilterRules != "" && !pathhelper.IsFileInAnyFilterRules(fileExt, cloudPath.FilterRules) {
+			return nil
+		}
+		if pathhelper.IsFileMatchedByFilter(fileExt, cloudPath.FilterRules, "download") {
+			return nil
+		}
+		key, ok := strmKeyForSource(filePath)
+		if !ok {
+			return nil
+		}
+		content, err := renderer.render(filePath, entry)
+		if err != nil {
+			return err
+		}
+		expected[key] = strmExpectation{
+			Source:   filePath,
+			PickCode: entry.PickCode,
+			Content:  content,
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return expected, nil
+}
+
+// strmKeyForSource 将事件空间的源文件路径转换为 LocalPath 下 STRM 的相对路径(正斜杠)。
+func strmKeyForSource(sourcePath string) (string, bool) {
+	relativePath, err := pathhelper.SafeRelativePath(sourcePath)
+	if err != nil || relativePath == "." {
+		return "", false
+	}
+	relativePath = filepath.ToSlash(relativePath)
+	return strings.TrimSuffix(relativePath, path.Ext(relativePath)) + ".strm", true
+}
+
+// normalizeStrmKey 将本地 STRM 相对路径的扩展名统一为小写 .strm，与 strmKeyForSource 的结果对齐。
+func normalizeStrmKey(key string) string {
+	return strings.TrimSuffix(key, path.Ext(key)) + ".strm"
+}
+
+// collectLocalStrm 读取 LocalPath 中 SourcePath 子树下的所有 STRM，返回相对路径 -> 内容；nested 对应的子树整体跳过。
+func collectLocalStrm(cloudPath model.CloudPath, nested []string) (map[string]string, error) {
+	local := map[string]string{}
+	base, err := pathhelper.JoinUnderRoot(cloudPath.LocalPath, cloudPath.SourcePath)
+	if err != nil {
+		return nil, err
+	}
+	skipDirs := make(map[string]bool, len(nested))
+	for _, source := range nested {
+		dir, err := pathhelper.JoinUnderRoot(cloudPath.LocalPath, source)
+		if err != nil {
+			return nil, err
+		}
+		skipDirs[dir] = true
+	}
+	if _, err := os.Stat(base); os.IsNotExist(err) {
+		return local, nil
+	}
+	localRoot, err := filepath.Abs(cloudPath.LocalPath)
+	if err != nil {
+		return nil, err
+	}
+	err = filepath.WalkDir(base, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if skipDirs[p] {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !strings.EqualFold(filepath.Ext(p), ".strm") {
+			return nil
+		}
+		rel, err := filepath.Rel(localRoot, p)
+		if err != nil {
+			return err
+		}
+		content, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		local[filepath.ToSlash(rel)] = strings.TrimSpace(string(content))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("遍历本地 STRM 失败: %w", err)
+	}
+	return local, nil
+}
+
+// planStrmReconcile 比较期望与本地 STRM，按相对路径排序输出差异动作。
+// 本地 STRM 扩展名不区分大小写(如 a.STRM)，重写与删除作用在本地实际文件上。
+func planStrmReconcile(expected map[string]strmExpectation, local map[string]string) []StrmReconcileAction {
+	localKeys := make(map[string]string, len(local))
+	for key := range local {
+		localKeys[normalizeStrmKey(key)] = key
+	}
+	var actions []StrmReconcileAction
+	for key, want := range expected {
+		localKey, exists := localKeys[key]
+		current := local[localKey]
+		switch {
+		case !exists:
+			actions = append(actions, StrmReconcileAction{
+				Action: StrmReconcileCreate, Source: want.Source, Target: key,
+				PickCode: want.PickCode, Expected: want.Content,
+			})
+		case current != strings.TrimSpace(want.Content):
+			actions = append(actions, StrmReconcileAction{
+				Action: StrmReconcileRewrite, Source: want.Source, Target: localKey,
+				PickCode: want.PickCode, Current: current, Expected: want.Content,
+			})
+		}
+	}
+	for key, current := range local {
+		if _, ok := expected[normalizeStrmKey(key)]; !ok {
+			actions = append(actions, StrmReconcileAction{
+				Action: StrmReconcileDelete, Target: key, Current: current,
+			})
+		}
+	}
+	sort.Slice(actions, func(i, j int) bool {
+		if actions[i].Target != actions[j].Target {
+			return actions[i].Target < actions[j].Target
+		}
+		return actions[i].Action < actions[j].Action
+	})
+	return actions
+}
+
+// apply 执行单条对账动作并写入整理日志
+func (s *StrmReconcileService) apply(cloudPath model.CloudPath, action *StrmReconcileAction, trigger string) {
+	start := time.Now()
+	err := applyStrmReconcileAction(cloudPath.LocalPath, *action)
+
+	logAction := model.OrganizeActionStrmCreate
+	message := "对账补建 STRM"
+	switch action.Action {
+	case StrmReconcileDelete:
+		logAction = model.OrganizeActionStrmDelete
+		message = "对账删除孤儿 STRM"
+	case StrmReconcileRewrite:
+		logAction = model.OrganizeActionStrmRewrite
+		message = "对账重写 STRM 内容"
+	}
+
+	entry := OrganizeLogEntry{
+		Action: logAction, Status: model.OrganizeStatusSuccess, Trigger: trigger,
+		Source: action.Source, Target: filepath.Join(cloudPath.LocalPath, filepath.FromSlash(action.Target)),
+		CloudPathID: cloudPath.ID, CloudStorageID: cloudPath.CloudStorageID,
+		PickCode: action.PickCode, Message: message, DurationMS: time.Since(start).Milliseconds(),
+	}
+	if err != nil {
+		action.Status = model.OrganizeStatusFailed
+		action.Error = err.Error()
+		entry.Status = model.OrganizeStatusFailed
+		entry.Error = err.Error()
+		s.logger.Warnf("STRM 对账动作失败 %s %s: %v", action.Action, action.Target, err)
+	} else {
+		action.Status = model.OrganizeStatusSuccess
+		// 与 CreateStrmOrDownload 一致，顺手缓存 pickcode
+		if action.Action != StrmReconcileDelete && action.PickCode != "" &&
+			cloudPath.CloudStorage != nil && cloudPath.CloudStorage.UsesPickcode() {
+			model.UpsertPickcodeCache(database.DB, pathhelper.SafeFilePathJoin(cloudPath.ContentPrefix, action.Source), action.PickCode)
+		}
+	}
+	WriteOrganizeLog(s.logger, entry)
+}
+
+// applyStrmReconcileAction 在 LocalPath 根目录内执行写入或删除。
+// 删除孤儿时只清理本服务生成的媒体信息文件；同名 nfo 可能由刮削器写入，保留不动。
+func applyStrmReconcileAction(localPath string, action StrmReconcileAction) error {
+	if err := os.MkdirAll(localPath, 0755); err != nil {
+		return err
+	}
+	root, err := os.OpenRoot(localPath)
+	if err != nil {
+		return err
+	}
+	defer root.Close()
+
+	relativePath, err := pathhelper.SafeRelativePath(action.Target)
+	if err != nil || relativePath == "." {
+		return fmt.Errorf("不安全的 STRM 路径: %s", action.Target)
+	}
+
+	if action.Action == StrmReconcileDelete {
+		if err := root.Remove(relativePath); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		sidecar := strings.TrimSuffix(relativePath, filepath.Ext(relativePath)) + StrmMediaInfoSuffix
+		if err := root.Remove(sidecar); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+
+	if err := root.MkdirAll(filepath.Dir(relativePath), 0755); err != nil {
+		return err
+	}
+	return root.WriteFile(relativePath, []byte(action.Expected), 0644)
+}
@@ -0,0 +1,244 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+)
+
+// reconcileFakeDriver 在 fakeStorageDriver 基础上支持解析对账根目录。
+type reconcileFakeDriver struct {
+	*fakeStorageDriver
+}
+
+func (d reconcileFakeDriver) ResolvePath(_ context.Context, p string) (StorageEntry, bool, error) {
+	if p == "/Media" {
+		return StorageEntry{ID: "root", Name: "Media", IsDir: true}, true, nil
+	}
+	return StorageEntry{}, false, nil
+}
+
+func setupStrmReconcileTest(t *testing.T, drv StorageDriver) (*StrmReconcileService, model.CloudPath) {
+	t.Helper()
+	oldDB := database.DB
+	db, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "reconcile.db")), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatalf("open sqlite test db: %v", err)
+	}
+	if err := db.AutoMigrate(&model.CloudPath{}, &model.OrganizeLog{}, &model.PickcodeCache{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	database.DB = db
+	t.Cleanup(func() { database.DB = oldDB })
+
+	RegisterStorageDriver(StorageDriverInfo{Type: "fake-reconcile"}, func(model.CloudStorage, *logger.Logger) (StorageDriver, error) {
+		return drv, nil
+	})
+	t.Cleanup(func() {
+		storageDriversMu.Lock()
+		delete(storageDrivers, "fake-reconcile")
+		storageDriversMu.Unlock()
+	})
+
+	cloudPath := model.CloudPath{
+		UserID:         1,
+		CloudStorageID: 1,
+		SourcePath:     "/Media",
+		SourceType:     model.SourceTypeMoviePilot2,
+		ContentPrefix:  "http://strm",
+		LocalPath:      t.TempDir(),
+		LinkType:       model.LinkTypeStrm,
+		FilterRules:    `{"include":[".mkv"],"download":[".srt"]}`,
+		CloudStorage:   &model.CloudStorage{ID: 1, StorageType: "fake-reconcile"},
+	}
+	if err := db.Create(&cloudPath).Error; err != nil {
+		t.Fatalf("create cloud path: %v", err)
+	}
+	log := logger.New(config.LogConfig{Level: "error", Output: "stdout"})
+	return NewStrmReconcileService(log), cloudPath
+}
+
+func writeLocalStrm(t *testing.T, root, rel, content string) {
+	t.Helper()
+	full := filepath.Join(root, filepath.FromSlash(rel))
+	if err := os.MkdirAll(filepath.Dir(full), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(full, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPlanStrmReconcile(t *testing.T) {
+	expected := map[string]strmExpectation{
+		"Media/a.strm": {Source: "/Media/a.mkv", Content: "http://strm/Media/a.mkv"},
+		"Media/b.strm": {Source: "/Media/b.mkv", Content: "http://strm/Media/b.mkv"},
+		"Media/c.strm": {Source: "/Media/c.mkv", Content: "http://strm/Media/c.mkv"},
+		"Media/d.strm": {Source: "/Media/d.mkv", Content: "http://strm/Media/d.mkv"},
+		"Media/e.strm": {Source: "/Media/e.mkv", Content: "http://strm/Media/e.mkv"},
+	}
+	local := map[string]string{
+		"Media/a.strm":    "http://strm/Media/a.mkv",
+		"Media/d.STRM":    "http://strm/Media/d.mkv",
+		"Media/e.Strm":    "http://old/Media/e.mkv",
+		"Media/b.strm":    "http://old/Media/b.mkv",
+		"Media/gone.strm": "http://strm/Media/gone.mkv",
+	}
+	actions := planStrmReconcile(expected, local)
+	got := make([]string, 0, len(actions))
+	for _, action := range actions {
+		got = append(got, action.Action+":"+action.Target)
+	}
+	// 扩展名大小写不同的本地 STRM 视为同一文件，重写作用在本地实际文件上
+	want := []string{"rewrite:Media/b.strm", "create:Media/c.strm", "rewrite:Media/e.Strm", "delete:Media/gone.strm"}
+	if len(got) != len(want) {
+		t.Fatalf("actions = %v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("actions = %v, want %v", got, want)
+		}
+	}
+}
+
+func TestStrmReconcileDryRunThenApply(t *testing.T) {
+	drv := reconcileFakeDriver{&fakeStorageDriver{children: map[string][]StorageEntry{
+		"root": {
+			{ID: "s1", Name: "Show", IsDir: true},
+			{ID: "f1", Name: "Movie.mkv", PickCode: "pc1"},
+			{ID: "f2", Name: "Movie.srt"},
+		},
+		"s1": {{ID: "f3", Name: "E01.mkv", PickCode: "pc3"}},
+	}}}
+	svc, cloudPath := setupStrmReconcileTest(t, drv)
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Show/E01.strm", "http://old/Media/Show/E01.mkv")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Deleted.strm", "http://strm/Media/Deleted.mkv")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Deleted.nfo", "<movie/>")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Deleted"+StrmMediaInfoSuffix, "[]")
+
+	report, err := svc.Reconcile(context.Background(), cloudPath, false, model.OrganizeTriggerManual)
+	if err != nil {
+		t.Fatalf("dry run: %v", err)
+	}
+	if !report.DryRun || report.Creates != 1 || report.Deletes != 1 || report.Rewrites != 1 || report.CloudFiles != 2 {
+		t.Fatalf("dry run report = %+v", report)
+	}
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "Movie.strm")); !os.IsNotExist(err) {
+		t.Fatalf("dry run must not create files, stat err = %v", err)
+	}
+
+	report, err = svc.Reconcile(context.Background(), cloudPath, true, model.OrganizeTriggerReconcile)
+	if err != nil {
+		t.Fatalf("apply: %v", err)
+	}
+	if report.Failed != 0 {
+		t.Fatalf("apply report = %+v", report)
+	}
+	content, err := os.ReadFile(filepath.Join(cloudPath.LocalPath, "Media", "Movie.strm"))
+	if err != nil || string(content) != "http://strm/Media/Movie.mkv" {
+		t.Fatalf("created strm = %q, %v", content, err)
+	}
+	if info, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "Movie.strm")); err != nil || info.Mode().Perm()&^0644 != 0 {
+		t.Fatalf("created strm mode = %v, %v", info.Mode(), err)
+	}
+	content, _ = os.ReadFile(filepath.Join(cloudPath.LocalPath, "Media", "Show", "E01.strm"))
+	if string(content) != "http://strm/Media/Show/E01.mkv" {
+		t.Fatalf("rewritten strm = %q", content)
+	}
+	for _, name := range []string{"Deleted.strm", "Deleted" + StrmMediaInfoSuffix} {
+		if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", name)); !os.IsNotExist(err) {
+			t.Fatalf("%s should be deleted, stat err = %v", name, err)
+		}
+	}
+	// nfo 可能由刮削器写入，对账不删除
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "Deleted.nfo")); err != nil {
+		t.Fatalf("scraper nfo should be kept: %v", err)
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	var logs int64
+	for time.Now().Before(deadline) {
+		database.DB.Model(&model.OrganizeLog{}).Where("trigger = ?", model.OrganizeTriggerReconcile).Count(&logs)
+		if logs == 3 {
+			break
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	if logs != 3 {
+		t.Fatalf("organize logs = %d, want 3", logs)
+	}
+	var stored model.CloudPath
+	database.DB.First(&stored, cloudPath.ID)
+	if stored.LastReconciledAt == nil {
+		t.Fatal("last_reconciled_at should be updated after apply")
+	}
+}
+
+func TestStrmReconcileSkipsNestedCloudPath(t *testing.T) {
+	drv := reconcileFakeDriver{&fakeStorageDriver{children: map[string][]StorageEntry{
+		"root": {
+			{ID: "s1", Name: "Show", IsDir: true},
+			{ID: "f1", Name: "Movie.mkv", PickCode: "pc1"},
+		},
+		"s1": {{ID: "f3", Name: "E01.mkv", PickCode: "pc3"}},
+	}}}
+	svc, cloudPath := setupStrmReconcileTest(t, drv)
+	inner := cloudPath
+	inner.ID = 0
+	inner.SourcePath = "/Media/Show"
+	inner.ContentPrefix = "http://inner"
+	if err := database.DB.Create(&inner).Error; err != nil {
+		t.Fatalf("create nested cloud path: %v", err)
+	}
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Movie.strm", "http://strm/Media/Movie.mkv")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Show/E01.strm", "http://inner/Media/Show/E01.mkv")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Show/Extra.strm", "http://inner/Media/Show/Extra.mkv")
+
+	report, err := svc.Reconcile(context.Background(), cloudPath, true, model.OrganizeTriggerManual)
+	if err != nil {
+		t.Fatalf("reconcile: %v", err)
+	}
+	if report.Creates != 0 || report.Deletes != 0 || report.Rewrites != 0 || report.CloudFiles != 1 || report.LocalStrm != 1 {
+		t.Fatalf("report = %+v", report)
+	}
+	content, _ := os.ReadFile(filepath.Join(cloudPath.LocalPath, "Media", "Show", "E01.strm"))
+	if string(content) != "http://inner/Media/Show/E01.mkv" {
+		t.Fatalf("nested strm was rewritten: %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "Show", "Extra.strm")); err != nil {
+		t.Fatalf("nested strm must not be deleted: %v", err)
+	}
+}
+
+func TestStrmReconcileAbortsOnListError(t *testing.T) {
+	drv := reconcileFakeDriver{&fakeStorageDriver{
+		children: map[string][]StorageEntry{"root": {{ID: "s1", Name: "Show", IsDir: true}}},
+		listErr:  map[string]error{"s1": errors.New("rate limited")},
+	}}
+	svc, cloudPath := setupStrmReconcileTest(t, drv)
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Show/E01.strm", "http://strm/Media/Show/E01.mkv")
+
+	if _, err := svc.Reconcile(context.Background(), cloudPath, true, model.OrganizeTriggerManual); err == nil {
+		t.Fatal("reconcile should fail when a directory cannot be listed")
+	}
+	if _, err := os.Stat(filepath.Join(cloudPath.LocalPath, "Media", "Show", "E01.strm")); err != nil {
+		t.Fatalf("strm must be kept when the cloud walk is incomplete: %v", err)
+	}
+	if report := svc.LatestReport(cloudPath.ID); report == nil || report.Status != StrmReconcileStatusFailed {
+		t.Fatalf("latest report = %+v", report)
+	}
+}
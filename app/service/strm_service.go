@@ -6,26 +6,25 @@ import (
 	"film-fusion/app/logger"
 	"film-fusion/app/model"
 	"film-fusion/app/utils/pathhelper"
+	"fmt"
 	"net/url"
 	"os"
 	"path/filepath"
 	"strings"
-
-	sdk115 "github.com/OpenListTeam/115-sdk-go"
 )
 
 // StrmService STRM 文件处理服务
 type StrmService struct {
 	logger         *logger.Logger
-	sdk115Open     *sdk115.Client
 	download115Svc *Download115Service
+	// mediaInfoProbes 为空时使用进程内共享的探测队列
+	mediaInfoProbes *strmMediaInfoQueue
 }
 
 // NewStrmService 创建新的 StrmService
 func NewStrmService(log *logger.Logger, download115Svc *Download115Service) *StrmService {
 	return &StrmService{
 		logger:         log,
-		sdk115Open:     sdk115.New(),
 		download115Svc: download115Svc,
 	}
 }
@@ -51,9 +50,9 @@ func (s *StrmService) CreateFile(path string, cloudPath model.CloudPath) error {
 		}
 	}
 
-	// 处理 115OPEN API 创建 STRM 文件
-	if cloudPath.CloudStorage.StorageType == model.StorageType115Open {
-		s.CreateStrmOrDownloadWith115OpenAPI(path, cloudPath, "")
+	// 由存储驱动支持的云盘创建 STRM 文件
+	if s.supportsStorage(cloudPath) {
+		s.CreateStrmOrDownload(path, cloudPath, "")
 		return nil
 	}
 
@@ -77,9 +76,9 @@ func (s *StrmService) RenameFile(originalPath, path string, cloudPath model.Clou
 		}
 	}
 
-	// 处理 115OPEN API 创建 STRM 文件
-	if destinationInside && cloudPath.CloudStorage.StorageType == model.StorageType115Open {
-		s.CreateStrmOrDownloadWith115OpenAPI(path, cloudPath, "")
+	// 由存储驱动支持的云盘创建 STRM 文件
+	if destinationInside && s.supportsStorage(cloudPath) {
+		s.CreateStrmOrDownload(path, cloudPath, "")
 		// 不能 Return --- 因为可能需要删除原来的文件
 	}
 
@@ -95,8 +94,8 @@ func (s *StrmService) CreateDir(path string, cloudPath model.CloudPath) {
 		return
 	}
 
-	if cloudPath.CloudStorage.StorageType == model.StorageType115Open && pathhelper.IsSubPath(path, cloudPath.SourcePath) {
-		s.WalkDirWith115OpenAPI(path, cloudPath)
+	if s.supportsStorage(cloudPath) && pathhelper.IsSubPath(path, cloudPath.SourcePath) {
+		s.WalkDir(path, cloudPath)
 	}
 }
 
@@ -106,8 +105,8 @@ func (s *StrmService) RenameDir(originalPath, path string, cloudPath model.Cloud
 		return
 	}
 
-	if destinationInside && cloudPath.CloudStorage.StorageType == model.StorageType115Open {
-		s.WalkDirWith115OpenAPI(path, cloudPath)
+	if destinationInside && s.supportsStorage(cloudPath) {
+		s.WalkDir(path, cloudPath)
 	}
 
 	// 原路径也在监控目录内时，需要删除本地的内容
@@ -116,9 +115,9 @@ func (s *StrmService) RenameDir(originalPath, path string, cloudPath model.Cloud
 	}
 }
 
-// WalkDirWith115OpenAPI 使用115 Open API递归遍历目录
+// WalkDir 使用云盘存储驱动递归遍历目录
 // 该方法会：
-// 1. 使用115 SDK获取指定目录下的所有文件和子目录
+// 1. 通过存储驱动获取指定目录下的所有文件和子目录
 // 2. 对符合过滤规则的文件调用 pathhelper.IsFileInAnyFilterRules() 进行过滤
 // 3. 为通过过滤的文件创建STRM文件或添加到下载队列
 // 4. 对子目录进行递归遍历
@@ -126,100 +125,67 @@ func (s *StrmService) RenameDir(originalPath, path string, cloudPath model.Cloud
 // 参数：
 //   - dirPath: 要遍历的目录路径
 //   - cloudPath: 云盘路径配置信息，包含过滤规则等
-func (s *StrmService) WalkDirWith115OpenAPI(dirPath string, cloudPath model.CloudPath) {
-	// 设置访问令牌
-	s.sdk115Open.SetAccessToken(cloudPath.CloudStorage.AccessToken)
-
-	sourceCloudPath := pathhelper.EnsureLeadingSlash(dirPath)
-	// 转换路径为云盘路径
-	if cloudPath.SourceType == model.SourceTypeCloudDrive2 {
-		sourceCloudPath = pathhelper.EnsureLeadingSlash(pathhelper.RemoveFirstDir(dirPath))
+func (s *StrmService) WalkDir(dirPath string, cloudPath model.CloudPath) {
+	if cloudPath.CloudStorage == nil {
+		s.logger.Warnf("CloudPath (ID: %d) 缺少关联的云存储配置，跳过遍历", cloudPath.ID)
+		return
 	}
-
-	// 获取目录信息
-	folderInfo, err := s.sdk115Open.GetFolderInfoByPath(context.Background(), sourceCloudPath)
+	drv, err := NewStorageDriver(*cloudPath.CloudStorage, s.logger)
 	if err != nil {
-		s.logger.Errorf("获取115Open目录信息失败: %s, 错误: %v", sourceCloudPath, err)
+		s.logger.Errorf("创建存储驱动失败: %v", err)
 		return
 	}
 
-	s.logger.Debugf("开始遍历115Open目录: %s (CID: %s)", sourceCloudPath, folderInfo.FileID)
-
-	// 递归遍历目录
-	s.walkDir115(folderInfo.FileID, dirPath, cloudPath, 0)
-}
+	sourceCloudPath := s.cloudSourcePath(dirPath, cloudPath)
 
-// walkDir115 递归遍历115目录的内部实现
-// 该方法处理分页获取文件列表，并对每个文件/目录进行相应处理
-//
-// 参数：
-//   - cid: 115目录的ID (从GetFolderInfoByPath获取的PickCode)
-//   - currentPath: 当前遍历的路径
-//   - cloudPath: 云盘路径配置信息
-//   - depth: 当前递归深度，用于防止无限递归
-func (s *StrmService) walkDir115(cid, currentPath string, cloudPath model.CloudPath, depth int) {
-	// 防止无限递归
-	maxDepth := 50
-	if depth >= maxDepth {
-		s.logger.Warnf("达到最大递归深度 %d，停止遍历: %s", maxDepth, currentPath)
+	// 获取目录信息
+	folderInfo, found, err := drv.ResolvePath(context.Background(), sourceCloudPath)
+	if err != nil || !found {
+		s.logger.Errorf("获取%s目录信息失败: %s, 错误: %v", drv.Type(), sourceCloudPath, err)
 		return
 	}
 
-	// 获取当前目录下的文件列表
-	req := &sdk115.GetFilesReq{
-		CID:     cid,
-		ShowDir: true, // 显示目录
-		Stdir:   1,    // 显示文件夹
-		Limit:   1150, // 一次获取1150个文件
-		Offset:  0,
-	}
+	s.logger.Debugf("开始遍历%s目录: %s (ID: %s)", drv.Type(), sourceCloudPath, folderInfo.ID)
 
-	for {
-		resp, err := s.sdk115Open.GetFiles(context.Background(), req)
-		if err != nil {
-			s.logger.Errorf("获取115Open目录文件列表失败: CID=%s, 错误: %v", cid, err)
-			return
-		}
+	_ = WalkStorageDir(context.Background(), drv, folderInfo.ID, dirPath, s.logger, func(filePath string, entry StorageEntry) error {
+		fileExt := strings.ToLower(filepath.Ext(entry.Name))
 
-		s.logger.Debugf("获取到 %d 个文件/目录, CID: %s", len(resp.Data), cid)
-
-		// 处理每个文件/目录
-		for _, file := range resp.Data {
-			filePath := filepath.Join(currentPath, file.Fn)
-
-			// 如果是目录 (Fc == "0")
-			if file.Fc == "0" {
-				s.logger.Debugf("发现目录: %s", filePath)
-				// 递归处理子目录
-				s.walkDir115(file.Fid, filePath, cloudPath, depth+1)
-			} else {
-				// 如果是文件 (Fc == "1")
-				fileExt := strings.ToLower(filepath.Ext(file.Fn))
+		// 检查文件是否在过滤规则中
+		if cloudPath.FilterRules != "" && !pathhelper.IsFileInAnyFilterRules(fileExt, cloudPath.FilterRules) {
+			s.logger.Debugf("文件 %s 不在过滤规则中，跳过处理", filePath)
+			return nil
+		}
 
-				// 检查文件是否在过滤规则中
-				if cloudPath.FilterRules != "" && !pathhelper.IsFileInAnyFilterRules(fileExt, cloudPath.FilterRules) {
-					s.logger.Debugf("文件 %s 不在过滤规则中，跳过处理", filePath)
-					continue
-				}
+		s.logger.Debugf("处理文件: %s", filePath)
 
-				s.logger.Debugf("处理文件: %s", filePath)
+		// 为符合过滤规则的文件创建STRM文件或下载
+		s.CreateStrmOrDownloadWithEntry(filePath, cloudPath, entry)
+		return nil
+	})
+}
 
-				// 为符合过滤规则的文件创建STRM文件或下载
-				s.CreateStrmOrDownloadWith115OpenAPI(filePath, cloudPath, file.Pc)
-			}
-		}
+// cloudSourcePath 将事件路径转换为网盘内路径；CloudDrive2 的路径首段是挂载名，需要去掉。
+func (s *StrmService) cloudSourcePath(eventPath string, cloudPath model.CloudPath) string {
+	if cloudPath.SourceType == model.SourceTypeCloudDrive2 {
+		return pathhelper.EnsureLeadingSlash(pathhelper.RemoveFirstDir(eventPath))
+	}
+	return pathhelper.EnsureLeadingSlash(eventPath)
+}
 
-		// 检查是否还有更多文件
-		if req.Offset+req.Limit >= resp.Count {
-			break
-		}
+// supportsStorage 判断 CloudPath 关联的存储是否有可用驱动。
+func (s *StrmService) supportsStorage(cloudPath model.CloudPath) bool {
+	return cloudPath.CloudStorage != nil && IsSupportedStorageType(cloudPath.CloudStorage.StorageType)
+}
 
-		// 继续获取下一批文件
-		req.Offset += req.Limit
-	}
+// CreateStrmOrDownload 通过存储驱动为云盘文件生成 STRM，或按下载规则加入下载队列；pickcode 可为空
+func (s *StrmService) CreateStrmOrDownload(path string, cloudPath model.CloudPath, pickcode string) {
+	s.CreateStrmOrDownloadWithEntry(path, cloudPath, StorageEntry{PickCode: pickcode})
 }
 
-func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath model.CloudPath, pickcode string) {
+// CreateStrmOrDownloadWithEntry 与 CreateStrmOrDownload 相同，
+// 但携带遍历得到的网盘条目，供 STRM 内容模板使用 sha1/size 等属性。
+func (s *StrmService) CreateStrmOrDownloadWithEntry(path string, cloudPath model.CloudPath, entry StorageEntry) {
+	pickcode := entry.PickCode
 	savePath, err := pathhelper.JoinUnderRoot(cloudPath.LocalPath, path)
 	if err != nil {
 		s.logger.Warnf("拒绝不安全的 STRM 目标路径 %q: %v", path, err)
@@ -236,11 +202,7 @@ func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath
 
 	// 如果匹配中下载的后缀直接调用 115Open API 下载
 	if pathhelper.IsFileMatchedByFilter(fileExt, cloudPath.FilterRules, "download") {
-		sourceCloudPath := pathhelper.EnsureLeadingSlash(path)
-
-		if cloudPath.SourceType == model.SourceTypeCloudDrive2 {
-			sourceCloudPath = pathhelper.EnsureLeadingSlash(pathhelper.RemoveFirstDir(path))
-		}
+		sourceCloudPath := s.cloudSourcePath(path, cloudPath)
 
 		// 不重复下载
 		if _, err := os.Stat(savePath); err == nil {
@@ -253,19 +215,18 @@ func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath
 			return
 		}
 
-		s.sdk115Open.SetAccessToken(cloudPath.CloudStorage.AccessToken)
-		folderInfo, err := s.sdk115Open.GetFolderInfoByPath(context.Background(), sourceCloudPath)
+		folderInfo, err := s.resolveCloudFile(cloudPath, sourceCloudPath)
 		if err != nil {
-			s.logger.Errorf("获取115Open文件夹信息失败: %v", err)
+			s.logger.Errorf("获取云盘文件信息失败: %v", err)
 			WriteOrganizeLog(s.logger, OrganizeLogEntry{
 				Action: model.OrganizeActionFileDownload, Status: model.OrganizeStatusFailed,
 				Source: path, Target: savePath, CloudPathID: cloudPath.ID, CloudStorageID: cloudPath.CloudStorageID,
-				PickCode: pickcode, Error: err.Error(), Message: "获取115Open文件夹信息失败",
+				PickCode: pickcode, Error: err.Error(), Message: "获取云盘文件信息失败",
 			})
 			return
 		}
 
-		s.logger.Debugf("获取115Open信息成功: %s", folderInfo.PickCode)
+		s.logger.Debugf("获取云盘文件信息成功: %s", folderInfo.PickCode)
 		if addErr := s.download115Svc.AddDownloadTask(cloudPath.CloudStorage.ID, folderInfo.PickCode, savePath); addErr != nil {
 			WriteOrganizeLog(s.logger, OrganizeLogEntry{
 				Action: model.OrganizeActionFileDownload, Status: model.OrganizeStatusSkipped,
@@ -306,18 +267,25 @@ func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath
 		}
 	}
 
-	nextPath := path
-	// 如果启用了 URI 编码，对内容进行编码
-	if cloudPath.ContentEncodeURI {
-		// 对路径进行URL编码，但保留路径分隔符
-		pathParts := strings.Split(nextPath, "/")
-		for i, part := range pathParts {
-			pathParts[i] = url.PathEscape(part)
+	// 内容需要文件属性而事件未携带时，从网盘补齐
+	if strmEntryMissingFileInfo(cloudPath, entry) {
+		if info, err := s.resolveCloudFile(cloudPath, s.cloudSourcePath(path, cloudPath)); err == nil {
+			entry = info
+			pickcode = info.PickCode
+		} else {
+			s.logger.Warnf("获取云盘文件信息失败，模板中的文件属性将为空: %v", err)
 		}
-		nextPath = strings.Join(pathParts, "/")
 	}
-
-	content := pathhelper.SafeFilePathJoin(cloudPath.ContentPrefix, nextPath)
+	content, err := renderStrmContent(path, cloudPath, entry)
+	if err != nil {
+		s.logger.Errorf("生成 STRM 内容失败: %v", err)
+		WriteOrganizeLog(s.logger, OrganizeLogEntry{
+			Action: model.OrganizeActionStrmCreate, Status: model.OrganizeStatusFailed,
+			Source: path, Target: strmFilePath, CloudPathID: cloudPath.ID, CloudStorageID: cloudPath.CloudStorageID,
+			PickCode: pickcode, Error: err.Error(), Message: "生成 STRM 内容失败",
+		})
+		return
+	}
 
 	// 提前创建文件夹
 	err = localRoot.MkdirAll(filepath.Dir(relativePath), 0755)
@@ -326,7 +294,7 @@ func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath
 		return
 	}
 
-	err = localRoot.WriteFile(strmRelativePath, []byte(content), 0777)
+	err = localRoot.WriteFile(strmRelativePath, []byte(content), 0644)
 	if err != nil {
 		s.logger.Errorf("创建 STRM 文件失败: %v", err)
 		WriteOrganizeLog(s.logger, OrganizeLogEntry{
@@ -342,6 +310,14 @@ func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath
 		PickCode: pickcode, Message: content,
 	})
 
+	// 媒体信息需要读取云端文件，交给后台队列补写，不阻塞 STRM 生成
+	if cloudPath.MediaInfoSidecar != "" && strmMediaInfoMissing(localRoot, relativeFullPath, cloudPath.MediaInfoSidecar) {
+		job := strmMediaInfoJob{localPath: cloudPath.LocalPath, relativeBase: relativeFullPath, eventPath: path, cloudPath: cloudPath, entry: entry}
+		if !s.mediaInfoQueue().enqueue(job) {
+			s.logger.Warnf("媒体信息探测队列已满，跳过 %s", path)
+		}
+	}
+
 	// 尽可能的缓存 pickcode
 	if pickcode != "" && cloudPath.CloudStorage.StorageType == model.StorageType115Open {
 		// 缓存 key 采用 STRM 内容空间的绝对路径，即 ContentPrefix + path，
@@ -354,6 +330,41 @@ func (s *StrmService) CreateStrmOrDownloadWith115OpenAPI(path string, cloudPath
 	s.logger.Debugf("STRM 文件内容: %s", content)
 }
 
+// strmFileContent 根据 CloudPath 的内容前缀与编码设置生成 STRM 文件内容。
+func strmFileContent(path string, cloudPath model.CloudPath) string {
+	nextPath := path
+	// 如果启用了 URI 编码，对内容进行编码
+	if cloudPath.ContentEncodeURI {
+		// 对路径进行URL编码，但保留路径分隔符
+		pathParts := strings.Split(nextPath, "/")
+		for i, part := range pathParts {
+			pathParts[i] = url.PathEscape(part)
+		}
+		nextPath = strings.Join(pathParts, "/")
+	}
+
+	return pathhelper.SafeFilePathJoin(cloudPath.ContentPrefix, nextPath)
+}
+
+// resolveCloudFile 通过存储驱动解析网盘内文件，文件不存在时返回错误。
+func (s *StrmService) resolveCloudFile(cloudPath model.CloudPath, cloudFilePath string) (StorageEntry, error) {
+	if cloudPath.CloudStorage == nil {
+		return StorageEntry{}, fmt.Errorf("CloudPath (ID: %d) 缺少关联的云存储配置", cloudPath.ID)
+	}
+	drv, err := NewStorageDriver(*cloudPath.CloudStorage, s.logger)
+	if err != nil {
+		return StorageEntry{}, err
+	}
+	entry, found, err := drv.ResolvePath(context.Background(), cloudFilePath)
+	if err != nil {
+		return StorageEntry{}, err
+	}
+	if !found {
+		return StorageEntry{}, fmt.Errorf("云盘文件不存在: %s", cloudFilePath)
+	}
+	return entry, nil
+}
+
 func (s *StrmService) DeleteStrm(path string, cloudPath model.CloudPath, isDir bool) {
 	if cloudPath.LocalPath == "" {
 		s.logger.Warnf("CloudPath (ID: %d) 没有设置 LocalPath，跳过 STRM 文件删除", cloudPath.ID)
@@ -413,6 +424,13 @@ func (s *StrmService) DeleteAction(localRootPath, eventPath string, isDirectory
 		s.logger.Errorf("错误原因：%v", err)
 	}
 
+	// 删除媒体信息旁路文件
+	mediaInfoRelative := relativePath[:len(relativePath)-len(ext)] + StrmMediaInfoSuffix
+	err = root.Remove(mediaInfoRelative)
+	if err != nil && !os.IsNotExist(err) {
+		s.logger.Errorf("删除本地媒体信息文件失败：%s, %v", fullPathName+StrmMediaInfoSuffix, err)
+	}
+
 	// 删除 STRM 文件
 	strmFilename := fullPathName + ".strm"
 	strmRelative := relativePath[:len(relativePath)-len(ext)] + ".strm"
@@ -0,0 +1,334 @@
+package service
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"film-fusion/app/database"
+	"film-fusion/app/model"
+	"film-fusion/app/utils/pathhelper"
+	"fmt"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+
+	"gorm.io/gorm"
+)
+
+// StrmTemplateData STRM 内容模板可用的变量，例如：
+//
+//	http://host/d/{{.Path}}?sign={{.Sign}}
+//	http://host/115/{{.PickCode}}/{{.Name | pathEscape}}
+type StrmTemplateData struct {
+	// Path 事件路径(不带前导 /)；启用 URI 编码时逐段编码，与前缀模式拼接的部分一致
+	Path string
+	// RawPath 未编码的事件路径(不带前导 /)
+	RawPath string
+	// CloudFilePath 网盘内路径(带前导 /)，CloudDrive2 源会去掉挂载名
+	CloudFilePath string
+	// RelativePath 相对于 CloudPath.SourcePath 的路径(不带前导 /)
+	RelativePath string
+	// Name 文件名，Ext 小写扩展名(带 .)
+	Name string
+	Ext  string
+
+	FileID   string
+	PickCode string
+	SHA1     string
+	Size     int64
+
+	StorageID   uint
+	StorageType string
+	CloudPathID uint
+	// Prefix 即 CloudPath.ContentPrefix，便于模板中复用
+	Prefix string
+	// Sign OpenList 兼容的签名(永不过期)，基于 OpenList 中的文件路径计算，未配置签名密钥时为空
+	Sign string
+}
+
+var strmTemplateFuncs = template.FuncMap{
+	"pathEscape":  url.PathEscape,
+	"queryEscape": url.QueryEscape,
+}
+
+// strmTemplates 缓存已解析的模板，批量生成时避免重复解析
+var strmTemplates sync.Map
+
+// UsesStrmTemplate 判断 CloudPath 是否使用模板生成 STRM 内容
+func UsesStrmTemplate(cloudPath model.CloudPath) bool {
+	return cloudPath.StrmContentType == model.StrmContentTypeTemplate && strings.TrimSpace(cloudPath.ContentTemplate) != ""
+}
+
+// ValidateStrmTemplate 解析模板并以示例数据试渲染，引用不存在的变量会返回错误
+func ValidateStrmTemplate(text string) error {
+	if strings.TrimSpace(text) == "" {
+		return fmt.Errorf("STRM 内容模板不能为空")
+	}
+	tmpl, err := parseStrmTemplate(text)
+	if err != nil {
+		return err
+	}
+	sample := StrmTemplateData{
+		Path: "Media/Movie.mkv", RawPath: "Media/Movie.mkv", CloudFilePath: "/Media/Movie.mkv",
+		RelativePath: "Movie.mkv", Name: "Movie.mkv", Ext: ".mkv",
+	}
+	if err := tmpl.Execute(&bytes.Buffer{}, sample); err != nil {
+		return fmt.Errorf("STRM 内容模板渲染失败: %w", err)
+	}
+	return nil
+}
+
+func parseStrmTemplate(text string) (*template.Template, error) {
+	if cached, ok := strmTemplates.Load(text); ok {
+		return cached.(*template.Template), nil
+	}
+	tmpl, err := template.New("strm").Funcs(strmTemplateFuncs).Parse(text)
+	if err != nil {
+		return nil, fmt.Errorf("STRM 内容模板解析失败: %w", err)
+	}
+	strmTemplates.Store(text, tmpl)
+	return tmpl, nil
+}
+
+// strmTemplateNeedsFileInfo 判断模板是否引用了需要从网盘获取的文件属性
+func strmTemplateNeedsFileInfo(text string) bool {
+	for _, field := range []string{".PickCode", ".SHA1", ".Size", ".FileID"} {
+		if strings.Contains(text, field) {
+			return true
+		}
+	}
+	return false
+}
+
+// newStrmTemplateData 根据事件路径与网盘条目组装模板变量
+func newStrmTemplateData(eventPath string, cloudPath model.CloudPath, entry StorageEntry) StrmTemplateData {
+	rawPath := strings.TrimPrefix(path.Clean("/"+eventPath), "/")
+	relativePath := rawPath
+	if source := strings.Trim(cloudPath.SourcePath, "/"); source != "" && pathhelper.IsSubPath(rawPath, source) {
+		relativePath = strings.TrimPrefix(strings.TrimPrefix(rawPath, source), "/")
+	}
+	name := path.Base(rawPath)
+	cloudFilePath := (&StrmService{}).cloudSourcePath(eventPath, cloudPath)
+
+	data := StrmTemplateData{
+		Path:          rawPath,
+		RawPath:       rawPath,
+		CloudFilePath: cloudFilePath,
+		RelativePath:  relativePath,
+		Name:          name,
+		Ext:           strings.ToLower(path.Ext(name)),
+		FileID:        entry.ID,
+		PickCode:      entry.PickCode,
+		SHA1:          entry.SHA1,
+		Size:          entry.Size,
+		StorageID:     cloudPath.CloudStorageID,
+		CloudPathID:   cloudPath.ID,
+		Prefix:        cloudPath.ContentPrefix,
+		Sign:          openListSign(cloudPath.ContentSignKey, openListSignPath(cloudFilePath, cloudPath)),
+	}
+	if cloudPath.CloudStorage != nil {
+		data.StorageType = cloudPath.CloudStorage.StorageType
+	}
+	if cloudPath.ContentEncodeURI {
+		data.Path = escapeStoragePath(rawPath)
+	}
+	return data
+}
+
+// strmEntryMissingFileInfo 判断按 cloudPath 的内容设置生成 STRM 时，entry 是否缺少所需的网盘文件属性
+func strmEntryMissingFileInfo(cloudPath model.CloudPath, entry StorageEntry) bool {
+	if cloudPath.StrmContentType == model.StrmContentTypeSigned {
+		return entry.PickCode == "" && cloudPath.CloudStorage != nil && cloudPath.CloudStorage.UsesPickcode()
+	}
+	return entry.ID == "" && UsesStrmTemplate(cloudPath) && strmTemplateNeedsFileInfo(cloudPath.ContentTemplate)
+}
+
+// renderStrmContent 生成 STRM 文件内容：模板模式按模板渲染，签名模式生成播放令牌地址，
+// 否则为 ContentPrefix + 路径。
+func renderStrmContent(eventPath string, cloudPath model.CloudPath, entry StorageEntry) (string, error) {
+	return newStrmContentRenderer(cloudPath).render(eventPath, entry)
+}
+
+// strmContentRenderer 批量生成同一 CloudPath 的 STRM 内容(对账、重新渲染)：
+// 模板只解析一次，签名模式的令牌吊销版本只在首次渲染时查询。
+type strmContentRenderer struct {
+	cloudPath model.CloudPath
+	tmpl      *template.Template
+	versions  *strmPlaybackTokenVersions
+}
+
+func newStrmContentRenderer(cloudPath model.CloudPath) *strmContentRenderer {
+	return &strmContentRenderer{cloudPath: cloudPath}
+}
+
+func (r *strmContentRenderer) render(eventPath string, entry StorageEntry) (string, error) {
+	cloudPath := r.cloudPath
+	if cloudPath.StrmContentType == model.StrmContentTypeSigned {
+		if r.versions == nil {
+			versions, err := loadStrmPlaybackTokenVersions(cloudPath.UserID, cloudPath.CloudStorageID)
+			if err != nil {
+				return "", err
+			}
+			r.versions = &versions
+		}
+		return signedStrmContent(eventPath, cloudPath, entry, *r.versions)
+	}
+	if !UsesStrmTemplate(cloudPath) {
+		return strmFileContent(eventPath, cloudPath), nil
+	}
+	if r.tmpl == nil {
+		tmpl, err := parseStrmTemplate(cloudPath.ContentTemplate)
+		if err != nil {
+			return "", err
+		}
+		r.tmpl = tmpl
+	}
+	var buf bytes.Buffer
+	if err := r.tmpl.Execute(&buf, newStrmTemplateData(eventPath, cloudPath, entry)); err != nil {
+		return "", fmt.Errorf("STRM 内容模板渲染失败: %w", err)
+	}
+	return strings.TrimSpace(buf.String()), nil
+}
+
+// openListSignPath 返回 OpenList 中看到的文件路径：网盘内路径(已去掉 CloudDrive2 挂载目录)，
+// 存储为 OpenList 时再拼上其 RootPath，签名必须基于这个路径才能通过 OpenList 校验。
+func openListSignPath(cloudFilePath string, cloudPath model.CloudPath) string {
+	if cloudPath.CloudStorage == nil || cloudPath.CloudStorage.StorageType != model.StorageTypeOpenList {
+		return cloudFilePath
+	}
+	cfg, err := cloudPath.CloudStorage.EndpointConfig()
+	if err != nil {
+		return cloudFilePath
+	}
+	return storageEndpointPath(cfg.RootPath, cloudFilePath)
+}
+
+// openListSign 与 OpenList/Alist 的 sign 参数算法一致：
+// base64url(HMAC-SHA256(key, path + ":" + expire)) + ":" + expire，此处 expire 固定为 0(永不过期)。
+func openListSign(key, filePath string) string {
+	if key == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(filePath + ":0"))
+	return base64.URLEncoding.EncodeToString(mac.Sum(nil)) + ":0"
+}
+
+// StrmRerenderResult 按模板重新渲染本地 STRM 的结果，字段与字符串替换模式的返回保持一致
+type StrmRerenderResult struct {
+	Scanned       int      `json:"scanned"`
+	Matched       int      `json:"matched"`
+	Replaced      int      `json:"replaced"`
+	ModifiedFiles []string `json:"modified_files"`
+	Errors        []string `json:"errors,omitempty"`
+}
+
+// RerenderStrm 用 cloudPath 当前的内容设置重写 SourcePath 子树下已有的 STRM 文件。
+// 源文件扩展名与文件属性优先取自目录树快照；快照中没有时从旧 STRM 内容推断扩展名，
+// 需要 pickcode/sha1 等属性时(模板引用或签名播放地址)再逐个向网盘查询。
+func (s *StrmService) RerenderStrm(cloudPath model.CloudPath) (*StrmRerenderResult, error) {
+	nested, err := nestedCloudPathSources(cloudPath)
+	if err != nil {
+		return nil, err
+	}
+	local, err := collectLocalStrm(cloudPath, nested)
+	if err != nil {
+		return nil, err
+	}
+	snapshot, err := snapshotEntriesByStrmKey(cloudPath.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &StrmRerenderResult{ModifiedFiles: []string{}}
+	renderer := newStrmContentRenderer(cloudPath)
+	keys := make([]string, 0, len(local))
+	for key := range local {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		result.Scanned++
+		current := local[key]
+
+		var eventPath string
+		var entry StorageEntry
+		if row, ok := snapshot[normalizeStrmKey(key)]; ok {
+			eventPath = row.Path
+			entry = snapshotStorageEntry(row)
+		} else if ext := sourceExtFromStrmContent(current); ext != "" {
+			eventPath = "/" + strings.TrimSuffix(key, path.Ext(key)) + ext
+		} else {
+			result.Errors = append(result.Errors, key+": 无法确定源文件扩展名")
+			continue
+		}
+		if strmEntryMissingFileInfo(cloudPath, entry) && s.supportsStorage(cloudPath) {
+			info, err := s.resolveCloudFile(cloudPath, s.cloudSourcePath(eventPath, cloudPath))
+			if err != nil {
+				result.Errors = append(result.Errors, key+": "+err.Error())
+				continue
+			}
+			entry = info
+		}
+
+		content, err := renderer.render(eventPath, entry)
+		if err != nil {
+			return result, err
+		}
+		result.Matched++
+		if content == current {
+			continue
+		}
+		if err := applyStrmReconcileAction(cloudPath.LocalPath, StrmReconcileAction{
+			Action: StrmReconcileRewrite, Target: key, Expected: content,
+		}); err != nil {
+			result.Errors = append(result.Errors, key+": "+err.Error())
+			continue
+		}
+		result.Replaced++
+		result.ModifiedFiles = append(result.ModifiedFiles, key)
+	}
+	return result, nil
+}
+
+// snapshotEntriesByStrmKey 读取 CloudPath 的快照文件条目，按 STRM 相对路径索引；未启用快照时返回空表。
+func snapshotEntriesByStrmKey(cloudPathID uint) (map[string]model.CloudTreeSnapshotEntry, error) {
+	entries := map[string]model.CloudTreeSnapshotEntry{}
+	if !database.DB.Migrator().HasTable(&model.CloudTreeSnapshotEntry{}) {
+		return entries, nil
+	}
+	var rows []model.CloudTreeSnapshotEntry
+	err := database.DB.Where("cloud_path_id = ? AND is_dir = ?", cloudPathID, false).
+		FindInBatches(&rows, 1000, func(tx *gorm.DB, batch int) error {
+			for _, row := range rows {
+				if key, ok := strmKeyForSource(row.Path); ok {
+					entries[key] = row
+				}
+			}
+			return nil
+		}).Error
+	return entries, err
+}
+
+// sourceExtFromStrmContent 从旧 STRM 内容(URL 或路径)中推断源文件扩展名
+func sourceExtFromStrmContent(content string) string {
+	p := strings.TrimSpace(content)
+	if u, err := url.Parse(p); err == nil && u.Scheme != "" {
+		p = u.Path
+	} else if idx := strings.IndexAny(p, "?#"); idx >= 0 {
+		p = p[:idx]
+	}
+	if unescaped, err := url.PathUnescape(p); err == nil {
+		p = unescaped
+	}
+	ext := path.Ext(path.Base(strings.ReplaceAll(p, "\\", "/")))
+	if ext == "" || strings.ContainsAny(ext, " /") {
+		return ""
+	}
+	return ext
+}
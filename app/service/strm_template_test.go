@@ -0,0 +1,129 @@
+package service
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"film-fusion/app/config"
+	"film-fusion/app/database"
+	"film-fusion/app/logger"
+	"film-fusion/app/model"
+)
+
+func TestRenderStrmContentTemplate(t *testing.T) {
+	cloudPath := model.CloudPath{
+		ID:               3,
+		CloudStorageID:   9,
+		SourcePath:       "/Media",
+		ContentPrefix:    "http://strm",
+		ContentEncodeURI: true,
+		StrmContentType:  model.StrmContentTypeTemplate,
+		ContentTemplate:  "http://host/d/{{.Path}}?sign={{.Sign}}&pc={{.PickCode}}&sha1={{.SHA1}}&size={{.Size}}&rel={{.RelativePath | queryEscape}}&s={{.StorageID}}",
+		ContentSignKey:   "token",
+	}
+	entry := StorageEntry{PickCode: "pc1", SHA1: "abc", Size: 42}
+
+	got, err := renderStrmContent("/Media/My Show/E01.mkv", cloudPath, entry)
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte("token"))
+	mac.Write([]byte("/Media/My Show/E01.mkv:0"))
+	sign := base64.URLEncoding.EncodeToString(mac.Sum(nil)) + ":0"
+	want := "http://host/d/Media/My%20Show/E01.mkv?sign=" + sign + "&pc=pc1&sha1=abc&size=42&rel=My+Show%2FE01.mkv&s=9"
+	if got != want {
+		t.Fatalf("content = %q, want %q", got, want)
+	}
+
+	// 非模板类型保持前缀 + 路径的旧行为
+	cloudPath.StrmContentType = model.StrmContentTypePath
+	got, err = renderStrmContent("/Media/My Show/E01.mkv", cloudPath, entry)
+	if err != nil || got != strmFileContent("/Media/My Show/E01.mkv", cloudPath) {
+		t.Fatalf("prefix content = %q, %v", got, err)
+	}
+}
+
+func TestStrmTemplateSignUsesOpenListPath(t *testing.T) {
+	cloudPath := model.CloudPath{
+		SourcePath:      "/CloudDrive/Media",
+		SourceType:      model.SourceTypeCloudDrive2,
+		StrmContentType: model.StrmContentTypeTemplate,
+		ContentTemplate: "http://openlist/d{{.CloudFilePath}}?sign={{.Sign}}",
+		ContentSignKey:  "openlist-token",
+		CloudStorage: &model.CloudStorage{
+			StorageType: model.StorageTypeOpenList,
+			Config:      `{"url":"http://openlist","root_path":"/115"}`,
+		},
+	}
+	got, err := renderStrmContent("/CloudDrive/Media/Movie (2024).mkv", cloudPath, StorageEntry{})
+	if err != nil {
+		t.Fatalf("render: %v", err)
+	}
+	// OpenList 对 /115/Media/Movie (2024).mkv 签发的永久签名
+	want := "http://openlist/d/Media/Movie (2024).mkv?sign=FNK5NeePt9ndCa8NI-rRoJZl_1LZKKPPWBZvVeyQkcs=:0"
+	if got != want {
+		t.Fatalf("content = %q, want %q", got, want)
+	}
+}
+
+func TestValidateStrmTemplate(t *testing.T) {
+	if err := ValidateStrmTemplate("http://host/{{.PickCode}}/{{.Name | pathEscape}}"); err != nil {
+		t.Fatalf("valid template rejected: %v", err)
+	}
+	for _, text := range []string{"", "http://host/{{.Path", "http://host/{{.Unknown}}"} {
+		if err := ValidateStrmTemplate(text); err == nil {
+			t.Fatalf("template %q should be rejected", text)
+		}
+	}
+}
+
+func TestRerenderStrm(t *testing.T) {
+	_, cloudPath := setupStrmReconcileTest(t, reconcileFakeDriver{&fakeStorageDriver{}})
+	if err := database.DB.AutoMigrate(&model.CloudTreeSnapshotEntry{}); err != nil {
+		t.Fatalf("auto migrate: %v", err)
+	}
+	database.DB.Create(&model.CloudTreeSnapshotEntry{
+		CloudPathID: cloudPath.ID, FileID: "f3", Name: "E01.mp4", Path: "/Media/Show/E01.mp4", PickCode: "pc3",
+	})
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Movie.strm", "http://strm/Media/Movie.mkv")
+	writeLocalStrm(t, cloudPath.LocalPath, "Media/Show/E01.strm", "http://old/115/pc3")
+	strmSvc := NewStrmService(logger.New(config.LogConfig{Level: "error", Output: "stdout"}), nil)
+
+	// 模板只引用路径：快照中没有的文件从旧内容推断扩展名
+	cloudPath.StrmContentType = model.StrmContentTypeTemplate
+	cloudPath.ContentTemplate = "http://new/{{.Path}}"
+	result, err := strmSvc.RerenderStrm(cloudPath)
+	if err != nil {
+		t.Fatalf("rerender: %v", err)
+	}
+	if result.Scanned != 2 || result.Replaced != 2 || len(result.Errors) != 0 {
+		t.Fatalf("result = %+v", result)
+	}
+	for rel, want := range map[string]string{
+		"Media/Movie.strm":    "http://new/Media/Movie.mkv",
+		"Media/Show/E01.strm": "http://new/Media/Show/E01.mp4",
+	} {
+		content, _ := os.ReadFile(filepath.Join(cloudPath.LocalPath, filepath.FromSlash(rel)))
+		if string(content) != want {
+			t.Fatalf("%s = %q, want %q", rel, content, want)
+		}
+	}
+
+	// 模板引用 pickcode：快照命中的直接渲染，网盘上查不到的记为错误且不改动
+	cloudPath.ContentTemplate = "http://new/115/{{.PickCode}}"
+	result, err = strmSvc.RerenderStrm(cloudPath)
+	if err != nil {
+		t.Fatalf("rerender: %v", err)
+	}
+	if result.Replaced != 1 || len(result.Errors) != 1 || result.ModifiedFiles[0] != "Media/Show/E01.strm" {
+		t.Fatalf("result = %+v", result)
+	}
+	content, _ := os.ReadFile(filepath.Join(cloudPath.LocalPath, "Media", "Show", "E01.strm"))
+	if string(content) != "http://new/115/pc3" {
+		t.Fatalf("E01.strm = %q", content)
+	}
+}
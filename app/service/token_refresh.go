@@ -2,15 +2,12 @@ package service
 
 import (
 	"context"
+	"errors"
 	"film-fusion/app/database"
 	"film-fusion/app/logger"
 	"film-fusion/app/model"
-	"fmt"
-	"strconv"
 	"sync"
 	"time"
-
-	sdk115 "github.com/OpenListTeam/115-sdk-go"
 )
 
 const (
@@ -132,25 +129,23 @@ func (s *TokenRefreshService) refreshStorageToken(storage *model.CloudStorage) {
 		}
 	}
 
-	var err error
-	var newAccessToken, newRefreshToken string
-	var expiresIn int64
-
-	// 根据存储类型调用相应的刷新方法
-	switch storage.StorageType {
-	case model.StorageType115Open:
-		newAccessToken, newRefreshToken, expiresIn, err = s.refresh115Token(storage)
-	default:
-		s.logger.Warnf("不支持的存储类型: %s", storage.StorageType)
+	token, err := s.refreshToken(storage)
+	if errors.Is(err, ErrStorageOperationUnsupported) {
+		s.logger.Debugf("存储[%s]类型 %s 无需刷新令牌", storage.StorageName, storage.StorageType)
 		return
 	}
 
 	if err != nil {
 		s.logger.Errorf("刷新存储[%s]令牌失败: %v", storage.StorageName, err)
+		tokenRefreshFailuresMetric.Inc(storage.StorageType)
 		storage.SetError(err)
 	} else {
 		s.logger.Infof("成功刷新存储[%s]的令牌", storage.StorageName)
-		storage.UpdateTokens(newAccessToken, newRefreshToken, expiresIn)
+		if storage.ProviderUID == "" && token.ProviderUID != "" {
+			storage.ProviderUID = token.ProviderUID
+			s.logger.Infof("已回填云盘账号标识: storage=%s, provider_uid=%s", storage.StorageName, storage.ProviderUID)
+		}
+		storage.UpdateTokens(token.AccessToken, token.RefreshToken, token.ExpiresIn)
 	}
 
 	// 保存更新
@@ -159,65 +154,20 @@ func (s *TokenRefreshService) refreshStorageToken(storage *model.CloudStorage) {
 	}
 }
 
-// refresh115Token 刷新115网盘令牌
-func (s *TokenRefreshService) refresh115Token(storage *model.CloudStorage) (string, string, int64, error) {
-	s.logger.Debugf("开始刷新115存储[%s]的令牌", storage.StorageName)
-
-	// 验证必要的参数
-	if storage.RefreshToken == "" {
-		return "", "", 0, fmt.Errorf("刷新令牌为空，无法刷新")
+// refreshToken 通过存储驱动刷新令牌，不同云盘的刷新细节由驱动实现。
+func (s *TokenRefreshService) refreshToken(storage *model.CloudStorage) (StorageToken, error) {
+	drv, err := NewStorageDriver(*storage, s.logger)
+	if err != nil {
+		s.logger.Warnf("不支持的存储类型: %s", storage.StorageType)
+		return StorageToken{}, ErrStorageOperationUnsupported
 	}
 
-	// 创建115 SDK客户端，设置当前的访问令牌和刷新令牌
-	client := sdk115.New(
-		sdk115.WithAccessToken(storage.AccessToken),
-		sdk115.WithRefreshToken(storage.RefreshToken),
-	)
-
 	// 调用刷新令牌API，设置超时时间
 	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
 	defer cancel()
 
-	s.logger.Debugf("正在调用115刷新令牌API，存储[%s]", storage.StorageName)
-	tokenResp, err := client.RefreshToken(ctx)
-	if err != nil {
-		// 检查是否是刷新令牌过期的错误
-		if ctx.Err() == context.DeadlineExceeded {
-			return "", "", 0, fmt.Errorf("刷新令牌请求超时")
-		}
-		return "", "", 0, fmt.Errorf("调用115刷新令牌API失败: %w", err)
-	}
-
-	if tokenResp == nil {
-		return "", "", 0, fmt.Errorf("115刷新令牌响应为空")
-	}
-
-	// 验证返回的令牌
-	if tokenResp.AccessToken == "" {
-		return "", "", 0, fmt.Errorf("115返回的访问令牌为空")
-	}
-
-	// 如果没有返回新的刷新令牌，使用原来的刷新令牌
-	newRefreshToken := tokenResp.RefreshToken
-	if newRefreshToken == "" {
-		s.logger.Debugf("115未返回新的刷新令牌，继续使用原刷新令牌")
-		newRefreshToken = storage.RefreshToken
-	}
-
-	s.logger.Infof("成功刷新115存储[%s]的令牌，新令牌过期时间: %d秒", storage.StorageName, tokenResp.ExpiresIn)
-
-	// 回填 provider_uid（仅在空时触发，避免对旧数据不断重试）
-	if storage.ProviderUID == "" {
-		tokenedClient := sdk115.New(sdk115.WithAccessToken(tokenResp.AccessToken))
-		if info, infoErr := tokenedClient.UserInfo(ctx); infoErr != nil {
-			s.logger.Warnf("回填115账号标识失败(storage=%s): %v", storage.StorageName, infoErr)
-		} else if info != nil && info.UserID != 0 {
-			storage.ProviderUID = strconv.FormatInt(info.UserID, 10)
-			s.logger.Infof("已回填115账号标识: storage=%s, provider_uid=%s", storage.StorageName, storage.ProviderUID)
-		}
-	}
-
-	return tokenResp.AccessToken, newRefreshToken, tokenResp.ExpiresIn, nil
+	s.logger.Debugf("正在调用%s刷新令牌API，存储[%s]", drv.Type(), storage.StorageName)
+	return drv.RefreshToken(ctx)
 }
 
 // ManualRefresh 手动刷新指定存储的令牌
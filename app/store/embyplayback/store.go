@@ -18,6 +18,7 @@ type Event struct {
 	PlaySessionID string
 	RemoteIP      string
 	UserAgent     string
+	EmbyUserID    string
 	Timestamp     time.Time
 }
 
@@ -28,6 +29,7 @@ type Session struct {
 	PlaySessionID       string
 	RemoteIP            string
 	UserAgent           string
+	EmbyUserID          string
 	MediaPath           string
 	Match302ID          uint
 	AssignmentID        uint
@@ -90,6 +92,7 @@ func (s *Store) MarkActive(event Event) {
 	session.PlaySessionID = firstNonEmpty(event.PlaySessionID, session.PlaySessionID)
 	session.RemoteIP = firstNonEmpty(event.RemoteIP, session.RemoteIP)
 	session.UserAgent = firstNonEmpty(event.UserAgent, session.UserAgent)
+	session.EmbyUserID = firstNonEmpty(event.EmbyUserID, session.EmbyUserID)
 	session.LastEventAt = event.Timestamp
 	if session.StartedAt.IsZero() {
 		session.StartedAt = event.Timestamp
@@ -156,6 +159,7 @@ func (s *Store) AttachRedirect(entry embyproxylog.Entry) {
 	session.RemoteIP = firstNonEmpty(entry.RemoteIP, session.RemoteIP)
 	session.UserAgent = firstNonEmpty(entry.UserAgent, session.UserAgent)
 	session.MediaPath = firstNonEmpty(entry.MediaPath, session.MediaPath)
+	session.EmbyUserID = firstNonEmpty(entry.EmbyUserID, session.EmbyUserID)
 	session.Match302ID = entry.Match302ID
 	session.AssignmentID = entry.AssignmentID
 	session.AssignedStorageID = entry.AssignedStorageID
@@ -206,6 +210,35 @@ func (s *Store) ActiveCountsByStorageExcept(excludeKey string) map[uint]int {
 	return counts
 }
 
+// ActiveCountByUserExcept 统计某个 Emby 用户当前的播放会话数，excludeKey 对应的会话不计入。
+func (s *Store) ActiveCountByUserExcept(embyUserID, excludeKey string) int {
+	embyUserID = strings.TrimSpace(embyUserID)
+	if embyUserID == "" {
+		return 0
+	}
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+
+	count := 0
+	for key, session := range s.sessions {
+		if key != excludeKey && session.EmbyUserID == embyUserID {
+			count++
+		}
+	}
+	return count
+}
+
+// FindSessionKey 查找与播放请求对应的现有会话。
+func (s *Store) FindSessionKey(itemID, mediaSourceID, remoteIP, userAgent string) (string, bool) {
+	now := time.Now()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pruneLocked(now)
+	return s.findSessionKeyLocked(itemID, mediaSourceID, remoteIP, userAgent)
+}
+
 func (s *Store) Clear() {
 	s.mu.Lock()
 	s.sessions = map[string]Session{}
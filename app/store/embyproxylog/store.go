@@ -12,7 +12,7 @@ import (
 type Entry struct {
 	ID                  uint64    `json:"id"`
 	Timestamp           time.Time `json:"timestamp"`
-	Source              string    `json:"source"` // cache / proxyPlay / fallback
+	Source              string    `json:"source"` // cache / proxyPlay / stream / fallback / limited / denied
 	Method              string    `json:"method"`
 	URI                 string    `json:"uri"`
 	UserAgent           string    `json:"user_agent"`
@@ -30,6 +30,18 @@ type Entry struct {
 	AccountType         string    `json:"account_type,omitempty"`
 	BalanceStatus       string    `json:"balance_status,omitempty"`
 	FallbackReason      string    `json:"fallback_reason,omitempty"`
+	EmbyUserID          string    `json:"emby_user_id,omitempty"`
+	EmbyUserName        string    `json:"emby_user_name,omitempty"`
+	Attempts            []Attempt `json:"attempts,omitempty"` // 依次尝试过的存储，主存储失败后才会有多条
+}
+
+// Attempt 一次获取直链的尝试
+type Attempt struct {
+	StorageID   uint   `json:"storage_id"`
+	StorageName string `json:"storage_name,omitempty"`
+	Path        string `json:"path,omitempty"`
+	Role        string `json:"role"` // primary / member / source / fallback
+	Error       string `json:"error,omitempty"`
 }
 
 func (e Entry) PlaybackKey() string {
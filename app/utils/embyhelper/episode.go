@@ -0,0 +1,92 @@
+package embyhelper
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// EpisodeItem 剧集单集(精简字段)，用于预取后续集。
+type EpisodeItem struct {
+	ID                string `json:"Id"`
+	Name              string `json:"Name"`
+	Type              string `json:"Type"`
+	Path              string `json:"Path"`
+	SeriesID          string `json:"SeriesId"`
+	IndexNumber       *int   `json:"IndexNumber"`       // 集号
+	ParentIndexNumber *int   `json:"ParentIndexNumber"` // 季号
+	LocationType      string `json:"LocationType"`      // Virtual 表示缺失的集
+
+	MediaSources []EpisodeMediaSource `json:"MediaSources"`
+}
+
+// EpisodeMediaSource 单集的媒体源；STRM 场景下 Path 为 STRM 内容指向的路径
+type EpisodeMediaSource struct {
+	ID   string `json:"Id"`
+	Path string `json:"Path"`
+}
+
+type episodeItemsResp struct {
+	Items []EpisodeItem `json:"Items"`
+}
+
+// NextEpisodes 返回 itemID 之后的最多 count 集(按 Emby 剧集顺序，可跨季)。
+// itemID 不是剧集单集时返回空列表；缺失(Virtual)或无路径的集会被跳过。
+func (e *EmbyClient) NextEpisodes(itemID string, count int) ([]EpisodeItem, error) {
+	itemID = strings.TrimSpace(itemID)
+	if itemID == "" {
+		return nil, fmt.Errorf("itemID 不能为空")
+	}
+	if count <= 0 {
+		return nil, nil
+	}
+
+	var current episodeItemsResp
+	r, err := e.client.R().
+		SetQueryParam("Ids", itemID).
+		SetQueryParam("Fields", "Path").
+		SetQueryParam("Limit", "1").
+		SetResult(&current).
+		Get("/Items")
+	if err != nil {
+		return nil, fmt.Errorf("请求 Emby 条目信息失败: %w", err)
+	}
+	if r.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("Emby 条目信息 HTTP %d: %s", r.StatusCode(), truncate(r.String(), 256))
+	}
+	if len(current.Items) == 0 || current.Items[0].Type != "Episode" || current.Items[0].SeriesID == "" {
+		return nil, nil
+	}
+
+	req := e.client.R().
+		SetQueryParam("StartItemId", itemID).
+		SetQueryParam("Fields", "Path,MediaSources").
+		// 多取几条，抵掉当前集与缺失的集
+		SetQueryParam("Limit", strconv.Itoa(count*2+1)).
+		SetQueryParam("EnableImages", "false").
+		SetQueryParam("EnableUserData", "false")
+	if uid := strings.TrimSpace(e.config.Emby.AdminUserID); uid != "" {
+		req = req.SetQueryParam("UserId", uid)
+	}
+	var resp episodeItemsResp
+	r, err = req.SetResult(&resp).Get(fmt.Sprintf("/Shows/%s/Episodes", current.Items[0].SeriesID))
+	if err != nil {
+		return nil, fmt.Errorf("请求 Emby 剧集列表失败: %w", err)
+	}
+	if r.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("Emby 剧集列表 HTTP %d: %s", r.StatusCode(), truncate(r.String(), 256))
+	}
+
+	out := make([]EpisodeItem, 0, count)
+	for _, item := range resp.Items {
+		if item.ID == itemID || strings.EqualFold(item.LocationType, "Virtual") || (strings.TrimSpace(item.Path) == "" && len(item.MediaSources) == 0) {
+			continue
+		}
+		out = append(out, item)
+		if len(out) == count {
+			break
+		}
+	}
+	return out, nil
+}
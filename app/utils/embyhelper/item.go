@@ -62,6 +62,7 @@ type GetEmbyItemsResult struct {
 	ID                  string
 	Protocol            string
 	Path                string
+	Size                int64 // 媒体源文件大小(字节)，Emby 未返回时为 0
 	NeedAddMediaStreams bool
 }
 
@@ -153,6 +154,9 @@ func GetEmbyItems(itemInfoUri string, itemId string, etag string, mediaSourceId
 
 		rvt.Protocol = mediaSource["Protocol"].(string)
 		rvt.Path = mediaSource["Path"].(string)
+		if size, ok := mediaSource["Size"].(float64); ok {
+			rvt.Size = int64(size)
+		}
 
 		mediaStreams, exists := mediaSource["MediaStreams"]
 		if !exists || len(mediaStreams.([]any)) == 0 {
@@ -172,6 +172,29 @@ func (e *EmbyClient) ListLibraries() ([]EmbyLibrary, error) {
 	return out, nil
 }
 
+// EmbyVirtualFolder 媒体库及其在 Emby 服务器上的目录
+type EmbyVirtualFolder struct {
+	ItemID         string   `json:"ItemId"`
+	Name           string   `json:"Name"`
+	CollectionType string   `json:"CollectionType"`
+	Locations      []string `json:"Locations"`
+}
+
+// ListVirtualFolders 列出媒体库及其目录(/Library/VirtualFolders)，用于由文件路径反查所属媒体库
+func (e *EmbyClient) ListVirtualFolders() ([]EmbyVirtualFolder, error) {
+	var folders []EmbyVirtualFolder
+	r, err := e.client.R().
+		SetResult(&folders).
+		Get("/Library/VirtualFolders")
+	if err != nil {
+		return nil, fmt.Errorf("请求 Emby 媒体库目录失败: %w", err)
+	}
+	if r.StatusCode() != http.StatusOK {
+		return nil, fmt.Errorf("Emby 媒体库目录 HTTP %d: %s", r.StatusCode(), truncate(r.String(), 256))
+	}
+	return folders, nil
+}
+
 // itemPathResp /Items?Ids=... 取条目 Path 的响应
 type itemPathResp struct {
 	Items []struct {
@@ -0,0 +1,358 @@
+package mediaprobe
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strings"
+)
+
+// Matroska/WebM 元素 ID
+const (
+	mkvEBML          = 0x1A45DFA3
+	mkvDocType       = 0x4282
+	mkvSegment       = 0x18538067
+	mkvInfo          = 0x1549A966
+	mkvTimecodeScale = 0x2AD7B1
+	mkvDuration      = 0x4489
+	mkvTitle         = 0x7BA9
+	mkvTracks        = 0x1654AE6B
+	mkvTrackEntry    = 0xAE
+	mkvTrackType     = 0x83
+	mkvFlagDefault   = 0x88
+	mkvCodecID       = 0x86
+	mkvLanguage      = 0x22B59C
+	mkvLanguageIETF  = 0x22B59D
+	mkvName          = 0x536E
+	mkvVideo         = 0xE0
+	mkvPixelWidth    = 0xB0
+	mkvPixelHeight   = 0xBA
+	mkvAudio         = 0xE1
+	mkvSamplingFreq  = 0xB5
+	mkvChannels      = 0x9F
+	mkvCluster       = 0x1F43B675
+)
+
+// mkvUnknownSize 表示未知长度(直播流等)的元素
+const mkvUnknownSize = -1
+
+// mkvMaxElementSize 单个元数据元素的读取上限，防止异常文件耗尽内存
+const mkvMaxElementSize = 16 << 20
+
+func probeMatroska(r io.ReadSeeker) (*Info, error) {
+	info := &Info{Container: "mkv"}
+
+	id, size, err := readMkvElementHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != mkvEBML {
+		return nil, ErrUnsupportedContainer
+	}
+	header, err := readMkvPayload(r, size)
+	if err != nil {
+		return nil, err
+	}
+	_ = walkMkvChildren(header, func(childID uint32, data []byte) error {
+		if childID == mkvDocType && string(data) == "webm" {
+			info.Container = "webm"
+		}
+		return nil
+	})
+
+	id, size, err = readMkvElementHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	if id != mkvSegment {
+		return nil, fmt.Errorf("未找到 Matroska Segment")
+	}
+	segmentStart, _ := r.Seek(0, io.SeekCurrent)
+
+	timecodeScale := uint64(1000000)
+	var rawDuration float64
+	var haveInfo, haveTracks bool
+	for !haveInfo || !haveTracks {
+		pos, _ := r.Seek(0, io.SeekCurrent)
+		if size != mkvUnknownSize && pos >= segmentStart+size {
+			break
+		}
+		childID, childSize, err := readMkvElementHeader(r)
+		if err != nil {
+			if errors.Is(err, io.EOF) && (haveInfo || haveTracks) {
+				break
+			}
+			return nil, err
+		}
+		switch childID {
+		case mkvInfo:
+			data, err := readMkvPayload(r, childSize)
+			if err != nil {
+				return nil, err
+			}
+			_ = walkMkvChildren(data, func(fieldID uint32, field []byte) error {
+				switch fieldID {
+				case mkvTimecodeScale:
+					timecodeScale = mkvUint(field)
+				case mkvDuration:
+					rawDuration = mkvFloat(field)
+				case mkvTitle:
+					info.Title = string(field)
+				}
+				return nil
+			})
+			haveInfo = true
+		case mkvTracks:
+			data, err := readMkvPayload(r, childSize)
+			if err != nil {
+				return nil, err
+			}
+			_ = walkMkvChildren(data, func(entryID uint32, entry []byte) error {
+				if entryID == mkvTrackEntry {
+					if stream, ok := parseMkvTrackEntry(entry); ok {
+						info.Streams = append(info.Streams, stream)
+					}
+				}
+				return nil
+			})
+			haveTracks = true
+		case mkvCluster:
+			// 媒体数据开始，元数据通常已读完
+			haveInfo, haveTracks = true, true
+		default:
+			if childSize == mkvUnknownSize {
+				return nil, fmt.Errorf("无法跳过未知长度的元素 0x%X", childID)
+			}
+			if _, err := r.Seek(childSize, io.SeekCurrent); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if len(info.Streams) == 0 {
+		return nil, fmt.Errorf("未解析到 Matroska 轨道信息")
+	}
+	info.DurationSeconds = rawDuration * float64(timecodeScale) / 1e9
+	return info, nil
+}
+
+func parseMkvTrackEntry(data []byte) (Stream, bool) {
+	stream := Stream{IsDefault: true, Language: "eng"}
+	var trackType uint64
+	var codecID, languageIETF string
+	_ = walkMkvChildren(data, func(id uint32, field []byte) error {
+		switch id {
+		case mkvTrackType:
+			trackType = mkvUint(field)
+		case mkvFlagDefault:
+			stream.IsDefault = mkvUint(field) == 1
+		case mkvCodecID:
+			codecID = string(field)
+		case mkvLanguage:
+			stream.Language = string(field)
+		case mkvLanguageIETF:
+			languageIETF = string(field)
+		case mkvName:
+			stream.Title = string(field)
+		case mkvVideo:
+			_ = walkMkvChildren(field, func(videoID uint32, v []byte) error {
+				switch videoID {
+				case mkvPixelWidth:
+					stream.Width = int(mkvUint(v))
+				case mkvPixelHeight:
+					stream.Height = int(mkvUint(v))
+				}
+				return nil
+			})
+		case mkvAudio:
+			stream.Channels = 1
+			_ = walkMkvChildren(field, func(audioID uint32, a []byte) error {
+				switch audioID {
+				case mkvSamplingFreq:
+					stream.SampleRate = int(mkvFloat(a))
+				case mkvChannels:
+					stream.Channels = int(mkvUint(a))
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	switch trackType {
+	case 1:
+		stream.Type = StreamVideo
+	case 2:
+		stream.Type = StreamAudio
+		if stream.SampleRate == 0 {
+			stream.SampleRate = 8000
+		}
+	case 17:
+		stream.Type = StreamSubtitle
+	default:
+		return stream, false
+	}
+	if languageIETF != "" {
+		stream.Language = languageIETF
+	}
+	stream.Codec = mkvCodecName(codecID)
+	return stream, true
+}
+
+// mkvCodecName 将 Matroska CodecID 转为 Emby/ffmpeg 使用的编码名
+func mkvCodecName(codecID string) string {
+	switch {
+	case strings.HasPrefix(codecID, "V_MPEGH/ISO/HEVC"):
+		return "hevc"
+	case strings.HasPrefix(codecID, "V_MPEG4/ISO/AVC"):
+		return "h264"
+	case codecID == "V_AV1":
+		return "av1"
+	case codecID == "V_VP9":
+		return "vp9"
+	case codecID == "V_VP8":
+		return "vp8"
+	case strings.HasPrefix(codecID, "V_MPEG2"):
+		return "mpeg2video"
+	case strings.HasPrefix(codecID, "V_MPEG4/ISO"):
+		return "mpeg4"
+	case strings.HasPrefix(codecID, "A_AAC"):
+		return "aac"
+	case codecID == "A_AC3":
+		return "ac3"
+	case codecID == "A_EAC3":
+		return "eac3"
+	case strings.HasPrefix(codecID, "A_DTS"):
+		return "dts"
+	case codecID == "A_TRUEHD":
+		return "truehd"
+	case codecID == "A_FLAC":
+		return "flac"
+	case codecID == "A_OPUS":
+		return "opus"
+	case codecID == "A_VORBIS":
+		return "vorbis"
+	case strings.HasPrefix(codecID, "A_MPEG/L3"):
+		return "mp3"
+	case strings.HasPrefix(codecID, "A_PCM"):
+		return "pcm"
+	case codecID == "S_TEXT/UTF8":
+		return "subrip"
+	case codecID == "S_TEXT/ASS", codecID == "S_TEXT/SSA", codecID == "S_ASS", codecID == "S_SSA":
+		return "ass"
+	case codecID == "S_HDMV/PGS":
+		return "pgssub"
+	case codecID == "S_VOBSUB":
+		return "dvdsub"
+	case codecID == "S_TEXT/WEBVTT":
+		return "webvtt"
+	}
+	return strings.ToLower(codecID)
+}
+
+// readMkvElementHeader 读取元素 ID 与长度；长度全 1 时返回 mkvUnknownSize
+func readMkvElementHeader(r io.Reader) (uint32, int64, error) {
+	id, _, err := readMkvVint(r, 4, false)
+	if err != nil {
+		return 0, 0, err
+	}
+	size, sizeLen, err := readMkvVint(r, 8, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size == (uint64(1)<<(7*sizeLen))-1 {
+		return uint32(id), mkvUnknownSize, nil
+	}
+	if size > math.MaxInt64 {
+		return 0, 0, fmt.Errorf("元素长度异常")
+	}
+	return uint32(id), int64(size), nil
+}
+
+// readMkvVint 读取 EBML 变长整数；stripMarker=false 时保留长度标记位(用于元素 ID)
+func readMkvVint(r io.Reader, maxLen int, stripMarker bool) (uint64, int, error) {
+	first := make([]byte, 1)
+	if _, err := io.ReadFull(r, first); err != nil {
+		return 0, 0, err
+	}
+	length := 1
+	for mask := byte(0x80); length <= maxLen && first[0]&mask == 0; mask >>= 1 {
+		length++
+	}
+	if length > maxLen {
+		return 0, 0, fmt.Errorf("无效的 EBML 变长整数")
+	}
+	value := uint64(first[0])
+	if stripMarker {
+		value &= uint64(0xFF >> length)
+	}
+	rest := make([]byte, length-1)
+	if _, err := io.ReadFull(r, rest); err != nil {
+		return 0, 0, err
+	}
+	for _, b := range rest {
+		value = value<<8 | uint64(b)
+	}
+	return value, length, nil
+}
+
+func readMkvPayload(r io.Reader, size int64) ([]byte, error) {
+	if size < 0 || size > mkvMaxElementSize {
+		return nil, fmt.Errorf("元素长度异常: %d", size)
+	}
+	data := make([]byte, size)
+	_, err := io.ReadFull(r, data)
+	return data, err
+}
+
+// walkMkvChildren 遍历内存中的子元素
+func walkMkvChildren(data []byte, fn func(id uint32, payload []byte) error) error {
+	reader := &sliceReader{data: data}
+	for reader.pos < len(data) {
+		id, size, err := readMkvElementHeader(reader)
+		if err != nil {
+			return err
+		}
+		if size == mkvUnknownSize || int64(reader.pos)+size > int64(len(data)) {
+			return fmt.Errorf("子元素越界")
+		}
+		payload := data[reader.pos : reader.pos+int(size)]
+		reader.pos += int(size)
+		if err := fn(id, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func mkvUint(data []byte) uint64 {
+	var v uint64
+	for _, b := range data {
+		v = v<<8 | uint64(b)
+	}
+	return v
+}
+
+func mkvFloat(data []byte) float64 {
+	switch len(data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(data))
+	}
+	return 0
+}
+
+type sliceReader struct {
+	data []byte
+	pos  int
+}
+
+func (s *sliceReader) Read(p []byte) (int, error) {
+	if s.pos >= len(s.data) {
+		return 0, io.EOF
+	}
+	n := copy(p, s.data[s.pos:])
+	s.pos += n
+	return n, nil
+}
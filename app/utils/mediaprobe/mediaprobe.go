@@ -0,0 +1,170 @@
+// Package mediaprobe 从视频文件头部解析容器、时长、分辨率与音视频/字幕轨道信息。
+// 只读取容器元数据(MKV 的 Info/Tracks，MP4 的 moov)，不解码媒体数据，
+// 适合配合 HTTP Range 读取网盘文件的前几 MB。
+package mediaprobe
+
+import (
+	"errors"
+	"fmt"
+	"io"
+)
+
+// ErrUnsupportedContainer 不支持的容器格式
+var ErrUnsupportedContainer = errors.New("不支持的容器格式")
+
+// ErrProbeLimit 读取超出探测预算
+var ErrProbeLimit = errors.New("超出探测读取上限")
+
+// 轨道类型，取值与 Emby MediaStream.Type 一致
+const (
+	StreamVideo    = "Video"
+	StreamAudio    = "Audio"
+	StreamSubtitle = "Subtitle"
+)
+
+// Info 媒体文件的技术信息
+type Info struct {
+	Container       string   `json:"container"`
+	DurationSeconds float64  `json:"duration_seconds"`
+	Size            int64    `json:"size"`
+	Bitrate         int64    `json:"bitrate"`
+	Title           string   `json:"title,omitempty"`
+	Streams         []Stream `json:"streams"`
+}
+
+// Stream 单条轨道
+type Stream struct {
+	Index      int    `json:"index"`
+	Type       string `json:"type"`
+	Codec      string `json:"codec"`
+	Language   string `json:"language,omitempty"`
+	Title      string `json:"title,omitempty"`
+	IsDefault  bool   `json:"is_default"`
+	Width      int    `json:"width,omitempty"`
+	Height     int    `json:"height,omitempty"`
+	Channels   int    `json:"channels,omitempty"`
+	SampleRate int    `json:"sample_rate,omitempty"`
+}
+
+// VideoStream 返回第一条视频轨道
+func (i *Info) VideoStream() *Stream {
+	for idx := range i.Streams {
+		if i.Streams[idx].Type == StreamVideo {
+			return &i.Streams[idx]
+		}
+	}
+	return nil
+}
+
+// Probe 解析 r 中的媒体文件。size 为文件总大小(未知时传 0)，maxBytes 限制实际读取的字节数(0 表示不限制)。
+func Probe(r io.ReadSeeker, size, maxBytes int64) (*Info, error) {
+	br := newBufferedReadSeeker(r, size, maxBytes)
+	head := make([]byte, 12)
+	if _, err := io.ReadFull(br, head); err != nil {
+		return nil, fmt.Errorf("读取文件头失败: %w", err)
+	}
+	if _, err := br.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var info *Info
+	var err error
+	switch {
+	case head[0] == 0x1A && head[1] == 0x45 && head[2] == 0xDF && head[3] == 0xA3:
+		info, err = probeMatroska(br)
+	case string(head[4:8]) == "ftyp":
+		info, err = probeMP4(br, size)
+	default:
+		return nil, ErrUnsupportedContainer
+	}
+	if err != nil {
+		return nil, err
+	}
+	info.Size = size
+	if size > 0 && info.DurationSeconds > 0 {
+		info.Bitrate = int64(float64(size*8) / info.DurationSeconds)
+	}
+	for idx := range info.Streams {
+		info.Streams[idx].Index = idx
+	}
+	return info, nil
+}
+
+// bufferedReadSeeker 以固定块读取底层 ReadSeeker，避免逐字节解析时产生大量 Range 请求
+type bufferedReadSeeker struct {
+	r         io.ReadSeeker
+	size      int64
+	maxBytes  int64
+	fetched   int64
+	buf       []byte
+	bufOffset int64
+	offset    int64
+}
+
+const probeChunkSize = 256 << 10
+
+func newBufferedReadSeeker(r io.ReadSeeker, size, maxBytes int64) *bufferedReadSeeker {
+	return &bufferedReadSeeker{r: r, size: size, maxBytes: maxBytes}
+}
+
+func (b *bufferedReadSeeker) Read(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+	if b.offset < b.bufOffset || b.offset >= b.bufOffset+int64(len(b.buf)) {
+		if err := b.fill(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, b.buf[b.offset-b.bufOffset:])
+	b.offset += int64(n)
+	return n, nil
+}
+
+func (b *bufferedReadSeeker) fill() error {
+	if b.size > 0 && b.offset >= b.size {
+		return io.EOF
+	}
+	chunk := int64(probeChunkSize)
+	if b.size > 0 && b.offset+chunk > b.size {
+		chunk = b.size - b.offset
+	}
+	if b.maxBytes > 0 && b.fetched+chunk > b.maxBytes {
+		return ErrProbeLimit
+	}
+	if _, err := b.r.Seek(b.offset, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, chunk)
+	n, err := io.ReadFull(b.r, buf)
+	if n == 0 {
+		if err == nil || errors.Is(err, io.ErrUnexpectedEOF) {
+			err = io.EOF
+		}
+		return err
+	}
+	b.fetched += int64(n)
+	b.buf = buf[:n]
+	b.bufOffset = b.offset
+	return nil
+}
+
+func (b *bufferedReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += b.offset
+	case io.SeekEnd:
+		if b.size <= 0 {
+			return 0, errors.New("文件大小未知，无法从末尾定位")
+		}
+		offset += b.size
+	default:
+		return 0, fmt.Errorf("invalid whence: %d", whence)
+	}
+	if offset < 0 {
+		return 0, errors.New("negative offset")
+	}
+	b.offset = offset
+	return offset, nil
+}
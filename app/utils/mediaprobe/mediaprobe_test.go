@@ -0,0 +1,156 @@
+package mediaprobe
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+// ebml 拼接一个 EBML 元素(长度统一用 8 字节编码)
+func ebml(id uint32, payload ...[]byte) []byte {
+	var body []byte
+	for _, p := range payload {
+		body = append(body, p...)
+	}
+	var out []byte
+	for shift := 24; shift >= 0; shift -= 8 {
+		if b := byte(id >> shift); b != 0 || len(out) > 0 {
+			out = append(out, b)
+		}
+	}
+	size := make([]byte, 8)
+	binary.BigEndian.PutUint64(size, uint64(len(body)))
+	size[0] = 0x01
+	out = append(out, size...)
+	return append(out, body...)
+}
+
+func ebmlUint(id uint32, v uint64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, v)
+	return ebml(id, b)
+}
+
+func ebmlFloat(id uint32, v float64) []byte {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, math.Float64bits(v))
+	return ebml(id, b)
+}
+
+func TestProbeMatroska(t *testing.T) {
+	file := append(ebml(mkvEBML, ebml(mkvDocType, []byte("matroska"))),
+		ebml(mkvSegment,
+			ebml(0x114D9B74, make([]byte, 32)), // SeekHead，应被跳过
+			ebml(mkvInfo, ebmlUint(mkvTimecodeScale, 1000000), ebmlFloat(mkvDuration, 5400000)),
+			ebml(mkvTracks,
+				ebml(mkvTrackEntry,
+					ebmlUint(mkvTrackType, 1), ebml(mkvCodecID, []byte("V_MPEGH/ISO/HEVC")),
+					ebml(mkvVideo, ebmlUint(mkvPixelWidth, 3840), ebmlUint(mkvPixelHeight, 2160)),
+				),
+				ebml(mkvTrackEntry,
+					ebmlUint(mkvTrackType, 2), ebml(mkvCodecID, []byte("A_EAC3")),
+					ebml(mkvLanguage, []byte("chi")), ebmlUint(mkvFlagDefault, 0),
+					ebml(mkvAudio, ebmlFloat(mkvSamplingFreq, 48000), ebmlUint(mkvChannels, 6)),
+				),
+				ebml(mkvTrackEntry, ebmlUint(mkvTrackType, 17), ebml(mkvCodecID, []byte("S_TEXT/ASS"))),
+			),
+			ebml(mkvCluster, make([]byte, 64)),
+		)...)
+
+	info, err := Probe(bytes.NewReader(file), 1_000_000_000, 0)
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if info.Container != "mkv" || info.DurationSeconds != 5400 || len(info.Streams) != 3 {
+		t.Fatalf("info = %+v", info)
+	}
+	if info.Bitrate != 1_000_000_000*8/5400 {
+		t.Fatalf("bitrate = %d", info.Bitrate)
+	}
+	video := info.VideoStream()
+	if video == nil || video.Codec != "hevc" || video.Width != 3840 || video.Height != 2160 {
+		t.Fatalf("video = %+v", video)
+	}
+	audio := info.Streams[1]
+	if audio.Codec != "eac3" || audio.Channels != 6 || audio.SampleRate != 48000 || audio.Language != "chi" || audio.IsDefault {
+		t.Fatalf("audio = %+v", audio)
+	}
+	if sub := info.Streams[2]; sub.Type != StreamSubtitle || sub.Codec != "ass" || sub.Index != 2 {
+		t.Fatalf("subtitle = %+v", sub)
+	}
+}
+
+func box(typ string, payload ...[]byte) []byte {
+	var body []byte
+	for _, p := range payload {
+		body = append(body, p...)
+	}
+	out := make([]byte, 8, 8+len(body))
+	binary.BigEndian.PutUint32(out, uint32(8+len(body)))
+	copy(out[4:], typ)
+	return append(out, body...)
+}
+
+func mp4Trak(handler, codec string, tkhdWidth, tkhdHeight uint32, entry []byte) []byte {
+	tkhd := make([]byte, 84)
+	tkhd[3] = 0x1 // enabled
+	binary.BigEndian.PutUint32(tkhd[76:], tkhdWidth<<16)
+	binary.BigEndian.PutUint32(tkhd[80:], tkhdHeight<<16)
+	mdhd := make([]byte, 24)
+	binary.BigEndian.PutUint16(mdhd[20:], uint16(('j'-0x60)<<10|('p'-0x60)<<5|('n'-0x60)))
+	hdlr := make([]byte, 24)
+	copy(hdlr[8:], handler)
+	stsd := make([]byte, 8)
+	binary.BigEndian.PutUint32(stsd[4:], 1)
+	return box("trak",
+		box("tkhd", tkhd),
+		box("mdia",
+			box("mdhd", mdhd),
+			box("hdlr", hdlr),
+			box("minf", box("stbl", box("stsd", stsd, box(codec, entry)))),
+		),
+	)
+}
+
+func TestProbeMP4WithTrailingMoov(t *testing.T) {
+	mvhd := make([]byte, 100)
+	binary.BigEndian.PutUint32(mvhd[12:], 1000)
+	binary.BigEndian.PutUint32(mvhd[16:], 1_500_000)
+	audioEntry := make([]byte, 28)
+	binary.BigEndian.PutUint16(audioEntry[16:], 2)
+	binary.BigEndian.PutUint32(audioEntry[24:], 44100<<16)
+
+	file := append(box("ftyp", []byte("isom0000")), box("mdat", make([]byte, 4096))...)
+	file = append(file, box("moov",
+		box("mvhd", mvhd),
+		mp4Trak("vide", "avc1", 1920, 1080, make([]byte, 78)),
+		mp4Trak("soun", "mp4a", 0, 0, audioEntry),
+	)...)
+
+	info, err := Probe(bytes.NewReader(file), int64(len(file)), 0)
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	if info.Container != "mp4" || info.DurationSeconds != 1500 || len(info.Streams) != 2 {
+		t.Fatalf("info = %+v", info)
+	}
+	video := info.VideoStream()
+	if video.Codec != "h264" || video.Width != 1920 || video.Height != 1080 || video.Language != "jpn" {
+		t.Fatalf("video = %+v", video)
+	}
+	if audio := info.Streams[1]; audio.Codec != "aac" || audio.Channels != 2 || audio.SampleRate != 44100 {
+		t.Fatalf("audio = %+v", audio)
+	}
+}
+
+func TestProbeRespectsReadLimit(t *testing.T) {
+	file := append(box("ftyp", []byte("isom0000")), box("mdat", make([]byte, 2*probeChunkSize))...)
+	file = append(file, box("moov", box("mvhd", make([]byte, 100)))...)
+	if _, err := Probe(bytes.NewReader(file), int64(len(file)), probeChunkSize); err == nil {
+		t.Fatal("probe should stop once the read budget is exhausted")
+	}
+	if _, err := Probe(bytes.NewReader([]byte("not a media file")), 16, 0); err != ErrUnsupportedContainer {
+		t.Fatalf("err = %v, want ErrUnsupportedContainer", err)
+	}
+}
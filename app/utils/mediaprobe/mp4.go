@@ -0,0 +1,248 @@
+package mediaprobe
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// mp4MaxMoovSize moov 读取上限，超出视为异常文件
+const mp4MaxMoovSize = 32 << 20
+
+type mp4Box struct {
+	typ     string
+	payload []byte
+}
+
+func probeMP4(r io.ReadSeeker, size int64) (*Info, error) {
+	moov, err := findMP4Moov(r, size)
+	if err != nil {
+		return nil, err
+	}
+	info := &Info{Container: "mp4"}
+	for _, box := range splitMP4Boxes(moov) {
+		switch box.typ {
+		case "mvhd":
+			timescale, duration := parseMP4TimeHeader(box.payload, 12, 20)
+			if timescale > 0 {
+				info.DurationSeconds = float64(duration) / float64(timescale)
+			}
+		case "trak":
+			if stream, ok := parseMP4Trak(box.payload); ok {
+				info.Streams = append(info.Streams, stream)
+			}
+		}
+	}
+	if len(info.Streams) == 0 {
+		return nil, fmt.Errorf("未解析到 MP4 轨道信息")
+	}
+	return info, nil
+}
+
+// findMP4Moov 依次跳过顶层 box 找到 moov；moov 位于文件末尾时依赖 Seek 直接跳过 mdat
+func findMP4Moov(r io.ReadSeeker, size int64) ([]byte, error) {
+	var offset int64
+	header := make([]byte, 16)
+	for size <= 0 || offset < size {
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+		if _, err := io.ReadFull(r, header[:8]); err != nil {
+			return nil, fmt.Errorf("未找到 moov: %w", err)
+		}
+		boxSize := int64(binary.BigEndian.Uint32(header[:4]))
+		typ := string(header[4:8])
+		headerLen := int64(8)
+		switch boxSize {
+		case 1:
+			if _, err := io.ReadFull(r, header[8:16]); err != nil {
+				return nil, err
+			}
+			boxSize = int64(binary.BigEndian.Uint64(header[8:16]))
+			headerLen = 16
+		case 0:
+			if size <= 0 {
+				return nil, fmt.Errorf("未找到 moov")
+			}
+			boxSize = size - offset
+		}
+		if boxSize < headerLen {
+			return nil, fmt.Errorf("MP4 box 长度异常: %s", typ)
+		}
+		if typ == "moov" {
+			if boxSize-headerLen > mp4MaxMoovSize {
+				return nil, fmt.Errorf("moov 过大: %d", boxSize)
+			}
+			payload := make([]byte, boxSize-headerLen)
+			if _, err := io.ReadFull(r, payload); err != nil {
+				return nil, err
+			}
+			return payload, nil
+		}
+		offset += boxSize
+	}
+	return nil, fmt.Errorf("未找到 moov")
+}
+
+func splitMP4Boxes(data []byte) []mp4Box {
+	var boxes []mp4Box
+	for pos := 0; pos+8 <= len(data); {
+		boxSize := int(binary.BigEndian.Uint32(data[pos : pos+4]))
+		typ := string(data[pos+4 : pos+8])
+		headerLen := 8
+		if boxSize == 1 && pos+16 <= len(data) {
+			boxSize = int(binary.BigEndian.Uint64(data[pos+8 : pos+16]))
+			headerLen = 16
+		} else if boxSize == 0 {
+			boxSize = len(data) - pos
+		}
+		if boxSize < headerLen || pos+boxSize > len(data) {
+			break
+		}
+		boxes = append(boxes, mp4Box{typ: typ, payload: data[pos+headerLen : pos+boxSize]})
+		pos += boxSize
+	}
+	return boxes
+}
+
+func findMP4Box(data []byte, path ...string) []byte {
+	for _, typ := range path {
+		found := false
+		for _, box := range splitMP4Boxes(data) {
+			if box.typ == typ {
+				data, found = box.payload, true
+				break
+			}
+		}
+		if !found {
+			return nil
+		}
+	}
+	return data
+}
+
+// parseMP4TimeHeader 解析 mvhd/mdhd 的 timescale 与 duration；
+// v0Offset/v1Offset 为版本 0/1 时 timescale 相对 payload 起始的偏移。
+func parseMP4TimeHeader(data []byte, v0Offset, v1Offset int) (uint32, uint64) {
+	if len(data) < 4 {
+		return 0, 0
+	}
+	if data[0] == 1 {
+		if len(data) < v1Offset+12 {
+			return 0, 0
+		}
+		return binary.BigEndian.Uint32(data[v1Offset:]), binary.BigEndian.Uint64(data[v1Offset+4:])
+	}
+	if len(data) < v0Offset+8 {
+		return 0, 0
+	}
+	return binary.BigEndian.Uint32(data[v0Offset:]), uint64(binary.BigEndian.Uint32(data[v0Offset+4:]))
+}
+
+func parseMP4Trak(trak []byte) (Stream, bool) {
+	stream := Stream{IsDefault: true}
+	mdia := findMP4Box(trak, "mdia")
+	hdlr := findMP4Box(mdia, "hdlr")
+	if len(hdlr) < 12 {
+		return stream, false
+	}
+	switch string(hdlr[8:12]) {
+	case "vide":
+		stream.Type = StreamVideo
+	case "soun":
+		stream.Type = StreamAudio
+	case "sbtl", "subt", "text":
+		stream.Type = StreamSubtitle
+	default:
+		return stream, false
+	}
+
+	if tkhd := findMP4Box(trak, "tkhd"); len(tkhd) >= 4 {
+		flags := uint32(tkhd[1])<<16 | uint32(tkhd[2])<<8 | uint32(tkhd[3])
+		stream.IsDefault = flags&0x1 != 0
+		// width/height 为 16.16 定点数，位于 tkhd 末尾 8 字节
+		if stream.Type == StreamVideo && len(tkhd) >= 84 {
+			stream.Width = int(binary.BigEndian.Uint32(tkhd[len(tkhd)-8:]) >> 16)
+			stream.Height = int(binary.BigEndian.Uint32(tkhd[len(tkhd)-4:]) >> 16)
+		}
+	}
+	if mdhd := findMP4Box(mdia, "mdhd"); len(mdhd) > 0 {
+		langOffset := 20
+		if mdhd[0] == 1 {
+			langOffset = 32
+		}
+		if len(mdhd) >= langOffset+2 {
+			stream.Language = mp4Language(binary.BigEndian.Uint16(mdhd[langOffset:]))
+		}
+	}
+
+	stsd := findMP4Box(mdia, "minf", "stbl", "stsd")
+	if len(stsd) >= 8 {
+		entries := splitMP4Boxes(stsd[8:])
+		if len(entries) > 0 {
+			entry := entries[0]
+			stream.Codec = mp4CodecName(entry.typ)
+			switch stream.Type {
+			case StreamVideo:
+				if len(entry.payload) >= 28 {
+					if w := int(binary.BigEndian.Uint16(entry.payload[24:])); w > 0 {
+						stream.Width = w
+					}
+					if h := int(binary.BigEndian.Uint16(entry.payload[26:])); h > 0 {
+						stream.Height = h
+					}
+				}
+			case StreamAudio:
+				if len(entry.payload) >= 28 {
+					stream.Channels = int(binary.BigEndian.Uint16(entry.payload[16:]))
+					stream.SampleRate = int(binary.BigEndian.Uint32(entry.payload[24:]) >> 16)
+				}
+			}
+		}
+	}
+	return stream, true
+}
+
+// mp4Language 解码 ISO-639-2/T 打包语言码(3 个 5 位字符)
+func mp4Language(packed uint16) string {
+	if packed == 0 || packed == 0x7FFF {
+		return "und"
+	}
+	return string([]byte{
+		byte(packed>>10&0x1F) + 0x60,
+		byte(packed>>5&0x1F) + 0x60,
+		byte(packed&0x1F) + 0x60,
+	})
+}
+
+func mp4CodecName(fourcc string) string {
+	switch fourcc {
+	case "avc1", "avc3":
+		return "h264"
+	case "hvc1", "hev1", "dvh1", "dvhe":
+		return "hevc"
+	case "av01":
+		return "av1"
+	case "vp09":
+		return "vp9"
+	case "mp4v":
+		return "mpeg4"
+	case "mp4a":
+		return "aac"
+	case "ac-3":
+		return "ac3"
+	case "ec-3":
+		return "eac3"
+	case "Opus":
+		return "opus"
+	case "fLaC":
+		return "flac"
+	case ".mp3":
+		return "mp3"
+	case "tx3g":
+		return "mov_text"
+	case "wvtt":
+		return "webvtt"
+	}
+	return fourcc
+}
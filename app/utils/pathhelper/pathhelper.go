@@ -153,6 +153,24 @@ func IsSubPath(candidate, prefix string) bool {
 	return candidatePath == prefixPath || strings.HasPrefix(candidatePath, prefixPath+"/")
 }
 
+// RebasePath 将位于 fromPrefix 内的 candidate 改写到 toPrefix 下，用于在不同视角(挂载点、下载器)的路径间映射。
+func RebasePath(candidate, fromPrefix, toPrefix string) (string, bool) {
+	if !IsSubPath(candidate, fromPrefix) {
+		return "", false
+	}
+	candidatePath, _ := NormalizeUntrustedPath(candidate)
+	fromPath, _ := NormalizeUntrustedPath(fromPrefix)
+	toPath, err := NormalizeUntrustedPath(toPrefix)
+	if err != nil {
+		return "", false
+	}
+	rest := candidatePath
+	if fromPath != "/" {
+		rest = strings.TrimPrefix(candidatePath, fromPath)
+	}
+	return path.Join(toPath, rest), true
+}
+
 // IsFileInAnyFilterRules 检查文件是否在任一过滤规则中（include 或 download）
 func IsFileInAnyFilterRules(filePath, filterRules string) bool {
 	if filterRules == "" {